@@ -1,5 +1,8 @@
 import requests
 import os
+import time
+import hmac
+import hashlib
 import feedparser
 import pandas as pd
 import streamlit as st
@@ -8,6 +11,33 @@ from .database import init_db_connection
 # --- Constants ---
 GO_API_URL = os.getenv("EXECUTION_ENGINE_URL", "http://localhost:8080")
 
+
+class SignedRequestAuth(requests.auth.AuthBase):
+    """Signs state-changing requests with X-Timestamp and X-Signature (HMAC-SHA256)."""
+
+    def __init__(self, secret: str):
+        self.secret = secret.encode()
+
+    def __call__(self, r):
+        if r.method in ("GET", "HEAD", "OPTIONS"):
+            return r
+        timestamp = str(int(time.time()))
+        body = r.body or b""
+        if isinstance(body, str):
+            body = body.encode()
+        message = (timestamp + r.method + r.path_url).encode() + body
+        r.headers["X-Timestamp"] = timestamp
+        r.headers["X-Signature"] = hmac.new(self.secret, message, hashlib.sha256).hexdigest()
+        return r
+
+
+# Session for the Go API; /api/v1 routes require an X-API-Key header
+go_api = requests.Session()
+if os.getenv("EXECUTION_API_KEY"):
+    go_api.headers["X-API-Key"] = os.getenv("EXECUTION_API_KEY")
+if os.getenv("EXECUTION_API_SECRET"):
+    go_api.auth = SignedRequestAuth(os.getenv("EXECUTION_API_SECRET"))
+
 def get_system_health():
     """Check health of backend services."""
     services = {"Go Engine": "UNKNOWN", "Python Strategy": "UNKNOWN", "Database": "UNKNOWN"}
@@ -35,7 +65,7 @@ def get_system_health():
 def get_market_data(symbol="BTCUSDT", exchange="binance"):
     """Fetch live market data from Go API."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/market/{exchange}/{symbol}", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/market/{exchange}/{symbol}", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -45,7 +75,7 @@ def get_market_data(symbol="BTCUSDT", exchange="binance"):
 def get_balance(exchange="binance"):
     """Fetch account balance from Go API."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/balance/{exchange}", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/balance/{exchange}", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -55,7 +85,7 @@ def get_balance(exchange="binance"):
 def get_all_balances():
     """Fetch balances across all exchanges."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/portfolio/balances", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/portfolio/balances", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -65,7 +95,7 @@ def get_all_balances():
 def place_order(order_data):
     """Submit order to Go API."""
     try:
-        r = requests.post(f"{GO_API_URL}/api/v1/orders", json=order_data, timeout=5)
+        r = go_api.post(f"{GO_API_URL}/api/v1/orders", json=order_data, timeout=5)
         if r.status_code == 200:
             return True, r.json()
         else:
@@ -76,7 +106,7 @@ def place_order(order_data):
 def cancel_order(order_id, symbol, exchange="binance"):
     """Cancel an existing order."""
     try:
-        r = requests.delete(
+        r = go_api.delete(
             f"{GO_API_URL}/api/v1/orders/{order_id}",
             json={"symbol": symbol, "exchange": exchange},
             timeout=5
@@ -91,7 +121,7 @@ def cancel_order(order_id, symbol, exchange="binance"):
 def get_recent_orders(limit=50):
     """Fetch recent orders."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/orders?limit={limit}", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/orders?limit={limit}", timeout=2)
         if r.status_code == 200:
             return r.json().get("orders", [])
     except:
@@ -106,7 +136,7 @@ def get_strategies(active_only=False):
         url = f"{GO_API_URL}/api/v1/strategies"
         if active_only:
             url += "?active=true"
-        r = requests.get(url, timeout=2)
+        r = go_api.get(url, timeout=2)
         if r.status_code == 200:
             return r.json().get("strategies", [])
     except:
@@ -116,7 +146,7 @@ def get_strategies(active_only=False):
 def get_strategy(name):
     """Fetch strategy details."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/strategies/{name}", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/strategies/{name}", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -126,7 +156,7 @@ def get_strategy(name):
 def get_strategy_performance(name):
     """Fetch strategy performance metrics."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/strategies/{name}/performance", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/strategies/{name}/performance", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -136,7 +166,7 @@ def get_strategy_performance(name):
 def create_strategy(strategy_data):
     """Create or update a strategy."""
     try:
-        r = requests.post(f"{GO_API_URL}/api/v1/strategies", json=strategy_data, timeout=5)
+        r = go_api.post(f"{GO_API_URL}/api/v1/strategies", json=strategy_data, timeout=5)
         if r.status_code == 200:
             return True, r.json()
         else:
@@ -147,7 +177,7 @@ def create_strategy(strategy_data):
 def delete_strategy(name):
     """Delete a strategy."""
     try:
-        r = requests.delete(f"{GO_API_URL}/api/v1/strategies/{name}", timeout=5)
+        r = go_api.delete(f"{GO_API_URL}/api/v1/strategies/{name}", timeout=5)
         if r.status_code == 200:
             return True, r.json()
         else:
@@ -160,7 +190,7 @@ def delete_strategy(name):
 def get_positions():
     """Fetch current positions."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/portfolio/positions", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/portfolio/positions", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -170,7 +200,7 @@ def get_positions():
 def get_portfolio_performance():
     """Fetch portfolio performance metrics."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/portfolio/performance", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/portfolio/performance", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
@@ -180,17 +210,17 @@ def get_portfolio_performance():
 def get_risk_metrics():
     """Fetch risk metrics."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/portfolio/risk", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/portfolio/risk", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
         pass
     return None
 
-def get_pnl(period="30 days"):
+def get_pnl(period="30d"):
     """Fetch PnL data."""
     try:
-        r = requests.get(f"{GO_API_URL}/api/v1/portfolio/pnl?period={period}", timeout=2)
+        r = go_api.get(f"{GO_API_URL}/api/v1/portfolio/pnl?period={period}", timeout=2)
         if r.status_code == 200:
             return r.json()
     except:
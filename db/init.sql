@@ -1,5 +1,7 @@
 -- SignalOps Database Schema
 -- PostgreSQL initialization script
+-- The execution engine's tables are also created by go-execution-core/migrations;
+-- change them there as a new migration and mirror the change here.
 
 -- Enable extensions
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
@@ -9,34 +11,63 @@ CREATE EXTENSION IF NOT EXISTS "pg_trgm";
 CREATE TABLE IF NOT EXISTS trades (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     order_id VARCHAR(50) UNIQUE NOT NULL,
+    exchange_order_id VARCHAR(100), -- ID assigned by the exchange, used to poll status
     strategy_name VARCHAR(100) NOT NULL,
     symbol VARCHAR(20) NOT NULL,
     side VARCHAR(10) NOT NULL CHECK (side IN ('BUY', 'SELL')),
+    order_type VARCHAR(30), -- MARKET, LIMIT, ...
     quantity DECIMAL(20, 8) NOT NULL,
     price DECIMAL(20, 8) NOT NULL,
     executed_price DECIMAL(20, 8),
+    filled_quantity DECIMAL(20, 8),
     status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
     exchange VARCHAR(50),
+    account_type VARCHAR(20) NOT NULL DEFAULT 'spot' CHECK (account_type IN ('spot', 'margin', 'futures')),
+    account VARCHAR(100) NOT NULL DEFAULT '',
     timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     executed_at TIMESTAMPTZ,
     pnl DECIMAL(20, 8),
     fees DECIMAL(20, 8) DEFAULT 0,
     slippage DECIMAL(20, 8),
     metadata JSONB,
+    -- Cumulative fill already applied to positions
+    booked_quantity DECIMAL(20, 8) NOT NULL DEFAULT 0,
+    booked_notional DECIMAL(28, 8) NOT NULL DEFAULT 0,
+    booked_fees DECIMAL(20, 8) NOT NULL DEFAULT 0,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
-CREATE INDEX idx_trades_strategy ON trades(strategy_name);
-CREATE INDEX idx_trades_symbol ON trades(symbol);
-CREATE INDEX idx_trades_timestamp ON trades(timestamp DESC);
-CREATE INDEX idx_trades_status ON trades(status);
+-- Keyset pagination: (timestamp, order_id) cursors for order history and strategy trades
+CREATE INDEX idx_trades_timestamp_order ON trades(timestamp DESC, order_id DESC);
+CREATE INDEX idx_trades_strategy_executed ON trades(strategy_name, executed_at DESC, order_id DESC);
+-- Filtered order history: the filter column, then the page order
+CREATE INDEX idx_trades_strategy_timestamp ON trades(strategy_name, timestamp DESC, order_id DESC);
+CREATE INDEX idx_trades_symbol_timestamp ON trades(symbol, timestamp DESC, order_id DESC);
+CREATE INDEX idx_trades_status_timestamp ON trades(status, timestamp DESC, order_id DESC);
+CREATE INDEX idx_trades_exchange_timestamp ON trades(exchange, timestamp DESC, order_id DESC);
+-- Orders the reconciler still polls
+CREATE INDEX idx_trades_open ON trades(timestamp)
+    WHERE status NOT IN ('FILLED', 'CANCELED', 'REJECTED', 'EXPIRED', 'FAILED', 'UNKNOWN');
+CREATE INDEX idx_trades_exchange_account ON trades(exchange, account);
+CREATE INDEX idx_trades_exchange_order ON trades(exchange_order_id);
+CREATE INDEX idx_trades_updated_at ON trades(updated_at);
 CREATE INDEX idx_trades_metadata ON trades USING GIN(metadata);
 
+-- Trades archive: finished trades moved out by `execution-engine archive-trades`.
+-- Every trades column, moved by name, plus archived_at; a column added to
+-- trades must be added here too.
+CREATE TABLE IF NOT EXISTS trades_archive (LIKE trades INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+ALTER TABLE trades_archive ADD COLUMN archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+CREATE UNIQUE INDEX idx_trades_archive_order ON trades_archive(order_id);
+CREATE INDEX idx_trades_archive_timestamp ON trades_archive(timestamp DESC, order_id DESC);
+CREATE INDEX idx_trades_archive_strategy ON trades_archive(strategy_name, timestamp DESC);
+
 -- Positions table: Current holdings and unrealized PnL
 CREATE TABLE IF NOT EXISTS positions (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    symbol VARCHAR(20) NOT NULL UNIQUE,
+    symbol VARCHAR(20) NOT NULL,
+    account VARCHAR(100) NOT NULL DEFAULT '',
     strategy_name VARCHAR(100) NOT NULL,
     quantity DECIMAL(20, 8) NOT NULL,
     average_entry_price DECIMAL(20, 8) NOT NULL,
@@ -45,12 +76,31 @@ CREATE TABLE IF NOT EXISTS positions (
     realized_pnl DECIMAL(20, 8) DEFAULT 0,
     opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     last_updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    metadata JSONB
+    lots JSONB, -- open lots, oldest first, for FIFO accounting
+    metadata JSONB,
+    UNIQUE(symbol, account)
 );
 
 CREATE INDEX idx_positions_symbol ON positions(symbol);
+CREATE INDEX idx_positions_account ON positions(account);
 CREATE INDEX idx_positions_strategy ON positions(strategy_name);
 
+-- Strategy lots table: FIFO lots per strategy and symbol that trades.pnl is realized from
+CREATE TABLE IF NOT EXISTS strategy_lots (
+    id BIGSERIAL PRIMARY KEY,
+    strategy_name VARCHAR(100) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    open_order_id VARCHAR(50) NOT NULL,
+    quantity DECIMAL(28, 12) NOT NULL, -- signed, negative for shorts
+    remaining DECIMAL(28, 12) NOT NULL, -- signed, 0 once closed
+    price DECIMAL(28, 12) NOT NULL, -- entry price including the opening fee share
+    opened_at TIMESTAMPTZ NOT NULL,
+    closed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_strategy_lots_open ON strategy_lots(strategy_name, symbol, id) WHERE remaining <> 0;
+CREATE INDEX idx_strategy_lots_order ON strategy_lots(open_order_id);
+
 -- Strategies table: Configuration and status
 CREATE TABLE IF NOT EXISTS strategies (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -65,13 +115,29 @@ CREATE TABLE IF NOT EXISTS strategies (
     total_pnl DECIMAL(20, 8) DEFAULT 0,
     win_rate DECIMAL(5, 4),
     total_trades INTEGER DEFAULT 0,
-    metadata JSONB
+    metadata JSONB,
+    -- Deleting a strategy sets these instead of removing the row
+    deleted_at TIMESTAMPTZ,
+    deleted_by VARCHAR(100)
 );
 
 CREATE INDEX idx_strategies_name ON strategies(name);
 CREATE INDEX idx_strategies_active ON strategies(is_active);
 CREATE INDEX idx_strategies_config ON strategies USING GIN(config);
 
+-- Strategy versions: every saved revision of a strategy's config and description, numbered from 1
+CREATE TABLE IF NOT EXISTS strategy_versions (
+    strategy_name VARCHAR(100) NOT NULL,
+    version INTEGER NOT NULL,
+    description TEXT,
+    config JSONB NOT NULL,
+    change VARCHAR(20) NOT NULL, -- created, updated or rolled_back
+    source_version INTEGER, -- the version a rollback restored
+    changed_by VARCHAR(100),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (strategy_name, version)
+);
+
 -- Decision logs table: Full audit trail for every trading decision
 CREATE TABLE IF NOT EXISTS decision_logs (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -111,6 +177,51 @@ CREATE INDEX idx_market_snapshots_symbol_time ON market_data_snapshots(symbol, t
 CREATE INDEX idx_market_snapshots_source ON market_data_snapshots(source);
 CREATE INDEX idx_market_snapshots_data ON market_data_snapshots USING GIN(data);
 
+-- Klines table: Closed candles from the kline streams for backtesting
+CREATE TABLE IF NOT EXISTS klines (
+    exchange VARCHAR(50) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    interval VARCHAR(10) NOT NULL,
+    open_time TIMESTAMPTZ NOT NULL,
+    open DECIMAL(20, 8) NOT NULL,
+    high DECIMAL(20, 8) NOT NULL,
+    low DECIMAL(20, 8) NOT NULL,
+    close DECIMAL(20, 8) NOT NULL,
+    volume DECIMAL(28, 8) NOT NULL,
+    close_time TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (exchange, symbol, interval, open_time)
+);
+
+-- Order book snapshots: top levels of live books sampled by the order book
+-- recorder for research, as [[price, quantity], ...] best first
+CREATE TABLE IF NOT EXISTS book_snapshots (
+    exchange VARCHAR(50) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    ts TIMESTAMPTZ NOT NULL,
+    last_update_id BIGINT NOT NULL,
+    bids JSONB NOT NULL,
+    asks JSONB NOT NULL,
+    mid DECIMAL(20, 8),
+    spread DECIMAL(20, 8),
+    PRIMARY KEY (exchange, symbol, ts)
+);
+
+CREATE INDEX idx_book_snapshots_ts ON book_snapshots(ts);
+
+-- Balance snapshots: account values sampled by the balance snapshotter
+-- (BALANCE_SNAPSHOT_INTERVAL), one row per exchange account and one "total" row
+-- per tick. assets holds {asset: {quantity, price_usd}}; a NULL total_value_usd
+-- is an account that could not be read (or, for the total, any account)
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    exchange VARCHAR(100) NOT NULL,
+    ts TIMESTAMPTZ NOT NULL,
+    total_value_usd DECIMAL(28, 8),
+    assets JSONB,
+    error TEXT,
+    PRIMARY KEY (exchange, ts)
+);
+
 -- Risk events table: Track risk manager decisions
 CREATE TABLE IF NOT EXISTS risk_events (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -122,6 +233,7 @@ CREATE TABLE IF NOT EXISTS risk_events (
     description TEXT NOT NULL,
     data JSONB,
     resolved BOOLEAN DEFAULT false,
+    resolved_by VARCHAR(100),
     resolved_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
@@ -129,6 +241,19 @@ CREATE TABLE IF NOT EXISTS risk_events (
 CREATE INDEX idx_risk_events_timestamp ON risk_events(timestamp DESC);
 CREATE INDEX idx_risk_events_severity ON risk_events(severity);
 CREATE INDEX idx_risk_events_resolved ON risk_events(resolved);
+CREATE INDEX idx_risk_events_unresolved ON risk_events(severity, timestamp DESC) WHERE resolved = false;
+
+-- Risk limits table: Portfolio limits read by the order path; a missing row means no limit
+CREATE TABLE IF NOT EXISTS risk_limits (
+    name VARCHAR(50) PRIMARY KEY,
+    value DECIMAL(20, 8) NOT NULL CHECK (value >= 0),
+    updated_by VARCHAR(100),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The exposure that used to be the CRITICAL risk level threshold
+INSERT INTO risk_limits (name, value, updated_by) VALUES ('max_total_exposure_usd', 100000, 'init')
+ON CONFLICT (name) DO NOTHING;
 
 -- Performance metrics table: Aggregated strategy performance
 CREATE TABLE IF NOT EXISTS performance_metrics (
@@ -156,6 +281,8 @@ CREATE TABLE IF NOT EXISTS api_keys (
     key_name VARCHAR(100) NOT NULL,
     encrypted_key TEXT NOT NULL,
     encrypted_secret TEXT NOT NULL,
+    encrypted_passphrase TEXT,
+    testnet BOOLEAN NOT NULL DEFAULT false,
     is_active BOOLEAN DEFAULT true,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     last_used_at TIMESTAMPTZ,
@@ -164,6 +291,20 @@ CREATE TABLE IF NOT EXISTS api_keys (
 
 CREATE INDEX idx_api_keys_exchange ON api_keys(exchange);
 
+-- Client API keys for the execution engine REST API (SHA-256 hashes only)
+CREATE TABLE IF NOT EXISTS client_api_keys (
+    id SERIAL PRIMARY KEY,
+    key_id VARCHAR(32) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'trader', 'admin')),
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    require_signature BOOLEAN NOT NULL DEFAULT false,
+    signing_secret TEXT, -- encrypted with EXCHANGE_CREDENTIALS_KEY
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -173,12 +314,21 @@ BEGIN
 END;
 $$ language 'plpgsql';
 
+-- Positions track their change time in last_updated
+CREATE OR REPLACE FUNCTION update_last_updated_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.last_updated = NOW();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
 -- Triggers for updated_at
 CREATE TRIGGER update_trades_updated_at BEFORE UPDATE ON trades
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_positions_updated_at BEFORE UPDATE ON positions
-    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_positions_last_updated BEFORE UPDATE ON positions
+    FOR EACH ROW EXECUTE FUNCTION update_last_updated_column();
 
 CREATE TRIGGER update_strategies_updated_at BEFORE UPDATE ON strategies
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -188,6 +338,7 @@ INSERT INTO strategies (name, description, config, is_active) VALUES (
     'GrahamDefensive',
     'Graham Value + Event Filter: Buy undervalued stocks when macro risk is low',
     '{
+        "type": "rule_based",
         "rules": [
             {
                 "id": "value_screen",
@@ -222,6 +373,11 @@ INSERT INTO strategies (name, description, config, is_active) VALUES (
     true
 ) ON CONFLICT (name) DO NOTHING;
 
+-- The sample strategy's history starts at its initial config
+INSERT INTO strategy_versions (strategy_name, version, description, config, change, changed_by, changed_at)
+SELECT name, 1, description, config, 'created', created_by, updated_at FROM strategies
+ON CONFLICT DO NOTHING;
+
 -- Grant permissions (for development)
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO signalops;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO signalops;
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Named accounts are registered in Server.exchanges as "<exchange>:<account>",
+// e.g. "binance:main" and "binance:alpha". The plain exchange key ("binance")
+// remains the default account.
+
+// errExchangeNotConfigured is returned when no exchange is registered under a key
+var errExchangeNotConfigured = errors.New("exchange not configured")
+
+// exchangeKey builds the Server.exchanges key for an exchange and optional account
+func exchangeKey(exchange, account string) string {
+	if account == "" {
+		return exchange
+	}
+	return exchange + ":" + account
+}
+
+// splitExchangeKey separates "binance:alpha" into ("binance", "alpha")
+func splitExchangeKey(key string) (exchange, account string) {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// normalizeExchangeAccount accepts either exchange="binance:alpha" or
+// exchange="binance" with account="alpha" and returns them separately
+func normalizeExchangeAccount(exchange, account string) (string, string) {
+	base, embedded := splitExchangeKey(exchange)
+	if account == "" {
+		account = embedded
+	}
+	return base, account
+}
+
+// loadAccountSpecs reads the structured account list from EXCHANGE_ACCOUNTS (JSON)
+// or EXCHANGE_ACCOUNTS_FILE. Each entry is an exchangeSpec; type defaults to the
+// exchange part of the name.
+func loadAccountSpecs(config *Config) ([]exchangeSpec, error) {
+	raw := []byte(config.ExchangeAccounts)
+	if len(raw) == 0 && config.ExchangeAccountsFile != "" {
+		data, err := os.ReadFile(config.ExchangeAccountsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", config.ExchangeAccountsFile, err)
+		}
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var specs []exchangeSpec
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return nil, fmt.Errorf("invalid exchange accounts JSON: %w", err)
+	}
+
+	for i := range specs {
+		if specs[i].Name == "" {
+			return nil, fmt.Errorf("exchange account %d has no name", i)
+		}
+		if specs[i].Type == "" {
+			specs[i].Type, _ = splitExchangeKey(specs[i].Name)
+		}
+	}
+	return specs, nil
+}
+
+// accountKeys returns every registered key for an exchange (default and named accounts), sorted
+func (s *Server) accountKeys(exchange string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for key := range s.exchanges {
+		if base, _ := splitExchangeKey(key); base == exchange {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeBalances sums valued balances from several accounts into one
+func mergeBalances(exchange string, balances []*Balance) *Balance {
+	merged := &Balance{
+		Exchange:  exchange,
+		Balances:  make(map[string]AssetBalance),
+		Timestamp: time.Now(),
+	}
+
+	unpriced := make(map[string]bool)
+	for _, balance := range balances {
+		for asset, bal := range balance.Balances {
+			total := merged.Balances[asset]
+			total.Asset = asset
+			total.Free += bal.Free
+			total.Locked += bal.Locked
+			total.Total += bal.Total
+			total.Borrowed += bal.Borrowed
+			total.Interest += bal.Interest
+			total.ValueUSD += bal.ValueUSD
+			merged.Balances[asset] = total
+		}
+		merged.TotalValueUSD += balance.TotalValueUSD
+		// The merged balance is as stale as its oldest part
+		if balance.Timestamp.Before(merged.Timestamp) {
+			merged.Timestamp = balance.Timestamp
+		}
+		for _, asset := range balance.UnpricedAssets {
+			unpriced[asset] = true
+		}
+	}
+
+	for asset := range unpriced {
+		merged.UnpricedAssets = append(merged.UnpricedAssets, asset)
+	}
+	sort.Strings(merged.UnpricedAssets)
+	return merged
+}
+
+// fetchAccountBalance returns the balance for one account, or all accounts of the
+// exchange merged when account is "all". It also returns the keys that were read
+// and whether every balance came from the cache; force bypasses the cache.
+func (s *Server) fetchAccountBalance(ctx context.Context, exchange, account string,
+	force bool) (*Balance, []string, bool, error) {
+	if account != "all" {
+		key := exchangeKey(exchange, account)
+
+		s.mu.RLock()
+		exchangeClient, exists := s.exchanges[key]
+		s.mu.RUnlock()
+
+		if !exists {
+			return nil, nil, false, fmt.Errorf("%w: %s", errExchangeNotConfigured, key)
+		}
+
+		balance, cached, err := s.cachedBalance(ctx, key, exchangeClient, force)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return balance, []string{key}, cached, nil
+	}
+
+	keys := s.accountKeys(exchange)
+	if len(keys) == 0 {
+		return nil, nil, false, fmt.Errorf("%w: %s", errExchangeNotConfigured, exchange)
+	}
+
+	balances := make([]*Balance, 0, len(keys))
+	allCached := true
+	for _, key := range keys {
+		s.mu.RLock()
+		exchangeClient, exists := s.exchanges[key]
+		s.mu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		balance, cached, err := s.cachedBalance(ctx, key, exchangeClient, force)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%s: %w", key, err)
+		}
+		balances = append(balances, balance)
+		allCached = allCached && cached
+	}
+
+	return mergeBalances(exchange, balances), keys, allCached, nil
+}
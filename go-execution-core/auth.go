@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Client API keys authenticate callers of the REST API. They are unrelated to the
+// exchange credentials in api_keys: only a SHA-256 hash of each key is stored, in
+// client_api_keys, and the plaintext is shown once when the key is created.
+//
+// Keys created with --signed also get a signing secret (encrypted with
+// EXCHANGE_CREDENTIALS_KEY) and must sign state-changing requests: X-Timestamp is
+// the Unix time in seconds and X-Signature is hex HMAC-SHA256 over
+// timestamp + method + path (with query string) + body.
+
+const (
+	apiKeyHeader    = "X-API-Key"
+	timestampHeader = "X-Timestamp"
+	signatureHeader = "X-Signature"
+
+	maxSignatureAge = 30 * time.Second
+)
+
+type contextKey string
+
+var errAPIKeyInvalid = errors.New("invalid API key")
+
+// ClientAPIKey is an authenticated client key
+type ClientAPIKey struct {
+	KeyID            string
+	Role             string
+	RequireSignature bool
+	SigningSecret    string // decrypted; empty unless RequireSignature
+}
+
+type cachedAPIKey struct {
+	key     *ClientAPIKey // nil for keys that failed lookup
+	expires time.Time
+}
+
+// maxNegativeAPIKeys caps how many unknown key hashes are remembered, so a caller
+// cycling through random keys cannot grow the cache without bound
+const maxNegativeAPIKeys = 10000
+
+// errAPIKeyLookupLimited means the caller used up its budget of database lookups
+var errAPIKeyLookupLimited = errors.New("too many API key lookups")
+
+// APIKeyStore validates client API keys against Postgres, caching results for ttl so
+// a revoked key stops working within one TTL on every instance
+type APIKeyStore struct {
+	db       *sql.DB
+	ttl      time.Duration
+	aead     cipher.AEAD             // encrypts signing secrets; nil when EXCHANGE_CREDENTIALS_KEY is unset
+	cache    map[string]cachedAPIKey // keyed by hash
+	negative int                     // cache entries for unknown keys
+	// lookups budgets the cache misses each caller may send to the database; nil
+	// leaves them unlimited
+	lookups *ClientRateLimiter
+	mu      sync.RWMutex
+}
+
+func NewAPIKeyStore(db *sql.DB, ttl time.Duration, aead cipher.AEAD) *APIKeyStore {
+	return &APIKeyStore{
+		db:    db,
+		ttl:   ttl,
+		aead:  aead,
+		cache: make(map[string]cachedAPIKey),
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate returns a valid, unrevoked key. caller identifies the client (its
+// IP) for the lookup budget, which is charged before a cache miss reaches the
+// database.
+func (ks *APIKeyStore) Authenticate(ctx context.Context, key, caller string) (*ClientAPIKey, error) {
+	hash := hashAPIKey(key)
+
+	ks.mu.RLock()
+	cached, hit := ks.cache[hash]
+	ks.mu.RUnlock()
+	if hit && time.Now().Before(cached.expires) {
+		if cached.key == nil {
+			return nil, errAPIKeyInvalid
+		}
+		return cached.key, nil
+	}
+
+	if ks.lookups != nil {
+		if ok, _ := ks.lookups.Allow(caller, budgetRead); !ok {
+			return nil, errAPIKeyLookupLimited
+		}
+	}
+
+	var client *ClientAPIKey
+	var keyID, role string
+	var requireSignature bool
+	var encryptedSecret sql.NullString
+	err := ks.db.QueryRowContext(ctx, `
+		SELECT key_id, role, require_signature, signing_secret FROM client_api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`, hash).Scan(&keyID, &role, &requireSignature, &encryptedSecret)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	default:
+		client = &ClientAPIKey{KeyID: keyID, Role: role, RequireSignature: requireSignature}
+		if requireSignature {
+			if ks.aead == nil || !encryptedSecret.Valid {
+				return nil, fmt.Errorf("API key %s requires signing but its secret cannot be decrypted", keyID)
+			}
+			secret, err := decryptCredential(ks.aead, encryptedSecret.String)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt signing secret for %s: %w", keyID, err)
+			}
+			client.SigningSecret = secret
+		}
+		// Only matched keys are written to, so unknown keys cost a read and no row lock
+		if _, err := ks.db.ExecContext(ctx, `UPDATE client_api_keys SET last_used_at = NOW() WHERE key_id = $1`, keyID); err != nil {
+			logEvent(ctx, "Failed to record API key use", "key_id", keyID, "error", err)
+		}
+	}
+
+	ks.remember(hash, client)
+	if client == nil {
+		return nil, errAPIKeyInvalid
+	}
+	return client, nil
+}
+
+// remember caches a lookup result. Once maxNegativeAPIKeys unknown keys are
+// cached, expired entries are swept and, if that frees nothing, the unknown keys
+// are forgotten: they only save a database read.
+func (ks *APIKeyStore) remember(hash string, client *ClientAPIKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.forgetLocked(hash)
+	if client == nil {
+		if ks.negative >= maxNegativeAPIKeys {
+			ks.sweepLocked(time.Now())
+		}
+		if ks.negative >= maxNegativeAPIKeys {
+			for h, entry := range ks.cache {
+				if entry.key == nil {
+					delete(ks.cache, h)
+				}
+			}
+			ks.negative = 0
+		}
+		ks.negative++
+	}
+	ks.cache[hash] = cachedAPIKey{key: client, expires: time.Now().Add(ks.ttl)}
+}
+
+func (ks *APIKeyStore) forgetLocked(hash string) {
+	if entry, exists := ks.cache[hash]; exists {
+		if entry.key == nil {
+			ks.negative--
+		}
+		delete(ks.cache, hash)
+	}
+}
+
+// sweepLocked drops expired entries
+func (ks *APIKeyStore) sweepLocked(now time.Time) {
+	for hash, entry := range ks.cache {
+		if !now.Before(entry.expires) {
+			ks.forgetLocked(hash)
+		}
+	}
+}
+
+// startCleanup sweeps expired entries every TTL until the process exits
+func (ks *APIKeyStore) startCleanup() {
+	if ks.ttl <= 0 {
+		return
+	}
+	ticker := time.NewTicker(ks.ttl)
+	defer ticker.Stop()
+	for range ticker.C {
+		ks.mu.Lock()
+		ks.sweepLocked(time.Now())
+		ks.mu.Unlock()
+	}
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Create generates a new key and returns its ID and the plaintext key. Signed keys
+// also return the signing secret; unsigned keys return an empty secret.
+func (ks *APIKeyStore) Create(name, role string, signed bool) (keyID, key, secret string, err error) {
+	if _, valid := rolePermissions[role]; !valid {
+		return "", "", "", fmt.Errorf("unknown role %q (viewer, trader or admin)", role)
+	}
+	idHex, err := randomHex(6)
+	if err != nil {
+		return "", "", "", err
+	}
+	keyHex, err := randomHex(24)
+	if err != nil {
+		return "", "", "", err
+	}
+	keyID = "key_" + idHex
+	key = "sok_" + keyHex
+
+	var encryptedSecret sql.NullString
+	if signed {
+		if ks.aead == nil {
+			return "", "", "", fmt.Errorf("signed keys need EXCHANGE_CREDENTIALS_KEY to encrypt the signing secret")
+		}
+		if secret, err = randomHex(32); err != nil {
+			return "", "", "", err
+		}
+		if encryptedSecret.String, err = encryptCredential(ks.aead, secret); err != nil {
+			return "", "", "", err
+		}
+		encryptedSecret.Valid = true
+	}
+
+	_, err = ks.db.Exec(`
+		INSERT INTO client_api_keys (key_id, name, role, key_hash, require_signature, signing_secret)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, keyID, name, role, hashAPIKey(key), signed, encryptedSecret)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to store API key: %w", err)
+	}
+	return keyID, key, secret, nil
+}
+
+// Revoke disables a key and drops it from this instance's cache
+func (ks *APIKeyStore) Revoke(keyID string) error {
+	var hash string
+	err := ks.db.QueryRow(`
+		UPDATE client_api_keys SET revoked_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING key_hash
+	`, keyID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("API key %s not found or already revoked", keyID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	ks.mu.Lock()
+	ks.forgetLocked(hash)
+	ks.mu.Unlock()
+	return nil
+}
+
+// requireAuth wraps the HTTP mux: every /api/v1 route needs a bearer token or, while
+// AUTH_ACCEPT_API_KEYS is on, a valid X-API-Key. The probes (/health, /livez,
+// /readyz) and the token endpoint stay open, and /metrics is open unless
+// METRICS_TOKEN is set.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" && s.config.MetricsToken != "" {
+			token, _ := bearerToken(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.MetricsToken)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error": "Invalid metrics token",
+				})
+				return
+			}
+		}
+
+		if !s.config.APIAuthEnabled || !strings.HasPrefix(r.URL.Path, "/api/v1/") || r.URL.Path == "/api/v1/auth/token" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var principal *Principal
+		if token, ok := bearerToken(r.Header.Get("Authorization")); ok && s.tokenVerifier != nil {
+			claims, err := s.tokenVerifier.Verify(token)
+			if err != nil {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error": "Invalid token: " + err.Error(),
+				})
+				return
+			}
+			principal = &Principal{ID: claims.Subject, Kind: "jwt", Role: claims.Role, Permissions: claims.Scopes()}
+		} else {
+			if !s.config.AuthAcceptAPIKeys {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error": "Missing bearer token",
+				})
+				return
+			}
+			if s.apiKeys == nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+					"error": "Authentication unavailable: database not connected",
+				})
+				return
+			}
+
+			key := r.Header.Get(apiKeyHeader)
+			if key == "" {
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error": "Missing " + apiKeyHeader + " header or bearer token",
+				})
+				return
+			}
+
+			lookupCtx, cancel := s.dbContext(r.Context())
+			client, err := s.apiKeys.Authenticate(lookupCtx, key, remoteClient(r))
+			cancel()
+			if err != nil {
+				if errors.Is(err, errAPIKeyLookupLimited) {
+					w.Header().Set("Retry-After", "1")
+					writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+						"error": "Too many API key lookups",
+					})
+					return
+				}
+				if !errors.Is(err, errAPIKeyInvalid) {
+					logEvent(r.Context(), "API key lookup failed", "error", err)
+					writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+						"error": "Authentication unavailable",
+					})
+					return
+				}
+				writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+					"error": "Invalid API key",
+				})
+				return
+			}
+
+			if client.RequireSignature && isStateChanging(r.Method) {
+				// limitRequestBody already capped the body
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					if !requestBodyError(w, err) {
+						writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+							"error": "Failed to read request body",
+						})
+					}
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				err = verifyRequestSignature(client.SigningSecret, r.Header.Get(timestampHeader), r.Method,
+					r.URL.RequestURI(), body, r.Header.Get(signatureHeader), time.Now())
+				if err != nil {
+					logEvent(r.Context(), "signature rejected", "key_id", client.KeyID, "error", err)
+					writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+						"error": err.Error(),
+					})
+					return
+				}
+			}
+			principal = &Principal{ID: client.KeyID, Kind: "api_key", Role: client.Role, Permissions: rolePermissions[client.Role]}
+		}
+
+		if missing := principal.missingPermission(routePermission(r.Method, r.URL.Path)); missing != "" {
+			logEvent(r.Context(), "permission denied", "method", r.Method, "path", r.URL.Path,
+				"principal", principal.ID, "role", principal.Role, "missing", missing)
+			forbid(w, principal, missing)
+			return
+		}
+
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			info.Caller = principal.ID
+		}
+		ctx := context.WithValue(r.Context(), principalContextKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isStateChanging(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// signRequest computes the hex HMAC-SHA256 that clients send in X-Signature
+func signRequest(secret, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + method + path))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyRequestSignature checks X-Timestamp/X-Signature, rejecting timestamps more
+// than maxSignatureAge away from now in either direction
+func verifyRequestSignature(secret, timestamp, method, path string, body []byte, signature string, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("missing %s or %s header", timestampHeader, signatureHeader)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: must be Unix seconds", timestampHeader)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("stale %s: must be within %s of server time", timestampHeader, maxSignatureAge)
+	}
+
+	expected := signRequest(secret, timestamp, method, path, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return fmt.Errorf("invalid %s", signatureHeader)
+	}
+	return nil
+}
+
+// runAPIKeyCommand implements `execution-engine apikey create|list|revoke`
+func runAPIKeyCommand(args []string) int {
+	usage := "usage: execution-engine apikey create <name> [--role viewer|trader|admin] [--signed] | list | revoke <key_id>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	config := loadConfig()
+	db, err := initDatabase(config.DatabaseURL, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	aead, _ := (&Server{config: config}).credentialsCipher()
+	store := NewAPIKeyStore(db, config.APIKeyCacheTTL, aead)
+
+	switch {
+	case args[0] == "create" && len(args) >= 2:
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		role := flags.String("role", roleViewer, "viewer, trader or admin")
+		signed := flags.Bool("signed", false, "require HMAC-signed state-changing requests")
+		if err := flags.Parse(args[2:]); err != nil || flags.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+
+		keyID, key, secret, err := store.Create(args[1], *role, *signed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Created %s API key %s (%s)\n", *role, keyID, args[1])
+		fmt.Printf("%s: %s\n", apiKeyHeader, key)
+		if secret != "" {
+			fmt.Printf("Signing secret: %s\n", secret)
+		}
+		fmt.Println("Store these now; they cannot be shown again.")
+
+	case args[0] == "revoke" && len(args) == 2:
+		if err := store.Revoke(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Revoked API key %s\n", args[1])
+
+	case args[0] == "list" && len(args) == 1:
+		rows, err := db.Query(`
+			SELECT key_id, name, role, require_signature, created_at, last_used_at, revoked_at
+			FROM client_api_keys
+			ORDER BY created_at
+		`)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list API keys: %v\n", err)
+			return 1
+		}
+		defer rows.Close()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY ID\tNAME\tROLE\tSIGNED\tCREATED\tLAST USED\tREVOKED")
+		for rows.Next() {
+			var keyID, name, role string
+			var signed bool
+			var createdAt time.Time
+			var lastUsedAt, revokedAt sql.NullTime
+			if err := rows.Scan(&keyID, &name, &role, &signed, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", keyID, name, role, signed,
+				createdAt.Format(time.RFC3339), formatNullTime(lastUsedAt), formatNullTime(revokedAt))
+		}
+		tw.Flush()
+		if err := rows.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list API keys: %v\n", err)
+			return 1
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
+
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return "-"
+	}
+	return t.Time.Format(time.RFC3339)
+}
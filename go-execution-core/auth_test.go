@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPIKeyStore(t *testing.T, ttl time.Duration) (*Server, *APIKeyStore) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	s.apiKeys = NewAPIKeyStore(s.db, ttl, nil)
+	return s, s.apiKeys
+}
+
+func TestAPIKeyNegativeCacheIsBounded(t *testing.T) {
+	_, ks := newTestAPIKeyStore(t, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < maxNegativeAPIKeys+100; i++ {
+		if _, err := ks.Authenticate(ctx, fmt.Sprintf("sok_unknown_%d", i), "ip:10.0.0.1"); !errors.Is(err, errAPIKeyInvalid) {
+			t.Fatalf("key %d: err = %v", i, err)
+		}
+	}
+	ks.mu.RLock()
+	size, negative := len(ks.cache), ks.negative
+	ks.mu.RUnlock()
+	if size > maxNegativeAPIKeys || negative != size {
+		t.Errorf("cache holds %d entries (%d negative), want at most %d", size, negative, maxNegativeAPIKeys)
+	}
+}
+
+func TestAPIKeyCacheSweepsExpiredEntries(t *testing.T) {
+	_, ks := newTestAPIKeyStore(t, 20*time.Millisecond)
+	ctx := context.Background()
+	_, key, _, err := ks.Create("bot", "viewer", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Authenticate(ctx, key, "ip:10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		ks.Authenticate(ctx, fmt.Sprintf("sok_unknown_%d", i), "ip:10.0.0.1")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	ks.mu.Lock()
+	ks.sweepLocked(time.Now())
+	size, negative := len(ks.cache), ks.negative
+	ks.mu.Unlock()
+	if size != 0 || negative != 0 {
+		t.Errorf("after sweep: %d entries, %d negative", size, negative)
+	}
+}
+
+func TestAPIKeyLastUsedOnlyOnMatch(t *testing.T) {
+	s, ks := newTestAPIKeyStore(t, time.Hour)
+	ctx := context.Background()
+	keyID, key, _, err := ks.Create("bot", "trader", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Counts every write to client_api_keys
+	_, err = s.db.Exec(`
+		CREATE TABLE api_key_writes (n INTEGER);
+		CREATE TRIGGER count_api_key_writes AFTER UPDATE ON client_api_keys
+		BEGIN INSERT INTO api_key_writes VALUES (1); END;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := func() int {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM api_key_writes`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for i := 0; i < 3; i++ {
+		ks.Authenticate(ctx, fmt.Sprintf("sok_unknown_%d", i), "ip:10.0.0.1")
+	}
+	if n := writes(); n != 0 {
+		t.Errorf("unknown keys caused %d writes", n)
+	}
+
+	client, err := ks.Authenticate(ctx, key, "ip:10.0.0.1")
+	if err != nil || client.KeyID != keyID || client.Role != "trader" {
+		t.Fatalf("Authenticate = %+v, %v", client, err)
+	}
+	var lastUsed *string
+	if err := s.db.QueryRow(`SELECT last_used_at FROM client_api_keys WHERE key_id = $1`, keyID).Scan(&lastUsed); err != nil {
+		t.Fatal(err)
+	}
+	if lastUsed == nil || writes() != 1 {
+		t.Errorf("last_used_at = %v after %d writes, want it set by one write", lastUsed, writes())
+	}
+}
+
+func TestAPIKeyLookupBudgetPerIP(t *testing.T) {
+	_, ks := newTestAPIKeyStore(t, time.Hour)
+	ks.lookups = NewClientRateLimiter(0.001, 3, 0.001, 3, time.Minute)
+	ctx := context.Background()
+	_, key, _, err := ks.Create("bot", "viewer", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Authenticate(ctx, key, "ip:10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := ks.Authenticate(ctx, fmt.Sprintf("sok_guess_%d", i), "ip:10.0.0.1"); !errors.Is(err, errAPIKeyInvalid) {
+			t.Fatalf("guess %d: err = %v, want errAPIKeyInvalid", i, err)
+		}
+	}
+	if _, err := ks.Authenticate(ctx, "sok_guess_2", "ip:10.0.0.1"); !errors.Is(err, errAPIKeyLookupLimited) {
+		t.Fatalf("over budget: err = %v, want errAPIKeyLookupLimited", err)
+	}
+	// Cached keys need no lookup, and other IPs have their own budget
+	if _, err := ks.Authenticate(ctx, key, "ip:10.0.0.1"); err != nil {
+		t.Errorf("cached key refused: %v", err)
+	}
+	if _, err := ks.Authenticate(ctx, "sok_guess_2", "ip:10.0.0.2"); !errors.Is(err, errAPIKeyInvalid) {
+		t.Errorf("other IP: err = %v, want errAPIKeyInvalid", err)
+	}
+}
+
+func TestRequireAuthLimitsLookupsBeforeQuerying(t *testing.T) {
+	s, ks := newTestAPIKeyStore(t, time.Hour)
+	s.config.APIAuthEnabled = true
+	s.config.AuthAcceptAPIKeys = true
+	ks.lookups = NewClientRateLimiter(0.001, 2, 0.001, 2, time.Minute)
+	srv := serveTest(t, s)
+
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		code, _ := doJSON(t, srv, http.MethodGet, "/api/v1/positions", nil, apiKeyHeader, fmt.Sprintf("sok_guess_%d", i))
+		codes = append(codes, code)
+	}
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", codes, want)
+		}
+	}
+	ks.mu.RLock()
+	negative := ks.negative
+	ks.mu.RUnlock()
+	if negative != 2 {
+		t.Errorf("%d unknown keys cached, want only the 2 looked up", negative)
+	}
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	const secret = "s3cret"
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"symbol":"BTCUSDT","side":"BUY","quantity":0.1}`)
+	valid := signRequest(secret, ts, "POST", "/api/v1/orders?dry=1", body)
+	at := func(offset time.Duration) string { return strconv.FormatInt(now.Add(offset).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		timestamp string
+		method    string
+		path      string
+		body      []byte
+		signature string
+		wantErr   string
+	}{
+		{name: "valid", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1", body: body, signature: valid},
+		{name: "uppercase hex", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1", body: body, signature: strings.ToUpper(valid)},
+		{name: "tampered body", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1",
+			body: bytes.Replace(body, []byte("0.1"), []byte("100"), 1), signature: valid, wantErr: "invalid X-Signature"},
+		{name: "body appended", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1",
+			body: append(append([]byte{}, body...), ' '), signature: valid, wantErr: "invalid X-Signature"},
+		{name: "tampered query", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=0", body: body, signature: valid,
+			wantErr: "invalid X-Signature"},
+		{name: "other method", timestamp: ts, method: "DELETE", path: "/api/v1/orders?dry=1", body: body, signature: valid,
+			wantErr: "invalid X-Signature"},
+		{name: "timestamp changed after signing", timestamp: at(time.Second), method: "POST", path: "/api/v1/orders?dry=1",
+			body: body, signature: valid, wantErr: "invalid X-Signature"},
+		{name: "stale", timestamp: at(-31 * time.Second), method: "POST", path: "/api/v1/orders?dry=1", body: body,
+			signature: signRequest(secret, at(-31*time.Second), "POST", "/api/v1/orders?dry=1", body), wantErr: "stale X-Timestamp"},
+		{name: "from the future", timestamp: at(31 * time.Second), method: "POST", path: "/api/v1/orders?dry=1", body: body,
+			signature: signRequest(secret, at(31*time.Second), "POST", "/api/v1/orders?dry=1", body), wantErr: "stale X-Timestamp"},
+		{name: "oldest accepted", timestamp: at(-30 * time.Second), method: "POST", path: "/api/v1/orders?dry=1", body: body,
+			signature: signRequest(secret, at(-30*time.Second), "POST", "/api/v1/orders?dry=1", body)},
+		{name: "milliseconds", timestamp: strconv.FormatInt(now.UnixMilli(), 10), method: "POST", path: "/api/v1/orders?dry=1",
+			body: body, signature: valid, wantErr: "stale X-Timestamp"},
+		{name: "not a number", timestamp: "yesterday", method: "POST", path: "/api/v1/orders?dry=1", body: body, signature: valid,
+			wantErr: "invalid X-Timestamp"},
+		{name: "missing signature", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1", body: body,
+			wantErr: "missing X-Timestamp or X-Signature header"},
+		{name: "wrong secret", timestamp: ts, method: "POST", path: "/api/v1/orders?dry=1", body: body,
+			signature: signRequest("other", ts, "POST", "/api/v1/orders?dry=1", body), wantErr: "invalid X-Signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyRequestSignature(secret, tt.timestamp, tt.method, tt.path, tt.body, tt.signature, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignedKeyOrderRequests(t *testing.T) {
+	s, mock := newTestServer(t)
+	s.config.APIAuthEnabled = true
+	s.config.AuthAcceptAPIKeys = true
+	s.config.CredentialsKey = strings.Repeat("ab", 32)
+	aead, err := s.credentialsCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.apiKeys = NewAPIKeyStore(s.db, time.Hour, aead)
+	_, key, secret, err := s.apiKeys.Create("bot", "trader", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := serveTest(t, s)
+
+	submit := func(body []byte, timestamp, signature string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/orders", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(apiKeyHeader, key)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, signature)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	order := func(id string, quantity float64) []byte {
+		raw, _ := json.Marshal(map[string]interface{}{"order_id": id, "strategy_name": "momentum",
+			"symbol": "BTCUSDT", "side": "BUY", "quantity": quantity, "exchange": "mock"})
+		return raw
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	body := order("ord-1", 0.1)
+	if code := submit(body, now, signRequest(secret, now, "POST", "/api/v1/orders", body)); code != http.StatusOK {
+		t.Fatalf("signed order: status %d", code)
+	}
+
+	signed := order("ord-2", 0.1)
+	signature := signRequest(secret, now, "POST", "/api/v1/orders", signed)
+	if code := submit(order("ord-2", 50), now, signature); code != http.StatusUnauthorized {
+		t.Errorf("tampered body: status %d, want 401", code)
+	}
+
+	stale := strconv.FormatInt(time.Now().Add(-5*time.Minute).Unix(), 10)
+	if code := submit(signed, stale, signRequest(secret, stale, "POST", "/api/v1/orders", signed)); code != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: status %d, want 401", code)
+	}
+	if code := submit(signed, now, ""); code != http.StatusUnauthorized {
+		t.Errorf("unsigned: status %d, want 401", code)
+	}
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Errorf("%d orders reached the exchange, want only the signed one", got)
+	}
+
+	// Reads need no signature
+	if code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders", nil, apiKeyHeader, key); code != http.StatusOK {
+		t.Errorf("unsigned read: status %d: %v", code, body)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// balanceCachePrefix namespaces cached balances in Redis, keyed by exchange key
+const balanceCachePrefix = "balance:"
+
+// cachedBalance returns an exchange's valued balance from Redis when it is younger
+// than BALANCE_CACHE_TTL, otherwise fetches and caches it. force skips the cache
+// read. Balance.Timestamp is the fetch time either way; the bool reports a hit.
+// Redis errors fall back to fetching, so the cache never fails a request.
+func (s *Server) cachedBalance(ctx context.Context, key string, exchange Exchange, force bool) (*Balance, bool, error) {
+	ttl := s.config.BalanceCacheTTL
+	useCache := s.redis != nil && ttl > 0
+	if useCache && !force {
+		data, err := s.redis.Get(ctx, balanceCachePrefix+key).Bytes()
+		switch {
+		case err == nil:
+			var balance Balance
+			if err := json.Unmarshal(data, &balance); err == nil {
+				recordCacheLookup("balance", "hit")
+				return &balance, true, nil
+			}
+			recordCacheLookup("balance", "miss")
+		case errors.Is(err, redis.Nil):
+			recordCacheLookup("balance", "miss")
+		default:
+			recordCacheLookup("balance", "error")
+			logEvent(ctx, "Balance cache unavailable", "exchange", key, "error", err)
+		}
+	}
+
+	balance, err := s.fetchBalance(ctx, exchange)
+	if err != nil {
+		return nil, false, err
+	}
+	if useCache {
+		data, _ := json.Marshal(balance)
+		if err := s.redis.Set(ctx, balanceCachePrefix+key, data, ttl).Err(); err != nil {
+			logEvent(ctx, "Failed to cache balance", "exchange", key, "error", err)
+		}
+	}
+	return balance, false, nil
+}
+
+// invalidateBalance drops an exchange's cached balance after an order changes it
+func (s *Server) invalidateBalance(ctx context.Context, key string) {
+	if s.redis == nil || s.config.BalanceCacheTTL <= 0 {
+		return
+	}
+	if err := s.redis.Del(ctx, balanceCachePrefix+key).Err(); err != nil {
+		logEvent(ctx, "Failed to invalidate cached balance", "exchange", key, "error", err)
+	}
+}
+
+// errBalanceTimeout is returned when an exchange does not answer within the
+// balance fetch timeout
+var errBalanceTimeout = errors.New("balance fetch timed out")
+
+// balanceWithTimeout is cachedBalance bounded by timeout (0 waits indefinitely).
+// The deadline cancels the exchange call itself.
+func (s *Server) balanceWithTimeout(ctx context.Context, key string, exchange Exchange, force bool,
+	timeout time.Duration) (*Balance, bool, error) {
+	if timeout <= 0 {
+		return s.cachedBalance(ctx, key, exchange, force)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	balance, cached, err := s.cachedBalance(fetchCtx, key, exchange, force)
+	if err != nil && ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		return nil, false, fmt.Errorf("%w after %s", errBalanceTimeout, timeout)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, false, ctx.Err()
+	}
+	return balance, cached, err
+}
+
+// balanceFetchMetrics keeps the last balance fetch duration and the timeout count
+// of each exchange for /metrics
+type balanceFetchMetrics struct {
+	mu       sync.Mutex
+	last     map[string]time.Duration
+	timeouts map[string]uint64
+}
+
+func newBalanceFetchMetrics() *balanceFetchMetrics {
+	return &balanceFetchMetrics{
+		last:     make(map[string]time.Duration),
+		timeouts: make(map[string]uint64),
+	}
+}
+
+func (bm *balanceFetchMetrics) observe(exchange string, elapsed time.Duration, err error) {
+	if bm == nil {
+		return
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.last[exchange] = elapsed
+	if errors.Is(err, errBalanceTimeout) {
+		bm.timeouts[exchange]++
+	}
+}
+
+var (
+	balanceFetchSecondsDesc = prometheus.NewDesc("signalops_balance_fetch_seconds",
+		"Duration of the last balance fetch per exchange.", []string{"exchange"}, nil)
+	balanceFetchTimeoutsDesc = prometheus.NewDesc("signalops_balance_fetch_timeouts_total",
+		"Balance fetches that hit BALANCE_FETCH_TIMEOUT.", []string{"exchange"}, nil)
+)
+
+func (bm *balanceFetchMetrics) collect(ch chan<- prometheus.Metric) {
+	if bm == nil {
+		return
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for name, elapsed := range bm.last {
+		ch <- prometheus.MustNewConstMetric(balanceFetchSecondsDesc, prometheus.GaugeValue, elapsed.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(balanceFetchTimeoutsDesc, prometheus.CounterValue,
+			float64(bm.timeouts[name]), name)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
+)
+
+// The balance snapshotter records the USD value of every registered exchange
+// account every BALANCE_SNAPSHOT_INTERVAL into balance_snapshots, with a "total"
+// row summing them, for the equity curve of GET /api/v1/portfolio/equity. Ticks
+// are aligned to the interval and rows keyed by (exchange, ts), so instances
+// sharing a database record each tick once. An account that cannot be read
+// within BALANCE_FETCH_TIMEOUT is recorded as a gap, without a value, and so is
+// the total while any account is missing; a zero would read as a withdrawal.
+//
+// Deposits and withdrawals are inferred. Between two readable snapshots the
+// change in value is the price change of the assets held at the first (market
+// PnL), less the fees of the fills in between, plus whatever changed the
+// quantities otherwise. Fills swap assets at about their market value, so that
+// rest is near zero unless funds moved in or out; beyond EQUITY_FLOW_THRESHOLD
+// of the earlier value it is flagged as a deposit or withdrawal.
+
+const (
+	// equityTotalKey is the exchange of the rows summing every account
+	equityTotalKey = "total"
+	// balanceSnapshotMinInterval bounds how often accounts are read for snapshots
+	balanceSnapshotMinInterval = time.Minute
+	// equityFlowMinUSD keeps small accounts from having rounding flagged as flows
+	equityFlowMinUSD = 1.0
+)
+
+var balanceSnapshotRows = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_balance_snapshots_total",
+	Help: "Rows written by the balance snapshotter, by result (recorded, gap, failed).",
+}, []string{"result"})
+
+// snapshotAsset is one priced asset of a balance snapshot
+type snapshotAsset struct {
+	Quantity float64 `json:"quantity"` // net of margin debt
+	PriceUSD float64 `json:"price_usd"`
+}
+
+// balanceSnapshot is one row of balance_snapshots; a gap has no value or assets
+type balanceSnapshot struct {
+	Exchange      string
+	Timestamp     time.Time
+	TotalValueUSD *float64
+	Assets        map[string]snapshotAsset
+	Error         string
+}
+
+// snapshotAssets reduces a valued balance to the priced assets it holds
+func snapshotAssets(balance *Balance) map[string]snapshotAsset {
+	unpriced := make(map[string]bool, len(balance.UnpricedAssets))
+	for _, asset := range balance.UnpricedAssets {
+		unpriced[asset] = true
+	}
+	assets := make(map[string]snapshotAsset)
+	for asset, bal := range balance.Balances {
+		quantity := bal.Total - bal.Borrowed - bal.Interest
+		if unpriced[asset] || quantity == 0 {
+			continue
+		}
+		assets[asset] = snapshotAsset{Quantity: quantity, PriceUSD: bal.ValueUSD / quantity}
+	}
+	return assets
+}
+
+// runBalanceSnapshots records a snapshot at every multiple of the interval until
+// the server shuts down
+func (s *Server) runBalanceSnapshots() {
+	interval := s.config.BalanceSnapshotInterval
+	if interval <= 0 {
+		return
+	}
+	if interval < balanceSnapshotMinInterval {
+		interval = balanceSnapshotMinInterval
+	}
+	log.Printf("✓ Balance snapshots every %s", interval)
+
+	for {
+		next := time.Now().Truncate(interval).Add(interval)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.streamCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if s.dbAvailable() {
+			s.recordBalanceSnapshots(next)
+		}
+	}
+}
+
+// recordBalanceSnapshots reads every account concurrently and writes their rows
+// and the total for ts
+func (s *Server) recordBalanceSnapshots(ts time.Time) {
+	s.mu.RLock()
+	exchanges := make(map[string]Exchange, len(s.exchanges))
+	for key, exchange := range s.exchanges {
+		exchanges[key] = exchange
+	}
+	s.mu.RUnlock()
+	if len(exchanges) == 0 {
+		return
+	}
+
+	type fetched struct {
+		balance *Balance
+		err     error
+	}
+	results := make(map[string]*fetched, len(exchanges))
+	keys := make([]string, 0, len(exchanges))
+	var g errgroup.Group
+	for key, exchange := range exchanges {
+		result := &fetched{}
+		results[key] = result
+		keys = append(keys, key)
+		key, exchange := key, exchange
+		g.Go(func() error {
+			result.balance, _, result.err = s.balanceWithTimeout(s.streamCtx, key, exchange, false,
+				s.config.BalanceFetchTimeout)
+			return nil // an unreadable account is a gap, not a reason to skip the others
+		})
+	}
+	g.Wait()
+	sort.Strings(keys)
+
+	snapshots := make([]balanceSnapshot, 0, len(keys)+1)
+	var totalValue float64
+	quantities := make(map[string]float64)
+	values := make(map[string]float64)
+	var missing []string
+	for _, key := range keys {
+		result := results[key]
+		snap := balanceSnapshot{Exchange: key, Timestamp: ts}
+		if result.err != nil {
+			log.Printf("Balance snapshot of %s recorded as a gap: %v", key, result.err)
+			snap.Error = result.err.Error()
+			missing = append(missing, key)
+			snapshots = append(snapshots, snap)
+			continue
+		}
+		value := result.balance.TotalValueUSD
+		snap.TotalValueUSD = &value
+		snap.Assets = snapshotAssets(result.balance)
+		totalValue += value
+		for asset, a := range snap.Assets {
+			quantities[asset] += a.Quantity
+			values[asset] += a.Quantity * a.PriceUSD
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	total := balanceSnapshot{Exchange: equityTotalKey, Timestamp: ts}
+	if len(missing) > 0 {
+		total.Error = "unavailable: " + strings.Join(missing, ", ")
+	} else {
+		total.TotalValueUSD = &totalValue
+		total.Assets = make(map[string]snapshotAsset, len(quantities))
+		for asset, quantity := range quantities {
+			if quantity != 0 {
+				total.Assets[asset] = snapshotAsset{Quantity: quantity, PriceUSD: values[asset] / quantity}
+			}
+		}
+	}
+	snapshots = append(snapshots, total)
+
+	var rows []string
+	var args []interface{}
+	gaps := 0
+	for _, snap := range snapshots {
+		var assets interface{}
+		if snap.Assets != nil {
+			encoded, _ := json.Marshal(snap.Assets)
+			assets = string(encoded)
+		} else {
+			gaps++
+		}
+		var errorText interface{}
+		if snap.Error != "" {
+			errorText = snap.Error
+		}
+		n := len(args)
+		rows = append(rows, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, snap.Exchange, snap.Timestamp, snap.TotalValueUSD, assets, errorText)
+	}
+
+	ctx, cancel := s.dbContext(s.streamCtx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO balance_snapshots (exchange, ts, total_value_usd, assets, error)
+		VALUES `+strings.Join(rows, ", ")+`
+		ON CONFLICT DO NOTHING
+	`, args...)
+	if err != nil {
+		balanceSnapshotRows.WithLabelValues("failed").Add(float64(len(snapshots)))
+		log.Printf("Failed to record balance snapshots: %v", err)
+		return
+	}
+	balanceSnapshotRows.WithLabelValues("recorded").Add(float64(len(snapshots) - gaps))
+	balanceSnapshotRows.WithLabelValues("gap").Add(float64(gaps))
+}
+
+// equityPoint is one point of the equity curve: the value at the last readable
+// snapshot of its bucket and how the value changed over the bucket
+type equityPoint struct {
+	Timestamp      time.Time `json:"timestamp"`
+	TotalValueUSD  *float64  `json:"total_value_usd"` // nil when no snapshot in the bucket could be read
+	Gap            bool      `json:"gap,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	ChangeUSD      float64   `json:"change_usd"`
+	MarketPnLUSD   float64   `json:"market_pnl_usd"`
+	FeesUSD        float64   `json:"fees_usd"`
+	UnexplainedUSD float64   `json:"unexplained_usd"` // change not explained by market PnL and fees
+	DepositsUSD    float64   `json:"deposits_usd"`
+	WithdrawalsUSD float64   `json:"withdrawals_usd"` // positive
+}
+
+// equityFlow is a change in value flagged as a deposit or withdrawal
+type equityFlow struct {
+	Timestamp time.Time `json:"timestamp"`
+	Since     time.Time `json:"since"` // the previous readable snapshot
+	AmountUSD float64   `json:"amount_usd"`
+	Type      string    `json:"type"` // deposit or withdrawal
+}
+
+// timedFee is the fee of one fill
+type timedFee struct {
+	At   time.Time
+	Fees float64
+}
+
+// splitEquityChange splits the change in value between two snapshots into the
+// market PnL of the assets held at the first and the flow left unexplained once
+// fees are added back. An asset sold out keeps its earlier price.
+func splitEquityChange(prev, cur map[string]snapshotAsset, change, fees float64) (marketPnL, flow float64) {
+	for asset, before := range prev {
+		price := before.PriceUSD
+		if after, ok := cur[asset]; ok {
+			price = after.PriceUSD
+		}
+		marketPnL += before.Quantity * (price - before.PriceUSD)
+	}
+	return marketPnL, change - marketPnL + fees
+}
+
+// handleEquity returns the account value over time with deposits and withdrawals:
+// GET /api/v1/portfolio/equity?from=...&to=...&granularity=1h&exchange=total
+// granularity is raw (every snapshot), 1h or 1d; exchange is an account key
+// ("binance", "binance:alpha") or total, the default. Defaults to the last 7 days.
+func (s *Server) handleEquity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	exchange := query.Get("exchange")
+	if exchange == "" {
+		exchange = equityTotalKey
+	}
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "1h"
+	}
+	var step time.Duration
+	if granularity != "raw" {
+		g, ok := timeseriesGranularities[granularity]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": "granularity must be raw, 1h or 1d",
+			})
+			return
+		}
+		step = g.step
+	}
+
+	to := time.Now().UTC()
+	from := time.Time{}
+	for param, field := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param),
+			})
+			return
+		}
+		*field = t.UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-7 * 24 * time.Hour)
+	}
+	if !from.Before(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "from must be before to"})
+		return
+	}
+	if step > 0 && to.Sub(from)/step > maxTimeseriesBuckets {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Range spans more than %d %s buckets", maxTimeseriesBuckets, granularity),
+		})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	db := s.store.reader(readAnalytics)
+	baseline, snapshots, fees, err := queryEquity(ctx, db, exchange, from, to, step == 0)
+	if err == errTooManySnapshots {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Range holds more than %d snapshots; use granularity 1h or 1d", maxTimeseriesBuckets),
+		})
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to query balance snapshots", "exchange", exchange, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch equity curve",
+		})
+		return
+	}
+
+	points := make([]equityPoint, 0)
+	flows := make([]equityFlow, 0)
+	var deposits, withdrawals float64
+	prev := baseline
+	next := 0 // first fee not yet attributed
+	for _, snap := range snapshots {
+		start := snap.Timestamp
+		if step > 0 {
+			start = start.Truncate(step)
+		}
+		if len(points) == 0 || !points[len(points)-1].Timestamp.Equal(start) {
+			points = append(points, equityPoint{Timestamp: start, Gap: true})
+		}
+		point := &points[len(points)-1]
+		if snap.TotalValueUSD == nil {
+			if point.Gap {
+				point.Error = snap.Error
+			}
+			continue
+		}
+		value := *snap.TotalValueUSD
+		point.TotalValueUSD, point.Gap, point.Error = &value, false, ""
+
+		if prev != nil {
+			var intervalFees float64
+			for next < len(fees) && !fees[next].At.After(prev.Timestamp) {
+				next++
+			}
+			for next < len(fees) && !fees[next].At.After(snap.Timestamp) {
+				intervalFees += fees[next].Fees
+				next++
+			}
+			change := value - *prev.TotalValueUSD
+			marketPnL, flow := splitEquityChange(prev.Assets, snap.Assets, change, intervalFees)
+			point.ChangeUSD += change
+			point.MarketPnLUSD += marketPnL
+			point.FeesUSD += intervalFees
+			point.UnexplainedUSD += flow
+			if math.Abs(flow) > math.Max(equityFlowMinUSD, s.config.EquityFlowThreshold*math.Abs(*prev.TotalValueUSD)) {
+				kind := "deposit"
+				if flow > 0 {
+					point.DepositsUSD += flow
+					deposits += flow
+				} else {
+					kind = "withdrawal"
+					point.WithdrawalsUSD -= flow
+					withdrawals -= flow
+				}
+				flows = append(flows, equityFlow{Timestamp: snap.Timestamp, Since: prev.Timestamp, AmountUSD: flow, Type: kind})
+			}
+		}
+		current := snap
+		prev = &current
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exchange":              exchange,
+		"granularity":           granularity,
+		"from":                  from.Format(time.RFC3339),
+		"to":                    to.Format(time.RFC3339),
+		"points":                points,
+		"count":                 len(points),
+		"flows":                 flows,
+		"total_deposits_usd":    deposits,
+		"total_withdrawals_usd": withdrawals,
+	})
+}
+
+// errTooManySnapshots is returned by queryEquity when a raw curve would exceed
+// maxTimeseriesBuckets points
+var errTooManySnapshots = fmt.Errorf("more than %d snapshots", maxTimeseriesBuckets)
+
+// queryEquity reads the snapshots of exchange in [from, to), oldest first, the
+// last readable one before from as the baseline of the first change (nil when
+// there is none), and the fees of the fills since the baseline
+func queryEquity(ctx context.Context, db *sql.DB, exchange string, from, to time.Time,
+	capped bool) (*balanceSnapshot, []balanceSnapshot, []timedFee, error) {
+	baselines, err := queryBalanceSnapshots(ctx, db, `
+		WHERE exchange = $1 AND ts < $2 AND total_value_usd IS NOT NULL
+		ORDER BY ts DESC
+		LIMIT 1
+	`, exchange, from)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	clause := "WHERE exchange = $1 AND ts >= $2 AND ts < $3 ORDER BY ts"
+	if capped {
+		clause += fmt.Sprintf(" LIMIT %d", maxTimeseriesBuckets+1)
+	}
+	snapshots, err := queryBalanceSnapshots(ctx, db, clause, exchange, from, to)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if capped && len(snapshots) > maxTimeseriesBuckets {
+		return nil, nil, nil, errTooManySnapshots
+	}
+
+	var baseline *balanceSnapshot
+	since := from
+	if len(baselines) > 0 {
+		baseline = &baselines[0]
+		since = baseline.Timestamp
+	}
+	var where whereBuilder
+	where.add("executed_at > ?", since)
+	where.add("executed_at < ?", to)
+	where.add("fees > 0")
+	if exchange != equityTotalKey {
+		base, account := splitExchangeKey(exchange)
+		where.add("COALESCE(exchange, 'binance') = ?", base)
+		where.add("account = ?", account)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT executed_at, fees FROM trades `+where.sql()+` ORDER BY executed_at`,
+		where.args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+	var fees []timedFee
+	for rows.Next() {
+		var fee timedFee
+		if err := rows.Scan(&fee.At, &fee.Fees); err != nil {
+			return nil, nil, nil, err
+		}
+		fees = append(fees, fee)
+	}
+	return baseline, snapshots, fees, rows.Err()
+}
+
+// queryBalanceSnapshots reads the balance_snapshots rows selected by the clause
+// that follows FROM
+func queryBalanceSnapshots(ctx context.Context, db *sql.DB, clause string, args ...interface{}) ([]balanceSnapshot, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT exchange, ts, total_value_usd, assets, error FROM balance_snapshots
+	`+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []balanceSnapshot
+	for rows.Next() {
+		var snap balanceSnapshot
+		var value sql.NullFloat64
+		var assets []byte
+		var errorText sql.NullString
+		if err := rows.Scan(&snap.Exchange, &snap.Timestamp, &value, &assets, &errorText); err != nil {
+			return nil, err
+		}
+		snap.Timestamp = snap.Timestamp.UTC()
+		if value.Valid {
+			snap.TotalValueUSD = &value.Float64
+		}
+		if assets != nil {
+			if err := json.Unmarshal(assets, &snap.Assets); err != nil {
+				return nil, fmt.Errorf("balance snapshot %s at %s: %w", snap.Exchange, snap.Timestamp.Format(time.RFC3339), err)
+			}
+		}
+		snap.Error = errorText.String
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
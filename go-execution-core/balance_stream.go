@@ -0,0 +1,250 @@
+package main
+
+import (
+	"time"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	balanceStreamHeartbeat       = time.Minute
+	balanceStreamPollInterval    = 10 * time.Second
+	balanceStreamMinPollInterval = time.Second
+)
+
+// Balance stream update types
+const (
+	balanceUpdateSnapshot = "snapshot"
+	balanceUpdateChange   = "change"
+)
+
+// StreamBalances sends an account's balance, then a "change" with the assets that
+// changed whenever a change is seen, and a full snapshot every heartbeat_seconds.
+// Exchanges with a user data stream (Binance spot) push changes, with the reason
+// when the account events give it. Others are polled every poll_interval_ms and
+// their snapshots compared; those changes are "unknown" and, like GetBalance, see
+// the exchange through the BALANCE_CACHE_TTL cache.
+func (s *Server) StreamBalances(req *pb.BalanceStreamRequest, stream pb.ExecutionService_StreamBalancesServer) error {
+	exchangeName := req.Exchange
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+	exchangeName, account := normalizeExchangeAccount(exchangeName, req.Account)
+	if account == "all" {
+		return status.Error(codes.InvalidArgument, "account all cannot be streamed; open a stream per account")
+	}
+	heartbeat := balanceStreamHeartbeat
+	if req.HeartbeatSeconds < 0 {
+		return status.Error(codes.InvalidArgument, "heartbeat_seconds must not be negative")
+	}
+	if req.HeartbeatSeconds > 0 {
+		heartbeat = time.Duration(req.HeartbeatSeconds) * time.Second
+	}
+	pollInterval := balanceStreamPollInterval
+	if req.PollIntervalMs != 0 {
+		pollInterval = time.Duration(req.PollIntervalMs) * time.Millisecond
+	}
+	if pollInterval < balanceStreamMinPollInterval {
+		return status.Errorf(codes.InvalidArgument, "poll_interval_ms must be at least %d",
+			balanceStreamMinPollInterval.Milliseconds())
+	}
+
+	key := exchangeKey(exchangeName, account)
+	s.mu.RLock()
+	exchange, exists := s.exchanges[key]
+	s.mu.RUnlock()
+	if !exists {
+		return status.Errorf(codes.NotFound, "exchange %s not configured", key)
+	}
+
+	// Subscribe before the first fetch so no change in between is lost
+	source := "poll"
+	var updates <-chan *accountUpdate
+	var sub *accountSubscriber
+	if streamer, ok := exchange.(accountStreamer); ok {
+		manager := streamer.AccountStream()
+		sub = manager.subscribe()
+		defer manager.unsubscribe(sub)
+		updates = sub.send
+		source = "push"
+	}
+	ctx := stream.Context()
+
+	// Pushed changes apply to a fresh balance, not one from the cache
+	current, _, err := s.cachedBalance(ctx, key, exchange, source == "push")
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to get balance: %v", err)
+	}
+	if err := stream.Send(balanceUpdateProto(exchangeName, current, nil, "")); err != nil {
+		return err
+	}
+
+	gauge := balanceStreams.WithLabelValues(key, source)
+	gauge.Inc()
+	defer gauge.Dec()
+	logEvent(ctx, "Balance stream opened", "exchange", key, "source", source, "heartbeat", heartbeat)
+
+	heartbeats := time.NewTicker(heartbeat)
+	defer heartbeats.Stop()
+	var poll <-chan time.Time
+	if updates == nil {
+		pollTicker := time.NewTicker(pollInterval)
+		defer pollTicker.Stop()
+		poll = pollTicker.C
+	}
+
+	// sendChanges moves the stream to next, sending the assets that changed
+	sendChanges := func(next *Balance, reason string) error {
+		changed := changedBalances(current, next)
+		current = next
+		if len(changed) == 0 {
+			return nil
+		}
+		return stream.Send(balanceUpdateProto(exchangeName, current, changed, reason))
+	}
+	refetch := func(force bool) (*Balance, bool) {
+		next, _, err := s.cachedBalance(ctx, key, exchange, force)
+		if err != nil {
+			logEvent(ctx, "Balance stream refresh failed", "exchange", key, "error", err)
+			return nil, false
+		}
+		return next, true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logEvent(ctx, "Balance stream closed", "exchange", key)
+			return nil
+		case <-s.streamCtx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case update, ok := <-updates:
+			if !ok {
+				if sub.dropped {
+					return status.Errorf(codes.ResourceExhausted, "stream fell more than %d updates behind", accountUpdateBuffer)
+				}
+				return status.Error(codes.Unavailable, "account stream closed")
+			}
+			if update.ExecutedOrderID != "" {
+				continue // the account position that follows carries the balance change
+			}
+			if update.Resync {
+				next, ok := refetch(true)
+				if !ok {
+					continue
+				}
+				if err := sendChanges(next, balanceReasonUnknown); err != nil {
+					return err
+				}
+				continue
+			}
+			s.invalidateBalance(ctx, key)
+			if err := sendChanges(applyAccountUpdate(current, update, s.prices), update.Reason); err != nil {
+				return err
+			}
+		case <-poll:
+			next, ok := refetch(false)
+			if !ok {
+				continue
+			}
+			if err := sendChanges(next, balanceReasonUnknown); err != nil {
+				return err
+			}
+		case <-heartbeats.C:
+			// Prices move between changes, so the snapshot is valued afresh
+			if s.prices != nil {
+				s.prices.Value(current)
+			}
+			current.Timestamp = time.Now()
+			if err := stream.Send(balanceUpdateProto(exchangeName, current, nil, "")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyAccountUpdate returns a copy of balance with the pushed amounts applied and
+// revalued. Assets that dropped to zero are removed, as GetBalance leaves them out.
+func applyAccountUpdate(balance *Balance, update *accountUpdate, prices *PriceCache) *Balance {
+	next := *balance
+	next.Balances = make(map[string]AssetBalance, len(balance.Balances))
+	for asset, bal := range balance.Balances {
+		next.Balances[asset] = bal
+	}
+	for asset, bal := range update.Balances {
+		if bal.Total == 0 {
+			delete(next.Balances, asset)
+			continue
+		}
+		next.Balances[asset] = bal
+	}
+	next.Timestamp = update.Timestamp
+	if prices != nil {
+		prices.Value(&next)
+	}
+	return &next
+}
+
+// changedBalances returns the assets of next whose amounts differ from previous,
+// with a zero balance for those that are gone. Value changes alone do not count.
+func changedBalances(previous, next *Balance) map[string]AssetBalance {
+	changed := make(map[string]AssetBalance)
+	for asset, bal := range next.Balances {
+		before, ok := previous.Balances[asset]
+		if !ok || before.Free != bal.Free || before.Locked != bal.Locked ||
+			before.Borrowed != bal.Borrowed || before.Interest != bal.Interest {
+			changed[asset] = bal
+		}
+	}
+	for asset := range previous.Balances {
+		if _, ok := next.Balances[asset]; !ok {
+			changed[asset] = AssetBalance{Asset: asset}
+		}
+	}
+	return changed
+}
+
+// balanceUpdateProto builds a stream update: a snapshot of balance, or with
+// changed those assets only. The total always covers the whole account.
+func balanceUpdateProto(exchange string, balance *Balance, changed map[string]AssetBalance,
+	reason string) *pb.BalanceResponse {
+	resp := balanceResponseProto(exchange, balance)
+	resp.UpdateType = balanceUpdateSnapshot
+	if changed != nil {
+		resp.UpdateType = balanceUpdateChange
+		resp.Reason = reason
+		resp.Balances = assetBalancesProto(changed)
+	}
+	return resp
+}
+
+// balanceResponseProto converts a balance for GetBalance and StreamBalances
+func balanceResponseProto(exchange string, balance *Balance) *pb.BalanceResponse {
+	return &pb.BalanceResponse{
+		Exchange:       exchange,
+		Balances:       assetBalancesProto(balance.Balances),
+		TotalValueUsd:  balance.TotalValueUSD,
+		UnpricedAssets: balance.UnpricedAssets,
+		MarginLevel:    balance.MarginLevel,
+		Timestamp:      timestamppb.New(balance.Timestamp),
+	}
+}
+
+func assetBalancesProto(balances map[string]AssetBalance) map[string]*pb.AssetBalance {
+	out := make(map[string]*pb.AssetBalance, len(balances))
+	for asset, bal := range balances {
+		out[asset] = &pb.AssetBalance{
+			Asset:    bal.Asset,
+			Free:     bal.Free,
+			Locked:   bal.Locked,
+			Total:    bal.Total,
+			ValueUsd: bal.ValueUSD,
+			Borrowed: bal.Borrowed,
+			Interest: bal.Interest,
+		}
+	}
+	return out
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errBatchDeadline marks legs the batch deadline cut short
+var errBatchDeadline = errors.New("batch deadline exceeded")
+
+// errBatchAborted marks legs an atomic batch skipped after another leg failed
+var errBatchAborted = errors.New("batch aborted after a failed leg")
+
+// batchLeg is the outcome of one order in a batch
+type batchLeg struct {
+	result    *OrderResult
+	err       error
+	submitted bool // false when the order never reached the exchange
+}
+
+// batchResult is a finished batch. placed counts the legs that succeeded; when an
+// atomic batch had a failed leg, unwound holds every leg's final state.
+type batchResult struct {
+	legs    []batchLeg
+	placed  int
+	unwound []legOutcome
+}
+
+// batchSubmit runs a validated batch for the REST and gRPC batch endpoints: legs
+// go out under BATCH_TIMEOUT, and an atomic batch with a failed leg is unwound
+func (s *Server) batchSubmit(ctx context.Context, key string, exchange Exchange, orders []*Order, atomic bool) *batchResult {
+	start := time.Now()
+	legCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.config.BatchTimeout > 0 {
+		legCtx, cancel = context.WithTimeout(ctx, s.config.BatchTimeout)
+	}
+	defer cancel()
+	batch := &batchResult{legs: s.submitBatch(legCtx, key, exchange, orders, atomic)}
+	s.batchStats.observe(len(orders), time.Since(start))
+
+	for _, leg := range batch.legs {
+		if leg.err == nil {
+			batch.placed++
+		}
+	}
+	if atomic && batch.placed < len(batch.legs) {
+		batch.unwound = s.unwindBatch(ctx, key, exchange, orders, batch.legs)
+		logEvent(ctx, "Atomic batch failed", "legs", len(batch.legs), "placed", batch.placed)
+	}
+	return batch
+}
+
+// submitBatch places orders with up to BATCH_CONCURRENCY in flight. Results keep
+// the input order. Once ctx expires no new legs start, and legs still waiting on
+// the exchange are reported with an unknown outcome rather than stalling the batch.
+// With stopOnFailure, the first failed leg also stops new legs from starting.
+func (s *Server) submitBatch(ctx context.Context, key string, exchange Exchange, orders []*Order, stopOnFailure bool) []batchLeg {
+	legs := make([]batchLeg, len(orders))
+
+	// Stopping dispatch must not cut short legs already at the exchange
+	abort := make(chan struct{})
+	var abortOnce sync.Once
+
+	workers := s.config.BatchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(orders) {
+		workers = len(orders)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// A leg handed over just as another failed must not reach the exchange
+				select {
+				case <-abort:
+					legs[i] = batchLeg{err: fmt.Errorf("%w, order not submitted", errBatchAborted)}
+					continue
+				default:
+				}
+				legs[i] = s.submitLeg(ctx, key, exchange, orders[i])
+				if stopOnFailure && legs[i].err != nil {
+					abortOnce.Do(func() { close(abort) })
+				}
+			}
+		}()
+	}
+
+	next := 0
+	skipped := fmt.Errorf("%w, order not submitted", errBatchDeadline)
+dispatch:
+	for ; next < len(orders); next++ {
+		select {
+		case <-abort:
+			skipped = fmt.Errorf("%w, order not submitted", errBatchAborted)
+			break dispatch
+		default:
+		}
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break dispatch
+		case <-abort:
+			skipped = fmt.Errorf("%w, order not submitted", errBatchAborted)
+			break dispatch
+		}
+	}
+	for i := next; i < len(orders); i++ {
+		legs[i] = batchLeg{err: skipped}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return legs
+}
+
+func (s *Server) submitLeg(ctx context.Context, key string, exchange Exchange, order *Order) batchLeg {
+	if ctx.Err() != nil {
+		return batchLeg{err: fmt.Errorf("%w, order not submitted", errBatchDeadline)}
+	}
+
+	// Exchanges without context support cannot be interrupted, so wait on the side
+	done := make(chan batchLeg, 1)
+	go func() {
+		result, err := s.submitOrder(ctx, key, exchange, order)
+		done <- batchLeg{result: result, err: err, submitted: true}
+	}()
+
+	select {
+	case leg := <-done:
+		return leg
+	case <-ctx.Done():
+		logEvent(ctx, "Batch leg timed out", "order_id", order.ID, "symbol", order.Symbol)
+		return batchLeg{
+			err:       fmt.Errorf("%w, order outcome unknown (check order status)", errBatchDeadline),
+			submitted: true,
+		}
+	}
+}
+
+// Per-leg outcomes reported by atomic batches
+const (
+	legSubmitted      = "submitted"
+	legFailed         = "failed"
+	legNeverSubmitted = "never_submitted"
+	legUnknown        = "unknown" // timed out; may or may not be on the exchange
+	legCancelled      = "cancelled"
+	legCancelFailed   = "cancel_failed"
+	legFilled         = "filled_cannot_undo"
+)
+
+// unwindTimeout bounds cancelling the placed legs of a failed atomic batch. It is
+// separate from the batch deadline, which may already have passed.
+const unwindTimeout = 15 * time.Second
+
+// legOutcome is a leg's final state after an atomic batch is unwound
+type legOutcome struct {
+	state string
+	err   error
+}
+
+// unwindBatch cancels the legs of a failed atomic batch that are still open.
+// Filled legs cannot be undone and are reported as such.
+func (s *Server) unwindBatch(ctx context.Context, key string, exchange Exchange, orders []*Order, legs []batchLeg) []legOutcome {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unwindTimeout)
+	defer cancel()
+
+	outcomes := make([]legOutcome, len(legs))
+	for i, leg := range legs {
+		switch {
+		case !leg.submitted:
+			outcomes[i] = legOutcome{state: legNeverSubmitted, err: leg.err}
+		case errors.Is(leg.err, errBatchDeadline):
+			outcomes[i] = legOutcome{state: legUnknown, err: leg.err}
+		case leg.err != nil:
+			outcomes[i] = legOutcome{state: legFailed, err: leg.err}
+		case leg.result.Status == "FILLED":
+			outcomes[i] = legOutcome{state: legFilled}
+		default:
+			if err := s.cancelOrder(ctx, key, exchange, orders[i], leg.result.ExchangeOrderID); err != nil {
+				logEvent(ctx, "Failed to unwind batch leg", "order_id", orders[i].ID, "error", err)
+				outcomes[i] = legOutcome{state: legCancelFailed, err: err}
+			} else {
+				outcomes[i] = legOutcome{state: legCancelled}
+			}
+		}
+	}
+	return outcomes
+}
+
+// batchMetrics records the size and end-to-end latency of order batches
+type batchMetrics struct {
+	size     prometheus.Histogram
+	duration prometheus.Histogram
+}
+
+func newBatchMetrics() *batchMetrics {
+	return &batchMetrics{
+		size: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "signalops_order_batch_size",
+			Help:    "Orders per batch submission.",
+			Buckets: []float64{1, 5, 10, 25, 50, 100, 250},
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "signalops_order_batch_duration_seconds",
+			Help:    "End-to-end latency of batch submissions.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}),
+	}
+}
+
+func (bm *batchMetrics) observe(orders int, elapsed time.Duration) {
+	if bm == nil {
+		return
+	}
+	bm.size.Observe(float64(orders))
+	bm.duration.Observe(elapsed.Seconds())
+}
+
+func (bm *batchMetrics) collect(ch chan<- prometheus.Metric) {
+	if bm == nil {
+		return
+	}
+	bm.size.Collect(ch)
+	bm.duration.Collect(ch)
+}
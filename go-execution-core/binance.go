@@ -6,23 +6,31 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// RateLimiter implements token bucket algorithm for Binance API rate limiting
-// Binance limit: 1200 requests/minute = 20 requests/second
+// RateLimiter implements token bucket algorithm for exchange API rate limiting.
+// Tokens are request weight: endpoints that cost an exchange more of its budget
+// take more than one. With EXCHANGE_RATE_LIMIT_MODE=distributed the bucket lives in
+// Redis and is shared by every instance using the same API key (exchange_ratelimit.go);
+// the local bucket takes over while Redis is unavailable.
 type RateLimiter struct {
 	tokens     float64
 	maxTokens  float64
 	refillRate float64 // tokens per second
 	lastRefill time.Time
 	mu         sync.Mutex
+
+	exchange, keyID string        // metric labels; "" for limiters not guarding an exchange
+	shared          *sharedBucket // nil in local mode
 }
 
 func NewRateLimiter(requestsPerSecond float64) *RateLimiter {
@@ -34,37 +42,87 @@ func NewRateLimiter(requestsPerSecond float64) *RateLimiter {
 	}
 }
 
+// Wait blocks until a token is available
 func (rl *RateLimiter) Wait(ctx context.Context) error {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	return rl.WaitN(ctx, 1)
+}
 
-	// Refill tokens based on time elapsed
-	now := time.Now()
-	elapsed := now.Sub(rl.lastRefill).Seconds()
-	rl.tokens = min(rl.maxTokens, rl.tokens+elapsed*rl.refillRate)
-	rl.lastRefill = now
+// WaitN blocks until weight tokens are available. The tokens are reserved up front
+// (the bucket may go negative), so concurrent waiters queue behind each other
+// instead of all waking at once; a cancelled wait hands its tokens back.
+func (rl *RateLimiter) WaitN(ctx context.Context, weight float64) error {
+	limiter := rateLimiterLocal
+	if rl.shared != nil {
+		handled, err := rl.shared.wait(ctx, rl, weight)
+		if handled {
+			return err
+		}
+		limiter = rateLimiterFallback
+	}
 
-	// If we have tokens, consume one and proceed
-	if rl.tokens >= 1.0 {
-		rl.tokens -= 1.0
+	rl.mu.Lock()
+	rl.refill()
+	rl.tokens -= weight
+	deficit := -rl.tokens
+	rl.mu.Unlock()
+	rl.record(limiter, weight, -deficit)
+
+	if deficit <= 0 {
 		return nil
 	}
 
-	// Calculate wait time needed
-	waitTime := time.Duration((1.0-rl.tokens)/rl.refillRate*1000) * time.Millisecond
-	rl.mu.Unlock()
+	timer := time.NewTimer(time.Duration(deficit / rl.refillRate * float64(time.Second)))
+	defer timer.Stop()
 
-	// Wait with context support
 	select {
-	case <-time.After(waitTime):
-		rl.mu.Lock()
-		rl.tokens = 0
+	case <-timer.C:
 		return nil
 	case <-ctx.Done():
+		rl.mu.Lock()
+		rl.tokens += weight
+		rl.mu.Unlock()
 		return ctx.Err()
 	}
 }
 
+// NewBurstRateLimiter allows bursts of up to burst requests on top of a steady rate
+func NewBurstRateLimiter(requestsPerSecond, burst float64) *RateLimiter {
+	rl := NewRateLimiter(requestsPerSecond)
+	rl.tokens = burst
+	rl.maxTokens = burst
+	return rl
+}
+
+// refill adds tokens for the time elapsed since the last refill; callers hold rl.mu
+func (rl *RateLimiter) refill() {
+	now := time.Now()
+	rl.tokens = min(rl.maxTokens, rl.tokens+now.Sub(rl.lastRefill).Seconds()*rl.refillRate)
+	rl.lastRefill = now
+}
+
+// Allow consumes a token without blocking. When none is available it returns false
+// and how long until one will be.
+func (rl *RateLimiter) Allow() (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refill()
+	if rl.tokens >= 1.0 {
+		rl.tokens -= 1.0
+		return true, 0
+	}
+	return false, time.Duration((1.0 - rl.tokens) / rl.refillRate * float64(time.Second))
+}
+
+// Available returns the number of tokens currently in the bucket
+func (rl *RateLimiter) Available() float64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refill()
+	return rl.tokens
+}
+
 func min(a, b float64) float64 {
 	if a < b {
 		return a
@@ -74,30 +132,55 @@ func min(a, b float64) float64 {
 
 // BinanceExchange implements Exchange interface for Binance
 type BinanceExchange struct {
-	apiKey      string
-	apiSecret   string
-	baseURL     string
-	client      *http.Client
-	rateLimiter *RateLimiter
+	apiKey        string
+	apiSecret     string
+	baseURL       string
+	wsURL         string
+	client        *http.Client
+	rateLimiter   *RateLimiter
+	depthStreams  *DepthStreamManager
+	klineStreams  *KlineStreamManager
+	marketStreams *MarketStreamManager
+	accountStream *AccountStreamManager
+	symbols       symbolCache
 }
 
 func NewBinanceExchange(apiKey, apiSecret string) *BinanceExchange {
-	return &BinanceExchange{
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		baseURL:   "https://api.binance.com",
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		rateLimiter: NewRateLimiter(18.0), // 18 req/s = 1080 req/min (safe margin under 1200 limit)
-	}
+	b := &BinanceExchange{
+		apiKey:      apiKey,
+		apiSecret:   apiSecret,
+		baseURL:     "https://api.binance.com",
+		wsURL:       "wss://stream.binance.com:9443",
+		client:      newExchangeHTTPClient("binance", 10*time.Second),
+		rateLimiter: newExchangeRateLimiter("binance", apiKey, 90), // 5400 weight/min, safe margin under the 6000 limit
+	}
+	b.depthStreams = NewDepthStreamManager(b, b.wsURL)
+	b.klineStreams = NewKlineStreamManager(b, b.wsURL, defaultKlineWindowSize)
+	b.marketStreams = NewMarketStreamManager(b.wsURL)
+	b.accountStream = NewAccountStreamManager(b, b.wsURL)
+	return b
+}
+
+// KnownSymbols returns the spot symbols currently trading
+func (b *BinanceExchange) KnownSymbols() (map[string]bool, error) {
+	return b.symbols.get(func() (map[string]bool, error) {
+		return fetchBinanceSymbols(b.client, b.baseURL+"/api/v3/exchangeInfo")
+	})
 }
 
-func (b *BinanceExchange) GetMarketData(symbol string) (*MarketData, error) {
+func (b *BinanceExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	if err := b.rateLimiter.WaitN(ctx, 2); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
 	// Get 24hr ticker data
-	url := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", b.baseURL, symbol)
+	reqURL := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", b.baseURL, url.QueryEscape(symbol))
 
-	resp, err := b.client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch market data: %w", err)
 	}
@@ -167,7 +250,12 @@ func (b *BinanceExchange) GetMarketData(symbol string) (*MarketData, error) {
 	}, nil
 }
 
-func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
+// SubmitOrder places an order; failures are logged with ctx's request ID
+func (b *BinanceExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	if err := b.rateLimiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
 	// Build order parameters
 	params := url.Values{}
 	params.Set("symbol", order.Symbol)
@@ -189,7 +277,7 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 	// Make request
 	reqURL := fmt.Sprintf("%s/api/v3/order?%s", b.baseURL, params.Encode())
 
-	req, err := http.NewRequest("POST", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +286,7 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 
 	resp, err := b.client.Do(req)
 	if err != nil {
+		logEvent(ctx, "Binance order request failed", "order_id", order.ID, "symbol", order.Symbol, "error", err)
 		return nil, fmt.Errorf("failed to submit order: %w", err)
 	}
 	defer resp.Body.Close()
@@ -205,12 +294,68 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
+		logEvent(ctx, "Binance order rejected", "order_id", order.ID, "symbol", order.Symbol,
+			"status", resp.StatusCode, "body", string(body))
 		return &OrderResult{
 			OrderID: order.ID,
 			Status:  "FAILED",
 		}, fmt.Errorf("binance order failed: %s - %s", resp.Status, string(body))
 	}
 
+	result, err := parseBinanceOrderResponse(order, body)
+	if err != nil {
+		return nil, err
+	}
+	b.convertFeeAssets(ctx, order.Symbol, result)
+	return result, nil
+}
+
+// binanceQuoteAssets are the quote currencies a symbol is split on, longest first
+// where one is a suffix of another
+var binanceQuoteAssets = []string{"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "DAI", "BTC", "ETH", "BNB", "EUR", "TRY", "BRL"}
+
+// binanceQuoteAsset is symbol's quote currency, or "" when it is not one of
+// binanceQuoteAssets
+func binanceQuoteAsset(symbol string) string {
+	for _, quote := range binanceQuoteAssets {
+		if strings.HasSuffix(symbol, quote) && len(symbol) > len(quote) {
+			return quote
+		}
+	}
+	return ""
+}
+
+// convertFeeAssets adds commission paid in a third asset (BNB discounts) to
+// result.Fees at the asset's current price in the symbol's quote currency.
+// Assets that cannot be priced stay in FeeAssets, out of Fees.
+func (b *BinanceExchange) convertFeeAssets(ctx context.Context, symbol string, result *OrderResult) {
+	quote := binanceQuoteAsset(symbol)
+	for asset, amount := range result.FeeAssets {
+		if quote == "" {
+			break
+		}
+		market, err := b.GetMarketData(ctx, asset+quote)
+		if err != nil || market.Price <= 0 {
+			logEvent(ctx, "Failed to convert commission to quote currency", "order_id", result.OrderID,
+				"symbol", symbol, "asset", asset, "amount", amount, "error", err)
+			continue
+		}
+		result.Fees += amount * market.Price
+		delete(result.FeeAssets, asset)
+	}
+	if len(result.FeeAssets) > 0 {
+		logEvent(ctx, "Commission left out of fees", "order_id", result.OrderID, "symbol", symbol,
+			"assets", result.FeeAssets)
+	} else {
+		result.FeeAssets = nil
+	}
+}
+
+// parseBinanceOrderResponse converts a FULL order response (spot and margin) into an OrderResult,
+// computing the volume-weighted execution price and total commission from the fills. Commission
+// paid in the base asset is valued at its fill's price; commission in any other asset than the
+// symbol's two is left in FeeAssets for convertFeeAssets.
+func parseBinanceOrderResponse(order *Order, body []byte) (*OrderResult, error) {
 	var orderResp struct {
 		OrderID             int64  `json:"orderId"`
 		Symbol              string `json:"symbol"`
@@ -218,9 +363,10 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 		ExecutedQty         string `json:"executedQty"`
 		CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
 		Fills               []struct {
-			Price      string `json:"price"`
-			Qty        string `json:"qty"`
-			Commission string `json:"commission"`
+			Price           string `json:"price"`
+			Qty             string `json:"qty"`
+			Commission      string `json:"commission"`
+			CommissionAsset string `json:"commissionAsset"`
 		} `json:"fills"`
 	}
 
@@ -234,6 +380,7 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 		return nil, fmt.Errorf("invalid executed quantity '%s': %w", orderResp.ExecutedQty, err)
 	}
 	var totalValue, totalFees float64
+	var feeAssets map[string]float64
 
 	for _, fill := range orderResp.Fills {
 		fillPrice, err := strconv.ParseFloat(fill.Price, 64)
@@ -250,7 +397,17 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 		}
 
 		totalValue += fillPrice * fillQty
-		totalFees += commission
+		switch {
+		case commission == 0, fill.CommissionAsset == "", strings.HasSuffix(orderResp.Symbol, fill.CommissionAsset):
+			totalFees += commission
+		case strings.HasPrefix(orderResp.Symbol, fill.CommissionAsset):
+			totalFees += commission * fillPrice
+		default:
+			if feeAssets == nil {
+				feeAssets = make(map[string]float64)
+			}
+			feeAssets[fill.CommissionAsset] += commission
+		}
 	}
 
 	avgPrice := 0.0
@@ -265,12 +422,32 @@ func (b *BinanceExchange) SubmitOrder(order *Order) (*OrderResult, error) {
 		ExecutedPrice:    avgPrice,
 		ExecutedQuantity: executedQty,
 		Fees:             totalFees,
+		FeeAssets:        feeAssets,
 		Timestamp:        time.Now(),
 	}, nil
 }
 
-func (b *BinanceExchange) GetOrderStatus(orderID string) (*OrderStatus, error) {
+// errOrderSymbolRequired is returned by Binance order lookups without a symbol,
+// which every Binance order endpoint rejects
+var errOrderSymbolRequired = errors.New("order lookups on Binance need the symbol")
+
+// GetOrderStatus cannot look an order up by ID alone; callers pass the symbol
+// through GetSymbolOrderStatus
+func (b *BinanceExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	return nil, errOrderSymbolRequired
+}
+
+// GetSymbolOrderStatus queries an order by symbol, which Binance requires
+func (b *BinanceExchange) GetSymbolOrderStatus(ctx context.Context, symbol, orderID string) (*OrderStatus, error) {
+	if symbol == "" {
+		return nil, errOrderSymbolRequired
+	}
+	if err := b.rateLimiter.WaitN(ctx, 4); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
 	params := url.Values{}
+	params.Set("symbol", symbol)
 	params.Set("orderId", orderID)
 	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
 
@@ -279,7 +456,7 @@ func (b *BinanceExchange) GetOrderStatus(orderID string) (*OrderStatus, error) {
 
 	reqURL := fmt.Sprintf("%s/api/v3/order?%s", b.baseURL, params.Encode())
 
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -292,14 +469,23 @@ func (b *BinanceExchange) GetOrderStatus(orderID string) (*OrderStatus, error) {
 	}
 	defer resp.Body.Close()
 
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		// -2013: order does not exist
+		if strings.Contains(string(body), `"code":-2013`) {
+			return nil, fmt.Errorf("binance API error: %s - %s: %w", resp.Status, string(body), errUnknownOrder)
+		}
+		return nil, fmt.Errorf("binance API error: %s - %s", resp.Status, string(body))
+	}
+
 	var orderResp struct {
-		OrderID     int64  `json:"orderId"`
-		Status      string `json:"status"`
-		ExecutedQty string `json:"executedQty"`
-		Price       string `json:"price"`
+		OrderID             int64  `json:"orderId"`
+		Status              string `json:"status"`
+		ExecutedQty         string `json:"executedQty"`
+		CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&orderResp); err != nil {
+	if err := json.Unmarshal(body, &orderResp); err != nil {
 		return nil, fmt.Errorf("failed to decode status response: %w", err)
 	}
 
@@ -307,21 +493,31 @@ func (b *BinanceExchange) GetOrderStatus(orderID string) (*OrderStatus, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid filled quantity '%s': %w", orderResp.ExecutedQty, err)
 	}
-	price, err := strconv.ParseFloat(orderResp.Price, 64)
+	quoteQty, err := strconv.ParseFloat(orderResp.CummulativeQuoteQty, 64)
 	if err != nil {
-		return nil, fmt.Errorf("invalid price '%s': %w", orderResp.Price, err)
+		return nil, fmt.Errorf("invalid quote quantity '%s': %w", orderResp.CummulativeQuoteQty, err)
+	}
+
+	// The order's limit price is not what it filled at; derive the average
+	avgPrice := 0.0
+	if filledQty > 0 {
+		avgPrice = quoteQty / filledQty
 	}
 
 	return &OrderStatus{
 		OrderID:      fmt.Sprintf("%d", orderResp.OrderID),
 		Status:       orderResp.Status,
 		FilledQty:    filledQty,
-		AveragePrice: price,
+		AveragePrice: avgPrice,
 		UpdatedAt:    time.Now(),
 	}, nil
 }
 
-func (b *BinanceExchange) GetBalance() (*Balance, error) {
+func (b *BinanceExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	if err := b.rateLimiter.WaitN(ctx, 20); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
 	params := url.Values{}
 	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
 
@@ -330,7 +526,7 @@ func (b *BinanceExchange) GetBalance() (*Balance, error) {
 
 	reqURL := fmt.Sprintf("%s/api/v3/account?%s", b.baseURL, params.Encode())
 
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -384,8 +580,81 @@ func (b *BinanceExchange) GetBalance() (*Balance, error) {
 	}, nil
 }
 
+// Ping checks connectivity via /api/v3/ping, then validates credentials with the
+// weight-1 signed account status call when an API key is configured
+func (b *BinanceExchange) Ping(ctx context.Context) error {
+	if err := b.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/api/v3/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping failed: %s", resp.Status)
+	}
+
+	if b.apiKey == "" {
+		return nil
+	}
+
+	if err := b.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+	params := url.Values{}
+	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
+	params.Set("signature", b.sign(params.Encode()))
+
+	req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/sapi/v1/account/status?%s", b.baseURL, params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+
+	resp, err = b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("credential check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("credential check failed: %s - %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// UseTestnet points REST and websocket traffic at the Binance spot testnet.
+// Must be called before any streams are started.
+func (b *BinanceExchange) UseTestnet() {
+	b.baseURL = "https://testnet.binance.vision"
+	b.wsURL = "wss://stream.testnet.binance.vision"
+	b.depthStreams.wsURL = b.wsURL
+	b.klineStreams.wsURL = b.wsURL
+	b.marketStreams.wsURL = b.wsURL
+	b.accountStream.wsURL = b.wsURL
+}
+
+// Close stops the depth, kline, market and account streams owned by this exchange
+func (b *BinanceExchange) Close() {
+	b.depthStreams.Close()
+	b.klineStreams.Close()
+	b.marketStreams.Close()
+	b.accountStream.Close()
+}
+
 func (b *BinanceExchange) sign(queryString string) string {
-	mac := hmac.New(sha256.New, []byte(b.apiSecret))
-	mac.Write([]byte(queryString))
+	return signHMACSHA256(b.apiSecret, queryString)
+}
+
+// signHMACSHA256 returns the hex HMAC-SHA256 signature used by Binance signed endpoints
+func signHMACSHA256(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
 	return hex.EncodeToString(mac.Sum(nil))
 }
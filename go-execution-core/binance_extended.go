@@ -8,66 +8,16 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// GetHistoricalKlines fetches historical OHLCV data from Binance
+// GetHistoricalKlines fetches the most recent OHLCV candles from Binance
 func (b *BinanceExchange) GetHistoricalKlines(symbol, interval string, limit int) ([]Kline, error) {
-	// Apply rate limiting
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := b.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limit wait failed: %w", err)
-	}
-
-	url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=%s&limit=%d",
-		b.baseURL, symbol, interval, limit)
-
-	resp, err := b.client.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch klines: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("binance API error: %s - %s", resp.Status, string(body))
-	}
-
-	var rawKlines [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawKlines); err != nil {
-		return nil, fmt.Errorf("failed to decode klines: %w", err)
-	}
-
-	klines := make([]Kline, 0, len(rawKlines))
-	for _, raw := range rawKlines {
-		if len(raw) < 11 {
-			continue
-		}
-
-		// Parse timestamp
-		timestamp := int64(raw[0].(float64))
-
-		// Parse OHLCV values
-		open, _ := strconv.ParseFloat(raw[1].(string), 64)
-		high, _ := strconv.ParseFloat(raw[2].(string), 64)
-		low, _ := strconv.ParseFloat(raw[3].(string), 64)
-		close, _ := strconv.ParseFloat(raw[4].(string), 64)
-		volume, _ := strconv.ParseFloat(raw[5].(string), 64)
-
-		klines = append(klines, Kline{
-			OpenTime:  time.UnixMilli(timestamp),
-			Open:      open,
-			High:      high,
-			Low:       low,
-			Close:     close,
-			Volume:    volume,
-			CloseTime: time.UnixMilli(int64(raw[6].(float64))),
-		})
-	}
-
-	return klines, nil
+	return b.GetKlines(ctx, symbol, interval, time.Time{}, time.Time{}, limit)
 }
 
 // GetOrderBook fetches order book depth from Binance
@@ -76,13 +26,13 @@ func (b *BinanceExchange) GetOrderBook(symbol string, limit int) (*OrderBook, er
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := b.rateLimiter.Wait(ctx); err != nil {
+	if err := b.rateLimiter.WaitN(ctx, binanceDepthWeight(limit)); err != nil {
 		return nil, fmt.Errorf("rate limit wait failed: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=%d", b.baseURL, symbol, limit)
+	reqURL := fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=%d", b.baseURL, url.QueryEscape(symbol), limit)
 
-	resp, err := b.client.Get(url)
+	resp, err := b.client.Get(reqURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch order book: %w", err)
 	}
@@ -132,10 +82,24 @@ func (b *BinanceExchange) GetOrderBook(symbol string, limit int) (*OrderBook, er
 	}, nil
 }
 
+// binanceDepthWeight is the request weight of an order book of limit levels
+func binanceDepthWeight(limit int) float64 {
+	switch {
+	case limit <= 100:
+		return 5
+	case limit <= 500:
+		return 25
+	case limit <= 1000:
+		return 50
+	default:
+		return 250
+	}
+}
+
 // CancelOrder cancels an existing order on Binance
-func (b *BinanceExchange) CancelOrder(symbol, orderID string) error {
+func (b *BinanceExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
 	// Apply rate limiting
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	if err := b.rateLimiter.Wait(ctx); err != nil {
@@ -152,7 +116,7 @@ func (b *BinanceExchange) CancelOrder(symbol, orderID string) error {
 
 	reqURL := fmt.Sprintf("%s/api/v3/order?%s", b.baseURL, params.Encode())
 
-	req, err := http.NewRequest("DELETE", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", reqURL, nil)
 	if err != nil {
 		return err
 	}
@@ -161,35 +125,77 @@ func (b *BinanceExchange) CancelOrder(symbol, orderID string) error {
 
 	resp, err := b.client.Do(req)
 	if err != nil {
+		logEvent(ctx, "Binance cancel request failed", "order_id", orderID, "symbol", symbol, "error", err)
 		return fmt.Errorf("failed to cancel order: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		logEvent(ctx, "Binance cancel rejected", "order_id", orderID, "symbol", symbol,
+			"status", resp.StatusCode, "body", string(body))
+		// -2011 covers both unknown and already closed orders
+		if strings.Contains(string(body), `"code":-2011`) {
+			return fmt.Errorf("binance cancel failed: %s - %s: %w", resp.Status, string(body), errUnknownOrder)
+		}
 		return fmt.Errorf("binance cancel failed: %s - %s", resp.Status, string(body))
 	}
 
 	return nil
 }
 
-// ModifyOrder modifies an existing order (cancel + replace)
-func (b *BinanceExchange) ModifyOrder(symbol, orderID string, newQuantity, newPrice float64) (*OrderResult, error) {
-	// First, cancel the existing order
-	if err := b.CancelOrder(symbol, orderID); err != nil {
-		return nil, fmt.Errorf("failed to cancel order for modification: %w", err)
+// CancelAllOrders cancels every open order on symbol in one request. Binance
+// answers -2011 when there is nothing to cancel, which is not an error here.
+func (b *BinanceExchange) CancelAllOrders(ctx context.Context, symbol string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := b.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
+	params.Set("signature", b.sign(params.Encode()))
+
+	reqURL := fmt.Sprintf("%s/api/v3/openOrders?%s", b.baseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "DELETE", reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to cancel open orders: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// Then submit a new order with updated parameters
-	newOrder := &Order{
-		Symbol:    symbol,
-		Side:      "BUY", // This should be determined from the original order
-		Quantity:  newQuantity,
-		Price:     newPrice,
-		OrderType: "LIMIT",
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), `"code":-2011`) {
+			return nil
+		}
+		logEvent(ctx, "Binance cancel all rejected", "symbol", symbol, "status", resp.StatusCode, "body", string(body))
+		return fmt.Errorf("binance cancel all failed: %s - %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// ModifyOrder replaces an open order (cancel + replace); Binance spot has no
+// in-place amend. If the cancel succeeds but the replacement is rejected, the
+// error wraps errReplacementFailed: the original order is gone.
+func (b *BinanceExchange) ModifyOrder(ctx context.Context, orderID string, replacement *Order) (*OrderResult, error) {
+	if err := b.CancelOrder(ctx, replacement.Symbol, orderID); err != nil {
+		return nil, fmt.Errorf("failed to cancel order for modification: %w", err)
 	}
 
-	return b.SubmitOrder(newOrder)
+	result, err := b.SubmitOrder(ctx, replacement)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errReplacementFailed, err)
+	}
+	return result, nil
 }
 
 // GetAllTickers fetches ticker data for all symbols
@@ -198,7 +204,8 @@ func (b *BinanceExchange) GetAllTickers() ([]TickerData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := b.rateLimiter.Wait(ctx); err != nil {
+	// Every symbol's 24hr ticker weighs 80
+	if err := b.rateLimiter.WaitN(ctx, 80); err != nil {
 		return nil, fmt.Errorf("rate limit wait failed: %w", err)
 	}
 
@@ -258,6 +265,7 @@ type Kline struct {
 	Close     float64
 	Volume    float64
 	CloseTime time.Time
+	IsClosed  bool // false for the currently forming candle
 }
 
 // OrderBook represents order book depth
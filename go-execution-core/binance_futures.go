@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BinanceFuturesExchange implements Exchange interface for Binance USDT-M futures
+type BinanceFuturesExchange struct {
+	apiKey      string
+	apiSecret   string
+	baseURL     string
+	client      *http.Client
+	rateLimiter *RateLimiter
+	symbols     symbolCache
+}
+
+func NewBinanceFuturesExchange(apiKey, apiSecret string) *BinanceFuturesExchange {
+	return &BinanceFuturesExchange{
+		apiKey:      apiKey,
+		apiSecret:   apiSecret,
+		baseURL:     "https://fapi.binance.com",
+		client:      newExchangeHTTPClient("binance_futures", 10*time.Second),
+		rateLimiter: newExchangeRateLimiter("binance_futures", apiKey, 35), // 2400 weight/min futures budget with headroom
+	}
+}
+
+// UseTestnet points requests at the Binance futures testnet
+func (f *BinanceFuturesExchange) UseTestnet() {
+	f.baseURL = "https://testnet.binancefuture.com"
+}
+
+// binanceFuturesWeights are the request weights of endpoints weighing more than 1
+var binanceFuturesWeights = map[string]float64{
+	"/fapi/v2/balance":           5,
+	"/fapi/v1/ticker/bookTicker": 2,
+}
+
+// wait takes path's request weight from the rate limiter; path may carry a query
+func (f *BinanceFuturesExchange) wait(ctx context.Context, path string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	weight, ok := binanceFuturesWeights[strings.SplitN(path, "?", 2)[0]]
+	if !ok {
+		weight = 1
+	}
+	if err := f.rateLimiter.WaitN(waitCtx, weight); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+	return nil
+}
+
+// signedRequest signs params and performs the request, returning the raw body
+func (f *BinanceFuturesExchange) signedRequest(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	if err := f.wait(ctx, path); err != nil {
+		return nil, err
+	}
+
+	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
+	params.Set("signature", f.sign(params.Encode()))
+
+	reqURL := fmt.Sprintf("%s%s?%s", f.baseURL, path, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-MBX-APIKEY", f.apiKey)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("futures request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("binance futures API error: %s - %s", resp.Status, string(body))
+	}
+
+	return body, nil
+}
+
+// publicGet performs an unsigned GET and decodes the JSON response
+func (f *BinanceFuturesExchange) publicGet(ctx context.Context, path string, out interface{}) error {
+	if err := f.wait(ctx, path); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", f.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("binance futures API error: %s - %s", resp.Status, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (f *BinanceFuturesExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	var ticker struct {
+		Symbol      string `json:"symbol"`
+		LastPrice   string `json:"lastPrice"`
+		Volume      string `json:"volume"`
+		HighPrice   string `json:"highPrice"`
+		LowPrice    string `json:"lowPrice"`
+		PriceChange string `json:"priceChange"`
+	}
+	if err := f.publicGet(ctx, "/fapi/v1/ticker/24hr?symbol="+url.QueryEscape(symbol), &ticker); err != nil {
+		return nil, err
+	}
+
+	// The futures 24hr ticker has no bid/ask, so read the book ticker as well
+	var book struct {
+		BidPrice string `json:"bidPrice"`
+		AskPrice string `json:"askPrice"`
+	}
+	if err := f.publicGet(ctx, "/fapi/v1/ticker/bookTicker?symbol="+url.QueryEscape(symbol), &book); err != nil {
+		return nil, err
+	}
+
+	price, err := strconv.ParseFloat(ticker.LastPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid last price '%s': %w", ticker.LastPrice, err)
+	}
+	bid, err := strconv.ParseFloat(book.BidPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bid price '%s': %w", book.BidPrice, err)
+	}
+	ask, err := strconv.ParseFloat(book.AskPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ask price '%s': %w", book.AskPrice, err)
+	}
+	volume, err := strconv.ParseFloat(ticker.Volume, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume '%s': %w", ticker.Volume, err)
+	}
+	high, err := strconv.ParseFloat(ticker.HighPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid high price '%s': %w", ticker.HighPrice, err)
+	}
+	low, err := strconv.ParseFloat(ticker.LowPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid low price '%s': %w", ticker.LowPrice, err)
+	}
+	priceChange, err := strconv.ParseFloat(ticker.PriceChange, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price change '%s': %w", ticker.PriceChange, err)
+	}
+
+	return &MarketData{
+		Symbol:      symbol,
+		Price:       price,
+		Bid:         bid,
+		Ask:         ask,
+		Volume24h:   volume,
+		High24h:     high,
+		Low24h:      low,
+		PriceChange: priceChange,
+		Timestamp:   time.Now(),
+	}, nil
+}
+
+func (f *BinanceFuturesExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	params := url.Values{}
+	params.Set("symbol", order.Symbol)
+	params.Set("side", order.Side)
+	params.Set("type", order.OrderType)
+	params.Set("quantity", fmt.Sprintf("%.8f", order.Quantity))
+	params.Set("newOrderRespType", "RESULT")
+
+	if order.OrderType == "LIMIT" {
+		params.Set("price", fmt.Sprintf("%.8f", order.Price))
+		params.Set("timeInForce", "GTC")
+	}
+	if order.PositionSide != "" {
+		params.Set("positionSide", order.PositionSide)
+	}
+	// reduceOnly cannot be sent in hedge mode (positionSide LONG/SHORT)
+	if order.ReduceOnly && (order.PositionSide == "" || order.PositionSide == "BOTH") {
+		params.Set("reduceOnly", "true")
+	}
+
+	body, err := f.signedRequest(ctx, "POST", "/fapi/v1/order", params)
+	if err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "FAILED",
+		}, fmt.Errorf("binance futures order failed: %w", err)
+	}
+
+	var orderResp struct {
+		OrderID     int64  `json:"orderId"`
+		Status      string `json:"status"`
+		ExecutedQty string `json:"executedQty"`
+		AvgPrice    string `json:"avgPrice"`
+	}
+
+	if err := json.Unmarshal(body, &orderResp); err != nil {
+		return nil, fmt.Errorf("failed to decode order response: %w", err)
+	}
+
+	executedQty, err := strconv.ParseFloat(orderResp.ExecutedQty, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid executed quantity '%s': %w", orderResp.ExecutedQty, err)
+	}
+	avgPrice, err := strconv.ParseFloat(orderResp.AvgPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid average price '%s': %w", orderResp.AvgPrice, err)
+	}
+
+	return &OrderResult{
+		OrderID:          order.ID,
+		ExchangeOrderID:  fmt.Sprintf("%d", orderResp.OrderID),
+		Status:           orderResp.Status,
+		ExecutedPrice:    avgPrice,
+		ExecutedQuantity: executedQty,
+		Timestamp:        time.Now(),
+	}, nil
+}
+
+// KnownSymbols returns the USDT-M contracts currently trading
+func (f *BinanceFuturesExchange) KnownSymbols() (map[string]bool, error) {
+	return f.symbols.get(func() (map[string]bool, error) {
+		return fetchBinanceSymbols(f.client, f.baseURL+"/fapi/v1/exchangeInfo")
+	})
+}
+
+// GetOrderStatus cannot look an order up by ID alone; callers pass the symbol
+// through GetSymbolOrderStatus
+func (f *BinanceFuturesExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	return nil, errOrderSymbolRequired
+}
+
+// GetSymbolOrderStatus queries an order by symbol, which Binance requires
+func (f *BinanceFuturesExchange) GetSymbolOrderStatus(ctx context.Context, symbol, orderID string) (*OrderStatus, error) {
+	if symbol == "" {
+		return nil, errOrderSymbolRequired
+	}
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	body, err := f.signedRequest(ctx, "GET", "/fapi/v1/order", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status: %w", err)
+	}
+
+	var orderResp struct {
+		OrderID     int64  `json:"orderId"`
+		Status      string `json:"status"`
+		ExecutedQty string `json:"executedQty"`
+		AvgPrice    string `json:"avgPrice"`
+	}
+
+	if err := json.Unmarshal(body, &orderResp); err != nil {
+		return nil, fmt.Errorf("failed to decode status response: %w", err)
+	}
+
+	filledQty, err := strconv.ParseFloat(orderResp.ExecutedQty, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filled quantity '%s': %w", orderResp.ExecutedQty, err)
+	}
+	avgPrice, err := strconv.ParseFloat(orderResp.AvgPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid average price '%s': %w", orderResp.AvgPrice, err)
+	}
+
+	return &OrderStatus{
+		OrderID:      fmt.Sprintf("%d", orderResp.OrderID),
+		Status:       orderResp.Status,
+		FilledQty:    filledQty,
+		AveragePrice: avgPrice,
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+func (f *BinanceFuturesExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	body, err := f.signedRequest(ctx, "GET", "/fapi/v2/balance", url.Values{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	var balanceResp []struct {
+		Asset            string `json:"asset"`
+		Balance          string `json:"balance"` // wallet balance
+		CrossUnPnl       string `json:"crossUnPnl"`
+		AvailableBalance string `json:"availableBalance"`
+	}
+
+	if err := json.Unmarshal(body, &balanceResp); err != nil {
+		return nil, fmt.Errorf("failed to decode balance response: %w", err)
+	}
+
+	balances := make(map[string]AssetBalance)
+
+	for _, bal := range balanceResp {
+		total, err := strconv.ParseFloat(bal.Balance, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance for %s: '%s': %w", bal.Asset, bal.Balance, err)
+		}
+		available, err := strconv.ParseFloat(bal.AvailableBalance, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid available balance for %s: '%s': %w", bal.Asset, bal.AvailableBalance, err)
+		}
+		var unrealized float64
+		if bal.CrossUnPnl != "" {
+			if unrealized, err = strconv.ParseFloat(bal.CrossUnPnl, 64); err != nil {
+				return nil, fmt.Errorf("invalid unrealized PnL for %s: '%s': %w", bal.Asset, bal.CrossUnPnl, err)
+			}
+		}
+
+		if total > 0 {
+			// Available includes unrealized PnL, so the margin held by positions and
+			// orders is what the margin balance has beyond it, never below zero
+			balances[bal.Asset] = AssetBalance{
+				Asset:  bal.Asset,
+				Free:   available,
+				Locked: math.Max(0, total+unrealized-available),
+				Total:  total,
+			}
+		}
+	}
+
+	return &Balance{
+		Exchange:  "binance_futures",
+		Balances:  balances,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// Ping checks connectivity via /fapi/v1/ping and validates credentials with a signed balance read
+func (f *BinanceFuturesExchange) Ping(ctx context.Context) error {
+	var pong struct{}
+	if err := f.publicGet(ctx, "/fapi/v1/ping", &pong); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	if _, err := f.signedRequest(ctx, "GET", "/fapi/v2/balance", url.Values{}); err != nil {
+		return fmt.Errorf("credential check failed: %w", err)
+	}
+	return nil
+}
+
+// SetLeverage changes the initial leverage for a symbol
+func (f *BinanceFuturesExchange) SetLeverage(ctx context.Context, symbol string, leverage int) error {
+	if leverage < 1 || leverage > 125 {
+		return fmt.Errorf("leverage must be between 1 and 125, got %d", leverage)
+	}
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("leverage", strconv.Itoa(leverage))
+
+	if _, err := f.signedRequest(ctx, "POST", "/fapi/v1/leverage", params); err != nil {
+		return fmt.Errorf("failed to set leverage: %w", err)
+	}
+	return nil
+}
+
+// CancelOrder cancels an existing futures order
+func (f *BinanceFuturesExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	if _, err := f.signedRequest(ctx, "DELETE", "/fapi/v1/order", params); err != nil {
+		return fmt.Errorf("binance futures cancel failed: %w", err)
+	}
+	return nil
+}
+
+func (f *BinanceFuturesExchange) sign(queryString string) string {
+	return signHMACSHA256(f.apiSecret, queryString)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestFuturesExchange(t *testing.T, handler http.HandlerFunc) *BinanceFuturesExchange {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &BinanceFuturesExchange{apiKey: "key", apiSecret: "secret", baseURL: srv.URL, client: srv.Client(),
+		rateLimiter: NewRateLimiter(1000)}
+}
+
+func TestBinanceFuturesBalanceLockedMargin(t *testing.T) {
+	f := newTestFuturesExchange(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fapi/v2/balance" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"asset":"USDT","balance":"1000","crossUnPnl":"200","availableBalance":"1150"},
+			{"asset":"BUSD","balance":"1000","crossUnPnl":"-300","availableBalance":"600"},
+			{"asset":"BNB","balance":"2","crossUnPnl":"0","availableBalance":"2.5"},
+			{"asset":"USDC","balance":"0","crossUnPnl":"0","availableBalance":"0"}
+		]`))
+	})
+
+	balance, err := f.GetBalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		asset  string
+		free   float64
+		locked float64
+	}{
+		{"USDT", 1150, 50}, // profit counts toward available; wallet minus available alone would be -150
+		{"BUSD", 600, 100},
+		{"BNB", 2.5, 0}, // never negative
+	}
+	for _, tt := range tests {
+		got, ok := balance.Balances[tt.asset]
+		if !ok {
+			t.Errorf("%s missing", tt.asset)
+			continue
+		}
+		if got.Free != tt.free || got.Locked != tt.locked {
+			t.Errorf("%s free %g locked %g, want %g and %g", tt.asset, got.Free, got.Locked, tt.free, tt.locked)
+		}
+	}
+	if _, ok := balance.Balances["USDC"]; ok {
+		t.Error("empty USDC balance listed")
+	}
+}
+
+func TestBinanceFuturesOrderStatusNeedsSymbol(t *testing.T) {
+	var calls atomic.Int32
+	f := newTestFuturesExchange(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Query().Get("symbol") != "BTCUSDT" || r.URL.Query().Get("orderId") != "42" {
+			http.Error(w, `{"code":-1102,"msg":"Mandatory parameter 'symbol' was not sent"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"orderId":42,"status":"FILLED","executedQty":"0.5","avgPrice":"30000"}`))
+	})
+	ctx := context.Background()
+
+	if _, err := f.GetOrderStatus(ctx, "42"); !errors.Is(err, errOrderSymbolRequired) {
+		t.Fatalf("GetOrderStatus err = %v, want errOrderSymbolRequired", err)
+	}
+	if _, err := f.GetSymbolOrderStatus(ctx, "", "42"); !errors.Is(err, errOrderSymbolRequired) {
+		t.Fatalf("GetSymbolOrderStatus without symbol err = %v, want errOrderSymbolRequired", err)
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("lookups without a symbol reached the exchange %d times", calls.Load())
+	}
+
+	status, err := f.GetSymbolOrderStatus(ctx, "BTCUSDT", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "FILLED" || status.FilledQty != 0.5 || status.AveragePrice != 30000 {
+		t.Errorf("status = %+v", status)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BinanceMarginExchange routes orders through the Binance cross margin account.
+// Market data comes from the spot exchange since margin trades the spot books.
+type BinanceMarginExchange struct {
+	spot           *BinanceExchange
+	apiKey         string
+	apiSecret      string
+	baseURL        string
+	client         *http.Client
+	rateLimiter    *RateLimiter
+	minMarginLevel float64 // reject orders that would push the margin level below this
+}
+
+func NewBinanceMarginExchange(spot *BinanceExchange, minMarginLevel float64) *BinanceMarginExchange {
+	return &BinanceMarginExchange{
+		spot:           spot,
+		apiKey:         spot.apiKey,
+		apiSecret:      spot.apiSecret,
+		baseURL:        spot.baseURL,
+		client:         newExchangeHTTPClient("binance_margin", 10*time.Second),
+		rateLimiter:    spot.rateLimiter, // sapi and api share the account's IP weight
+		minMarginLevel: minMarginLevel,
+	}
+}
+
+// marginAccount is the subset of /sapi/v1/margin/account we use
+type marginAccount struct {
+	MarginLevel         string `json:"marginLevel"`
+	TotalAssetOfBtc     string `json:"totalAssetOfBtc"`
+	TotalLiabilityOfBtc string `json:"totalLiabilityOfBtc"`
+	UserAssets          []struct {
+		Asset    string `json:"asset"`
+		Free     string `json:"free"`
+		Locked   string `json:"locked"`
+		Borrowed string `json:"borrowed"`
+		Interest string `json:"interest"`
+	} `json:"userAssets"`
+}
+
+// binanceMarginWeights are the request weights of the margin endpoints we call
+var binanceMarginWeights = map[string]float64{
+	"POST /sapi/v1/margin/order":   6,
+	"GET /sapi/v1/margin/order":    10,
+	"DELETE /sapi/v1/margin/order": 10,
+	"GET /sapi/v1/margin/account":  10,
+}
+
+func (m *BinanceMarginExchange) signedRequest(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	weight, ok := binanceMarginWeights[method+" "+path]
+	if !ok {
+		weight = 1
+	}
+	if err := m.rateLimiter.WaitN(waitCtx, weight); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	params.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
+	params.Set("signature", signHMACSHA256(m.apiSecret, params.Encode()))
+
+	reqURL := fmt.Sprintf("%s%s?%s", m.baseURL, path, params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-MBX-APIKEY", m.apiKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("margin request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("binance margin API error: %s - %s", resp.Status, string(body))
+	}
+
+	return body, nil
+}
+
+func (m *BinanceMarginExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	return m.spot.GetMarketData(ctx, symbol)
+}
+
+func (m *BinanceMarginExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	sideEffect := order.SideEffectType
+	if sideEffect == "" {
+		sideEffect = "NO_SIDE_EFFECT"
+	}
+
+	if err := m.checkMarginLevel(ctx, order, sideEffect); err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "REJECTED",
+		}, err
+	}
+
+	params := url.Values{}
+	params.Set("symbol", order.Symbol)
+	params.Set("side", order.Side)
+	params.Set("type", order.OrderType)
+	params.Set("quantity", fmt.Sprintf("%.8f", order.Quantity))
+	params.Set("sideEffectType", sideEffect)
+	params.Set("newOrderRespType", "FULL")
+
+	if order.OrderType == "LIMIT" {
+		params.Set("price", fmt.Sprintf("%.8f", order.Price))
+		params.Set("timeInForce", "GTC")
+	}
+
+	body, err := m.signedRequest(ctx, "POST", "/sapi/v1/margin/order", params)
+	if err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "FAILED",
+		}, fmt.Errorf("binance margin order failed: %w", err)
+	}
+
+	result, err := parseBinanceOrderResponse(order, body)
+	if err != nil {
+		return nil, err
+	}
+	m.spot.convertFeeAssets(ctx, order.Symbol, result)
+	return result, nil
+}
+
+// checkMarginLevel rejects orders when the current or projected margin level is below the threshold.
+// Borrowing orders are assumed to borrow their full notional, which is the worst case.
+func (m *BinanceMarginExchange) checkMarginLevel(ctx context.Context, order *Order, sideEffect string) error {
+	if m.minMarginLevel <= 0 {
+		return nil
+	}
+
+	account, err := m.getAccount(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check margin level: %w", err)
+	}
+
+	totalAsset, _ := strconv.ParseFloat(account.TotalAssetOfBtc, 64)
+	totalLiability, _ := strconv.ParseFloat(account.TotalLiabilityOfBtc, 64)
+
+	if sideEffect == "MARGIN_BUY" || sideEffect == "AUTO_BORROW_REPAY" {
+		borrowBTC, err := m.notionalInBTC(ctx, order)
+		if err != nil {
+			return fmt.Errorf("failed to estimate order notional: %w", err)
+		}
+		totalAsset += borrowBTC
+		totalLiability += borrowBTC
+	}
+
+	if totalLiability <= 0 {
+		return nil // nothing borrowed, margin level is effectively infinite
+	}
+
+	projected := totalAsset / totalLiability
+	if projected < m.minMarginLevel {
+		return fmt.Errorf("margin level would drop to %.3f, below minimum %.3f", projected, m.minMarginLevel)
+	}
+	return nil
+}
+
+// notionalInBTC estimates the order value in BTC from the symbol's quote asset
+func (m *BinanceMarginExchange) notionalInBTC(ctx context.Context, order *Order) (float64, error) {
+	price := order.Price
+	if price <= 0 {
+		data, err := m.spot.GetMarketData(ctx, order.Symbol)
+		if err != nil {
+			return 0, err
+		}
+		price = data.Price
+	}
+	notional := order.Quantity * price
+
+	if strings.HasSuffix(order.Symbol, "BTC") {
+		return notional, nil
+	}
+
+	for _, quote := range []string{"USDT", "USDC", "FDUSD", "BUSD", "ETH", "BNB"} {
+		if strings.HasSuffix(order.Symbol, quote) {
+			btc, err := m.spot.GetMarketData(ctx, "BTC"+quote)
+			if err != nil {
+				// Some quotes only trade as <quote>BTC
+				alt, altErr := m.spot.GetMarketData(ctx, quote+"BTC")
+				if altErr != nil {
+					return 0, err
+				}
+				return notional * alt.Price, nil
+			}
+			return notional / btc.Price, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported quote asset for %s", order.Symbol)
+}
+
+// KnownSymbols returns the spot symbol list; margin pairs are a subset of it
+func (m *BinanceMarginExchange) KnownSymbols() (map[string]bool, error) {
+	return m.spot.KnownSymbols()
+}
+
+// GetOrderStatus cannot look an order up by ID alone; callers pass the symbol
+// through GetSymbolOrderStatus
+func (m *BinanceMarginExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	return nil, errOrderSymbolRequired
+}
+
+// GetSymbolOrderStatus queries an order by symbol, which Binance requires
+func (m *BinanceMarginExchange) GetSymbolOrderStatus(ctx context.Context, symbol, orderID string) (*OrderStatus, error) {
+	if symbol == "" {
+		return nil, errOrderSymbolRequired
+	}
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	body, err := m.signedRequest(ctx, "GET", "/sapi/v1/margin/order", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status: %w", err)
+	}
+
+	var orderResp struct {
+		OrderID             int64  `json:"orderId"`
+		Status              string `json:"status"`
+		ExecutedQty         string `json:"executedQty"`
+		CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+	}
+
+	if err := json.Unmarshal(body, &orderResp); err != nil {
+		return nil, fmt.Errorf("failed to decode status response: %w", err)
+	}
+
+	filledQty, err := strconv.ParseFloat(orderResp.ExecutedQty, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filled quantity '%s': %w", orderResp.ExecutedQty, err)
+	}
+	quoteQty, err := strconv.ParseFloat(orderResp.CummulativeQuoteQty, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quote quantity '%s': %w", orderResp.CummulativeQuoteQty, err)
+	}
+
+	avgPrice := 0.0
+	if filledQty > 0 {
+		avgPrice = quoteQty / filledQty
+	}
+
+	return &OrderStatus{
+		OrderID:      fmt.Sprintf("%d", orderResp.OrderID),
+		Status:       orderResp.Status,
+		FilledQty:    filledQty,
+		AveragePrice: avgPrice,
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+func (m *BinanceMarginExchange) getAccount(ctx context.Context) (*marginAccount, error) {
+	body, err := m.signedRequest(ctx, "GET", "/sapi/v1/margin/account", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	var account marginAccount
+	if err := json.Unmarshal(body, &account); err != nil {
+		return nil, fmt.Errorf("failed to decode margin account: %w", err)
+	}
+	return &account, nil
+}
+
+// GetBalance returns margin balances including borrowed amounts and the account margin level
+func (m *BinanceMarginExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	account, err := m.getAccount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	balances := make(map[string]AssetBalance)
+
+	for _, bal := range account.UserAssets {
+		free, err := strconv.ParseFloat(bal.Free, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid free balance for %s: '%s': %w", bal.Asset, bal.Free, err)
+		}
+		locked, err := strconv.ParseFloat(bal.Locked, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locked balance for %s: '%s': %w", bal.Asset, bal.Locked, err)
+		}
+		borrowed, err := strconv.ParseFloat(bal.Borrowed, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid borrowed balance for %s: '%s': %w", bal.Asset, bal.Borrowed, err)
+		}
+		interest, err := strconv.ParseFloat(bal.Interest, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interest for %s: '%s': %w", bal.Asset, bal.Interest, err)
+		}
+
+		if free > 0 || locked > 0 || borrowed > 0 {
+			balances[bal.Asset] = AssetBalance{
+				Asset:    bal.Asset,
+				Free:     free,
+				Locked:   locked,
+				Total:    free + locked,
+				Borrowed: borrowed,
+				Interest: interest,
+			}
+		}
+	}
+
+	marginLevel, _ := strconv.ParseFloat(account.MarginLevel, 64)
+
+	return &Balance{
+		Exchange:    "binance_margin",
+		Balances:    balances,
+		MarginLevel: marginLevel,
+		Timestamp:   time.Now(),
+	}, nil
+}
+
+// Ping checks spot connectivity and that the credentials can read the margin account
+func (m *BinanceMarginExchange) Ping(ctx context.Context) error {
+	if err := m.spot.Ping(ctx); err != nil {
+		return err
+	}
+	if _, err := m.getAccount(ctx); err != nil {
+		return fmt.Errorf("credential check failed: %w", err)
+	}
+	return nil
+}
+
+// CancelOrder cancels an open margin order
+func (m *BinanceMarginExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	if _, err := m.signedRequest(ctx, "DELETE", "/sapi/v1/margin/order", params); err != nil {
+		return fmt.Errorf("binance margin cancel failed: %w", err)
+	}
+	return nil
+}
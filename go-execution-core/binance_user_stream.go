@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Account updates from the Binance user data stream: a listen key from
+// POST /api/v3/userDataStream opens <wsURL>/ws/<listenKey>, which pushes
+// executionReport, balanceUpdate and outboundAccountPosition events for the
+// account. The key expires after 60 minutes unless renewed with PUT. One
+// connection per exchange is shared by every balance stream and, while the
+// database is up, the position manager's execution follower; it is closed when
+// the last one leaves.
+
+const (
+	accountUpdateBuffer    = 64 // per-subscriber; a subscriber this far behind is dropped
+	listenKeyRenewInterval = 30 * time.Minute
+	// A trade or transfer explains an account position arriving within this window
+	balanceReasonWindow = 5 * time.Second
+)
+
+// Reasons for a balance change
+const (
+	balanceReasonTrade      = "trade"
+	balanceReasonDeposit    = "deposit"
+	balanceReasonWithdrawal = "withdrawal"
+	balanceReasonUnknown    = "unknown"
+)
+
+// errListenKeyExpired ends a session whose listen key Binance let lapse
+var errListenKeyExpired = errors.New("listen key expired")
+
+// accountUpdate carries the new free and locked amounts of the assets that changed
+type accountUpdate struct {
+	Balances  map[string]AssetBalance
+	Reason    string
+	Timestamp time.Time
+	// Resync follows a reconnect: changes may have been missed, so subscribers
+	// refetch the balance. Balances is empty.
+	Resync bool
+	// ExecutedOrderID is the exchange order ID of a trade execution, which the
+	// position manager books. Balances is empty.
+	ExecutedOrderID string
+}
+
+type accountSubscriber struct {
+	send    chan *accountUpdate
+	dropped bool // set before send is closed for falling behind
+}
+
+// balanceReasons remembers the events that explain the next account position
+type balanceReasons struct {
+	trade     time.Time // last trade execution
+	transfers map[string]balanceTransfer
+}
+
+// balanceTransfer is a deposit or withdrawal seen by balanceUpdate
+type balanceTransfer struct {
+	reason string
+	at     time.Time
+}
+
+// reason picks the cause of a position change covering assets, consuming it
+func (r *balanceReasons) reason(assets map[string]AssetBalance, now time.Time) string {
+	for asset := range assets {
+		if transfer, ok := r.transfers[asset]; ok {
+			delete(r.transfers, asset)
+			if now.Sub(transfer.at) <= balanceReasonWindow {
+				return transfer.reason
+			}
+		}
+	}
+	if !r.trade.IsZero() && now.Sub(r.trade) <= balanceReasonWindow {
+		r.trade = time.Time{}
+		return balanceReasonTrade
+	}
+	return balanceReasonUnknown
+}
+
+// AccountStreamManager owns the user data stream of one Binance account
+type AccountStreamManager struct {
+	exchange    *BinanceExchange
+	wsURL       string
+	subscribers map[*accountSubscriber]struct{}
+	stop        context.CancelFunc // ends the running connection; nil while idle
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex // guards subscribers and stop
+}
+
+func NewAccountStreamManager(exchange *BinanceExchange, wsURL string) *AccountStreamManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AccountStreamManager{
+		exchange:    exchange,
+		wsURL:       wsURL,
+		subscribers: make(map[*accountSubscriber]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// subscribe adds a subscriber, starting the user data stream on first use
+func (m *AccountStreamManager) subscribe() *accountSubscriber {
+	sub := &accountSubscriber{send: make(chan *accountUpdate, accountUpdateBuffer)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers[sub] = struct{}{}
+	if m.stop == nil && m.ctx.Err() == nil {
+		ctx, stop := context.WithCancel(m.ctx)
+		m.stop = stop
+		go m.run(ctx)
+		log.Printf("✓ Account stream started")
+	}
+	return sub
+}
+
+// unsubscribe removes a subscriber, stopping the user data stream when it was the last
+func (m *AccountStreamManager) unsubscribe(sub *accountSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(sub)
+}
+
+// remove does the work of unsubscribe; caller holds m.mu
+func (m *AccountStreamManager) remove(sub *accountSubscriber) {
+	if _, exists := m.subscribers[sub]; !exists {
+		return
+	}
+	delete(m.subscribers, sub)
+	close(sub.send)
+	if len(m.subscribers) == 0 && m.stop != nil {
+		m.stop()
+		m.stop = nil
+	}
+}
+
+// publish queues an update for every subscriber without blocking, dropping
+// those that fell behind
+func (m *AccountStreamManager) publish(update *accountUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sub := range m.subscribers {
+		select {
+		case sub.send <- update:
+		default:
+			sub.dropped = true
+			m.remove(sub)
+		}
+	}
+}
+
+// Close stops the user data stream and ends every subscription
+func (m *AccountStreamManager) Close() {
+	m.cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sub := range m.subscribers {
+		m.remove(sub)
+	}
+}
+
+// run keeps the user data stream open until ctx ends, reconnecting with backoff
+func (m *AccountStreamManager) run(ctx context.Context) {
+	backoff := time.Second
+	for connected := false; ; connected = true {
+		err := m.stream(ctx, connected)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Account stream interrupted: %v (reconnecting in %s)", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// stream runs one session under a fresh listen key. After a reconnect subscribers
+// are told to resync, since changes in between were not seen.
+func (m *AccountStreamManager) stream(ctx context.Context, reconnect bool) error {
+	listenKey, err := m.exchange.listenKey(ctx, http.MethodPost, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		m.exchange.listenKey(closeCtx, http.MethodDelete, listenKey)
+	}()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, m.wsURL+"/ws/"+listenKey, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect account stream: %w", err)
+	}
+	defer conn.Close()
+
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		renew := time.NewTicker(listenKeyRenewInterval)
+		defer renew.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-sessionDone:
+				return
+			case <-renew.C:
+				if _, err := m.exchange.listenKey(ctx, http.MethodPut, listenKey); err != nil {
+					log.Printf("Account stream listen key renewal failed: %v", err)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	if reconnect {
+		m.publish(&accountUpdate{Resync: true, Timestamp: time.Now()})
+	}
+
+	reasons := &balanceReasons{transfers: make(map[string]balanceTransfer)}
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		update, err := reasons.handle(data, time.Now())
+		if errors.Is(err, errListenKeyExpired) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Skipping account stream event: %v", err)
+			continue
+		}
+		if update != nil {
+			m.publish(update)
+		}
+	}
+}
+
+// handle reads one user data stream event, returning an update for account
+// positions or trade executions. Executions also, and balance updates only, record
+// the reason for the next account position.
+func (r *balanceReasons) handle(data []byte, now time.Time) (*accountUpdate, error) {
+	var ev struct {
+		Type      string `json:"e"`
+		EventTime int64  `json:"E"`
+		ExecType  string `json:"x"` // executionReport
+		OrderID   int64  `json:"i"`
+		// Unused, but without them "X" and "I" would fill ExecType and OrderID:
+		// json matches keys case-insensitively
+		OrderStatus string `json:"X"`
+		Ignore      int64  `json:"I"`
+		Asset       string `json:"a"` // balanceUpdate
+		Delta       string `json:"d"`
+		Balances    []struct {
+			Asset  string `json:"a"`
+			Free   string `json:"f"`
+			Locked string `json:"l"`
+		} `json:"B"` // outboundAccountPosition
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+
+	switch ev.Type {
+	case "executionReport":
+		if ev.ExecType == "TRADE" {
+			r.trade = now
+			return &accountUpdate{
+				ExecutedOrderID: strconv.FormatInt(ev.OrderID, 10),
+				Timestamp:       time.UnixMilli(ev.EventTime),
+			}, nil
+		}
+	case "balanceUpdate":
+		delta, err := strconv.ParseFloat(ev.Delta, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance delta for %s: '%s': %w", ev.Asset, ev.Delta, err)
+		}
+		reason := balanceReasonDeposit
+		if delta < 0 {
+			reason = balanceReasonWithdrawal
+		}
+		r.transfers[ev.Asset] = balanceTransfer{reason: reason, at: now}
+	case "outboundAccountPosition":
+		balances := make(map[string]AssetBalance, len(ev.Balances))
+		for _, bal := range ev.Balances {
+			free, err := strconv.ParseFloat(bal.Free, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid free balance for %s: '%s': %w", bal.Asset, bal.Free, err)
+			}
+			locked, err := strconv.ParseFloat(bal.Locked, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid locked balance for %s: '%s': %w", bal.Asset, bal.Locked, err)
+			}
+			balances[bal.Asset] = AssetBalance{Asset: bal.Asset, Free: free, Locked: locked, Total: free + locked}
+		}
+		return &accountUpdate{
+			Balances:  balances,
+			Reason:    r.reason(balances, now),
+			Timestamp: time.UnixMilli(ev.EventTime),
+		}, nil
+	case "listenKeyExpired":
+		return nil, errListenKeyExpired
+	}
+	return nil, nil
+}
+
+// listenKey creates (POST), renews (PUT) or closes (DELETE) a user data stream
+// listen key. Only POST returns one.
+func (b *BinanceExchange) listenKey(ctx context.Context, method, key string) (string, error) {
+	reqURL := b.baseURL + "/api/v3/userDataStream"
+	if key != "" {
+		reqURL += "?" + url.Values{"listenKey": {key}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("listen key %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("binance API error: %s - %s", resp.Status, string(body))
+	}
+
+	var result struct {
+		ListenKey string `json:"listenKey"`
+	}
+	if method == http.MethodPost {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("failed to decode listen key response: %w", err)
+		}
+	}
+	return result.ListenKey, nil
+}
+
+// AccountStream returns the shared user data stream for this account
+func (b *BinanceExchange) AccountStream() *AccountStreamManager {
+	return b.accountStream
+}
+
+// accountStreamer is implemented by exchanges that push account changes
+type accountStreamer interface {
+	AccountStream() *AccountStreamManager
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	pb "execution-engine/pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// Set at build time, e.g.
+// go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+// schemaHash fingerprints execution.proto as compiled into the binary, so a
+// client can tell whether it was generated from the same schema
+var schemaHash = sync.OnceValue(func() string {
+	file := protodesc.ToFileDescriptorProto(pb.File_execution_proto)
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(file)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:12]
+})
+
+// buildInfo describes the running binary. Without -ldflags the commit and build
+// time come from the VCS stamp go build records, when there is one.
+func (s *Server) buildInfo() *pb.BuildInfo {
+	info := &pb.BuildInfo{
+		Version:      version,
+		Commit:       commit,
+		BuildTime:    buildTime,
+		GoVersion:    runtime.Version(),
+		ProtoPackage: string(pb.File_execution_proto.Package()),
+		SchemaHash:   schemaHash(),
+		Environment:  s.config.Environment,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// GetBuildInfo reports the version and proto schema the server runs, for grpcurl
+// users and clients checking compatibility
+func (s *Server) GetBuildInfo(ctx context.Context, req *pb.BuildInfoRequest) (*pb.BuildInfo, error) {
+	return s.buildInfo(), nil
+}
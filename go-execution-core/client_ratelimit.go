@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientRateLimiter keeps a pair of token buckets per client: one for reads and
+// one for order placement, so a runaway order loop cannot starve dashboards and
+// heavy polling cannot block trading. Clients are keyed by API key or token
+// subject, falling back to the remote IP.
+type ClientRateLimiter struct {
+	readRate, readBurst   float64
+	orderRate, orderBurst float64
+	idleTTL               time.Duration
+	clients               map[string]*clientBuckets
+	mu                    sync.Mutex
+}
+
+type clientBuckets struct {
+	read, order *RateLimiter
+	lastSeen    time.Time
+	allowed     map[string]uint64 // by budget
+	limited     map[string]uint64
+}
+
+const (
+	budgetRead  = "read"
+	budgetOrder = "order"
+)
+
+func NewClientRateLimiter(readRate, readBurst, orderRate, orderBurst float64, idleTTL time.Duration) *ClientRateLimiter {
+	return &ClientRateLimiter{
+		readRate:   readRate,
+		readBurst:  readBurst,
+		orderRate:  orderRate,
+		orderBurst: orderBurst,
+		idleTTL:    idleTTL,
+		clients:    make(map[string]*clientBuckets),
+	}
+}
+
+// Allow charges one request against the client's budget
+func (cl *ClientRateLimiter) Allow(client, budget string) (bool, time.Duration) {
+	cl.mu.Lock()
+	buckets, exists := cl.clients[client]
+	if !exists {
+		buckets = &clientBuckets{
+			read:    NewBurstRateLimiter(cl.readRate, cl.readBurst),
+			order:   NewBurstRateLimiter(cl.orderRate, cl.orderBurst),
+			allowed: make(map[string]uint64),
+			limited: make(map[string]uint64),
+		}
+		cl.clients[client] = buckets
+	}
+	buckets.lastSeen = time.Now()
+	cl.mu.Unlock()
+
+	bucket := buckets.read
+	if budget == budgetOrder {
+		bucket = buckets.order
+	}
+	ok, retryAfter := bucket.Allow()
+
+	cl.mu.Lock()
+	if ok {
+		buckets.allowed[budget]++
+	} else {
+		buckets.limited[budget]++
+	}
+	cl.mu.Unlock()
+
+	return ok, retryAfter
+}
+
+// cleanup forgets clients idle for longer than idleTTL
+func (cl *ClientRateLimiter) cleanup() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cutoff := time.Now().Add(-cl.idleTTL)
+	for client, buckets := range cl.clients {
+		if buckets.lastSeen.Before(cutoff) {
+			delete(cl.clients, client)
+		}
+	}
+}
+
+// startCleanup prunes idle clients until the process exits
+func (cl *ClientRateLimiter) startCleanup() {
+	ticker := time.NewTicker(cl.idleTTL / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		cl.cleanup()
+	}
+}
+
+var (
+	clientRequestsDesc = prometheus.NewDesc("signalops_client_requests_total",
+		"Requests per client and budget that were allowed or rate limited.", []string{"client", "budget", "result"}, nil)
+	clientTokensDesc = prometheus.NewDesc("signalops_client_tokens_available",
+		"Tokens left in each client's buckets.", []string{"client", "budget"}, nil)
+)
+
+// collect reports per-client usage for /metrics
+func (cl *ClientRateLimiter) collect(ch chan<- prometheus.Metric) {
+	if cl == nil {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for client, buckets := range cl.clients {
+		for _, budget := range []string{budgetRead, budgetOrder} {
+			ch <- prometheus.MustNewConstMetric(clientRequestsDesc, prometheus.CounterValue,
+				float64(buckets.allowed[budget]), client, budget, "allowed")
+			ch <- prometheus.MustNewConstMetric(clientRequestsDesc, prometheus.CounterValue,
+				float64(buckets.limited[budget]), client, budget, "limited")
+		}
+		ch <- prometheus.MustNewConstMetric(clientTokensDesc, prometheus.GaugeValue,
+			buckets.read.Available(), client, budgetRead)
+		ch <- prometheus.MustNewConstMetric(clientTokensDesc, prometheus.GaugeValue,
+			buckets.order.Available(), client, budgetOrder)
+	}
+}
+
+// requestBudget classifies a request: state-changing order routes use the order
+// budget, everything else the read budget
+func requestBudget(r *http.Request) string {
+	if isStateChanging(r.Method) && strings.HasPrefix(r.URL.Path, "/api/v1/orders") {
+		return budgetOrder
+	}
+	return budgetRead
+}
+
+// rateLimitClient identifies the caller for rate limiting
+func rateLimitClient(r *http.Request) string {
+	if id := callerID(r.Context()); id != "" {
+		return id
+	}
+	return remoteClient(r)
+}
+
+// remoteClient identifies the caller by its IP
+func remoteClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit throttles /api/v1 requests per client. It runs inside requireAuth so
+// the caller's identity is already on the context.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.clientLimiter == nil || !strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, budget := rateLimitClient(r), requestBudget(r)
+		if ok, retryAfter := s.clientLimiter.Allow(client, budget); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+				"error":       fmt.Sprintf("Rate limit exceeded for %s requests", budget),
+				"retry_after": seconds,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"execution-engine/pkg/client"
+)
+
+// sdkClient serves s over the named transport and returns a pkg/client Client
+// for it; the gRPC server runs the same interceptor chain as main
+func sdkClient(t *testing.T, s *Server, transport string) client.Client {
+	t.Helper()
+	var c client.Client
+	switch transport {
+	case "rest":
+		c = client.NewREST(serveTest(t, s).URL, client.WithRetries(0, 0))
+	case "grpc":
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		grpcServer := s.newGRPCServer()
+		go grpcServer.Serve(lis)
+		t.Cleanup(grpcServer.Stop)
+		if c, err = client.NewGRPC(lis.Addr().String(), client.WithRetries(0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// TestClientAgainstHandlers runs the same calls through both transports of
+// pkg/client against the engine's real handlers
+func TestClientAgainstHandlers(t *testing.T) {
+	for _, transport := range []string{"rest", "grpc"} {
+		t.Run(transport, func(t *testing.T) {
+			s, mock := newTestServer(t)
+			mock.FillPrice = 30000
+			c := sdkClient(t, s, transport)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			updates, err := c.StreamOrderUpdates(ctx, client.OrderUpdateFilter{StrategyName: "momentum"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer updates.Close()
+			// The websocket subscribes once connected; give it a moment before publishing
+			waitForSubscribers(t, s, 1)
+
+			order := &client.OrderRequest{
+				OrderID: "ord-1", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 0.5, Exchange: "mock",
+			}
+			result, err := c.SubmitOrder(ctx, order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Success || result.Status != "FILLED" || result.ExecutedPrice != 30000 || result.Replayed {
+				t.Fatalf("result = %+v", result)
+			}
+
+			update, err := updates.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if update.OrderID != "ord-1" || update.StrategyName != "momentum" {
+				t.Errorf("update = %+v", update)
+			}
+
+			// A retry goes out with the same idempotency key and replays the result
+			replay, err := c.SubmitOrder(ctx, order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !replay.Replayed || replay.ExchangeOrderID != result.ExchangeOrderID {
+				t.Errorf("replay = %+v, want the first result", replay)
+			}
+			if got := mock.CallCount("SubmitOrder"); got != 1 {
+				t.Errorf("SubmitOrder reached the exchange %d times", got)
+			}
+
+			invalid, err := c.SubmitOrder(ctx, &client.OrderRequest{
+				OrderID: "ord-2", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: -1, Exchange: "mock",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if invalid.Success || invalid.RejectReason != client.RejectValidation || len(invalid.FieldErrors) == 0 {
+				t.Errorf("invalid order = %+v", invalid)
+			}
+			unknown, err := c.SubmitOrder(ctx, &client.OrderRequest{
+				OrderID: "ord-3", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 1, Exchange: "kraken",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unknown.Success || unknown.RejectReason != client.RejectExchangeNotConfigured {
+				t.Errorf("order on an unconfigured exchange = %+v", unknown)
+			}
+
+			mock.RestLimitOrders = true
+			if _, err := c.SubmitOrder(ctx, &client.OrderRequest{
+				OrderID: "ord-4", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 0.1,
+				Price: 29000, OrderType: "LIMIT", Exchange: "mock",
+			}); err != nil {
+				t.Fatal(err)
+			}
+			s.dbWrites.Wait()
+			if err := c.CancelOrder(ctx, &client.CancelRequest{OrderID: "ord-4"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := mock.CallCount("CancelOrder"); got != 1 {
+				t.Errorf("CancelOrder reached the exchange %d times", got)
+			}
+			if err := c.CancelOrder(ctx, &client.CancelRequest{OrderID: "nope"}); client.StatusCode(err) != 404 {
+				t.Errorf("cancelling an unknown order: err = %v, want 404", err)
+			}
+
+			data, err := c.GetMarketData(ctx, "mock", "BTCUSDT")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.Symbol != "BTCUSDT" || data.Price != 30000 {
+				t.Errorf("market data = %+v", data)
+			}
+			if _, err := c.GetMarketData(ctx, "kraken", "BTCUSDT"); client.StatusCode(err) != 400 {
+				t.Errorf("market data on an unconfigured exchange: err = %v, want 400", err)
+			}
+
+			balance, err := c.GetBalance(ctx, &client.BalanceRequest{Exchange: "mock"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if balance.TotalValueUSD != 40000 || balance.Balances["BTC"].Total != 1 {
+				t.Errorf("balance = %+v", balance)
+			}
+
+			page, err := c.ListOrders(ctx, &client.ListOrdersRequest{StrategyName: "momentum", Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Orders) != 1 || page.Orders[0].OrderID != "ord-4" || page.NextCursor == "" {
+				t.Fatalf("first page = %+v", page)
+			}
+			page, err = c.ListOrders(ctx, &client.ListOrdersRequest{StrategyName: "momentum", Cursor: page.NextCursor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Orders) != 1 || page.Orders[0].OrderID != "ord-1" || page.Orders[0].Status != "FILLED" {
+				t.Errorf("second page = %+v", page)
+			}
+
+			positions, err := c.GetPositions(ctx, &client.PositionsRequest{StrategyName: "momentum"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(positions.Positions) != 1 || positions.Positions[0].Symbol != "BTCUSDT" || positions.Positions[0].Quantity != 0.5 {
+				t.Errorf("positions = %+v", positions)
+			}
+		})
+	}
+}
+
+// waitForSubscribers waits until n order event subscribers are connected
+func waitForSubscribers(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.orderEvents.mu.Lock()
+		subscribers := len(s.orderEvents.subscribers)
+		s.orderEvents.mu.Unlock()
+		if subscribers >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d order event subscribers, want %d", subscribers, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
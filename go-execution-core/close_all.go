@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// allOrdersCanceler is implemented by exchanges that cancel every open order on a
+// symbol in one call; others have their orders cancelled one by one
+type allOrdersCanceler interface {
+	CancelAllOrders(ctx context.Context, symbol string) error
+}
+
+// openOrderGroup is the open orders recorded for one exchange and symbol
+type openOrderGroup struct {
+	Exchange string          `json:"exchange"`
+	Symbol   string          `json:"symbol"`
+	Orders   []strategyOrder `json:"orders"`
+}
+
+// closeAllResult reports one position of a close_all run
+type closeAllResult struct {
+	Symbol       string               `json:"symbol"`
+	Account      string               `json:"account"`
+	StrategyName string               `json:"strategy_name"`
+	Quantity     float64              `json:"quantity"`
+	Side         string               `json:"side"`
+	Notional     float64              `json:"notional,omitempty"` // estimate from current_price in dry runs
+	Fill         *positionCloseResult `json:"fill,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// handleCloseAll flattens the whole book during an incident:
+// POST /api/v1/portfolio/close_all {"reason": "...", "dry_run": true}
+// Open orders are cancelled first, so nothing refills a position while it is being
+// closed, then every open position is closed with a market order, a few at a time.
+// Real runs are recorded as a CRITICAL risk event with the caller and reason,
+// resolved by the run itself when every order and position was dealt with.
+func (s *Server) handleCloseAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		req.DryRun = true
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "reason is required"})
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	groups, err := s.openOrderGroups(ctx)
+	var positions []openPosition
+	if err == nil {
+		var where whereBuilder
+		where.add("quantity != 0")
+		positions, err = s.loadOpenPositions(ctx, where)
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to load open orders and positions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to load open orders and positions",
+		})
+		return
+	}
+
+	if req.DryRun {
+		planned := make([]closeAllResult, len(positions))
+		var notional float64
+		for i, pos := range positions {
+			planned[i] = closeAllPlan(pos)
+			planned[i].Notional = math.Abs(pos.Quantity) * pos.CurrentPrice
+			notional += planned[i].Notional
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dry_run":            true,
+			"reason":             req.Reason,
+			"orders_to_cancel":   groups,
+			"positions_to_close": planned,
+			"estimated_notional": notional,
+		})
+		return
+	}
+
+	caller := callerID(ctx)
+	logEvent(ctx, "Close all triggered", "caller", caller, "reason", req.Reason,
+		"order_groups", len(groups), "positions", len(positions))
+	eventID, err := s.RecordRiskEvent(ctx, "CLOSE_ALL", riskSeverityCritical, req.Reason,
+		map[string]interface{}{"triggered_by": caller, "positions": len(positions)})
+	if err != nil {
+		// The audit row must exist before anything is touched
+		logEvent(ctx, "Failed to record close all", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to record risk event; nothing was closed",
+		})
+		return
+	}
+
+	cancelled, failedCancels := s.cancelOrderGroups(ctx, groups)
+	results := s.closePositionsConcurrently(ctx, positions)
+
+	var closedNotional, totalFees float64
+	failed := make([]closeAllResult, 0)
+	for _, result := range results {
+		if result.Error != "" {
+			failed = append(failed, result)
+		}
+		if result.Fill != nil {
+			closedNotional += result.Fill.ExecutedPrice * result.Fill.ExecutedQuantity
+			totalFees += result.Fill.Fees
+		}
+	}
+	summary := map[string]interface{}{
+		"risk_event_id":    eventID,
+		"reason":           req.Reason,
+		"triggered_by":     caller,
+		"cancelled_orders": cancelled,
+		"failed_cancels":   failedCancels,
+		"positions":        results,
+		"closed_notional":  closedNotional,
+		"total_fees":       totalFees,
+		"failed_positions": failed,
+		"success":          len(failed) == 0 && len(failedCancels) == 0,
+	}
+
+	summaryData, _ := json.Marshal(summary)
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE risk_events
+		SET data = data || $2::jsonb, resolved = $3,
+			resolved_by = CASE WHEN $3 THEN $4 END, resolved_at = CASE WHEN $3 THEN NOW() END
+		WHERE id = $1
+	`, eventID, summaryData, summary["success"], caller)
+	if err != nil {
+		logEvent(ctx, "Failed to record close all result", "risk_event_id", eventID, "error", err)
+	}
+	logEvent(ctx, "Close all finished", "cancelled_orders", cancelled, "failed_cancels", len(failedCancels),
+		"closed", len(results)-len(failed), "failed", len(failed), "notional", closedNotional)
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// closeAllPlan describes the order that would close pos
+func closeAllPlan(pos openPosition) closeAllResult {
+	side := "SELL"
+	if pos.Quantity < 0 {
+		side = "BUY"
+	}
+	return closeAllResult{
+		Symbol:       pos.Symbol,
+		Account:      pos.Account,
+		StrategyName: pos.StrategyName,
+		Quantity:     math.Abs(pos.Quantity),
+		Side:         side,
+	}
+}
+
+// openOrderGroups reads every order not yet final, grouped by exchange and symbol
+func (s *Server) openOrderGroups(ctx context.Context) ([]openOrderGroup, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT order_id, COALESCE(exchange_order_id, ''), strategy_name, symbol, side, COALESCE(exchange, ''), account, status
+		FROM trades
+		WHERE status IN ('NEW', 'PARTIALLY_FILLED', 'PENDING')
+		ORDER BY exchange, account, symbol, timestamp
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]openOrderGroup, 0)
+	for rows.Next() {
+		var o strategyOrder
+		var exchange, account string
+		if err := rows.Scan(&o.OrderID, &o.ExchangeOrderID, &o.StrategyName, &o.Symbol, &o.Side, &exchange, &account, &o.Status); err != nil {
+			return nil, err
+		}
+		if exchange == "" {
+			exchange = "binance"
+		}
+		o.Exchange = exchangeKey(exchange, account)
+		if n := len(groups); n > 0 && groups[n-1].Exchange == o.Exchange && groups[n-1].Symbol == o.Symbol {
+			groups[n-1].Orders = append(groups[n-1].Orders, o)
+			continue
+		}
+		groups = append(groups, openOrderGroup{Exchange: o.Exchange, Symbol: o.Symbol, Orders: []strategyOrder{o}})
+	}
+	return groups, rows.Err()
+}
+
+// cancelOrderGroups cancels each group with one CancelAllOrders call where the
+// exchange has it, otherwise order by order, and marks what was cancelled in trades
+func (s *Server) cancelOrderGroups(ctx context.Context, groups []openOrderGroup) (int, []strategyOrder) {
+	cancelled := 0
+	failed := make([]strategyOrder, 0)
+	for _, group := range groups {
+		s.mu.RLock()
+		exchange, exists := s.exchanges[group.Exchange]
+		s.mu.RUnlock()
+
+		done := group.Orders
+		if bulk, ok := exchange.(allOrdersCanceler); exists && ok {
+			if err := bulk.CancelAllOrders(ctx, group.Symbol); err != nil {
+				logEvent(ctx, "Failed to cancel open orders", "exchange", group.Exchange, "symbol", group.Symbol, "error", err)
+				done = nil
+				for _, o := range group.Orders {
+					o.Error = err.Error()
+					failed = append(failed, o)
+				}
+			} else {
+				s.invalidateBalance(ctx, group.Exchange)
+			}
+		} else {
+			groupFailed := s.cancelStrategyOrders(ctx, group.Orders)
+			failed = append(failed, groupFailed...)
+			done = withoutOrders(group.Orders, groupFailed)
+		}
+
+		for _, o := range done {
+			if _, err := s.db.ExecContext(ctx, `UPDATE trades SET status = 'CANCELED' WHERE order_id = $1`, o.OrderID); err != nil {
+				logEvent(ctx, "Failed to mark order cancelled", "order_id", o.OrderID, "error", err)
+				continue
+			}
+			s.forgetOrderStatus(ctx, o.OrderID)
+		}
+		cancelled += len(done)
+	}
+	return cancelled, failed
+}
+
+// withoutOrders returns the orders not listed in remove
+func withoutOrders(orders, remove []strategyOrder) []strategyOrder {
+	removed := make(map[string]bool, len(remove))
+	for _, o := range remove {
+		removed[o.OrderID] = true
+	}
+	kept := make([]strategyOrder, 0, len(orders))
+	for _, o := range orders {
+		if !removed[o.OrderID] {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// closePositionsConcurrently closes every position with at most BATCH_CONCURRENCY
+// market orders in flight, returning one result per position in input order
+func (s *Server) closePositionsConcurrently(ctx context.Context, positions []openPosition) []closeAllResult {
+	concurrency := s.config.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]closeAllResult, len(positions))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, pos := range positions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pos openPosition) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = closeAllPlan(pos)
+			fill, err := s.closePosition(ctx, pos, "", 100)
+			results[i].Fill = fill
+			if err != nil {
+				logEvent(ctx, "Failed to close position", "symbol", pos.Symbol, "account", pos.Account, "error", err)
+				results[i].Error = fmt.Sprint(err)
+			}
+		}(i, pos)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoinbaseExchange implements Exchange interface for Coinbase Advanced Trade
+type CoinbaseExchange struct {
+	keyName     string // organizations/{org_id}/apiKeys/{key_id}
+	privateKey  *ecdsa.PrivateKey
+	host        string
+	basePath    string
+	client      *http.Client
+	rateLimiter *RateLimiter
+}
+
+// NewCoinbaseExchange creates a Coinbase client from a CDP API key name and its EC private key (PEM)
+func NewCoinbaseExchange(keyName, privateKeyPEM string) (*CoinbaseExchange, error) {
+	// Keys passed through env files often have literal \n sequences
+	privateKeyPEM = strings.ReplaceAll(privateKeyPEM, `\n`, "\n")
+
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid coinbase private key: no PEM block found")
+	}
+
+	var key *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		parsed, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coinbase EC private key: %w", err)
+		}
+		key = parsed
+	default:
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coinbase private key: %w", err)
+		}
+		ecKey, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("coinbase private key must be an ECDSA key")
+		}
+		key = ecKey
+	}
+
+	return &CoinbaseExchange{
+		keyName:     keyName,
+		privateKey:  key,
+		host:        "api.coinbase.com",
+		basePath:    "/api/v3/brokerage",
+		client:      newExchangeHTTPClient("coinbase", 10*time.Second),
+		rateLimiter: newExchangeRateLimiter("coinbase", keyName, 25), // private endpoints allow 30 req/s
+	}, nil
+}
+
+// coinbaseQuoteAssets are checked longest-first when splitting compact symbols
+var coinbaseQuoteAssets = []string{"USDT", "USDC", "EUR", "GBP", "USD", "BTC", "ETH", "DAI"}
+
+// toCoinbaseProductID maps exchange-neutral symbols (BTCUSD) to Coinbase product IDs (BTC-USD)
+func toCoinbaseProductID(symbol string) string {
+	return dashSymbol(symbol, coinbaseQuoteAssets)
+}
+
+// dashSymbol splits a compact symbol on the first matching quote asset (BTCUSDT -> BTC-USDT).
+// Symbols already containing a dash are returned upper-cased as-is.
+func dashSymbol(symbol string, quotes []string) string {
+	symbol = strings.ToUpper(symbol)
+	if strings.Contains(symbol, "-") {
+		return symbol
+	}
+	for _, quote := range quotes {
+		if strings.HasSuffix(symbol, quote) && len(symbol) > len(quote) {
+			return symbol[:len(symbol)-len(quote)] + "-" + quote
+		}
+	}
+	return symbol
+}
+
+// fromCoinbaseProductID maps Coinbase product IDs (BTC-USD) back to compact symbols (BTCUSD)
+func fromCoinbaseProductID(productID string) string {
+	return strings.ReplaceAll(productID, "-", "")
+}
+
+// buildJWT creates the short-lived ES256 token Coinbase requires per request
+func (c *CoinbaseExchange) buildJWT(method, path string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	header := map[string]interface{}{
+		"alg":   "ES256",
+		"typ":   "JWT",
+		"kid":   c.keyName,
+		"nonce": hex.EncodeToString(nonce),
+	}
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"sub": c.keyName,
+		"iss": "cdp",
+		"nbf": now,
+		"exp": now + 120,
+		"uri": fmt.Sprintf("%s %s%s", method, c.host, path),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.privateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	// JWS ES256 signatures are the fixed-width concatenation r || s
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// do performs an authenticated request and decodes the JSON response into out
+func (c *CoinbaseExchange) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := c.rateLimiter.Wait(waitCtx); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	fullPath := c.basePath + path
+	token, err := c.buildJWT(method, fullPath)
+	if err != nil {
+		return err
+	}
+
+	reqURL := "https://" + c.host + fullPath
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("coinbase request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("coinbase API error: %s - %s", resp.Status, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode coinbase response: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseOptionalFloat parses Coinbase numeric strings, treating "" as zero
+func parseOptionalFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (c *CoinbaseExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	productID := toCoinbaseProductID(symbol)
+
+	var product struct {
+		Price                    string `json:"price"`
+		Volume24h                string `json:"volume_24h"`
+		PricePercentageChange24h string `json:"price_percentage_change_24h"`
+	}
+	if err := c.do(ctx, "GET", "/products/"+productID, nil, nil, &product); err != nil {
+		return nil, fmt.Errorf("failed to fetch market data: %w", err)
+	}
+
+	var ticker struct {
+		Trades []struct {
+			Price string `json:"price"`
+		} `json:"trades"`
+		BestBid string `json:"best_bid"`
+		BestAsk string `json:"best_ask"`
+	}
+	if err := c.do(ctx, "GET", "/products/"+productID+"/ticker", url.Values{"limit": {"1"}}, nil, &ticker); err != nil {
+		return nil, fmt.Errorf("failed to fetch ticker: %w", err)
+	}
+
+	price, err := strconv.ParseFloat(product.Price, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price '%s': %w", product.Price, err)
+	}
+	bid, err := parseOptionalFloat(ticker.BestBid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bid price '%s': %w", ticker.BestBid, err)
+	}
+	ask, err := parseOptionalFloat(ticker.BestAsk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ask price '%s': %w", ticker.BestAsk, err)
+	}
+	volume, err := parseOptionalFloat(product.Volume24h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume '%s': %w", product.Volume24h, err)
+	}
+	changePct, err := parseOptionalFloat(product.PricePercentageChange24h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price change '%s': %w", product.PricePercentageChange24h, err)
+	}
+
+	// Coinbase reports the 24h change as a percentage; derive the absolute change
+	priceChange := 0.0
+	if changePct != -100 {
+		priceChange = price - price/(1+changePct/100)
+	}
+
+	return &MarketData{
+		Symbol:      symbol,
+		Price:       price,
+		Bid:         bid,
+		Ask:         ask,
+		Volume24h:   volume,
+		PriceChange: priceChange,
+		Timestamp:   time.Now(),
+	}, nil
+}
+
+func (c *CoinbaseExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	orderConfig := map[string]interface{}{}
+	switch order.OrderType {
+	case "LIMIT":
+		orderConfig["limit_limit_gtc"] = map[string]string{
+			"base_size":   strconv.FormatFloat(order.Quantity, 'f', -1, 64),
+			"limit_price": strconv.FormatFloat(order.Price, 'f', -1, 64),
+		}
+	default:
+		orderConfig["market_market_ioc"] = map[string]string{
+			"base_size": strconv.FormatFloat(order.Quantity, 'f', -1, 64),
+		}
+	}
+
+	clientOrderID := order.ID
+	if clientOrderID == "" {
+		clientOrderID = fmt.Sprintf("signalops-%d", time.Now().UnixNano())
+	}
+
+	body := map[string]interface{}{
+		"client_order_id":     clientOrderID,
+		"product_id":          toCoinbaseProductID(order.Symbol),
+		"side":                order.Side,
+		"order_configuration": orderConfig,
+	}
+
+	var orderResp struct {
+		Success         bool `json:"success"`
+		SuccessResponse struct {
+			OrderID string `json:"order_id"`
+		} `json:"success_response"`
+		ErrorResponse struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		} `json:"error_response"`
+	}
+
+	if err := c.do(ctx, "POST", "/orders", nil, body, &orderResp); err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "FAILED",
+		}, fmt.Errorf("coinbase order failed: %w", err)
+	}
+
+	if !orderResp.Success {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "REJECTED",
+		}, fmt.Errorf("coinbase order rejected: %s - %s", orderResp.ErrorResponse.Error, orderResp.ErrorResponse.Message)
+	}
+
+	result := &OrderResult{
+		OrderID:         order.ID,
+		ExchangeOrderID: orderResp.SuccessResponse.OrderID,
+		Status:          "NEW",
+		Timestamp:       time.Now(),
+	}
+
+	// The create response carries no fills; read them back from the order record
+	if status, err := c.GetOrderStatus(ctx, result.ExchangeOrderID); err == nil {
+		result.Status = status.Status
+		result.ExecutedPrice = status.AveragePrice
+		result.ExecutedQuantity = status.FilledQty
+		result.Fees = status.Fees
+	}
+
+	return result, nil
+}
+
+// coinbaseStatuses maps Coinbase order states to the Binance-style statuses used elsewhere
+var coinbaseStatuses = map[string]string{
+	"PENDING":              "NEW",
+	"OPEN":                 "NEW",
+	"FILLED":               "FILLED",
+	"CANCELLED":            "CANCELED",
+	"EXPIRED":              "EXPIRED",
+	"FAILED":               "REJECTED",
+	"QUEUED":               "NEW",
+	"CANCEL_QUEUED":        "NEW",
+	"UNKNOWN_ORDER_STATUS": "UNKNOWN",
+}
+
+func (c *CoinbaseExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	var orderResp struct {
+		Order struct {
+			OrderID            string `json:"order_id"`
+			Status             string `json:"status"`
+			FilledSize         string `json:"filled_size"`
+			AverageFilledPrice string `json:"average_filled_price"`
+			TotalFees          string `json:"total_fees"`
+		} `json:"order"`
+	}
+
+	if err := c.do(ctx, "GET", "/orders/historical/"+orderID, nil, nil, &orderResp); err != nil {
+		return nil, fmt.Errorf("failed to get order status: %w", err)
+	}
+
+	o := orderResp.Order
+	filledQty, err := parseOptionalFloat(o.FilledSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filled size '%s': %w", o.FilledSize, err)
+	}
+	avgPrice, err := parseOptionalFloat(o.AverageFilledPrice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid average price '%s': %w", o.AverageFilledPrice, err)
+	}
+	fees, err := parseOptionalFloat(o.TotalFees)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fees '%s': %w", o.TotalFees, err)
+	}
+
+	status, ok := coinbaseStatuses[o.Status]
+	if !ok {
+		status = o.Status
+	}
+	if status == "NEW" && filledQty > 0 {
+		status = "PARTIALLY_FILLED"
+	}
+
+	return &OrderStatus{
+		OrderID:      o.OrderID,
+		Status:       status,
+		FilledQty:    filledQty,
+		AveragePrice: avgPrice,
+		Fees:         fees,
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+// Ping validates connectivity and the API key via the key permissions endpoint
+func (c *CoinbaseExchange) Ping(ctx context.Context) error {
+	if err := c.do(ctx, "GET", "/key_permissions", nil, nil, nil); err != nil {
+		return fmt.Errorf("credential check failed: %w", err)
+	}
+	return nil
+}
+
+// CancelOrder cancels an open order; Coinbase identifies orders by ID alone
+func (c *CoinbaseExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	var cancelResp struct {
+		Results []struct {
+			Success       bool   `json:"success"`
+			FailureReason string `json:"failure_reason"`
+			OrderID       string `json:"order_id"`
+		} `json:"results"`
+	}
+
+	body := map[string]interface{}{"order_ids": []string{orderID}}
+	if err := c.do(ctx, "POST", "/orders/batch_cancel", nil, body, &cancelResp); err != nil {
+		return fmt.Errorf("coinbase cancel failed: %w", err)
+	}
+
+	for _, result := range cancelResp.Results {
+		if result.OrderID == orderID && !result.Success {
+			return fmt.Errorf("coinbase cancel failed: %s", result.FailureReason)
+		}
+	}
+	return nil
+}
+
+func (c *CoinbaseExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	balances := make(map[string]AssetBalance)
+
+	query := url.Values{"limit": {"250"}}
+	for {
+		var accountsResp struct {
+			Accounts []struct {
+				Currency         string `json:"currency"`
+				AvailableBalance struct {
+					Value string `json:"value"`
+				} `json:"available_balance"`
+				Hold struct {
+					Value string `json:"value"`
+				} `json:"hold"`
+			} `json:"accounts"`
+			HasNext bool   `json:"has_next"`
+			Cursor  string `json:"cursor"`
+		}
+
+		if err := c.do(ctx, "GET", "/accounts", query, nil, &accountsResp); err != nil {
+			return nil, fmt.Errorf("failed to get balance: %w", err)
+		}
+
+		for _, acct := range accountsResp.Accounts {
+			free, err := parseOptionalFloat(acct.AvailableBalance.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid available balance for %s: '%s': %w", acct.Currency, acct.AvailableBalance.Value, err)
+			}
+			locked, err := parseOptionalFloat(acct.Hold.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hold for %s: '%s': %w", acct.Currency, acct.Hold.Value, err)
+			}
+
+			if free > 0 || locked > 0 {
+				balances[acct.Currency] = AssetBalance{
+					Asset:  acct.Currency,
+					Free:   free,
+					Locked: locked,
+					Total:  free + locked,
+				}
+			}
+		}
+
+		if !accountsResp.HasNext || accountsResp.Cursor == "" {
+			break
+		}
+		query.Set("cursor", accountsResp.Cursor)
+	}
+
+	return &Balance{
+		Exchange:  "coinbase",
+		Balances:  balances,
+		Timestamp: time.Now(),
+	}, nil
+}
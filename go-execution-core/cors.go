@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Headers browsers may send cross-origin, including the ones used for auth
+var corsAllowedHeaders = strings.Join([]string{
+	"Content-Type", "Authorization", apiKeyHeader, timestampHeader, signatureHeader, requestIDHeader,
+	idempotencyHeader,
+}, ", ")
+
+const corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// originAllowed reports whether a browser origin may use the API, including websockets
+func (s *Server) originAllowed(origin string) bool {
+	for _, allowed := range s.config.CORSAllowedOrigins {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// cors answers preflight requests and sets Access-Control-Allow-Origin for origins
+// in CORS_ALLOWED_ORIGINS. It runs outside requireAuth because browsers never send
+// credentials on preflight. "*" is honored only when configured explicitly.
+func (s *Server) cors(next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(s.config.CORSAllowedOrigins))
+	for _, origin := range s.config.CORSAllowedOrigins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	maxAge := strconv.Itoa(int(s.config.CORSMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		originAllowed := allowed[origin] || allowed["*"]
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !originAllowed {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if allowed["*"] && !allowed[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+requestIDHeader+", "+replayedHeader)
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdWriteLock takes the database write lock on a connection of its own, as a
+// slow transaction elsewhere would, until release is called
+func holdWriteLock(t *testing.T, s *Server) (release func()) {
+	t.Helper()
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			tx.Rollback()
+			conn.Close()
+		})
+	}
+	t.Cleanup(release)
+	return release
+}
+
+// createStrategyRequest posts a new strategy to the full handler chain under ctx
+// and reports the status and how long the handler took
+func createStrategyRequest(ctx context.Context, s *Server, name string) (int, time.Duration) {
+	body := `{"name":"` + name + `","config":` + validRuleBased + `}`
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/strategies", strings.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	s.newHTTPServer().Handler.ServeHTTP(w, r)
+	return w.Code, time.Since(start)
+}
+
+func TestHandlerReturnsOnCancelledQuery(t *testing.T) {
+	s, _ := newTestServer(t)
+	holdWriteLock(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	code, took := createStrategyRequest(ctx, s, "cancelled")
+	if took > time.Second {
+		t.Errorf("handler took %v after its request was cancelled", took)
+	}
+	if code < 500 {
+		t.Errorf("status %d, want a failure", code)
+	}
+}
+
+func TestHandlerStatementTimeout(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.config.DBStatementTimeout = 100 * time.Millisecond
+	holdWriteLock(t, s)
+
+	code, took := createStrategyRequest(context.Background(), s, "timed-out")
+	if took > time.Second {
+		t.Errorf("handler took %v with a %v statement timeout", took, s.config.DBStatementTimeout)
+	}
+	if code < 500 {
+		t.Errorf("status %d, want a failure", code)
+	}
+}
+
+// TestHandlerWaitsForLock checks the waiting is still there: a lock released
+// within the busy timeout lets the request through
+func TestHandlerWaitsForLock(t *testing.T) {
+	s, _ := newTestServer(t)
+	release := holdWriteLock(t, s)
+	time.AfterFunc(200*time.Millisecond, release)
+
+	code, took := createStrategyRequest(context.Background(), s, "waited")
+	if code >= 300 {
+		t.Errorf("status %d after the lock was released", code)
+	}
+	if took < 150*time.Millisecond {
+		t.Errorf("handler took %v; it should have waited for the lock", took)
+	}
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM strategies WHERE name = $1`, "waited").Scan(&count); err != nil || count != 1 {
+		t.Errorf("%d strategies saved, err %v", count, err)
+	}
+}
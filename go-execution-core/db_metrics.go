@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// instrumentedPostgresDriver is lib/pq with every round trip timed into
+// signalops_db_query_duration_seconds
+const instrumentedPostgresDriver = "postgres-instrumented"
+
+func init() {
+	sql.Register(instrumentedPostgresDriver, instrumentedDriver{&pq.Driver{}})
+}
+
+func observeDB(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedConn{conn}, nil
+}
+
+// instrumentedConn forwards the optional interfaces database/sql looks for; when
+// the wrapped connection lacks one, driver.ErrSkip sends database/sql down its
+// fallback path as if the method were not there
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeDB("query", time.Now())
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeDB("exec", time.Now())
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	observeDB("begin", start)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedTx{tx}, nil
+}
+
+func (c instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+type instrumentedTx struct {
+	driver.Tx
+}
+
+func (tx instrumentedTx) Commit() error {
+	defer observeDB("commit", time.Now())
+	return tx.Tx.Commit()
+}
+
+func (tx instrumentedTx) Rollback() error {
+	defer observeDB("rollback", time.Now())
+	return tx.Tx.Rollback()
+}
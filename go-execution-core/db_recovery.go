@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Postgres being down at boot does not leave the engine without a database
+// until a restart. Startup tries DB_CONNECT_ATTEMPTS times with doubling
+// backoff; if Postgres is still unreachable the engine starts with a pool that
+// has not connected yet (sql.Open does not dial) and marks the database
+// disconnected. runDatabaseRecovery then pings every DB_RECOVERY_INTERVAL: the
+// first ping that succeeds applies migrations and checks the schema as startup
+// would, and marks the database connected. A connected database whose ping
+// fails is marked disconnected until one succeeds again. The pool itself is
+// kept throughout, since database/sql replaces broken connections on its own,
+// so every component holding it picks the database back up.
+//
+// While disconnected, API reads answer 503 (dbAvailable) and /readyz fails its
+// database check. Order writes still go to Postgres and land in the order
+// journal when it refuses them.
+
+// dbConnectBackoffMax caps the wait between startup attempts
+const dbConnectBackoffMax = 30 * time.Second
+
+var (
+	dbReconnectAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_db_reconnect_attempts_total",
+		Help: "Attempts to connect to Postgres while it was unavailable, at startup and after, by result (success, failure).",
+	}, []string{"result"})
+
+	dbConnectedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signalops_db_connected",
+		Help: "1 while Postgres answers and its schema has been checked, 0 otherwise.",
+	})
+)
+
+// connectDatabase runs initDatabase up to DBConnectAttempts times, waiting
+// DBConnectBackoff before the second and doubling. An outdated schema or a
+// missing DATABASE_URL is not retried.
+func connectDatabase(config *Config) (*sql.DB, error) {
+	attempts := config.DBConnectAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := config.DBConnectBackoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var db *sql.DB
+		db, err = initDatabase(config.DatabaseURL, config.RunMigrations)
+		if err == nil {
+			if attempt > 1 {
+				dbReconnectAttempts.WithLabelValues("success").Inc()
+			}
+			dbConnectedGauge.Set(1)
+			return db, nil
+		}
+		if errors.Is(err, errSchemaOutdated) || config.DatabaseURL == "" {
+			return nil, err
+		}
+		if attempt > 1 {
+			dbReconnectAttempts.WithLabelValues("failure").Inc()
+		}
+		if attempt == attempts {
+			break
+		}
+		log.Printf("Database connection failed (attempt %d/%d), retrying in %s: %v", attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > dbConnectBackoffMax {
+			backoff = dbConnectBackoffMax
+		}
+	}
+	return nil, err
+}
+
+// dbAvailable reports whether the database can serve requests now
+func (s *Server) dbAvailable() bool {
+	return s.db != nil && s.dbConnected.Load()
+}
+
+// runDatabaseRecovery checks the database every DBRecoveryInterval until
+// shutdown, reconnecting it when it is down
+func (s *Server) runDatabaseRecovery() {
+	interval := s.config.DBRecoveryInterval
+	if s.db == nil || interval <= 0 {
+		return
+	}
+	// A pool that never connected has not had its schema checked or its stored
+	// exchanges loaded
+	prepared := s.dbConnected.Load()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		connected := s.dbConnected.Load()
+		ctx, cancel := context.WithTimeout(s.streamCtx, readinessDBTimeout)
+		err := s.db.PingContext(ctx)
+		cancel()
+		if err == nil && !prepared {
+			if err = prepareDatabase(s.db, dialectForURL(s.config.DatabaseURL), s.config.RunMigrations); errors.Is(err, errSchemaOutdated) {
+				log.Printf("ALERT database reachable but not usable: %v", err)
+			}
+		}
+
+		switch {
+		case err != nil && connected:
+			log.Printf("Database connection lost: %v", err)
+			s.setDBConnected(false)
+		case err != nil:
+			dbReconnectAttempts.WithLabelValues("failure").Inc()
+		case !connected:
+			dbReconnectAttempts.WithLabelValues("success").Inc()
+			s.setDBConnected(true)
+			log.Println("✓ Reconnected to PostgreSQL")
+			if !prepared {
+				prepared = true
+				s.loadPersistedExchanges()
+			}
+		}
+	}
+}
+
+func (s *Server) setDBConnected(connected bool) {
+	s.dbConnected.Store(connected)
+	if connected {
+		dbConnectedGauge.Set(1)
+	} else {
+		dbConnectedGauge.Set(0)
+	}
+}
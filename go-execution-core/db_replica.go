@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Analytics reads (portfolio performance, PnL, risk metrics, strategy
+// performance) aggregate over all of trades, and on the primary they hold pool
+// connections that order logging waits for. With DATABASE_REPLICA_URL set they
+// go to a second pool on a Postgres streaming replica instead. Callers do not
+// pick a pool: they tell the Store what a read needs (readIntent) and
+// Store.reader answers with the replica while runReplicaMonitor finds it
+// answering and no more than DB_REPLICA_MAX_LAG behind, and with the primary
+// otherwise. Writes and reads that must see them always use the primary.
+
+// readIntent is what a read needs from the data it gets
+type readIntent int
+
+const (
+	// readCurrent must see every committed write, e.g. a read after a write
+	readCurrent readIntent = iota
+	// readAnalytics may lag the primary by up to DB_REPLICA_MAX_LAG
+	readAnalytics
+)
+
+var (
+	dbReplicaLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signalops_db_replica_lag_seconds",
+		Help: "How far the read replica's replay is behind the primary, as of the last check.",
+	})
+
+	dbReplicaHealthy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signalops_db_replica_healthy",
+		Help: "1 while analytics reads go to the read replica, 0 while they fall back to the primary.",
+	})
+
+	dbReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_db_reads_total",
+		Help: "Reads handed a pool by the store, by intent (current, analytics) and pool (primary, replica).",
+	}, []string{"intent", "pool"})
+)
+
+func (i readIntent) String() string {
+	if i == readAnalytics {
+		return "analytics"
+	}
+	return "current"
+}
+
+// replicaLagQuery is how far the replica's replay is behind. A replica that has
+// replayed all it received is current even when its last replayed transaction
+// is old, because the primary has been idle; a server that is not in recovery is
+// the primary itself.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+	END::float8
+`
+
+// attachReplica sends analytics reads to replica once the monitor has found it
+// healthy
+func (st *Store) attachReplica(replica *sql.DB) {
+	st.replica = replica
+}
+
+// reader is the pool for a read with intent
+func (st *Store) reader(intent readIntent) *sql.DB {
+	if intent == readAnalytics && st.replica != nil && st.replicaHealthy.Load() {
+		dbReads.WithLabelValues(intent.String(), "replica").Inc()
+		return st.replica
+	}
+	dbReads.WithLabelValues(intent.String(), "primary").Inc()
+	return st.db
+}
+
+// openReplica opens the DATABASE_REPLICA_URL pool, or returns nil when there is
+// none or it cannot be used. It does not connect; runReplicaMonitor does.
+func openReplica(config *Config) *sql.DB {
+	switch {
+	case config.DatabaseReplicaURL == "":
+		return nil
+	case dialectForURL(config.DatabaseURL) != dialectPostgres || dialectForURL(config.DatabaseReplicaURL) != dialectPostgres:
+		log.Println("Warning: DATABASE_REPLICA_URL ignored, read replicas need Postgres")
+		return nil
+	}
+	replica, err := newDatabasePool(config.DatabaseReplicaURL)
+	if err != nil {
+		log.Printf("Warning: Read replica unusable, analytics reads use the primary: %v", err)
+		return nil
+	}
+	return replica
+}
+
+// runReplicaMonitor measures the replica's lag every DBReplicaCheckInterval
+// until shutdown, routing analytics reads to it while it answers within
+// DBReplicaMaxLag
+func (s *Server) runReplicaMonitor() {
+	if s.store == nil || s.store.replica == nil {
+		return
+	}
+	interval := s.config.DBReplicaCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		healthy := s.store.replicaHealthy.Load()
+		lag, err := s.replicaLag()
+		switch {
+		case err != nil:
+			if healthy {
+				log.Printf("Read replica unavailable, analytics reads use the primary: %v", err)
+			}
+			healthy = false
+		case lag > s.config.DBReplicaMaxLag:
+			if healthy {
+				log.Printf("Read replica %s behind (limit %s), analytics reads use the primary",
+					lag.Round(time.Millisecond), s.config.DBReplicaMaxLag)
+			}
+			healthy = false
+		case !healthy:
+			log.Printf("✓ Read replica serving analytics reads (%s behind)", lag.Round(time.Millisecond))
+			healthy = true
+		}
+		s.store.replicaHealthy.Store(healthy)
+		if healthy {
+			dbReplicaHealthy.Set(1)
+		} else {
+			dbReplicaHealthy.Set(0)
+		}
+
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicaLag measures how far the replica is behind and records it
+func (s *Server) replicaLag() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(s.streamCtx, readinessDBTimeout)
+	defer cancel()
+	var seconds float64
+	if err := s.store.replica.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	dbReplicaLag.Set(seconds)
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// Sources of event stream entries
+const (
+	streamSourceLive   = "live"
+	streamSourceReplay = "replay" // re-emitted from trades by POST /api/v1/events/replay
+)
+
+const (
+	// maxReplayOrders bounds one replay request; longer ranges are replayed in parts
+	maxReplayOrders = 50000
+	// replayBatchSize is how many entries one pipelined round trip appends
+	replayBatchSize = 500
+)
+
+var eventStreamEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_event_stream_entries_total",
+	Help: "Entries appended to the Redis event stream by source (live, replay) and result (added, failed).",
+}, []string{"source", "result"})
+
+// eventStream is the Redis Stream ORDER_EVENTS_STREAM. Every order event and fill
+// is appended as an entry of flat fields (type, order_id, schema_version, source)
+// with the event JSON in data, trimmed to about ORDER_EVENTS_STREAM_MAXLEN entries.
+// The engine creates the stream with the consumer group ORDER_EVENTS_STREAM_GROUP
+// reading from its start; services may add groups of their own. Entries stay
+// pending in a group until a consumer acks them, so a consumer that was offline
+// resumes where it left off as long as the entries were not trimmed.
+type eventStream struct {
+	client     *redis.Client
+	name       string
+	maxLen     int64
+	group      string
+	groupReady atomic.Bool
+}
+
+// ensureGroup creates the stream and the default group unless that already
+// succeeded; retried on each append while Redis is unreachable
+func (es *eventStream) ensureGroup(ctx context.Context) {
+	if es.groupReady.Load() {
+		return
+	}
+	createCtx, cancel := context.WithTimeout(ctx, orderEventPublishTimeout)
+	defer cancel()
+	err := es.client.XGroupCreateMkStream(createCtx, es.name, es.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		logEvent(ctx, "Failed to create event stream group", "stream", es.name, "group", es.group, "error", err)
+		return
+	}
+	es.groupReady.Store(true)
+}
+
+// entry builds the XADD arguments of an event
+func (es *eventStream) entry(ev relayedEvent, source string) (*redis.XAddArgs, error) {
+	var eventType, orderID string
+	var payload interface{}
+	if ev.order != nil {
+		eventType, orderID = ev.order.Type, ev.order.OrderID
+		payload = orderEventMessage{SchemaVersion: orderEventSchemaVersion, OrderEvent: *ev.order}
+	} else {
+		eventType, orderID = fillEventName, ev.fill.OrderID
+		payload = fillEventMessage{SchemaVersion: orderEventSchemaVersion, Fill: *ev.fill}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.XAddArgs{
+		Stream: es.name,
+		MaxLen: es.maxLen,
+		Approx: true,
+		Values: []interface{}{
+			"type", eventType,
+			"order_id", orderID,
+			"schema_version", orderEventSchemaVersion,
+			"source", source,
+			"data", data,
+		},
+	}, nil
+}
+
+// append adds one event, counting and logging a failure
+func (es *eventStream) append(ctx context.Context, ev relayedEvent, source string) {
+	es.ensureGroup(ctx)
+	args, err := es.entry(ev, source)
+	if err == nil {
+		addCtx, cancel := context.WithTimeout(ctx, orderEventPublishTimeout)
+		err = es.client.XAdd(addCtx, args).Err()
+		cancel()
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to append to event stream", "stream", es.name, "error", err)
+		eventStreamEntries.WithLabelValues(source, "failed").Inc()
+		return
+	}
+	eventStreamEntries.WithLabelValues(source, "added").Inc()
+}
+
+// appendBatch adds events in one pipelined round trip and returns how many were
+// added and the ID of the last
+func (es *eventStream) appendBatch(ctx context.Context, events []relayedEvent, source string) (int, string, error) {
+	es.ensureGroup(ctx)
+	pipe := es.client.Pipeline()
+	cmds := make([]*redis.StringCmd, 0, len(events))
+	for _, ev := range events {
+		args, err := es.entry(ev, source)
+		if err != nil {
+			return 0, "", err
+		}
+		cmds = append(cmds, pipe.XAdd(ctx, args))
+	}
+	_, err := pipe.Exec(ctx)
+	added, lastID := 0, ""
+	for _, cmd := range cmds {
+		if cmd.Err() == nil {
+			added++
+			lastID = cmd.Val()
+		}
+	}
+	eventStreamEntries.WithLabelValues(source, "added").Add(float64(added))
+	eventStreamEntries.WithLabelValues(source, "failed").Add(float64(len(cmds) - added))
+	return added, lastID, err
+}
+
+func (s *Server) registerEventStreamEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/events/replay", s.handleReplayEvents)
+}
+
+// handleReplayEvents re-emits recorded orders executed in [from, to) into the
+// event stream: POST /api/v1/events/replay {from, to, strategy_name, symbol}.
+// Each order becomes an order event with its current status and cumulative fill
+// and, when it traded, one fill of its whole executed quantity, both with source
+// replay. Live fills of the same order may have been partial, so consumers should
+// treat replayed entries as the order's final state rather than add them up.
+func (s *Server) handleReplayEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.eventStream == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Event stream not configured (ORDER_EVENTS_STREAM)",
+		})
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		From         string `json:"from"`
+		To           string `json:"to"`
+		StrategyName string `json:"strategy_name"`
+		Symbol       string `json:"symbol"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var errs []FieldError
+	from, err := time.Parse(time.RFC3339, req.From)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "from", Message: "must be an RFC3339 timestamp"})
+	}
+	to := time.Now().UTC()
+	if req.To != "" {
+		if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+			errs = append(errs, FieldError{Field: "to", Message: "must be an RFC3339 timestamp"})
+		}
+	}
+	if len(errs) == 0 && !to.After(from) {
+		errs = append(errs, FieldError{Field: "to", Message: "must be after from"})
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "Invalid replay request",
+			"errors": errs,
+		})
+		return
+	}
+
+	var where whereBuilder
+	where.add("executed_at >= ?", from)
+	where.add("executed_at < ?", to)
+	if req.StrategyName != "" {
+		where.add("strategy_name = ?", req.StrategyName)
+	}
+	if req.Symbol != "" {
+		where.add("symbol = ?", strings.ToUpper(req.Symbol))
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	rows, err := s.store.reader(readAnalytics).QueryContext(ctx, `
+		SELECT order_id, COALESCE(exchange_order_id, ''), strategy_name, symbol, side,
+		       COALESCE(exchange, 'binance'), account, status, quantity,
+		       COALESCE(filled_quantity, 0), COALESCE(executed_price, price), COALESCE(fees, 0), executed_at
+		FROM trades `+where.sql()+`
+		ORDER BY executed_at, order_id
+		LIMIT `+fmt.Sprint(maxReplayOrders+1), where.args...)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query orders to replay", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to fetch orders"})
+		return
+	}
+	var events []relayedEvent
+	orders := 0
+	for rows.Next() {
+		var ev OrderEvent
+		var exchange, account string
+		if err := rows.Scan(&ev.OrderID, &ev.ExchangeOrderID, &ev.StrategyName, &ev.Symbol, &ev.Side,
+			&exchange, &account, &ev.Status, &ev.Quantity, &ev.FilledQuantity, &ev.Price, &ev.Fees,
+			&ev.Timestamp); err != nil {
+			rows.Close()
+			logEvent(r.Context(), "Failed to read order to replay", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to fetch orders"})
+			return
+		}
+		orders++
+		ev.Type = orderEventType(ev.Status)
+		ev.Exchange = exchangeKey(exchange, account)
+		events = append(events, relayedEvent{order: &ev})
+		if ev.FilledQuantity > 0 {
+			events = append(events, relayedEvent{fill: &Fill{
+				OrderID:      ev.OrderID,
+				StrategyName: ev.StrategyName,
+				Symbol:       ev.Symbol,
+				Side:         ev.Side,
+				Exchange:     ev.Exchange,
+				Price:        ev.Price,
+				Quantity:     ev.FilledQuantity,
+				Fees:         ev.Fees,
+				Timestamp:    ev.Timestamp,
+			}})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logEvent(r.Context(), "Failed to read orders to replay", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to fetch orders"})
+		return
+	}
+	if orders > maxReplayOrders {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": "Invalid replay request",
+			"errors": []FieldError{{Field: "to",
+				Message: fmt.Sprintf("range holds more than %d orders; replay it in parts", maxReplayOrders)}},
+		})
+		return
+	}
+
+	added, lastID := 0, ""
+	for start := 0; start < len(events); start += replayBatchSize {
+		end := start + replayBatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		n, id, err := s.eventStream.appendBatch(r.Context(), events[start:end], streamSourceReplay)
+		added += n
+		if id != "" {
+			lastID = id
+		}
+		if err != nil {
+			logEvent(r.Context(), "Event replay failed", "stream", s.eventStream.name, "added", added, "error", err)
+			writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+				"error":   "Failed to append to the event stream",
+				"entries": added,
+				"last_id": lastID,
+			})
+			return
+		}
+	}
+	logEvent(r.Context(), "Events replayed", "stream", s.eventStream.name, "from", from, "to", to,
+		"orders", orders, "entries", added, "by", callerID(r.Context()))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"stream":  s.eventStream.name,
+		"from":    from.UTC().Format(time.RFC3339),
+		"to":      to.UTC().Format(time.RFC3339),
+		"orders":  orders,
+		"entries": added,
+		"last_id": lastID,
+	})
+}
@@ -0,0 +1,82 @@
+// Command order_events prints the order events the execution engine publishes to
+// Redis when ORDER_EVENTS_REDIS_ENABLED=true:
+//
+//	go run ./examples/order_events -redis localhost:6379 -channels 'orders:*'
+//
+// Delivery is best-effort: events published while no subscriber is connected, or
+// dropped by the engine, are gone. Services that must see every fill should read
+// the event stream (ORDER_EVENTS_STREAM) with client.EventConsumer instead.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// schemaVersion is the event schema this consumer understands
+const schemaVersion = 1
+
+// orderEvent is schema version 1 of an order event
+type orderEvent struct {
+	SchemaVersion   int     `json:"schema_version"`
+	Type            string  `json:"type"` // submitted, filled, partially_filled, cancelled, rejected, unknown
+	OrderID         string  `json:"order_id"`
+	ExchangeOrderID string  `json:"exchange_order_id"`
+	StrategyName    string  `json:"strategy_name"`
+	Symbol          string  `json:"symbol"`
+	Side            string  `json:"side"`
+	Exchange        string  `json:"exchange"`
+	Status          string  `json:"status"`
+	Quantity        float64 `json:"quantity"`
+	FilledQuantity  float64 `json:"filled_quantity"`
+	Price           float64 `json:"price"`
+	Fees            float64 `json:"fees"`
+	Error           string  `json:"error"`
+	Timestamp       string  `json:"timestamp"`
+}
+
+func main() {
+	addr := flag.String("redis", "localhost:6379", "Redis address")
+	channels := flag.String("channels", "orders:*", "comma-separated channels or patterns")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := redis.NewClient(&redis.Options{Addr: *addr})
+	defer client.Close()
+	sub := client.PSubscribe(ctx, strings.Split(*channels, ",")...)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Fatalf("Subscribe failed: %v", err)
+	}
+
+	messages := sub.Channel()
+	for {
+		var msg *redis.Message
+		select {
+		case <-ctx.Done():
+			return
+		case msg = <-messages:
+		}
+		var ev orderEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			log.Printf("%s: undecodable event: %v", msg.Channel, err)
+			continue
+		}
+		if ev.SchemaVersion != schemaVersion {
+			log.Printf("%s: skipping schema version %d", msg.Channel, ev.SchemaVersion)
+			continue
+		}
+		log.Printf("%s %s %s %s %s filled %g/%g at %g (fees %g) on %s",
+			ev.Type, ev.OrderID, ev.StrategyName, ev.Side, ev.Symbol,
+			ev.FilledQuantity, ev.Quantity, ev.Price, ev.Fees, ev.Exchange)
+	}
+}
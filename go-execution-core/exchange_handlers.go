@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtime exchange registration REST API handlers
+
+func (s *Server) registerExchangeEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/exchanges", s.handleExchanges)
+	mux.HandleFunc("/api/v1/exchanges/", s.handleExchangeByName)
+}
+
+// exchangeSpec describes an exchange adapter to construct at runtime
+type exchangeSpec struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	APIKey     string `json:"api_key"`
+	APISecret  string `json:"api_secret"`
+	Passphrase string `json:"passphrase"` // KuCoin only
+	Testnet    bool   `json:"testnet"`
+	Persist    bool   `json:"persist"`
+}
+
+// exchangeConnectivityTimeout bounds the connectivity check done when listing exchanges
+const exchangeConnectivityTimeout = 5 * time.Second
+
+// newExchangeFromSpec constructs the adapter for spec.Type
+func (s *Server) newExchangeFromSpec(spec exchangeSpec) (Exchange, error) {
+	if spec.Testnet && spec.Type != "binance" && spec.Type != "binance_futures" {
+		return nil, fmt.Errorf("testnet is not supported for exchange type %s", spec.Type)
+	}
+
+	switch spec.Type {
+	case "binance":
+		b := NewBinanceExchange(spec.APIKey, spec.APISecret)
+		if spec.Testnet {
+			b.UseTestnet()
+		}
+		return b, nil
+	case "binance_futures":
+		f := NewBinanceFuturesExchange(spec.APIKey, spec.APISecret)
+		if spec.Testnet {
+			f.UseTestnet()
+		}
+		return f, nil
+	case "binance_margin":
+		return NewBinanceMarginExchange(NewBinanceExchange(spec.APIKey, spec.APISecret), s.config.MarginMinLevel), nil
+	case "coinbase":
+		return NewCoinbaseExchange(spec.APIKey, spec.APISecret)
+	case "kucoin":
+		return NewKucoinExchange(spec.APIKey, spec.APISecret, spec.Passphrase), nil
+	default:
+		return nil, fmt.Errorf("unsupported exchange type %q", spec.Type)
+	}
+}
+
+// exchangeTypeOf reports the adapter type of a registered exchange
+func exchangeTypeOf(exchange Exchange) string {
+	switch exchange.(type) {
+	case *BinanceExchange:
+		return "binance"
+	case *BinanceFuturesExchange:
+		return "binance_futures"
+	case *BinanceMarginExchange:
+		return "binance_margin"
+	case *CoinbaseExchange:
+		return "coinbase"
+	case *KucoinExchange:
+		return "kucoin"
+	case *PaperExchange:
+		return "paper"
+	default:
+		return "unknown"
+	}
+}
+
+// handleExchanges handles GET (list) and POST (register)
+func (s *Server) handleExchanges(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listExchanges(w, r)
+	case http.MethodPost:
+		s.registerExchange(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleExchangeByName handles DELETE /api/v1/exchanges/{name}
+func (s *Server) handleExchangeByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/exchanges/")
+	if name == "" {
+		http.Error(w, "Exchange name required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.removeExchange(w, r, name)
+}
+
+// listExchanges returns configured exchanges with a connectivity check, never credentials
+func (s *Server) listExchanges(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	snapshot := make(map[string]Exchange, len(s.exchanges))
+	for name, exchange := range s.exchanges {
+		snapshot[name] = exchange
+	}
+	s.mu.RUnlock()
+
+	type checkResult struct {
+		name    string
+		latency time.Duration
+		err     error
+	}
+
+	results := make(chan checkResult, len(snapshot))
+	var wg sync.WaitGroup
+	for name, exchange := range snapshot {
+		wg.Add(1)
+		go func(name string, exchange Exchange) {
+			defer wg.Done()
+
+			// GetBalance is signed, so it validates credentials as well as reachability
+			ctx, cancel := context.WithTimeout(r.Context(), exchangeConnectivityTimeout)
+			defer cancel()
+			start := time.Now()
+			_, err := exchange.GetBalance(ctx)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("connectivity check timed out")
+			}
+			results <- checkResult{name: name, latency: time.Since(start), err: err}
+		}(name, exchange)
+	}
+	wg.Wait()
+	close(results)
+
+	exchanges := make([]map[string]interface{}, 0, len(snapshot))
+	for result := range results {
+		entry := map[string]interface{}{
+			"name":       result.name,
+			"type":       exchangeTypeOf(snapshot[result.name]),
+			"connected":  result.err == nil,
+			"latency_ms": result.latency.Milliseconds(),
+		}
+		if result.err != nil {
+			entry["error"] = result.err.Error()
+		}
+		exchanges = append(exchanges, entry)
+	}
+	sort.Slice(exchanges, func(i, j int) bool {
+		return exchanges[i]["name"].(string) < exchanges[j]["name"].(string)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exchanges": exchanges,
+		"count":     len(exchanges),
+	})
+}
+
+// registerExchange constructs an adapter and adds it to Server.exchanges
+func (s *Server) registerExchange(w http.ResponseWriter, r *http.Request) {
+	var spec exchangeSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if spec.Name == "" || spec.Type == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "name and type are required",
+		})
+		return
+	}
+	if spec.APIKey == "" || spec.APISecret == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "api_key and api_secret are required",
+		})
+		return
+	}
+	if strings.Contains(spec.Name, "/") {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "name must not contain '/'",
+		})
+		return
+	}
+
+	exchange, err := s.newExchangeFromSpec(spec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if spec.Persist {
+		if err := s.persistExchange(r.Context(), spec); err != nil {
+			logEvent(r.Context(), "Failed to persist exchange", "exchange", spec.Name, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": fmt.Sprintf("Failed to persist credentials: %v", err),
+			})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	previous, replaced := s.exchanges[spec.Name]
+	s.exchanges[spec.Name] = exchange
+	s.mu.Unlock()
+
+	// Key rotation replaces the adapter in place; stop streams owned by the old one
+	if closer, ok := previous.(interface{ Close() }); replaced && ok {
+		closer.Close()
+	}
+
+	logEvent(r.Context(), "Exchange registered at runtime", "exchange", spec.Name, "type", spec.Type)
+
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"success":   true,
+		"name":      spec.Name,
+		"type":      spec.Type,
+		"testnet":   spec.Testnet,
+		"persisted": spec.Persist,
+		"replaced":  replaced,
+	})
+}
+
+// removeExchange unregisters an exchange once it has no open orders
+func (s *Server) removeExchange(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.RLock()
+	exchange, exists := s.exchanges[name]
+	s.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Exchange %s not configured", name),
+		})
+		return
+	}
+
+	if s.db != nil {
+		baseExchange, account := splitExchangeKey(name)
+
+		ctx, cancel := s.dbContext(r.Context())
+		defer cancel()
+
+		var openOrders int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM trades
+			WHERE exchange = $1 AND COALESCE(account, '') = $2
+			  AND status IN ('NEW', 'PARTIALLY_FILLED', 'PENDING')
+		`, baseExchange, account).Scan(&openOrders)
+		if err != nil {
+			logEvent(r.Context(), "Failed to check open orders", "exchange", name, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to check open orders",
+			})
+			return
+		}
+		if openOrders > 0 {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":       fmt.Sprintf("Exchange %s has %d open orders", name, openOrders),
+				"open_orders": openOrders,
+			})
+			return
+		}
+
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE key_name = $1`, name); err != nil {
+			logEvent(r.Context(), "Failed to delete persisted credentials", "exchange", name, "error", err)
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.exchanges, name)
+	s.mu.Unlock()
+
+	if closer, ok := exchange.(interface{ Close() }); ok {
+		closer.Close()
+	}
+
+	logEvent(r.Context(), "Exchange removed", "exchange", name)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Exchange %s removed", name),
+	})
+}
+
+// credentialsCipher builds the AES-GCM cipher from EXCHANGE_CREDENTIALS_KEY (32 bytes, hex or base64)
+func (s *Server) credentialsCipher() (cipher.AEAD, error) {
+	raw := s.config.CredentialsKey
+	if raw == "" {
+		return nil, fmt.Errorf("EXCHANGE_CREDENTIALS_KEY not set")
+	}
+
+	key, err := hex.DecodeString(raw)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("EXCHANGE_CREDENTIALS_KEY must be hex or base64")
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("EXCHANGE_CREDENTIALS_KEY must decode to 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptCredential(aead cipher.AEAD, plaintext string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptCredential(aead cipher.AEAD, encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// persistExchange stores encrypted credentials in api_keys so the exchange survives restarts
+func (s *Server) persistExchange(ctx context.Context, spec exchangeSpec) error {
+	if s.db == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	aead, err := s.credentialsCipher()
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, err := encryptCredential(aead, spec.APIKey)
+	if err != nil {
+		return err
+	}
+	encryptedSecret, err := encryptCredential(aead, spec.APISecret)
+	if err != nil {
+		return err
+	}
+	encryptedPassphrase := ""
+	if spec.Passphrase != "" {
+		if encryptedPassphrase, err = encryptCredential(aead, spec.Passphrase); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+
+	// A name maps to one adapter, so drop any row for it under a different type
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE key_name = $1 AND exchange <> $2`, spec.Name, spec.Type); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO api_keys (exchange, key_name, encrypted_key, encrypted_secret, encrypted_passphrase, testnet, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, true)
+		ON CONFLICT (exchange, key_name) DO UPDATE SET
+			encrypted_key = EXCLUDED.encrypted_key,
+			encrypted_secret = EXCLUDED.encrypted_secret,
+			encrypted_passphrase = EXCLUDED.encrypted_passphrase,
+			testnet = EXCLUDED.testnet,
+			is_active = true
+	`, spec.Type, spec.Name, encryptedKey, encryptedSecret, encryptedPassphrase, spec.Testnet)
+	return err
+}
+
+// loadPersistedExchanges registers exchanges stored by the runtime API.
+// Exchanges already configured from the environment take precedence.
+func (s *Server) loadPersistedExchanges() {
+	if !s.dbAvailable() || s.config.CredentialsKey == "" {
+		return
+	}
+
+	aead, err := s.credentialsCipher()
+	if err != nil {
+		log.Printf("Warning: cannot load persisted exchanges: %v", err)
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT exchange, key_name, encrypted_key, encrypted_secret, COALESCE(encrypted_passphrase, ''), testnet
+		FROM api_keys
+		WHERE is_active = true
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to query persisted exchanges: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var spec exchangeSpec
+		var encryptedKey, encryptedSecret, encryptedPassphrase string
+		if err := rows.Scan(&spec.Type, &spec.Name, &encryptedKey, &encryptedSecret, &encryptedPassphrase, &spec.Testnet); err != nil {
+			log.Printf("Warning: failed to scan persisted exchange: %v", err)
+			continue
+		}
+
+		if spec.APIKey, err = decryptCredential(aead, encryptedKey); err != nil {
+			log.Printf("Warning: failed to decrypt credentials for %s: %v", spec.Name, err)
+			continue
+		}
+		if spec.APISecret, err = decryptCredential(aead, encryptedSecret); err != nil {
+			log.Printf("Warning: failed to decrypt credentials for %s: %v", spec.Name, err)
+			continue
+		}
+		if encryptedPassphrase != "" {
+			if spec.Passphrase, err = decryptCredential(aead, encryptedPassphrase); err != nil {
+				log.Printf("Warning: failed to decrypt credentials for %s: %v", spec.Name, err)
+				continue
+			}
+		}
+
+		exchange, err := s.newExchangeFromSpec(spec)
+		if err != nil {
+			log.Printf("Warning: failed to construct persisted exchange %s: %v", spec.Name, err)
+			continue
+		}
+
+		s.mu.Lock()
+		if _, exists := s.exchanges[spec.Name]; exists {
+			s.mu.Unlock()
+			log.Printf("Skipping persisted exchange %s: already configured from environment", spec.Name)
+			continue
+		}
+		s.exchanges[spec.Name] = exchange
+		s.mu.Unlock()
+
+		log.Printf("✓ Exchange %s (%s) restored from database", spec.Name, spec.Type)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Warning: failed to read persisted exchanges: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiters an exchange call's weight was taken from
+const (
+	rateLimiterLocal       = "local"
+	rateLimiterDistributed = "distributed"
+	rateLimiterFallback    = "fallback" // local bucket while Redis is unavailable in distributed mode
+)
+
+// sharedBucketPrefix namespaces the Redis token buckets, keyed by exchange and API key hash
+const sharedBucketPrefix = "ratelimit:"
+
+// sharedBucketTimeout bounds one script call; slower Redis falls back to the local bucket
+const sharedBucketTimeout = 250 * time.Millisecond
+
+var (
+	exchangeRateLimitWeight = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_exchange_rate_limit_weight_total",
+		Help: "Request weight this instance took for exchange calls by exchange, API key and limiter (local, distributed, fallback).",
+	}, []string{"exchange", "key", "limiter"})
+	exchangeRateLimitAvailable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signalops_exchange_rate_limit_available",
+		Help: "Weight left in an exchange rate limit bucket after this instance's last call; shared by all instances in distributed mode, negative while calls queue.",
+	}, []string{"exchange", "key"})
+)
+
+// sharedBucketScript is a token bucket in one Redis hash. It refills from the Redis
+// clock so instances need not agree on time, reserves the weight even when that
+// leaves the bucket negative (callers then sleep wait_ms, queueing behind earlier
+// reservations like the local limiter), and hands weight back when given a
+// negative one. Returns {wait_ms, tokens left}; tokens as a string since Lua
+// numbers come back truncated to integers.
+var sharedBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local weight = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, math.min(burst, tokens + math.max(0, now - ts) * rate) - weight)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+local wait = 0
+if tokens < 0 then
+	wait = math.ceil(-tokens / rate * 1000)
+end
+return {wait, tostring(tokens)}
+`)
+
+// distributedRateLimits is the Redis client exchange limiters share buckets
+// through, set at startup with EXCHANGE_RATE_LIMIT_MODE=distributed; nil keeps
+// every limiter local
+var distributedRateLimits *redis.Client
+
+// newExchangeRateLimiter is the limiter of one exchange API key, allowing
+// weightPerSecond with a burst of one second's weight. In distributed mode the
+// bucket is shared in Redis by every instance using the key.
+func newExchangeRateLimiter(exchange, apiKey string, weightPerSecond float64) *RateLimiter {
+	rl := NewRateLimiter(weightPerSecond)
+	rl.exchange, rl.keyID = exchange, rateLimitKeyID(apiKey)
+	if distributedRateLimits != nil {
+		rl.shared = &sharedBucket{
+			client: distributedRateLimits,
+			key:    sharedBucketPrefix + exchange + ":" + rl.keyID,
+		}
+	}
+	return rl
+}
+
+// rateLimitKeyID identifies an API key in Redis keys and metric labels without
+// revealing it; public endpoints called without a key share "public"
+func rateLimitKeyID(apiKey string) string {
+	if apiKey == "" {
+		return "public"
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// sharedBucket is a limiter's token bucket in Redis
+type sharedBucket struct {
+	client   *redis.Client
+	key      string
+	degraded atomic.Bool // Redis failed on the last call; logged once per outage
+}
+
+// wait reserves weight in the shared bucket and sleeps until it is available.
+// handled is false when Redis could not be reached, and the caller should use its
+// local bucket instead.
+func (sb *sharedBucket) wait(ctx context.Context, rl *RateLimiter, weight float64) (handled bool, err error) {
+	delay, tokens, err := sb.reserve(ctx, rl, weight)
+	if err != nil {
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		if !sb.degraded.Swap(true) {
+			log.Printf("Warning: shared rate limit %s unavailable, using the local limiter: %v", sb.key, err)
+		}
+		return false, nil
+	}
+	if sb.degraded.Swap(false) {
+		log.Printf("Shared rate limit %s available again", sb.key)
+	}
+	rl.record(rateLimiterDistributed, weight, tokens)
+	if delay <= 0 {
+		return true, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		refundCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedBucketTimeout)
+		defer cancel()
+		sb.reserve(refundCtx, rl, -weight)
+		return true, ctx.Err()
+	}
+}
+
+// reserve runs the bucket script (EVALSHA, loading it on first use), returning how
+// long to wait for the reserved weight and the tokens left
+func (sb *sharedBucket) reserve(ctx context.Context, rl *RateLimiter, weight float64) (time.Duration, float64, error) {
+	callCtx, cancel := context.WithTimeout(ctx, sharedBucketTimeout)
+	defer cancel()
+	res, err := sharedBucketScript.Run(callCtx, sb.client, []string{sb.key},
+		rl.refillRate, rl.maxTokens, weight).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rate limit script reply %v", res)
+	}
+	waitMs, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, _ := strconv.ParseFloat(tokensStr, 64)
+	return time.Duration(waitMs) * time.Millisecond, tokens, nil
+}
+
+// record counts weight taken for an exchange call and the tokens left after it
+func (rl *RateLimiter) record(limiter string, weight, tokens float64) {
+	if rl.exchange == "" {
+		return
+	}
+	exchangeRateLimitWeight.WithLabelValues(rl.exchange, rl.keyID, limiter).Add(weight)
+	exchangeRateLimitAvailable.WithLabelValues(rl.exchange, rl.keyID).Set(tokens)
+}
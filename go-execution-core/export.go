@@ -0,0 +1,285 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportPageSize is how many trades each keyset query of an export fetches
+const exportPageSize = 1000
+
+// exportColumns is the CSV header; the order is part of the export format, so
+// new columns go at the end. cursor resumes an interrupted export after that row.
+var exportColumns = []string{
+	"order_id", "exchange_order_id", "strategy_name", "symbol", "side", "quantity", "price",
+	"executed_price", "filled_quantity", "fees", "status", "exchange", "account",
+	"timestamp", "executed_at", "cursor",
+}
+
+// exportedTrade is one trades row as exported
+type exportedTrade struct {
+	OrderID         string   `json:"order_id"`
+	ExchangeOrderID string   `json:"exchange_order_id"`
+	StrategyName    string   `json:"strategy_name"`
+	Symbol          string   `json:"symbol"`
+	Side            string   `json:"side"`
+	Quantity        float64  `json:"quantity"`
+	Price           float64  `json:"price"`
+	ExecutedPrice   *float64 `json:"executed_price"`
+	FilledQuantity  *float64 `json:"filled_quantity"`
+	Fees            float64  `json:"fees"`
+	Status          string   `json:"status"`
+	Exchange        string   `json:"exchange"`
+	Account         string   `json:"account"`
+	Timestamp       string   `json:"timestamp"`
+	ExecutedAt      *string  `json:"executed_at"`
+	Cursor          string   `json:"cursor"`
+}
+
+func (t *exportedTrade) csvRecord() []string {
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	executedAt := ""
+	if t.ExecutedAt != nil {
+		executedAt = *t.ExecutedAt
+	}
+	return []string{
+		t.OrderID, t.ExchangeOrderID, t.StrategyName, t.Symbol, t.Side,
+		strconv.FormatFloat(t.Quantity, 'f', -1, 64), strconv.FormatFloat(t.Price, 'f', -1, 64),
+		optional(t.ExecutedPrice), optional(t.FilledQuantity), strconv.FormatFloat(t.Fees, 'f', -1, 64),
+		t.Status, t.Exchange, t.Account, t.Timestamp, executedAt, t.Cursor,
+	}
+}
+
+// tradeWriter is the output side of an export. flush pushes buffered rows out
+// and reports any write error so far.
+type tradeWriter interface {
+	begin()
+	write(t *exportedTrade) error
+	flush() error
+	end()
+}
+
+type csvTradeWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvTradeWriter) begin() {
+	c.w.Write(exportColumns)
+}
+
+func (c *csvTradeWriter) write(t *exportedTrade) error {
+	return c.w.Write(t.csvRecord())
+}
+
+func (c *csvTradeWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvTradeWriter) end() {
+	c.w.Flush()
+}
+
+// jsonTradeWriter streams a JSON array one element at a time
+type jsonTradeWriter struct {
+	w     http.ResponseWriter
+	enc   *json.Encoder
+	count int
+}
+
+func (j *jsonTradeWriter) begin() {
+	fmt.Fprint(j.w, "[")
+}
+
+func (j *jsonTradeWriter) write(t *exportedTrade) error {
+	if j.count > 0 {
+		fmt.Fprint(j.w, ",")
+	}
+	j.count++
+	return j.enc.Encode(t)
+}
+
+func (j *jsonTradeWriter) flush() error {
+	return nil
+}
+
+func (j *jsonTradeWriter) end() {
+	fmt.Fprint(j.w, "]\n")
+}
+
+// handleExportTrades streams trades as CSV or JSON:
+// GET /api/v1/trades/export?from=...&to=...&strategy=...&format=csv|json&cursor=...
+// Rows come newest first in keyset pages, so memory use does not grow with the
+// export. Every row carries the cursor that resumes the export after it, and the
+// X-Export-Complete trailer is only "true" when every row was written.
+func (s *Server) handleExportTrades(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "format must be csv or json"})
+		return
+	}
+
+	var where whereBuilder
+	if strategy := query.Get("strategy"); strategy != "" {
+		where.add("strategy_name = ?", strategy)
+	}
+	label := "all"
+	for _, param := range []string{"from", "to"} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param),
+			})
+			return
+		}
+		if param == "from" {
+			where.add("timestamp >= ?", t)
+			label = t.UTC().Format("20060102")
+		} else {
+			where.add("timestamp <= ?", t)
+			label += "-" + t.UTC().Format("20060102")
+		}
+	}
+
+	var cursor *pageCursor
+	if raw := query.Get("cursor"); raw != "" {
+		decoded, err := decodeCursor(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		cursor = &decoded
+	}
+
+	var out tradeWriter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out = &csvTradeWriter{w: csv.NewWriter(w)}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		out = &jsonTradeWriter{w: w, enc: json.NewEncoder(w)}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="trades_%s.%s"`, label, format))
+	w.Header().Set("Trailer", "X-Export-Complete")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	out.begin()
+	exported, err := s.exportTradePages(r, where, cursor, out, func() { rc.Flush() })
+	out.end()
+	if err != nil {
+		// Headers are long gone; the missing trailer tells the client to resume
+		logEvent(r.Context(), "Trade export interrupted", "rows", exported, "error", err)
+		return
+	}
+	w.Header().Set("X-Export-Complete", "true")
+	logEvent(r.Context(), "Trade export complete", "rows", exported, "format", format)
+}
+
+// exportTradePages writes every matching trade after cursor, one keyset page at a time
+func (s *Server) exportTradePages(r *http.Request, filters whereBuilder, cursor *pageCursor,
+	out tradeWriter, flush func()) (int, error) {
+	exported := 0
+	for {
+		where := whereBuilder{
+			clauses: append([]string(nil), filters.clauses...),
+			args:    append([]interface{}(nil), filters.args...),
+		}
+		if cursor != nil {
+			where.addCursor("timestamp", *cursor)
+		}
+
+		// Built before the call: where.arg appends to where.args, and Go does not
+		// order that against reading where.args in the same argument list
+		pageQuery := fmt.Sprintf(`
+			SELECT order_id, COALESCE(exchange_order_id, ''), strategy_name, symbol, side, quantity, price,
+			       executed_price, filled_quantity, COALESCE(fees, 0), status, COALESCE(exchange, ''),
+			       account, timestamp, executed_at
+			FROM trades
+			%s
+			ORDER BY timestamp DESC, order_id DESC
+			LIMIT %s
+		`, where.sql(), where.arg(exportPageSize))
+
+		rows, err := s.db.QueryContext(r.Context(), pageQuery, where.args...)
+		if err != nil {
+			return exported, err
+		}
+
+		page := 0
+		for rows.Next() {
+			var t exportedTrade
+			var executedPrice, filledQuantity sql.NullFloat64
+			var timestamp time.Time
+			var executedAt sql.NullTime
+			if err := rows.Scan(&t.OrderID, &t.ExchangeOrderID, &t.StrategyName, &t.Symbol, &t.Side,
+				&t.Quantity, &t.Price, &executedPrice, &filledQuantity, &t.Fees, &t.Status, &t.Exchange,
+				&t.Account, &timestamp, &executedAt); err != nil {
+				rows.Close()
+				return exported, err
+			}
+			if executedPrice.Valid {
+				t.ExecutedPrice = &executedPrice.Float64
+			}
+			if filledQuantity.Valid {
+				t.FilledQuantity = &filledQuantity.Float64
+			}
+			if executedAt.Valid {
+				formatted := executedAt.Time.UTC().Format(time.RFC3339Nano)
+				t.ExecutedAt = &formatted
+			}
+			t.Timestamp = timestamp.UTC().Format(time.RFC3339Nano)
+			t.Cursor = encodeCursor(timestamp, t.OrderID)
+
+			if err := out.write(&t); err != nil {
+				rows.Close()
+				return exported, err
+			}
+			cursor = &pageCursor{Timestamp: timestamp, OrderID: t.OrderID}
+			exported++
+			page++
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return exported, err
+		}
+
+		if err := out.flush(); err != nil {
+			return exported, err
+		}
+		flush()
+		if page < exportPageSize {
+			return exported, nil
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Uploader puts export files into an S3-compatible bucket (AWS, MinIO, R2,
+// ...) with path-style URLs and Signature Version 4. One PUT per file, so files
+// are limited to the 5GB a single PUT takes.
+type s3Uploader struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newS3Uploader reads EXPORT_S3_* from config; nil when no endpoint is set
+func newS3Uploader(config *Config) (*s3Uploader, error) {
+	if config.ExportS3Endpoint == "" {
+		return nil, nil
+	}
+	endpoint, err := url.Parse(config.ExportS3Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("EXPORT_S3_ENDPOINT must be an http(s) URL, got %q", config.ExportS3Endpoint)
+	}
+	if config.ExportS3AccessKey == "" || config.ExportS3SecretKey == "" {
+		return nil, fmt.Errorf("EXPORT_S3_ACCESS_KEY and EXPORT_S3_SECRET_KEY are required with EXPORT_S3_ENDPOINT")
+	}
+	return &s3Uploader{
+		endpoint:     endpoint,
+		region:       config.ExportS3Region,
+		accessKey:    config.ExportS3AccessKey,
+		secretKey:    config.ExportS3SecretKey,
+		sessionToken: config.ExportS3SessionToken,
+		client:       &http.Client{Timeout: 30 * time.Minute},
+	}, nil
+}
+
+// upload puts the file at path into bucket under key
+func (u *s3Uploader) upload(ctx context.Context, bucket, key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The signature covers the payload hash, so the file is read twice
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	target := *u.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + bucket + "/" + key
+	target.RawPath = s3EscapePath(target.Path) // sent as signed
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/vnd.apache.parquet")
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+	signS3Request(req, hex.EncodeToString(hash.Sum(nil)), u.accessKey, u.secretKey, u.region, time.Now())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 PUT %s/%s: %s: %s", bucket, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signS3Request adds the AWS Signature Version 4 Authorization header for the
+// s3 service to req, signing the host and every header already set
+func signS3Request(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath URI-encodes each segment of path as SigV4 requires for S3
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but the RFC 3986 unreserved characters
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
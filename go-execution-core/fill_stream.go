@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	fillStreamHistory     = 1000 // events kept for Last-Event-ID resume
+	fillStreamBuffer      = 256  // per-connection; a client this far behind is dropped
+	sseHeartbeatInterval  = 15 * time.Second
+	pnlSnapshotInterval   = 10 * time.Second
+	fillEventName         = "fill"
+	pnlSnapshotEventName  = "pnl_snapshot"
+	fillStreamResetReason = "events since Last-Event-ID are no longer buffered"
+)
+
+// Fill is one execution against an order
+type Fill struct {
+	OrderID      string    `json:"order_id"`
+	StrategyName string    `json:"strategy_name"`
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	Exchange     string    `json:"exchange,omitempty"`
+	Price        float64   `json:"price"`
+	Quantity     float64   `json:"quantity"`
+	Fees         float64   `json:"fees"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// streamEvent is one server-sent event with its resume ID
+type streamEvent struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+// FillStream numbers fill and PnL events and fans them out to SSE clients. Fills
+// are kept in a ring buffer so a reconnecting client can resume from its
+// Last-Event-ID; PnL snapshots are not, since a newer one is always on the way.
+type FillStream struct {
+	mu          sync.Mutex
+	nextID      uint64
+	ring        []streamEvent
+	start       int    // index of the oldest event in ring
+	evicted     uint64 // ID of the newest event pushed out of ring
+	subscribers map[chan streamEvent]struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewFillStream() *FillStream {
+	return &FillStream{
+		ring:        make([]streamEvent, 0, fillStreamHistory),
+		subscribers: make(map[chan streamEvent]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// publish assigns the next ID to an event and delivers it without blocking
+func (fs *FillStream) publish(name string, payload interface{}, keep bool) {
+	if fs == nil {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", name, err)
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.nextID++
+	ev := streamEvent{id: fs.nextID, name: name, data: data}
+	if keep {
+		if len(fs.ring) < fillStreamHistory {
+			fs.ring = append(fs.ring, ev)
+		} else {
+			fs.evicted = fs.ring[fs.start].id
+			fs.ring[fs.start] = ev
+			fs.start = (fs.start + 1) % fillStreamHistory
+		}
+	}
+
+	for ch := range fs.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			delete(fs.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a client and returns the buffered events after lastID. gap
+// is true when events after lastID are gone, either pushed out of the buffer or
+// lost in a restart (which also restarts IDs).
+func (fs *FillStream) subscribe(lastID uint64, resume bool) (ch chan streamEvent, backlog []streamEvent, gap bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if resume {
+		for i := 0; i < len(fs.ring); i++ {
+			ev := fs.ring[(fs.start+i)%len(fs.ring)]
+			if ev.id > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+		gap = lastID < fs.evicted || lastID > fs.nextID
+	}
+
+	ch = make(chan streamEvent, fillStreamBuffer)
+	fs.subscribers[ch] = struct{}{}
+	return ch, backlog, gap
+}
+
+func (fs *FillStream) unsubscribe(ch chan streamEvent) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, exists := fs.subscribers[ch]; exists {
+		delete(fs.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (fs *FillStream) subscriberCount() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.subscribers)
+}
+
+// close ends every open stream; registered to run when the HTTP server shuts
+// down, which would otherwise wait on these long-lived responses
+func (fs *FillStream) close() {
+	fs.closeOnce.Do(func() { close(fs.closed) })
+}
+
+// recordFill publishes a fill to SSE clients and the Redis event stream
+func (s *Server) recordFill(fill Fill) {
+	if fill.Quantity <= 0 {
+		return
+	}
+	if fill.Timestamp.IsZero() {
+		fill.Timestamp = time.Now()
+	}
+	s.fills.publish(fillEventName, fill, true)
+	s.eventRelay.enqueueFill(fill)
+}
+
+// runPnLSnapshots publishes portfolio PnL totals while anyone is listening
+func (s *Server) runPnLSnapshots() {
+	ticker := time.NewTicker(pnlSnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.fills.closed:
+			return
+		case <-ticker.C:
+		}
+		if s.db == nil || s.fills.subscriberCount() == 0 {
+			continue
+		}
+
+		var unrealized, realized float64
+		var openPositions int
+		ctx, cancel := s.dbContext(context.Background())
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(unrealized_pnl), 0), COALESCE(SUM(realized_pnl), 0), COUNT(*)
+			FROM positions
+			WHERE quantity != 0
+		`).Scan(&unrealized, &realized, &openPositions)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to compute PnL snapshot: %v", err)
+			continue
+		}
+
+		s.fills.publish(pnlSnapshotEventName, map[string]interface{}{
+			"total_unrealized_pnl": unrealized,
+			"total_realized_pnl":   realized,
+			"total_pnl":            unrealized + realized,
+			"open_positions":       openPositions,
+			"timestamp":            time.Now(),
+		}, false)
+	}
+}
+
+func (s *Server) registerFillStreamEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/stream/fills", s.handleFillStream)
+}
+
+// handleFillStream streams fills and PnL snapshots as server-sent events:
+// GET /api/v1/stream/fills (resume with the Last-Event-ID header or ?last_event_id=)
+func (s *Server) handleFillStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// EventSource cannot set headers on its first connection, so also take a query param
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	resume := lastEventID != ""
+	if resume {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's read and write timeouts; an expired read
+	// deadline would also cancel the request context
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+
+	ch, backlog, gap := s.fills.subscribe(lastID, resume)
+	defer s.fills.unsubscribe(ch)
+	logEvent(r.Context(), "Fill stream connected", "last_event_id", lastEventID, "replayed", len(backlog))
+
+	write := func(ev streamEvent) error {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.id, ev.name, ev.data)
+		return err
+	}
+
+	// Ask EventSource to retry quickly after a dropped connection
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if gap {
+		fmt.Fprintf(w, "event: reset\ndata: {\"reason\": %q}\n\n", fillStreamResetReason)
+	}
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.fills.closed:
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return // fell too far behind; the client reconnects with Last-Event-ID
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
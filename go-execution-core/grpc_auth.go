@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyMetadata carries a client API key over gRPC, like the X-API-Key header
+const apiKeyMetadata = "x-api-key"
+
+// grpcPrincipal authenticates a call the way requireAuth does /api/v1 requests:
+// an "authorization: Bearer <token>" entry or, while AUTH_ACCEPT_API_KEYS is on,
+// an x-api-key entry. Methods needing no permission (health, reflection, build
+// info) skip authentication, as do all calls when API_AUTH_ENABLED=false.
+func (s *Server) grpcPrincipal(ctx context.Context, method string) (context.Context, error) {
+	perm := grpcMethodPermission(method)
+	if !s.config.APIAuthEnabled || perm == "" {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	principal, err := s.grpcCredentials(ctx, md, perm)
+	if err != nil {
+		return nil, err
+	}
+	if missing := principal.missingPermission(perm); missing != "" {
+		logEvent(ctx, "permission denied", "method", method,
+			"principal", principal.ID, "role", principal.Role, "missing", missing)
+		return nil, status.Errorf(codes.PermissionDenied, "missing permission %s", missing)
+	}
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.Caller = principal.ID
+	}
+	return context.WithValue(ctx, principalContextKey, principal), nil
+}
+
+// grpcCredentials resolves the call's token or API key to a principal
+func (s *Server) grpcCredentials(ctx context.Context, md metadata.MD, perm string) (*Principal, error) {
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, ok := bearerToken(values[0])
+		if !ok || s.tokenVerifier == nil {
+			return nil, status.Error(codes.Unauthenticated, "unsupported authorization metadata")
+		}
+		claims, err := s.tokenVerifier.Verify(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid token: "+err.Error())
+		}
+		return &Principal{ID: claims.Subject, Kind: "jwt", Role: claims.Role, Permissions: claims.Scopes()}, nil
+	}
+
+	if !s.config.AuthAcceptAPIKeys {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	values := md.Get(apiKeyMetadata)
+	if len(values) == 0 || values[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization or "+apiKeyMetadata+" metadata")
+	}
+	if s.apiKeys == nil {
+		return nil, status.Error(codes.Unavailable, "authentication unavailable: database not connected")
+	}
+	lookupCtx, cancel := s.dbContext(ctx)
+	client, err := s.apiKeys.Authenticate(lookupCtx, values[0], grpcRemoteClient(ctx))
+	cancel()
+	if err != nil {
+		if errors.Is(err, errAPIKeyLookupLimited) {
+			return nil, status.Error(codes.ResourceExhausted, "too many API key lookups")
+		}
+		if !errors.Is(err, errAPIKeyInvalid) {
+			logEvent(ctx, "API key lookup failed", "error", err)
+			return nil, status.Error(codes.Unavailable, "authentication unavailable")
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	// Request signatures cover REST bodies only, so signed keys cannot change
+	// anything over gRPC; they use REST or a bearer token for that
+	if client.RequireSignature && !strings.HasSuffix(perm, ":read") {
+		return nil, status.Error(codes.PermissionDenied,
+			"signed API keys may only call read methods over gRPC; use a bearer token or the REST API")
+	}
+	return &Principal{ID: client.KeyID, Kind: "api_key", Role: client.Role, Permissions: rolePermissions[client.Role]}, nil
+}
+
+func (s *Server) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.grpcPrincipal(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.grpcPrincipal(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcRemoteClient identifies the caller by its IP, like remoteClient
+func grpcRemoteClient(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpcHealth serves the standard grpc.health.v1 service from the /readyz checks,
+// for the service mesh and grpcurl probes. The whole server ("") and
+// ExecutionService are SERVING exactly when readiness passes. The status is
+// re-evaluated every GRPC_HEALTH_INTERVAL for Watch streams; Check evaluates it
+// on the spot, like a /readyz request.
+type grpcHealth struct {
+	healthpb.UnimplementedHealthServer
+	s *Server
+
+	mu       sync.Mutex
+	status   healthpb.HealthCheckResponse_ServingStatus
+	changed  chan struct{} // closed and replaced on every status change
+	draining bool          // set by drain; the status stays NOT_SERVING
+}
+
+// grpcHealthServices are the service names the health service answers for
+var grpcHealthServices = map[string]bool{
+	"": true,
+	pb.ExecutionService_ServiceDesc.ServiceName: true,
+}
+
+func newGRPCHealth(s *Server) *grpcHealth {
+	return &grpcHealth{
+		s:       s,
+		status:  healthpb.HealthCheckResponse_NOT_SERVING,
+		changed: make(chan struct{}),
+	}
+}
+
+// current returns the status and a channel closed when it next changes
+func (h *grpcHealth) current() (healthpb.HealthCheckResponse_ServingStatus, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status, h.changed
+}
+
+func (h *grpcHealth) set(servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining || h.status == servingStatus {
+		return
+	}
+	log.Printf("gRPC health: %s -> %s", h.status, servingStatus)
+	h.status = servingStatus
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// evaluate runs the readiness checks and records the outcome
+func (h *grpcHealth) evaluate(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready, _ := h.s.readiness(ctx); ready {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	h.set(servingStatus)
+	current, _ := h.current()
+	return current
+}
+
+// run re-evaluates the status until shutdown starts
+func (h *grpcHealth) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.evaluate(h.s.streamCtx)
+		select {
+		case <-h.s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain reports NOT_SERVING from now on. Shutdown calls it before ending streams
+// and stopping the server, so balancers stop routing new calls here first.
+func (h *grpcHealth) drain() {
+	h.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	h.mu.Lock()
+	h.draining = true
+	h.mu.Unlock()
+}
+
+func (h *grpcHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !grpcHealthServices[req.Service] {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+	return &healthpb.HealthCheckResponse{Status: h.evaluate(ctx)}, nil
+}
+
+// Watch sends the status now and on every change. Unknown services get
+// SERVICE_UNKNOWN, as the protocol asks. Streams end when shutdown starts, after
+// the final NOT_SERVING, so they do not hold up GracefulStop.
+func (h *grpcHealth) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	sent := healthpb.HealthCheckResponse_ServingStatus(-1)
+	// send reports the latest status if the client has not seen it yet
+	send := func() (<-chan struct{}, error) {
+		servingStatus, changed := h.current()
+		if !grpcHealthServices[req.Service] {
+			servingStatus = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		if servingStatus == sent {
+			return changed, nil
+		}
+		sent = servingStatus
+		return changed, stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus})
+	}
+
+	for {
+		changed, err := send()
+		if err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream ended")
+		case <-h.s.streamCtx.Done():
+			if _, err := send(); err != nil {
+				return err
+			}
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-changed:
+		}
+	}
+}
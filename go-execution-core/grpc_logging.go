@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata carries the request ID over gRPC, like the X-Request-ID header
+var requestIDMetadata = strings.ToLower(requestIDHeader)
+
+// grpcRequestInfo assigns the call a request ID the way requestLogging does,
+// honoring a valid incoming x-request-id so a caller's trace continues here
+func grpcRequestInfo(ctx context.Context) (context.Context, *requestInfo) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	info := &requestInfo{ID: id}
+	return context.WithValue(ctx, requestInfoContextKey, info), info
+}
+
+// logGRPCCall writes the access log line for a finished call. Health checks are
+// left out, like the HTTP probes.
+func logGRPCCall(ctx context.Context, method string, start time.Time, err error) {
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return
+	}
+	remote := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	kv := []interface{}{
+		"method", method,
+		"code", status.Code(err).String(),
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		"peer", remote,
+	}
+	if err != nil {
+		kv = append(kv, "error", status.Convert(err).Message())
+	}
+	logEvent(ctx, "grpc request", kv...)
+}
+
+// grpcUnaryLogging and grpcStreamLogging tag every call with a request ID, return
+// it in the x-request-id response header and log the call when it ends
+func grpcUnaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, reqInfo := grpcRequestInfo(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, reqInfo.ID))
+
+	resp, err := handler(ctx, req)
+	logGRPCCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func grpcStreamLogging(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, reqInfo := grpcRequestInfo(ss.Context())
+	ss.SetHeader(metadata.Pairs(requestIDMetadata, reqInfo.ID))
+
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logGRPCCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// recoveredPanic logs a handler panic with its stack and turns it into INTERNAL,
+// so one bad call cannot take the server down
+func recoveredPanic(ctx context.Context, method string, p interface{}) error {
+	grpcPanics.WithLabelValues(method).Inc()
+	logEvent(ctx, "gRPC handler panic", "method", method, "panic", p, "stack", string(debug.Stack()))
+	return status.Errorf(codes.Internal, "internal error (request_id %s)", requestIDFromContext(ctx))
+}
+
+func grpcUnaryRecovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			resp, err = nil, recoveredPanic(ctx, info.FullMethod, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func grpcStreamRecovery(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recoveredPanic(ss.Context(), info.FullMethod, p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// contextStream hands stream handlers a context enriched by the interceptors
+// (request ID, principal)
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (cs *contextStream) Context() context.Context {
+	return cs.ctx
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// placeLimitOrder records a resting LIMIT order through the REST API and returns
+// its exchange order ID
+func placeLimitOrder(t *testing.T, s *Server, mock *MockExchange, orderID, symbol string) string {
+	t.Helper()
+	mock.RestLimitOrders = true
+	srv := serveTest(t, s)
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": orderID, "strategy_name": "momentum", "symbol": symbol, "side": "BUY",
+		"quantity": 0.5, "price": 29000, "order_type": "LIMIT", "exchange": "mock",
+	})
+	if code != http.StatusOK || body["status"] != "NEW" {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	s.dbWrites.Wait()
+	exchangeOrderID, _ := body["exchange_order_id"].(string)
+	if exchangeOrderID == "" {
+		t.Fatalf("no exchange order ID: %v", body)
+	}
+	return exchangeOrderID
+}
+
+func TestGetOrderStatusRPC(t *testing.T) {
+	s, mock := newTestServer(t)
+	ctx := context.Background()
+	exchangeOrderID := placeLimitOrder(t, s, mock, "ord-1", "BTCUSDT")
+	mock.SetOrderStatus(exchangeOrderID, "FILLED", 0.5)
+
+	resp, err := s.GetOrderStatus(ctx, &pb.OrderStatusRequest{OrderId: "ord-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "FILLED" || resp.FilledQuantity != 0.5 || resp.Source != "exchange" ||
+		resp.ExchangeOrderId != exchangeOrderID || resp.Exchange != "mock" || resp.Symbol != "BTCUSDT" {
+		t.Errorf("response = %v", resp)
+	}
+	var stored string
+	if err := s.db.QueryRow(`SELECT status FROM trades WHERE order_id = $1`, "ord-1").Scan(&stored); err != nil || stored != "FILLED" {
+		t.Errorf("stored status %q, err %v; want the refresh written back", stored, err)
+	}
+
+	// An order the engine never recorded is looked up on the named exchange
+	other := placeLimitOrder(t, s, mock, "ord-2", "ETHUSDT")
+	if _, err := s.db.Exec(`DELETE FROM trades WHERE order_id = $1`, "ord-2"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s.GetOrderStatus(ctx, &pb.OrderStatusRequest{OrderId: "ext-1", ExchangeOrderId: other, Exchange: "mock", Symbol: "ethusdt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "NEW" || resp.Source != "exchange" || resp.Symbol != "ETHUSDT" {
+		t.Errorf("unrecorded order = %v", resp)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.OrderStatusRequest
+		code codes.Code
+	}{
+		{"missing order ID", &pb.OrderStatusRequest{}, codes.InvalidArgument},
+		{"unknown order", &pb.OrderStatusRequest{OrderId: "nope"}, codes.NotFound},
+		{"unknown on the exchange too", &pb.OrderStatusRequest{OrderId: "nope", Exchange: "mock", Symbol: "BTCUSDT"}, codes.NotFound},
+		{"unconfigured exchange", &pb.OrderStatusRequest{OrderId: "ord-1", Exchange: "kraken"}, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		if _, err := s.GetOrderStatus(ctx, tt.req); status.Code(err) != tt.code {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestGetOpenOrdersRPC(t *testing.T) {
+	s, mock := newTestServer(t)
+	ctx := context.Background()
+	placeLimitOrder(t, s, mock, "ord-1", "BTCUSDT")
+	placeLimitOrder(t, s, mock, "ord-2", "ETHUSDT")
+	filled := placeLimitOrder(t, s, mock, "ord-3", "BTCUSDT")
+	mock.SetOrderStatus(filled, "FILLED", 0.5)
+	if _, err := s.GetOrderStatus(ctx, &pb.OrderStatusRequest{OrderId: "ord-3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.OpenOrdersRequest
+		want []string
+	}{
+		{"all exchanges", &pb.OpenOrdersRequest{}, []string{"ord-1", "ord-2"}},
+		{"one exchange", &pb.OpenOrdersRequest{Exchange: "mock"}, []string{"ord-1", "ord-2"}},
+		{"one symbol", &pb.OpenOrdersRequest{Exchange: "mock", Symbol: "btcusdt"}, []string{"ord-1"}},
+		{"symbol without open orders", &pb.OpenOrdersRequest{Symbol: "SOLUSDT"}, []string{}},
+	}
+	for _, tt := range tests {
+		resp, err := s.GetOpenOrders(ctx, tt.req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := make([]string, 0, len(resp.Orders))
+		for _, order := range resp.Orders {
+			got = append(got, order.OrderId)
+			if order.Status != "NEW" || order.Exchange != "mock" || order.Price != 29000 {
+				t.Errorf("%s: order = %v", tt.name, order)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: orders %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := s.GetOpenOrders(ctx, &pb.OpenOrdersRequest{Exchange: "kraken"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("unconfigured exchange: err = %v", err)
+	}
+}
+
+// TestOrderStatusJSONContract pins the REST order status JSON the gRPC methods
+// were built alongside: the REST keys must not change, and GetOrderStatus and
+// GetOrder must report the same values under the same names
+func TestOrderStatusJSONContract(t *testing.T) {
+	s, mock := newTestServer(t)
+	srv := serveTest(t, s)
+	ctx := context.Background()
+	exchangeOrderID := placeLimitOrder(t, s, mock, "ord-1", "BTCUSDT")
+	mock.SetOrderStatus(exchangeOrderID, "PARTIALLY_FILLED", 0.2)
+
+	code, rest := doJSON(t, srv, http.MethodGet, "/api/v1/order_status?force=true&order_id="+url.QueryEscape("ord-1"), nil)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, rest)
+	}
+	wantKeys := []string{"average_price", "exchange", "exchange_order_id", "fees", "filled_quantity",
+		"order_id", "source", "status", "symbol", "updated_at"}
+	if got := sortedKeys(rest); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("REST keys = %v, want %v", got, wantKeys)
+	}
+
+	resp, err := s.GetOrderStatus(ctx, &pb.OrderStatusRequest{OrderId: "ord-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpc := protoJSON(t, resp)
+	for _, key := range wantKeys {
+		if key == "updated_at" || key == "fees" {
+			continue // a timestamp string in protojson; zero fees are omitted
+		}
+		if !reflect.DeepEqual(rest[key], rpc[key]) {
+			t.Errorf("%s: REST %v, gRPC %v", key, rest[key], rpc[key])
+		}
+	}
+
+	code, restOrder := doJSON(t, srv, http.MethodGet, "/api/v1/orders/ord-1", nil)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, restOrder)
+	}
+	order, err := s.GetOrder(ctx, &pb.GetOrderRequest{OrderId: "ord-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpcOrder := protoJSON(t, order)
+	for _, key := range []string{"order_id", "exchange_order_id", "strategy_name", "symbol", "side",
+		"quantity", "price", "status", "filled_quantity", "exchange", "account_type", "order_type", "source"} {
+		if !reflect.DeepEqual(restOrder[key], rpcOrder[key]) {
+			t.Errorf("order %s: REST %v, gRPC %v", key, restOrder[key], rpcOrder[key])
+		}
+	}
+}
+
+// protoJSON renders a message with its proto field names, the naming the REST
+// API uses
+func protoJSON(t *testing.T, m proto.Message) map[string]interface{} {
+	t.Helper()
+	raw, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,33 +2,65 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"strings"
 	"time"
 
 	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Implement pb.UnimplementedExecutionServiceServer to satisfy the interface
-// This ensures we implement all required methods from the generated code
+// Server is the only ExecutionService implementation; the methods live in this
+// file and the ones beside it (order_actions.go, build_info.go). The embedded
+// pb.UnimplementedExecutionServiceServer answers UNIMPLEMENTED for RPCs added to
+// execution.proto before they are written here.
+var _ pb.ExecutionServiceServer = (*Server)(nil)
+
+// Reasons SubmitOrder rejects an order before it reaches the exchange
+const (
+	rejectExchangeNotConfigured = "exchange_not_configured"
+	rejectValidation            = "validation"
+	rejectExchangeUnavailable   = "exchange_unavailable"
+)
+
+// SubmitOrder places one order; POST /api/v1/orders is served by it too. Orders
+// that cannot be placed come back REJECTED with a reject_reason rather than as an
+// error status. Retries carrying the same idempotency-key metadata, or else the
+// same order_id, replay the first response.
 func (s *Server) SubmitOrder(ctx context.Context, req *pb.OrderRequest) (*pb.OrderResponse, error) {
-	log.Printf("gRPC Order: %s %s %.8f %s", req.Side, req.Symbol, req.Quantity, req.Exchange)
+	idemKey, err := idempotencyKey(ctx, req.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	logEvent(ctx, "Order request", "order_id", req.OrderId, "side", req.Side, "symbol", req.Symbol,
+		"quantity", req.Quantity, "exchange", req.Exchange)
 
-	// Validate request
-	if req.Symbol == "" || req.Side == "" || req.Quantity <= 0 {
+	// Determine exchange (default to binance) and optional named account
+	if req.Exchange == "" {
+		req.Exchange = "binance"
+	}
+	if req.OrderType == "" {
+		req.OrderType = "MARKET"
+	}
+	req.Exchange, req.Account = normalizeExchangeAccount(req.Exchange, req.Account)
+	if req.AccountType == "margin" && req.Exchange == "binance" {
+		req.Exchange = "binance_margin"
+	}
+	exchange := exchangeKey(req.Exchange, req.Account)
+	reject := func(reason, message string) *pb.OrderResponse {
 		return &pb.OrderResponse{
 			Success:      false,
 			OrderId:      req.OrderId,
 			Status:       "REJECTED",
-			ErrorMessage: "Invalid order parameters",
-		}, nil
-	}
-
-	// Determine exchange (default to binance)
-	exchange := req.Exchange
-	if exchange == "" {
-		exchange = "binance"
+			ErrorMessage: message,
+			RejectReason: reason,
+		}
 	}
 
 	// Get exchange client
@@ -37,44 +69,71 @@ func (s *Server) SubmitOrder(ctx context.Context, req *pb.OrderRequest) (*pb.Ord
 	s.mu.RUnlock()
 
 	if !exists {
-		return &pb.OrderResponse{
-			Success:      false,
-			OrderId:      req.OrderId,
-			Status:       "REJECTED",
-			ErrorMessage: fmt.Sprintf("Exchange %s not configured", exchange),
-		}, nil
+		return reject(rejectExchangeNotConfigured, fmt.Sprintf("Exchange %s not configured", exchange)), nil
 	}
 
 	// Create order
 	order := &Order{
-		ID:           req.OrderId,
-		Symbol:       req.Symbol,
-		Side:         req.Side,
-		Quantity:     req.Quantity,
-		Price:        req.Price,
-		OrderType:    req.OrderType,
-		StrategyName: req.StrategyName,
+		ID:             req.OrderId,
+		Symbol:         req.Symbol,
+		Side:           req.Side,
+		Quantity:       req.Quantity,
+		Price:          req.Price,
+		OrderType:      req.OrderType,
+		StrategyName:   req.StrategyName,
+		ReduceOnly:     req.ReduceOnly,
+		PositionSide:   req.PositionSide,
+		AccountType:    req.AccountType,
+		SideEffectType: req.SideEffectType,
+	}
+	if errs := validateOrder(exchangeClient, order); errs != nil {
+		resp := reject(rejectValidation, errs.Error())
+		resp.FieldErrors = fieldErrorsProto(errs)
+		return resp, nil
+	}
+	req.Side, req.OrderType = order.Side, order.OrderType
+
+	if err := s.health.CheckOrderable(exchange); err != nil {
+		return reject(rejectExchangeUnavailable, err.Error()), nil
+	}
+
+	// Concurrent duplicates wait here so only one reaches the exchange
+	dbCtx := context.WithoutCancel(ctx)
+	fingerprint := requestFingerprint(orderSubmissionFromProto(req))
+	if idemKey != "" {
+		unlock := s.idempotency.lock(idemKey)
+		defer unlock()
+		if replay := s.claimIdempotencyKey(dbCtx, idemKey, req.OrderId, fingerprint); replay != nil {
+			logEvent(ctx, "Duplicate order not submitted", "order_id", req.OrderId, "status", replay.Status)
+			return replayedOrderResponse(replay)
+		}
+	}
+	respond := func(resp *pb.OrderResponse) (*pb.OrderResponse, error) {
+		if idemKey != "" {
+			s.saveIdempotentResponse(dbCtx, idemKey, fingerprint, http.StatusOK, orderResponseJSON(resp))
+		}
+		return resp, nil
 	}
 
 	// Submit to exchange
-	result, err := exchangeClient.SubmitOrder(order)
+	result, err := s.submitOrder(ctx, exchange, exchangeClient, order)
 	if err != nil {
-		log.Printf("Order submission failed: %v", err)
-		return &pb.OrderResponse{
+		logEvent(ctx, "Order failed", "order_id", req.OrderId, "exchange", exchange, "error", err)
+		return respond(&pb.OrderResponse{
 			Success:      false,
 			OrderId:      req.OrderId,
 			Status:       "FAILED",
 			ErrorMessage: err.Error(),
-		}, nil
+		})
 	}
 
 	// Log to database
 	if s.db != nil {
-		go s.logOrderToDatabase(req, result)
+		s.goDBWrite(func() { s.logOrderToDatabase(dbCtx, req, result) })
 	}
 
 	// Return response
-	return &pb.OrderResponse{
+	return respond(&pb.OrderResponse{
 		Success:          true,
 		OrderId:          req.OrderId,
 		ExchangeOrderId:  result.ExchangeOrderID,
@@ -83,10 +142,127 @@ func (s *Server) SubmitOrder(ctx context.Context, req *pb.OrderRequest) (*pb.Ord
 		ExecutedQuantity: result.ExecutedQuantity,
 		Fees:             result.Fees,
 		ExecutedAt:       timestamppb.New(result.Timestamp),
-	}, nil
+	})
+}
+
+func fieldErrorsProto(errs validationError) []*pb.FieldError {
+	out := make([]*pb.FieldError, len(errs))
+	for i, fe := range errs {
+		out[i] = &pb.FieldError{Field: fe.Field, Message: fe.Message}
+	}
+	return out
+}
+
+// BatchSubmitOrders submits orders on one exchange with the semantics of POST
+// /api/v1/orders/batch: legs go out concurrently, every leg is validated before
+// any is placed, and results keep the input order. Unlike SubmitOrder, a batch
+// that cannot start is an error status rather than a REJECTED response.
+func (s *Server) BatchSubmitOrders(ctx context.Context, req *pb.BatchOrderRequest) (*pb.BatchOrderResponse, error) {
+	if len(req.Orders) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "orders required")
+	}
+	exchangeName, account := req.Exchange, req.Account
+	if exchangeName == "" {
+		exchangeName, account = req.Orders[0].Exchange, req.Orders[0].Account
+	}
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+	key := exchangeKey(normalizeExchangeAccount(exchangeName, account))
+
+	s.mu.RLock()
+	exchangeClient, exists := s.exchanges[key]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "exchange %s not configured", key)
+	}
+
+	orders := make([]*Order, len(req.Orders))
+	var invalid validationError
+	for i, orderReq := range req.Orders {
+		if orderReq.Exchange != "" && exchangeKey(normalizeExchangeAccount(orderReq.Exchange, orderReq.Account)) != key {
+			invalid = append(invalid, FieldError{
+				Field:   fmt.Sprintf("orders[%d].exchange", i),
+				Message: fmt.Sprintf("must be empty or %s, the batch's exchange", key),
+			})
+		}
+		orders[i] = &Order{
+			ID:           orderReq.OrderId,
+			Symbol:       orderReq.Symbol,
+			Side:         orderReq.Side,
+			Quantity:     orderReq.Quantity,
+			Price:        orderReq.Price,
+			OrderType:    orderReq.OrderType,
+			StrategyName: orderReq.StrategyName,
+		}
+		if orders[i].OrderType == "" {
+			orders[i].OrderType = "MARKET"
+		}
+		if errs := validateOrder(exchangeClient, orders[i]); errs != nil {
+			invalid = append(invalid, errs.prefixed(fmt.Sprintf("orders[%d].", i))...)
+		}
+	}
+	if invalid != nil {
+		return nil, status.Error(codes.InvalidArgument, invalid.Error())
+	}
+	if err := s.health.CheckOrderable(key); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	log.Printf("gRPC Batch: %d orders on %s (atomic=%t)", len(orders), key, req.Atomic)
+
+	batch := s.batchSubmit(ctx, key, exchangeClient, orders, req.Atomic)
+
+	resp := &pb.BatchOrderResponse{
+		Total:     int32(len(orders)),
+		Succeeded: int32(batch.placed),
+		Failed:    int32(len(orders) - batch.placed),
+		Results:   make([]*pb.BatchOrderResult, len(batch.legs)),
+	}
+	for i, leg := range batch.legs {
+		result := &pb.BatchOrderResult{OrderId: orders[i].ID}
+		if leg.err != nil {
+			result.Error = leg.err.Error()
+		} else {
+			result.Success = true
+			result.ExchangeOrderId = leg.result.ExchangeOrderID
+			result.Status = leg.result.Status
+			result.ExecutedPrice = leg.result.ExecutedPrice
+			result.ExecutedQuantity = leg.result.ExecutedQuantity
+			result.Fees = leg.result.Fees
+			if s.db != nil {
+				orderReq := req.Orders[i]
+				orderReq.Exchange, orderReq.Account = splitExchangeKey(key)
+				orderReq.Side, orderReq.OrderType = orders[i].Side, orders[i].OrderType
+				legResult := leg.result
+				s.goDBWrite(func() { s.logOrderToDatabase(context.WithoutCancel(ctx), orderReq, legResult) })
+			}
+		}
+		resp.Results[i] = result
+	}
+
+	if req.Atomic {
+		resp.Status = "COMPLETED"
+		if batch.unwound != nil {
+			resp.Status = "FAILED"
+			for i, outcome := range batch.unwound {
+				resp.Results[i].Success = false
+				resp.Results[i].LegState = outcome.state
+				if outcome.err != nil {
+					resp.Results[i].Error = outcome.err.Error()
+				}
+			}
+		} else {
+			for _, result := range resp.Results {
+				result.LegState = legSubmitted
+			}
+		}
+	}
+	return resp, nil
 }
 
-// GetMarketData retrieves current market data
+// GetMarketData retrieves current market data through the market data cache
+// (cache-bypass metadata skips it); GET /api/v1/market/{exchange}/{symbol} is
+// served by it too
 func (s *Server) GetMarketData(ctx context.Context, req *pb.MarketDataRequest) (*pb.MarketDataResponse, error) {
 	log.Printf("gRPC Market data: %s on %s", req.Symbol, req.Exchange)
 
@@ -100,33 +276,171 @@ func (s *Server) GetMarketData(ctx context.Context, req *pb.MarketDataRequest) (
 	s.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("exchange %s not configured", exchange)
+		return nil, status.Errorf(codes.FailedPrecondition, "Exchange %s not configured", exchange)
 	}
 
-	data, err := exchangeClient.GetMarketData(req.Symbol)
+	data, _, err := s.cachedMarketData(ctx, exchange, exchangeClient, req.Symbol, cacheBypassRequested(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get market data: %w", err)
 	}
 
-	return &pb.MarketDataResponse{
-		Symbol:            req.Symbol,
-		Exchange:          exchange,
-		Price:             data.Price,
-		Bid:               data.Bid,
-		Ask:               data.Ask,
-		Volume_24H:        data.Volume24h,
-		High_24H:          data.High24h,
-		Low_24H:           data.Low24h,
-		PriceChange_24H:   data.PriceChange,
-		PriceChangePct_24H: (data.PriceChange / data.Price) * 100,
-		Timestamp:         timestamppb.New(data.Timestamp),
-	}, nil
+	return marketDataProto(req.Symbol, exchange, data), nil
+}
+
+// GetTickers lists 24h tickers from the ticker cache, filtered and sorted like
+// GET /api/v1/market/{exchange}/tickers
+func (s *Server) GetTickers(ctx context.Context, req *pb.TickersRequest) (*pb.TickersResponse, error) {
+	exchange := req.Exchange
+	if exchange == "" {
+		exchange = "binance"
+	}
+
+	q := tickerQuery{
+		Exchange:   exchange,
+		QuoteAsset: req.QuoteAsset,
+		SortBy:     req.SortBy,
+		Ascending:  req.Ascending,
+		Limit:      int(req.Limit),
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	lister, err := s.tickerSource(exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	tickers, fetchedAt, err := s.marketTickers(lister, q)
+	if err != nil {
+		logEvent(ctx, "Failed to load tickers", "exchange", exchange, "error", err)
+		return nil, fmt.Errorf("failed to get tickers: %w", err)
+	}
+
+	resp := &pb.TickersResponse{
+		Exchange:  exchange,
+		Tickers:   make([]*pb.Ticker, len(tickers)),
+		FetchedAt: timestamppb.New(fetchedAt),
+	}
+	for i, t := range tickers {
+		resp.Tickers[i] = &pb.Ticker{
+			Symbol:         t.Symbol,
+			Price:          t.Price,
+			PriceChange:    t.PriceChange,
+			PriceChangePct: t.PriceChangePercent,
+			Volume:         t.Volume,
+			QuoteVolume:    t.QuoteVolume,
+		}
+	}
+	return resp, nil
+}
+
+// GetPositions lists positions like GET /api/v1/portfolio/positions
+func (s *Server) GetPositions(ctx context.Context, req *pb.PositionsRequest) (*pb.PositionsResponse, error) {
+	if req.ClosedWithinSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "closed_within_seconds must not be negative")
+	}
+	if !s.dbAvailable() {
+		return nil, status.Error(codes.Unavailable, "database not available")
+	}
+
+	rows, err := s.queryPositions(ctx, positionFilter{
+		StrategyName:  req.StrategyName,
+		Symbol:        req.Symbol,
+		Exchange:      req.Exchange,
+		Account:       req.Account,
+		IncludeClosed: req.IncludeClosed,
+		ClosedWithin:  time.Duration(req.ClosedWithinSeconds) * time.Second,
+	})
+	if err != nil {
+		logEvent(ctx, "Failed to query positions", "error", err)
+		return nil, status.Error(codes.Internal, "failed to fetch positions")
+	}
+
+	resp := &pb.PositionsResponse{Positions: make([]*pb.Position, len(rows))}
+	var totals positionTotals
+	for i := range rows {
+		row := &rows[i] // the optional fields point into it
+		position := &pb.Position{
+			Symbol:            row.Symbol,
+			Account:           row.Account,
+			StrategyName:      row.StrategyName,
+			Quantity:          row.Quantity,
+			AverageEntryPrice: row.AvgEntryPrice,
+			OpenedAt:          timestamppb.New(row.OpenedAt),
+			LastUpdated:       timestamppb.New(row.LastUpdated),
+			Closed:            row.Quantity == 0,
+		}
+		if row.CurrentPrice.Valid {
+			marketValue := row.CurrentPrice.Float64 * row.Quantity
+			position.CurrentPrice, position.MarketValue = &row.CurrentPrice.Float64, &marketValue
+		}
+		if row.UnrealizedPnL.Valid {
+			position.UnrealizedPnl = &row.UnrealizedPnL.Float64
+		}
+		if row.RealizedPnL.Valid {
+			position.RealizedPnl = &row.RealizedPnL.Float64
+		}
+		totals.add(*row)
+		resp.Positions[i] = position
+	}
+	resp.TotalUnrealizedPnl = totals.unrealizedPnL
+	resp.TotalRealizedPnl = totals.realizedPnL
+	resp.TotalPnl = totals.unrealizedPnL + totals.realizedPnL
+	resp.TotalMarketValue = totals.marketValue
+	return resp, nil
+}
+
+// GetPortfolioSummary returns the numbers of GET /api/v1/portfolio/performance
+func (s *Server) GetPortfolioSummary(ctx context.Context, req *pb.PortfolioSummaryRequest) (*pb.PortfolioSummary, error) {
+	if !s.dbAvailable() {
+		return nil, status.Error(codes.Unavailable, "database not available")
+	}
+
+	perf, err := s.queryPortfolioPerformance(ctx)
+	if err != nil {
+		logEvent(ctx, "Failed to query performance", "error", err)
+		return nil, status.Error(codes.Internal, "failed to fetch performance data")
+	}
+
+	resp := &pb.PortfolioSummary{
+		TotalTrades:        perf.TotalTrades,
+		WinningTrades:      perf.WinningTrades,
+		LosingTrades:       perf.LosingTrades,
+		WinRate:            perf.WinRate,
+		TotalPnl:           perf.TotalPnL,
+		AveragePnlPerTrade: perf.AvgPnL,
+		MaxWin:             perf.MaxWin,
+		MaxLoss:            perf.MaxLoss,
+		RiskAdjusted:       riskAdjustedProto(perf.RiskAdjusted),
+		Strategies:         make([]*pb.StrategyPerformance, len(perf.Strategies)),
+	}
+	for i, strategy := range perf.Strategies {
+		resp.Strategies[i] = &pb.StrategyPerformance{
+			StrategyName: strategy.StrategyName,
+			Trades:       strategy.Trades,
+			Pnl:          strategy.PnL,
+			RiskAdjusted: riskAdjustedProto(strategy.RiskAdjusted),
+		}
+	}
+	return resp, nil
+}
+
+func riskAdjustedProto(stats riskAdjustedStats) *pb.RiskAdjustedStats {
+	return &pb.RiskAdjustedStats{
+		Days:                  int32(stats.Days),
+		SharpeRatio:           stats.SharpeRatio,
+		SortinoRatio:          stats.SortinoRatio,
+		MaxDrawdown:           stats.MaxDrawdown,
+		MaxDrawdownPeakDate:   stats.MaxDrawdownPeak,
+		MaxDrawdownTroughDate: stats.MaxDrawdownTrough,
+		ProfitFactor:          stats.ProfitFactor,
+	}
 }
 
 // StreamPrices streams real-time price updates (stub for now)
 func (s *Server) StreamPrices(req *pb.StreamRequest, stream pb.ExecutionService_StreamPricesServer) error {
 	log.Printf("gRPC Stream prices: %v", req.Symbols)
-	
+
 	// TODO: Implement actual streaming
 	// For now, return a single update
 	for _, symbol := range req.Symbols {
@@ -140,95 +454,269 @@ func (s *Server) StreamPrices(req *pb.StreamRequest, stream pb.ExecutionService_
 			return err
 		}
 	}
-	
+
 	return nil
 }
 
-// GetOrderStatus retrieves order status
+// GetOrderStatus returns an order's live status like GET /api/v1/order_status:
+// from the order status cache when it holds the order (unless cache-bypass
+// metadata is set), otherwise refreshed from the exchange with changes written
+// back to trades. Orders the engine did not record are looked up on req.Exchange
+// directly.
 func (s *Server) GetOrderStatus(ctx context.Context, req *pb.OrderStatusRequest) (*pb.OrderStatusResponse, error) {
-	log.Printf("gRPC Order status: %s", req.OrderId)
+	if req.OrderId == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_id required")
+	}
+	if !cacheBypassRequested(ctx) {
+		if cached := s.cachedOrderStatuses(ctx, []string{req.OrderId})[req.OrderId]; cached != nil {
+			return trackedOrderProto(cached), nil
+		}
+	} else if s.orderStatusCacheEnabled() {
+		recordCacheLookup("order_status", "bypass")
+	}
+	key := ""
+	if req.Exchange != "" {
+		key = exchangeKey(normalizeExchangeAccount(req.Exchange, ""))
+		s.mu.RLock()
+		_, exists := s.exchanges[key]
+		s.mu.RUnlock()
+		if !exists {
+			return nil, status.Errorf(codes.FailedPrecondition, "exchange %s not configured", key)
+		}
+	}
+
+	if s.db != nil {
+		order, err := s.refreshOrderStatus(ctx, req.OrderId)
+		switch {
+		case err == nil:
+			return trackedOrderProto(order), nil
+		case !errors.Is(err, errOrderNotFound):
+			logEvent(ctx, "Failed to load order", "order_id", req.OrderId, "error", err)
+			return nil, status.Error(codes.Internal, "failed to load order")
+		case key == "":
+			return nil, status.Errorf(codes.NotFound, "order %s not found", req.OrderId)
+		}
+	} else if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "exchange required without a database")
+	}
 
-	// TODO: Implement actual order status tracking
-	// For now, return a placeholder
+	exchangeOrderID := req.ExchangeOrderId
+	if exchangeOrderID == "" {
+		exchangeOrderID = req.OrderId
+	}
+	s.mu.RLock()
+	exchange, exists := s.exchanges[key]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, status.Errorf(codes.FailedPrecondition, "exchange %s not configured", key)
+	}
+	orderStatus, err := fetchOrderStatus(ctx, exchange, strings.ToUpper(req.Symbol), exchangeOrderID)
+	if errors.Is(err, errUnknownOrder) {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.OrderId)
+	}
+	if errors.Is(err, errOrderSymbolRequired) {
+		return nil, status.Errorf(codes.InvalidArgument, "symbol required to look up orders on %s", key)
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to fetch order status", "order_id", req.OrderId, "exchange", key, "error", err)
+		return nil, status.Errorf(codes.Unavailable, "exchange call failed: %v", err)
+	}
+	exchangeName, account := splitExchangeKey(key)
+	return trackedOrderProto(&trackedOrder{
+		OrderID:         req.OrderId,
+		ExchangeOrderID: exchangeOrderID,
+		Exchange:        exchangeName,
+		Account:         account,
+		Symbol:          strings.ToUpper(req.Symbol),
+		Status:          orderStatus.Status,
+		FilledQty:       orderStatus.FilledQty,
+		AveragePrice:    orderStatus.AveragePrice,
+		Fees:            orderStatus.Fees,
+		UpdatedAt:       orderStatus.UpdatedAt,
+		Source:          "exchange",
+	}), nil
+}
+
+func trackedOrderProto(order *trackedOrder) *pb.OrderStatusResponse {
 	return &pb.OrderStatusResponse{
-		OrderId:       req.OrderId,
-		Status:        "FILLED",
-		FilledQuantity: 0.0,
-		AveragePrice:  0.0,
-		Fees:          0.0,
-		UpdatedAt:     timestamppb.Now(),
-	}, nil
+		OrderId:         order.OrderID,
+		Status:          order.Status,
+		FilledQuantity:  order.FilledQty,
+		AveragePrice:    order.AveragePrice,
+		Fees:            order.Fees,
+		UpdatedAt:       timestamppb.New(order.UpdatedAt),
+		ExchangeOrderId: order.ExchangeOrderID,
+		Symbol:          order.Symbol,
+		Exchange:        exchangeKey(order.Exchange, order.Account),
+		Source:          order.Source,
+		RefreshError:    order.RefreshError,
+	}
+}
+
+// GetOpenOrders lists the orders recorded in trades that are not yet final
+func (s *Server) GetOpenOrders(ctx context.Context, req *pb.OpenOrdersRequest) (*pb.OpenOrdersResponse, error) {
+	var exchangeName, account string
+	if req.Exchange != "" {
+		exchangeName, account = normalizeExchangeAccount(req.Exchange, "")
+		key := exchangeKey(exchangeName, account)
+		s.mu.RLock()
+		_, exists := s.exchanges[key]
+		s.mu.RUnlock()
+		if !exists {
+			return nil, status.Errorf(codes.FailedPrecondition, "exchange %s not configured", key)
+		}
+	}
+	if !s.dbAvailable() {
+		return nil, status.Error(codes.Unavailable, "database not available")
+	}
+
+	orders, err := s.loadOpenOrders(ctx, exchangeName, account, req.Symbol)
+	if err != nil {
+		logEvent(ctx, "Failed to load open orders", "exchange", req.Exchange, "symbol", req.Symbol, "error", err)
+		return nil, status.Error(codes.Internal, "failed to load open orders")
+	}
+	resp := &pb.OpenOrdersResponse{Orders: make([]*pb.Order, len(orders))}
+	for i, order := range orders {
+		resp.Orders[i] = orderRecordProto(order)
+	}
+	return resp, nil
+}
+
+// GetOrder returns an order's full record, like GET /api/v1/orders/{id}
+func (s *Server) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
+	if req.OrderId == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_id required")
+	}
+	if !s.dbAvailable() {
+		return nil, status.Error(codes.Unavailable, "database not available")
+	}
+
+	order, err := s.loadOrder(ctx, req.OrderId, req.Refresh)
+	if errors.Is(err, errOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.OrderId)
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to load order", "order_id", req.OrderId, "error", err)
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+
+	return orderRecordProto(order), nil
 }
 
-// GetBalance retrieves account balance
+// ListOrders pages through recorded orders newest first, like GET /api/v1/orders
+func (s *Server) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	filter := orderListFilter{
+		StrategyName: req.StrategyName,
+		Symbol:       req.Symbol,
+		Side:         req.Side,
+		Status:       req.Status,
+		Exchange:     req.Exchange,
+		Limit:        int(req.Limit),
+	}
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = 50
+	case filter.Limit < 1:
+		filter.Limit = 1
+	case filter.Limit > maxPageSize:
+		filter.Limit = maxPageSize
+	}
+	if req.From != nil {
+		filter.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		filter.To = req.To.AsTime()
+	}
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		filter.Cursor = &cursor
+	}
+	if !s.dbAvailable() {
+		return nil, status.Error(codes.Unavailable, "database not available")
+	}
+
+	orders, nextCursor, err := s.listOrders(ctx, filter)
+	if err != nil {
+		logEvent(ctx, "Failed to list orders", "error", err)
+		return nil, status.Error(codes.Internal, "failed to list orders")
+	}
+	resp := &pb.ListOrdersResponse{Orders: make([]*pb.Order, len(orders)), NextCursor: nextCursor}
+	for i, order := range orders {
+		resp.Orders[i] = orderRecordProto(order)
+	}
+	return resp, nil
+}
+
+func orderRecordProto(order *orderRecord) *pb.Order {
+	resp := &pb.Order{
+		OrderId:         order.OrderID,
+		ExchangeOrderId: order.ExchangeOrderID,
+		StrategyName:    order.StrategyName,
+		Symbol:          order.Symbol,
+		Side:            order.Side,
+		Quantity:        order.Quantity,
+		Price:           order.Price,
+		Status:          order.Status,
+		FilledQuantity:  order.FilledQty,
+		AveragePrice:    order.AveragePrice,
+		Fees:            order.Fees,
+		Exchange:        exchangeKey(order.Exchange, order.Account),
+		AccountType:     order.AccountType,
+		OrderType:       order.OrderType,
+		Timestamp:       timestamppb.New(order.Timestamp),
+		UpdatedAt:       timestamppb.New(order.UpdatedAt),
+		Source:          order.Source,
+		RefreshError:    order.RefreshError,
+	}
+	if order.ExecutedAt != nil {
+		resp.ExecutedAt = timestamppb.New(*order.ExecutedAt)
+	}
+	return resp
+}
+
+// GetBalance retrieves account balance; GET /api/v1/balance/{exchange} is served
+// by it too
 func (s *Server) GetBalance(ctx context.Context, req *pb.BalanceRequest) (*pb.BalanceResponse, error) {
+	if req.MinValueUsd < 0 || math.IsNaN(req.MinValueUsd) || math.IsInf(req.MinValueUsd, 0) {
+		return nil, status.Error(codes.InvalidArgument, "min_value_usd must be a non-negative number")
+	}
 	exchange := req.Exchange
 	if exchange == "" {
 		exchange = "binance"
 	}
+	exchange, account := normalizeExchangeAccount(exchange, req.Account)
 
-	log.Printf("gRPC Balance: %s", exchange)
-
-	s.mu.RLock()
-	exchangeClient, exists := s.exchanges[exchange]
-	s.mu.RUnlock()
+	log.Printf("gRPC Balance: %s", exchangeKey(exchange, account))
 
-	if !exists {
-		return nil, fmt.Errorf("exchange %s not configured", exchange)
+	balance, accounts, cached, err := s.fetchAccountBalance(ctx, exchange, account, req.Force)
+	if errors.Is(err, errExchangeNotConfigured) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Exchange %s not configured", exchangeKey(exchange, account))
 	}
-
-	balance, err := exchangeClient.GetBalance()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get balance: %w", err)
 	}
 
-	// Convert to proto format
-	balances := make(map[string]*pb.AssetBalance)
-	for asset, bal := range balance.Balances {
-		balances[asset] = &pb.AssetBalance{
-			Asset:    bal.Asset,
-			Free:     bal.Free,
-			Locked:   bal.Locked,
-			Total:    bal.Total,
-			ValueUsd: bal.ValueUSD,
-		}
-	}
-
-	return &pb.BalanceResponse{
-		Exchange:      exchange,
-		Balances:      balances,
-		TotalValueUsd: balance.TotalValueUSD,
-		Timestamp:     timestamppb.New(balance.Timestamp),
-	}, nil
-}
-
-// logOrderToDatabase logs order to PostgreSQL
-func (s *Server) logOrderToDatabase(req *pb.OrderRequest, result *OrderResult) {
-	query := `
-		INSERT INTO trades
-		(order_id, strategy_name, symbol, side, quantity, price, executed_price,
-		 status, exchange, timestamp, executed_at, fees)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-	`
-
-	_, err := s.db.Exec(query,
-		req.OrderId,
-		req.StrategyName,
-		req.Symbol,
-		req.Side,
-		req.Quantity,
-		req.Price,
-		result.ExecutedPrice,
-		result.Status,
-		req.Exchange,
-		time.Now(),
-		result.Timestamp,
-		result.Fees,
-	)
+	filterBalance(balance, req.Assets, req.MinValueUsd)
+	resp := balanceResponseProto(exchange, balance)
+	resp.Accounts = accounts
+	resp.Cached = cached
+	return resp, nil
+}
 
+// logOrderToDatabase logs order to PostgreSQL with its fill booked, journaling
+// the row for retry when Postgres cannot take it now
+func (s *Server) logOrderToDatabase(ctx context.Context, req *pb.OrderRequest, result *OrderResult) {
+	trade := newTradeRecord(req, result)
+	dbCtx, cancel := s.dbContext(ctx)
+	_, err := s.recordOrderFill(dbCtx, OrderFill{Trade: trade, Mode: fillInsert})
+	cancel()
 	if err != nil {
-		log.Printf("Failed to log order to database: %v", err)
-	} else {
-		log.Printf("✓ Order logged to database: %s", req.OrderId)
+		logEvent(ctx, "Failed to log order to database", "order_id", req.OrderId, "error", err)
+		s.journalOrder(ctx, trade, err)
+		return
 	}
+	logEvent(ctx, "Order logged to database", "order_id", req.OrderId)
 }
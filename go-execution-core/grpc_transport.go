@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// grpcTransportOptions applies the GRPC_KEEPALIVE_*, GRPC_MAX_* settings
+func (s *Server) grpcTransportOptions() []grpc.ServerOption {
+	cfg := s.config
+	maxStreams := uint32(math.MaxUint32)
+	if cfg.GRPCMaxConcurrentStreams > 0 {
+		maxStreams = uint32(cfg.GRPCMaxConcurrentStreams)
+	}
+	options := []grpc.ServerOption{
+		// Zero idle and age values are grpc's "infinity"
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  cfg.GRPCKeepaliveTime,
+			Timeout:               cfg.GRPCKeepaliveTimeout,
+			MaxConnectionIdle:     cfg.GRPCMaxConnectionIdle,
+			MaxConnectionAge:      cfg.GRPCMaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.GRPCMaxConnectionAgeGrace,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.GRPCKeepaliveMinTime,
+			PermitWithoutStream: cfg.GRPCKeepalivePermitNoCalls,
+		}),
+		grpc.MaxConcurrentStreams(maxStreams),
+	}
+	// Unset caps keep grpc's defaults (4MB received, unlimited sent)
+	if cfg.GRPCMaxRecvMsgBytes > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(cfg.GRPCMaxRecvMsgBytes))
+	}
+	if cfg.GRPCMaxSendMsgBytes > 0 {
+		options = append(options, grpc.MaxSendMsgSize(cfg.GRPCMaxSendMsgBytes))
+	}
+	return options
+}
+
+// HTTP/2 frame details the connection metrics look for (RFC 9113)
+const (
+	http2ClientPrefaceLen   = 24 // "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2FramePing          = 0x6
+	http2FrameGoAway        = 0x7
+	http2FlagAck            = 0x1
+	http2ErrEnhanceYourCalm = 0xb // what grpc sends clients that ping too often
+)
+
+// http2FrameScanner follows the frames in one direction of a plaintext HTTP/2
+// connection and reports each with up to its first 8 payload bytes, enough for
+// PING data and the GOAWAY error code
+type http2FrameScanner struct {
+	skip     int // connection preface bytes still to pass over
+	header   [9]byte
+	headerN  int
+	left     int // payload bytes of the current frame still to come
+	payload  [8]byte
+	payloadN int
+	onFrame  func(frameType, flags byte, payload []byte)
+}
+
+func (sc *http2FrameScanner) scan(p []byte) {
+	for len(p) > 0 {
+		if sc.skip > 0 {
+			if len(p) <= sc.skip {
+				sc.skip -= len(p)
+				return
+			}
+			p = p[sc.skip:]
+			sc.skip = 0
+		}
+		if sc.headerN < len(sc.header) {
+			n := copy(sc.header[sc.headerN:], p)
+			sc.headerN += n
+			p = p[n:]
+			if sc.headerN < len(sc.header) {
+				return
+			}
+			sc.left = int(sc.header[0])<<16 | int(sc.header[1])<<8 | int(sc.header[2])
+			sc.payloadN = 0
+		}
+		n := sc.left
+		if n > len(p) {
+			n = len(p)
+		}
+		sc.payloadN += copy(sc.payload[sc.payloadN:], p[:n])
+		sc.left -= n
+		p = p[n:]
+		if sc.left == 0 {
+			sc.onFrame(sc.header[3], sc.header[4], sc.payload[:sc.payloadN])
+			sc.headerN = 0
+		}
+	}
+}
+
+// grpcConnListener counts open gRPC connections and the keepalive traffic on
+// them: PINGs each way and GOAWAYs for clients breaking GRPC_KEEPALIVE_MIN_TIME.
+// The scan needs plaintext HTTP/2, which is how the gRPC port is served.
+type grpcConnListener struct {
+	net.Listener
+}
+
+func (l grpcConnListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	grpcConnections.Inc()
+	c := &grpcConn{Conn: conn}
+	c.in = http2FrameScanner{skip: http2ClientPrefaceLen, onFrame: func(frameType, flags byte, _ []byte) {
+		if frameType == http2FramePing && flags&http2FlagAck == 0 {
+			grpcPings.WithLabelValues("received").Inc()
+		}
+	}}
+	c.out = http2FrameScanner{onFrame: func(frameType, flags byte, payload []byte) {
+		switch {
+		case frameType == http2FramePing && flags&http2FlagAck == 0:
+			grpcPings.WithLabelValues("sent").Inc()
+		case frameType == http2FrameGoAway && len(payload) == 8 && payload[7] == http2ErrEnhanceYourCalm &&
+			payload[4]|payload[5]|payload[6] == 0:
+			grpcKeepaliveViolations.Inc()
+		}
+	}}
+	return c, nil
+}
+
+type grpcConn struct {
+	net.Conn
+	in  http2FrameScanner // used only by the transport's reader goroutine
+	out http2FrameScanner
+	// Writes normally come from one goroutine, but the transport does not promise it
+	outMu     sync.Mutex
+	closeOnce sync.Once
+}
+
+func (c *grpcConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.scan(p[:n])
+	return n, err
+}
+
+func (c *grpcConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.outMu.Lock()
+	c.out.scan(p[:n])
+	c.outMu.Unlock()
+	return n, err
+}
+
+func (c *grpcConn) Close() error {
+	c.closeOnce.Do(grpcConnections.Dec)
+	return c.Conn.Close()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthProbeTimeout bounds one exchange ping, so a hung exchange reads as down
+// rather than holding up the next round
+const healthProbeTimeout = 10 * time.Second
+
+// ExchangeHealth is the latest probe result for one exchange
+type ExchangeHealth struct {
+	Up                  bool
+	LastCheck           time.Time
+	LastSuccess         time.Time
+	FailingSince        time.Time // zero while healthy
+	ConsecutiveFailures int
+	Latency             time.Duration
+	LastError           string
+}
+
+// HealthMonitor pings every registered exchange on a fixed interval
+type HealthMonitor struct {
+	interval time.Duration
+	grace    time.Duration // how long probes may fail before orders are refused
+	status   map[string]*ExchangeHealth
+	mu       sync.RWMutex
+}
+
+func NewHealthMonitor(interval, grace time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		interval: interval,
+		grace:    grace,
+		status:   make(map[string]*ExchangeHealth),
+	}
+}
+
+// startHealthProbes runs exchange probes until the process exits
+func (s *Server) startHealthProbes() {
+	s.probeExchanges()
+
+	ticker := time.NewTicker(s.health.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.probeExchanges()
+	}
+}
+
+// probeExchanges pings all exchanges concurrently and drops results for removed ones
+func (s *Server) probeExchanges() {
+	s.mu.RLock()
+	snapshot := make(map[string]Exchange, len(s.exchanges))
+	for name, exchange := range s.exchanges {
+		snapshot[name] = exchange
+	}
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, exchange := range snapshot {
+		wg.Add(1)
+		go func(name string, exchange Exchange) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			err := exchange.Ping(ctx)
+			s.health.record(name, time.Since(start), err)
+		}(name, exchange)
+	}
+	wg.Wait()
+
+	s.health.prune(snapshot)
+}
+
+// record stores a probe result, logging transitions between up and down
+func (hm *HealthMonitor) record(name string, latency time.Duration, err error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	h, exists := hm.status[name]
+	if !exists {
+		h = &ExchangeHealth{}
+		hm.status[name] = h
+	}
+
+	now := time.Now()
+	wasUp := h.Up || !exists
+	h.LastCheck = now
+	h.Latency = latency
+
+	if err == nil {
+		if !h.Up && exists {
+			log.Printf("✓ Exchange %s healthy again after %d failed probes", name, h.ConsecutiveFailures)
+		}
+		h.Up = true
+		h.LastSuccess = now
+		h.FailingSince = time.Time{}
+		h.ConsecutiveFailures = 0
+		h.LastError = ""
+		return
+	}
+
+	if wasUp {
+		log.Printf("Exchange %s health probe failed: %v", name, err)
+	}
+	h.Up = false
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	if h.FailingSince.IsZero() {
+		h.FailingSince = now
+	}
+}
+
+// prune forgets exchanges that are no longer registered
+func (hm *HealthMonitor) prune(registered map[string]Exchange) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	for name := range hm.status {
+		if _, exists := registered[name]; !exists {
+			delete(hm.status, name)
+		}
+	}
+}
+
+// Snapshot returns a copy of every exchange's health, keyed by exchange name
+func (hm *HealthMonitor) Snapshot() map[string]ExchangeHealth {
+	if hm == nil {
+		return map[string]ExchangeHealth{}
+	}
+
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	out := make(map[string]ExchangeHealth, len(hm.status))
+	for name, h := range hm.status {
+		out[name] = *h
+	}
+	return out
+}
+
+// errExchangeUnhealthy is wrapped by CheckOrderable's errors
+var errExchangeUnhealthy = errors.New("exchange unhealthy")
+
+// CheckOrderable returns an error when an exchange has been failing probes for longer
+// than the grace period. Exchanges that have not been probed yet are allowed.
+func (hm *HealthMonitor) CheckOrderable(name string) error {
+	if hm == nil {
+		return nil
+	}
+
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	h, exists := hm.status[name]
+	if !exists || h.Up || h.FailingSince.IsZero() {
+		return nil
+	}
+	if down := time.Since(h.FailingSince); down > hm.grace {
+		return fmt.Errorf("%w: %s has failed health probes for %s (%d consecutive failures, last error: %s)",
+			errExchangeUnhealthy, name, down.Round(time.Second), h.ConsecutiveFailures, h.LastError)
+	}
+	return nil
+}
+
+// exchangeHealthJSON renders health for the /health endpoint
+func exchangeHealthJSON(snapshot map[string]ExchangeHealth) map[string]interface{} {
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]interface{}, len(snapshot))
+	for _, name := range names {
+		h := snapshot[name]
+		entry := map[string]interface{}{
+			"status":               "up",
+			"consecutive_failures": h.ConsecutiveFailures,
+			"latency_ms":           h.Latency.Milliseconds(),
+			"last_check":           h.LastCheck.Format(time.RFC3339),
+		}
+		if !h.Up {
+			entry["status"] = "down"
+			entry["error"] = h.LastError
+		}
+		if !h.LastSuccess.IsZero() {
+			entry["last_success"] = h.LastSuccess.Format(time.RFC3339)
+		}
+		out[name] = entry
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// routeTemplates spell out the paths served under each subtree pattern ("/api/v1/orders/")
+// so metrics are labelled with a route instead of a raw path. A {param} segment matches
+// any value; other segments must match exactly, and the first matching template wins.
+// A path under a subtree that no template matches is labelled with the subtree pattern.
+var routeTemplates = []string{
+	"/api/v1/orders/{id}",
+	"/api/v1/strategies/{name}",
+	"/api/v1/strategies/{name}/performance",
+	"/api/v1/strategies/{name}/performance/timeseries",
+	"/api/v1/strategies/{name}/clone",
+	"/api/v1/strategies/{name}/recompute",
+	"/api/v1/strategies/{name}/versions",
+	"/api/v1/strategies/{name}/rollback",
+	"/api/v1/strategies/{name}/restore",
+	"/api/v1/market/{exchange}/tickers",
+	"/api/v1/market/{exchange}/{symbol}",
+	"/api/v1/orderbook/{symbol}/history",
+	"/api/v1/orderbook/{exchange}/{symbol}",
+	"/api/v1/klines/{exchange}/{symbol}",
+	"/api/v1/balance/{exchange}",
+	"/api/v1/exchanges/{name}",
+	"/api/v1/portfolio/positions/{symbol}/close",
+	"/api/v1/portfolio/risk/events/{id}/resolve",
+	"/api/v1/export/{id}",
+}
+
+// streamingRoutes hold a connection open for as long as the client listens; their
+// duration says nothing about handler latency, so they are not timed
+var streamingRoutes = map[string]bool{
+	"/api/v1/ws/market":    true,
+	"/api/v1/ws/orders":    true,
+	"/api/v1/stream/fills": true,
+}
+
+// normalizeRoute returns the route label of a request: the mux pattern that
+// serves it, expanded through routeTemplates for subtree patterns
+func normalizeRoute(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	if !strings.HasSuffix(pattern, "/") {
+		return pattern
+	}
+	segments := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	for _, template := range routeTemplates {
+		if strings.HasPrefix(template, pattern) && matchRouteTemplate(template, segments) {
+			return template
+		}
+	}
+	return pattern
+}
+
+func matchRouteTemplate(template string, segments []string) bool {
+	parts := strings.Split(template, "/")
+	if len(parts) != len(segments) {
+		return false
+	}
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// statusClass reduces a status code to its class ("2xx", "4xx", ...)
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// routeMetrics records the latency and response size of every request under its
+// normalized route, and logs requests slower than SLOW_REQUEST_THRESHOLD. It runs
+// inside requestLogging so the slow-request line carries the request ID.
+func (s *Server) routeMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		elapsed := time.Since(start)
+
+		route := normalizeRoute(mux, r)
+		if streamingRoutes[route] {
+			return
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		class := statusClass(status)
+		httpRequestDuration.WithLabelValues(route, r.Method, class).Observe(elapsed.Seconds())
+		httpResponseSize.WithLabelValues(route, r.Method, class).Observe(float64(recorder.bytes))
+
+		if threshold := s.config.SlowRequestThreshold; threshold > 0 && elapsed >= threshold {
+			logEvent(r.Context(), "Slow request",
+				"method", r.Method,
+				"route", route,
+				"path", r.URL.Path,
+				"status", status,
+				"duration_ms", float64(elapsed.Microseconds())/1000,
+				"threshold_ms", threshold.Milliseconds(),
+			)
+		}
+	})
+}
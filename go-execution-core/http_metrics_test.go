@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	noop := func(http.ResponseWriter, *http.Request) {}
+	for _, pattern := range []string{
+		"/api/v1/orders", "/api/v1/orders/", "/api/v1/orders/batch",
+		"/api/v1/strategies", "/api/v1/strategies/", "/api/v1/market/",
+	} {
+		mux.HandleFunc(pattern, noop)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/orders", "/api/v1/orders"},
+		{"/api/v1/orders/abc123", "/api/v1/orders/{id}"},
+		{"/api/v1/orders/5f3c9a1e-77d2-4c1b-9b0e-2e6f1c0d9a41", "/api/v1/orders/{id}"},
+		{"/api/v1/orders/abc123/", "/api/v1/orders/{id}"},
+		{"/api/v1/orders/batch", "/api/v1/orders/batch"},
+		{"/api/v1/orders/abc123/extra", "/api/v1/orders/"},
+		{"/api/v1/orders/", "/api/v1/orders/"},
+		{"/api/v1/strategies/foo", "/api/v1/strategies/{name}"},
+		{"/api/v1/strategies/foo/performance", "/api/v1/strategies/{name}/performance"},
+		{"/api/v1/strategies/bar/performance", "/api/v1/strategies/{name}/performance"},
+		{"/api/v1/strategies/foo/performance/timeseries", "/api/v1/strategies/{name}/performance/timeseries"},
+		{"/api/v1/strategies/foo/clone", "/api/v1/strategies/{name}/clone"},
+		{"/api/v1/strategies/foo/unknown", "/api/v1/strategies/"},
+		{"/api/v1/market/binance/BTCUSDT", "/api/v1/market/{exchange}/{symbol}"},
+		{"/api/v1/market/binance/tickers", "/api/v1/market/{exchange}/tickers"},
+		{"/api/v1/nope", "unmatched"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if got := normalizeRoute(mux, r); got != tt.want {
+			t.Errorf("normalizeRoute(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestRouteLabelsOnMetrics requests paths with IDs and names through the full
+// handler chain and checks /metrics carries the template, not the raw path
+func TestRouteLabelsOnMetrics(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	tests := []struct {
+		path  string
+		route string
+	}{
+		{"/api/v1/orders/abc123", "/api/v1/orders/{id}"},
+		{"/api/v1/orders/def456", "/api/v1/orders/{id}"},
+		{"/api/v1/strategies/foo/performance", "/api/v1/strategies/{name}/performance"},
+		{"/api/v1/strategies/bar/performance", "/api/v1/strategies/{name}/performance"},
+	}
+	before := map[string]float64{}
+	for _, tt := range tests {
+		before[tt.route], _ = scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count",
+			"route", tt.route, "method", "GET", "status_class", "4xx")
+	}
+	for _, tt := range tests {
+		if code, body := doJSON(t, srv, http.MethodGet, tt.path, nil); code != http.StatusNotFound {
+			t.Errorf("%s: status %d: %v", tt.path, code, body)
+		}
+	}
+	for route, count := range before {
+		got, _ := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count",
+			"route", route, "method", "GET", "status_class", "4xx")
+		if got-count != 2 {
+			t.Errorf("%s: %g requests recorded, want 2", route, got-count)
+		}
+	}
+	for _, tt := range tests {
+		if _, ok := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", "route", tt.path); ok {
+			t.Errorf("raw path %s used as a route label", tt.path)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pb "execution-engine/pb"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key" // idempotency-key metadata over gRPC
+	replayedHeader       = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+
+	// idempotencyTTL is how long a processed key replays its original response
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds how long a key stays claimed if the engine dies
+	// mid-submission; until then retries get 409 instead of a second order
+	idempotencyPendingTTL = 5 * time.Minute
+	// idempotencyPollInterval is how often a duplicate checks for the result of
+	// the submission another instance claimed
+	idempotencyPollInterval = 50 * time.Millisecond
+)
+
+// idempotentResponse is what Redis holds per key: a pending claim (Status 0) or
+// the response that was sent
+type idempotentResponse struct {
+	Fingerprint string                 `json:"fingerprint"`
+	Status      int                    `json:"status"`
+	Body        map[string]interface{} `json:"body,omitempty"`
+}
+
+// idempotencyLocks serializes requests sharing a key within this process, so
+// concurrent duplicates wait for the first instead of racing it to the exchange.
+// It also remembers recent responses, which covers Redis outages and the window
+// before the async trades insert lands.
+type idempotencyLocks struct {
+	mu        sync.Mutex
+	locks     map[string]*idempotencyLock
+	recent    map[string]recentResponse
+	lastPrune time.Time
+}
+
+type recentResponse struct {
+	resp    *idempotentResponse
+	expires time.Time
+}
+
+type idempotencyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock blocks until key is free and returns the unlock func
+func (l *idempotencyLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*idempotencyLock)
+	}
+	entry, exists := l.locks[key]
+	if !exists {
+		entry = &idempotencyLock{}
+		l.locks[key] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		l.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *idempotencyLocks) recall(key string) *idempotentResponse {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, exists := l.recent[key]; exists && time.Now().Before(entry.expires) {
+		return entry.resp
+	}
+	return nil
+}
+
+func (l *idempotencyLocks) remember(key string, resp *idempotentResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.recent == nil {
+		l.recent = make(map[string]recentResponse)
+	}
+	now := time.Now()
+	if now.Sub(l.lastPrune) > time.Minute {
+		for k, entry := range l.recent {
+			if now.After(entry.expires) {
+				delete(l.recent, k)
+			}
+		}
+		l.lastPrune = now
+	}
+	l.recent[key] = recentResponse{resp: resp, expires: now.Add(idempotencyTTL)}
+}
+
+// idempotencyMetadata carries the Idempotency-Key header to SubmitOrder
+var idempotencyMetadata = strings.ToLower(idempotencyHeader)
+
+// idempotencyKey returns the Redis key for an order submission: the
+// idempotency-key metadata, else the order_id, scoped to the caller. Empty when
+// the call carries neither.
+func idempotencyKey(ctx context.Context, orderID string) (string, error) {
+	key := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(idempotencyMetadata); len(values) > 0 {
+			key = values[0]
+		}
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return "", status.Errorf(codes.InvalidArgument, "%s must be at most %d characters",
+			idempotencyHeader, maxIdempotencyKeyLen)
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		key = orderID
+	}
+	if key == "" {
+		return "", nil
+	}
+	caller := callerID(ctx)
+	if caller == "" {
+		caller = "anonymous"
+	}
+	return "idempotency:orders:" + caller + ":" + key, nil
+}
+
+// orderSubmission is what an order's fingerprint covers: the POST /api/v1/orders
+// body after defaults and normalization. Keys stored before the endpoint moved to
+// SubmitOrder were fingerprinted over the same JSON.
+type orderSubmission struct {
+	OrderID        string  `json:"order_id"`
+	StrategyName   string  `json:"strategy_name"`
+	Symbol         string  `json:"symbol"`
+	Side           string  `json:"side"`
+	Quantity       float64 `json:"quantity"`
+	Price          float64 `json:"price"`
+	OrderType      string  `json:"order_type"`
+	Exchange       string  `json:"exchange"`
+	ReduceOnly     bool    `json:"reduce_only"`
+	PositionSide   string  `json:"position_side"`
+	AccountType    string  `json:"account_type"`
+	SideEffectType string  `json:"side_effect_type"`
+	Account        string  `json:"account"`
+}
+
+func orderSubmissionFromProto(req *pb.OrderRequest) orderSubmission {
+	return orderSubmission{
+		OrderID:        req.OrderId,
+		StrategyName:   req.StrategyName,
+		Symbol:         req.Symbol,
+		Side:           req.Side,
+		Quantity:       req.Quantity,
+		Price:          req.Price,
+		OrderType:      req.OrderType,
+		Exchange:       req.Exchange,
+		ReduceOnly:     req.ReduceOnly,
+		PositionSide:   req.PositionSide,
+		AccountType:    req.AccountType,
+		SideEffectType: req.SideEffectType,
+		Account:        req.Account,
+	}
+}
+
+// requestFingerprint identifies a request body so a key reused for a different
+// order is rejected instead of replaying the wrong result
+func requestFingerprint(req interface{}) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey returns the response to send instead of submitting: the
+// stored result of an earlier request, or a conflict. nil means the key is now
+// claimed and the caller should submit. The caller holds the in-process lock.
+func (s *Server) claimIdempotencyKey(ctx context.Context, key, orderID, fingerprint string) *idempotentResponse {
+	if stored := s.idempotency.recall(key); stored != nil {
+		return storedIdempotentResponse(stored, fingerprint)
+	}
+
+	redisUp := s.redis != nil
+	if redisUp {
+		data, err := s.redis.Get(ctx, key).Bytes()
+		switch {
+		case err == nil:
+			var stored idempotentResponse
+			if err := json.Unmarshal(data, &stored); err == nil {
+				recordCacheLookup("idempotency", "hit")
+				if replay := storedIdempotentResponse(&stored, fingerprint); replay.Status != http.StatusConflict {
+					return replay
+				}
+				// Claimed by another instance, or by this one before a restart
+				return s.awaitIdempotentResponse(ctx, key, fingerprint)
+			}
+			recordCacheLookup("idempotency", "miss")
+		case errors.Is(err, redis.Nil):
+			recordCacheLookup("idempotency", "miss")
+		default:
+			recordCacheLookup("idempotency", "error")
+			logEvent(ctx, "Idempotency store unavailable, checking trades only", "error", err)
+			redisUp = false
+		}
+	}
+
+	// Redis may have been flushed; an order already in the trades table was placed
+	if orderID != "" && s.db != nil {
+		if body, err := s.recordedOrderResponse(ctx, orderID); err == nil {
+			return &idempotentResponse{Status: http.StatusOK, Body: body}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			logEvent(ctx, "Failed to check trades for duplicate order", "order_id", orderID, "error", err)
+		}
+	}
+
+	if redisUp {
+		pending, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+		claimed, err := s.redis.SetNX(ctx, key, pending, idempotencyPendingTTL).Result()
+		if err != nil {
+			logEvent(ctx, "Failed to claim idempotency key", "error", err)
+		} else if !claimed {
+			// Another engine instance won the race
+			return s.awaitIdempotentResponse(ctx, key, fingerprint)
+		}
+	}
+	return nil
+}
+
+// awaitIdempotentResponse polls Redis for up to ORDER_DUPLICATE_WAIT while another
+// instance submits the order claimed under key, and returns its response. A claim
+// that is still pending, or gone without a response (the instance died), gets the
+// in-progress conflict and the client's next retry decides.
+func (s *Server) awaitIdempotentResponse(ctx context.Context, key, fingerprint string) *idempotentResponse {
+	deadline := time.Now().Add(s.config.OrderDuplicateWait)
+	ticker := time.NewTicker(idempotencyPollInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return inProgressResponse()
+		case <-ticker.C:
+		}
+		data, err := s.redis.Get(ctx, key).Bytes()
+		var stored idempotentResponse
+		if err == nil {
+			err = json.Unmarshal(data, &stored)
+		}
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				logEvent(ctx, "Failed to read idempotency key", "error", err)
+			}
+			duplicateOrderWaits.WithLabelValues("abandoned").Inc()
+			return inProgressResponse()
+		}
+		if replay := storedIdempotentResponse(&stored, fingerprint); replay.Status != http.StatusConflict {
+			duplicateOrderWaits.WithLabelValues("replayed").Inc()
+			return replay
+		}
+	}
+	if s.config.OrderDuplicateWait > 0 {
+		duplicateOrderWaits.WithLabelValues("timeout").Inc()
+	}
+	return inProgressResponse()
+}
+
+func storedIdempotentResponse(stored *idempotentResponse, fingerprint string) *idempotentResponse {
+	if stored.Fingerprint != "" && stored.Fingerprint != fingerprint {
+		return &idempotentResponse{
+			Status: http.StatusUnprocessableEntity,
+			Body: map[string]interface{}{
+				"success": false,
+				"error":   "Idempotency key was already used for a different order",
+			},
+		}
+	}
+	if stored.Status == 0 {
+		return inProgressResponse()
+	}
+	return stored
+}
+
+func inProgressResponse() *idempotentResponse {
+	return &idempotentResponse{
+		Status: http.StatusConflict,
+		Body: map[string]interface{}{
+			"success": false,
+			"error":   "An order with this idempotency key is still being processed",
+		},
+	}
+}
+
+// recordedOrderResponse rebuilds the submission response from the trades table
+func (s *Server) recordedOrderResponse(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var exchangeOrderID, status string
+	var executedPrice, executedQty, fees float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(exchange_order_id, ''), status, COALESCE(executed_price, 0),
+		       COALESCE(filled_quantity, 0), COALESCE(fees, 0)
+		FROM trades
+		WHERE order_id = $1
+	`, orderID).Scan(&exchangeOrderID, &status, &executedPrice, &executedQty, &fees)
+	if err != nil {
+		return nil, err
+	}
+	return orderResponseJSON(&pb.OrderResponse{
+		Success:          true,
+		OrderId:          orderID,
+		ExchangeOrderId:  exchangeOrderID,
+		Status:           status,
+		ExecutedPrice:    executedPrice,
+		ExecutedQuantity: executedQty,
+		Fees:             fees,
+	}), nil
+}
+
+// orderResponseJSON is the POST /api/v1/orders body for a submission, which is
+// also what idempotency keys store
+func orderResponseJSON(resp *pb.OrderResponse) map[string]interface{} {
+	if !resp.Success {
+		body := map[string]interface{}{
+			"success": false,
+			"error":   resp.ErrorMessage,
+		}
+		if resp.RejectReason != "" {
+			body["reject_reason"] = resp.RejectReason
+		}
+		return body
+	}
+	return map[string]interface{}{
+		"success":           true,
+		"order_id":          resp.OrderId,
+		"exchange_order_id": resp.ExchangeOrderId,
+		"status":            resp.Status,
+		"executed_price":    resp.ExecutedPrice,
+		"executed_quantity": resp.ExecutedQuantity,
+		"fees":              resp.Fees,
+	}
+}
+
+// replayedOrderResponse answers a duplicate submission from what the key holds:
+// the stored response, ABORTED while the first is still in flight, or
+// ALREADY_EXISTS when the key belongs to a different order
+func replayedOrderResponse(replay *idempotentResponse) (*pb.OrderResponse, error) {
+	message, _ := replay.Body["error"].(string)
+	switch replay.Status {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return nil, status.Error(codes.Aborted, message)
+	default:
+		return nil, status.Error(codes.AlreadyExists, message)
+	}
+	resp := &pb.OrderResponse{Replayed: true, ErrorMessage: message, Status: "FAILED"}
+	resp.Success, _ = replay.Body["success"].(bool)
+	if resp.Success {
+		resp.OrderId, _ = replay.Body["order_id"].(string)
+		resp.ExchangeOrderId, _ = replay.Body["exchange_order_id"].(string)
+		resp.Status, _ = replay.Body["status"].(string)
+		resp.ExecutedPrice, _ = replay.Body["executed_price"].(float64)
+		resp.ExecutedQuantity, _ = replay.Body["executed_quantity"].(float64)
+		resp.Fees, _ = replay.Body["fees"].(float64)
+	}
+	return resp, nil
+}
+
+// saveIdempotentResponse records the response for key so retries replay it
+func (s *Server) saveIdempotentResponse(ctx context.Context, key, fingerprint string, status int, body map[string]interface{}) {
+	resp := &idempotentResponse{Fingerprint: fingerprint, Status: status, Body: body}
+	s.idempotency.remember(key, resp)
+	if s.redis == nil {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err == nil {
+		err = s.redis.Set(ctx, key, data, idempotencyTTL).Err()
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to save idempotent response", "error", err)
+	}
+}
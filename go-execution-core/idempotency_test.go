@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type submitResult struct {
+	code     int
+	replayed bool
+	body     map[string]interface{}
+}
+
+// submitWithKey posts an order to POST /api/v1/orders under an Idempotency-Key
+func submitWithKey(t *testing.T, srv *httptest.Server, key string, order map[string]interface{}) submitResult {
+	t.Helper()
+	raw, _ := json.Marshal(order)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/orders", bytes.NewReader(raw))
+	if err != nil {
+		t.Error(err)
+		return submitResult{}
+	}
+	req.Header.Set(idempotencyHeader, key)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Error(err)
+		return submitResult{}
+	}
+	defer resp.Body.Close()
+	result := submitResult{code: resp.StatusCode, replayed: resp.Header.Get(replayedHeader) == "true"}
+	json.NewDecoder(resp.Body).Decode(&result.body)
+	return result
+}
+
+// submitConcurrently sends every order at once, one goroutine each
+func submitConcurrently(t *testing.T, srvs []*httptest.Server, key string, orders []map[string]interface{}) []submitResult {
+	t.Helper()
+	results := make([]submitResult, len(orders))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range orders {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			results[i] = submitWithKey(t, srvs[i%len(srvs)], key, orders[i])
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return results
+}
+
+func testOrder(id string, quantity float64) map[string]interface{} {
+	return map[string]interface{}{"order_id": id, "strategy_name": "momentum", "symbol": "BTCUSDT",
+		"side": "BUY", "quantity": quantity, "exchange": "mock"}
+}
+
+func TestConcurrentSubmissionsSameIdempotencyKey(t *testing.T) {
+	s, mock := newTestServer(t)
+	// Long enough that the second request arrives while the first is at the exchange
+	mock.Latency = 200 * time.Millisecond
+	srv := serveTest(t, s)
+
+	order := testOrder("ord-1", 0.1)
+	results := submitConcurrently(t, []*httptest.Server{srv}, "retry-1", []map[string]interface{}{order, order})
+
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Fatalf("exchange received %d orders, want 1", got)
+	}
+	replays := 0
+	for i, r := range results {
+		if r.code != http.StatusOK || r.body["success"] != true {
+			t.Fatalf("request %d: status %d: %v", i, r.code, r.body)
+		}
+		if r.replayed {
+			replays++
+		}
+	}
+	if replays != 1 {
+		t.Errorf("%d responses marked %s, want 1", replays, replayedHeader)
+	}
+	if results[0].body["exchange_order_id"] != results[1].body["exchange_order_id"] {
+		t.Errorf("exchange_order_id %v and %v differ", results[0].body["exchange_order_id"], results[1].body["exchange_order_id"])
+	}
+
+	// A later retry replays as well
+	if r := submitWithKey(t, srv, "retry-1", order); !r.replayed || r.body["exchange_order_id"] != results[0].body["exchange_order_id"] {
+		t.Errorf("retry: %+v", r)
+	}
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Errorf("exchange received %d orders after the retry, want 1", got)
+	}
+}
+
+func TestConcurrentSubmissionsKeyReusedForDifferentOrder(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.Latency = 200 * time.Millisecond
+	srv := serveTest(t, s)
+
+	results := submitConcurrently(t, []*httptest.Server{srv}, "retry-1",
+		[]map[string]interface{}{testOrder("ord-1", 0.1), testOrder("ord-1", 5)})
+
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Fatalf("exchange received %d orders, want 1", got)
+	}
+	codes := map[int]int{}
+	for _, r := range results {
+		codes[r.code]++
+	}
+	if codes[http.StatusOK] != 1 || codes[http.StatusUnprocessableEntity] != 1 {
+		t.Errorf("statuses = %v, want one 200 and one 422", codes)
+	}
+}
+
+// twoInstances starts two engines sharing one Redis, as replicas behind a load
+// balancer; each has its own database and exchange mock
+func twoInstances(t *testing.T, duplicateWait time.Duration) (*miniredis.Miniredis, []*httptest.Server, []*MockExchange) {
+	t.Helper()
+	mr, client := newTestRedis(t)
+	var srvs []*httptest.Server
+	var mocks []*MockExchange
+	for i := 0; i < 2; i++ {
+		s, mock := newTestServer(t)
+		s.redis = client
+		s.config.OrderDuplicateWait = duplicateWait
+		srvs = append(srvs, serveTest(t, s))
+		mocks = append(mocks, mock)
+	}
+	return mr, srvs, mocks
+}
+
+func TestConcurrentSubmissionsAcrossInstances(t *testing.T) {
+	mr, srvs, mocks := twoInstances(t, 3*time.Second)
+	for _, mock := range mocks {
+		mock.Latency = 200 * time.Millisecond
+	}
+	waitsBefore, _ := scrapeMetric(t, srvs[0], "signalops_duplicate_order_waits_total", "result", "replayed")
+
+	order := testOrder("ord-1", 0.1)
+	results := submitConcurrently(t, srvs, "retry-1", []map[string]interface{}{order, order})
+
+	if got := mocks[0].CallCount("SubmitOrder") + mocks[1].CallCount("SubmitOrder"); got != 1 {
+		t.Fatalf("exchanges received %d orders, want 1", got)
+	}
+	replays := 0
+	for i, r := range results {
+		if r.code != http.StatusOK || r.body["success"] != true {
+			t.Fatalf("request %d: status %d: %v", i, r.code, r.body)
+		}
+		if r.replayed {
+			replays++
+		}
+	}
+	if replays != 1 {
+		t.Errorf("%d responses marked %s, want 1", replays, replayedHeader)
+	}
+	if results[0].body["exchange_order_id"] != results[1].body["exchange_order_id"] {
+		t.Errorf("exchange_order_id %v and %v differ", results[0].body["exchange_order_id"], results[1].body["exchange_order_id"])
+	}
+	if waits, _ := scrapeMetric(t, srvs[0], "signalops_duplicate_order_waits_total", "result", "replayed"); waits-waitsBefore != 1 {
+		t.Errorf("%v duplicate waits replayed, want 1", waits-waitsBefore)
+	}
+
+	// The result stays in Redis for a day for later retries on either instance
+	var claims []string
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "idempotency:") {
+			claims = append(claims, key)
+		}
+	}
+	if len(claims) != 1 {
+		t.Fatalf("idempotency keys %v, want one", claims)
+	}
+	if ttl := mr.TTL(claims[0]); ttl != idempotencyTTL {
+		t.Errorf("result TTL %v, want %v", ttl, idempotencyTTL)
+	}
+}
+
+// TestDuplicateAcrossInstancesTimesOut checks a duplicate gives up with 409 once
+// ORDER_DUPLICATE_WAIT passes while the first instance is still at the exchange
+func TestDuplicateAcrossInstancesTimesOut(t *testing.T) {
+	_, srvs, mocks := twoInstances(t, 100*time.Millisecond)
+	for _, mock := range mocks {
+		mock.Latency = time.Second
+	}
+
+	order := testOrder("ord-1", 0.1)
+	results := submitConcurrently(t, srvs, "retry-1", []map[string]interface{}{order, order})
+
+	if got := mocks[0].CallCount("SubmitOrder") + mocks[1].CallCount("SubmitOrder"); got != 1 {
+		t.Fatalf("exchanges received %d orders, want 1", got)
+	}
+	codes := map[int]int{}
+	for _, r := range results {
+		codes[r.code]++
+	}
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict] != 1 {
+		t.Errorf("statuses = %v, want one 200 and one 409", codes)
+	}
+}
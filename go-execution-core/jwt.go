@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenClaims are the JWT claims the engine issues and accepts
+type TokenClaims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss"`
+	Role      string `json:"role,omitempty"`
+	Scope     string `json:"scope"` // space-separated
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *TokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// TokenVerifier validates bearer tokens. HS256 is built in; a JWKS-backed verifier
+// can be swapped in without touching the middleware.
+type TokenVerifier interface {
+	Verify(token string) (*TokenClaims, error)
+}
+
+// HMACTokenIssuer mints and verifies HS256 tokens with a shared secret
+type HMACTokenIssuer struct {
+	secret []byte
+	issuer string
+	ttl    time.Duration
+}
+
+func NewHMACTokenIssuer(secret, issuer string, ttl time.Duration) *HMACTokenIssuer {
+	return &HMACTokenIssuer{secret: []byte(secret), issuer: issuer, ttl: ttl}
+}
+
+var jwtHS256Header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (h *HMACTokenIssuer) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Mint returns a signed token for subject with the given role and scopes
+func (h *HMACTokenIssuer) Mint(subject, role string, scopes []string) (string, *TokenClaims, error) {
+	now := time.Now()
+	claims := &TokenClaims{
+		Subject:   subject,
+		Issuer:    h.issuer,
+		Role:      role,
+		Scope:     strings.Join(scopes, " "),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(h.ttl).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signingInput := jwtHS256Header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + h.sign(signingInput), claims, nil
+}
+
+// Verify checks the signature, algorithm, issuer and expiry
+func (h *HMACTokenIssuer) Verify(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm")
+	}
+
+	expected := h.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload")
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token payload")
+	}
+	if claims.Issuer != h.issuer {
+		return nil, fmt.Errorf("unexpected token issuer")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	return &claims, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" value
+func bearerToken(authorization string) (string, bool) {
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
+
+// tokenUser is a configured account that may mint tokens. Scopes default to the
+// permissions of Role.
+type tokenUser struct {
+	Username       string   `json:"username"`
+	PasswordSHA256 string   `json:"password_sha256"` // hex SHA-256 of the password
+	Role           string   `json:"role"`
+	Scopes         []string `json:"scopes"`
+}
+
+func loadTokenUsers(config *Config) (map[string]tokenUser, error) {
+	raw := []byte(config.AuthUsers)
+	if len(raw) == 0 && config.AuthUsersFile != "" {
+		data, err := os.ReadFile(config.AuthUsersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", config.AuthUsersFile, err)
+		}
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var list []tokenUser
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("invalid auth users JSON: %w", err)
+	}
+
+	users := make(map[string]tokenUser, len(list))
+	for i, u := range list {
+		if u.Username == "" || u.PasswordSHA256 == "" {
+			return nil, fmt.Errorf("auth user %d needs username and password_sha256", i)
+		}
+		if u.Role != "" {
+			perms, valid := rolePermissions[u.Role]
+			if !valid {
+				return nil, fmt.Errorf("auth user %s has unknown role %q", u.Username, u.Role)
+			}
+			if len(u.Scopes) == 0 {
+				u.Scopes = perms
+			}
+		}
+		users[u.Username] = u
+	}
+	return users, nil
+}
+
+func (s *Server) registerAuthEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/token", s.handleIssueToken)
+}
+
+// handleIssueToken exchanges a configured username/password for a short-lived token.
+// Callers may request a subset of their scopes.
+func (s *Server) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.tokenIssuer == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Token issuing not configured (set JWT_SECRET)",
+		})
+		return
+	}
+
+	var req struct {
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		Scopes   []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid JSON",
+		})
+		return
+	}
+
+	user, exists := s.tokenUsers[req.Username]
+	sum := sha256.Sum256([]byte(req.Password))
+	if !exists || subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(user.PasswordSHA256))) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "Invalid username or password",
+		})
+		return
+	}
+
+	scopes := user.Scopes
+	if len(req.Scopes) > 0 {
+		granted := &Principal{Permissions: user.Scopes}
+		for _, scope := range req.Scopes {
+			if granted.missingPermission(scope) != "" {
+				writeJSON(w, http.StatusForbidden, map[string]interface{}{
+					"error": fmt.Sprintf("Scope %s not granted to %s", scope, user.Username),
+				})
+				return
+			}
+		}
+		scopes = req.Scopes
+	}
+
+	token, claims, err := s.tokenIssuer.Mint(user.Username, user.Role, scopes)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to issue token",
+		})
+		return
+	}
+	log.Printf("✓ Issued token for %s (%s)", user.Username, claims.Scope)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   claims.ExpiresAt - claims.IssuedAt,
+		"scope":        claims.Scope,
+	})
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// With KLINE_PERSIST=true closed candles are kept in the klines table: the seeded
+// history and closed candles of the kline streams, candles fetched to answer
+// /api/v1/klines, and ranges loaded by `execution-engine backfill-klines`. Range
+// reads take what the table has and fetch only the missing segments upstream.
+// Gaps are found from the candles themselves (each candle's close_time + 1ms is
+// the next open_time), so an interrupted backfill resumes where it stopped.
+
+const (
+	klineInsertBatch  = 500  // rows per INSERT, 10 parameters each
+	klineBackfillSpan = 5000 // candles checked for gaps per backfill step
+)
+
+// klineStoreExchange names the exchange whose candles another serves: named
+// accounts and margin trade on their base exchange's book
+func klineStoreExchange(name string) string {
+	base, _ := splitExchangeKey(name)
+	if base == "binance_margin" {
+		return "binance"
+	}
+	return base
+}
+
+// closedKlines drops a candle that is still forming
+func closedKlines(klines []Kline) []Kline {
+	closed := make([]Kline, 0, len(klines))
+	for _, k := range klines {
+		if k.IsClosed {
+			closed = append(closed, k)
+		}
+	}
+	return closed
+}
+
+// upsertKlines writes closed candles, replacing stored ones with the same open time
+func upsertKlines(ctx context.Context, db *sql.DB, exchange, symbol, interval string, klines []Kline) error {
+	klines = closedKlines(klines)
+	for len(klines) > 0 {
+		batch := klines
+		if len(batch) > klineInsertBatch {
+			batch = batch[:klineInsertBatch]
+		}
+		klines = klines[len(batch):]
+
+		values := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, 10*len(batch))
+		for _, k := range batch {
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10))
+			args = append(args, exchange, symbol, interval, k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume, k.CloseTime)
+		}
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO klines
+			(exchange, symbol, interval, open_time, open, high, low, close, volume, close_time)
+			VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT (exchange, symbol, interval, open_time) DO UPDATE SET
+				open = EXCLUDED.open,
+				high = EXCLUDED.high,
+				low = EXCLUDED.low,
+				close = EXCLUDED.close,
+				volume = EXCLUDED.volume,
+				close_time = EXCLUDED.close_time
+		`, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadKlines reads up to limit stored candles opening in [start, end], oldest first
+func loadKlines(ctx context.Context, db *sql.DB, exchange, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT open_time, open, high, low, close, volume, close_time
+		FROM klines
+		WHERE exchange = $1 AND symbol = $2 AND interval = $3 AND open_time >= $4 AND open_time <= $5
+		ORDER BY open_time
+		LIMIT $6
+	`, exchange, symbol, interval, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var klines []Kline
+	for rows.Next() {
+		k := Kline{IsClosed: true}
+		if err := rows.Scan(&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume, &k.CloseTime); err != nil {
+			return nil, err
+		}
+		klines = append(klines, k)
+	}
+	return klines, rows.Err()
+}
+
+// klineGap is a stretch of open times [start, end] without stored candles
+type klineGap struct {
+	start, end time.Time
+}
+
+// findKlineGaps returns the segments of [start, end] that stored (oldest first)
+// leaves uncovered. A candle may open up to one interval after an unaligned start.
+// When stored holds limit candles the range ends with the last of them.
+func findKlineGaps(stored []Kline, start, end time.Time, length time.Duration, limit int) []klineGap {
+	var gaps []klineGap
+	next := start
+	for i, k := range stored {
+		if (i == 0 && k.OpenTime.Sub(start) >= length) || (i > 0 && k.OpenTime.After(next)) {
+			gaps = append(gaps, klineGap{next, k.OpenTime.Add(-time.Millisecond)})
+		}
+		next = k.CloseTime.Add(time.Millisecond)
+	}
+	if len(stored) < limit && !next.After(end) {
+		gaps = append(gaps, klineGap{next, end})
+	}
+	return gaps
+}
+
+// mergeKlines combines candle sets by open time, later sets winning, oldest first
+func mergeKlines(sets ...[]Kline) []Kline {
+	byOpen := make(map[int64]Kline)
+	for _, set := range sets {
+		for _, k := range set {
+			byOpen[k.OpenTime.UnixMilli()] = k
+		}
+	}
+	merged := make([]Kline, 0, len(byOpen))
+	for _, k := range byOpen {
+		merged = append(merged, k)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].OpenTime.Before(merged[j].OpenTime) })
+	return merged
+}
+
+// storedKlineRange serves a range starting at start from the klines table,
+// fetching the segments it lacks upstream and storing what they return
+func (s *Server) storedKlineRange(ctx context.Context, exchangeName string, p klineProvider, symbol, interval string,
+	start, end time.Time, limit int) ([]Kline, error) {
+	exchange := klineStoreExchange(exchangeName)
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	dbCtx, cancel := s.dbContext(ctx)
+	stored, err := loadKlines(dbCtx, s.db, exchange, symbol, interval, start, end, limit)
+	cancel()
+	if err != nil {
+		logEvent(ctx, "Failed to read stored klines", "symbol", symbol, "interval", interval, "error", err)
+		return fetchKlineRange(ctx, p, symbol, interval, start, end, limit)
+	}
+
+	gaps := findKlineGaps(stored, start, end, p.KlineIntervals()[interval], limit)
+	sets := [][]Kline{stored}
+	for _, gap := range gaps {
+		fetched, err := fetchKlineRange(ctx, p, symbol, interval, gap.start, gap.end, limit)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, fetched)
+
+		dbCtx, cancel := s.dbContext(ctx)
+		err = upsertKlines(dbCtx, s.db, exchange, symbol, interval, fetched)
+		cancel()
+		if err != nil {
+			logEvent(ctx, "Failed to store klines", "symbol", symbol, "interval", interval, "error", err)
+		}
+	}
+	if len(gaps) > 0 {
+		logEvent(ctx, "Kline range stitched", "symbol", symbol, "interval", interval,
+			"stored", len(stored), "gaps", len(gaps))
+	}
+
+	klines := mergeKlines(sets...)
+	if len(klines) > limit {
+		klines = klines[:limit]
+	}
+	return klines, nil
+}
+
+// saveKlines persists closed stream candles for later backtesting
+func (s *Server) saveKlines(exchange, symbol, interval string, klines []Kline) {
+	ctx, cancel := s.dbContext(context.Background())
+	defer cancel()
+	if err := upsertKlines(ctx, s.db, exchange, symbol, interval, klines); err != nil {
+		log.Printf("Failed to persist %d klines %s %s: %v", len(klines), symbol, interval, err)
+	}
+}
+
+// backfillKlines stores every candle of [start, end] the table lacks, a span of
+// candles at a time, and returns how many it fetched
+func backfillKlines(ctx context.Context, db *sql.DB, p klineProvider, exchange, symbol, interval string,
+	start, end time.Time, progress func(through time.Time, fetched int)) (int, error) {
+	length := p.KlineIntervals()[interval]
+	span := time.Duration(klineBackfillSpan) * length
+	total := 0
+	for from := start; !from.After(end); from = from.Add(span) {
+		to := from.Add(span - time.Millisecond)
+		if to.After(end) {
+			to = end
+		}
+		stored, err := loadKlines(ctx, db, exchange, symbol, interval, from, to, klineBackfillSpan+1)
+		if err != nil {
+			return total, fmt.Errorf("failed to read stored klines: %w", err)
+		}
+		for _, gap := range findKlineGaps(stored, from, to, length, klineBackfillSpan+1) {
+			fetched, err := fetchKlineRange(ctx, p, symbol, interval, gap.start, gap.end, klineBackfillSpan+1)
+			if err != nil {
+				return total, err
+			}
+			if err := upsertKlines(ctx, db, exchange, symbol, interval, fetched); err != nil {
+				return total, fmt.Errorf("failed to store klines: %w", err)
+			}
+			total += len(fetched)
+		}
+		progress(to, total)
+	}
+	return total, nil
+}
+
+// runBackfillKlinesCommand is `execution-engine backfill-klines`
+func runBackfillKlinesCommand(args []string) int {
+	usage := "usage: execution-engine backfill-klines --symbol SYMBOL --start TIME [--end TIME] [--interval 1m] [--exchange binance|binance_futures]"
+	flags := flag.NewFlagSet("backfill-klines", flag.ContinueOnError)
+	exchangeName := flags.String("exchange", "binance", "binance or binance_futures")
+	symbol := flags.String("symbol", "", "symbol to backfill, e.g. BTCUSDT")
+	interval := flags.String("interval", "1m", "candle interval")
+	startRaw := flags.String("start", "", "first open time, RFC3339 or Unix milliseconds")
+	endRaw := flags.String("end", "", "last open time (default now)")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || *symbol == "" || *startRaw == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	var p klineProvider
+	switch *exchangeName {
+	case "binance":
+		p = NewBinanceExchange("", "")
+	case "binance_futures":
+		p = NewBinanceFuturesExchange("", "")
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if _, ok := p.KlineIntervals()[*interval]; !ok {
+		fmt.Fprintf(os.Stderr, "unsupported interval %q\n", *interval)
+		return 2
+	}
+	start, err := parseTimeParam(*startRaw)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "start must be an RFC3339 timestamp or Unix milliseconds")
+		return 2
+	}
+	end := time.Now()
+	if *endRaw != "" {
+		if end, err = parseTimeParam(*endRaw); err != nil {
+			fmt.Fprintln(os.Stderr, "end must be an RFC3339 timestamp or Unix milliseconds")
+			return 2
+		}
+	}
+	if !start.Before(end) {
+		fmt.Fprintln(os.Stderr, "start must be before end")
+		return 2
+	}
+
+	config := loadConfig()
+	db, err := initDatabase(config.DatabaseURL, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	// Ctrl-C stops between pages; running the command again resumes
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sym := strings.ToUpper(*symbol)
+	fetched, err := backfillKlines(ctx, db, p, *exchangeName, sym, *interval, start, end, func(through time.Time, fetched int) {
+		fmt.Printf("%s %s: checked through %s, %d candles fetched\n", sym, *interval, through.UTC().Format(time.RFC3339), fetched)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backfill stopped after %d candles: %v\n", fetched, err)
+		return 1
+	}
+	fmt.Printf("Backfilled %s %s from %s to %s: %d candles fetched\n", sym, *interval,
+		start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), fetched)
+	return 0
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// In-memory candle builder fed by Binance <symbol>@kline_<interval> streams.
+// Each (symbol, interval) keeps the currently forming candle plus a rolling
+// window of closed candles, seeded from GetHistoricalKlines on subscribe.
+
+const defaultKlineWindowSize = 500
+
+// klineEvent is a message from the <symbol>@kline_<interval> stream
+type klineEvent struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+	Symbol    string `json:"s"`
+	Kline     struct {
+		OpenTime  int64  `json:"t"`
+		CloseTime int64  `json:"T"`
+		Interval  string `json:"i"`
+		Open      string `json:"o"`
+		Close     string `json:"c"`
+		High      string `json:"h"`
+		Low       string `json:"l"`
+		Volume    string `json:"v"`
+		IsClosed  bool   `json:"x"`
+	} `json:"k"`
+}
+
+// toKline parses the string fields of a stream kline
+func (ev *klineEvent) toKline() (Kline, error) {
+	k := ev.Kline
+	values := make([]float64, 5)
+	for i, raw := range []string{k.Open, k.High, k.Low, k.Close, k.Volume} {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Kline{}, fmt.Errorf("invalid kline value '%s': %w", raw, err)
+		}
+		values[i] = v
+	}
+
+	return Kline{
+		OpenTime:  time.UnixMilli(k.OpenTime),
+		Open:      values[0],
+		High:      values[1],
+		Low:       values[2],
+		Close:     values[3],
+		Volume:    values[4],
+		CloseTime: time.UnixMilli(k.CloseTime),
+		IsClosed:  k.IsClosed,
+	}, nil
+}
+
+// candleWindow holds the forming candle and the last N closed candles
+type candleWindow struct {
+	closed  []Kline
+	current *Kline
+	size    int
+	seeded  bool
+	mu      sync.RWMutex
+}
+
+// seed loads historical candles; the newest one may still be forming
+func (cw *candleWindow) seed(klines []Kline) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	now := time.Now()
+	cw.closed = cw.closed[:0]
+	cw.current = nil
+	for _, k := range klines {
+		if k.CloseTime.After(now) {
+			forming := k
+			cw.current = &forming
+			continue
+		}
+		k.IsClosed = true
+		cw.closed = append(cw.closed, k)
+	}
+	cw.trim()
+	cw.seeded = true
+}
+
+// update applies a stream candle, returning true when it closed a candle
+func (cw *candleWindow) update(k Kline) bool {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	// Ignore updates for candles already in the closed window (replays after reconnect)
+	if n := len(cw.closed); n > 0 && !k.OpenTime.After(cw.closed[n-1].OpenTime) {
+		return false
+	}
+
+	if !k.IsClosed {
+		cw.current = &k
+		return false
+	}
+
+	cw.closed = append(cw.closed, k)
+	cw.trim()
+	if cw.current != nil && !cw.current.OpenTime.After(k.OpenTime) {
+		cw.current = nil
+	}
+	return true
+}
+
+func (cw *candleWindow) trim() {
+	if len(cw.closed) > cw.size {
+		cw.closed = append([]Kline(nil), cw.closed[len(cw.closed)-cw.size:]...)
+	}
+}
+
+// recent returns up to n candles, oldest first, ending with the forming candle if any
+func (cw *candleWindow) recent(n int) []Kline {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+
+	all := make([]Kline, 0, len(cw.closed)+1)
+	all = append(all, cw.closed...)
+	if cw.current != nil {
+		all = append(all, *cw.current)
+	}
+	if n > 0 && len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
+
+// KlineStreamManager maintains candle windows for subscribed symbol/interval pairs
+type KlineStreamManager struct {
+	exchange   *BinanceExchange
+	wsURL      string
+	windowSize int
+	windows    map[string]*candleWindow
+	onClosed   func(symbol, interval string, klines []Kline)
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mu         sync.Mutex
+}
+
+func NewKlineStreamManager(exchange *BinanceExchange, wsURL string, windowSize int) *KlineStreamManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KlineStreamManager{
+		exchange:   exchange,
+		wsURL:      wsURL,
+		windowSize: windowSize,
+		windows:    make(map[string]*candleWindow),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Subscribe starts streaming a symbol/interval pair if not already running
+func (m *KlineStreamManager) Subscribe(symbol, interval string) *candleWindow {
+	symbol = strings.ToUpper(symbol)
+	key := symbol + ":" + interval
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cw, exists := m.windows[key]; exists {
+		return cw
+	}
+
+	cw := &candleWindow{size: m.windowSize}
+	m.windows[key] = cw
+	go m.run(symbol, interval, cw)
+	log.Printf("✓ Kline stream started for %s %s", symbol, interval)
+	return cw
+}
+
+// Close stops all kline streams
+func (m *KlineStreamManager) Close() {
+	m.cancel()
+}
+
+// run seeds the window from REST, then keeps the stream connected with backoff
+func (m *KlineStreamManager) run(symbol, interval string, cw *candleWindow) {
+	backoff := time.Second
+	for {
+		err := m.stream(symbol, interval, cw)
+		if m.ctx.Err() != nil {
+			return
+		}
+		log.Printf("Kline stream for %s %s interrupted: %v (reconnecting in %s)", symbol, interval, err, backoff)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *KlineStreamManager) stream(symbol, interval string, cw *candleWindow) error {
+	streamURL := fmt.Sprintf("%s/ws/%s@kline_%s", m.wsURL, strings.ToLower(symbol), interval)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(m.ctx, streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect kline stream: %w", err)
+	}
+	defer conn.Close()
+
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	// Seed (or re-seed after a reconnect) so there is no gap in the window
+	limit := m.windowSize + 1
+	if limit > 1000 {
+		limit = 1000 // Binance maximum per request
+	}
+	history, err := m.exchange.GetHistoricalKlines(symbol, interval, limit)
+	if err != nil {
+		return fmt.Errorf("failed to seed klines: %w", err)
+	}
+	cw.seed(history)
+	if m.onClosed != nil {
+		if closed := closedKlines(history); len(closed) > 0 {
+			m.onClosed(symbol, interval, closed)
+		}
+	}
+
+	for {
+		var ev klineEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			return err
+		}
+
+		k, err := ev.toKline()
+		if err != nil {
+			log.Printf("Skipping kline event for %s: %v", symbol, err)
+			continue
+		}
+
+		if cw.update(k) && m.onClosed != nil {
+			m.onClosed(symbol, interval, []Kline{k})
+		}
+	}
+}
+
+// ConfigureKlineStreams sets the rolling window size and an optional hook for
+// closed candles, called with the seeded history and then each candle that closes
+func (b *BinanceExchange) ConfigureKlineStreams(windowSize int, onClosed func(symbol, interval string, klines []Kline)) {
+	b.klineStreams.mu.Lock()
+	defer b.klineStreams.mu.Unlock()
+
+	if windowSize > 0 {
+		b.klineStreams.windowSize = windowSize
+	}
+	b.klineStreams.onClosed = onClosed
+}
+
+// GetRecentKlines serves the last n candles for a symbol from the in-memory window
+// without an HTTP call once the stream is seeded
+func (b *BinanceExchange) GetRecentKlines(symbol, interval string, n int) ([]Kline, error) {
+	cw := b.klineStreams.Subscribe(symbol, interval)
+
+	deadline := time.Now().Add(depthSyncTimeout)
+	for {
+		cw.mu.RLock()
+		seeded := cw.seeded
+		cw.mu.RUnlock()
+		if seeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("kline window for %s %s not yet seeded", symbol, interval)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return cw.recent(n), nil
+}
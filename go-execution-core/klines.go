@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKlineLimit = 500
+	maxKlineLimit     = 10000 // across all upstream pages of one request
+)
+
+// binanceKlineIntervals are the intervals Binance serves, with their length
+// (1M is an upper bound, used only to size ranges)
+var binanceKlineIntervals = map[string]time.Duration{
+	"1s": time.Second, "1m": time.Minute, "3m": 3 * time.Minute, "5m": 5 * time.Minute,
+	"15m": 15 * time.Minute, "30m": 30 * time.Minute, "1h": time.Hour, "2h": 2 * time.Hour,
+	"4h": 4 * time.Hour, "6h": 6 * time.Hour, "8h": 8 * time.Hour, "12h": 12 * time.Hour,
+	"1d": 24 * time.Hour, "3d": 72 * time.Hour, "1w": 7 * 24 * time.Hour, "1M": 31 * 24 * time.Hour,
+}
+
+// klineProvider is implemented by exchanges serving historical candles. GetKlines
+// returns one upstream page of at most KlinePageLimit candles, oldest first;
+// zero start or end leaves that side open.
+type klineProvider interface {
+	KlineIntervals() map[string]time.Duration
+	KlinePageLimit() int
+	GetKlines(ctx context.Context, symbol, interval string, start, end time.Time, limit int) ([]Kline, error)
+}
+
+// fetchBinanceKlines requests one page from a Binance klines endpoint (spot and
+// futures share the format) after waiting on the rate limiter for weight
+func fetchBinanceKlines(ctx context.Context, client *http.Client, limiter *RateLimiter, weight float64,
+	endpoint, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	if err := limiter.WaitN(ctx, weight); err != nil {
+		return nil, fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("interval", interval)
+	params.Set("limit", strconv.Itoa(limit))
+	if !start.IsZero() {
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch klines: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("binance API error: %s - %s", resp.Status, string(body))
+	}
+
+	// [openTime, open, high, low, close, volume, closeTime, ...]
+	var rawKlines [][]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rawKlines); err != nil {
+		return nil, fmt.Errorf("failed to decode klines: %w", err)
+	}
+
+	klines := make([]Kline, 0, len(rawKlines))
+	for _, raw := range rawKlines {
+		if len(raw) < 7 {
+			continue
+		}
+		var openTime, closeTime int64
+		var values [5]string
+		if err := json.Unmarshal(raw[0], &openTime); err != nil {
+			return nil, fmt.Errorf("invalid kline open time: %w", err)
+		}
+		if err := json.Unmarshal(raw[6], &closeTime); err != nil {
+			return nil, fmt.Errorf("invalid kline close time: %w", err)
+		}
+		parsed := make([]float64, len(values))
+		for i := range values {
+			if err := json.Unmarshal(raw[i+1], &values[i]); err != nil {
+				return nil, fmt.Errorf("invalid kline value: %w", err)
+			}
+			if parsed[i], err = strconv.ParseFloat(values[i], 64); err != nil {
+				return nil, fmt.Errorf("invalid kline value '%s': %w", values[i], err)
+			}
+		}
+
+		klines = append(klines, Kline{
+			OpenTime:  time.UnixMilli(openTime),
+			Open:      parsed[0],
+			High:      parsed[1],
+			Low:       parsed[2],
+			Close:     parsed[3],
+			Volume:    parsed[4],
+			CloseTime: time.UnixMilli(closeTime),
+			IsClosed:  closeTime < time.Now().UnixMilli(),
+		})
+	}
+	return klines, nil
+}
+
+// KlineIntervals returns the candle intervals Binance spot serves
+func (b *BinanceExchange) KlineIntervals() map[string]time.Duration {
+	return binanceKlineIntervals
+}
+
+// KlinePageLimit is the most candles /api/v3/klines returns per call
+func (b *BinanceExchange) KlinePageLimit() int {
+	return 1000
+}
+
+// GetKlines fetches one page of spot candles
+func (b *BinanceExchange) GetKlines(ctx context.Context, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	return fetchBinanceKlines(ctx, b.client, b.rateLimiter, 2, b.baseURL+"/api/v3/klines", symbol, interval, start, end, limit)
+}
+
+// KlineIntervals returns the spot intervals; margin pairs trade on the spot book
+func (m *BinanceMarginExchange) KlineIntervals() map[string]time.Duration {
+	return m.spot.KlineIntervals()
+}
+
+// KlinePageLimit is the spot page size
+func (m *BinanceMarginExchange) KlinePageLimit() int {
+	return m.spot.KlinePageLimit()
+}
+
+// GetKlines fetches one page of candles from the spot book
+func (m *BinanceMarginExchange) GetKlines(ctx context.Context, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	return m.spot.GetKlines(ctx, symbol, interval, start, end, limit)
+}
+
+// KlineIntervals returns the candle intervals Binance futures serves
+func (f *BinanceFuturesExchange) KlineIntervals() map[string]time.Duration {
+	return binanceKlineIntervals
+}
+
+// KlinePageLimit is the most candles /fapi/v1/klines returns per call
+func (f *BinanceFuturesExchange) KlinePageLimit() int {
+	return 1500
+}
+
+// GetKlines fetches one page of contract candles
+func (f *BinanceFuturesExchange) GetKlines(ctx context.Context, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	return fetchBinanceKlines(ctx, f.client, f.rateLimiter, binanceFuturesKlinesWeight(limit),
+		f.baseURL+"/fapi/v1/klines", symbol, interval, start, end, limit)
+}
+
+// binanceFuturesKlinesWeight is the request weight of a futures klines page of limit candles
+func binanceFuturesKlinesWeight(limit int) float64 {
+	switch {
+	case limit < 100:
+		return 1
+	case limit < 500:
+		return 2
+	case limit <= 1000:
+		return 5
+	default:
+		return 10
+	}
+}
+
+// fetchKlineRange pages through the provider until limit candles or the end of
+// the range. Without a start it returns the limit candles ending at end (or now).
+func fetchKlineRange(ctx context.Context, p klineProvider, symbol, interval string, start, end time.Time, limit int) ([]Kline, error) {
+	pageSize := p.KlinePageLimit()
+	if start.IsZero() {
+		if limit <= pageSize {
+			return p.GetKlines(ctx, symbol, interval, time.Time{}, end, limit)
+		}
+		// Walk forward from far enough back, then keep the newest candles
+		until := end
+		if until.IsZero() {
+			until = time.Now()
+		}
+		start = until.Add(-time.Duration(limit) * p.KlineIntervals()[interval])
+		klines, err := fetchKlineRange(ctx, p, symbol, interval, start, end, limit+pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(klines) > limit {
+			klines = klines[len(klines)-limit:]
+		}
+		return klines, nil
+	}
+
+	var klines []Kline
+	cursor := start
+	for len(klines) < limit {
+		page := pageSize
+		if remaining := limit - len(klines); remaining < page {
+			page = remaining
+		}
+		batch, err := p.GetKlines(ctx, symbol, interval, cursor, end, page)
+		if err != nil {
+			return nil, err
+		}
+		klines = append(klines, batch...)
+		if len(batch) < page {
+			break
+		}
+		cursor = batch[len(batch)-1].OpenTime.Add(time.Millisecond)
+		if !end.IsZero() && cursor.After(end) {
+			break
+		}
+	}
+	return klines, nil
+}
+
+// parseTimeParam accepts RFC3339 or Unix milliseconds (as Binance uses)
+func parseTimeParam(raw string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// handleGetKlines serves historical candles:
+// GET /api/v1/klines/{exchange}/{symbol}?interval=1h&limit=500&start=...&end=...
+// Each candle is [open_time, open, high, low, close, volume, close_time] with
+// times in Unix milliseconds.
+func (s *Server) handleGetKlines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/klines/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+	exchangeName := parts[0]
+	symbol := strings.ToUpper(parts[1])
+
+	s.mu.RLock()
+	exchange, exists := s.exchanges[exchangeName]
+	s.mu.RUnlock()
+	if !exists {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Exchange %s not configured", exchangeName),
+		})
+		return
+	}
+	provider, ok := exchange.(klineProvider)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Exchange does not support historical klines",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	intervalLength, ok := provider.KlineIntervals()[interval]
+	if !ok {
+		supported := make([]string, 0, len(provider.KlineIntervals()))
+		for name := range provider.KlineIntervals() {
+			supported = append(supported, name)
+		}
+		sort.Slice(supported, func(i, j int) bool {
+			return provider.KlineIntervals()[supported[i]] < provider.KlineIntervals()[supported[j]]
+		})
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":     fmt.Sprintf("Unsupported interval %q", interval),
+			"intervals": supported,
+		})
+		return
+	}
+
+	var start, end time.Time
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"start", &start}, {"end", &end}} {
+		raw := query.Get(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := parseTimeParam(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp or Unix milliseconds", bound.param),
+			})
+			return
+		}
+		*bound.dst = t
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "start must be before end"})
+		return
+	}
+
+	// A closed range without an explicit limit means the whole range
+	limit := defaultKlineLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxKlineLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("limit must be an integer between 1 and %d", maxKlineLimit),
+			})
+			return
+		}
+		limit = parsed
+	} else if !start.IsZero() && !end.IsZero() {
+		candles := int(end.Sub(start)/intervalLength) + 1
+		if candles > maxKlineLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("Range covers about %d candles, more than %d; narrow it or set limit", candles, maxKlineLimit),
+			})
+			return
+		}
+		limit = candles
+	}
+
+	// Ranges come from the klines table first when candles are persisted
+	var klines []Kline
+	var err error
+	if s.dbAvailable() && s.config.KlinePersist && !start.IsZero() {
+		klines, err = s.storedKlineRange(r.Context(), exchangeName, provider, symbol, interval, start, end, limit)
+	} else {
+		klines, err = fetchKlineRange(r.Context(), provider, symbol, interval, start, end, limit)
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to fetch klines", "exchange", exchangeName, "symbol", symbol, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error": fmt.Sprintf("Failed to fetch klines: %v", err),
+		})
+		return
+	}
+
+	rows := make([][]interface{}, len(klines))
+	historical := !end.IsZero() && end.Before(time.Now())
+	for i, k := range klines {
+		rows[i] = []interface{}{k.OpenTime.UnixMilli(), k.Open, k.High, k.Low, k.Close, k.Volume, k.CloseTime.UnixMilli()}
+		if !k.IsClosed {
+			historical = false
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"exchange": exchangeName,
+		"symbol":   symbol,
+		"interval": interval,
+		"klines":   rows,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode klines", http.StatusInternalServerError)
+		return
+	}
+
+	// Closed candles never change, so a past range can be cached and revalidated
+	if historical {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KucoinExchange implements Exchange interface for KuCoin spot
+type KucoinExchange struct {
+	apiKey      string
+	apiSecret   string
+	passphrase  string
+	baseURL     string
+	client      *http.Client
+	rateLimiter *RateLimiter
+}
+
+func NewKucoinExchange(apiKey, apiSecret, passphrase string) *KucoinExchange {
+	return &KucoinExchange{
+		apiKey:      apiKey,
+		apiSecret:   apiSecret,
+		passphrase:  passphrase,
+		baseURL:     "https://api.kucoin.com",
+		client:      newExchangeHTTPClient("kucoin", 10*time.Second),
+		rateLimiter: newExchangeRateLimiter("kucoin", apiKey, 10),
+	}
+}
+
+// kucoinQuoteAssets are checked longest-first when splitting compact symbols
+var kucoinQuoteAssets = []string{"USDT", "USDC", "TUSD", "BTC", "ETH", "KCS", "DAI"}
+
+// toKucoinSymbol maps exchange-neutral symbols (BTCUSDT) to KuCoin symbols (BTC-USDT)
+func toKucoinSymbol(symbol string) string {
+	return dashSymbol(symbol, kucoinQuoteAssets)
+}
+
+// kucoinResponse is the envelope around every KuCoin REST response
+type kucoinResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (k *KucoinExchange) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(k.apiSecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// request performs a signed request and decodes the envelope's data into out.
+// Key version 2 requires the passphrase itself to be signed with the secret.
+func (k *KucoinExchange) request(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := k.rateLimiter.Wait(waitCtx); err != nil {
+		return fmt.Errorf("rate limit wait failed: %w", err)
+	}
+
+	endpoint := path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("KC-API-KEY", k.apiKey)
+	req.Header.Set("KC-API-SIGN", k.sign(timestamp+method+endpoint+string(payload)))
+	req.Header.Set("KC-API-TIMESTAMP", timestamp)
+	req.Header.Set("KC-API-PASSPHRASE", k.sign(k.passphrase))
+	req.Header.Set("KC-API-KEY-VERSION", "2")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kucoin request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kucoin API error: %s - %s", resp.Status, string(respBody))
+	}
+
+	var envelope kucoinResponse
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("failed to decode kucoin response: %w", err)
+	}
+	if envelope.Code != "200000" {
+		return fmt.Errorf("kucoin API error: %s - %s", envelope.Code, envelope.Msg)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return fmt.Errorf("failed to decode kucoin data: %w", err)
+		}
+	}
+	return nil
+}
+
+func (k *KucoinExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	var stats struct {
+		Last        string `json:"last"`
+		Buy         string `json:"buy"`
+		Sell        string `json:"sell"`
+		Vol         string `json:"vol"`
+		High        string `json:"high"`
+		Low         string `json:"low"`
+		ChangePrice string `json:"changePrice"`
+	}
+
+	query := url.Values{"symbol": {toKucoinSymbol(symbol)}}
+	if err := k.request(ctx, "GET", "/api/v1/market/stats", query, nil, &stats); err != nil {
+		return nil, fmt.Errorf("failed to fetch market data: %w", err)
+	}
+
+	price, err := strconv.ParseFloat(stats.Last, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid last price '%s': %w", stats.Last, err)
+	}
+	bid, err := parseOptionalFloat(stats.Buy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bid price '%s': %w", stats.Buy, err)
+	}
+	ask, err := parseOptionalFloat(stats.Sell)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ask price '%s': %w", stats.Sell, err)
+	}
+	volume, err := parseOptionalFloat(stats.Vol)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume '%s': %w", stats.Vol, err)
+	}
+	high, err := parseOptionalFloat(stats.High)
+	if err != nil {
+		return nil, fmt.Errorf("invalid high price '%s': %w", stats.High, err)
+	}
+	low, err := parseOptionalFloat(stats.Low)
+	if err != nil {
+		return nil, fmt.Errorf("invalid low price '%s': %w", stats.Low, err)
+	}
+	priceChange, err := parseOptionalFloat(stats.ChangePrice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price change '%s': %w", stats.ChangePrice, err)
+	}
+
+	return &MarketData{
+		Symbol:      symbol,
+		Price:       price,
+		Bid:         bid,
+		Ask:         ask,
+		Volume24h:   volume,
+		High24h:     high,
+		Low24h:      low,
+		PriceChange: priceChange,
+		Timestamp:   time.Now(),
+	}, nil
+}
+
+// SubmitOrder places the order and then resolves fills, since KuCoin only returns the orderId
+func (k *KucoinExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	clientOid := order.ID
+	if clientOid == "" {
+		clientOid = fmt.Sprintf("signalops-%d", time.Now().UnixNano())
+	}
+
+	body := map[string]string{
+		"clientOid": clientOid,
+		"side":      strings.ToLower(order.Side),
+		"symbol":    toKucoinSymbol(order.Symbol),
+		"type":      strings.ToLower(order.OrderType),
+		"size":      strconv.FormatFloat(order.Quantity, 'f', -1, 64),
+	}
+	if order.OrderType == "LIMIT" {
+		body["price"] = strconv.FormatFloat(order.Price, 'f', -1, 64)
+	}
+
+	var orderResp struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := k.request(ctx, "POST", "/api/v1/orders", nil, body, &orderResp); err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "FAILED",
+		}, fmt.Errorf("kucoin order failed: %w", err)
+	}
+
+	result := &OrderResult{
+		OrderID:         order.ID,
+		ExchangeOrderID: orderResp.OrderID,
+		Status:          "NEW",
+		Timestamp:       time.Now(),
+	}
+
+	if status, err := k.GetOrderStatus(ctx, orderResp.OrderID); err == nil {
+		result.Status = status.Status
+		result.ExecutedPrice = status.AveragePrice
+		result.ExecutedQuantity = status.FilledQty
+		result.Fees = status.Fees
+	}
+
+	return result, nil
+}
+
+// GetOrderStatus reads the order state, then aggregates /api/v1/fills for average price and fees
+func (k *KucoinExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	var orderResp struct {
+		ID          string `json:"id"`
+		Size        string `json:"size"`
+		DealSize    string `json:"dealSize"`
+		IsActive    bool   `json:"isActive"`
+		CancelExist bool   `json:"cancelExist"`
+	}
+	if err := k.request(ctx, "GET", "/api/v1/orders/"+orderID, nil, nil, &orderResp); err != nil {
+		return nil, fmt.Errorf("failed to get order status: %w", err)
+	}
+
+	dealSize, err := parseOptionalFloat(orderResp.DealSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deal size '%s': %w", orderResp.DealSize, err)
+	}
+
+	var status string
+	switch {
+	case orderResp.IsActive && dealSize > 0:
+		status = "PARTIALLY_FILLED"
+	case orderResp.IsActive:
+		status = "NEW"
+	case orderResp.CancelExist:
+		status = "CANCELED"
+	default:
+		status = "FILLED"
+	}
+
+	filledQty, avgPrice, fees, err := k.orderFills(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if filledQty == 0 {
+		filledQty = dealSize
+	}
+
+	return &OrderStatus{
+		OrderID:      orderResp.ID,
+		Status:       status,
+		FilledQty:    filledQty,
+		AveragePrice: avgPrice,
+		Fees:         fees,
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+// orderFills sums every fill page for an order
+func (k *KucoinExchange) orderFills(ctx context.Context, orderID string) (filledQty, avgPrice, fees float64, err error) {
+	var funds float64
+
+	for page := 1; ; page++ {
+		var fillsResp struct {
+			TotalPage int `json:"totalPage"`
+			Items     []struct {
+				Size  string `json:"size"`
+				Funds string `json:"funds"`
+				Fee   string `json:"fee"`
+			} `json:"items"`
+		}
+
+		query := url.Values{
+			"orderId":     {orderID},
+			"currentPage": {strconv.Itoa(page)},
+			"pageSize":    {"500"},
+		}
+		if err := k.request(ctx, "GET", "/api/v1/fills", query, nil, &fillsResp); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to get order fills: %w", err)
+		}
+
+		for _, fill := range fillsResp.Items {
+			size, err := strconv.ParseFloat(fill.Size, 64)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("invalid fill size '%s': %w", fill.Size, err)
+			}
+			fillFunds, err := strconv.ParseFloat(fill.Funds, 64)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("invalid fill funds '%s': %w", fill.Funds, err)
+			}
+			fee, err := strconv.ParseFloat(fill.Fee, 64)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("invalid fill fee '%s': %w", fill.Fee, err)
+			}
+			filledQty += size
+			funds += fillFunds
+			fees += fee
+		}
+
+		if page >= fillsResp.TotalPage {
+			break
+		}
+	}
+
+	if filledQty > 0 {
+		avgPrice = funds / filledQty
+	}
+	return filledQty, avgPrice, fees, nil
+}
+
+// GetBalance aggregates the trade and main (funding) accounts per currency
+func (k *KucoinExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	var accounts []struct {
+		Currency  string `json:"currency"`
+		Type      string `json:"type"`
+		Balance   string `json:"balance"`
+		Available string `json:"available"`
+		Holds     string `json:"holds"`
+	}
+	if err := k.request(ctx, "GET", "/api/v1/accounts", nil, nil, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	balances := make(map[string]AssetBalance)
+
+	for _, acct := range accounts {
+		if acct.Type != "trade" && acct.Type != "main" {
+			continue
+		}
+
+		free, err := strconv.ParseFloat(acct.Available, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid available balance for %s: '%s': %w", acct.Currency, acct.Available, err)
+		}
+		locked, err := strconv.ParseFloat(acct.Holds, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holds for %s: '%s': %w", acct.Currency, acct.Holds, err)
+		}
+		if free == 0 && locked == 0 {
+			continue
+		}
+
+		bal := balances[acct.Currency]
+		bal.Asset = acct.Currency
+		bal.Free += free
+		bal.Locked += locked
+		bal.Total = bal.Free + bal.Locked
+		balances[acct.Currency] = bal
+	}
+
+	return &Balance{
+		Exchange:  "kucoin",
+		Balances:  balances,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// Ping checks the server time endpoint, then validates credentials with a trade account read
+func (k *KucoinExchange) Ping(ctx context.Context) error {
+	var serverTime int64
+	if err := k.request(ctx, "GET", "/api/v1/timestamp", nil, nil, &serverTime); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	if err := k.request(ctx, "GET", "/api/v1/accounts", url.Values{"type": {"trade"}}, nil, nil); err != nil {
+		return fmt.Errorf("credential check failed: %w", err)
+	}
+	return nil
+}
+
+// CancelOrder cancels an open order; KuCoin identifies orders by ID alone
+func (k *KucoinExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	if err := k.request(ctx, "DELETE", "/api/v1/orders/"+orderID, nil, nil, nil); err != nil {
+		return fmt.Errorf("kucoin cancel failed: %w", err)
+	}
+	return nil
+}
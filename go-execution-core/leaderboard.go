@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The strategy leaderboard is one Redis sorted set per metric, leaderboard:pnl,
+// leaderboard:sharpe and leaderboard:win_rate, scored by each strategy's current
+// value so the dashboard reads it without aggregating trades. Its rules:
+//
+//   - a strategy is rescored after each fill booked to it and each recompute of
+//     its aggregates, from the strategies row and its daily PnL once committed
+//   - deleted strategies, and strategies without a value for a metric (win_rate
+//     before the first closing trade, sharpe before two days of PnL), are left
+//     off that board
+//   - every board is rebuilt from the strategies table at startup and after a
+//     full recompute, so a Redis flush or restart loses nothing for long
+//   - each hour the first instance to get there copies every board to a snapshot
+//     key kept for a day, and reads compare against the one from 24h ago
+//
+// Redis errors are logged; the leaderboard never fails a fill or a recompute.
+
+// leaderboardPrefix namespaces the boards and their snapshots in Redis
+const leaderboardPrefix = "leaderboard:"
+
+const (
+	// leaderboardSnapshotInterval is how often the boards are snapshotted
+	leaderboardSnapshotInterval = time.Hour
+	// leaderboardDeltaWindow is how far back deltas look
+	leaderboardDeltaWindow = 24 * time.Hour
+	// leaderboardRebuildRetry spaces startup rebuilds while the database or Redis is down
+	leaderboardRebuildRetry = time.Minute
+)
+
+// Metrics strategies are ranked by
+const (
+	leaderboardPnL     = "pnl"
+	leaderboardSharpe  = "sharpe"
+	leaderboardWinRate = "win_rate"
+)
+
+var leaderboardMetrics = []string{leaderboardPnL, leaderboardSharpe, leaderboardWinRate}
+
+// maxLeaderboardLimit caps GET /api/v1/leaderboard?limit
+const maxLeaderboardLimit = 100
+
+// leaderboardSnapshotScript copies KEYS[1] to the snapshot KEYS[2] and records
+// when in KEYS[3], both expiring after ARGV[1] ms, unless an instance already
+// took this snapshot. Returns 1 when it took it.
+var leaderboardSnapshotScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+redis.call('ZUNIONSTORE', KEYS[2], 1, KEYS[1])
+redis.call('PEXPIRE', KEYS[2], ARGV[1])
+redis.call('SET', KEYS[3], ARGV[2], 'PX', ARGV[1])
+return 1
+`)
+
+func (s *Server) leaderboardEnabled() bool {
+	return s.redis != nil && s.config.LeaderboardEnabled
+}
+
+func leaderboardKey(metric string) string {
+	return leaderboardPrefix + metric
+}
+
+// leaderboardSnapshotKeys are the snapshot of a board taken in the interval
+// starting at bucket and the key holding when it was taken
+func leaderboardSnapshotKeys(metric string, bucket time.Time) (string, string) {
+	key := leaderboardKey(metric) + ":snapshot:" + strconv.FormatInt(bucket.Unix(), 10)
+	return key, key + ":at"
+}
+
+// strategyScore is a strategy's values on the boards; nil leaves it off one
+type strategyScore struct {
+	Name    string
+	Deleted bool
+	PnL     float64
+	WinRate *float64
+	Sharpe  *float64
+}
+
+// leaderboardScores reads the named strategies' values, or every strategy's when
+// names is nil
+func (s *Server) leaderboardScores(ctx context.Context, names []string) ([]strategyScore, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+
+	var where whereBuilder
+	if names != nil {
+		where.add(s.store.dialect.inList("name", "?"), s.store.dialect.listArg(names))
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, COALESCE(total_pnl, 0), win_rate, deleted_at IS NOT NULL
+		FROM strategies `+where.sql(), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scores := make([]strategyScore, 0)
+	for rows.Next() {
+		var score strategyScore
+		var winRate sql.NullFloat64
+		if err := rows.Scan(&score.Name, &score.PnL, &winRate, &score.Deleted); err != nil {
+			return nil, err
+		}
+		if winRate.Valid {
+			score.WinRate = &winRate.Float64
+		}
+		scores = append(scores, score)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Sharpe from the same daily PnL series the performance endpoints use
+	where = whereBuilder{}
+	where.add("pnl IS NOT NULL")
+	where.add("status = 'FILLED'")
+	where.add("executed_at IS NOT NULL")
+	if names != nil {
+		where.add(s.store.dialect.inList("strategy_name", "?"), s.store.dialect.listArg(names))
+	}
+	sums, err := s.store.sumPnL(ctx, readCurrent, &where, "day", time.UTC, true)
+	if err != nil {
+		return nil, err
+	}
+	daily := make(map[string][]dayPnL)
+	for _, sum := range sums {
+		daily[sum.Strategy] = append(daily[sum.Strategy], dayPnL{Day: sum.Start, PnL: sum.PnL})
+	}
+	for i := range scores {
+		scores[i].Sharpe = computeRiskAdjusted(daily[scores[i].Name]).SharpeRatio
+	}
+	return scores, nil
+}
+
+// updateLeaderboard rescores the named strategies, or rebuilds every board when
+// names is nil; strategies missing from the table are taken off
+func (s *Server) updateLeaderboard(ctx context.Context, names []string) error {
+	if !s.leaderboardEnabled() || s.store == nil || (names != nil && len(names) == 0) {
+		return nil
+	}
+	scores, err := s.leaderboardScores(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	if names == nil {
+		for _, metric := range leaderboardMetrics {
+			pipe.Del(ctx, leaderboardKey(metric))
+		}
+	} else {
+		for _, name := range names {
+			for _, metric := range leaderboardMetrics {
+				pipe.ZRem(ctx, leaderboardKey(metric), name)
+			}
+		}
+	}
+	for _, score := range scores {
+		if score.Deleted {
+			continue
+		}
+		pipe.ZAdd(ctx, leaderboardKey(leaderboardPnL), redis.Z{Score: score.PnL, Member: score.Name})
+		if score.WinRate != nil {
+			pipe.ZAdd(ctx, leaderboardKey(leaderboardWinRate), redis.Z{Score: *score.WinRate, Member: score.Name})
+		}
+		if score.Sharpe != nil {
+			pipe.ZAdd(ctx, leaderboardKey(leaderboardSharpe), redis.Z{Score: *score.Sharpe, Member: score.Name})
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// refreshLeaderboard rescores strategies after a committed write, logging failures
+func (s *Server) refreshLeaderboard(ctx context.Context, names ...string) {
+	if err := s.updateLeaderboard(ctx, names); err != nil {
+		logEvent(ctx, "Failed to update leaderboard", "strategies", names, "error", err)
+	}
+}
+
+// runLeaderboard rebuilds the boards at startup, retrying until it succeeds, and
+// snapshots them every leaderboardSnapshotInterval until shutdown
+func (s *Server) runLeaderboard() {
+	if !s.leaderboardEnabled() || s.db == nil {
+		return
+	}
+
+	rebuilt := false
+	for {
+		if !rebuilt {
+			if err := s.updateLeaderboard(s.streamCtx, nil); err != nil {
+				log.Printf("Failed to rebuild leaderboard: %v", err)
+			} else {
+				rebuilt = true
+				log.Printf("✓ Strategy leaderboard rebuilt in Redis, snapshotted every %s", leaderboardSnapshotInterval)
+			}
+		}
+		if rebuilt {
+			s.snapshotLeaderboard(s.streamCtx, time.Now())
+		}
+
+		wait := time.Until(time.Now().Truncate(leaderboardSnapshotInterval).Add(leaderboardSnapshotInterval))
+		if !rebuilt {
+			wait = leaderboardRebuildRetry
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.streamCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// snapshotLeaderboard takes the snapshots of the interval containing now, unless
+// another instance already has
+func (s *Server) snapshotLeaderboard(ctx context.Context, now time.Time) {
+	bucket := now.Truncate(leaderboardSnapshotInterval)
+	ttl := leaderboardDeltaWindow + 2*leaderboardSnapshotInterval
+	for _, metric := range leaderboardMetrics {
+		key, atKey := leaderboardSnapshotKeys(metric, bucket)
+		err := leaderboardSnapshotScript.Run(ctx, s.redis, []string{leaderboardKey(metric), key, atKey},
+			ttl.Milliseconds(), now.UTC().Format(time.RFC3339)).Err()
+		if err != nil {
+			log.Printf("Failed to snapshot leaderboard %s: %v", metric, err)
+		}
+	}
+}
+
+// leaderboardEntry is one strategy's place on a board. Previous values are those
+// of the snapshot from leaderboardDeltaWindow ago, nil when the strategy was not
+// on it or there is none.
+type leaderboardEntry struct {
+	Rank          int64    `json:"rank"`
+	Strategy      string   `json:"strategy"`
+	Score         float64  `json:"score"`
+	PreviousRank  *int64   `json:"previous_rank"`
+	PreviousScore *float64 `json:"previous_score"`
+	RankChange    *int64   `json:"rank_change"` // positive when the strategy moved up
+	Delta         *float64 `json:"delta"`
+}
+
+func (s *Server) registerLeaderboardEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/leaderboard", s.handleLeaderboard)
+}
+
+// handleLeaderboard returns the top strategies of a board with their change over
+// the last day: GET /api/v1/leaderboard?metric=pnl|sharpe|win_rate&limit=20
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = leaderboardPnL
+	}
+	valid := false
+	for _, m := range leaderboardMetrics {
+		valid = valid || m == metric
+	}
+	if !valid {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "metric must be pnl, sharpe or win_rate",
+		})
+		return
+	}
+	limit, err := parsePageSize(query.Get("limit"), 20)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+	if !s.leaderboardEnabled() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Leaderboard not available (LEADERBOARD_ENABLED)",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	snapshotKey, snapshotAtKey := leaderboardSnapshotKeys(metric,
+		time.Now().Add(-leaderboardDeltaWindow).Truncate(leaderboardSnapshotInterval))
+	pipe := s.redis.Pipeline()
+	top := pipe.ZRevRangeWithScores(ctx, leaderboardKey(metric), 0, int64(limit)-1)
+	total := pipe.ZCard(ctx, leaderboardKey(metric))
+	snapshotAt := pipe.Get(ctx, snapshotAtKey)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		logEvent(ctx, "Failed to read leaderboard", "metric", metric, "error", err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Leaderboard not available",
+		})
+		return
+	}
+
+	entries := make([]leaderboardEntry, len(top.Val()))
+	for i, z := range top.Val() {
+		entries[i] = leaderboardEntry{Rank: int64(i) + 1, Strategy: z.Member.(string), Score: z.Score}
+	}
+	var takenAt interface{}
+	if snapshotAt.Err() == nil {
+		takenAt = snapshotAt.Val()
+	}
+	if takenAt != nil && len(entries) > 0 {
+		pipe := s.redis.Pipeline()
+		scores := make([]*redis.FloatCmd, len(entries))
+		ranks := make([]*redis.IntCmd, len(entries))
+		for i, entry := range entries {
+			scores[i] = pipe.ZScore(ctx, snapshotKey, entry.Strategy)
+			ranks[i] = pipe.ZRevRank(ctx, snapshotKey, entry.Strategy)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			// The board is still worth returning without deltas
+			logEvent(ctx, "Failed to read leaderboard snapshot", "metric", metric, "error", err)
+			takenAt = nil
+		} else {
+			for i := range entries {
+				if scores[i].Err() != nil || ranks[i].Err() != nil {
+					continue // not on the board a day ago
+				}
+				previousScore, previousRank := scores[i].Val(), ranks[i].Val()+1
+				delta, change := entries[i].Score-previousScore, previousRank-entries[i].Rank
+				entries[i].PreviousScore, entries[i].PreviousRank = &previousScore, &previousRank
+				entries[i].Delta, entries[i].RankChange = &delta, &change
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metric":      metric,
+		"entries":     entries,
+		"total":       total.Val(),
+		"snapshot_at": takenAt,
+	})
+}
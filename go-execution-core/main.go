@@ -6,30 +6,225 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
 	pb "execution-engine/pb"
+	"execution-engine/pkg/position"
 )
 
 type Config struct {
+	Environment   string // "production" turns off development conveniences such as gRPC reflection
 	GRPCPort      string
 	HTTPPort      string
 	DatabaseURL   string
+	RunMigrations bool // apply pending schema migrations at startup
 	RedisURL      string
 	BinanceAPIKey string
 	BinanceSecret string
+
+	// Redis credentials and TLS; set values override those in a redis(s):// REDIS_URL
+	RedisUsername              string
+	RedisPassword              string
+	RedisDB                    int // -1 keeps the URL's database (0 without one)
+	RedisTLS                   bool
+	RedisTLSCAFile             string
+	RedisTLSCertFile           string
+	RedisTLSKeyFile            string
+	RedisTLSInsecureSkipVerify bool
+
+	BinanceFuturesAPIKey string
+	BinanceFuturesSecret string
+
+	BinanceMarginEnabled bool
+	MarginMinLevel       float64
+
+	CoinbaseAPIKey string
+	CoinbaseSecret string
+
+	KucoinAPIKey     string
+	KucoinSecret     string
+	KucoinPassphrase string
+
+	// local keeps exchange rate limits per instance; distributed shares them
+	// per exchange API key through Redis
+	ExchangeRateLimitMode string
+
+	PriceCacheMaxAge time.Duration
+	TickerCacheTTL   time.Duration
+	BalanceCacheTTL  time.Duration // 0 disables the Redis balance cache
+	// 0 disables the Redis quote cache; concurrent fetches are still coalesced
+	MarketDataCacheTTL time.Duration
+	// How long final orders stay in the Redis order status cache; 0 disables it
+	OrderStatusCacheTTL time.Duration
+	// Strategy leaderboard sorted sets in Redis (GET /api/v1/leaderboard)
+	LeaderboardEnabled bool
+	// Per-exchange limit for GET /api/v1/portfolio/balances
+	BalanceFetchTimeout time.Duration
+
+	HealthProbeInterval    time.Duration
+	GRPCHealthInterval     time.Duration // how often Watch streams of grpc.health.v1 see readiness re-evaluated
+	GRPCReflection         bool          // serve grpc.reflection so grpcurl can list and call methods
+	ExchangeUnhealthyGrace time.Duration
+
+	// Open orders are polled every OrderReconcileInterval (0 disables), at most
+	// OrderReconcileBatch a pass, and given up as UNKNOWN after OrderReconcileMaxAge
+	OrderReconcileInterval time.Duration
+	OrderReconcileBatch    int
+	OrderReconcileMaxAge   time.Duration
+	// archive-trades moves finished trades older than TradeArchiveAfter to
+	// trades_archive, TradeArchiveBatch rows a statement
+	TradeArchiveAfter time.Duration
+	TradeArchiveBatch int
+	// Parquet exports go to directories inside ExportDir or, with ExportS3Endpoint,
+	// to S3-compatible buckets
+	ExportDir            string
+	ExportS3Endpoint     string
+	ExportS3Region       string
+	ExportS3AccessKey    string
+	ExportS3SecretKey    string
+	ExportS3SessionToken string
+	// Strategy aggregates are recomputed for strategies with changed trades every
+	// StrategyStatsInterval (0 disables)
+	StrategyStatsInterval time.Duration
+
+	PaperEnabled     bool
+	PaperBalances    string
+	PaperFeeRate     float64
+	PaperSlippageBps float64
+	PaperPriceSource string
+
+	// Named accounts ("binance:alpha") as a JSON list of exchange specs
+	ExchangeAccounts     string
+	ExchangeAccountsFile string
+
+	CredentialsKey string // AES-256 key for exchange credentials persisted at runtime
+
+	KlineWindowSize int
+	KlineSymbols    []string
+	KlinePersist    bool
+
+	// Live order books of OrderBookRecordSymbols sampled into book_snapshots
+	OrderBookRecordExchange  string
+	OrderBookRecordSymbols   []string
+	OrderBookRecordInterval  time.Duration
+	OrderBookRecordDepth     int
+	OrderBookRecordRetention time.Duration
+	OrderBookRecordMaxRows   int
+
+	// Account values recorded into balance_snapshots for the equity curve (0 disables)
+	BalanceSnapshotInterval time.Duration
+	// Share of the account value a change must leave unexplained by market PnL and
+	// fees to be flagged as a deposit or withdrawal
+	EquityFlowThreshold float64
+
+	// Order events also published to Redis pub/sub as OrderEventsRedisPrefix:type
+	OrderEventsRedisEnabled bool
+	OrderEventsRedisPrefix  string
+	OrderEventsRedisBuffer  int
+	// Order events and fills also appended to this Redis Stream ("" disables)
+	OrderEventsStream       string
+	OrderEventsStreamMaxLen int
+	OrderEventsStreamGroup  string
+
+	APIAuthEnabled bool
+	APIKeyCacheTTL time.Duration
+	// Per-IP budget of API key lookups that miss the cache; 0 disables
+	APIKeyLookupRPS   float64
+	APIKeyLookupBurst float64
+	// How long other instances may apply risk limits changed elsewhere
+	RiskLimitsCacheTTL time.Duration
+	// How reductions realize PnL: "average" (weighted average cost) or "fifo"
+	PositionAccounting string
+	MetricsToken       string // optional bearer token for /metrics
+	// Requests slower than this are logged with their route and request ID; 0 disables
+	SlowRequestThreshold time.Duration
+
+	AuthAcceptAPIKeys bool // accept X-API-Key alongside bearer tokens during the JWT migration
+	JWTSecret         string
+	JWTIssuer         string
+	JWTTTL            time.Duration
+	AuthUsers         string // JSON list of users allowed to mint tokens
+	AuthUsersFile     string
+
+	// Per-client token buckets (requests per second and burst) for reads and order placement
+	RateLimitEnabled    bool
+	RateLimitReadRPS    float64
+	RateLimitReadBurst  float64
+	RateLimitOrderRPS   float64
+	RateLimitOrderBurst float64
+	RateLimitIdleTTL    time.Duration
+
+	CORSAllowedOrigins []string // exact origins; "*" only when listed explicitly
+	CORSMaxAge         time.Duration
+
+	ShutdownTimeout time.Duration // total time allowed to drain requests, orders and DB writes
+
+	DBStatementTimeout time.Duration // deadline for the database calls of one request step, 0 for none
+	// Postgres is tried DBConnectAttempts times at startup, waiting DBConnectBackoff
+	// and doubling; after that, and whenever a ping fails, it is retried every
+	// DBRecoveryInterval (0 disables, running without a database instead)
+	DBConnectAttempts  int
+	DBConnectBackoff   time.Duration
+	DBRecoveryInterval time.Duration
+
+	// Analytics reads go to DatabaseReplicaURL while it is at most DBReplicaMaxLag
+	// behind, checked every DBReplicaCheckInterval
+	DatabaseReplicaURL     string
+	DBReplicaMaxLag        time.Duration
+	DBReplicaCheckInterval time.Duration
+
+	// Order rows Postgres refused are kept in OrderJournalPath until written; a
+	// backlog of OrderJournalAlertDepth rows is logged as an alert
+	OrderJournalPath       string
+	OrderJournalAlertDepth int
+	// How long a duplicate of an order another instance is submitting waits for
+	// that instance's result before getting 409 (0 answers at once)
+	OrderDuplicateWait time.Duration
+
+	// HTTP server timeouts; WriteTimeout must outlast BatchTimeout
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	MaxRequestBodyBytes   int64 // request body cap, 0 for none
+	MaxBatchBodyBytes     int64 // cap for the batch endpoints
+
+	// gRPC transport: server keepalive pings, the client ping policy, message caps
+	// and connection limits. Zero ages and idle times mean no limit.
+	GRPCKeepaliveTime          time.Duration // ping a client after this long without activity
+	GRPCKeepaliveTimeout       time.Duration // close the connection when a ping goes unanswered this long
+	GRPCKeepaliveMinTime       time.Duration // clients pinging more often get GOAWAY (too_many_pings)
+	GRPCKeepalivePermitNoCalls bool          // allow client pings on connections with no active call
+	GRPCMaxRecvMsgBytes        int
+	GRPCMaxSendMsgBytes        int
+	GRPCMaxConcurrentStreams   int // per connection, 0 for no limit
+	GRPCMaxConnectionIdle      time.Duration
+	GRPCMaxConnectionAge       time.Duration
+	GRPCMaxConnectionAgeGrace  time.Duration // time calls get to finish once a connection reaches its age
+
+	BatchConcurrency int           // orders in flight per batch request
+	BatchTimeout     time.Duration // deadline for a whole batch
+
+	StrategyAllowUnknownTypes bool // accept configs whose type has no registered schema
 }
 
 type Server struct {
@@ -38,17 +233,215 @@ type Server struct {
 	db        *sql.DB
 	redis     *redis.Client
 	exchanges map[string]Exchange
-	mu        sync.RWMutex
+	prices    *PriceCache
+	tickers   *TickerCache
+	health    *HealthMonitor
+	apiKeys   *APIKeyStore
+
+	tokenIssuer   *HMACTokenIssuer
+	tokenVerifier TokenVerifier
+	tokenUsers    map[string]tokenUser
+
+	clientLimiter *ClientRateLimiter
+
+	// Drained on shutdown: exchange order calls, then the async DB writes they trigger
+	exchangeCalls sync.WaitGroup
+	dbWrites      sync.WaitGroup
+	orderJournal  *orderJournal // order rows waiting for Postgres; nil without a database
+
+	idempotency    idempotencyLocks
+	marketFetches  singleflight.Group // coalesces market data cache misses
+	batchStats     *batchMetrics
+	balanceFetches *balanceFetchMetrics
+	orderEvents    *OrderEventHub
+	fills          *FillStream
+	eventRelay     *orderEventRelay // nil unless events go to Redis
+	eventStream    *eventStream     // nil without ORDER_EVENTS_STREAM
+
+	strategyTimeseries *TimeseriesCache
+	exports            *exportJobs
+	exportS3           *s3Uploader // nil without EXPORT_S3_ENDPOINT
+	riskLimits         *RiskLimitStore
+	store              *Store // records orders and fills; nil without a database
+	// dbConnected is whether db has answered and its schema been checked; see
+	// runDatabaseRecovery
+	dbConnected    atomic.Bool
+	positionMethod position.Method
+
+	// Cancelled on shutdown so long-lived gRPC streams end and GracefulStop can finish
+	streamCtx   context.Context
+	stopStreams context.CancelFunc
+
+	// grpc.health.v1 status, derived from readiness
+	grpcHealth *grpcHealth
+
+	// Readiness: set once startup completes and the gRPC listener is bound
+	started       atomic.Bool
+	grpcListening atomic.Bool
+
+	mu sync.RWMutex
 }
 
 func loadConfig() *Config {
+	environment := getEnv("ENVIRONMENT", "development")
 	return &Config{
+		Environment:   environment,
 		GRPCPort:      getEnv("GRPC_PORT", "50050"),
 		HTTPPort:      getEnv("HTTP_PORT", "8080"),
 		DatabaseURL:   getEnv("DATABASE_URL", ""),
+		RunMigrations: getEnv("RUN_MIGRATIONS", "false") == "true",
 		RedisURL:      getEnv("REDIS_URL", "redis:6379"),
 		BinanceAPIKey: getEnv("BINANCE_API_KEY", ""),
 		BinanceSecret: getEnv("BINANCE_SECRET_KEY", ""),
+
+		RedisUsername:              getEnv("REDIS_USERNAME", ""),
+		RedisPassword:              getEnv("REDIS_PASSWORD", ""),
+		RedisDB:                    getEnvInt("REDIS_DB", -1),
+		RedisTLS:                   getEnv("REDIS_TLS", "false") == "true",
+		RedisTLSCAFile:             getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisTLSCertFile:           getEnv("REDIS_TLS_CERT_FILE", ""),
+		RedisTLSKeyFile:            getEnv("REDIS_TLS_KEY_FILE", ""),
+		RedisTLSInsecureSkipVerify: getEnv("REDIS_TLS_INSECURE_SKIP_VERIFY", "false") == "true",
+
+		BinanceFuturesAPIKey: getEnv("BINANCE_FUTURES_API_KEY", ""),
+		BinanceFuturesSecret: getEnv("BINANCE_FUTURES_SECRET_KEY", ""),
+
+		BinanceMarginEnabled: getEnv("BINANCE_MARGIN_ENABLED", "false") == "true",
+		MarginMinLevel:       getEnvFloat("MARGIN_MIN_LEVEL", 1.5),
+
+		CoinbaseAPIKey: getEnv("COINBASE_API_KEY", ""),
+		CoinbaseSecret: getEnv("COINBASE_SECRET_KEY", ""),
+
+		KucoinAPIKey:     getEnv("KUCOIN_API_KEY", ""),
+		KucoinSecret:     getEnv("KUCOIN_SECRET_KEY", ""),
+		KucoinPassphrase: getEnv("KUCOIN_PASSPHRASE", ""),
+
+		ExchangeRateLimitMode: getEnv("EXCHANGE_RATE_LIMIT_MODE", "local"),
+
+		PriceCacheMaxAge: getEnvDuration("PRICE_CACHE_MAX_AGE", 30*time.Second),
+		TickerCacheTTL:   getEnvDuration("TICKER_CACHE_TTL", 5*time.Second),
+		BalanceCacheTTL:  getEnvDuration("BALANCE_CACHE_TTL", 10*time.Second),
+
+		MarketDataCacheTTL:  getEnvDuration("MARKET_DATA_CACHE_TTL", time.Second),
+		OrderStatusCacheTTL: getEnvDuration("ORDER_STATUS_CACHE_TTL", 3*time.Hour),
+		LeaderboardEnabled:  getEnv("LEADERBOARD_ENABLED", "true") == "true",
+
+		BalanceFetchTimeout: getEnvDuration("BALANCE_FETCH_TIMEOUT", 3*time.Second),
+
+		HealthProbeInterval:    getEnvDuration("HEALTH_PROBE_INTERVAL", 15*time.Second),
+		OrderReconcileInterval: getEnvDuration("ORDER_RECONCILE_INTERVAL", 30*time.Second),
+		OrderReconcileBatch:    getEnvInt("ORDER_RECONCILE_BATCH", 100),
+		OrderReconcileMaxAge:   getEnvDuration("ORDER_RECONCILE_MAX_AGE", 7*24*time.Hour),
+		TradeArchiveAfter:      getEnvDuration("TRADE_ARCHIVE_AFTER", 365*24*time.Hour),
+		TradeArchiveBatch:      getEnvInt("TRADE_ARCHIVE_BATCH", 1000),
+		ExportDir:              getEnv("EXPORT_DIR", "data/exports"),
+		ExportS3Endpoint:       getEnv("EXPORT_S3_ENDPOINT", ""),
+		ExportS3Region:         getEnv("EXPORT_S3_REGION", "us-east-1"),
+		ExportS3AccessKey:      getEnv("EXPORT_S3_ACCESS_KEY", ""),
+		ExportS3SecretKey:      getEnv("EXPORT_S3_SECRET_KEY", ""),
+		ExportS3SessionToken:   getEnv("EXPORT_S3_SESSION_TOKEN", ""),
+		StrategyStatsInterval:  getEnvDuration("STRATEGY_STATS_INTERVAL", 15*time.Second),
+		GRPCHealthInterval:     getEnvDuration("GRPC_HEALTH_INTERVAL", 5*time.Second),
+		GRPCReflection:         getEnv("GRPC_REFLECTION", strconv.FormatBool(environment != "production")) == "true",
+		ExchangeUnhealthyGrace: getEnvDuration("EXCHANGE_UNHEALTHY_GRACE", 60*time.Second),
+
+		PaperEnabled:     getEnv("PAPER_TRADING_ENABLED", "true") == "true",
+		PaperBalances:    getEnv("PAPER_BALANCES", "USDT=100000"),
+		PaperFeeRate:     getEnvFloat("PAPER_FEE_RATE", 0.001),
+		PaperSlippageBps: getEnvFloat("PAPER_SLIPPAGE_BPS", 5),
+		PaperPriceSource: getEnv("PAPER_PRICE_SOURCE", "binance"),
+
+		ExchangeAccounts:     getEnv("EXCHANGE_ACCOUNTS", ""),
+		ExchangeAccountsFile: getEnv("EXCHANGE_ACCOUNTS_FILE", ""),
+
+		CredentialsKey: getEnv("EXCHANGE_CREDENTIALS_KEY", ""),
+
+		KlineWindowSize: getEnvInt("KLINE_WINDOW_SIZE", defaultKlineWindowSize),
+		KlineSymbols:    getEnvList("KLINE_SYMBOLS"),
+		KlinePersist:    getEnv("KLINE_PERSIST", "false") == "true",
+
+		OrderBookRecordExchange:  getEnv("ORDERBOOK_RECORD_EXCHANGE", "binance"),
+		OrderBookRecordSymbols:   getEnvList("ORDERBOOK_RECORD_SYMBOLS"),
+		OrderBookRecordInterval:  getEnvDuration("ORDERBOOK_RECORD_INTERVAL", 10*time.Second),
+		OrderBookRecordDepth:     getEnvInt("ORDERBOOK_RECORD_DEPTH", 20),
+		OrderBookRecordRetention: getEnvDuration("ORDERBOOK_RECORD_RETENTION", 7*24*time.Hour),
+		OrderBookRecordMaxRows:   getEnvInt("ORDERBOOK_RECORD_MAX_ROWS", 5000000),
+
+		BalanceSnapshotInterval: getEnvDuration("BALANCE_SNAPSHOT_INTERVAL", 5*time.Minute),
+		EquityFlowThreshold:     getEnvFloat("EQUITY_FLOW_THRESHOLD", 0.01),
+
+		OrderEventsRedisEnabled: getEnv("ORDER_EVENTS_REDIS_ENABLED", "false") == "true",
+		OrderEventsRedisPrefix:  getEnv("ORDER_EVENTS_REDIS_PREFIX", "orders"),
+		OrderEventsRedisBuffer:  getEnvInt("ORDER_EVENTS_REDIS_BUFFER", 1024),
+		OrderEventsStream:       getEnv("ORDER_EVENTS_STREAM", ""),
+		OrderEventsStreamMaxLen: getEnvInt("ORDER_EVENTS_STREAM_MAXLEN", 100000),
+		OrderEventsStreamGroup:  getEnv("ORDER_EVENTS_STREAM_GROUP", "default"),
+
+		APIAuthEnabled: getEnv("API_AUTH_ENABLED", "true") == "true",
+		APIKeyCacheTTL: getEnvDuration("API_KEY_CACHE_TTL", 60*time.Second),
+
+		APIKeyLookupRPS:   getEnvFloat("API_KEY_LOOKUP_RPS", 2),
+		APIKeyLookupBurst: getEnvFloat("API_KEY_LOOKUP_BURST", 10),
+
+		RiskLimitsCacheTTL:   getEnvDuration("RISK_LIMITS_CACHE_TTL", 30*time.Second),
+		PositionAccounting:   getEnv("POSITION_ACCOUNTING", string(position.WeightedAverage)),
+		MetricsToken:         getEnv("METRICS_TOKEN", ""),
+		SlowRequestThreshold: getEnvDuration("SLOW_REQUEST_THRESHOLD", time.Second),
+
+		AuthAcceptAPIKeys: getEnv("AUTH_ACCEPT_API_KEYS", "true") == "true",
+		JWTSecret:         getEnv("JWT_SECRET", ""),
+		JWTIssuer:         getEnv("JWT_ISSUER", "signalops-execution"),
+		JWTTTL:            getEnvDuration("JWT_TTL", 15*time.Minute),
+		AuthUsers:         getEnv("AUTH_USERS", ""),
+		AuthUsersFile:     getEnv("AUTH_USERS_FILE", ""),
+
+		RateLimitEnabled:    getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+		RateLimitReadRPS:    getEnvFloat("RATE_LIMIT_READ_RPS", 20),
+		RateLimitReadBurst:  getEnvFloat("RATE_LIMIT_READ_BURST", 40),
+		RateLimitOrderRPS:   getEnvFloat("RATE_LIMIT_ORDER_RPS", 5),
+		RateLimitOrderBurst: getEnvFloat("RATE_LIMIT_ORDER_BURST", 10),
+		RateLimitIdleTTL:    getEnvDuration("RATE_LIMIT_IDLE_TTL", 10*time.Minute),
+
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSMaxAge:         getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+
+		DBStatementTimeout: getEnvDuration("DB_STATEMENT_TIMEOUT", 10*time.Second),
+		DBConnectAttempts:  getEnvInt("DB_CONNECT_ATTEMPTS", 5),
+		DBConnectBackoff:   getEnvDuration("DB_CONNECT_BACKOFF", time.Second),
+		DBRecoveryInterval: getEnvDuration("DB_RECOVERY_INTERVAL", 10*time.Second),
+
+		DatabaseReplicaURL:     getEnv("DATABASE_REPLICA_URL", ""),
+		DBReplicaMaxLag:        getEnvDuration("DB_REPLICA_MAX_LAG", 30*time.Second),
+		DBReplicaCheckInterval: getEnvDuration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second),
+
+		OrderJournalPath:       getEnv("ORDER_JOURNAL_PATH", "data/order-journal.jsonl"),
+		OrderJournalAlertDepth: getEnvInt("ORDER_JOURNAL_ALERT_DEPTH", 10),
+		OrderDuplicateWait:     getEnvDuration("ORDER_DUPLICATE_WAIT", 3*time.Second),
+
+		HTTPReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		HTTPReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		HTTPWriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		HTTPIdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		MaxRequestBodyBytes:   int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 1<<20)),
+		MaxBatchBodyBytes:     int64(getEnvInt("MAX_BATCH_BODY_BYTES", 10<<20)),
+
+		GRPCKeepaliveTime:          getEnvDuration("GRPC_KEEPALIVE_TIME", 60*time.Second),
+		GRPCKeepaliveTimeout:       getEnvDuration("GRPC_KEEPALIVE_TIMEOUT", 20*time.Second),
+		GRPCKeepaliveMinTime:       getEnvDuration("GRPC_KEEPALIVE_MIN_TIME", 10*time.Second),
+		GRPCKeepalivePermitNoCalls: getEnv("GRPC_KEEPALIVE_PERMIT_WITHOUT_CALLS", "true") == "true",
+		GRPCMaxRecvMsgBytes:        getEnvInt("GRPC_MAX_RECV_MSG_BYTES", 16<<20),
+		GRPCMaxSendMsgBytes:        getEnvInt("GRPC_MAX_SEND_MSG_BYTES", 16<<20),
+		GRPCMaxConcurrentStreams:   getEnvInt("GRPC_MAX_CONCURRENT_STREAMS", 1000),
+		GRPCMaxConnectionIdle:      getEnvDuration("GRPC_MAX_CONNECTION_IDLE", 0),
+		GRPCMaxConnectionAge:       getEnvDuration("GRPC_MAX_CONNECTION_AGE", 0),
+		GRPCMaxConnectionAgeGrace:  getEnvDuration("GRPC_MAX_CONNECTION_AGE_GRACE", 30*time.Second),
+
+		BatchConcurrency: getEnvInt("BATCH_CONCURRENCY", 5),
+		BatchTimeout:     getEnvDuration("BATCH_TIMEOUT", 30*time.Second),
+
+		StrategyAllowUnknownTypes: getEnv("STRATEGY_ALLOW_UNKNOWN_TYPES", "false") == "true",
 	}
 }
 
@@ -59,39 +452,213 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: invalid integer for %s: %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: invalid number for %s: %q, using %g", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: invalid duration for %s: %q, using %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvList parses a comma-separated environment variable, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func main() {
-	log.Println("Starting SignalOps Go Execution Engine...")
+	// Key management subcommand: execution-engine apikey create|list|revoke
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(os.Args[2:]))
+	}
+	// Schema subcommand: execution-engine migrate [status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+	// Candle history subcommand: execution-engine backfill-klines --symbol S --start T
+	if len(os.Args) > 1 && os.Args[1] == "backfill-klines" {
+		os.Exit(runBackfillKlinesCommand(os.Args[2:]))
+	}
+	// Retention subcommand: execution-engine archive-trades [--older-than DURATION]
+	if len(os.Args) > 1 && os.Args[1] == "archive-trades" {
+		os.Exit(runArchiveTradesCommand(os.Args[2:]))
+	}
+	// PnL subcommand: execution-engine recompute-pnl [--strategy NAME]
+	if len(os.Args) > 1 && os.Args[1] == "recompute-pnl" {
+		os.Exit(runRecomputePnLCommand(os.Args[2:]))
+	}
 
 	config := loadConfig()
+	log.Printf("Starting SignalOps Go Execution Engine %s (%s)...", version, config.Environment)
 
 	// Initialize database
-	db, err := initDatabase(config.DatabaseURL)
-	if err != nil {
-		log.Printf("Warning: Database connection failed: %v", err)
-		db = nil // Continue without DB for now
-	} else {
-		defer db.Close()
+	db, err := connectDatabase(config)
+	if errors.Is(err, errSchemaOutdated) {
+		log.Fatalf("Database not usable: %v", err)
+	}
+	dbConnected := err == nil
+	switch {
+	case err == nil && dialectForURL(config.DatabaseURL) == dialectSQLite:
+		log.Println("✓ Using SQLite database (local development only)")
+	case err == nil:
 		log.Println("✓ Connected to PostgreSQL")
+	case config.DatabaseURL != "" && config.DBRecoveryInterval > 0:
+		// Start with a pool that connects once Postgres is back (runDatabaseRecovery)
+		log.Printf("Warning: Database connection failed: %v; retrying every %s", err, config.DBRecoveryInterval)
+		if db, err = newDatabasePool(config.DatabaseURL); err != nil {
+			log.Printf("Warning: Database unusable: %v", err)
+			db = nil
+		}
+	default:
+		log.Printf("Warning: Database connection failed: %v", err)
+		db = nil // Continue without DB
 	}
 
-	// Initialize Redis
-	redisClient := initRedis(config.RedisURL)
-	defer redisClient.Close()
+	// Initialize Redis (closed by shutdown)
+	redisClient, err := initRedis(config)
+	if err != nil {
+		log.Fatalf("Invalid Redis configuration: %v", err)
+	}
 
 	// Ping Redis
 	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Printf("Warning: Redis connection failed: %v", err)
+		kind := redisErrorKind(err)
+		if hint := redisConnectHint(kind); hint != "" {
+			log.Printf("Warning: Redis connection failed (%s error): %v; %s", kind, err, hint)
+		} else {
+			log.Printf("Warning: Redis connection failed: %v", err)
+		}
 	} else {
-		log.Println("✓ Connected to Redis")
+		log.Printf("✓ Connected to Redis (db %d, tls %t)", redisClient.Options().DB, redisClient.Options().TLSConfig != nil)
 	}
 
 	// Create server
 	server := &Server{
-		config:    config,
-		db:        db,
-		redis:     redisClient,
-		exchanges: make(map[string]Exchange),
+		config:         config,
+		db:             db,
+		redis:          redisClient,
+		exchanges:      make(map[string]Exchange),
+		batchStats:     newBatchMetrics(),
+		balanceFetches: newBalanceFetchMetrics(),
+		orderEvents:    NewOrderEventHub(),
+		fills:          NewFillStream(),
+		exports:        newExportJobs(),
+	}
+	server.streamCtx, server.stopStreams = context.WithCancel(context.Background())
+	server.dbConnected.Store(dbConnected)
+	if config.OrderEventsStream != "" {
+		server.eventStream = &eventStream{client: redisClient, name: config.OrderEventsStream,
+			maxLen: int64(config.OrderEventsStreamMaxLen), group: config.OrderEventsStreamGroup}
+		log.Printf("✓ Order events and fills appended to Redis stream %s (group %s)",
+			config.OrderEventsStream, config.OrderEventsStreamGroup)
+	}
+	if config.OrderEventsRedisEnabled || server.eventStream != nil {
+		prefix := ""
+		if config.OrderEventsRedisEnabled {
+			prefix = config.OrderEventsRedisPrefix
+			log.Printf("✓ Order events published to Redis channels %s:*", prefix)
+		}
+		server.eventRelay = newOrderEventRelay(redisClient, prefix, server.eventStream, config.OrderEventsRedisBuffer)
+		server.orderEvents.relay = server.eventRelay
+		go server.eventRelay.run(server.streamCtx)
+	}
+	switch config.ExchangeRateLimitMode {
+	case "local":
+	case "distributed":
+		// Set before any exchange is created: adapters pick it up in their constructors
+		distributedRateLimits = redisClient
+		log.Println("✓ Exchange rate limits shared through Redis")
+	default:
+		log.Fatalf("Invalid EXCHANGE_RATE_LIMIT_MODE %q: must be local or distributed", config.ExchangeRateLimitMode)
+	}
+	if server.positionMethod, err = position.ParseMethod(config.PositionAccounting); err != nil {
+		log.Fatalf("Invalid POSITION_ACCOUNTING: %v", err)
+	}
+	server.grpcHealth = newGRPCHealth(server)
+
+	// Order rows a previous run could not write are replayed before the ports open
+	if db != nil {
+		server.riskLimits = NewRiskLimitStore(db, config.RiskLimitsCacheTTL)
+		server.store = NewStore(db, dialectForURL(config.DatabaseURL), server.positionMethod, server.riskLimits)
+		if replica := openReplica(config); replica != nil {
+			server.store.attachReplica(replica)
+		}
+		if server.orderJournal, err = openOrderJournal(config.OrderJournalPath, config.OrderJournalAlertDepth); err != nil {
+			log.Fatalf("Order journal unavailable: %v", err)
+		}
+		server.replayOrderJournal()
+		go server.runOrderJournal()
+	}
+
+	// Client API keys for the REST API
+	if db != nil {
+		aead, err := server.credentialsCipher()
+		if err != nil {
+			log.Printf("Warning: signed API keys unavailable: %v", err)
+		}
+		server.apiKeys = NewAPIKeyStore(db, config.APIKeyCacheTTL, aead)
+		if config.APIKeyLookupRPS > 0 {
+			server.apiKeys.lookups = NewClientRateLimiter(config.APIKeyLookupRPS, config.APIKeyLookupBurst,
+				config.APIKeyLookupRPS, config.APIKeyLookupBurst, config.RateLimitIdleTTL)
+			go server.apiKeys.lookups.startCleanup()
+		}
+		go server.apiKeys.startCleanup()
+	}
+	if config.JWTSecret != "" {
+		server.tokenIssuer = NewHMACTokenIssuer(config.JWTSecret, config.JWTIssuer, config.JWTTTL)
+		server.tokenVerifier = server.tokenIssuer
+		users, err := loadTokenUsers(config)
+		if err != nil {
+			log.Fatalf("Invalid auth users: %v", err)
+		}
+		server.tokenUsers = users
+		log.Printf("✓ JWT auth enabled (%d token users, API keys accepted: %t)", len(users), config.AuthAcceptAPIKeys)
+	}
+	if config.RateLimitEnabled {
+		server.clientLimiter = NewClientRateLimiter(config.RateLimitReadRPS, config.RateLimitReadBurst,
+			config.RateLimitOrderRPS, config.RateLimitOrderBurst, config.RateLimitIdleTTL)
+		go server.clientLimiter.startCleanup()
+		log.Printf("✓ Client rate limits: %.0f reads/s (burst %.0f), %.0f orders/s (burst %.0f)",
+			config.RateLimitReadRPS, config.RateLimitReadBurst, config.RateLimitOrderRPS, config.RateLimitOrderBurst)
+	}
+	if !config.APIAuthEnabled {
+		log.Println("Warning: API_AUTH_ENABLED=false, REST and gRPC APIs are unauthenticated")
+	}
+
+	// USD valuation of balances uses public Binance tickers, so no credentials are needed
+	server.prices = NewPriceCache(NewBinanceExchange("", "").GetAllTickers, config.PriceCacheMaxAge)
+	server.tickers = NewTickerCache(config.TickerCacheTTL)
+	server.strategyTimeseries = NewTimeseriesCache()
+	if server.exportS3, err = newS3Uploader(config); err != nil {
+		log.Fatalf("Invalid export configuration: %v", err)
 	}
 
 	// Initialize exchanges
@@ -99,57 +666,196 @@ func main() {
 		binance := NewBinanceExchange(config.BinanceAPIKey, config.BinanceSecret)
 		server.exchanges["binance"] = binance
 		log.Println("✓ Binance exchange initialized")
+
+		// Kline streams: optional persistence of closed candles and pre-warmed symbols
+		var onClosed func(symbol, interval string, klines []Kline)
+		if config.KlinePersist && db != nil {
+			onClosed = func(symbol, interval string, klines []Kline) {
+				server.saveKlines("binance", symbol, interval, klines)
+			}
+		}
+		binance.ConfigureKlineStreams(config.KlineWindowSize, onClosed)
+		for _, symbol := range config.KlineSymbols {
+			binance.klineStreams.Subscribe(symbol, "1m")
+		}
+
+		if config.BinanceMarginEnabled {
+			server.exchanges["binance_margin"] = NewBinanceMarginExchange(binance, config.MarginMinLevel)
+			log.Printf("✓ Binance margin account initialized (min margin level %.2f)", config.MarginMinLevel)
+		}
+	}
+
+	if config.BinanceFuturesAPIKey != "" {
+		server.exchanges["binance_futures"] = NewBinanceFuturesExchange(config.BinanceFuturesAPIKey, config.BinanceFuturesSecret)
+		log.Println("✓ Binance USDT-M futures exchange initialized")
+	}
+
+	if config.CoinbaseAPIKey != "" {
+		coinbase, err := NewCoinbaseExchange(config.CoinbaseAPIKey, config.CoinbaseSecret)
+		if err != nil {
+			log.Printf("Warning: Coinbase exchange not initialized: %v", err)
+		} else {
+			server.exchanges["coinbase"] = coinbase
+			log.Println("✓ Coinbase Advanced Trade exchange initialized")
+		}
+	}
+
+	if config.KucoinAPIKey != "" {
+		server.exchanges["kucoin"] = NewKucoinExchange(config.KucoinAPIKey, config.KucoinSecret, config.KucoinPassphrase)
+		log.Println("✓ KuCoin exchange initialized")
+	}
+
+	// Named accounts from EXCHANGE_ACCOUNTS / EXCHANGE_ACCOUNTS_FILE
+	accountSpecs, err := loadAccountSpecs(config)
+	if err != nil {
+		log.Fatalf("Invalid exchange accounts: %v", err)
+	}
+	for _, spec := range accountSpecs {
+		exchange, err := server.newExchangeFromSpec(spec)
+		if err != nil {
+			log.Printf("Warning: exchange account %s not initialized: %v", spec.Name, err)
+			continue
+		}
+		server.exchanges[spec.Name] = exchange
+		log.Printf("✓ Exchange account %s (%s) initialized", spec.Name, spec.Type)
+	}
+
+	// Exchanges registered through the API with persist=true
+	server.loadPersistedExchanges()
+
+	// Paper trading is registered by default so there is always a working exchange
+	if config.PaperEnabled {
+		balances, err := parsePaperBalances(config.PaperBalances)
+		if err != nil {
+			log.Fatalf("Invalid PAPER_BALANCES: %v", err)
+		}
+
+		// Price from a configured exchange, or public Binance tickers without credentials
+		pricer, exists := server.exchanges[config.PaperPriceSource]
+		if !exists {
+			pricer = NewBinanceExchange("", "")
+		}
+
+		server.exchanges["paper"] = NewPaperExchange(pricer, balances, config.PaperFeeRate, config.PaperSlippageBps/10000)
+		log.Printf("✓ Paper trading exchange initialized (fee %.4f, slippage %.1f bps)", config.PaperFeeRate, config.PaperSlippageBps)
 	}
 
+	// Exchange connectivity probes
+	server.health = NewHealthMonitor(config.HealthProbeInterval, config.ExchangeUnhealthyGrace)
+	go server.startHealthProbes()
+
+	// Postgres reconnection when it was down at startup or goes away
+	go server.runDatabaseRecovery()
+
+	// Analytics reads on the read replica while it keeps up (DATABASE_REPLICA_URL)
+	go server.runReplicaMonitor()
+
+	// PnL snapshots for the fill event stream
+	go server.runPnLSnapshots()
+
+	// Order book samples for research (ORDERBOOK_RECORD_SYMBOLS)
+	go server.runOrderBookRecorder()
+
+	// Account values for the equity curve (BALANCE_SNAPSHOT_INTERVAL)
+	go server.runBalanceSnapshots()
+
+	// strategies.total_pnl, win_rate, total_trades and last_executed_at from trades
+	go server.runStrategyStats()
+
+	// Strategy leaderboard in Redis, rebuilt from the strategies table
+	go server.runLeaderboard()
+
+	// Positions from trades the exchanges report, including fills of resting orders
+	server.followExecutions()
+
+	// Fills of resting orders the exchanges do not push
+	go server.runOrderReconciliation()
+
+	// Server state read at scrape time by /metrics
+	prometheus.MustRegister(engineCollector{server})
+
 	// Start gRPC server
-	go server.startGRPCServer()
+	grpcServer := server.newGRPCServer()
+	go server.startGRPCServer(grpcServer, listen("gRPC", config.GRPCPort))
 
 	// Start HTTP server (for health checks and REST fallback)
-	go server.startHTTPServer()
+	httpServer := server.newHTTPServer()
+	go server.startHTTPServer(httpServer, listen("HTTP", config.HTTPPort))
+
+	// Both ports are bound and the exchange registry is built
+	server.markReady()
+	go server.grpcHealth.run(config.GRPCHealthInterval)
 
 	// Wait for shutdown signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down servers...")
+	server.shutdown(httpServer, grpcServer)
 }
 
-func (s *Server) startGRPCServer() {
-	lis, err := net.Listen("tcp", ":"+s.config.GRPCPort)
-	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", s.config.GRPCPort, err)
-	}
-
-	grpcServer := grpc.NewServer()
+func (s *Server) newGRPCServer() *grpc.Server {
+	options := s.grpcTransportOptions()
+	// Interceptors, outermost first: request ID and access log, latency, panic recovery, then auth
+	options = append(options,
+		grpc.ChainUnaryInterceptor(grpcUnaryLogging, grpcUnaryMetrics, grpcUnaryRecovery, s.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(grpcStreamLogging, grpcStreamMetrics, grpcStreamRecovery, s.grpcStreamAuth),
+	)
+	grpcServer := grpc.NewServer(options...)
 	// Register gRPC ExecutionService
 	pb.RegisterExecutionServiceServer(grpcServer, s)
+	// Standard health checks for the service mesh, following /readyz
+	healthpb.RegisterHealthServer(grpcServer, s.grpcHealth)
+	// Lets grpcurl and similar tools discover the services without the .proto files
+	if s.config.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+	return grpcServer
+}
 
-	log.Printf("✓ gRPC server listening on port %s", s.config.GRPCPort)
+func (s *Server) startGRPCServer(grpcServer *grpc.Server, lis net.Listener) {
+	s.grpcListening.Store(true)
+	log.Printf("✓ gRPC server listening on port %s (reflection: %t)", s.config.GRPCPort, s.config.GRPCReflection)
 
-	if err := grpcServer.Serve(lis); err != nil {
+	if err := grpcServer.Serve(grpcConnListener{lis}); err != nil {
 		log.Fatalf("Failed to serve gRPC: %v", err)
 	}
 }
 
-func (s *Server) startHTTPServer() {
+func (s *Server) newHTTPServer() *http.Server {
 	mux := http.NewServeMux()
 
-	// Health check endpoint
+	// Probes: /livez for restarts, /readyz for routing traffic
+	mux.HandleFunc("/livez", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+
+	// Health check endpoint, kept for existing clients: readiness plus exchange detail
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy","service":"signalops-go-execution"}`))
-	})
+		snapshot := s.health.Snapshot()
+		ready, checks := s.readiness(r.Context())
+
+		status, code := "healthy", http.StatusOK
+		for _, h := range snapshot {
+			if !h.Up {
+				status = "degraded"
+				break
+			}
+		}
+		if !ready {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+		}
 
-	// Metrics endpoint (basic)
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "# SignalOps Execution Engine Metrics\n")
-		fmt.Fprintf(w, "signalops_exchanges_connected %d\n", len(s.exchanges))
-		fmt.Fprintf(w, "signalops_uptime_seconds %.0f\n", time.Since(startTime).Seconds())
+		writeJSON(w, code, map[string]interface{}{
+			"status":    status,
+			"service":   "signalops-go-execution",
+			"checks":    checks,
+			"exchanges": exchangeHealthJSON(snapshot),
+		})
 	})
 
+	// Prometheus metrics; see metrics.go
+	mux.Handle("/metrics", metricsHandler())
+
 	// REST API endpoints (fallback for Python client)
 	s.registerRESTEndpoints(mux)
 
@@ -159,19 +865,89 @@ func (s *Server) startHTTPServer() {
 	// Portfolio & risk endpoints
 	s.registerPortfolioEndpoints(mux)
 
+	// Runtime exchange management
+	s.registerExchangeEndpoints(mux)
+
+	// Token issuing
+	s.registerAuthEndpoints(mux)
+
+	// Live order updates over websocket
+	s.registerOrderStreamEndpoints(mux)
+
+	// Parquet exports for research
+	s.registerExportEndpoints(mux)
+
+	// Fills and PnL snapshots as server-sent events
+	s.registerFillStreamEndpoints(mux)
+
+	// Replays recorded orders into the Redis event stream
+	s.registerEventStreamEndpoints(mux)
+
+	// Strategy rankings from Redis sorted sets
+	s.registerLeaderboardEndpoints(mux)
+
+	// Shared market data stream over websocket
+	s.registerMarketStreamEndpoints(mux)
+
+	srv := &http.Server{
+		Addr:              ":" + s.config.HTTPPort,
+		Handler:           s.requestLogging(s.routeMetrics(mux, s.cors(s.limitRequestBody(s.requireAuth(s.rateLimit(mux)))))),
+		ReadHeaderTimeout: s.config.HTTPReadHeaderTimeout,
+		ReadTimeout:       s.config.HTTPReadTimeout,
+		WriteTimeout:      s.config.HTTPWriteTimeout,
+		IdleTimeout:       s.config.HTTPIdleTimeout,
+	}
+	// Event streams never finish on their own, so end them when draining starts
+	srv.RegisterOnShutdown(s.fills.close)
+	return srv
+}
+
+func (s *Server) startHTTPServer(httpServer *http.Server, lis net.Listener) {
 	log.Printf("✓ HTTP server listening on port %s", s.config.HTTPPort)
 
-	if err := http.ListenAndServe(":"+s.config.HTTPPort, mux); err != nil {
+	if err := httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("HTTP server failed: %v", err)
 	}
 }
 
-func initDatabase(dbURL string) (*sql.DB, error) {
-	if dbURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL not set")
+// initDatabase connects to Postgres, applies pending migrations when migrate is
+// set, and fails with errSchemaOutdated when the schema is behind this binary.
+// A SQLite database gets its schema created instead.
+func initDatabase(dbURL string, migrate bool) (*sql.DB, error) {
+	db, err := openDatabase(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareDatabase(db, dialectForURL(dbURL), migrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// prepareDatabase is the schema half of initDatabase, for a pool that is already
+// connected
+func prepareDatabase(db *sql.DB, dialect sqlDialect, migrate bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	if dialect == dialectSQLite {
+		return prepareSQLite(ctx, db)
+	}
+	if migrate {
+		ran, err := runMigrations(ctx, db)
+		for _, m := range ran {
+			log.Printf("✓ Applied migration %d (%s)", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errSchemaOutdated, err)
+		}
 	}
+	return checkSchemaVersion(ctx, db)
+}
 
-	db, err := sql.Open("postgres", dbURL)
+func openDatabase(dbURL string) (*sql.DB, error) {
+	db, err := newDatabasePool(dbURL)
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +957,34 @@ func initDatabase(dbURL string) (*sql.DB, error) {
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// newDatabasePool opens a pool without connecting; sql.Open only checks dbURL
+func newDatabasePool(dbURL string) (*sql.DB, error) {
+	if dbURL == "" {
+		return nil, fmt.Errorf("DATABASE_URL not set")
+	}
+
+	if dialectForURL(dbURL) == dialectSQLite {
+		dsn, err := sqliteDSN(dbURL)
+		if err != nil {
+			return nil, err
+		}
+		db, err := sql.Open(instrumentedSQLiteDriver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		// Writers take turns on the file anyway; WAL lets readers run alongside
+		db.SetMaxOpenConns(4)
+		return db, nil
+	}
+
+	db, err := sql.Open(instrumentedPostgresDriver, dbURL)
+	if err != nil {
 		return nil, err
 	}
 
@@ -192,26 +996,34 @@ func initDatabase(dbURL string) (*sql.DB, error) {
 	return db, nil
 }
 
-func initRedis(redisURL string) *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:         redisURL,
-		Password:     "",
-		DB:           0,
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-		PoolSize:     10,
-	})
+// dbContext bounds the database calls made under ctx by DB_STATEMENT_TIMEOUT.
+// Rows must be read before cancel is called.
+func (s *Server) dbContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.DBStatementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.config.DBStatementTimeout)
+}
+
+func initRedis(config *Config) (*redis.Client, error) {
+	opts, err := redisOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
 }
 
 var startTime = time.Now()
 
-// Exchange interface for different exchange implementations
+// Exchange is implemented by every exchange adapter. Calls take the caller's
+// context: a cancelled request or an expired deadline aborts the exchange round
+// trip, and logs carry the request ID.
 type Exchange interface {
-	GetMarketData(symbol string) (*MarketData, error)
-	SubmitOrder(order *Order) (*OrderResult, error)
-	GetOrderStatus(orderID string) (*OrderStatus, error)
-	GetBalance() (*Balance, error)
+	GetMarketData(ctx context.Context, symbol string) (*MarketData, error)
+	SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error)
+	GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error)
+	GetBalance(ctx context.Context) (*Balance, error)
+	Ping(ctx context.Context) error // connectivity and credential check used by health probes
 }
 
 // Common types
@@ -235,6 +1047,14 @@ type Order struct {
 	Price        float64
 	OrderType    string
 	StrategyName string
+
+	// Futures-only fields, ignored by spot exchanges
+	ReduceOnly   bool
+	PositionSide string // BOTH, LONG or SHORT (hedge mode)
+
+	// Margin-only fields
+	AccountType    string // spot (default) or margin
+	SideEffectType string // NO_SIDE_EFFECT, MARGIN_BUY, AUTO_REPAY, AUTO_BORROW_REPAY
 }
 
 type OrderResult struct {
@@ -243,7 +1063,8 @@ type OrderResult struct {
 	Status           string
 	ExecutedPrice    float64
 	ExecutedQuantity float64
-	Fees             float64
+	Fees             float64            // in the quote currency
+	FeeAssets        map[string]float64 // commission by asset that could not be valued in the quote currency
 	Timestamp        time.Time
 }
 
@@ -257,10 +1078,12 @@ type OrderStatus struct {
 }
 
 type Balance struct {
-	Exchange      string
-	Balances      map[string]AssetBalance
-	TotalValueUSD float64
-	Timestamp     time.Time
+	Exchange       string
+	Balances       map[string]AssetBalance
+	TotalValueUSD  float64
+	MarginLevel    float64  // margin accounts only, 0 otherwise
+	UnpricedAssets []string // assets that could not be valued in USD
+	Timestamp      time.Time
 }
 
 type AssetBalance struct {
@@ -269,4 +1092,19 @@ type AssetBalance struct {
 	Locked   float64
 	Total    float64
 	ValueUSD float64
+	Borrowed float64 // margin accounts only
+	Interest float64 // margin accounts only
+}
+
+// accountTypeForExchange maps an exchange key to the account type recorded on trades
+func accountTypeForExchange(exchange string) string {
+	exchange, _ = splitExchangeKey(exchange)
+	switch exchange {
+	case "binance_margin":
+		return "margin"
+	case "binance_futures":
+		return "futures"
+	default:
+		return "spot"
+	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/metadata"
+)
+
+// marketDataCachePrefix namespaces cached quotes in Redis, keyed by exchange and symbol
+const marketDataCachePrefix = "market:"
+
+// cacheBypassMetadata set to "true" makes GetMarketData read the exchange and
+// GetOrderStatus skip the order status cache; REST callers pass ?force=true
+const cacheBypassMetadata = "cache-bypass"
+
+// marketDataFetchTimeout bounds a coalesced fetch, which outlives the caller that
+// started it when that caller goes away
+const marketDataFetchTimeout = 10 * time.Second
+
+// cachedMarketData returns a quote from Redis when it is younger than
+// MARKET_DATA_CACHE_TTL, otherwise fetches and caches it. Concurrent misses for the
+// same symbol on this instance share one exchange call. force skips the cache
+// read. MarketData.Timestamp is the fetch time either way; the bool reports a hit.
+// Redis errors fall back to fetching, so the cache never fails a request.
+func (s *Server) cachedMarketData(ctx context.Context, exchangeName string, exchange Exchange, symbol string,
+	force bool) (*MarketData, bool, error) {
+	key := marketDataCachePrefix + exchangeName + ":" + symbol
+	ttl := s.config.MarketDataCacheTTL
+	useCache := s.redis != nil && ttl > 0
+	if force {
+		recordCacheLookup("market_data", "bypass")
+		data, err := exchange.GetMarketData(ctx, symbol)
+		if err == nil && useCache {
+			s.cacheMarketData(ctx, key, data, ttl)
+		}
+		return data, false, err
+	}
+	if useCache {
+		raw, err := s.redis.Get(ctx, key).Bytes()
+		switch {
+		case err == nil:
+			var data MarketData
+			if err := json.Unmarshal(raw, &data); err == nil {
+				recordCacheLookup("market_data", "hit")
+				return &data, true, nil
+			}
+		case errors.Is(err, redis.Nil):
+		default:
+			recordCacheLookup("market_data", "error")
+			logEvent(ctx, "Market data cache unavailable", "exchange", exchangeName, "symbol", symbol, "error", err)
+		}
+	}
+
+	leader := false
+	result := s.marketFetches.DoChan(key, func() (interface{}, error) {
+		leader = true
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), marketDataFetchTimeout)
+		defer cancel()
+		data, err := exchange.GetMarketData(fetchCtx, symbol)
+		if err == nil && useCache {
+			s.cacheMarketData(fetchCtx, key, data, ttl)
+		}
+		return data, err
+	})
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case r := <-result:
+		// leader is set before the result is sent, and only where the fetch started
+		if leader {
+			recordCacheLookup("market_data", "miss")
+		} else {
+			recordCacheLookup("market_data", "coalesced")
+		}
+		if r.Err != nil {
+			return nil, false, r.Err
+		}
+		return r.Val.(*MarketData), false, nil
+	}
+}
+
+func (s *Server) cacheMarketData(ctx context.Context, key string, data *MarketData, ttl time.Duration) {
+	raw, _ := json.Marshal(data)
+	if err := s.redis.Set(ctx, key, raw, ttl).Err(); err != nil {
+		logEvent(ctx, "Failed to cache market data", "key", key, "error", err)
+	}
+}
+
+// cacheBypassRequested reports whether the call asks to skip the Redis cache
+func cacheBypassRequested(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(cacheBypassMetadata)
+	return len(values) > 0 && values[0] == "true"
+}
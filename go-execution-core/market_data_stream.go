@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// marketDataPollInterval paces StreamMarketData on exchanges without a market
+// stream when the client set no min_interval_ms
+const marketDataPollInterval = time.Second
+
+// StreamMarketData pushes market data for req.Symbols until the client cancels.
+// Exchanges with a websocket market stream share it with /api/v1/ws/market;
+// others are polled through GetMarketData. With min_interval_ms set, each symbol
+// is sent at most once per interval, carrying its latest tick. Clients change
+// symbols by opening another stream.
+func (s *Server) StreamMarketData(req *pb.StreamMarketDataRequest, stream pb.ExecutionService_StreamMarketDataServer) error {
+	exchangeName := req.Exchange
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+	if req.MinIntervalMs < 0 {
+		return status.Error(codes.InvalidArgument, "min_interval_ms must not be negative")
+	}
+	interval := time.Duration(req.MinIntervalMs) * time.Millisecond
+
+	s.mu.RLock()
+	exchange, exists := s.exchanges[exchangeName]
+	s.mu.RUnlock()
+	if !exists {
+		return status.Errorf(codes.NotFound, "exchange %s not configured", exchangeName)
+	}
+	symbols, err := marketSymbols(exchange, req.Symbols)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(symbols) > maxMarketSymbolsPerConn {
+		return status.Errorf(codes.InvalidArgument, "at most %d symbols per stream", maxMarketSymbolsPerConn)
+	}
+
+	for _, symbol := range symbols {
+		gauge := marketDataStreams.WithLabelValues(exchangeName, symbol)
+		gauge.Inc()
+		defer gauge.Dec()
+	}
+	ctx := stream.Context()
+	logEvent(ctx, "Market data stream opened", "exchange", exchangeName, "symbols", len(symbols), "min_interval", interval)
+
+	if streamer, ok := exchange.(marketStreamer); ok {
+		err = s.streamMarketTicks(ctx, stream, streamer.MarketStream(), exchangeName, symbols, interval)
+	} else {
+		err = s.pollMarketData(ctx, stream, exchange, exchangeName, symbols, interval)
+	}
+	logEvent(ctx, "Market data stream closed", "exchange", exchangeName, "error", err)
+	return err
+}
+
+// streamMarketTicks relays ticks from the shared upstream stream, holding back
+// the latest tick of each symbol until its interval has passed
+func (s *Server) streamMarketTicks(ctx context.Context, stream pb.ExecutionService_StreamMarketDataServer,
+	manager *MarketStreamManager, exchangeName string, symbols []string, interval time.Duration) error {
+	sub := manager.newSubscriber()
+	send := sub.send // Remove clears sub.send
+	defer manager.Remove(sub)
+	if err := manager.Subscribe(sub, symbols); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	lastSent := make(map[string]time.Time, len(symbols))
+	pending := make(map[string]*MarketTick)
+	var flush <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.streamCtx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case msg, ok := <-send:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "stream fell behind and was dropped")
+			}
+			tick, isTick := msg.(*MarketTick)
+			if !isTick {
+				continue
+			}
+			if interval > 0 && time.Since(lastSent[tick.Symbol]) < interval {
+				pending[tick.Symbol] = tick
+				continue
+			}
+			if err := stream.Send(marketTickProto(exchangeName, tick)); err != nil {
+				return err
+			}
+			lastSent[tick.Symbol] = time.Now()
+		case <-flush:
+			for symbol, tick := range pending {
+				if time.Since(lastSent[symbol]) < interval {
+					continue
+				}
+				if err := stream.Send(marketTickProto(exchangeName, tick)); err != nil {
+					return err
+				}
+				lastSent[symbol] = time.Now()
+				delete(pending, symbol)
+			}
+		}
+	}
+}
+
+// pollMarketData is the fallback for exchanges without a market stream. A failed
+// fetch skips that symbol for the round rather than ending the stream.
+func (s *Server) pollMarketData(ctx context.Context, stream pb.ExecutionService_StreamMarketDataServer,
+	exchange Exchange, exchangeName string, symbols []string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = marketDataPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, symbol := range symbols {
+			data, err := exchange.GetMarketData(ctx, symbol)
+			if err != nil {
+				logEvent(ctx, "Market data poll failed", "exchange", exchangeName, "symbol", symbol, "error", err)
+				continue
+			}
+			if err := stream.Send(marketDataProto(symbol, exchangeName, data)); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.streamCtx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+func marketTickProto(exchange string, tick *MarketTick) *pb.MarketDataResponse {
+	return &pb.MarketDataResponse{
+		Symbol:     tick.Symbol,
+		Exchange:   exchange,
+		Price:      tick.Price,
+		Bid:        tick.Bid,
+		Ask:        tick.Ask,
+		Volume_24H: tick.Volume24h,
+		Timestamp:  timestamppb.New(tick.Timestamp),
+	}
+}
+
+// marketDataProto converts an exchange snapshot, as returned by GetMarketData
+func marketDataProto(symbol, exchange string, data *MarketData) *pb.MarketDataResponse {
+	resp := &pb.MarketDataResponse{
+		Symbol:          symbol,
+		Exchange:        exchange,
+		Price:           data.Price,
+		Bid:             data.Bid,
+		Ask:             data.Ask,
+		Volume_24H:      data.Volume24h,
+		High_24H:        data.High24h,
+		Low_24H:         data.Low24h,
+		PriceChange_24H: data.PriceChange,
+		Timestamp:       timestamppb.New(data.Timestamp),
+	}
+	if data.Price != 0 {
+		resp.PriceChangePct_24H = data.PriceChange / data.Price * 100
+	}
+	return resp
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Market data fan-out: one combined Binance stream per exchange carries the
+// <symbol>@ticker streams every client has asked for, and each tick is copied to
+// the subscribers of its symbol. Upstream subscriptions follow demand through the
+// SUBSCRIBE/UNSUBSCRIBE methods instead of reconnecting.
+
+const (
+	marketTickBuffer        = 256 // per-connection; a client this far behind is dropped
+	maxMarketSymbolsPerConn = 100
+)
+
+// MarketTick is a ticker update pushed to /api/v1/ws/market clients
+type MarketTick struct {
+	Type      string    `json:"type"`
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	Bid       float64   `json:"bid"`
+	Ask       float64   `json:"ask"`
+	Volume24h float64   `json:"volume_24h"`
+	Timestamp time.Time `json:"timestamp"`
+	Stale     bool      `json:"stale,omitempty"` // first tick after an upstream reconnect; updates were missed
+}
+
+// tickerEvent is the payload of the Binance <symbol>@ticker stream
+type tickerEvent struct {
+	EventTime int64  `json:"E"`
+	Symbol    string `json:"s"`
+	Last      string `json:"c"`
+	Bid       string `json:"b"`
+	Ask       string `json:"a"`
+	Volume    string `json:"v"`
+}
+
+func (ev *tickerEvent) toTick() (*MarketTick, error) {
+	tick := &MarketTick{Type: "tick", Symbol: ev.Symbol, Timestamp: time.UnixMilli(ev.EventTime)}
+	for _, field := range []struct {
+		raw string
+		dst *float64
+	}{{ev.Last, &tick.Price}, {ev.Bid, &tick.Bid}, {ev.Ask, &tick.Ask}, {ev.Volume, &tick.Volume24h}} {
+		v, err := strconv.ParseFloat(field.raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ticker value '%s': %w", field.raw, err)
+		}
+		*field.dst = v
+	}
+	return tick, nil
+}
+
+// marketSubscriber is one client connection and the symbols it follows
+type marketSubscriber struct {
+	send    chan interface{}
+	symbols map[string]bool
+	dropped bool // set before send is closed for falling behind
+}
+
+// MarketStreamManager owns the upstream market data connection for one exchange
+type MarketStreamManager struct {
+	wsURL       string
+	subscribers map[string]map[*marketSubscriber]struct{} // by symbol
+	stale       map[string]bool                           // symbols whose next tick follows a reconnect
+	conn        *websocket.Conn                           // nil while disconnected
+	nextReqID   int64
+	started     bool
+	reconnects  atomic.Uint64
+	dropped     atomic.Uint64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex // guards the fields above and writes to conn
+}
+
+func NewMarketStreamManager(wsURL string) *MarketStreamManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MarketStreamManager{
+		wsURL:       wsURL,
+		subscribers: make(map[string]map[*marketSubscriber]struct{}),
+		stale:       make(map[string]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+func (m *MarketStreamManager) newSubscriber() *marketSubscriber {
+	return &marketSubscriber{send: make(chan interface{}, marketTickBuffer), symbols: make(map[string]bool)}
+}
+
+// Subscribe adds symbols to a subscriber, subscribing upstream to any symbol
+// nobody was following yet. The upstream connection starts on first use.
+func (m *MarketStreamManager) Subscribe(sub *marketSubscriber, symbols []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sub.dropped {
+		return nil
+	}
+	added := 0
+	for _, symbol := range symbols {
+		if !sub.symbols[symbol] {
+			added++
+		}
+	}
+	if len(sub.symbols)+added > maxMarketSymbolsPerConn {
+		return fmt.Errorf("at most %d symbols per connection", maxMarketSymbolsPerConn)
+	}
+
+	var fresh []string
+	for _, symbol := range symbols {
+		if sub.symbols[symbol] {
+			continue
+		}
+		sub.symbols[symbol] = true
+		if m.subscribers[symbol] == nil {
+			m.subscribers[symbol] = make(map[*marketSubscriber]struct{})
+			fresh = append(fresh, symbol)
+		}
+		m.subscribers[symbol][sub] = struct{}{}
+	}
+
+	if !m.started {
+		m.started = true
+		go m.run()
+		log.Printf("✓ Market data stream started")
+	}
+	m.sendUpstream("SUBSCRIBE", fresh)
+	return nil
+}
+
+// Unsubscribe removes symbols from a subscriber, dropping upstream streams nobody follows
+func (m *MarketStreamManager) Unsubscribe(sub *marketSubscriber, symbols []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unsubscribe(sub, symbols)
+}
+
+// unsubscribe does the work of Unsubscribe; caller holds m.mu
+func (m *MarketStreamManager) unsubscribe(sub *marketSubscriber, symbols []string) {
+	var idle []string
+	for _, symbol := range symbols {
+		if !sub.symbols[symbol] {
+			continue
+		}
+		delete(sub.symbols, symbol)
+		delete(m.subscribers[symbol], sub)
+		if len(m.subscribers[symbol]) == 0 {
+			delete(m.subscribers, symbol)
+			delete(m.stale, symbol)
+			idle = append(idle, symbol)
+		}
+	}
+	m.sendUpstream("UNSUBSCRIBE", idle)
+}
+
+// Remove detaches a subscriber from every symbol and closes its channel
+func (m *MarketStreamManager) Remove(sub *marketSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(sub)
+}
+
+// remove does the work of Remove; caller holds m.mu
+func (m *MarketStreamManager) remove(sub *marketSubscriber) {
+	if sub.send == nil {
+		return
+	}
+	symbols := make([]string, 0, len(sub.symbols))
+	for symbol := range sub.symbols {
+		symbols = append(symbols, symbol)
+	}
+	m.unsubscribe(sub, symbols)
+	close(sub.send)
+	sub.send = nil
+}
+
+// deliver queues msg without blocking, dropping a subscriber that fell behind;
+// caller holds m.mu
+func (m *MarketStreamManager) deliver(sub *marketSubscriber, msg interface{}) {
+	if sub.send == nil {
+		return
+	}
+	select {
+	case sub.send <- msg:
+	default:
+		sub.dropped = true
+		m.remove(sub)
+		m.dropped.Add(1)
+	}
+}
+
+// sendUpstream asks Binance to start or stop streams; caller holds m.mu. While
+// disconnected this is a no-op: run subscribes to every followed symbol on connect.
+func (m *MarketStreamManager) sendUpstream(method string, symbols []string) {
+	if m.conn == nil || len(symbols) == 0 {
+		return
+	}
+	params := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		params[i] = strings.ToLower(symbol) + "@ticker"
+	}
+	m.nextReqID++
+	m.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	err := m.conn.WriteJSON(map[string]interface{}{"method": method, "params": params, "id": m.nextReqID})
+	if err != nil {
+		// The read loop sees the broken connection and reconnects, resubscribing everything
+		log.Printf("Market stream %s failed: %v", method, err)
+		m.conn.Close()
+	}
+}
+
+// Close stops the upstream connection
+func (m *MarketStreamManager) Close() {
+	m.cancel()
+}
+
+// run keeps the upstream connection open, reconnecting with backoff
+func (m *MarketStreamManager) run() {
+	backoff := time.Second
+	for connected := false; ; connected = true {
+		err := m.stream(connected)
+		if m.ctx.Err() != nil {
+			return
+		}
+		m.reconnects.Add(1)
+		log.Printf("Market data stream interrupted: %v (reconnecting in %s)", err, backoff)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// stream runs one upstream session. On a reconnect every followed symbol is
+// marked stale so its next tick tells clients that updates were missed.
+func (m *MarketStreamManager) stream(reconnect bool) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(m.ctx, m.wsURL+"/stream", nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect market stream: %w", err)
+	}
+	defer conn.Close()
+
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	m.mu.Lock()
+	m.conn = conn
+	symbols := make([]string, 0, len(m.subscribers))
+	for symbol := range m.subscribers {
+		symbols = append(symbols, symbol)
+		if reconnect {
+			m.stale[symbol] = true
+		}
+	}
+	m.sendUpstream("SUBSCRIBE", symbols)
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.conn = nil
+		m.mu.Unlock()
+	}()
+
+	for {
+		// Combined stream frames; replies to SUBSCRIBE carry no stream and are skipped
+		var msg struct {
+			Stream string      `json:"stream"`
+			Data   tickerEvent `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		if msg.Stream == "" {
+			continue
+		}
+
+		tick, err := msg.Data.toTick()
+		if err != nil {
+			log.Printf("Skipping ticker event for %s: %v", msg.Data.Symbol, err)
+			continue
+		}
+		m.publish(tick)
+	}
+}
+
+// publish copies a tick to every subscriber of its symbol
+func (m *MarketStreamManager) publish(tick *MarketTick) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stale[tick.Symbol] {
+		tick.Stale = true
+		delete(m.stale, tick.Symbol)
+	}
+	for sub := range m.subscribers[tick.Symbol] {
+		m.deliver(sub, tick)
+	}
+}
+
+var (
+	marketSubscribersDesc = prometheus.NewDesc("signalops_market_subscribers",
+		"Market stream subscribers per symbol.", []string{"exchange", "symbol"}, nil)
+	marketReconnectsDesc = prometheus.NewDesc("signalops_market_upstream_reconnects_total",
+		"Reconnects of the shared upstream ticker stream.", []string{"exchange"}, nil)
+	marketDroppedDesc = prometheus.NewDesc("signalops_market_subscribers_dropped_total",
+		"Market stream subscribers disconnected for falling behind.", []string{"exchange"}, nil)
+)
+
+func (m *MarketStreamManager) collect(ch chan<- prometheus.Metric, exchange string) {
+	m.mu.Lock()
+	for symbol, subs := range m.subscribers {
+		ch <- prometheus.MustNewConstMetric(marketSubscribersDesc, prometheus.GaugeValue, float64(len(subs)), exchange, symbol)
+	}
+	m.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(marketReconnectsDesc, prometheus.CounterValue, float64(m.reconnects.Load()), exchange)
+	ch <- prometheus.MustNewConstMetric(marketDroppedDesc, prometheus.CounterValue, float64(m.dropped.Load()), exchange)
+}
+
+// MarketStream returns the shared ticker stream for this exchange
+func (b *BinanceExchange) MarketStream() *MarketStreamManager {
+	return b.marketStreams
+}
+
+// marketStreamer is implemented by exchanges that can fan out live tickers
+type marketStreamer interface {
+	MarketStream() *MarketStreamManager
+}
+
+// collectMarketStreamMetrics reports subscriber counts for every exchange with a market stream
+func (s *Server) collectMarketStreamMetrics(ch chan<- prometheus.Metric) {
+	s.mu.RLock()
+	streams := make(map[string]*MarketStreamManager)
+	for name, exchange := range s.exchanges {
+		if streamer, ok := exchange.(marketStreamer); ok {
+			streams[name] = streamer.MarketStream()
+		}
+	}
+	s.mu.RUnlock()
+
+	for name, stream := range streams {
+		stream.collect(ch, name)
+	}
+}
+
+func (s *Server) registerMarketStreamEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/ws/market", s.handleMarketStream)
+}
+
+// handleMarketStream upgrades to a websocket of ticker updates:
+// GET /api/v1/ws/market?exchange=binance&symbols=BTCUSDT,ETHUSDT, then
+// {"action": "subscribe"|"unsubscribe", "symbols": [...]} to change symbols.
+func (s *Server) handleMarketStream(w http.ResponseWriter, r *http.Request) {
+	exchangeName := r.URL.Query().Get("exchange")
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+
+	s.mu.RLock()
+	exchange, exists := s.exchanges[exchangeName]
+	s.mu.RUnlock()
+	if !exists {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Exchange %s not configured", exchangeName),
+		})
+		return
+	}
+	streamer, ok := exchange.(marketStreamer)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Exchange does not support market data streams",
+		})
+		return
+	}
+	manager := streamer.MarketStream()
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || s.originAllowed(origin)
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already wrote the error response
+	}
+	defer conn.Close()
+	defer trackConnection("market")()
+
+	sub := manager.newSubscriber()
+	send := sub.send // Remove clears sub.send
+	defer manager.Remove(sub)
+	logEvent(r.Context(), "Market stream connected", "exchange", exchangeName)
+
+	// Replies go through the subscriber's queue so the writer stays the only goroutine writing to conn
+	reply := func(msg map[string]interface{}) {
+		manager.mu.Lock()
+		manager.deliver(sub, msg)
+		manager.mu.Unlock()
+	}
+	handle := func(action string, raw []string) {
+		symbols, err := marketSymbols(exchange, raw)
+		if err == nil {
+			switch action {
+			case "subscribe":
+				err = manager.Subscribe(sub, symbols)
+			case "unsubscribe":
+				manager.Unsubscribe(sub, symbols)
+			default:
+				err = fmt.Errorf("unknown action %q, expected subscribe or unsubscribe", action)
+			}
+		}
+
+		if err != nil {
+			reply(map[string]interface{}{"type": "error", "error": err.Error()})
+			return
+		}
+		reply(map[string]interface{}{"type": action + "d", "symbols": symbols})
+	}
+
+	if raw := r.URL.Query().Get("symbols"); raw != "" {
+		handle("subscribe", strings.Split(raw, ","))
+	}
+
+	// Reader: subscription changes and pongs
+	go func() {
+		defer manager.Remove(sub)
+		conn.SetReadLimit(wsMaxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				Action  string   `json:"action"`
+				Symbols []string `json:"symbols"`
+			}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				reply(map[string]interface{}{"type": "error", "error": "Invalid JSON"})
+				continue
+			}
+			handle(msg.Action, msg.Symbols)
+		}
+	}()
+
+	// Writer: the only goroutine writing to conn
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				manager.mu.Lock()
+				dropped := sub.dropped
+				manager.mu.Unlock()
+				if dropped {
+					conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow, ticks dropped"))
+				}
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// marketSymbols normalizes requested symbols and checks them against the
+// exchange's symbol list when it has one
+func marketSymbols(exchange Exchange, raw []string) ([]string, error) {
+	symbols := make([]string, 0, len(raw))
+	for _, symbol := range raw {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("symbols required")
+	}
+
+	if lister, ok := exchange.(symbolLister); ok {
+		if known, err := lister.KnownSymbols(); err == nil {
+			for _, symbol := range symbols {
+				if !known[symbol] {
+					return nil, fmt.Errorf("%s is not traded on this exchange", symbol)
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
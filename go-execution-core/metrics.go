@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Instrumentation for /metrics. Event metrics are registered here; gauges that
+// mirror state owned elsewhere (exchange health, stream subscribers, client rate
+// limits) are read at scrape time by engineCollector under their existing names.
+
+var (
+	ordersSubmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_orders_submitted_total",
+		Help: "Orders sent to exchanges, by exchange, side and resulting status (ERROR when the call failed).",
+	}, []string{"exchange", "side", "status"})
+
+	exchangeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signalops_exchange_request_duration_seconds",
+		Help:    "Exchange REST API call latency by exchange type and endpoint.",
+		Buckets: []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"exchange", "endpoint"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signalops_db_query_duration_seconds",
+		Help:    "Postgres round trips by operation (query, exec, begin, commit, rollback); queries until the first rows arrive.",
+		Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"operation"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_cache_requests_total",
+		Help: "Redis cache lookups by cache and result (hit, miss, error; market_data also coalesced, bypass; order_status also bypass).",
+	}, []string{"cache", "result"})
+
+	duplicateOrderWaits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_duplicate_order_waits_total",
+		Help: "Duplicate orders that waited on another instance's submission, by result (replayed, timeout, abandoned when the claim went away without one).",
+	}, []string{"result"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signalops_http_request_duration_seconds",
+		Help:    "HTTP request latency by normalized route, method and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status_class"})
+
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signalops_http_response_size_bytes",
+		Help:    "HTTP response body size by normalized route, method and status class.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"route", "method", "status_class"})
+
+	grpcRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signalops_grpc_request_duration_seconds",
+		Help:    "gRPC call latency by method and status code; streams until they end.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	grpcConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signalops_grpc_connections",
+		Help: "Open client connections on the gRPC port.",
+	})
+
+	grpcPings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_grpc_pings_total",
+		Help: "HTTP/2 PING frames on gRPC connections by direction (received from clients, sent by the server); includes flow-control pings.",
+	}, []string{"direction"})
+
+	grpcKeepaliveViolations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "signalops_grpc_keepalive_violations_total",
+		Help: "Connections closed with GOAWAY too_many_pings for pinging more often than GRPC_KEEPALIVE_MIN_TIME.",
+	})
+
+	grpcPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signalops_grpc_panics_total",
+		Help: "gRPC handlers that panicked, recovered and answered INTERNAL, by method.",
+	}, []string{"method"})
+
+	marketDataStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signalops_grpc_market_data_streams",
+		Help: "Open StreamMarketData calls by exchange and symbol.",
+	}, []string{"exchange", "symbol"})
+
+	orderBookStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signalops_grpc_orderbook_streams",
+		Help: "Open StreamOrderBook calls by exchange and symbol.",
+	}, []string{"exchange", "symbol"})
+
+	balanceStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signalops_grpc_balance_streams",
+		Help: "Open StreamBalances calls by exchange and source (push, poll).",
+	}, []string{"exchange", "source"})
+
+	websocketConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signalops_websocket_connections",
+		Help: "Open websocket connections by stream (orders, market).",
+	}, []string{"stream"})
+)
+
+// trackConnection counts an open websocket connection until the returned func runs
+func trackConnection(stream string) func() {
+	gauge := websocketConnections.WithLabelValues(stream)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// recordCacheLookup counts one cache lookup
+func recordCacheLookup(cache, result string) {
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// metricsHandler serves every registered metric in the Prometheus text format
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// engineCollector reports state owned by the server at scrape time
+type engineCollector struct {
+	s *Server
+}
+
+// Describe lists every descriptor up front: Collect only emits series that exist
+// at scrape time, and the registry rejects series it was not told about
+func (c engineCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		exchangesConnectedDesc, uptimeDesc, exchangeUpDesc, exchangeProbeLatencyDesc,
+		clientRequestsDesc, clientTokensDesc,
+		balanceFetchSecondsDesc, balanceFetchTimeoutsDesc,
+		orderEventSubscribersDesc, orderEventsPublishedDesc, orderEventDroppedDesc,
+		marketSubscribersDesc, marketReconnectsDesc, marketDroppedDesc,
+	} {
+		ch <- desc
+	}
+	if c.s.batchStats != nil {
+		c.s.batchStats.size.Describe(ch)
+		c.s.batchStats.duration.Describe(ch)
+	}
+}
+
+var (
+	exchangesConnectedDesc = prometheus.NewDesc("signalops_exchanges_connected",
+		"Registered exchanges and accounts.", nil, nil)
+	uptimeDesc = prometheus.NewDesc("signalops_uptime_seconds",
+		"Seconds since the engine started.", nil, nil)
+	exchangeUpDesc = prometheus.NewDesc("signalops_exchange_up",
+		"1 when the exchange's last health probe succeeded.", []string{"exchange"}, nil)
+	exchangeProbeLatencyDesc = prometheus.NewDesc("signalops_exchange_probe_latency_seconds",
+		"Latency of the exchange's last health probe.", []string{"exchange"}, nil)
+)
+
+func (c engineCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.s
+	s.mu.RLock()
+	exchangeCount := len(s.exchanges)
+	s.mu.RUnlock()
+	ch <- prometheus.MustNewConstMetric(exchangesConnectedDesc, prometheus.GaugeValue, float64(exchangeCount))
+	ch <- prometheus.MustNewConstMetric(uptimeDesc, prometheus.GaugeValue, time.Since(startTime).Seconds())
+
+	snapshot := s.health.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		up := 0.0
+		if snapshot[name].Up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(exchangeUpDesc, prometheus.GaugeValue, up, name)
+		ch <- prometheus.MustNewConstMetric(exchangeProbeLatencyDesc, prometheus.GaugeValue,
+			snapshot[name].Latency.Seconds(), name)
+	}
+
+	s.clientLimiter.collect(ch)
+	s.batchStats.collect(ch)
+	s.balanceFetches.collect(ch)
+	s.orderEvents.collect(ch)
+	s.collectMarketStreamMetrics(ch)
+}
+
+// grpcUnaryMetrics and grpcStreamMetrics time every RPC, including rejected ones
+func grpcUnaryMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcRequestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).
+		Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+func grpcStreamMetrics(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	grpcRequestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).
+		Observe(time.Since(start).Seconds())
+	return err
+}
+
+// exchangeIDSegment matches path segments that are identifiers (order IDs,
+// UUIDs) rather than endpoint names
+var exchangeIDSegment = regexp.MustCompile(`^[0-9a-fA-F-]{8,}$|^\d+$`)
+
+// exchangeEndpoint reduces a request path to a stable label, e.g.
+// /api/v1/orders/5f3c...e1 becomes /api/v1/orders/{id}
+func exchangeEndpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if exchangeIDSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// instrumentedTransport times every exchange REST call
+type instrumentedTransport struct {
+	exchange string
+	next     http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	exchangeRequestDuration.WithLabelValues(t.exchange, exchangeEndpoint(req.URL.Path)).
+		Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// newExchangeHTTPClient is the REST client of an exchange, with call latency
+// recorded under the exchange type
+func newExchangeHTTPClient(exchange string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: instrumentedTransport{exchange: exchange, next: http.DefaultTransport},
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "execution-engine/pb"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestMetricsEndpointSeries drives an order, a websocket and a gRPC call through
+// a server, then scrapes /metrics and checks the key series are exported
+func TestMetricsEndpointSeries(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+	// main registers the collector once per process; tests register it per server
+	collector := engineCollector{s}
+	prometheus.MustRegister(collector)
+	t.Cleanup(func() { prometheus.Unregister(collector) })
+
+	filled := []string{"exchange", "mock", "side", "BUY", "status", "FILLED"}
+	ordersBefore, _ := scrapeMetric(t, srv, "signalops_orders_submitted_total", filled...)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT",
+		"side": "BUY", "quantity": 0.5, "exchange": "mock",
+	})
+	if code != http.StatusOK || body["success"] != true {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	s.dbWrites.Wait()
+	if code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders/ord-1", nil); code != http.StatusOK {
+		t.Fatalf("order lookup: status %d: %v", code, body)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/ws/orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitForMetric(t, srv, 1, "signalops_websocket_connections", "stream", "orders")
+
+	method := pb.ExecutionService_GetOrderStatus_FullMethodName
+	_, err = grpcUnaryMetrics(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "no such order")
+		})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("interceptor err = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		labels []string
+	}{
+		{"signalops_http_request_duration_seconds_count", []string{"route", "/api/v1/orders", "method", "POST", "status_class", "2xx"}},
+		{"signalops_http_request_duration_seconds_count", []string{"route", "/api/v1/orders/{id}", "method", "GET", "status_class", "2xx"}},
+		{"signalops_http_response_size_bytes_count", []string{"route", "/api/v1/orders", "method", "POST", "status_class", "2xx"}},
+		{"signalops_db_query_duration_seconds_count", []string{"operation", "query"}},
+		{"signalops_db_query_duration_seconds_count", []string{"operation", "exec"}},
+		{"signalops_grpc_request_duration_seconds_count", []string{"method", method, "code", "NotFound"}},
+		{"signalops_websocket_connections", []string{"stream", "orders"}},
+		// Scrape-time series, under the names dashboards used before client_golang
+		{"signalops_exchanges_connected", nil},
+		{"signalops_uptime_seconds", nil},
+		{"signalops_order_events_published_total", nil},
+		{"go_goroutines", nil},
+	}
+	for _, tt := range tests {
+		if _, ok := scrapeMetric(t, srv, tt.name, tt.labels...); !ok {
+			t.Errorf("%s%v not exported", tt.name, tt.labels)
+		}
+	}
+
+	if got, _ := scrapeMetric(t, srv, "signalops_orders_submitted_total", filled...); got-ordersBefore != 1 {
+		t.Errorf("filled mock orders counted %g, want 1", got-ordersBefore)
+	}
+	if got, _ := scrapeMetric(t, srv, "signalops_exchanges_connected"); got != 1 {
+		t.Errorf("signalops_exchanges_connected = %g, want 1", got)
+	}
+	// Streams stay open for as long as the client listens, so they are not timed
+	if _, ok := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", "route", "/api/v1/ws/orders"); ok {
+		t.Error("websocket route timed as a request")
+	}
+
+	conn.Close()
+	waitForMetric(t, srv, 0, "signalops_websocket_connections", "stream", "orders")
+}
+
+// waitForMetric polls /metrics until a series reaches want, for gauges moved by
+// another goroutine
+func waitForMetric(t *testing.T, srv *httptest.Server, want float64, name string, labels ...string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := scrapeMetric(t, srv, name, labels...)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s%v = %g, want %g", name, labels, got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
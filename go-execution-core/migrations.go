@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema migrations are the SQL files in migrations/, named <version>_<name>.sql
+// and applied in version order, each in its own transaction. Applied versions are
+// recorded in schema_migrations.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID keys the advisory lock that keeps replicas starting together
+// from applying the same migration twice
+const migrationLockID = 0x5349474e414c // "SIGNAL"
+
+const migrationTimeout = 5 * time.Minute
+
+// errSchemaOutdated means the database is behind the migrations built into the binary
+var errSchemaOutdated = errors.New("database schema is outdated")
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations reads the embedded migrations in version order
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.sql", entry.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, entry.Name(), version)
+		}
+		seen[version] = entry.Name()
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// expectedSchemaVersion is the version of the newest embedded migration
+func expectedSchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+const createSchemaMigrations = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(200) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)
+`
+
+// runMigrations applies the embedded migrations the database has not seen yet and
+// returns them. Migrations run under an advisory lock, so concurrent callers wait
+// and then find nothing left to do.
+func runMigrations(ctx context.Context, db *sql.DB) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// The advisory lock belongs to a session, so everything runs on one connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return nil, fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []migration
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// schemaVersion returns the newest applied migration, 0 when none has been
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// checkSchemaVersion fails with errSchemaOutdated when the database is missing
+// migrations this binary expects. A newer schema is accepted, so an older binary
+// keeps running during a rolling deploy.
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	expected, err := expectedSchemaVersion()
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current < expected {
+		return fmt.Errorf("%w: at version %d, this binary needs %d; run `execution-engine migrate` or set RUN_MIGRATIONS=true",
+			errSchemaOutdated, current, expected)
+	}
+	return nil
+}
+
+// runMigrateCommand implements `execution-engine migrate [status]`
+func runMigrateCommand(args []string) int {
+	usage := "usage: execution-engine migrate [status]"
+	if len(args) > 1 || (len(args) == 1 && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	config := loadConfig()
+	if err := requirePostgres(config.DatabaseURL, "migrate"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := openDatabase(config.DatabaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	if len(args) == 1 {
+		current, err := schemaVersion(ctx, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read schema version: %v\n", err)
+			return 1
+		}
+		expected, err := expectedSchemaVersion()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Schema version %d, binary expects %d\n", current, expected)
+		if current < expected {
+			return 1
+		}
+		return 0
+	}
+
+	ran, err := runMigrations(ctx, db)
+	for _, m := range ran {
+		fmt.Printf("Applied migration %d (%s)\n", m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(ran) == 0 {
+		fmt.Println("Schema is up to date")
+	}
+	return 0
+}
@@ -0,0 +1,183 @@
+-- Tables the execution engine reads and writes. Everything is IF NOT EXISTS so the
+-- migration also applies to databases created by db/init.sql, which it baselines.
+-- gen_random_uuid() is built into Postgres 13+, so no extension (and no superuser)
+-- is needed.
+
+CREATE TABLE IF NOT EXISTS trades (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id VARCHAR(50) UNIQUE NOT NULL,
+    exchange_order_id VARCHAR(100), -- ID assigned by the exchange, used to poll status
+    strategy_name VARCHAR(100) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    side VARCHAR(10) NOT NULL CHECK (side IN ('BUY', 'SELL')),
+    quantity DECIMAL(20, 8) NOT NULL,
+    price DECIMAL(20, 8) NOT NULL,
+    executed_price DECIMAL(20, 8),
+    filled_quantity DECIMAL(20, 8),
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    exchange VARCHAR(50),
+    account_type VARCHAR(20) NOT NULL DEFAULT 'spot' CHECK (account_type IN ('spot', 'margin', 'futures')),
+    account VARCHAR(100) NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    executed_at TIMESTAMPTZ,
+    pnl DECIMAL(20, 8),
+    fees DECIMAL(20, 8) DEFAULT 0,
+    slippage DECIMAL(20, 8),
+    metadata JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trades_strategy ON trades(strategy_name);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol ON trades(symbol);
+CREATE INDEX IF NOT EXISTS idx_trades_timestamp ON trades(timestamp DESC);
+-- Keyset pagination: (timestamp, order_id) cursors for order history and strategy trades
+CREATE INDEX IF NOT EXISTS idx_trades_timestamp_order ON trades(timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_strategy_executed ON trades(strategy_name, executed_at DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_status ON trades(status);
+CREATE INDEX IF NOT EXISTS idx_trades_exchange_account ON trades(exchange, account);
+CREATE INDEX IF NOT EXISTS idx_trades_metadata ON trades USING GIN(metadata);
+
+CREATE TABLE IF NOT EXISTS positions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    symbol VARCHAR(20) NOT NULL,
+    account VARCHAR(100) NOT NULL DEFAULT '',
+    strategy_name VARCHAR(100) NOT NULL,
+    quantity DECIMAL(20, 8) NOT NULL,
+    average_entry_price DECIMAL(20, 8) NOT NULL,
+    current_price DECIMAL(20, 8),
+    unrealized_pnl DECIMAL(20, 8),
+    realized_pnl DECIMAL(20, 8) DEFAULT 0,
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    metadata JSONB,
+    UNIQUE(symbol, account)
+);
+
+CREATE INDEX IF NOT EXISTS idx_positions_symbol ON positions(symbol);
+CREATE INDEX IF NOT EXISTS idx_positions_account ON positions(account);
+CREATE INDEX IF NOT EXISTS idx_positions_strategy ON positions(strategy_name);
+
+CREATE TABLE IF NOT EXISTS strategies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    config JSONB NOT NULL,
+    is_active BOOLEAN DEFAULT true,
+    created_by VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_executed_at TIMESTAMPTZ,
+    total_pnl DECIMAL(20, 8) DEFAULT 0,
+    win_rate DECIMAL(5, 4),
+    total_trades INTEGER DEFAULT 0,
+    metadata JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategies_name ON strategies(name);
+CREATE INDEX IF NOT EXISTS idx_strategies_active ON strategies(is_active);
+CREATE INDEX IF NOT EXISTS idx_strategies_config ON strategies USING GIN(config);
+
+CREATE TABLE IF NOT EXISTS klines (
+    exchange VARCHAR(50) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    interval VARCHAR(10) NOT NULL,
+    open_time TIMESTAMPTZ NOT NULL,
+    open DECIMAL(20, 8) NOT NULL,
+    high DECIMAL(20, 8) NOT NULL,
+    low DECIMAL(20, 8) NOT NULL,
+    close DECIMAL(20, 8) NOT NULL,
+    volume DECIMAL(28, 8) NOT NULL,
+    close_time TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (exchange, symbol, interval, open_time)
+);
+
+CREATE TABLE IF NOT EXISTS risk_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    event_type VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+    strategy_name VARCHAR(100),
+    symbol VARCHAR(20),
+    description TEXT NOT NULL,
+    data JSONB,
+    resolved BOOLEAN DEFAULT false,
+    resolved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_risk_events_timestamp ON risk_events(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_risk_events_severity ON risk_events(severity);
+CREATE INDEX IF NOT EXISTS idx_risk_events_resolved ON risk_events(resolved);
+
+-- Portfolio limits read by the order path; a missing row means no limit
+CREATE TABLE IF NOT EXISTS risk_limits (
+    name VARCHAR(50) PRIMARY KEY,
+    value DECIMAL(20, 8) NOT NULL CHECK (value >= 0),
+    updated_by VARCHAR(100),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO risk_limits (name, value, updated_by) VALUES ('max_total_exposure_usd', 100000, 'migration')
+ON CONFLICT (name) DO NOTHING;
+
+-- Exchange credentials added at runtime, encrypted with EXCHANGE_CREDENTIALS_KEY
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    exchange VARCHAR(50) NOT NULL,
+    key_name VARCHAR(100) NOT NULL,
+    encrypted_key TEXT NOT NULL,
+    encrypted_secret TEXT NOT NULL,
+    encrypted_passphrase TEXT,
+    testnet BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    UNIQUE(exchange, key_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_exchange ON api_keys(exchange);
+
+-- Client API keys for the REST and gRPC APIs (SHA-256 hashes only)
+CREATE TABLE IF NOT EXISTS client_api_keys (
+    id SERIAL PRIMARY KEY,
+    key_id VARCHAR(32) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'trader', 'admin')),
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    require_signature BOOLEAN NOT NULL DEFAULT false,
+    signing_secret TEXT, -- encrypted with EXCHANGE_CREDENTIALS_KEY
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Positions track their change time in last_updated
+CREATE OR REPLACE FUNCTION update_last_updated_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.last_updated = NOW();
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS update_trades_updated_at ON trades;
+CREATE TRIGGER update_trades_updated_at BEFORE UPDATE ON trades
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_positions_last_updated ON positions;
+CREATE TRIGGER update_positions_last_updated BEFORE UPDATE ON positions
+    FOR EACH ROW EXECUTE FUNCTION update_last_updated_column();
+
+DROP TRIGGER IF EXISTS update_strategies_updated_at ON strategies;
+CREATE TRIGGER update_strategies_updated_at BEFORE UPDATE ON strategies
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
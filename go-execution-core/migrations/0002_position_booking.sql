@@ -0,0 +1,19 @@
+-- Positions are maintained from fills. booked_* record how much of each order's
+-- cumulative fill has been applied to its position, so a fill seen again (status
+-- refresh, execution report) is not counted twice.
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS booked_quantity DECIMAL(20, 8) NOT NULL DEFAULT 0;
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS booked_notional DECIMAL(28, 8) NOT NULL DEFAULT 0;
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS booked_fees DECIMAL(20, 8) NOT NULL DEFAULT 0;
+
+-- Fills before this migration were never booked; leave positions as they are and
+-- book only what orders fill from now on
+UPDATE trades
+SET booked_quantity = COALESCE(filled_quantity, 0),
+    booked_notional = COALESCE(filled_quantity, 0) * COALESCE(executed_price, 0),
+    booked_fees = COALESCE(fees, 0);
+
+-- Open lots, oldest first, for FIFO accounting
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS lots JSONB;
+
+-- Execution reports name the exchange's order ID
+CREATE INDEX IF NOT EXISTS idx_trades_exchange_order ON trades(exchange_order_id);
@@ -0,0 +1,3 @@
+-- The order type (MARKET, LIMIT, ...) each trades row was submitted as; NULL for
+-- orders recorded before it was kept
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS order_type VARCHAR(30);
@@ -0,0 +1,27 @@
+-- trades is not partitioned by month: order_id stays UNIQUE on its own (the order
+-- journal's ON CONFLICT (order_id) relies on it) and a partitioned table can only
+-- enforce uniqueness that includes the partition key. Instead the filtered order
+-- history reads get (filter, timestamp DESC, order_id DESC) indexes that serve
+-- both the filter and the keyset page order, and old rows move to trades_archive.
+CREATE INDEX IF NOT EXISTS idx_trades_strategy_timestamp ON trades(strategy_name, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol_timestamp ON trades(symbol, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_status_timestamp ON trades(status, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_exchange_timestamp ON trades(exchange, timestamp DESC, order_id DESC);
+-- Orders the reconciler still polls; a small slice of the table
+CREATE INDEX IF NOT EXISTS idx_trades_open ON trades(timestamp)
+    WHERE status NOT IN ('FILLED', 'CANCELED', 'REJECTED', 'EXPIRED', 'FAILED', 'UNKNOWN');
+
+-- Leading columns of the indexes above
+DROP INDEX IF EXISTS idx_trades_strategy;
+DROP INDEX IF EXISTS idx_trades_symbol;
+DROP INDEX IF EXISTS idx_trades_status;
+DROP INDEX IF EXISTS idx_trades_timestamp;
+
+-- Finished trades moved out of trades by `execution-engine archive-trades`. The
+-- table has every trades column, moved by name, plus archived_at; a column
+-- added to trades must be added here too or archiving stops with an error.
+CREATE TABLE IF NOT EXISTS trades_archive (LIKE trades INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+ALTER TABLE trades_archive ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trades_archive_order ON trades_archive(order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_archive_timestamp ON trades_archive(timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_archive_strategy ON trades_archive(strategy_name, timestamp DESC);
@@ -0,0 +1,16 @@
+-- Order book samples taken by the order book recorder (ORDERBOOK_RECORD_SYMBOLS):
+-- the top levels of each side as [[price, quantity], ...], best first
+CREATE TABLE IF NOT EXISTS book_snapshots (
+    exchange VARCHAR(50) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    ts TIMESTAMPTZ NOT NULL,
+    last_update_id BIGINT NOT NULL,
+    bids JSONB NOT NULL,
+    asks JSONB NOT NULL,
+    mid DECIMAL(20, 8),
+    spread DECIMAL(20, 8),
+    PRIMARY KEY (exchange, symbol, ts)
+);
+
+-- Retention and row-cap pruning
+CREATE INDEX IF NOT EXISTS idx_book_snapshots_ts ON book_snapshots(ts);
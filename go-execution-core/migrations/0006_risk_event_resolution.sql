@@ -0,0 +1,5 @@
+-- Who resolved a risk event (the API caller, or the close all run that finished cleanly)
+ALTER TABLE risk_events ADD COLUMN IF NOT EXISTS resolved_by VARCHAR(100);
+
+-- /readyz counts unresolved CRITICAL events on every probe
+CREATE INDEX IF NOT EXISTS idx_risk_events_unresolved ON risk_events(severity, timestamp DESC) WHERE resolved = false;
@@ -0,0 +1,16 @@
+-- FIFO lots per strategy and symbol, from which trades.pnl is realized. Existing
+-- trades get their pnl from `execution-engine recompute-pnl`.
+CREATE TABLE IF NOT EXISTS strategy_lots (
+    id BIGSERIAL PRIMARY KEY,
+    strategy_name VARCHAR(100) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    open_order_id VARCHAR(50) NOT NULL,
+    quantity DECIMAL(28, 12) NOT NULL, -- signed, negative for shorts
+    remaining DECIMAL(28, 12) NOT NULL, -- signed, 0 once closed
+    price DECIMAL(28, 12) NOT NULL, -- entry price including the opening fee share
+    opened_at TIMESTAMPTZ NOT NULL,
+    closed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_lots_open ON strategy_lots(strategy_name, symbol, id) WHERE remaining <> 0;
+CREATE INDEX IF NOT EXISTS idx_strategy_lots_order ON strategy_lots(open_order_id);
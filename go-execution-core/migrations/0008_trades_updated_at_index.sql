@@ -0,0 +1,2 @@
+-- The strategy stats updater looks up strategies with trades changed since its last pass
+CREATE INDEX IF NOT EXISTS idx_trades_updated_at ON trades(updated_at);
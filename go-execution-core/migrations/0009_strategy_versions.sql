@@ -0,0 +1,22 @@
+-- Deleting a strategy sets deleted_at instead of removing the row, so its config
+-- and stats stay with the trades that name it
+ALTER TABLE strategies ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE strategies ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(100);
+
+-- Every saved revision of a strategy's config and description, numbered from 1
+CREATE TABLE IF NOT EXISTS strategy_versions (
+    strategy_name VARCHAR(100) NOT NULL,
+    version INTEGER NOT NULL,
+    description TEXT,
+    config JSONB NOT NULL,
+    change VARCHAR(20) NOT NULL, -- created, updated or rolled_back
+    source_version INTEGER, -- the version a rollback restored
+    changed_by VARCHAR(100),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (strategy_name, version)
+);
+
+-- Existing strategies start their history at their current config
+INSERT INTO strategy_versions (strategy_name, version, description, config, change, changed_by, changed_at)
+SELECT name, 1, description, config, 'created', created_by, updated_at FROM strategies
+ON CONFLICT DO NOTHING;
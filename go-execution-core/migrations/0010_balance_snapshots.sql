@@ -0,0 +1,12 @@
+-- Account values sampled by the balance snapshotter (BALANCE_SNAPSHOT_INTERVAL):
+-- one row per exchange account and one "total" row per tick. assets holds
+-- {asset: {quantity, price_usd}} of the priced assets; a NULL total_value_usd is
+-- a gap, an account that could not be read (or, for the total, any account)
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    exchange VARCHAR(100) NOT NULL,
+    ts TIMESTAMPTZ NOT NULL,
+    total_value_usd DECIMAL(28, 8),
+    assets JSONB,
+    error TEXT,
+    PRIMARY KEY (exchange, ts)
+);
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// schemaTables are the tables every schema, migrated or SQLite, must have
+var schemaTables = []string{
+	"trades", "trades_archive", "positions", "strategy_lots", "strategies", "strategy_versions", "klines",
+	"book_snapshots", "balance_snapshots", "risk_events", "risk_limits", "api_keys", "client_api_keys",
+}
+
+// postgresTestDB returns a pool on a fresh, empty schema of the database in
+// TEST_POSTGRES_URL, dropped when the test ends. Tests needing Postgres skip
+// when the variable is unset.
+func postgresTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("TEST_POSTGRES_URL")
+	if dbURL == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	admin, err := openDatabase(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// lib/pq sends unknown URL parameters as session settings
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	db, err := openDatabase(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d (%s) at position %d; versions must run 1, 2, 3...", m.Version, m.Name, i+1)
+		}
+		if m.Name == "" || strings.TrimSpace(m.SQL) == "" {
+			t.Errorf("migration %d: name %q, %d bytes of SQL", m.Version, m.Name, len(m.SQL))
+		}
+	}
+	expected, err := expectedSchemaVersion()
+	if err != nil || expected != migrations[len(migrations)-1].Version {
+		t.Errorf("expectedSchemaVersion = %d, %v", expected, err)
+	}
+}
+
+func TestMigrationsFromEmpty(t *testing.T) {
+	db := postgresTestDB(t)
+	ctx := context.Background()
+	expected, err := expectedSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prepareDatabase(db, dialectPostgres, false); !errors.Is(err, errSchemaOutdated) {
+		t.Fatalf("empty database without RUN_MIGRATIONS: err = %v, want errSchemaOutdated", err)
+	}
+
+	ran, err := runMigrations(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != expected {
+		t.Errorf("applied %d migrations, want %d", len(ran), expected)
+	}
+	if current, err := schemaVersion(ctx, db); err != nil || current != expected {
+		t.Errorf("schema version %d, %v; want %d", current, err, expected)
+	}
+	for _, table := range schemaTables {
+		var exists bool
+		if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil || !exists {
+			t.Errorf("table %s missing after migrating (err %v)", table, err)
+		}
+	}
+	if err := checkSchemaVersion(ctx, db); err != nil {
+		t.Error(err)
+	}
+
+	// Re-running, at startup or by hand, finds nothing left to apply
+	ran, err = runMigrations(ctx, db)
+	if err != nil || len(ran) != 0 {
+		t.Errorf("second run applied %d migrations, err %v", len(ran), err)
+	}
+	if err := prepareDatabase(db, dialectPostgres, true); err != nil {
+		t.Errorf("startup with RUN_MIGRATIONS on a current schema: %v", err)
+	}
+	var recorded int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&recorded); err != nil || recorded != expected {
+		t.Errorf("%d versions recorded, err %v; want %d", recorded, err, expected)
+	}
+}
+
+// TestMigrationsConcurrentReplicas starts two replicas at once on an empty
+// database; the advisory lock lets one apply everything and the other nothing
+func TestMigrationsConcurrentReplicas(t *testing.T) {
+	db := postgresTestDB(t)
+	expected, err := expectedSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	applied := make([]int, 2)
+	errs := make([]error, 2)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ran, err := runMigrations(context.Background(), db)
+			applied[i], errs[i] = len(ran), err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if applied[0]+applied[1] != expected || (applied[0] != 0 && applied[1] != 0) {
+		t.Errorf("replicas applied %v migrations, want %d by one of them", applied, expected)
+	}
+}
+
+func TestSQLiteSchemaReapplies(t *testing.T) {
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "engine.db")
+	db, err := initDatabase(dbURL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file from before strategies had the soft-delete columns
+	if _, err := db.Exec(`DROP TABLE strategies`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE strategies (id INTEGER PRIMARY KEY, name TEXT UNIQUE NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for run := 1; run <= 2; run++ {
+		db, err := initDatabase(dbURL, false)
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		for _, table := range schemaTables {
+			var exists bool
+			if err := db.QueryRow(`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = $1`, table).Scan(&exists); err != nil || !exists {
+				t.Errorf("run %d: table %s missing (err %v)", run, table, err)
+			}
+		}
+		for _, c := range sqliteAddedColumns {
+			var present bool
+			if err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info($1) WHERE name = $2`, c.table, c.column).Scan(&present); err != nil || !present {
+				t.Errorf("run %d: column %s.%s missing (err %v)", run, c.table, c.column, err)
+			}
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MockExchange is a deterministic, scriptable Exchange for integration tests.
+// It lives in a _test.go file of package main because the Exchange types are
+// not importable from another package; newTestServer registers it as "mock" to
+// exercise the REST and gRPC order paths without exchange credentials.
+type MockExchange struct {
+	FillPrice float64       // price for every fill; 0 uses the order price or 100
+	FillRatio float64       // fraction of quantity filled; 0 means fully filled
+	FeeRate   float64       // fees as a fraction of notional
+	Latency   time.Duration // artificial delay before every call returns
+	Balances  map[string]AssetBalance
+
+	// RestLimitOrders leaves LIMIT orders resting (NEW) instead of filling them
+	RestLimitOrders bool
+
+	// Scripted failures. Err fails every call; SymbolErrors fails orders for one
+	// symbol and OrderErrors one order ID (e.g. to produce partial batch failures).
+	Err          error
+	SymbolErrors map[string]error
+	OrderErrors  map[string]error
+
+	calls       []MockCall
+	orders      map[string]*OrderStatus
+	nextOrderID int64
+	mu          sync.Mutex
+}
+
+// MockCall records a single call made against the MockExchange
+type MockCall struct {
+	Method string
+	Args   []interface{}
+	Time   time.Time
+}
+
+// Errors callers can script to mimic common exchange failures
+var (
+	ErrMockInsufficientBalance = errors.New("mock exchange: insufficient balance")
+	ErrMockTimeout             = errors.New("mock exchange: request timed out")
+)
+
+func NewMockExchange() *MockExchange {
+	return &MockExchange{
+		Balances: map[string]AssetBalance{
+			"USDT": {Asset: "USDT", Free: 10000, Total: 10000},
+			"BTC":  {Asset: "BTC", Free: 1, Total: 1},
+		},
+		SymbolErrors: make(map[string]error),
+		OrderErrors:  make(map[string]error),
+		orders:       make(map[string]*OrderStatus),
+		nextOrderID:  1000,
+	}
+}
+
+// record logs a call and applies the scripted latency, which ctx cuts short like
+// a real round trip. It returns the scripted error.
+func (m *MockExchange) record(ctx context.Context, method string, args ...interface{}) error {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Method: method, Args: args, Time: time.Now()})
+	latency, err := m.Latency, m.Err
+	m.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// Calls returns a copy of every call made so far, in order
+func (m *MockExchange) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallCount returns how many times a method was called
+func (m *MockExchange) CallCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, call := range m.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset clears the call log and order history, keeping the scripted behavior
+func (m *MockExchange) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	m.orders = make(map[string]*OrderStatus)
+}
+
+func (m *MockExchange) price(fallback float64) float64 {
+	if m.FillPrice > 0 {
+		return m.FillPrice
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return 100
+}
+
+func (m *MockExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	if err := m.record(ctx, "GetMarketData", symbol); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	price := m.price(0)
+	return &MarketData{
+		Symbol:    symbol,
+		Price:     price,
+		Bid:       price * 0.9995,
+		Ask:       price * 1.0005,
+		Volume24h: 1000,
+		High24h:   price * 1.05,
+		Low24h:    price * 0.95,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+func (m *MockExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	if err := m.record(ctx, "SubmitOrder", *order); err != nil {
+		return &OrderResult{OrderID: order.ID, Status: "FAILED"}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.SymbolErrors[order.Symbol]; err != nil {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, err
+	}
+	if err := m.OrderErrors[order.ID]; err != nil {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, err
+	}
+
+	ratio := m.FillRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	if m.RestLimitOrders && order.OrderType == "LIMIT" {
+		ratio = 0
+	}
+	filled := order.Quantity * ratio
+	price := m.price(order.Price)
+
+	status := "FILLED"
+	if ratio == 0 {
+		status = "NEW"
+	} else if ratio < 1 {
+		status = "PARTIALLY_FILLED"
+	}
+
+	m.nextOrderID++
+	exchangeOrderID := strconv.FormatInt(m.nextOrderID, 10)
+	fees := filled * price * m.FeeRate
+
+	m.orders[exchangeOrderID] = &OrderStatus{
+		OrderID:      exchangeOrderID,
+		Status:       status,
+		FilledQty:    filled,
+		AveragePrice: price,
+		Fees:         fees,
+		UpdatedAt:    time.Now(),
+	}
+
+	return &OrderResult{
+		OrderID:          order.ID,
+		ExchangeOrderID:  exchangeOrderID,
+		Status:           status,
+		ExecutedPrice:    price,
+		ExecutedQuantity: filled,
+		Fees:             fees,
+		Timestamp:        time.Now(),
+	}, nil
+}
+
+func (m *MockExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	if err := m.record(ctx, "GetOrderStatus", orderID); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, exists := m.orders[orderID]
+	if !exists {
+		return nil, fmt.Errorf("order %s: %w", orderID, errUnknownOrder)
+	}
+	copied := *status
+	return &copied, nil
+}
+
+// SetOrderStatus moves an order on the exchange, e.g. fills a resting LIMIT order
+func (m *MockExchange) SetOrderStatus(exchangeOrderID, status string, filled float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if order, exists := m.orders[exchangeOrderID]; exists {
+		order.Status = status
+		order.FilledQty = filled
+		order.UpdatedAt = time.Now()
+	}
+}
+
+func (m *MockExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	if err := m.record(ctx, "GetBalance"); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balances := make(map[string]AssetBalance, len(m.Balances))
+	for asset, bal := range m.Balances {
+		balances[asset] = bal
+	}
+
+	return &Balance{
+		Exchange:  "mock",
+		Balances:  balances,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+func (m *MockExchange) Ping(ctx context.Context) error {
+	return m.record(ctx, "Ping")
+}
+
+// CancelOrder marks an open order as cancelled
+func (m *MockExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	if err := m.record(ctx, "CancelOrder", symbol, orderID); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, exists := m.orders[orderID]
+	if !exists {
+		return fmt.Errorf("order %s: %w", orderID, errUnknownOrder)
+	}
+	if status.Status == "FILLED" {
+		return fmt.Errorf("order %s already filled: %w", orderID, errOrderClosed)
+	}
+	status.Status = "CANCELED"
+	status.UpdatedAt = time.Now()
+	return nil
+}
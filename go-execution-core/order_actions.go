@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// errUnknownOrder and errOrderClosed tell a cancel of an order the exchange
+	// does not know, or that has nothing left to cancel, from exchange failures
+	errUnknownOrder = errors.New("unknown order")
+	errOrderClosed  = errors.New("order is no longer open")
+
+	errModifyUnsupported = errors.New("exchange does not support order modification")
+
+	// errReplacementFailed means a modification cancelled the original order but
+	// the exchange rejected its replacement
+	errReplacementFailed = errors.New("order cancelled but replacement rejected")
+)
+
+// orderModifier is implemented by exchanges that can replace an open order;
+// replacement carries the symbol, side, new quantity and new price
+type orderModifier interface {
+	ModifyOrder(ctx context.Context, orderID string, replacement *Order) (*OrderResult, error)
+}
+
+// modifyOrder replaces the open order exchangeOrderID with replacement, which keeps
+// the engine's order ID, and publishes the outcome like submitOrder does
+func (s *Server) modifyOrder(ctx context.Context, key string, exchange Exchange, exchangeOrderID string,
+	replacement *Order) (*OrderResult, error) {
+	modifier, ok := exchange.(orderModifier)
+	if !ok {
+		return nil, errModifyUnsupported
+	}
+	limits, err := s.riskLimits.Get(ctx)
+	if err != nil {
+		logEvent(ctx, "Failed to load risk limits, using last known", "error", err)
+	}
+	if err := checkOrderLimits(replacement, limits); err != nil {
+		s.recordRiskRejection(ctx, replacement, err)
+		return nil, err
+	}
+
+	s.exchangeCalls.Add(1)
+	defer s.exchangeCalls.Done()
+
+	result, err := modifier.ModifyOrder(ctx, exchangeOrderID, replacement)
+	if err == nil || errors.Is(err, errReplacementFailed) {
+		s.orderEvents.Publish(OrderEvent{
+			Type:            orderEventCancelled,
+			OrderID:         replacement.ID,
+			ExchangeOrderID: exchangeOrderID,
+			StrategyName:    replacement.StrategyName,
+			Symbol:          replacement.Symbol,
+			Side:            replacement.Side,
+			Exchange:        key,
+			Status:          "CANCELED",
+		})
+	}
+	if err == nil {
+		s.publishOrderResult(key, replacement, result, nil)
+		exchangeName, _ := splitExchangeKey(key)
+		ordersSubmitted.WithLabelValues(exchangeName, replacement.Side, result.Status).Inc()
+	}
+	s.invalidateBalance(ctx, key)
+	return result, err
+}
+
+// markOrderCancelled records a successful cancel in the order's trades row
+func (s *Server) markOrderCancelled(ctx context.Context, orderID string) {
+	if s.db == nil {
+		return
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE trades SET status = 'CANCELED' WHERE order_id = $1`, orderID); err != nil {
+		logEvent(ctx, "Failed to mark order cancelled", "order_id", orderID, "error", err)
+		return
+	}
+	s.forgetOrderStatus(ctx, orderID)
+}
+
+// recordOrderReplacement points the order's trades row at the replacement order.
+// Fills of the replaced order stay booked to the position; the replacement's are
+// booked from zero.
+func (s *Server) recordOrderReplacement(ctx context.Context, replacement *Order, result *OrderResult) {
+	if s.db == nil {
+		return
+	}
+	_, err := s.recordOrderFill(ctx, OrderFill{Mode: fillReplace, Trade: &TradeRecord{
+		OrderID:          replacement.ID,
+		Quantity:         replacement.Quantity,
+		Price:            replacement.Price,
+		Status:           result.Status,
+		ExecutedQuantity: result.ExecutedQuantity,
+		ExecutedPrice:    result.ExecutedPrice,
+		Fees:             result.Fees,
+		ExchangeOrderID:  result.ExchangeOrderID,
+	}})
+	if err != nil {
+		logEvent(ctx, "Failed to record order replacement", "order_id", replacement.ID, "error", err)
+	}
+}
+
+// orderTarget is the exchange order a CancelOrder or ModifyOrder call acts on
+type orderTarget struct {
+	key             string
+	exchange        Exchange
+	symbol          string
+	exchangeOrderID string
+	stored          *trackedOrder // nil for orders the engine did not record
+}
+
+// resolveOrderTarget fills symbol and exchange from the order's trades row when
+// the request leaves them out, and refuses orders already in a final state
+func (s *Server) resolveOrderTarget(ctx context.Context, orderID, symbol, exchangeName string) (*orderTarget, error) {
+	if orderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_id required")
+	}
+	target := &orderTarget{exchangeOrderID: orderID}
+	exchangeName, account := normalizeExchangeAccount(exchangeName, "")
+
+	if s.db != nil {
+		stored, err := s.loadStoredOrder(ctx, orderID)
+		switch {
+		case err == nil:
+			if terminalOrderStatuses[stored.Status] {
+				return nil, status.Errorf(codes.FailedPrecondition, "order %s is already %s", orderID, stored.Status)
+			}
+			target.stored = stored
+			if symbol == "" {
+				symbol = stored.Symbol
+			}
+			if exchangeName == "" {
+				exchangeName, account = stored.Exchange, stored.Account
+			}
+			if stored.ExchangeOrderID != "" {
+				target.exchangeOrderID = stored.ExchangeOrderID
+			}
+		case errors.Is(err, errOrderNotFound):
+			if symbol == "" || exchangeName == "" {
+				return nil, status.Errorf(codes.NotFound, "order %s not found; pass symbol and exchange to act on it", orderID)
+			}
+		default:
+			logEvent(ctx, "Failed to load order", "order_id", orderID, "error", err)
+			return nil, status.Error(codes.Internal, "failed to load order")
+		}
+	}
+	if symbol == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol required")
+	}
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+	target.symbol = symbol
+	target.key = exchangeKey(exchangeName, account)
+
+	s.mu.RLock()
+	exchange, exists := s.exchanges[target.key]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "exchange %s not configured", target.key)
+	}
+	target.exchange = exchange
+	return target, nil
+}
+
+// orderActionError maps a failed cancel or modify to a gRPC status
+func orderActionError(orderID string, err error) error {
+	switch {
+	case errors.Is(err, errCancelUnsupported), errors.Is(err, errModifyUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, errUnknownOrder):
+		return status.Errorf(codes.NotFound, "order %s is not open on the exchange", orderID)
+	case errors.Is(err, errOrderClosed), errors.Is(err, errRiskLimitExceeded):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errReplacementFailed):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Errorf(codes.Unavailable, "exchange call failed: %v", err)
+}
+
+// writeOrderActionError answers a failed REST order action with the status
+// of its resolveOrderTarget or orderActionError code: 400 for bad requests and
+// exchanges that cannot do it, 404 for unknown orders and exchanges, 409 for
+// orders that are closed or over a risk limit, 502 when the exchange call failed
+func writeOrderActionError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.InvalidArgument, codes.Unimplemented:
+		code = http.StatusBadRequest
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.FailedPrecondition:
+		code = http.StatusConflict
+	case codes.Aborted, codes.Unavailable:
+		code = http.StatusBadGateway
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"success": false,
+		"error":   st.Message(),
+	})
+}
+
+// CancelOrder cancels an open order, like DELETE /api/v1/orders/{id}
+func (s *Server) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.OrderActionResponse, error) {
+	target, err := s.resolveOrderTarget(ctx, req.OrderId, req.Symbol, req.Exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled := &Order{ID: req.OrderId, Symbol: target.symbol}
+	if target.stored != nil {
+		cancelled.StrategyName, cancelled.Side = target.stored.StrategyName, target.stored.Side
+	}
+	if err := s.cancelOrder(ctx, target.key, target.exchange, cancelled, target.exchangeOrderID); err != nil {
+		logEvent(ctx, "Cancel failed", "order_id", req.OrderId, "exchange", target.key, "error", err)
+		return nil, orderActionError(req.OrderId, err)
+	}
+	s.markOrderCancelled(ctx, req.OrderId)
+	logEvent(ctx, "gRPC cancel", "order_id", req.OrderId, "symbol", target.symbol, "exchange", target.key)
+
+	return &pb.OrderActionResponse{
+		Success:         true,
+		OrderId:         req.OrderId,
+		Status:          "CANCELED",
+		ExchangeOrderId: target.exchangeOrderID,
+		Message:         "order cancelled",
+	}, nil
+}
+
+// ModifyOrder replaces an open order with a limit order at a new quantity and
+// price, like PUT /api/v1/orders/{id}. The replacement keeps the order ID and
+// side; its exchange order ID is returned and written to the trades row.
+func (s *Server) ModifyOrder(ctx context.Context, req *pb.ModifyOrderRequest) (*pb.OrderActionResponse, error) {
+	if req.NewQuantity <= 0 || req.NewPrice <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "new_quantity and new_price must be positive")
+	}
+	target, err := s.resolveOrderTarget(ctx, req.OrderId, req.Symbol, req.Exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement := &Order{
+		ID:        req.OrderId,
+		Symbol:    target.symbol,
+		Side:      req.Side,
+		Quantity:  req.NewQuantity,
+		Price:     req.NewPrice,
+		OrderType: "LIMIT",
+	}
+	if target.stored != nil {
+		replacement.Side = target.stored.Side
+		replacement.StrategyName = target.stored.StrategyName
+	}
+	if replacement.Side != "BUY" && replacement.Side != "SELL" {
+		return nil, status.Error(codes.InvalidArgument, "side must be BUY or SELL for orders the engine did not record")
+	}
+
+	result, err := s.modifyOrder(ctx, target.key, target.exchange, target.exchangeOrderID, replacement)
+	if err != nil {
+		logEvent(ctx, "Modify failed", "order_id", req.OrderId, "exchange", target.key, "error", err)
+		if errors.Is(err, errReplacementFailed) {
+			s.markOrderCancelled(ctx, req.OrderId)
+		}
+		return nil, orderActionError(req.OrderId, err)
+	}
+	s.recordOrderReplacement(ctx, replacement, result)
+	logEvent(ctx, "gRPC modify", "order_id", req.OrderId, "exchange", target.key,
+		"new_exchange_order_id", result.ExchangeOrderID)
+
+	return &pb.OrderActionResponse{
+		Success:         true,
+		OrderId:         req.OrderId,
+		Status:          result.Status,
+		ExchangeOrderId: result.ExchangeOrderID,
+		Message:         "order replaced",
+	}, nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "execution-engine/pb"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Order event types pushed to /api/v1/ws/orders
+const (
+	orderEventSubmitted       = "submitted"
+	orderEventFilled          = "filled"
+	orderEventPartiallyFilled = "partially_filled"
+	orderEventCancelled       = "cancelled"
+	orderEventRejected        = "rejected"
+	orderEventUnknown         = "unknown" // given up by reconciliation
+)
+
+const (
+	orderEventBuffer = 256 // per-connection; a client this far behind is dropped
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+)
+
+// OrderEvent is a change in an order's lifecycle
+type OrderEvent struct {
+	Type            string    `json:"type"`
+	OrderID         string    `json:"order_id"`
+	ExchangeOrderID string    `json:"exchange_order_id,omitempty"`
+	StrategyName    string    `json:"strategy_name,omitempty"`
+	Symbol          string    `json:"symbol"`
+	Side            string    `json:"side,omitempty"`
+	Exchange        string    `json:"exchange,omitempty"`
+	Status          string    `json:"status"`
+	Quantity        float64   `json:"quantity,omitempty"`
+	FilledQuantity  float64   `json:"filled_quantity"`
+	Price           float64   `json:"price,omitempty"`
+	Fees            float64   `json:"fees,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// orderEventType maps an exchange status to the event it represents
+func orderEventType(status string) string {
+	switch status {
+	case "FILLED":
+		return orderEventFilled
+	case "PARTIALLY_FILLED":
+		return orderEventPartiallyFilled
+	case "CANCELED":
+		return orderEventCancelled
+	case "REJECTED", "EXPIRED", "FAILED":
+		return orderEventRejected
+	case orderStatusUnknown:
+		return orderEventUnknown
+	}
+	return orderEventSubmitted
+}
+
+// orderEventFilter narrows a subscription; empty fields match everything
+type orderEventFilter struct {
+	StrategyName string `json:"strategy_name,omitempty"`
+	Symbol       string `json:"symbol,omitempty"`
+}
+
+func (f orderEventFilter) matches(ev *OrderEvent) bool {
+	return (f.StrategyName == "" || f.StrategyName == ev.StrategyName) &&
+		(f.Symbol == "" || f.Symbol == ev.Symbol)
+}
+
+type orderSubscriber struct {
+	send    chan interface{}
+	filter  orderEventFilter
+	dropped bool // set before send is closed for falling behind
+}
+
+// OrderEventHub fans order events out to websocket subscribers and, when enabled,
+// to Redis. Publishing never blocks: a subscriber whose buffer is full is dropped
+// and its channel closed.
+type OrderEventHub struct {
+	subscribers map[*orderSubscriber]struct{}
+	relay       *orderEventRelay // nil unless ORDER_EVENTS_REDIS_ENABLED
+	dropped     atomic.Uint64
+	published   atomic.Uint64
+	mu          sync.Mutex
+}
+
+func NewOrderEventHub() *OrderEventHub {
+	return &OrderEventHub{subscribers: make(map[*orderSubscriber]struct{})}
+}
+
+func (h *OrderEventHub) subscribe(filter orderEventFilter) *orderSubscriber {
+	sub := &orderSubscriber{send: make(chan interface{}, orderEventBuffer), filter: filter}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *OrderEventHub) unsubscribe(sub *orderSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.subscribers[sub]; exists {
+		delete(h.subscribers, sub)
+		close(sub.send)
+	}
+}
+
+// setFilter replaces a subscriber's filter and queues an acknowledgement
+func (h *OrderEventHub) setFilter(sub *orderSubscriber, filter orderEventFilter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.subscribers[sub]; !exists {
+		return
+	}
+	sub.filter = filter
+	h.deliver(sub, map[string]interface{}{"type": "subscribed", "filters": filter})
+}
+
+// deliver queues msg without blocking; caller holds h.mu
+func (h *OrderEventHub) deliver(sub *orderSubscriber, msg interface{}) {
+	select {
+	case sub.send <- msg:
+	default:
+		delete(h.subscribers, sub)
+		sub.dropped = true
+		close(sub.send)
+		h.dropped.Add(1)
+	}
+}
+
+// Publish sends ev to every matching subscriber
+func (h *OrderEventHub) Publish(ev OrderEvent) {
+	if h == nil {
+		return
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+	h.published.Add(1)
+	h.relay.enqueueOrder(&ev)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if sub.filter.matches(&ev) {
+			h.deliver(sub, &ev)
+		}
+	}
+}
+
+var (
+	orderEventSubscribersDesc = prometheus.NewDesc("signalops_order_event_subscribers",
+		"Open order event subscriptions.", nil, nil)
+	orderEventsPublishedDesc = prometheus.NewDesc("signalops_order_events_published_total",
+		"Order events published.", nil, nil)
+	orderEventDroppedDesc = prometheus.NewDesc("signalops_order_event_subscribers_dropped_total",
+		"Order event subscribers disconnected for falling behind.", nil, nil)
+)
+
+func (h *OrderEventHub) collect(ch chan<- prometheus.Metric) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	subscribers := len(h.subscribers)
+	h.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(orderEventSubscribersDesc, prometheus.GaugeValue, float64(subscribers))
+	ch <- prometheus.MustNewConstMetric(orderEventsPublishedDesc, prometheus.CounterValue, float64(h.published.Load()))
+	ch <- prometheus.MustNewConstMetric(orderEventDroppedDesc, prometheus.CounterValue, float64(h.dropped.Load()))
+}
+
+// publishOrderResult reports a submission and, when the exchange already moved it
+// on (filled, rejected, ...), that transition too
+func (s *Server) publishOrderResult(exchangeKey string, order *Order, result *OrderResult, err error) {
+	ev := OrderEvent{
+		Type:         orderEventSubmitted,
+		OrderID:      order.ID,
+		StrategyName: order.StrategyName,
+		Symbol:       order.Symbol,
+		Side:         order.Side,
+		Exchange:     exchangeKey,
+		Quantity:     order.Quantity,
+		Price:        order.Price,
+	}
+	if err != nil {
+		ev.Type, ev.Status, ev.Error = orderEventRejected, "REJECTED", err.Error()
+		s.orderEvents.Publish(ev)
+		return
+	}
+
+	ev.ExchangeOrderID = result.ExchangeOrderID
+	ev.Status = result.Status
+	ev.FilledQuantity = result.ExecutedQuantity
+	ev.Fees = result.Fees
+	if result.ExecutedPrice > 0 {
+		ev.Price = result.ExecutedPrice
+	}
+	s.orderEvents.Publish(ev)
+	s.recordFill(Fill{
+		OrderID:      order.ID,
+		StrategyName: order.StrategyName,
+		Symbol:       order.Symbol,
+		Side:         order.Side,
+		Exchange:     exchangeKey,
+		Price:        ev.Price,
+		Quantity:     result.ExecutedQuantity,
+		Fees:         result.Fees,
+	})
+
+	if next := orderEventType(result.Status); next != orderEventSubmitted {
+		ev.Type = next
+		s.orderEvents.Publish(ev)
+	}
+}
+
+func (s *Server) registerOrderStreamEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/ws/orders", s.handleOrderStream)
+}
+
+// handleOrderStream upgrades to a websocket pushing OrderEvents as JSON. Filters
+// come from the query string and can be changed with
+// {"type": "subscribe", "strategy_name": "...", "symbol": "..."}.
+func (s *Server) handleOrderStream(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || s.originAllowed(origin)
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already wrote the error response
+	}
+	defer conn.Close()
+	defer trackConnection("orders")()
+
+	sub := s.orderEvents.subscribe(orderEventFilter{
+		StrategyName: r.URL.Query().Get("strategy_name"),
+		Symbol:       r.URL.Query().Get("symbol"),
+	})
+	defer s.orderEvents.unsubscribe(sub)
+	logEvent(r.Context(), "Order stream connected", "strategy_name", sub.filter.StrategyName, "symbol", sub.filter.Symbol)
+
+	// Reader: subscribe messages and pongs
+	go func() {
+		defer s.orderEvents.unsubscribe(sub)
+		conn.SetReadLimit(wsMaxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg struct {
+				Type string `json:"type"`
+				orderEventFilter
+			}
+			if json.Unmarshal(data, &msg) != nil || msg.Type != "subscribe" {
+				continue
+			}
+			s.orderEvents.setFilter(sub, msg.orderEventFilter)
+		}
+	}()
+
+	// Writer: the only goroutine writing to conn
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-sub.send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				if sub.dropped {
+					conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow, events dropped"))
+				}
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// StreamOrderUpdates is the gRPC counterpart of /api/v1/ws/orders: it pushes every
+// order state change matching the filter until the client cancels. The stream
+// shares the hub's bounded buffer, so a client that falls behind is dropped with
+// RESOURCE_EXHAUSTED rather than holding up publishers.
+func (s *Server) StreamOrderUpdates(req *pb.OrderUpdatesRequest, stream pb.ExecutionService_StreamOrderUpdatesServer) error {
+	sub := s.orderEvents.subscribe(orderEventFilter{
+		StrategyName: req.StrategyName,
+		Symbol:       strings.ToUpper(req.Symbol),
+	})
+	defer s.orderEvents.unsubscribe(sub)
+	ctx := stream.Context()
+	logEvent(ctx, "Order update stream opened", "strategy_name", sub.filter.StrategyName, "symbol", sub.filter.Symbol)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.streamCtx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case msg, ok := <-sub.send:
+			if !ok {
+				if sub.dropped {
+					return status.Errorf(codes.ResourceExhausted, "stream fell more than %d updates behind", orderEventBuffer)
+				}
+				return nil
+			}
+			ev, isEvent := msg.(*OrderEvent)
+			if !isEvent {
+				continue
+			}
+			if err := stream.Send(orderUpdateProto(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func orderUpdateProto(ev *OrderEvent) *pb.OrderUpdate {
+	update := &pb.OrderUpdate{
+		OrderId:         ev.OrderID,
+		ExchangeOrderId: ev.ExchangeOrderID,
+		Status:          ev.Status,
+		FilledQuantity:  ev.FilledQuantity,
+		Fees:            ev.Fees,
+		Timestamp:       timestamppb.New(ev.Timestamp),
+		EventType:       ev.Type,
+		StrategyName:    ev.StrategyName,
+		Symbol:          ev.Symbol,
+		Side:            ev.Side,
+		Exchange:        ev.Exchange,
+		Error:           ev.Error,
+	}
+	// Before any fill the event carries the limit price, not an average
+	if ev.FilledQuantity > 0 {
+		update.AveragePrice = ev.Price
+	}
+	return update
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// orderEventSchemaVersion is the schema_version of order and fill events on
+// Redis. Adding a field keeps it; renaming, removing or changing the meaning of
+// one bumps it.
+const orderEventSchemaVersion = 1
+
+// orderEventPublishTimeout bounds one PUBLISH or XADD, so a stalled Redis fills the
+// queue and drops events instead of holding them indefinitely
+const orderEventPublishTimeout = 2 * time.Second
+
+var orderEventsRelayed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_order_events_redis_total",
+	Help: "Order events sent to Redis pub/sub by result (published, dropped when the queue is full, failed).",
+}, []string{"result"})
+
+// orderEventMessage is an OrderEvent as published on Redis
+type orderEventMessage struct {
+	SchemaVersion int `json:"schema_version"`
+	OrderEvent
+}
+
+// fillEventMessage is a Fill as appended to the event stream
+type fillEventMessage struct {
+	SchemaVersion int `json:"schema_version"`
+	Fill
+}
+
+// relayedEvent is a queued order event or fill
+type relayedEvent struct {
+	order *OrderEvent
+	fill  *Fill
+}
+
+// orderEventRelay sends order events to Redis pub/sub channels named
+// ORDER_EVENTS_REDIS_PREFIX:type (orders:submitted, orders:filled, ...) and, with
+// ORDER_EVENTS_STREAM, appends them and fills to that Redis Stream. The order path
+// only queues: events are sent in order by one goroutine, and are dropped and
+// counted when the queue is full or Redis fails. Pub/sub reaches only connected
+// subscribers; the stream keeps the last ORDER_EVENTS_STREAM_MAXLEN entries for
+// consumer groups (event_stream.go).
+type orderEventRelay struct {
+	client *redis.Client
+	prefix string // "" when events are not published
+	stream *eventStream
+	queue  chan relayedEvent
+}
+
+func newOrderEventRelay(client *redis.Client, prefix string, stream *eventStream, buffer int) *orderEventRelay {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &orderEventRelay{client: client, prefix: prefix, stream: stream, queue: make(chan relayedEvent, buffer)}
+}
+
+// enqueueOrder queues ev without blocking; a nil relay drops it
+func (r *orderEventRelay) enqueueOrder(ev *OrderEvent) {
+	if r != nil {
+		r.enqueue(relayedEvent{order: ev})
+	}
+}
+
+// enqueueFill queues a fill for the stream without blocking
+func (r *orderEventRelay) enqueueFill(fill Fill) {
+	if r != nil && r.stream != nil {
+		r.enqueue(relayedEvent{fill: &fill})
+	}
+}
+
+func (r *orderEventRelay) enqueue(ev relayedEvent) {
+	select {
+	case r.queue <- ev:
+	default:
+		orderEventsRelayed.WithLabelValues("dropped").Inc()
+	}
+}
+
+// run sends queued events until ctx is cancelled
+func (r *orderEventRelay) run(ctx context.Context) {
+	if r.stream != nil {
+		r.stream.ensureGroup(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-r.queue:
+			if ev.order != nil && r.prefix != "" {
+				r.publish(ctx, ev.order)
+			}
+			if r.stream != nil {
+				r.stream.append(ctx, ev, streamSourceLive)
+			}
+		}
+	}
+}
+
+func (r *orderEventRelay) publish(ctx context.Context, ev *OrderEvent) {
+	data, err := json.Marshal(orderEventMessage{SchemaVersion: orderEventSchemaVersion, OrderEvent: *ev})
+	if err != nil {
+		log.Printf("Failed to encode order event: %v", err)
+		orderEventsRelayed.WithLabelValues("failed").Inc()
+		return
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, orderEventPublishTimeout)
+	defer cancel()
+	if err := r.client.Publish(publishCtx, r.prefix+":"+ev.Type, data).Err(); err != nil {
+		logEvent(ctx, "Failed to publish order event to Redis", "order_id", ev.OrderID, "type", ev.Type, "error", err)
+		orderEventsRelayed.WithLabelValues("failed").Inc()
+		return
+	}
+	orderEventsRelayed.WithLabelValues("published").Inc()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis starts an in-memory Redis and a client for it
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+// relayToRedis wires s's order events to Redis as main does for
+// ORDER_EVENTS_REDIS_ENABLED, on the "orders" prefix
+func relayToRedis(s *Server, client *redis.Client, stream *eventStream, buffer int) {
+	s.eventStream = stream
+	s.eventRelay = newOrderEventRelay(client, "orders", stream, buffer)
+	s.orderEvents.relay = s.eventRelay
+	go s.eventRelay.run(s.streamCtx)
+}
+
+func TestOrderEventsPublishedToRedis(t *testing.T) {
+	s, _ := newTestServer(t)
+	_, client := newTestRedis(t)
+	stream := &eventStream{client: client, name: "order-events", maxLen: 1000, group: "default"}
+	relayToRedis(s, client, stream, 16)
+	srv := serveTest(t, s)
+
+	sub := client.PSubscribe(context.Background(), "orders:*")
+	defer sub.Close()
+	if _, err := sub.Receive(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	messages := sub.Channel()
+
+	order := map[string]interface{}{"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT",
+		"side": "BUY", "quantity": 0.5, "price": 30000, "order_type": "LIMIT", "exchange": "mock"}
+	if code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", order); code != http.StatusOK {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+
+	for _, channel := range []string{"orders:submitted", "orders:filled"} {
+		var msg *redis.Message
+		select {
+		case msg = <-messages:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no message on %s", channel)
+		}
+		if msg.Channel != channel {
+			t.Fatalf("message on %s, want %s", msg.Channel, channel)
+		}
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{
+			"schema_version": float64(orderEventSchemaVersion), "type": channel[len("orders:"):],
+			"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY",
+			"exchange": "mock", "status": "FILLED", "quantity": 0.5, "filled_quantity": 0.5, "price": 30000.0,
+		}
+		for field, value := range want {
+			if ev[field] != value {
+				t.Errorf("%s: %s = %v, want %v", channel, field, ev[field], value)
+			}
+		}
+		if ev["exchange_order_id"] == "" || ev["timestamp"] == nil {
+			t.Errorf("%s: missing exchange_order_id or timestamp: %s", channel, msg.Payload)
+		}
+	}
+
+	// The stream gets the same two events and the fill, in order
+	deadline := time.Now().Add(2 * time.Second)
+	var entries []redis.XMessage
+	for len(entries) < 3 && time.Now().Before(deadline) {
+		var err error
+		if entries, err = client.XRange(context.Background(), "order-events", "-", "+").Result(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var types []interface{}
+	for _, entry := range entries {
+		types = append(types, entry.Values["type"])
+	}
+	if len(types) != 3 || types[0] != orderEventSubmitted || types[1] != fillEventName || types[2] != orderEventFilled {
+		t.Errorf("stream entry types %v, want submitted, fill, filled", types)
+	}
+}
+
+// TestOrderEventsRedisDown checks a dead Redis costs the order path nothing: the
+// order goes through and the events are counted as failed
+func TestOrderEventsRedisDown(t *testing.T) {
+	s, _ := newTestServer(t)
+	mr, client := newTestRedis(t)
+	relayToRedis(s, client, nil, 16)
+	srv := serveTest(t, s)
+	failedBefore, _ := scrapeMetric(t, srv, "signalops_order_events_redis_total", "result", "failed")
+	mr.Close()
+
+	start := time.Now()
+	if code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", testOrder("ord-1", 0.1)); code != http.StatusOK {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("submit took %v with Redis down", took)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		failed, _ := scrapeMetric(t, srv, "signalops_order_events_redis_total", "result", "failed")
+		if failed-failedBefore == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v events counted as failed, want 2", failed-failedBefore)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestOrderEventRelayDropsWhenFull checks enqueueing never blocks: with nothing
+// draining the queue, events beyond its size are dropped and counted
+func TestOrderEventRelayDropsWhenFull(t *testing.T) {
+	s, _ := newTestServer(t)
+	_, client := newTestRedis(t)
+	relay := newOrderEventRelay(client, "orders", nil, 2)
+	s.orderEvents.relay = relay
+	srv := serveTest(t, s)
+	droppedBefore, _ := scrapeMetric(t, srv, "signalops_order_events_redis_total", "result", "dropped")
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			s.orderEvents.Publish(OrderEvent{Type: orderEventSubmitted, OrderID: "ord-1", Symbol: "BTCUSDT"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full relay queue")
+	}
+
+	if dropped, _ := scrapeMetric(t, srv, "signalops_order_events_redis_total", "result", "dropped"); dropped-droppedBefore != 3 {
+		t.Errorf("%v events dropped, want 3", dropped-droppedBefore)
+	}
+	if len(relay.queue) != 2 {
+		t.Errorf("%d events queued, want 2", len(relay.queue))
+	}
+}
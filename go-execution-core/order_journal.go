@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Orders that reached an exchange must end up in trades even when Postgres is
+// down at the moment they are logged. A trades insert that fails for a reason
+// retrying can fix is appended to a journal file (one JSON object per line,
+// fsynced) and a background worker retries the journal with backoff, rewriting
+// the file without the rows Postgres accepted. Journaled rows left by a previous
+// run are replayed at startup before the ports open.
+
+// Backoff between journal flushes while Postgres keeps failing
+const (
+	orderJournalRetryMin = time.Second
+	orderJournalRetryMax = time.Minute
+)
+
+var orderJournalDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "signalops_order_journal_depth",
+	Help: "Order rows waiting in the local journal for Postgres to accept them.",
+})
+
+// permanentDBError reports whether retrying err cannot help: the row itself is
+// rejected (bad data, a constraint) or the statement does not fit the schema
+func permanentDBError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Class() {
+	case "22", "23", "42":
+		return true
+	}
+	return false
+}
+
+// orderJournal is the file of order rows waiting for Postgres, mirrored in memory
+type orderJournal struct {
+	path       string
+	alertDepth int
+
+	mu        sync.Mutex
+	entries   []TradeRecord
+	nextAlert int           // depth at which the next backlog alert is logged
+	added     chan struct{} // wakes the flush worker
+}
+
+// openOrderJournal loads the journal at path, creating its directory. A line cut
+// short by a crash mid-append is skipped and the file rewritten without it, so
+// the next append starts on a line of its own.
+func openOrderJournal(path string, alertDepth int) (*orderJournal, error) {
+	if alertDepth < 1 {
+		alertDepth = 1
+	}
+	j := &orderJournal{path: path, alertDepth: alertDepth, nextAlert: alertDepth, added: make(chan struct{}, 1)}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create order journal directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order journal: %w", err)
+	}
+	clean := len(data) == 0 || data[len(data)-1] == '\n'
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry TradeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.OrderID == "" {
+			log.Printf("Warning: skipping unreadable order journal line %d: %s", line, scanner.Text())
+			clean = false
+			continue
+		}
+		j.entries = append(j.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order journal: %w", err)
+	}
+	if !clean {
+		if err := j.rewrite(); err != nil {
+			return nil, fmt.Errorf("failed to repair order journal: %w", err)
+		}
+	}
+	j.setDepth()
+	return j, nil
+}
+
+// add appends an entry to the file and returns the new depth
+func (j *orderJournal) add(entry *TradeRecord) (int, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	j.entries = append(j.entries, *entry)
+	j.setDepth()
+	select {
+	case j.added <- struct{}{}:
+	default:
+	}
+	return len(j.entries), nil
+}
+
+// pending returns the waiting entries, oldest first
+func (j *orderJournal) pending() []TradeRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]TradeRecord(nil), j.entries...)
+}
+
+// remove drops written entries and rewrites the file without them
+func (j *orderJournal) remove(orderIDs map[string]bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	kept := j.entries[:0]
+	for _, entry := range j.entries {
+		if !orderIDs[entry.OrderID] {
+			kept = append(kept, entry)
+		}
+	}
+	j.entries = kept
+	j.setDepth()
+	if len(j.entries) < j.alertDepth {
+		j.nextAlert = j.alertDepth
+	}
+	return j.rewrite()
+}
+
+// rewrite replaces the file with the in-memory entries; the caller holds mu
+func (j *orderJournal) rewrite() error {
+	var buf bytes.Buffer
+	for _, entry := range j.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// alert reports whether depth warrants a backlog alert, which is logged at the
+// alert depth and again each time the backlog doubles
+func (j *orderJournal) alert(depth int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if depth < j.nextAlert {
+		return false
+	}
+	for j.nextAlert <= depth {
+		j.nextAlert *= 2
+	}
+	return true
+}
+
+func (j *orderJournal) setDepth() {
+	orderJournalDepth.Set(float64(len(j.entries)))
+}
+
+// journalOrder keeps an order row Postgres refused for later; rows it will never
+// take are only logged
+func (s *Server) journalOrder(ctx context.Context, entry *TradeRecord, insertErr error) {
+	if s.orderJournal == nil || permanentDBError(insertErr) {
+		logEvent(ctx, "Order row not journaled", "order_id", entry.OrderID, "error", insertErr)
+		return
+	}
+	depth, err := s.orderJournal.add(entry)
+	if err != nil {
+		// Last resort: the row is in the log for manual recovery
+		row, _ := json.Marshal(entry)
+		logEvent(ctx, "Failed to journal order row", "order_id", entry.OrderID, "error", err, "row", string(row))
+		return
+	}
+	logEvent(ctx, "Order row journaled for retry", "order_id", entry.OrderID, "depth", depth)
+	if s.orderJournal.alert(depth) {
+		logEvent(ctx, "ALERT order journal backlog growing; trades are not reaching Postgres",
+			"depth", depth, "path", s.orderJournal.path)
+	}
+}
+
+// flushOrderJournal writes journaled rows oldest first and books their fills,
+// stopping at the first row Postgres still refuses. It returns how many are left.
+func (s *Server) flushOrderJournal(ctx context.Context) int {
+	entries := s.orderJournal.pending()
+	written := make(map[string]bool)
+	var flushErr error
+	for i := range entries {
+		entry := &entries[i]
+		if ctx.Err() != nil {
+			break
+		}
+		dbCtx, cancel := s.dbContext(ctx)
+		_, err := s.recordOrderFill(dbCtx, OrderFill{Trade: entry, Mode: fillReplay})
+		cancel()
+		if err != nil && !permanentDBError(err) {
+			flushErr = err
+			break
+		}
+		if err != nil {
+			row, _ := json.Marshal(entry)
+			logEvent(ctx, "Dropping journaled order row Postgres rejects", "order_id", entry.OrderID,
+				"error", err, "row", string(row))
+		} else {
+			logEvent(ctx, "Journaled order row written", "order_id", entry.OrderID)
+		}
+		written[entry.OrderID] = true
+	}
+
+	if len(written) > 0 {
+		if err := s.orderJournal.remove(written); err != nil {
+			// The rows stay in the file; replaying them again skips what exists
+			logEvent(ctx, "Failed to rewrite order journal", "error", err)
+		}
+	}
+	remaining := len(entries) - len(written)
+	if flushErr != nil {
+		logEvent(ctx, "Order journal flush failed", "remaining", remaining, "error", flushErr)
+	}
+	return remaining
+}
+
+// replayOrderJournal makes one pass over rows left by a previous run
+func (s *Server) replayOrderJournal() {
+	if s.orderJournal == nil {
+		return
+	}
+	pending := len(s.orderJournal.pending())
+	if pending == 0 {
+		return
+	}
+	log.Printf("Replaying %d journaled order rows from %s", pending, s.orderJournal.path)
+	if remaining := s.flushOrderJournal(context.Background()); remaining > 0 {
+		log.Printf("Warning: %d journaled order rows still pending; retrying in the background", remaining)
+	} else {
+		log.Println("✓ Order journal replayed")
+	}
+}
+
+// runOrderJournal retries the journal until the server shuts down, backing off
+// while Postgres keeps failing
+func (s *Server) runOrderJournal() {
+	if s.orderJournal == nil {
+		return
+	}
+	delay := orderJournalRetryMin
+	for {
+		if len(s.orderJournal.pending()) == 0 {
+			delay = orderJournalRetryMin
+			select {
+			case <-s.streamCtx.Done():
+				return
+			case <-s.orderJournal.added:
+			}
+		}
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if s.flushOrderJournal(s.streamCtx) == 0 {
+			delay = orderJournalRetryMin
+			continue
+		}
+		if delay *= 2; delay > orderJournalRetryMax {
+			delay = orderJournalRetryMax
+		}
+	}
+}
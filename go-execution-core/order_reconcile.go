@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Orders the exchange has not finished with (NEW, PARTIALLY_FILLED, ...) are
+// polled in the background so trades, positions and the order streams catch up
+// with fills that happen after submission. Orders that keep failing to refresh
+// are polled less often, and those older than the retention window are given up
+// as UNKNOWN. A refresh on demand (GET /api/v1/orders/{id}?refresh=true) still
+// works for them.
+
+// orderStatusUnknown marks an order the reconciler stopped polling
+const orderStatusUnknown = "UNKNOWN"
+
+// reconcileMaxBackoff caps how far apart a failing order's attempts get
+const reconcileMaxBackoff = 30 * time.Minute
+
+var orderReconciliations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_order_reconciliations_total",
+	Help: "Background order status refreshes by result (refreshed, error, expired).",
+}, []string{"result"})
+
+// reconcileBackoff is the retry state of an order whose refreshes fail
+type reconcileBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// runOrderReconciliation refreshes open orders every interval until the server shuts down
+func (s *Server) runOrderReconciliation() {
+	interval := s.config.OrderReconcileInterval
+	if s.db == nil || interval <= 0 {
+		return
+	}
+	log.Printf("✓ Order reconciliation every %s (orders given up after %s)", interval, s.config.OrderReconcileMaxAge)
+
+	backoffs := make(map[string]*reconcileBackoff)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+			s.reconcileOrders(s.streamCtx, backoffs, time.Now())
+		}
+	}
+}
+
+// reconcileOrders runs one pass over the open orders, oldest first
+func (s *Server) reconcileOrders(ctx context.Context, backoffs map[string]*reconcileBackoff, now time.Time) {
+	s.expireOpenOrders(ctx, now.Add(-s.config.OrderReconcileMaxAge))
+
+	dbCtx, cancel := s.dbContext(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(dbCtx, `
+		SELECT order_id FROM trades
+		WHERE status NOT IN ('FILLED', 'CANCELED', 'REJECTED', 'EXPIRED', 'FAILED', 'UNKNOWN')
+		ORDER BY timestamp
+		LIMIT $1
+	`, s.config.OrderReconcileBatch)
+	if err != nil {
+		logEvent(ctx, "Failed to load open orders for reconciliation", "error", err)
+		return
+	}
+	var orderIDs []string
+	for rows.Next() {
+		var orderID string
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			logEvent(ctx, "Failed to load open orders for reconciliation", "error", err)
+			return
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logEvent(ctx, "Failed to load open orders for reconciliation", "error", err)
+		return
+	}
+
+	open := make(map[string]bool, len(orderIDs))
+	for _, orderID := range orderIDs {
+		open[orderID] = true
+		backoff := backoffs[orderID]
+		if backoff != nil && now.Before(backoff.next) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Exchange calls wait on the exchange's own rate limiter, one order at a time
+		order, err := s.refreshOrderStatus(ctx, orderID)
+		switch {
+		case err != nil || order.RefreshError != "":
+			if backoff == nil {
+				backoff = &reconcileBackoff{}
+				backoffs[orderID] = backoff
+			}
+			backoff.failures++
+			// Wait twice as long after each failure
+			delay := s.config.OrderReconcileInterval
+			for i := 0; i < backoff.failures && delay < reconcileMaxBackoff; i++ {
+				delay *= 2
+			}
+			if delay > reconcileMaxBackoff {
+				delay = reconcileMaxBackoff
+			}
+			backoff.next = now.Add(delay)
+			orderReconciliations.WithLabelValues("error").Inc()
+		default:
+			delete(backoffs, orderID)
+			orderReconciliations.WithLabelValues("refreshed").Inc()
+		}
+	}
+
+	// Forget orders that finished or were given up
+	for orderID := range backoffs {
+		if !open[orderID] {
+			delete(backoffs, orderID)
+		}
+	}
+}
+
+// expireOpenOrders marks open orders placed before cutoff UNKNOWN and tells the
+// order streams
+func (s *Server) expireOpenOrders(ctx context.Context, cutoff time.Time) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE trades
+		SET status = $2
+		WHERE status NOT IN ('FILLED', 'CANCELED', 'REJECTED', 'EXPIRED', 'FAILED', 'UNKNOWN')
+		  AND timestamp < $1
+		RETURNING order_id, COALESCE(exchange_order_id, ''), COALESCE(exchange, ''), account, strategy_name,
+		          symbol, side, COALESCE(filled_quantity, 0), COALESCE(executed_price, 0), COALESCE(fees, 0)
+	`, cutoff, orderStatusUnknown)
+	if err != nil {
+		logEvent(ctx, "Failed to expire stale orders", "error", err)
+		return
+	}
+	var expired []string
+	// Deferred before rows.Close so it runs after it, once the UPDATE has completed
+	defer func() { s.forgetOrderStatus(ctx, expired...) }()
+	defer rows.Close()
+
+	for rows.Next() {
+		var o trackedOrder
+		if err := rows.Scan(&o.OrderID, &o.ExchangeOrderID, &o.Exchange, &o.Account, &o.StrategyName,
+			&o.Symbol, &o.Side, &o.FilledQty, &o.AveragePrice, &o.Fees); err != nil {
+			logEvent(ctx, "Failed to read expired order", "error", err)
+			return
+		}
+		expired = append(expired, o.OrderID)
+		logEvent(ctx, "Order given up as UNKNOWN", "order_id", o.OrderID, "exchange", exchangeKey(o.Exchange, o.Account))
+		orderReconciliations.WithLabelValues("expired").Inc()
+		s.orderEvents.Publish(OrderEvent{
+			Type:            orderEventType(orderStatusUnknown),
+			OrderID:         o.OrderID,
+			ExchangeOrderID: o.ExchangeOrderID,
+			StrategyName:    o.StrategyName,
+			Symbol:          o.Symbol,
+			Side:            o.Side,
+			Exchange:        exchangeKey(o.Exchange, o.Account),
+			Status:          orderStatusUnknown,
+			FilledQuantity:  o.FilledQty,
+			Price:           o.AveragePrice,
+			Fees:            o.Fees,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		logEvent(ctx, "Failed to read expired orders", "error", err)
+	}
+}
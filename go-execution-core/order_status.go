@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxOrderStatusBatch caps how many orders one batch status request may refresh
+const maxOrderStatusBatch = 100
+
+var errOrderNotFound = errors.New("order not found")
+
+// Orders in these states never change again, so they are served from the trades table
+var terminalOrderStatuses = map[string]bool{
+	"FILLED":   true,
+	"CANCELED": true,
+	"REJECTED": true,
+	"EXPIRED":  true,
+	"FAILED":   true,
+}
+
+// symbolOrderStatuser is implemented by exchanges whose order lookup needs the symbol
+type symbolOrderStatuser interface {
+	GetSymbolOrderStatus(ctx context.Context, symbol, orderID string) (*OrderStatus, error)
+}
+
+// trackedOrder is an order's status as recorded locally, refreshed from the exchange
+type trackedOrder struct {
+	OrderID         string
+	ExchangeOrderID string
+	Exchange        string
+	Account         string
+	StrategyName    string
+	Symbol          string
+	Side            string
+	Status          string
+	FilledQty       float64
+	AveragePrice    float64
+	Fees            float64
+	UpdatedAt       time.Time
+	Source          string // "exchange" when refreshed, "database" otherwise
+	RefreshError    string // why the exchange could not be queried, if it was tried
+}
+
+// loadStoredOrder reads an order as recorded in the trades table, without asking
+// its exchange
+func (s *Server) loadStoredOrder(ctx context.Context, orderID string) (*trackedOrder, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	order := &trackedOrder{OrderID: orderID, Source: "database"}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(exchange_order_id, ''), COALESCE(exchange, ''), account, strategy_name, symbol, side,
+		       status, COALESCE(filled_quantity, 0), COALESCE(executed_price, 0), COALESCE(fees, 0), updated_at
+		FROM trades
+		WHERE order_id = $1
+	`, orderID).Scan(&order.ExchangeOrderID, &order.Exchange, &order.Account, &order.StrategyName, &order.Symbol,
+		&order.Side, &order.Status, &order.FilledQty, &order.AveragePrice, &order.Fees, &order.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// orderRecord is the full trades row of an order
+type orderRecord struct {
+	trackedOrder
+	AccountType string
+	OrderType   string // "" for orders recorded before it was kept
+	Quantity    float64
+	Price       float64 // limit price, 0 for market orders
+	Timestamp   time.Time
+	ExecutedAt  *time.Time
+	PnL         *float64
+	Slippage    *float64
+	Metadata    json.RawMessage
+	CreatedAt   time.Time
+}
+
+// orderRecordColumns are the trades columns scanOrderRecord reads, in order
+const orderRecordColumns = `
+	order_id, COALESCE(exchange_order_id, ''), COALESCE(exchange, ''), account, account_type, strategy_name,
+	symbol, side, COALESCE(order_type, ''), quantity, price, status, COALESCE(filled_quantity, 0),
+	COALESCE(executed_price, 0), COALESCE(fees, 0), timestamp, executed_at, pnl, slippage, metadata,
+	created_at, updated_at`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrderRecord(row rowScanner) (*orderRecord, error) {
+	record := &orderRecord{trackedOrder: trackedOrder{Source: "database"}}
+	var executedAt sql.NullTime
+	var pnl, slippage sql.NullFloat64
+	var metadata []byte
+	err := row.Scan(&record.OrderID, &record.ExchangeOrderID, &record.Exchange, &record.Account,
+		&record.AccountType, &record.StrategyName, &record.Symbol, &record.Side, &record.OrderType, &record.Quantity, &record.Price,
+		&record.Status, &record.FilledQty, &record.AveragePrice, &record.Fees, &record.Timestamp, &executedAt,
+		&pnl, &slippage, &metadata, &record.CreatedAt, &record.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if executedAt.Valid {
+		record.ExecutedAt = &executedAt.Time
+	}
+	if pnl.Valid {
+		record.PnL = &pnl.Float64
+	}
+	if slippage.Valid {
+		record.Slippage = &slippage.Float64
+	}
+	if len(metadata) > 0 {
+		record.Metadata = json.RawMessage(metadata)
+	}
+	return record, nil
+}
+
+// loadOrderRecord reads every column of an order's trades row
+func (s *Server) loadOrderRecord(ctx context.Context, orderID string) (*orderRecord, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	record, err := scanOrderRecord(s.db.QueryRowContext(ctx,
+		`SELECT `+orderRecordColumns+` FROM trades WHERE order_id = $1`, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errOrderNotFound
+	}
+	return record, err
+}
+
+// loadOpenOrders reads the full record of every order not yet final, oldest
+// first. Empty exchange, account or symbol match any; exchange is the base name.
+func (s *Server) loadOpenOrders(ctx context.Context, exchange, account, symbol string) ([]*orderRecord, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var where whereBuilder
+	where.add("status IN ('NEW', 'PARTIALLY_FILLED', 'PENDING')")
+	if exchange != "" {
+		where.add("COALESCE(NULLIF(exchange, ''), 'binance') = ?", exchange)
+		where.add("account = ?", account)
+	}
+	if symbol != "" {
+		where.add("symbol = ?", strings.ToUpper(symbol))
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+orderRecordColumns+` FROM trades `+where.sql()+
+		` ORDER BY timestamp, order_id`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*orderRecord, 0)
+	for rows.Next() {
+		record, err := scanOrderRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, record)
+	}
+	return orders, rows.Err()
+}
+
+// orderListFilter selects a page of orders for GET /api/v1/orders and ListOrders;
+// empty fields match any order
+type orderListFilter struct {
+	StrategyName string
+	Symbol       string
+	Side         string
+	Status       string
+	Exchange     string
+	From, To     time.Time // zero leaves that side open
+	Cursor       *pageCursor
+	Limit        int
+}
+
+// listOrders reads one page of orders newest first, with the cursor of the next
+// page ("" on the last)
+func (s *Server) listOrders(ctx context.Context, f orderListFilter) ([]*orderRecord, string, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	query, args := listOrdersQuery(f)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	orders := make([]*orderRecord, 0)
+	for rows.Next() {
+		record, err := scanOrderRecord(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		orders = append(orders, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(orders) > f.Limit {
+		orders = orders[:f.Limit]
+		last := orders[len(orders)-1]
+		nextCursor = encodeCursor(last.Timestamp, last.OrderID)
+	}
+	return orders, nextCursor, nil
+}
+
+// listOrdersQuery is the query listOrders runs for f. Each filter column has a
+// (column, timestamp DESC, order_id DESC) index serving both the filter and the
+// page order.
+func listOrdersQuery(f orderListFilter) (string, []interface{}) {
+	var where whereBuilder
+	for _, filter := range []struct{ column, value string }{
+		{"strategy_name", f.StrategyName},
+		{"symbol", strings.ToUpper(f.Symbol)},
+		{"side", strings.ToUpper(f.Side)},
+		{"status", strings.ToUpper(f.Status)},
+		{"exchange", f.Exchange},
+	} {
+		if filter.value != "" {
+			where.add(filter.column+" = ?", filter.value)
+		}
+	}
+	if !f.From.IsZero() {
+		where.add("timestamp >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		where.add("timestamp <= ?", f.To)
+	}
+	if f.Cursor != nil {
+		where.addCursor("timestamp", *f.Cursor)
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	query := `SELECT ` + orderRecordColumns + ` FROM trades ` + where.sql() +
+		` ORDER BY timestamp DESC, order_id DESC LIMIT ` + where.arg(f.Limit+1)
+	return query, where.args
+}
+
+// loadOrder returns an order's full record, with its status refreshed from the
+// exchange first when refresh is set
+func (s *Server) loadOrder(ctx context.Context, orderID string, refresh bool) (*orderRecord, error) {
+	if !refresh {
+		return s.loadOrderRecord(ctx, orderID)
+	}
+	tracked, err := s.refreshOrderStatus(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	record, err := s.loadOrderRecord(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the refresh outcome (source, refresh error) alongside the stored row
+	record.trackedOrder = *tracked
+	return record, nil
+}
+
+// refreshOrderStatus loads an order from the trades table and, unless it is already
+// final, asks its exchange for the current status and writes back any change. An
+// exchange failure is reported on the result rather than as an error, so callers
+// still get the last known status.
+func (s *Server) refreshOrderStatus(ctx context.Context, orderID string) (*trackedOrder, error) {
+	order, err := s.loadStoredOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if terminalOrderStatuses[order.Status] {
+		s.cacheOrderStatus(ctx, order)
+		return order, nil
+	}
+	if order.ExchangeOrderID == "" {
+		order.RefreshError = "No exchange order ID recorded"
+		return order, nil
+	}
+
+	key := exchangeKey(order.Exchange, order.Account)
+	s.mu.RLock()
+	exchange, exists := s.exchanges[key]
+	s.mu.RUnlock()
+	if !exists {
+		order.RefreshError = fmt.Sprintf("Exchange %s not configured", key)
+		return order, nil
+	}
+
+	status, err := fetchOrderStatus(ctx, exchange, order.Symbol, order.ExchangeOrderID)
+	if err != nil {
+		logEvent(ctx, "Failed to refresh order status", "order_id", orderID, "exchange", key, "error", err)
+		order.RefreshError = err.Error()
+		return order, nil
+	}
+
+	previous := *order
+	order.Source = "exchange"
+	order.Status = status.Status
+	order.FilledQty = status.FilledQty
+	order.UpdatedAt = status.UpdatedAt
+	// Not every exchange reports price and fees on status; keep what was recorded
+	if status.AveragePrice > 0 {
+		order.AveragePrice = status.AveragePrice
+	}
+	if status.Fees > 0 {
+		order.Fees = status.Fees
+	}
+
+	if order.Status != previous.Status || order.FilledQty != previous.FilledQty ||
+		order.AveragePrice != previous.AveragePrice || order.Fees != previous.Fees {
+		// The exchange has moved on whether or not the caller is still waiting
+		dbCtx, cancel := s.dbContext(context.WithoutCancel(ctx))
+		_, err := s.recordOrderFill(dbCtx, OrderFill{Mode: fillUpdate, Trade: &TradeRecord{
+			OrderID:          orderID,
+			Status:           order.Status,
+			ExecutedQuantity: order.FilledQty,
+			ExecutedPrice:    order.AveragePrice,
+			Fees:             order.Fees,
+			ExecutedAt:       order.UpdatedAt,
+		}})
+		cancel()
+		if err != nil {
+			logEvent(ctx, "Failed to update order status", "order_id", orderID, "error", err)
+		} else {
+			logEvent(ctx, "Order status updated", "order_id", orderID, "from", previous.Status, "to", order.Status)
+			s.cacheOrderStatus(ctx, order)
+		}
+		s.orderEvents.Publish(OrderEvent{
+			Type:            orderEventType(order.Status),
+			OrderID:         orderID,
+			ExchangeOrderID: order.ExchangeOrderID,
+			StrategyName:    order.StrategyName,
+			Symbol:          order.Symbol,
+			Side:            order.Side,
+			Exchange:        key,
+			Status:          order.Status,
+			FilledQuantity:  order.FilledQty,
+			Price:           order.AveragePrice,
+			Fees:            order.Fees,
+		})
+		if fill := order.FilledQty - previous.FilledQty; fill > 0 {
+			// Price of just this fill, backed out of the change in average price
+			price := (order.FilledQty*order.AveragePrice - previous.FilledQty*previous.AveragePrice) / fill
+			if price <= 0 {
+				price = order.AveragePrice
+			}
+			s.recordFill(Fill{
+				OrderID:      orderID,
+				StrategyName: order.StrategyName,
+				Symbol:       order.Symbol,
+				Side:         order.Side,
+				Exchange:     key,
+				Price:        price,
+				Quantity:     fill,
+				Fees:         order.Fees - previous.Fees,
+			})
+		}
+	}
+	return order, nil
+}
+
+// fetchOrderStatus asks the exchange for an order's status, passing the symbol to
+// exchanges that need it
+func fetchOrderStatus(ctx context.Context, exchange Exchange, symbol, exchangeOrderID string) (*OrderStatus, error) {
+	if lookup, ok := exchange.(symbolOrderStatuser); ok {
+		return lookup.GetSymbolOrderStatus(ctx, symbol, exchangeOrderID)
+	}
+	return exchange.GetOrderStatus(ctx, exchangeOrderID)
+}
+
+func trackedOrderJSON(order *trackedOrder) map[string]interface{} {
+	result := map[string]interface{}{
+		"order_id":          order.OrderID,
+		"exchange_order_id": order.ExchangeOrderID,
+		"exchange":          exchangeKey(order.Exchange, order.Account),
+		"symbol":            order.Symbol,
+		"status":            order.Status,
+		"filled_quantity":   order.FilledQty,
+		"average_price":     order.AveragePrice,
+		"fees":              order.Fees,
+		"updated_at":        order.UpdatedAt,
+		"source":            order.Source,
+	}
+	if order.RefreshError != "" {
+		result["refresh_error"] = order.RefreshError
+	}
+	return result
+}
+
+func orderRecordJSON(record *orderRecord) map[string]interface{} {
+	result := trackedOrderJSON(&record.trackedOrder)
+	result["strategy_name"] = record.StrategyName
+	result["side"] = record.Side
+	result["account"] = record.Account
+	result["account_type"] = record.AccountType
+	result["order_type"] = record.OrderType
+	result["quantity"] = record.Quantity
+	result["price"] = record.Price
+	result["timestamp"] = record.Timestamp
+	result["executed_at"] = record.ExecutedAt
+	result["pnl"] = record.PnL
+	result["slippage"] = record.Slippage
+	result["metadata"] = record.Metadata
+	result["created_at"] = record.CreatedAt
+	return result
+}
+
+// handleGetOrderStatus returns the live status of one order, from the order
+// status cache when it holds the order: GET /api/v1/order_status?order_id=...
+// ?force=true skips the cache.
+func (s *Server) handleGetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderID := r.URL.Query().Get("order_id")
+	if orderID == "" {
+		http.Error(w, "order_id required", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("force") != "true" {
+		if cached := s.cachedOrderStatuses(r.Context(), []string{orderID})[orderID]; cached != nil {
+			writeJSON(w, http.StatusOK, trackedOrderJSON(cached))
+			return
+		}
+	} else if s.orderStatusCacheEnabled() {
+		recordCacheLookup("order_status", "bypass")
+	}
+
+	if !s.dbAvailable() {
+		http.Error(w, "Database not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	order, err := s.refreshOrderStatus(r.Context(), orderID)
+	if errors.Is(err, errOrderNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Order %s not found", orderID),
+		})
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to load order", "order_id", orderID, "error", err)
+		http.Error(w, "Failed to load order", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, trackedOrderJSON(order))
+}
+
+// handleBatchOrderStatus returns the live status of several orders, those in the
+// order status cache from it: POST /api/v1/order_status/batch {"order_ids": [...]}.
+// ?force=true skips the cache.
+func (s *Server) handleBatchOrderStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		OrderIDs []string `json:"order_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.OrderIDs) == 0 {
+		http.Error(w, "order_ids required", http.StatusBadRequest)
+		return
+	}
+	if len(req.OrderIDs) > maxOrderStatusBatch {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("At most %d order_ids per request", maxOrderStatusBatch),
+		})
+		return
+	}
+
+	var cached map[string]*trackedOrder
+	if r.URL.Query().Get("force") != "true" {
+		cached = s.cachedOrderStatuses(r.Context(), req.OrderIDs)
+	} else if s.orderStatusCacheEnabled() {
+		recordCacheLookup("order_status", "bypass")
+	}
+	if len(cached) < len(req.OrderIDs) && !s.dbAvailable() {
+		http.Error(w, "Database not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	orders := make([]map[string]interface{}, 0, len(req.OrderIDs))
+	notFound := make([]string, 0)
+	for _, orderID := range req.OrderIDs {
+		if order := cached[orderID]; order != nil {
+			orders = append(orders, trackedOrderJSON(order))
+			continue
+		}
+		order, err := s.refreshOrderStatus(r.Context(), orderID)
+		if errors.Is(err, errOrderNotFound) {
+			notFound = append(notFound, orderID)
+			continue
+		}
+		if err != nil {
+			logEvent(r.Context(), "Failed to load order", "order_id", orderID, "error", err)
+			http.Error(w, "Failed to load orders", http.StatusInternalServerError)
+			return
+		}
+		orders = append(orders, trackedOrderJSON(order))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"orders":    orders,
+		"not_found": notFound,
+	})
+}
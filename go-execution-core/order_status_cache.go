@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// orderStatusCachePrefix namespaces cached order statuses in Redis, one hash per order ID
+const orderStatusCachePrefix = "order_status:"
+
+// orderStatusCacheOpenTTL bounds how long an open order's entry lives without a
+// write; the reconciler rewrites entries of orders that keep changing
+const orderStatusCacheOpenTTL = time.Hour
+
+// The order status cache holds the status of recent orders so dashboards polling
+// them read Redis instead of Postgres or the exchange. Its rules:
+//
+//   - an entry is written only after the trades write it reflects committed, and
+//     a failed write leaves the entry as it was, matching the unchanged row
+//   - a committed write that does not carry the whole status (cancels, replays,
+//     replacements, expiries, partial updates) deletes the entry instead, and the
+//     next read goes to the database
+//   - reads that miss fill the entry only for final orders, whose row no longer
+//     changes, so a read never puts back a status a concurrent write replaced
+//   - a write never replaces a final entry, nor an open one with less filled
+//     (orderStatusCacheScript), so writes that commit in one order and reach
+//     Redis in the other keep the later state
+//
+// Final entries expire ORDER_STATUS_CACHE_TTL after their last write, open ones
+// after orderStatusCacheOpenTTL. Redis errors are logged and fall back to the
+// database; the cache never fails a request.
+
+// orderStatusCacheScript writes an order's hash unless the stored entry is final,
+// or open with more filled than a non-final write. ARGV: final (1/0), filled
+// quantity, TTL in ms, then field/value pairs.
+var orderStatusCacheScript = redis.NewScript(`
+local state = redis.call('HMGET', KEYS[1], 'final', 'filled_qty')
+if state[1] == '1' then
+	return 0
+end
+if ARGV[1] ~= '1' and state[2] and tonumber(state[2]) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+func (s *Server) orderStatusCacheEnabled() bool {
+	return s.redis != nil && s.config.OrderStatusCacheTTL > 0
+}
+
+// cacheOrderStatus writes order's entry; callers have committed the status it holds
+func (s *Server) cacheOrderStatus(ctx context.Context, order *trackedOrder) {
+	if !s.orderStatusCacheEnabled() {
+		return
+	}
+	final := terminalOrderStatuses[order.Status]
+	ttl := orderStatusCacheOpenTTL
+	finalFlag := "0"
+	if final {
+		ttl, finalFlag = s.config.OrderStatusCacheTTL, "1"
+	}
+	filled := strconv.FormatFloat(order.FilledQty, 'f', -1, 64)
+	err := orderStatusCacheScript.Run(ctx, s.redis, []string{orderStatusCachePrefix + order.OrderID},
+		finalFlag, filled, ttl.Milliseconds(),
+		"final", finalFlag,
+		"exchange_order_id", order.ExchangeOrderID,
+		"exchange", order.Exchange,
+		"account", order.Account,
+		"strategy_name", order.StrategyName,
+		"symbol", order.Symbol,
+		"side", order.Side,
+		"status", order.Status,
+		"filled_qty", filled,
+		"avg_price", strconv.FormatFloat(order.AveragePrice, 'f', -1, 64),
+		"fees", strconv.FormatFloat(order.Fees, 'f', -1, 64),
+		"updated_at", order.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	).Err()
+	if err != nil {
+		logEvent(ctx, "Failed to cache order status", "order_id", order.OrderID, "error", err)
+	}
+}
+
+// forgetOrderStatus deletes entries after a committed write that does not carry
+// the orders' whole status
+func (s *Server) forgetOrderStatus(ctx context.Context, orderIDs ...string) {
+	if !s.orderStatusCacheEnabled() || len(orderIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(orderIDs))
+	for i, orderID := range orderIDs {
+		keys[i] = orderStatusCachePrefix + orderID
+	}
+	if err := s.redis.Del(ctx, keys...).Err(); err != nil {
+		logEvent(ctx, "Failed to invalidate cached order status", "order_ids", orderIDs, "error", err)
+	}
+}
+
+// cachedOrderStatuses returns the cached entries of orderIDs in one round trip,
+// with Source "cache"; orders without an entry are left out
+func (s *Server) cachedOrderStatuses(ctx context.Context, orderIDs []string) map[string]*trackedOrder {
+	if !s.orderStatusCacheEnabled() || len(orderIDs) == 0 {
+		return nil
+	}
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(orderIDs))
+	for i, orderID := range orderIDs {
+		cmds[i] = pipe.HGetAll(ctx, orderStatusCachePrefix+orderID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		recordCacheLookup("order_status", "error")
+		logEvent(ctx, "Order status cache unavailable", "error", err)
+		return nil
+	}
+
+	orders := make(map[string]*trackedOrder, len(orderIDs))
+	for i, orderID := range orderIDs {
+		order, ok := parseCachedOrderStatus(orderID, cmds[i].Val())
+		if !ok {
+			recordCacheLookup("order_status", "miss")
+			continue
+		}
+		recordCacheLookup("order_status", "hit")
+		orders[orderID] = order
+	}
+	return orders
+}
+
+// parseCachedOrderStatus reads an entry's fields; an empty or unreadable entry is a miss
+func parseCachedOrderStatus(orderID string, fields map[string]string) (*trackedOrder, bool) {
+	if fields["status"] == "" {
+		return nil, false
+	}
+	order := &trackedOrder{
+		OrderID:         orderID,
+		ExchangeOrderID: fields["exchange_order_id"],
+		Exchange:        fields["exchange"],
+		Account:         fields["account"],
+		StrategyName:    fields["strategy_name"],
+		Symbol:          fields["symbol"],
+		Side:            fields["side"],
+		Status:          fields["status"],
+		Source:          "cache",
+	}
+	var err error
+	if order.FilledQty, err = strconv.ParseFloat(fields["filled_qty"], 64); err != nil {
+		return nil, false
+	}
+	if order.AveragePrice, err = strconv.ParseFloat(fields["avg_price"], 64); err != nil {
+		return nil, false
+	}
+	if order.Fees, err = strconv.ParseFloat(fields["fees"], 64); err != nil {
+		return nil, false
+	}
+	if order.UpdatedAt, err = time.Parse(time.RFC3339Nano, fields["updated_at"]); err != nil {
+		return nil, false
+	}
+	return order, true
+}
+
+// tradeOrderStatus is the status of a newly inserted trades row
+func tradeOrderStatus(t *TradeRecord) *trackedOrder {
+	return &trackedOrder{
+		OrderID:         t.OrderID,
+		ExchangeOrderID: t.ExchangeOrderID,
+		Exchange:        t.Exchange,
+		Account:         t.Account,
+		StrategyName:    t.StrategyName,
+		Symbol:          t.Symbol,
+		Side:            t.Side,
+		Status:          t.Status,
+		FilledQty:       t.ExecutedQuantity,
+		AveragePrice:    t.ExecutedPrice,
+		Fees:            t.Fees,
+		UpdatedAt:       time.Now(),
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// cacheWriteHook sees every order status cache write before it reaches Redis
+type cacheWriteHook struct {
+	onWrite func(key string)
+}
+
+func (h cacheWriteHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h cacheWriteHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		// EVALSHA/EVAL sha-or-script numkeys key ...
+		if name := cmd.Name(); (name == "evalsha" || name == "eval") && len(cmd.Args()) > 3 {
+			if key, ok := cmd.Args()[3].(string); ok {
+				h.onWrite(key)
+			}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h cacheWriteHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// newCachingServer is a test server with the order status cache on miniredis
+func newCachingServer(t *testing.T) (*Server, *MockExchange, *miniredis.Miniredis) {
+	t.Helper()
+	s, mock := newTestServer(t)
+	mr, client := newTestRedis(t)
+	s.redis = client
+	s.config.OrderStatusCacheTTL = 3 * time.Hour
+	return s, mock, mr
+}
+
+// TestOrderStatusCacheWrittenAfterCommit checks the entry of a new order is
+// written once its trades row is visible to other connections, and is what
+// order status lookups then serve
+func TestOrderStatusCacheWrittenAfterCommit(t *testing.T) {
+	s, _, mr := newCachingServer(t)
+	var writes int
+	s.redis.AddHook(cacheWriteHook{onWrite: func(key string) {
+		writes++
+		var status string
+		if err := s.db.QueryRow(`SELECT status FROM trades WHERE order_id = $1`, "ord-1").Scan(&status); err != nil {
+			t.Errorf("cache write of %s before its trades row committed: %v", key, err)
+		}
+	}})
+	srv := serveTest(t, s)
+
+	if code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", testOrder("ord-1", 0.1)); code != http.StatusOK {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+	s.dbWrites.Wait() // the fill is booked after the response
+	// EVALSHA, then EVAL the first time the script is missing
+	if writes == 0 {
+		t.Fatal("order status not cached")
+	}
+	key := orderStatusCachePrefix + "ord-1"
+	if status := mr.HGet(key, "status"); status != "FILLED" {
+		t.Errorf("cached status %q, want FILLED", status)
+	}
+	if ttl := mr.TTL(key); ttl != s.config.OrderStatusCacheTTL {
+		t.Errorf("final entry TTL %v, want %v", ttl, s.config.OrderStatusCacheTTL)
+	}
+
+	code, body := doJSON(t, srv, http.MethodGet, "/api/v1/order_status?order_id=ord-1", nil)
+	if code != http.StatusOK || body["source"] != "cache" || body["status"] != "FILLED" || body["filled_quantity"] != 0.1 {
+		t.Errorf("lookup: status %d: %v", code, body)
+	}
+	if _, body := doJSON(t, srv, http.MethodGet, "/api/v1/order_status?order_id=ord-1&force=true", nil); body["source"] == "cache" {
+		t.Errorf("force=true served from the cache: %v", body)
+	}
+}
+
+// TestOrderStatusCacheNotWrittenOnRollback checks a fill whose transaction rolls
+// back leaves the cache as it was: no entry for a new order, the previous one for
+// an update
+func TestOrderStatusCacheNotWrittenOnRollback(t *testing.T) {
+	s, _, mr := newCachingServer(t)
+	ctx := context.Background()
+	if _, err := s.db.Exec(`CREATE TRIGGER inject BEFORE INSERT ON positions BEGIN SELECT RAISE(ABORT, 'injected'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.recordOrderFill(ctx, testFill("ord-1")); err == nil {
+		t.Fatal("fill booked despite the injected failure")
+	}
+	if mr.Exists(orderStatusCachePrefix + "ord-1") {
+		t.Errorf("cache entry written for a rolled back fill: %v", mr.Keys())
+	}
+
+	// An open order's entry survives a failed update of its row
+	partial := testFill("ord-2")
+	partial.Trade.Quantity, partial.Trade.ExecutedQuantity, partial.Trade.Status = 2, 0, "NEW"
+	if _, err := s.db.Exec(`DROP TRIGGER inject`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.recordOrderFill(ctx, partial); err != nil {
+		t.Fatal(err)
+	}
+	key := orderStatusCachePrefix + "ord-2"
+	if status := mr.HGet(key, "status"); status != "NEW" {
+		t.Fatalf("cached status %q, want NEW", status)
+	}
+	if _, err := s.db.Exec(`CREATE TRIGGER inject BEFORE INSERT ON positions BEGIN SELECT RAISE(ABORT, 'injected'); END`); err != nil {
+		t.Fatal(err)
+	}
+	partial.Mode, partial.Trade.ExecutedQuantity, partial.Trade.Status = fillUpdate, 2, "FILLED"
+	if _, err := s.recordOrderFill(ctx, partial); err == nil {
+		t.Fatal("update booked despite the injected failure")
+	}
+	if status := mr.HGet(key, "status"); status != "NEW" {
+		t.Errorf("cached status %q after a rolled back update, want NEW", status)
+	}
+
+	// Committed, the update drops the entry so the next read goes to the database
+	if _, err := s.db.Exec(`DROP TRIGGER inject`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.recordOrderFill(ctx, partial); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(key) {
+		t.Errorf("entry kept after a committed update: status %s", mr.HGet(key, "status"))
+	}
+}
+
+// TestOrderStatusCacheKeepsLaterState checks writes that reach Redis out of order
+// never replace a final entry, nor an open one with less filled
+func TestOrderStatusCacheKeepsLaterState(t *testing.T) {
+	s, _, mr := newCachingServer(t)
+	ctx := context.Background()
+	key := orderStatusCachePrefix + "ord-1"
+	order := func(status string, filled float64) *trackedOrder {
+		return &trackedOrder{OrderID: "ord-1", Symbol: "BTCUSDT", Status: status, FilledQty: filled, UpdatedAt: time.Now()}
+	}
+
+	s.cacheOrderStatus(ctx, order("PARTIALLY_FILLED", 0.5))
+	if ttl := mr.TTL(key); ttl != orderStatusCacheOpenTTL {
+		t.Errorf("open entry TTL %v, want %v", ttl, orderStatusCacheOpenTTL)
+	}
+	s.cacheOrderStatus(ctx, order("PARTIALLY_FILLED", 0.2))
+	if filled := mr.HGet(key, "filled_qty"); filled != "0.5" {
+		t.Errorf("filled %s after a stale open write, want 0.5", filled)
+	}
+	s.cacheOrderStatus(ctx, order("FILLED", 1))
+	s.cacheOrderStatus(ctx, order("PARTIALLY_FILLED", 0.8))
+	if status := mr.HGet(key, "status"); status != "FILLED" {
+		t.Errorf("status %s after a stale open write, want FILLED", status)
+	}
+}
+
+// TestOrderStatusCacheRedisDown checks lookups fall back to the database
+func TestOrderStatusCacheRedisDown(t *testing.T) {
+	s, _, mr := newCachingServer(t)
+	srv := serveTest(t, s)
+	if code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", testOrder("ord-1", 0.1)); code != http.StatusOK {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+	s.dbWrites.Wait()
+	mr.Close()
+
+	code, body := doJSON(t, srv, http.MethodGet, "/api/v1/order_status?order_id=ord-1", nil)
+	if code != http.StatusOK || body["source"] != "database" || body["status"] != "FILLED" {
+		t.Errorf("lookup with Redis down: status %d: %v", code, body)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listOrdersPlans are the order history reads and the index each must use
+var listOrdersPlans = []struct {
+	name   string
+	filter orderListFilter
+	index  string
+}{
+	{"unfiltered", orderListFilter{}, "idx_trades_timestamp_order"},
+	{"next page", orderListFilter{Cursor: &pageCursor{Timestamp: time.Now(), OrderID: "ord-1"}}, "idx_trades_timestamp_order"},
+	{"strategy", orderListFilter{StrategyName: "momentum"}, "idx_trades_strategy_timestamp"},
+	{"symbol", orderListFilter{Symbol: "btcusdt"}, "idx_trades_symbol_timestamp"},
+	{"status", orderListFilter{Status: "filled"}, "idx_trades_status_timestamp"},
+	{"exchange", orderListFilter{Exchange: "binance"}, "idx_trades_exchange_timestamp"},
+	{"strategy page in a time range", orderListFilter{
+		StrategyName: "momentum", From: time.Now().Add(-time.Hour), To: time.Now(),
+		Cursor: &pageCursor{Timestamp: time.Now(), OrderID: "ord-1"},
+	}, "idx_trades_strategy_timestamp"},
+}
+
+// explain returns the plan of query, one line per row of the EXPLAIN output
+func explain(t *testing.T, db *sql.DB, prefix, query string, args ...interface{}) string {
+	t.Helper()
+	rows, err := db.Query(prefix+" "+query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatal(err)
+		}
+		// The last column is the step: SQLite's detail, Postgres' QUERY PLAN line
+		switch step := values[len(values)-1].(type) {
+		case string:
+			plan = append(plan, step)
+		case []byte:
+			plan = append(plan, string(step))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(plan, "\n")
+}
+
+func TestListOrdersUsesIndexesSQLite(t *testing.T) {
+	s, _ := newTestServer(t)
+	insertTestTrade(t, s, "ord-1", "momentum", 1, time.Now())
+
+	for _, tt := range listOrdersPlans {
+		tt.filter.Limit = 50
+		query, args := listOrdersQuery(tt.filter)
+		plan := explain(t, s.db, "EXPLAIN QUERY PLAN", query, args...)
+		if !strings.Contains(plan, "USING INDEX "+tt.index) && !strings.Contains(plan, "USING COVERING INDEX "+tt.index) {
+			t.Errorf("%s: plan does not use %s:\n%s", tt.name, tt.index, plan)
+		}
+		if strings.Contains(plan, "TEMP B-TREE") {
+			t.Errorf("%s: plan sorts instead of reading the index in order:\n%s", tt.name, plan)
+		}
+	}
+}
+
+// TestListOrdersUsesIndexesPostgres runs the same check on the migrated schema.
+// An almost empty table is cheapest to scan, so sequential scans are turned off
+// to ask whether an index can serve the query at all.
+func TestListOrdersUsesIndexesPostgres(t *testing.T) {
+	db := postgresTestDB(t)
+	if _, err := runMigrations(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // keep the session setting below
+	if _, err := db.Exec(`SET enable_seqscan = off`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range listOrdersPlans {
+		tt.filter.Limit = 50
+		query, args := listOrdersQuery(tt.filter)
+		plan := explain(t, db, "EXPLAIN", query, args...)
+		if !strings.Contains(plan, "Index Scan using "+tt.index) {
+			t.Errorf("%s: plan does not scan %s:\n%s", tt.name, tt.index, plan)
+		}
+		if strings.Contains(plan, "Sort") {
+			t.Errorf("%s: plan sorts instead of reading the index in order:\n%s", tt.name, plan)
+		}
+	}
+}
+
+// TestListOrdersFilters runs GET /api/v1/orders against trades seeded in each
+// store backend, with each filter alone and combined
+func TestListOrdersFilters(t *testing.T) {
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.db = b.db
+			testListOrdersFilters(t, s)
+		})
+	}
+}
+
+func testListOrdersFilters(t *testing.T, s *Server) {
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, trade := range []struct {
+		strategy, symbol, side, status, exchange string
+	}{
+		{"momentum", "BTCUSDT", "BUY", "FILLED", "binance"},
+		{"momentum", "ETHUSDT", "SELL", "CANCELED", "binance"},
+		{"mean_revert", "BTCUSDT", "SELL", "FILLED", "coinbase"},
+		{"mean_revert", "ETHUSDT", "BUY", "NEW", "binance:alpha"},
+		{"momentum", "BTCUSDT", "SELL", "FILLED", "coinbase"},
+	} {
+		at := base.Add(time.Duration(i) * time.Hour)
+		_, err := s.db.Exec(`
+			INSERT INTO trades (order_id, strategy_name, symbol, side, quantity, price, status, exchange, timestamp)
+			VALUES ($1, $2, $3, $4, 1, 100, $5, $6, $7)`,
+			fmt.Sprintf("ord-%d", i), trade.strategy, trade.symbol, trade.side, trade.status, trade.exchange, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := serveTest(t, s)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string // newest first
+		filters map[string]interface{}
+	}{
+		{"none", "", []string{"ord-4", "ord-3", "ord-2", "ord-1", "ord-0"}, map[string]interface{}{}},
+		{"strategy_name", "strategy_name=mean_revert", []string{"ord-3", "ord-2"},
+			map[string]interface{}{"strategy_name": "mean_revert"}},
+		{"symbol, any case", "symbol=ethusdt", []string{"ord-3", "ord-1"}, map[string]interface{}{"symbol": "ETHUSDT"}},
+		{"side", "side=buy", []string{"ord-3", "ord-0"}, map[string]interface{}{"side": "BUY"}},
+		{"status", "status=filled", []string{"ord-4", "ord-2", "ord-0"}, map[string]interface{}{"status": "FILLED"}},
+		{"exchange", "exchange=coinbase", []string{"ord-4", "ord-2"}, map[string]interface{}{"exchange": "coinbase"}},
+		{"from, inclusive", "from=2024-03-10T15:00:00Z", []string{"ord-4", "ord-3"},
+			map[string]interface{}{"from": "2024-03-10T15:00:00Z"}},
+		{"to, inclusive", "to=2024-03-10T13:00:00Z", []string{"ord-1", "ord-0"},
+			map[string]interface{}{"to": "2024-03-10T13:00:00Z"}},
+		{"combined", "strategy_name=momentum&side=SELL&status=FILLED&from=2024-03-10T13:00:00Z&to=2024-03-10T16:00:00Z",
+			[]string{"ord-4"}, map[string]interface{}{"strategy_name": "momentum", "side": "SELL", "status": "FILLED",
+				"from": "2024-03-10T13:00:00Z", "to": "2024-03-10T16:00:00Z"}},
+		{"no match", "symbol=BTCUSDT&exchange=binance:alpha", nil,
+			map[string]interface{}{"symbol": "BTCUSDT", "exchange": "binance:alpha"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders?"+tt.query, nil)
+			if code != http.StatusOK {
+				t.Fatalf("status %d: %v", code, body)
+			}
+			var got []string
+			orders, _ := body["orders"].([]interface{})
+			for _, order := range orders {
+				got = append(got, order.(map[string]interface{})["order_id"].(string))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("orders %v, want %v", got, tt.want)
+			}
+			if body["count"] != float64(len(tt.want)) {
+				t.Errorf("count %v, want %d", body["count"], len(tt.want))
+			}
+			if filters, _ := body["filters"].(map[string]interface{}); !reflect.DeepEqual(filters, tt.filters) {
+				t.Errorf("filters %v, want %v", filters, tt.filters)
+			}
+		})
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2024-03-10", "from=2024-03-10T12:00:00Z&to=2024-13-01T00:00:00Z"} {
+		if code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders?"+query, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400: %v", query, code, body)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	orderBookStreamDepth       = 20
+	orderBookStreamInterval    = time.Second
+	orderBookStreamMinInterval = 100 * time.Millisecond // the depth stream's own update speed
+)
+
+// liveOrderBookStreamer is implemented by exchanges that maintain local depth books
+type liveOrderBookStreamer interface {
+	liveOrderBook(symbol string) (*localOrderBook, error)
+}
+
+// StreamOrderBook follows a live depth book, sending at most one update per
+// update_interval_ms however often the exchange updates it. Updates are full
+// top-of-book snapshots, or with diffs set one snapshot and then the levels that
+// changed within the requested depth. When the exchange book is resynchronized a
+// diff stream gets a "reset" update and ends with ABORTED, so the client drops its
+// copy and reopens the stream; snapshot streams carry on.
+func (s *Server) StreamOrderBook(req *pb.OrderBookStreamRequest, stream pb.ExecutionService_StreamOrderBookServer) error {
+	symbol := strings.ToUpper(req.Symbol)
+	if symbol == "" {
+		return status.Error(codes.InvalidArgument, "symbol required")
+	}
+	exchangeName := req.Exchange
+	if exchangeName == "" {
+		exchangeName = "binance"
+	}
+	depth := int(req.Depth)
+	if depth == 0 {
+		depth = orderBookStreamDepth
+	}
+	if depth < 1 || depth > depthSnapshotLimit {
+		return status.Errorf(codes.InvalidArgument, "depth must be between 1 and %d", depthSnapshotLimit)
+	}
+	interval := orderBookStreamInterval
+	if req.UpdateIntervalMs != 0 {
+		interval = time.Duration(req.UpdateIntervalMs) * time.Millisecond
+	}
+	if interval < orderBookStreamMinInterval {
+		return status.Errorf(codes.InvalidArgument, "update_interval_ms must be at least %d",
+			orderBookStreamMinInterval.Milliseconds())
+	}
+
+	s.mu.RLock()
+	exchange, exists := s.exchanges[exchangeName]
+	s.mu.RUnlock()
+	if !exists {
+		return status.Errorf(codes.NotFound, "exchange %s not configured", exchangeName)
+	}
+	streamer, ok := exchange.(liveOrderBookStreamer)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "exchange %s does not support live order books", exchangeName)
+	}
+	book, err := streamer.liveOrderBook(symbol)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	gauge := orderBookStreams.WithLabelValues(exchangeName, symbol)
+	gauge.Inc()
+	defer gauge.Dec()
+	ctx := stream.Context()
+	logEvent(ctx, "Order book stream opened", "exchange", exchangeName, "symbol", symbol,
+		"depth", depth, "interval", interval, "diffs", req.Diffs)
+
+	resets := book.resetCount()
+	var sent *OrderBook // the client's copy
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if req.Diffs && book.resetCount() != resets {
+			logEvent(ctx, "Order book resynchronized, ending diff stream", "exchange", exchangeName, "symbol", symbol)
+			if err := stream.Send(&pb.OrderBookUpdate{Symbol: symbol, Exchange: exchangeName, Type: "reset"}); err != nil {
+				return err
+			}
+			return status.Error(codes.Aborted, "order book resynchronized; reopen the stream for a fresh snapshot")
+		}
+
+		// A book being resynchronized is skipped until it has caught up again
+		if book.isSynced() {
+			current := book.snapshot(depth)
+			if update := orderBookUpdateProto(exchangeName, current, sent, req.Diffs); update != nil {
+				if err := stream.Send(update); err != nil {
+					return err
+				}
+			}
+			sent = current
+		}
+
+		select {
+		case <-ctx.Done():
+			logEvent(ctx, "Order book stream closed", "exchange", exchangeName, "symbol", symbol)
+			return nil
+		case <-s.streamCtx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+// orderBookUpdateProto builds the update taking the client from previous (nil
+// before the first update) to current: a snapshot, or with diffs the changed
+// levels. It returns nil when nothing within the depth changed.
+func orderBookUpdateProto(exchange string, current, previous *OrderBook, diffs bool) *pb.OrderBookUpdate {
+	update := &pb.OrderBookUpdate{
+		Symbol:       current.Symbol,
+		Exchange:     exchange,
+		Type:         "snapshot",
+		Bids:         orderBookLevelsProto(current.Bids),
+		Asks:         orderBookLevelsProto(current.Asks),
+		LastUpdateId: current.LastUpdateID,
+		Timestamp:    timestamppb.New(current.Timestamp),
+	}
+	if previous == nil {
+		return update
+	}
+	bids := diffOrderBookLevels(previous.Bids, current.Bids, true)
+	asks := diffOrderBookLevels(previous.Asks, current.Asks, false)
+	if len(bids) == 0 && len(asks) == 0 {
+		return nil
+	}
+	if diffs {
+		update.Type = "diff"
+		update.Bids = orderBookLevelsProto(bids)
+		update.Asks = orderBookLevelsProto(asks)
+	}
+	return update
+}
+
+// diffOrderBookLevels returns the levels of current whose quantity changed, plus
+// quantity 0 for levels that left, best first
+func diffOrderBookLevels(previous, current []OrderBookLevel, descending bool) []OrderBookLevel {
+	before := make(map[float64]float64, len(previous))
+	for _, level := range previous {
+		before[level.Price] = level.Quantity
+	}
+	changed := make([]OrderBookLevel, 0)
+	for _, level := range current {
+		if quantity, ok := before[level.Price]; !ok || quantity != level.Quantity {
+			changed = append(changed, level)
+		}
+		delete(before, level.Price)
+	}
+	for price := range before {
+		changed = append(changed, OrderBookLevel{Price: price})
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		if descending {
+			return changed[i].Price > changed[j].Price
+		}
+		return changed[i].Price < changed[j].Price
+	})
+	return changed
+}
+
+func orderBookLevelsProto(levels []OrderBookLevel) []*pb.OrderBookLevel {
+	out := make([]*pb.OrderBookLevel, 0, len(levels))
+	for _, level := range levels {
+		out = append(out, &pb.OrderBookLevel{Price: level.Price, Quantity: level.Quantity})
+	}
+	return out
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The order book recorder samples the top levels of the live books of
+// ORDERBOOK_RECORD_SYMBOLS every ORDERBOOK_RECORD_INTERVAL into book_snapshots for
+// research. Its footprint is bounded: at most orderBookRecordMaxSymbols symbols,
+// orderBookRecordMaxDepth levels a side, one sample per symbol per second, no
+// sample while a book has not changed, and rows beyond the retention or the row
+// cap are pruned every orderBookPruneInterval.
+
+const (
+	orderBookRecordMaxSymbols  = 50
+	orderBookRecordMaxDepth    = 100
+	orderBookRecordMinInterval = time.Second
+	orderBookPruneInterval     = 10 * time.Minute
+	orderBookHistoryMaxRange   = 7 * 24 * time.Hour
+)
+
+var orderBookSnapshots = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_orderbook_snapshots_total",
+	Help: "Order book samples taken by the recorder, by result (recorded, unchanged, unavailable, failed).",
+}, []string{"result"})
+
+// liveOrderBookProvider is implemented by exchanges that maintain books from depth streams
+type liveOrderBookProvider interface {
+	GetLiveOrderBook(symbol string) (*OrderBook, error)
+}
+
+// bookSnapshot is one recorded row of book_snapshots
+type bookSnapshot struct {
+	Timestamp    time.Time
+	LastUpdateID int64
+	Bids, Asks   [][2]float64
+	Mid, Spread  *float64 // nil while a side is empty
+}
+
+func newBookSnapshot(book *OrderBook, depth int, ts time.Time) bookSnapshot {
+	snap := bookSnapshot{
+		Timestamp:    ts,
+		LastUpdateID: book.LastUpdateID,
+		Bids:         orderBookLevelsJSON(book.Bids, depth),
+		Asks:         orderBookLevelsJSON(book.Asks, depth),
+	}
+	if len(book.Bids) > 0 && len(book.Asks) > 0 {
+		bid, ask := book.Bids[0].Price, book.Asks[0].Price
+		mid, spread := (bid+ask)/2, ask-bid
+		snap.Mid, snap.Spread = &mid, &spread
+	}
+	return snap
+}
+
+// runOrderBookRecorder samples the configured books until the server shuts down
+func (s *Server) runOrderBookRecorder() {
+	cfg := s.config
+	if s.db == nil || len(cfg.OrderBookRecordSymbols) == 0 {
+		return
+	}
+	s.mu.RLock()
+	exchange, exists := s.exchanges[cfg.OrderBookRecordExchange]
+	s.mu.RUnlock()
+	provider, ok := exchange.(liveOrderBookProvider)
+	if !exists || !ok {
+		log.Printf("Warning: order book recorder disabled: exchange %s has no live order books", cfg.OrderBookRecordExchange)
+		return
+	}
+
+	symbols := make([]string, 0, len(cfg.OrderBookRecordSymbols))
+	for _, symbol := range cfg.OrderBookRecordSymbols {
+		symbols = append(symbols, strings.ToUpper(symbol))
+	}
+	if len(symbols) > orderBookRecordMaxSymbols {
+		log.Printf("Warning: order book recorder limited to the first %d of %d symbols", orderBookRecordMaxSymbols, len(symbols))
+		symbols = symbols[:orderBookRecordMaxSymbols]
+	}
+	interval := cfg.OrderBookRecordInterval
+	if interval < orderBookRecordMinInterval {
+		interval = orderBookRecordMinInterval
+	}
+	depth := cfg.OrderBookRecordDepth
+	if depth < 1 || depth > orderBookRecordMaxDepth {
+		depth = orderBookRecordMaxDepth
+	}
+	log.Printf("✓ Order book recorder: %s every %s, %d levels, kept %s (at most %d rows)",
+		strings.Join(symbols, ","), interval, depth, cfg.OrderBookRecordRetention, cfg.OrderBookRecordMaxRows)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastUpdate := make(map[string]int64, len(symbols))
+	nextPrune := time.Now()
+	for {
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		// A slow write delays the next sample instead of queueing samples behind it
+		s.recordOrderBooks(provider, symbols, depth, lastUpdate)
+		if time.Now().After(nextPrune) {
+			s.pruneOrderBookSnapshots()
+			nextPrune = time.Now().Add(orderBookPruneInterval)
+		}
+	}
+}
+
+// recordOrderBooks writes one sample of every symbol whose book changed since its last sample
+func (s *Server) recordOrderBooks(provider liveOrderBookProvider, symbols []string, depth int, lastUpdate map[string]int64) {
+	now := time.Now()
+	var values []string
+	var args []interface{}
+	var recorded []string
+	for _, symbol := range symbols {
+		book, err := provider.GetLiveOrderBook(symbol)
+		if err != nil {
+			orderBookSnapshots.WithLabelValues("unavailable").Inc()
+			continue
+		}
+		if book.LastUpdateID == lastUpdate[symbol] {
+			orderBookSnapshots.WithLabelValues("unchanged").Inc()
+			continue
+		}
+		snap := newBookSnapshot(book, depth, now)
+		bids, _ := json.Marshal(snap.Bids)
+		asks, _ := json.Marshal(snap.Asks)
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+		args = append(args, s.config.OrderBookRecordExchange, symbol, snap.Timestamp, snap.LastUpdateID,
+			string(bids), string(asks), snap.Mid, snap.Spread)
+		recorded = append(recorded, symbol)
+		lastUpdate[symbol] = book.LastUpdateID
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	ctx, cancel := s.dbContext(s.streamCtx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO book_snapshots (exchange, symbol, ts, last_update_id, bids, asks, mid, spread)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT DO NOTHING
+	`, args...)
+	if err != nil {
+		orderBookSnapshots.WithLabelValues("failed").Add(float64(len(recorded)))
+		log.Printf("Failed to record order book snapshots: %v", err)
+		for _, symbol := range recorded {
+			delete(lastUpdate, symbol) // retry them on the next tick
+		}
+		return
+	}
+	orderBookSnapshots.WithLabelValues("recorded").Add(float64(len(recorded)))
+}
+
+// pruneOrderBookSnapshots deletes rows older than the retention, then the oldest
+// rows beyond the row cap
+func (s *Server) pruneOrderBookSnapshots() {
+	ctx, cancel := s.dbContext(s.streamCtx)
+	defer cancel()
+	if retention := s.config.OrderBookRecordRetention; retention > 0 {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM book_snapshots WHERE ts < $1`, time.Now().Add(-retention)); err != nil {
+			log.Printf("Failed to prune order book snapshots: %v", err)
+			return
+		}
+	}
+	if maxRows := s.config.OrderBookRecordMaxRows; maxRows > 0 {
+		_, err := s.db.ExecContext(ctx, `
+			DELETE FROM book_snapshots
+			WHERE ts < (SELECT ts FROM book_snapshots ORDER BY ts DESC OFFSET $1 LIMIT 1)
+		`, maxRows)
+		if err != nil {
+			log.Printf("Failed to cap order book snapshots: %v", err)
+		}
+	}
+}
+
+// handleOrderBookHistory returns recorded snapshots of a symbol, oldest first:
+// GET /api/v1/orderbook/{symbol}/history?from=&to=&exchange=&limit=&cursor=
+func (s *Server) handleOrderBookHistory(w http.ResponseWriter, r *http.Request, symbol string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	symbol = strings.ToUpper(symbol)
+	exchange := query.Get("exchange")
+	if exchange == "" {
+		exchange = s.config.OrderBookRecordExchange
+	}
+	limit, err := parsePageSize(query.Get("limit"), 100)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Snapshots are large, so a request covers a bounded window; to defaults to
+	// now and from to one hour before to
+	to := time.Now()
+	from := time.Time{}
+	for param, field := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param),
+			})
+			return
+		}
+		*field = t
+	}
+	if from.IsZero() {
+		from = to.Add(-time.Hour)
+	}
+	if !from.Before(to) || to.Sub(from) > orderBookHistoryMaxRange {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("from must be before to and at most %s earlier", orderBookHistoryMaxRange),
+		})
+		return
+	}
+
+	where := whereBuilder{}
+	where.add("exchange = ?", exchange)
+	where.add("symbol = ?", symbol)
+	where.add("ts >= ?", from)
+	where.add("ts <= ?", to)
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		where.add("ts > ?", cursor.Timestamp)
+	}
+
+	snapshots, err := s.queryBookSnapshots(r.Context(), where, limit+1)
+	if err != nil {
+		logEvent(r.Context(), "Failed to read order book history", "symbol", symbol, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch order book history",
+		})
+		return
+	}
+
+	response := map[string]interface{}{
+		"exchange": exchange,
+		"symbol":   symbol,
+		"from":     from.Format(time.RFC3339),
+		"to":       to.Format(time.RFC3339),
+	}
+	if len(snapshots) > limit {
+		snapshots = snapshots[:limit]
+		response["next_cursor"] = encodeCursor(snapshots[limit-1].Timestamp, symbol)
+	}
+	out := make([]map[string]interface{}, 0, len(snapshots))
+	for _, snap := range snapshots {
+		out = append(out, map[string]interface{}{
+			"timestamp":      snap.Timestamp.Format(time.RFC3339Nano),
+			"last_update_id": snap.LastUpdateID,
+			"bids":           snap.Bids,
+			"asks":           snap.Asks,
+			"mid":            snap.Mid,
+			"spread":         snap.Spread,
+		})
+	}
+	response["snapshots"] = out
+	response["count"] = len(out)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// queryBookSnapshots reads up to limit snapshots matching where, oldest first
+func (s *Server) queryBookSnapshots(ctx context.Context, where whereBuilder, limit int) ([]bookSnapshot, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	query := `SELECT ts, last_update_id, bids, asks, mid, spread FROM book_snapshots ` + where.sql() +
+		` ORDER BY ts LIMIT ` + where.arg(limit)
+	rows, err := s.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []bookSnapshot
+	for rows.Next() {
+		var snap bookSnapshot
+		var bids, asks []byte
+		if err := rows.Scan(&snap.Timestamp, &snap.LastUpdateID, &bids, &asks, &snap.Mid, &snap.Spread); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bids, &snap.Bids); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(asks, &snap.Asks); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Local order book maintenance from Binance @depth diff streams.
+// Follows the documented sequencing rules:
+//  1. Open the stream and buffer events
+//  2. Take a REST snapshot via /api/v3/depth
+//  3. Drop buffered events with u <= lastUpdateId
+//  4. The first applied event must satisfy U <= lastUpdateId+1 <= u
+//  5. Every following event must have U == previous u + 1, otherwise resnapshot
+
+var errDepthGap = errors.New("depth stream sequence gap")
+
+const (
+	depthSnapshotLimit = 1000
+	depthEventBuffer   = 1000
+	depthSyncTimeout   = 5 * time.Second
+)
+
+// depthEvent is a single diff message from the <symbol>@depth stream
+type depthEvent struct {
+	EventType     string     `json:"e"`
+	EventTime     int64      `json:"E"`
+	Symbol        string     `json:"s"`
+	FirstUpdateID int64      `json:"U"`
+	FinalUpdateID int64      `json:"u"`
+	Bids          [][]string `json:"b"`
+	Asks          [][]string `json:"a"`
+}
+
+// localOrderBook is an in-memory order book kept in sync with diff events
+type localOrderBook struct {
+	symbol       string
+	bids         map[float64]float64
+	asks         map[float64]float64
+	lastUpdateID int64
+	synced       bool // true once the first post-snapshot event has been applied
+	resets       int  // snapshots loaded; grows when the book is resynchronized
+	updatedAt    time.Time
+	mu           sync.RWMutex
+}
+
+func newLocalOrderBook(symbol string) *localOrderBook {
+	return &localOrderBook{
+		symbol: symbol,
+		bids:   make(map[float64]float64),
+		asks:   make(map[float64]float64),
+	}
+}
+
+// reset replaces the book contents with a REST snapshot
+func (b *localOrderBook) reset(snapshot *OrderBook) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = make(map[float64]float64, len(snapshot.Bids))
+	b.asks = make(map[float64]float64, len(snapshot.Asks))
+	for _, level := range snapshot.Bids {
+		b.bids[level.Price] = level.Quantity
+	}
+	for _, level := range snapshot.Asks {
+		b.asks[level.Price] = level.Quantity
+	}
+	b.lastUpdateID = snapshot.LastUpdateID
+	b.synced = false
+	b.resets++
+	b.updatedAt = snapshot.Timestamp
+}
+
+// apply applies a diff event according to the sequencing rules.
+// Stale events are ignored; errDepthGap means the book must be resnapshotted.
+func (b *localOrderBook) apply(ev *depthEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Event fully covered by the snapshot (or already applied)
+	if ev.FinalUpdateID <= b.lastUpdateID {
+		return nil
+	}
+
+	if !b.synced {
+		if ev.FirstUpdateID > b.lastUpdateID+1 {
+			return errDepthGap
+		}
+	} else if ev.FirstUpdateID != b.lastUpdateID+1 {
+		return errDepthGap
+	}
+
+	if err := applyDepthLevels(b.bids, ev.Bids); err != nil {
+		return err
+	}
+	if err := applyDepthLevels(b.asks, ev.Asks); err != nil {
+		return err
+	}
+
+	b.lastUpdateID = ev.FinalUpdateID
+	b.synced = true
+	b.updatedAt = time.UnixMilli(ev.EventTime)
+	return nil
+}
+
+// applyDepthLevels updates one side of the book; quantities are absolute and 0 removes the level
+func applyDepthLevels(side map[float64]float64, levels [][]string) error {
+	for _, level := range levels {
+		if len(level) < 2 {
+			continue
+		}
+		price, err := strconv.ParseFloat(level[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid depth price '%s': %w", level[0], err)
+		}
+		quantity, err := strconv.ParseFloat(level[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid depth quantity '%s': %w", level[1], err)
+		}
+
+		if quantity == 0 {
+			delete(side, price)
+		} else {
+			side[price] = quantity
+		}
+	}
+	return nil
+}
+
+// isSynced reports whether the book has a snapshot plus at least one applied diff
+func (b *localOrderBook) isSynced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.synced
+}
+
+// resetCount tells streams of the book's diffs when it was resynchronized
+func (b *localOrderBook) resetCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.resets
+}
+
+// snapshot returns the top depth levels per side (0 = all levels)
+func (b *localOrderBook) snapshot(depth int) *OrderBook {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	bids := make([]OrderBookLevel, 0, len(b.bids))
+	for price, quantity := range b.bids {
+		bids = append(bids, OrderBookLevel{Price: price, Quantity: quantity})
+	}
+	sort.Slice(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
+
+	asks := make([]OrderBookLevel, 0, len(b.asks))
+	for price, quantity := range b.asks {
+		asks = append(asks, OrderBookLevel{Price: price, Quantity: quantity})
+	}
+	sort.Slice(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+
+	if depth > 0 {
+		if len(bids) > depth {
+			bids = bids[:depth]
+		}
+		if len(asks) > depth {
+			asks = asks[:depth]
+		}
+	}
+
+	return &OrderBook{
+		Symbol:       b.symbol,
+		Bids:         bids,
+		Asks:         asks,
+		LastUpdateID: b.lastUpdateID,
+		Timestamp:    b.updatedAt,
+	}
+}
+
+// DepthStreamManager maintains live order books for subscribed symbols
+type DepthStreamManager struct {
+	exchange *BinanceExchange
+	wsURL    string
+	books    map[string]*localOrderBook
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+}
+
+func NewDepthStreamManager(exchange *BinanceExchange, wsURL string) *DepthStreamManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DepthStreamManager{
+		exchange: exchange,
+		wsURL:    wsURL,
+		books:    make(map[string]*localOrderBook),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Book returns the live book for a symbol, starting a stream on first use
+// and waiting briefly for the initial sync
+func (m *DepthStreamManager) Book(symbol string) (*localOrderBook, error) {
+	symbol = strings.ToUpper(symbol)
+
+	m.mu.Lock()
+	book, exists := m.books[symbol]
+	if !exists {
+		book = newLocalOrderBook(symbol)
+		m.books[symbol] = book
+		go m.run(symbol, book)
+		log.Printf("✓ Depth stream started for %s", symbol)
+	}
+	m.mu.Unlock()
+
+	deadline := time.Now().Add(depthSyncTimeout)
+	for !book.isSynced() {
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("order book for %s not yet synchronized", symbol)
+		}
+		select {
+		case <-m.ctx.Done():
+			return nil, m.ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return book, nil
+}
+
+// Close stops all depth streams
+func (m *DepthStreamManager) Close() {
+	m.cancel()
+}
+
+// run keeps the stream for one symbol connected, reconnecting with backoff
+func (m *DepthStreamManager) run(symbol string, book *localOrderBook) {
+	backoff := time.Second
+	for {
+		err := m.stream(symbol, book)
+		if m.ctx.Err() != nil {
+			return
+		}
+		log.Printf("Depth stream for %s interrupted: %v (reconnecting in %s)", symbol, err, backoff)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// stream runs one websocket session: buffer events, snapshot, then apply diffs
+func (m *DepthStreamManager) stream(symbol string, book *localOrderBook) error {
+	streamURL := fmt.Sprintf("%s/ws/%s@depth@100ms", m.wsURL, strings.ToLower(symbol))
+
+	conn, _, err := websocket.DefaultDialer.DialContext(m.ctx, streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect depth stream: %w", err)
+	}
+	defer conn.Close()
+
+	// Close the connection when the manager shuts down so ReadJSON unblocks
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	events := make(chan *depthEvent, depthEventBuffer)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(events)
+		for {
+			var ev depthEvent
+			if err := conn.ReadJSON(&ev); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case events <- &ev:
+			default:
+				readErr <- fmt.Errorf("depth event buffer overflow")
+				return
+			}
+		}
+	}()
+
+	if err := m.resnapshot(symbol, book); err != nil {
+		return err
+	}
+
+	for ev := range events {
+		err := book.apply(ev)
+		if errors.Is(err, errDepthGap) {
+			log.Printf("Depth gap detected for %s, resnapshotting", symbol)
+			if err := m.resnapshot(symbol, book); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return <-readErr
+}
+
+func (m *DepthStreamManager) resnapshot(symbol string, book *localOrderBook) error {
+	snapshot, err := m.exchange.GetOrderBook(symbol, depthSnapshotLimit)
+	if err != nil {
+		return fmt.Errorf("failed to fetch depth snapshot: %w", err)
+	}
+	book.reset(snapshot)
+	return nil
+}
+
+// GetLiveOrderBook returns the locally maintained order book for a symbol
+func (b *BinanceExchange) GetLiveOrderBook(symbol string) (*OrderBook, error) {
+	book, err := b.depthStreams.Book(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return book.snapshot(0), nil
+}
+
+// liveOrderBook returns the maintained book itself, for streams that follow it
+func (b *BinanceExchange) liveOrderBook(symbol string) (*localOrderBook, error) {
+	return b.depthStreams.Book(symbol)
+}
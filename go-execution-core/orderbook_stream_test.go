@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The fixtures are a recorded BTCUSDT session: a /api/v3/depth snapshot, the
+// @depth diffs that followed it (the first one already covered by the snapshot)
+// and the book Binance returned once the last diff was applied.
+const (
+	depthSnapshotFixture  = "testdata/binance_depth_btcusdt_snapshot.json"
+	depthDiffsFixture     = "testdata/binance_depth_btcusdt.jsonl"
+	depthReferenceFixture = "testdata/binance_depth_btcusdt_reference.json"
+)
+
+// loadDepthBook reads a depth snapshot in the /api/v3/depth format
+func loadDepthBook(t *testing.T, path string) *OrderBook {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		LastUpdateID int64      `json:"lastUpdateId"`
+		Bids         [][]string `json:"bids"`
+		Asks         [][]string `json:"asks"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	levels := func(raw [][]string) []OrderBookLevel {
+		out := make([]OrderBookLevel, 0, len(raw))
+		for _, level := range raw {
+			price, _ := strconv.ParseFloat(level[0], 64)
+			quantity, _ := strconv.ParseFloat(level[1], 64)
+			out = append(out, OrderBookLevel{Price: price, Quantity: quantity})
+		}
+		return out
+	}
+	return &OrderBook{Symbol: "BTCUSDT", LastUpdateID: resp.LastUpdateID, Bids: levels(resp.Bids), Asks: levels(resp.Asks)}
+}
+
+// loadDepthDiffs reads recorded diff events, one JSON message per line
+func loadDepthDiffs(t *testing.T, path string) []*depthEvent {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []*depthEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var ev depthEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		events = append(events, &ev)
+	}
+	return events
+}
+
+func assertSameLevels(t *testing.T, got, want *OrderBook) {
+	t.Helper()
+	if got.LastUpdateID != want.LastUpdateID {
+		t.Errorf("lastUpdateId = %d, want %d", got.LastUpdateID, want.LastUpdateID)
+	}
+	if !reflect.DeepEqual(got.Bids, want.Bids) {
+		t.Errorf("bids = %v, want %v", got.Bids, want.Bids)
+	}
+	if !reflect.DeepEqual(got.Asks, want.Asks) {
+		t.Errorf("asks = %v, want %v", got.Asks, want.Asks)
+	}
+}
+
+func TestLocalOrderBookReplayMatchesReference(t *testing.T) {
+	book := newLocalOrderBook("BTCUSDT")
+	book.reset(loadDepthBook(t, depthSnapshotFixture))
+	for _, ev := range loadDepthDiffs(t, depthDiffsFixture) {
+		if err := book.apply(ev); err != nil {
+			t.Fatalf("apply U=%d u=%d: %v", ev.FirstUpdateID, ev.FinalUpdateID, err)
+		}
+	}
+	if !book.isSynced() {
+		t.Fatal("book not synced after replay")
+	}
+	assertSameLevels(t, book.snapshot(0), loadDepthBook(t, depthReferenceFixture))
+
+	top := book.snapshot(2)
+	if len(top.Bids) != 2 || len(top.Asks) != 2 || top.Bids[0].Price != 30000.25 || top.Asks[0].Price != 30000.75 {
+		t.Errorf("snapshot(2) = %+v", top)
+	}
+}
+
+func TestLocalOrderBookSequencing(t *testing.T) {
+	diff := func(first, final int64) *depthEvent {
+		return &depthEvent{FirstUpdateID: first, FinalUpdateID: final, Bids: [][]string{{"100", strconv.FormatInt(final, 10)}}}
+	}
+	tests := []struct {
+		name    string
+		events  []*depthEvent
+		wantErr error
+		wantID  int64 // lastUpdateId once the events are applied
+		synced  bool
+	}{
+		{name: "stale events are dropped", events: []*depthEvent{diff(90, 95), diff(96, 100)}, wantID: 100},
+		{name: "first event may straddle the snapshot", events: []*depthEvent{diff(99, 102)}, wantID: 102, synced: true},
+		{name: "first event starting right after the snapshot", events: []*depthEvent{diff(101, 101)}, wantID: 101, synced: true},
+		{name: "first event past the snapshot is a gap", events: []*depthEvent{diff(102, 104)}, wantErr: errDepthGap, wantID: 100},
+		{name: "consecutive events apply", events: []*depthEvent{diff(99, 102), diff(103, 105), diff(106, 106)}, wantID: 106, synced: true},
+		{name: "missing update id is a gap", events: []*depthEvent{diff(99, 102), diff(104, 105)}, wantErr: errDepthGap, wantID: 102, synced: true},
+		{name: "overlapping event after sync is a gap", events: []*depthEvent{diff(99, 102), diff(102, 103)}, wantErr: errDepthGap, wantID: 102, synced: true},
+		{name: "replayed event after sync is dropped", events: []*depthEvent{diff(99, 102), diff(99, 102)}, wantID: 102, synced: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := newLocalOrderBook("BTCUSDT")
+			book.reset(&OrderBook{LastUpdateID: 100})
+			var err error
+			for _, ev := range tt.events {
+				if err = book.apply(ev); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := book.snapshot(0).LastUpdateID; got != tt.wantID {
+				t.Errorf("lastUpdateId = %d, want %d", got, tt.wantID)
+			}
+			if book.isSynced() != tt.synced {
+				t.Errorf("synced = %t, want %t", book.isSynced(), tt.synced)
+			}
+		})
+	}
+}
+
+func TestLocalOrderBookRejectsMalformedLevels(t *testing.T) {
+	book := newLocalOrderBook("BTCUSDT")
+	book.reset(&OrderBook{LastUpdateID: 1})
+	err := book.apply(&depthEvent{FirstUpdateID: 2, FinalUpdateID: 2, Bids: [][]string{{"abc", "1"}}})
+	if err == nil || errors.Is(err, errDepthGap) {
+		t.Fatalf("err = %v, want a parse error", err)
+	}
+}
+
+// TestDepthStreamManagerResyncsAfterGap streams the recorded diffs, then a diff
+// that skips update IDs, and checks the manager takes a new snapshot and keeps
+// applying diffs on top of it
+func TestDepthStreamManagerResyncsAfterGap(t *testing.T) {
+	first, err := os.ReadFile(depthSnapshotFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := `{"lastUpdateId":125,"bids":[["30010.00","2.00"]],"asks":[["30011.00","1.00"]]}`
+	diffs := loadDepthDiffs(t, depthDiffsFixture)
+	diffs = append(diffs,
+		&depthEvent{EventType: "depthUpdate", EventTime: 1700000000500, Symbol: "BTCUSDT", FirstUpdateID: 120, FinalUpdateID: 125,
+			Bids: [][]string{{"1.00", "1.00"}}},
+		&depthEvent{EventType: "depthUpdate", EventTime: 1700000000600, Symbol: "BTCUSDT", FirstUpdateID: 126, FinalUpdateID: 127,
+			Bids: [][]string{{"30010.00", "0.00"}, {"30009.50", "4.00"}}, Asks: [][]string{{"30011.50", "0.50"}}},
+	)
+
+	var snapshots atomic.Int32
+	upgrader := websocket.Upgrader{}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v3/depth":
+			if r.URL.Query().Get("symbol") != "BTCUSDT" {
+				http.Error(w, "bad symbol", http.StatusBadRequest)
+				return
+			}
+			if snapshots.Add(1) == 1 {
+				w.Write(first)
+			} else {
+				w.Write([]byte(second))
+			}
+		case r.URL.Path == "/ws/btcusdt@depth@100ms":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for _, ev := range diffs {
+				if err := conn.WriteJSON(ev); err != nil {
+					return
+				}
+			}
+			<-done
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	exchange := &BinanceExchange{baseURL: srv.URL, client: srv.Client(), rateLimiter: NewRateLimiter(1000)}
+	manager := NewDepthStreamManager(exchange, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	defer manager.Close()
+
+	book, err := manager.Book("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for book.snapshot(0).LastUpdateID != 127 {
+		if time.Now().After(deadline) {
+			t.Fatalf("book stuck at lastUpdateId %d", book.snapshot(0).LastUpdateID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := snapshots.Load(); got != 2 {
+		t.Errorf("snapshots fetched = %d, want 2 (initial and after the gap)", got)
+	}
+	if got := book.resetCount(); got != 2 {
+		t.Errorf("resets = %d, want 2", got)
+	}
+	assertSameLevels(t, book.snapshot(0), &OrderBook{
+		LastUpdateID: 127,
+		Bids:         []OrderBookLevel{{Price: 30009.50, Quantity: 4}},
+		Asks:         []OrderBookLevel{{Price: 30011, Quantity: 1}, {Price: 30011.50, Quantity: 0.5}},
+	})
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PaperExchange simulates fills against live prices from another exchange.
+// Balances are virtual and reset on restart; orders flow through the same
+// REST/gRPC/DB paths as live trading.
+type PaperExchange struct {
+	pricer      Exchange // source of market data, usually public Binance tickers
+	feeRate     float64  // charged on notional, in the quote asset
+	slippage    float64  // fraction of price applied against the taker
+	free        map[string]float64
+	locked      map[string]float64
+	orders      map[string]*paperOrder
+	nextOrderID int64
+	mu          sync.Mutex
+}
+
+// paperOrder is a simulated order; resting limits are re-checked on status queries
+type paperOrder struct {
+	order     Order
+	id        string
+	base      string
+	quote     string
+	lockAsset string // funds reserved until filled or cancelled
+	lockQty   float64
+	status    string
+	filledQty float64
+	avgPrice  float64
+	fees      float64
+	updatedAt time.Time
+}
+
+func NewPaperExchange(pricer Exchange, balances map[string]float64, feeRate, slippage float64) *PaperExchange {
+	free := make(map[string]float64, len(balances))
+	for asset, amount := range balances {
+		free[strings.ToUpper(asset)] = amount
+	}
+
+	return &PaperExchange{
+		pricer:   pricer,
+		feeRate:  feeRate,
+		slippage: slippage,
+		free:     free,
+		locked:   make(map[string]float64),
+		orders:   make(map[string]*paperOrder),
+		// Start from a Binance-sized numeric ID so logs and clients look the same as live
+		nextOrderID: 1_000_000_000 + time.Now().Unix()%1_000_000_000,
+	}
+}
+
+// parsePaperBalances parses "USDT=100000,BTC=1" into a balance map
+func parsePaperBalances(spec string) (map[string]float64, error) {
+	balances := make(map[string]float64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid paper balance %q, expected ASSET=AMOUNT", entry)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("invalid paper balance amount %q", parts[1])
+		}
+		balances[strings.ToUpper(strings.TrimSpace(parts[0]))] = amount
+	}
+	return balances, nil
+}
+
+// paperQuoteAssets are checked longest-first when splitting symbols into base/quote
+var paperQuoteAssets = []string{"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "USD", "EUR", "BTC", "ETH", "BNB"}
+
+func splitPaperSymbol(symbol string) (base, quote string, err error) {
+	parts := strings.SplitN(dashSymbol(symbol, paperQuoteAssets), "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("unsupported symbol %s", symbol)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (p *PaperExchange) GetMarketData(ctx context.Context, symbol string) (*MarketData, error) {
+	return p.pricer.GetMarketData(ctx, symbol)
+}
+
+// SubmitOrder fills market and marketable limit orders immediately at the touch
+// plus slippage; other limit orders rest with their funds locked.
+func (p *PaperExchange) SubmitOrder(ctx context.Context, order *Order) (*OrderResult, error) {
+	if order.Quantity <= 0 {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, fmt.Errorf("quantity must be positive")
+	}
+	if order.Side != "BUY" && order.Side != "SELL" {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, fmt.Errorf("invalid side %s", order.Side)
+	}
+	if order.OrderType == "LIMIT" && order.Price <= 0 {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, fmt.Errorf("limit orders require a price")
+	}
+
+	base, quote, err := splitPaperSymbol(order.Symbol)
+	if err != nil {
+		return &OrderResult{OrderID: order.ID, Status: "REJECTED"}, err
+	}
+
+	data, err := p.pricer.GetMarketData(ctx, order.Symbol)
+	if err != nil {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "FAILED",
+		}, fmt.Errorf("paper order failed to price: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextOrderID++
+	po := &paperOrder{
+		order:     *order,
+		id:        strconv.FormatInt(p.nextOrderID, 10),
+		base:      base,
+		quote:     quote,
+		status:    "NEW",
+		updatedAt: time.Now(),
+	}
+
+	// Lock the funds the order could consume
+	lockAsset, lockAmount := p.requiredFunds(po, data)
+	if p.free[lockAsset] < lockAmount {
+		return &OrderResult{
+			OrderID: order.ID,
+			Status:  "REJECTED",
+		}, fmt.Errorf("insufficient %s balance: have %.8f, need %.8f", lockAsset, p.free[lockAsset], lockAmount)
+	}
+	p.free[lockAsset] -= lockAmount
+	p.locked[lockAsset] += lockAmount
+	po.lockAsset, po.lockQty = lockAsset, lockAmount
+
+	p.orders[po.id] = po
+	p.tryFill(po, data)
+
+	return &OrderResult{
+		OrderID:          order.ID,
+		ExchangeOrderID:  po.id,
+		Status:           po.status,
+		ExecutedPrice:    po.avgPrice,
+		ExecutedQuantity: po.filledQty,
+		Fees:             po.fees,
+		Timestamp:        po.updatedAt,
+	}, nil
+}
+
+// requiredFunds returns the asset and amount an order reserves until filled or cancelled
+func (p *PaperExchange) requiredFunds(po *paperOrder, data *MarketData) (string, float64) {
+	if po.order.Side == "SELL" {
+		return po.base, po.order.Quantity
+	}
+	price := po.order.Price
+	if po.order.OrderType != "LIMIT" {
+		price = p.fillPrice("BUY", data)
+	}
+	return po.quote, po.order.Quantity * price * (1 + p.feeRate)
+}
+
+// fillPrice is the touch price on the taker side, worsened by the configured slippage
+func (p *PaperExchange) fillPrice(side string, data *MarketData) float64 {
+	if side == "BUY" {
+		ask := data.Ask
+		if ask <= 0 {
+			ask = data.Price
+		}
+		return ask * (1 + p.slippage)
+	}
+	bid := data.Bid
+	if bid <= 0 {
+		bid = data.Price
+	}
+	return bid * (1 - p.slippage)
+}
+
+// tryFill fills the whole order if it is marketable at the given prices. Caller holds p.mu.
+func (p *PaperExchange) tryFill(po *paperOrder, data *MarketData) {
+	if po.status != "NEW" {
+		return
+	}
+
+	price := p.fillPrice(po.order.Side, data)
+	if po.order.OrderType == "LIMIT" {
+		if po.order.Side == "BUY" && price > po.order.Price {
+			return
+		}
+		if po.order.Side == "SELL" && price < po.order.Price {
+			return
+		}
+	}
+
+	qty := po.order.Quantity
+	notional := qty * price
+	fees := notional * p.feeRate
+
+	// Release the reservation, then book the actual fill
+	p.release(po)
+
+	if po.order.Side == "BUY" {
+		p.free[po.quote] -= notional + fees
+		p.free[po.base] += qty
+	} else {
+		p.free[po.base] -= qty
+		p.free[po.quote] += notional - fees
+	}
+
+	po.status = "FILLED"
+	po.filledQty = qty
+	po.avgPrice = price
+	po.fees = fees
+	po.updatedAt = time.Now()
+}
+
+// release returns an order's reserved funds to the free balance. Caller holds p.mu.
+func (p *PaperExchange) release(po *paperOrder) {
+	p.locked[po.lockAsset] -= po.lockQty
+	p.free[po.lockAsset] += po.lockQty
+	po.lockQty = 0
+}
+
+// GetOrderStatus reports the simulated order, filling resting limits that became marketable
+func (p *PaperExchange) GetOrderStatus(ctx context.Context, orderID string) (*OrderStatus, error) {
+	p.mu.Lock()
+	po, exists := p.orders[orderID]
+	resting := exists && po.status == "NEW"
+	symbol := ""
+	if exists {
+		symbol = po.order.Symbol
+	}
+	p.mu.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("order %s: %w", orderID, errUnknownOrder)
+	}
+
+	if resting {
+		if data, err := p.pricer.GetMarketData(ctx, symbol); err == nil {
+			p.mu.Lock()
+			p.tryFill(po, data)
+			p.mu.Unlock()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &OrderStatus{
+		OrderID:      po.id,
+		Status:       po.status,
+		FilledQty:    po.filledQty,
+		AveragePrice: po.avgPrice,
+		Fees:         po.fees,
+		UpdatedAt:    po.updatedAt,
+	}, nil
+}
+
+func (p *PaperExchange) GetBalance(ctx context.Context) (*Balance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	balances := make(map[string]AssetBalance)
+	for asset, free := range p.free {
+		locked := p.locked[asset]
+		if free > 0 || locked > 0 {
+			balances[asset] = AssetBalance{
+				Asset:  asset,
+				Free:   free,
+				Locked: locked,
+				Total:  free + locked,
+			}
+		}
+	}
+	for asset, locked := range p.locked {
+		if _, seen := balances[asset]; !seen && locked > 0 {
+			balances[asset] = AssetBalance{
+				Asset:  asset,
+				Locked: locked,
+				Total:  locked,
+			}
+		}
+	}
+
+	return &Balance{
+		Exchange:  "paper",
+		Balances:  balances,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// Ping reports the health of the price source, since paper fills depend on it
+func (p *PaperExchange) Ping(ctx context.Context) error {
+	return p.pricer.Ping(ctx)
+}
+
+// CancelOrder cancels a resting order and releases its locked funds
+func (p *PaperExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	po, exists := p.orders[orderID]
+	if !exists {
+		return fmt.Errorf("order %s: %w", orderID, errUnknownOrder)
+	}
+	if po.status != "NEW" {
+		return fmt.Errorf("order %s is %s: %w", orderID, po.status, errOrderClosed)
+	}
+
+	p.release(po)
+
+	po.status = "CANCELED"
+	po.updatedAt = time.Now()
+	return nil
+}
+
+// CancelAllOrders cancels every resting order on symbol
+func (p *PaperExchange) CancelAllOrders(ctx context.Context, symbol string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, po := range p.orders {
+		if po.order.Symbol == symbol && po.status == "NEW" {
+			p.release(po)
+			po.status = "CANCELED"
+			po.updatedAt = time.Now()
+		}
+	}
+	return nil
+}
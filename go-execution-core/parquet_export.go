@@ -0,0 +1,663 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Parquet exports for the research stack: POST /api/v1/export starts a job that
+// writes trades, and optionally positions and klines, one file per table, into
+// a directory under EXPORT_DIR or an S3-compatible bucket. Jobs run one at a time
+// in the background; GET /api/v1/export/{id} reports their progress, and the row
+// count and size of each file once done. Rows are read in keyset pages of
+// exportPageSize from the analytics reader (db_replica.go) and handed to the
+// Parquet writer, which holds at most one row group in memory.
+//
+// Types are kept: timestamps are INT64 TIMESTAMP_MICROS (UTC), prices,
+// quantities, fees and PnL DECIMAL(18,8) in INT64, and kline volume DOUBLE, which
+// can exceed that range. Jobs live in memory and are lost on restart.
+
+const (
+	// exportJobsKept is how many finished jobs stay queryable
+	exportJobsKept = 50
+	// exportRowGroupBytes caps the row group the Parquet writer buffers
+	exportRowGroupBytes = 32 << 20
+	// exportDecimalScale is the scale of the DECIMAL(18,8) columns
+	exportDecimalScale = 8
+)
+
+// Export job statuses
+const (
+	exportQueued    = "queued"
+	exportRunning   = "running"
+	exportCompleted = "completed"
+	exportFailed    = "failed"
+)
+
+var exportRows = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "signalops_export_rows_total",
+	Help: "Rows written to Parquet exports, by table.",
+}, []string{"table"})
+
+// exportJob is an export's request and progress as GET /api/v1/export/{id}
+// returns it
+type exportJob struct {
+	ID          string       `json:"id"`
+	Status      string       `json:"status"`
+	Tables      []string     `json:"tables"`
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Destination string       `json:"destination"`
+	RequestedBy string       `json:"requested_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	Rows        int64        `json:"rows"` // written so far, across tables
+	Files       []exportFile `json:"files"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// exportFile is one finished table file
+type exportFile struct {
+	Table string `json:"table"`
+	Path  string `json:"path"` // local path or s3://bucket/key
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// exportJobs holds the jobs of this process and runs one at a time
+type exportJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*exportJob
+	order []string // IDs, oldest first
+	slot  chan struct{}
+}
+
+func newExportJobs() *exportJobs {
+	return &exportJobs{jobs: make(map[string]*exportJob), slot: make(chan struct{}, 1)}
+}
+
+func (e *exportJobs) add(job *exportJob) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs[job.ID] = job
+	e.order = append(e.order, job.ID)
+	// Forget the oldest finished jobs beyond exportJobsKept
+	for i := 0; len(e.order) > exportJobsKept && i < len(e.order); {
+		old := e.jobs[e.order[i]]
+		if old.Status != exportCompleted && old.Status != exportFailed {
+			i++
+			continue
+		}
+		delete(e.jobs, old.ID)
+		e.order = append(e.order[:i], e.order[i+1:]...)
+	}
+}
+
+// update changes a job under the lock
+func (e *exportJobs) update(id string, change func(job *exportJob)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if job, ok := e.jobs[id]; ok {
+		change(job)
+	}
+}
+
+// get returns a copy of a job
+func (e *exportJobs) get(id string) (exportJob, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return exportJob{}, false
+	}
+	return job.snapshot(), true
+}
+
+// list returns copies of every job, newest first
+func (e *exportJobs) list() []exportJob {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	jobs := make([]exportJob, 0, len(e.order))
+	for i := len(e.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, e.jobs[e.order[i]].snapshot())
+	}
+	return jobs
+}
+
+func (j *exportJob) snapshot() exportJob {
+	c := *j
+	c.Tables = append([]string(nil), j.Tables...)
+	c.Files = append(make([]exportFile, 0, len(j.Files)), j.Files...)
+	return c
+}
+
+// exportTable describes how one table is read and written. Rows are paged by
+// key, a unique ordering, and filtered to the job's range on rangeColumn ("" for
+// tables exported as they are now).
+type exportTable struct {
+	schema      interface{} // a row value; its parquet tags are the file schema
+	columns     string
+	from        string
+	rangeColumn string
+	key         []string
+	scan        func(rows *sql.Rows) (row interface{}, key []interface{}, err error)
+}
+
+var exportTables = map[string]exportTable{
+	"trades": {
+		schema: new(parquetTrade),
+		columns: `order_id, exchange_order_id, strategy_name, symbol, side, order_type, status, exchange,
+			account, account_type, quantity, price, executed_price, filled_quantity, fees, pnl, slippage,
+			timestamp, executed_at`,
+		from:        "trades",
+		rangeColumn: "timestamp",
+		key:         []string{"timestamp", "order_id"},
+		scan:        scanParquetTrade,
+	},
+	"positions": {
+		schema: new(parquetPosition),
+		columns: `symbol, account, strategy_name, quantity, average_entry_price, current_price,
+			unrealized_pnl, realized_pnl, opened_at, last_updated`,
+		from: "positions",
+		key:  []string{"symbol", "account"},
+		scan: scanParquetPosition,
+	},
+	"klines": {
+		schema:      new(parquetKline),
+		columns:     `exchange, symbol, interval, open_time, open, high, low, close, volume, close_time`,
+		from:        "klines",
+		rangeColumn: "open_time",
+		key:         []string{"exchange", "symbol", "interval", "open_time"},
+		scan:        scanParquetKline,
+	},
+}
+
+type parquetTrade struct {
+	OrderID         string  `parquet:"name=order_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ExchangeOrderID *string `parquet:"name=exchange_order_id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	StrategyName    string  `parquet:"name=strategy_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Symbol          string  `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Side            string  `parquet:"name=side, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OrderType       *string `parquet:"name=order_type, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Status          string  `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Exchange        *string `parquet:"name=exchange, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Account         string  `parquet:"name=account, type=BYTE_ARRAY, convertedtype=UTF8"`
+	AccountType     string  `parquet:"name=account_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Quantity        int64   `parquet:"name=quantity, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	Price           int64   `parquet:"name=price, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	ExecutedPrice   *int64  `parquet:"name=executed_price, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	FilledQuantity  *int64  `parquet:"name=filled_quantity, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	Fees            *int64  `parquet:"name=fees, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	PnL             *int64  `parquet:"name=pnl, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	Slippage        *int64  `parquet:"name=slippage, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	Timestamp       int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	ExecutedAt      *int64  `parquet:"name=executed_at, type=INT64, convertedtype=TIMESTAMP_MICROS, repetitiontype=OPTIONAL"`
+}
+
+func scanParquetTrade(rows *sql.Rows) (interface{}, []interface{}, error) {
+	var t parquetTrade
+	var exchangeOrderID, orderType, exchange sql.NullString
+	var quantity, price float64
+	var executedPrice, filledQuantity, fees, pnl, slippage sql.NullFloat64
+	var timestamp time.Time
+	var executedAt sql.NullTime
+	if err := rows.Scan(&t.OrderID, &exchangeOrderID, &t.StrategyName, &t.Symbol, &t.Side, &orderType,
+		&t.Status, &exchange, &t.Account, &t.AccountType, &quantity, &price, &executedPrice,
+		&filledQuantity, &fees, &pnl, &slippage, &timestamp, &executedAt); err != nil {
+		return nil, nil, err
+	}
+	var d decimalConverter
+	t.ExchangeOrderID, t.OrderType, t.Exchange = optionalString(exchangeOrderID), optionalString(orderType), optionalString(exchange)
+	t.Quantity, t.Price = d.value("quantity", quantity), d.value("price", price)
+	t.ExecutedPrice, t.FilledQuantity = d.optional("executed_price", executedPrice), d.optional("filled_quantity", filledQuantity)
+	t.Fees, t.PnL, t.Slippage = d.optional("fees", fees), d.optional("pnl", pnl), d.optional("slippage", slippage)
+	t.Timestamp, t.ExecutedAt = timestamp.UnixMicro(), optionalMicros(executedAt)
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("trade %s: %w", t.OrderID, d.err)
+	}
+	return t, []interface{}{timestamp, t.OrderID}, nil
+}
+
+type parquetPosition struct {
+	Symbol            string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Account           string `parquet:"name=account, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StrategyName      string `parquet:"name=strategy_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Quantity          int64  `parquet:"name=quantity, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	AverageEntryPrice int64  `parquet:"name=average_entry_price, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	CurrentPrice      *int64 `parquet:"name=current_price, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	UnrealizedPnL     *int64 `parquet:"name=unrealized_pnl, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	RealizedPnL       *int64 `parquet:"name=realized_pnl, type=INT64, convertedtype=DECIMAL, scale=8, precision=18, repetitiontype=OPTIONAL"`
+	OpenedAt          int64  `parquet:"name=opened_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	LastUpdated       int64  `parquet:"name=last_updated, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+func scanParquetPosition(rows *sql.Rows) (interface{}, []interface{}, error) {
+	var p parquetPosition
+	var quantity, entryPrice float64
+	var currentPrice, unrealizedPnL, realizedPnL sql.NullFloat64
+	var openedAt, lastUpdated time.Time
+	if err := rows.Scan(&p.Symbol, &p.Account, &p.StrategyName, &quantity, &entryPrice, &currentPrice,
+		&unrealizedPnL, &realizedPnL, &openedAt, &lastUpdated); err != nil {
+		return nil, nil, err
+	}
+	var d decimalConverter
+	p.Quantity, p.AverageEntryPrice = d.value("quantity", quantity), d.value("average_entry_price", entryPrice)
+	p.CurrentPrice, p.UnrealizedPnL = d.optional("current_price", currentPrice), d.optional("unrealized_pnl", unrealizedPnL)
+	p.RealizedPnL = d.optional("realized_pnl", realizedPnL)
+	p.OpenedAt, p.LastUpdated = openedAt.UnixMicro(), lastUpdated.UnixMicro()
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("position %s/%s: %w", p.Symbol, p.Account, d.err)
+	}
+	return p, []interface{}{p.Symbol, p.Account}, nil
+}
+
+type parquetKline struct {
+	Exchange  string  `parquet:"name=exchange, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Symbol    string  `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Interval  string  `parquet:"name=interval, type=BYTE_ARRAY, convertedtype=UTF8"`
+	OpenTime  int64   `parquet:"name=open_time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Open      int64   `parquet:"name=open, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	High      int64   `parquet:"name=high, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	Low       int64   `parquet:"name=low, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	Close     int64   `parquet:"name=close, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	Volume    float64 `parquet:"name=volume, type=DOUBLE"`
+	CloseTime int64   `parquet:"name=close_time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+func scanParquetKline(rows *sql.Rows) (interface{}, []interface{}, error) {
+	var k parquetKline
+	var openPrice, highPrice, lowPrice, closePrice float64
+	var openTime, closeTime time.Time
+	if err := rows.Scan(&k.Exchange, &k.Symbol, &k.Interval, &openTime, &openPrice, &highPrice, &lowPrice,
+		&closePrice, &k.Volume, &closeTime); err != nil {
+		return nil, nil, err
+	}
+	var d decimalConverter
+	k.Open, k.High = d.value("open", openPrice), d.value("high", highPrice)
+	k.Low, k.Close = d.value("low", lowPrice), d.value("close", closePrice)
+	k.OpenTime, k.CloseTime = openTime.UnixMicro(), closeTime.UnixMicro()
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("kline %s %s %s %s: %w", k.Exchange, k.Symbol, k.Interval, openTime.UTC().Format(time.RFC3339), d.err)
+	}
+	return k, []interface{}{k.Exchange, k.Symbol, k.Interval, openTime}, nil
+}
+
+// decimalConverter scales values to DECIMAL(18,8) and keeps the first value
+// that does not fit
+type decimalConverter struct {
+	err error
+}
+
+func (d *decimalConverter) value(column string, v float64) int64 {
+	scaled := math.Round(v * math.Pow10(exportDecimalScale))
+	if math.IsNaN(scaled) || math.Abs(scaled) >= 1e18 {
+		if d.err == nil {
+			d.err = fmt.Errorf("%s %v does not fit DECIMAL(18,%d)", column, v, exportDecimalScale)
+		}
+		return 0
+	}
+	return int64(scaled)
+}
+
+func (d *decimalConverter) optional(column string, v sql.NullFloat64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	scaled := d.value(column, v.Float64)
+	return &scaled
+}
+
+func optionalString(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+func optionalMicros(v sql.NullTime) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	micros := v.Time.UnixMicro()
+	return &micros
+}
+
+// exportDestination is where a job's files go: a local directory, or a bucket
+// and key prefix
+type exportDestination struct {
+	dir    string
+	bucket string
+	prefix string
+}
+
+// parseExportDestination accepts s3://bucket/prefix, which needs EXPORT_S3_*, or
+// a directory inside EXPORT_DIR, relative to it or absolute
+func (s *Server) parseExportDestination(raw string) (exportDestination, error) {
+	if rest, ok := strings.CutPrefix(raw, "s3://"); ok {
+		if s.exportS3 == nil {
+			return exportDestination{}, fmt.Errorf("s3 destinations need EXPORT_S3_ENDPOINT")
+		}
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return exportDestination{}, fmt.Errorf("%q has no bucket", raw)
+		}
+		return exportDestination{bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+	}
+
+	base, err := filepath.Abs(s.config.ExportDir)
+	if err != nil {
+		return exportDestination{}, err
+	}
+	dir := raw
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(base, dir)
+	}
+	dir = filepath.Clean(dir)
+	if dir != base && !strings.HasPrefix(dir, base+string(filepath.Separator)) {
+		return exportDestination{}, fmt.Errorf("must be inside EXPORT_DIR (%s) or an s3:// URL", base)
+	}
+	return exportDestination{dir: dir}, nil
+}
+
+func (s *Server) registerExportEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/export", s.handleExports)
+	mux.HandleFunc("/api/v1/export/", s.handleExportByID)
+}
+
+// handleExports starts an export or lists the jobs:
+// POST /api/v1/export {"from", "to", "destination", "tables"}
+// GET /api/v1/export
+func (s *Server) handleExports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": s.exports.list()})
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		From        string   `json:"from"`
+		To          string   `json:"to"`
+		Destination string   `json:"destination"`
+		Tables      []string `json:"tables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var errs []FieldError
+	from, err := time.Parse(time.RFC3339, req.From)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "from", Message: "must be an RFC3339 timestamp"})
+	}
+	to := time.Now().UTC()
+	if req.To != "" {
+		if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+			errs = append(errs, FieldError{Field: "to", Message: "must be an RFC3339 timestamp"})
+		}
+	}
+	if len(errs) == 0 && !to.After(from) {
+		errs = append(errs, FieldError{Field: "to", Message: "must be after from"})
+	}
+	if len(req.Tables) == 0 {
+		req.Tables = []string{"trades"}
+	}
+	seen := make(map[string]bool)
+	for _, table := range req.Tables {
+		if _, ok := exportTables[table]; !ok || seen[table] {
+			errs = append(errs, FieldError{Field: "tables", Message: "must list trades, positions or klines at most once each"})
+			break
+		}
+		seen[table] = true
+	}
+	var dest exportDestination
+	if req.Destination == "" {
+		errs = append(errs, FieldError{Field: "destination", Message: "is required"})
+	} else if dest, err = s.parseExportDestination(req.Destination); err != nil {
+		errs = append(errs, FieldError{Field: "destination", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "Invalid export request",
+			"errors": errs,
+		})
+		return
+	}
+
+	job := &exportJob{
+		ID:          newRequestID(),
+		Status:      exportQueued,
+		Tables:      req.Tables,
+		From:        from.UTC(),
+		To:          to.UTC(),
+		Destination: req.Destination,
+		RequestedBy: callerID(r.Context()),
+		CreatedAt:   time.Now().UTC(),
+		Files:       make([]exportFile, 0, len(req.Tables)),
+	}
+	s.exports.add(job)
+	go s.runExport(job.ID, dest)
+	logEvent(r.Context(), "Export queued", "job", job.ID, "tables", strings.Join(job.Tables, ","),
+		"from", job.From, "to", job.To, "destination", job.Destination, "by", job.RequestedBy)
+
+	w.Header().Set("Location", "/api/v1/export/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+// handleExportByID reports a job: GET /api/v1/export/{id}
+func (s *Server) handleExportByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/export/")
+	job, ok := s.exports.get(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Export '%s' not found", id),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// runExport waits for the export slot, then writes each table of the job
+func (s *Server) runExport(id string, dest exportDestination) {
+	select {
+	case s.exports.slot <- struct{}{}:
+	case <-s.streamCtx.Done():
+		s.finishExport(id, errors.New("shutting down"))
+		return
+	}
+	defer func() { <-s.exports.slot }()
+
+	job, _ := s.exports.get(id)
+	started := time.Now().UTC()
+	s.exports.update(id, func(j *exportJob) {
+		j.Status = exportRunning
+		j.StartedAt = &started
+	})
+	log.Printf("Export %s started: %s from %s to %s", id, strings.Join(job.Tables, ","),
+		job.From.Format(time.RFC3339), job.To.Format(time.RFC3339))
+
+	var err error
+	for _, table := range job.Tables {
+		var file exportFile
+		if file, err = s.exportTable(s.streamCtx, job, table, dest); err != nil {
+			err = fmt.Errorf("%s: %w", table, err)
+			break
+		}
+		s.exports.update(id, func(j *exportJob) { j.Files = append(j.Files, file) })
+	}
+	s.finishExport(id, err)
+}
+
+func (s *Server) finishExport(id string, err error) {
+	finished := time.Now().UTC()
+	var job exportJob
+	s.exports.update(id, func(j *exportJob) {
+		j.FinishedAt = &finished
+		if err != nil {
+			j.Status = exportFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = exportCompleted
+		}
+		job = j.snapshot()
+	})
+	if err != nil {
+		log.Printf("Export %s failed after %d rows: %v", id, job.Rows, err)
+		return
+	}
+	log.Printf("✓ Export %s complete: %d rows in %d files", id, job.Rows, len(job.Files))
+}
+
+// exportTable writes one table of job to a file and moves it to dest
+func (s *Server) exportTable(ctx context.Context, job exportJob, table string, dest exportDestination) (exportFile, error) {
+	name := fmt.Sprintf("%s_%s_%s.parquet", table, job.From.Format("20060102T150405Z"), job.To.Format("20060102T150405Z"))
+
+	// Local files are written next to their final name and renamed when complete,
+	// so readers never see a partial file; S3 files are staged in the temp dir
+	tmpDir := os.TempDir()
+	if dest.dir != "" {
+		if err := os.MkdirAll(dest.dir, 0o755); err != nil {
+			return exportFile{}, err
+		}
+		tmpDir = dest.dir
+	}
+	tmp, err := os.CreateTemp(tmpDir, "."+name+".*.tmp")
+	if err != nil {
+		return exportFile{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	rows, err := s.writeParquet(ctx, job, table, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return exportFile{}, err
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return exportFile{}, err
+	}
+
+	file := exportFile{Table: table, Rows: rows, Bytes: info.Size()}
+	if dest.dir != "" {
+		file.Path = filepath.Join(dest.dir, name)
+		return file, os.Rename(tmp.Name(), file.Path)
+	}
+	key := name
+	if dest.prefix != "" {
+		key = dest.prefix + "/" + name
+	}
+	file.Path = "s3://" + dest.bucket + "/" + key
+	return file, s.exportS3.upload(ctx, dest.bucket, key, tmp.Name())
+}
+
+// writeParquet streams the job's rows of table into out, one keyset page at a
+// time, and returns how many it wrote
+func (s *Server) writeParquet(ctx context.Context, job exportJob, table string, out io.Writer) (int64, error) {
+	spec := exportTables[table]
+	pw, err := writer.NewParquetWriterFromWriter(out, spec.schema, 1)
+	if err != nil {
+		return 0, err
+	}
+	pw.RowGroupSize = exportRowGroupBytes
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	keyColumns := strings.Join(spec.key, ", ")
+	var written int64
+	var after []interface{}
+	for {
+		var where whereBuilder
+		if spec.rangeColumn != "" {
+			where.add(spec.rangeColumn+" >= ?", job.From)
+			where.add(spec.rangeColumn+" < ?", job.To)
+		}
+		if after != nil {
+			where.add("("+keyColumns+") > ("+strings.TrimSuffix(strings.Repeat("?, ", len(after)), ", ")+")", after...)
+		}
+
+		page, last, err := s.readExportPage(ctx, spec, where, keyColumns, pw)
+		written += int64(page)
+		s.exports.update(job.ID, func(j *exportJob) { j.Rows += int64(page) })
+		exportRows.WithLabelValues(table).Add(float64(page))
+		if err != nil {
+			return written, err
+		}
+		if page < exportPageSize {
+			break
+		}
+		after = last
+	}
+	if err := pw.WriteStop(); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// readExportPage writes one page of rows to pw, returning how many and the key
+// of the last
+func (s *Server) readExportPage(ctx context.Context, spec exportTable, where whereBuilder, keyColumns string,
+	pw *writer.ParquetWriter) (int, []interface{}, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	rows, err := s.store.reader(readAnalytics).QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM %s
+		%s
+		ORDER BY %s
+		LIMIT %d
+	`, spec.columns, spec.from, where.sql(), keyColumns, exportPageSize), where.args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	page := 0
+	var last []interface{}
+	for rows.Next() {
+		row, key, err := spec.scan(rows)
+		if err != nil {
+			return page, nil, err
+		}
+		if err := pw.Write(row); err != nil {
+			return page, nil, err
+		}
+		last = key
+		page++
+	}
+	return page, last, rows.Err()
+}
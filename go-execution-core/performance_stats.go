@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// tradingDaysPerYear annualizes daily ratios; crypto markets trade every day
+const tradingDaysPerYear = 365
+
+// dayPnL is the realized PnL of one UTC day
+type dayPnL struct {
+	Day         time.Time
+	PnL         float64
+	GrossProfit float64
+	GrossLoss   float64 // positive
+}
+
+// riskAdjustedStats are the ratios of a daily PnL series. Ratios that cannot be
+// computed (fewer than 2 days, zero variance, no losses) are nil rather than NaN
+// or Inf, which JSON cannot encode.
+type riskAdjustedStats struct {
+	Days              int      `json:"days"`
+	SharpeRatio       *float64 `json:"sharpe_ratio"`
+	SortinoRatio      *float64 `json:"sortino_ratio"`
+	MaxDrawdown       float64  `json:"max_drawdown"`
+	MaxDrawdownPeak   *string  `json:"max_drawdown_peak_date"`
+	MaxDrawdownTrough *string  `json:"max_drawdown_trough_date"`
+	ProfitFactor      *float64 `json:"profit_factor"`
+}
+
+// queryDailyPnL reads realized PnL per strategy and UTC day
+func (s *Server) queryDailyPnL(ctx context.Context) (map[string][]dayPnL, error) {
+	var where whereBuilder
+	where.add("pnl IS NOT NULL")
+	where.add("status = 'FILLED'")
+	where.add("executed_at IS NOT NULL")
+	sums, err := s.store.sumPnL(ctx, readAnalytics, &where, "day", time.UTC, true)
+	if err != nil {
+		return nil, err
+	}
+
+	byStrategy := make(map[string][]dayPnL)
+	for _, sum := range sums {
+		byStrategy[sum.Strategy] = append(byStrategy[sum.Strategy], dayPnL{
+			Day:         sum.Start,
+			PnL:         sum.PnL,
+			GrossProfit: sum.GrossProfit,
+			GrossLoss:   sum.GrossLoss,
+		})
+	}
+	return byStrategy, nil
+}
+
+// combineDailyPnL sums several strategies' series into one portfolio series
+func combineDailyPnL(byStrategy map[string][]dayPnL) []dayPnL {
+	totals := make(map[int64]dayPnL)
+	for _, days := range byStrategy {
+		for _, d := range days {
+			t := totals[d.Day.Unix()]
+			t.Day = d.Day
+			t.PnL += d.PnL
+			t.GrossProfit += d.GrossProfit
+			t.GrossLoss += d.GrossLoss
+			totals[d.Day.Unix()] = t
+		}
+	}
+	combined := make([]dayPnL, 0, len(totals))
+	for _, d := range totals {
+		combined = append(combined, d)
+	}
+	sort.Slice(combined, func(i, j int) bool { return combined[i].Day.Before(combined[j].Day) })
+	return combined
+}
+
+// computeRiskAdjusted derives the ratios from days sorted by date. Days without
+// trades between the first and last trading day count as zero returns. Returns
+// are daily realized PnL until balance snapshots give a capital base; Sharpe and
+// Sortino do not depend on a fixed capital, only drawdown is in currency.
+func computeRiskAdjusted(days []dayPnL) riskAdjustedStats {
+	var stats riskAdjustedStats
+	if len(days) == 0 {
+		return stats
+	}
+
+	first, last := days[0].Day, days[len(days)-1].Day
+	returns := make([]float64, int(last.Sub(first)/(24*time.Hour))+1)
+	var grossProfit, grossLoss float64
+	for _, d := range days {
+		returns[int(d.Day.Sub(first)/(24*time.Hour))] += d.PnL
+		grossProfit += d.GrossProfit
+		grossLoss += d.GrossLoss
+	}
+	stats.Days = len(returns)
+
+	if grossLoss > 0 {
+		pf := grossProfit / grossLoss
+		stats.ProfitFactor = &pf
+	}
+
+	// Drawdown of cumulative PnL, which starts at zero before the first day
+	var cumulative, peak float64
+	peakDay := first
+	for i, r := range returns {
+		day := first.AddDate(0, 0, i)
+		cumulative += r
+		if cumulative > peak {
+			peak, peakDay = cumulative, day
+		}
+		if drawdown := peak - cumulative; drawdown > stats.MaxDrawdown {
+			stats.MaxDrawdown = drawdown
+			peakDate, troughDate := peakDay.Format("2006-01-02"), day.Format("2006-01-02")
+			stats.MaxDrawdownPeak, stats.MaxDrawdownTrough = &peakDate, &troughDate
+		}
+	}
+
+	if len(returns) < 2 {
+		return stats
+	}
+	var sum float64
+	for _, r := range returns {
+		sum += r
+	}
+	mean := sum / float64(len(returns))
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+	annualize := math.Sqrt(tradingDaysPerYear)
+	if stdDev > 0 {
+		sharpe := mean / stdDev * annualize
+		stats.SharpeRatio = &sharpe
+	}
+	if downsideDev > 0 {
+		sortino := mean / downsideDev * annualize
+		stats.SortinoRatio = &sortino
+	}
+	return stats
+}
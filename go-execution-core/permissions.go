@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Permissions are the scopes carried by tokens and implied by roles
+const (
+	scopeOrdersRead      = "orders:read"
+	scopeOrdersWrite     = "orders:write"
+	scopeMarketRead      = "market:read"
+	scopePortfolioRead   = "portfolio:read"
+	scopeStrategiesRead  = "strategies:read"
+	scopeStrategiesWrite = "strategies:write"
+	scopeExchangesRead   = "exchanges:read"
+	scopeExchangesWrite  = "exchanges:write"
+
+	// permAdmin guards routes missing from routePermissions, so new endpoints fail closed
+	permAdmin = "admin"
+)
+
+// Roles tied to API keys and token users
+const (
+	roleViewer = "viewer"
+	roleTrader = "trader"
+	roleAdmin  = "admin"
+)
+
+var viewerPermissions = []string{
+	scopeOrdersRead, scopeMarketRead, scopePortfolioRead, scopeStrategiesRead, scopeExchangesRead,
+}
+
+var rolePermissions = map[string][]string{
+	roleViewer: viewerPermissions,
+	roleTrader: append(append([]string{}, viewerPermissions...), scopeOrdersWrite),
+	roleAdmin: append(append([]string{}, viewerPermissions...),
+		scopeOrdersWrite, scopeStrategiesWrite, scopeExchangesWrite, permAdmin),
+}
+
+// routeRule maps a path prefix to the permission needed to read (GET/HEAD) and
+// to change (every other method)
+type routeRule struct {
+	prefix string
+	read   string
+	write  string
+}
+
+// routePermissions is the single source of REST authorization. The longest
+// matching prefix wins; unmatched /api/v1 routes require permAdmin.
+var routePermissions = []routeRule{
+	{"/api/v1/orders", scopeOrdersRead, scopeOrdersWrite},
+	{"/api/v1/order_status", scopeOrdersRead, scopeOrdersRead},
+	{"/api/v1/trades/export", scopeOrdersRead, scopeOrdersRead},
+	{"/api/v1/market/", scopeMarketRead, scopeMarketRead},
+	{"/api/v1/orderbook/", scopeMarketRead, scopeMarketRead},
+	{"/api/v1/klines/", scopeMarketRead, scopeMarketRead},
+	{"/api/v1/balance/", scopePortfolioRead, scopePortfolioRead},
+	{"/api/v1/portfolio/", scopePortfolioRead, scopePortfolioRead},
+	{"/api/v1/portfolio/positions/", scopePortfolioRead, scopeOrdersWrite},
+	{"/api/v1/portfolio/close_all", permAdmin, permAdmin},
+	{"/api/v1/export", permAdmin, permAdmin},
+	{"/api/v1/portfolio/risk/limits", scopePortfolioRead, permAdmin},
+	{"/api/v1/portfolio/risk/events", scopePortfolioRead, permAdmin},
+	{"/api/v1/strategies", scopeStrategiesRead, scopeStrategiesWrite},
+	{"/api/v1/leaderboard", scopeStrategiesRead, scopeStrategiesRead},
+	{"/api/v1/exchanges", scopeExchangesRead, scopeExchangesWrite},
+	{"/api/v1/ws/orders", scopeOrdersRead, scopeOrdersRead},
+	{"/api/v1/stream/fills", scopeOrdersRead, scopeOrdersRead},
+	{"/api/v1/ws/market", scopeMarketRead, scopeMarketRead},
+}
+
+// grpcMethodPermissions is the single source of gRPC authorization, in the same
+// permissions the roles grant for REST. Methods mapped to "" need no credentials;
+// unlisted methods require permAdmin.
+var grpcMethodPermissions = map[string]string{
+	// Health checks need no credentials, like /readyz
+	"/grpc.health.v1.Health/Check": "",
+	"/grpc.health.v1.Health/Watch": "",
+	// Reflection only describes the schema; it is off in production unless GRPC_REFLECTION=true
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      "",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": "",
+
+	"/signalops.ExecutionService/SubmitOrder":         scopeOrdersWrite,
+	"/signalops.ExecutionService/BatchSubmitOrders":   scopeOrdersWrite,
+	"/signalops.ExecutionService/CancelOrder":         scopeOrdersWrite,
+	"/signalops.ExecutionService/ModifyOrder":         scopeOrdersWrite,
+	"/signalops.ExecutionService/GetOrderStatus":      scopeOrdersRead,
+	"/signalops.ExecutionService/GetOpenOrders":       scopeOrdersRead,
+	"/signalops.ExecutionService/ListOrders":          scopeOrdersRead,
+	"/signalops.ExecutionService/GetOrder":            scopeOrdersRead,
+	"/signalops.ExecutionService/GetMarketData":       scopeMarketRead,
+	"/signalops.ExecutionService/StreamPrices":        scopeMarketRead,
+	"/signalops.ExecutionService/StreamMarketData":    scopeMarketRead,
+	"/signalops.ExecutionService/StreamOrderBook":     scopeMarketRead,
+	"/signalops.ExecutionService/StreamOrderUpdates":  scopeOrdersRead,
+	"/signalops.ExecutionService/GetBalance":          scopePortfolioRead,
+	"/signalops.ExecutionService/StreamBalances":      scopePortfolioRead,
+	"/signalops.ExecutionService/GetPositions":        scopePortfolioRead,
+	"/signalops.ExecutionService/GetPortfolioSummary": scopePortfolioRead,
+	"/signalops.ExecutionService/GetTickers":          scopeMarketRead,
+	"/signalops.ExecutionService/GetBuildInfo":        "",
+}
+
+func routePermission(method, path string) string {
+	var best *routeRule
+	for i := range routePermissions {
+		rule := &routePermissions[i]
+		if strings.HasPrefix(path, rule.prefix) && (best == nil || len(rule.prefix) > len(best.prefix)) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return permAdmin
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return best.read
+	}
+	return best.write
+}
+
+func grpcMethodPermission(method string) string {
+	if perm, exists := grpcMethodPermissions[method]; exists {
+		return perm
+	}
+	return permAdmin
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID          string // API key ID or token subject
+	Kind        string // "api_key" or "jwt"
+	Role        string
+	Permissions []string
+}
+
+const principalContextKey contextKey = "principal"
+
+func principalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey).(*Principal)
+	return p
+}
+
+// callerID returns the ID of the authenticated caller for audit logs, if any
+func callerID(ctx context.Context) string {
+	if p := principalFromContext(ctx); p != nil {
+		return p.ID
+	}
+	return ""
+}
+
+// missingPermission returns perm when the principal lacks it, or "" when allowed
+func (p *Principal) missingPermission(perm string) string {
+	for _, granted := range p.Permissions {
+		if granted == perm {
+			return ""
+		}
+	}
+	return perm
+}
+
+// forbid writes the 403 for a principal that lacks perm
+func forbid(w http.ResponseWriter, p *Principal, perm string) {
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":              "Forbidden: missing permission " + perm,
+		"missing_permission": perm,
+		"role":               p.Role,
+	})
+}
@@ -0,0 +1,379 @@
+// Package client is the Go client for the execution engine. Client is implemented
+// over the REST API by NewREST and over gRPC by NewGRPC, so a service can switch
+// transports without touching its call sites:
+//
+//	c := client.NewREST("http://localhost:8080", client.WithAPIKey(os.Getenv("EXECUTION_API_KEY"), ""))
+//	// or: c, err := client.NewGRPC("localhost:50050", client.WithBearerToken(token))
+//	defer c.Close()
+//
+//	result, err := c.SubmitOrder(ctx, &client.OrderRequest{
+//		OrderID:      "momentum-42",
+//		StrategyName: "momentum",
+//		Symbol:       "BTCUSDT",
+//		Side:         "BUY",
+//		Quantity:     0.01,
+//	})
+//	if err != nil {
+//		return err // transport, auth or server failure
+//	}
+//	if !result.Success {
+//		log.Printf("order %s %s: %s", result.OrderID, result.Status, result.Error)
+//	}
+//
+//	updates, err := c.StreamOrderUpdates(ctx, client.OrderUpdateFilter{StrategyName: "momentum"})
+//	if err != nil {
+//		return err
+//	}
+//	defer updates.Close()
+//	for {
+//		update, err := updates.Recv()
+//		if err != nil {
+//			return err
+//		}
+//		log.Printf("%s %s %s", update.OrderID, update.Type, update.Status)
+//	}
+//
+// Every call carries the configured credentials. Calls failing with a server error
+// (HTTP 5xx, or the gRPC codes grpc-gateway maps to one) are retried with
+// exponential backoff. Orders always go out with an idempotency key, so a retried
+// submission replays the first result instead of placing a second order.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Client is the execution engine API, whichever transport carries it
+type Client interface {
+	// SubmitOrder places an order. Orders the engine answers but does not place
+	// (rejected or failed on the exchange) come back with Success false and a nil
+	// error; the error is for calls that got no answer.
+	SubmitOrder(ctx context.Context, req *OrderRequest) (*OrderResult, error)
+	// CancelOrder cancels an open order
+	CancelOrder(ctx context.Context, req *CancelRequest) error
+	GetMarketData(ctx context.Context, exchange, symbol string) (*MarketData, error)
+	GetBalance(ctx context.Context, req *BalanceRequest) (*Balance, error)
+	// ListOrders returns one page of recorded orders, newest first
+	ListOrders(ctx context.Context, req *ListOrdersRequest) (*OrderPage, error)
+	GetPositions(ctx context.Context, req *PositionsRequest) (*Positions, error)
+	// StreamOrderUpdates pushes order state changes until ctx ends or the stream is closed
+	StreamOrderUpdates(ctx context.Context, filter OrderUpdateFilter) (OrderUpdateStream, error)
+	Close() error
+}
+
+// OrderUpdateStream receives order updates. Recv blocks for the next one; after
+// the stream ends it keeps returning the error that ended it.
+type OrderUpdateStream interface {
+	Recv() (*OrderUpdate, error)
+	Close() error
+}
+
+// Reject reasons of an order the engine refused before sending it to the exchange
+const (
+	RejectExchangeNotConfigured = "exchange_not_configured"
+	RejectValidation            = "validation"
+	RejectExchangeUnavailable   = "exchange_unavailable"
+)
+
+// OrderRequest is a new order. Exchange defaults to binance and OrderType to MARKET.
+type OrderRequest struct {
+	OrderID        string  `json:"order_id"`
+	StrategyName   string  `json:"strategy_name"`
+	Symbol         string  `json:"symbol"`
+	Side           string  `json:"side"` // BUY or SELL
+	Quantity       float64 `json:"quantity"`
+	Price          float64 `json:"price"` // Limit price, 0 for market orders
+	OrderType      string  `json:"order_type"`
+	Exchange       string  `json:"exchange"`
+	Account        string  `json:"account"` // Named account, empty for the default one
+	ReduceOnly     bool    `json:"reduce_only"`
+	PositionSide   string  `json:"position_side"`
+	AccountType    string  `json:"account_type"` // spot, margin or futures
+	SideEffectType string  `json:"side_effect_type"`
+
+	// IdempotencyKey defaults to OrderID, or a random key when that is empty too
+	IdempotencyKey string `json:"-"`
+}
+
+// OrderResult is the engine's answer to an order
+type OrderResult struct {
+	Success          bool
+	OrderID          string
+	ExchangeOrderID  string
+	Status           string // REJECTED or FAILED when not placed
+	ExecutedPrice    float64
+	ExecutedQuantity float64
+	Fees             float64
+	ExecutedAt       time.Time // gRPC only
+	Error            string
+	RejectReason     string       // One of the Reject constants when the engine refused the order
+	FieldErrors      []FieldError // With RejectValidation
+	Replayed         bool         // The result of an earlier submission with the same idempotency key
+}
+
+// FieldError is one reason an order failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// CancelRequest identifies an order to cancel. Symbol and Exchange default to the
+// order's recorded ones; an order the engine did not record needs both.
+type CancelRequest struct {
+	OrderID  string
+	Symbol   string
+	Exchange string
+	Account  string
+}
+
+type MarketData struct {
+	Symbol         string
+	Exchange       string
+	Price          float64
+	Bid            float64
+	Ask            float64
+	Volume24h      float64
+	High24h        float64
+	Low24h         float64
+	PriceChange24h float64
+	Timestamp      time.Time
+}
+
+// BalanceRequest selects an account balance. Exchange defaults to binance.
+type BalanceRequest struct {
+	Exchange    string
+	Account     string   // Named account, "all" to merge every account
+	Assets      []string // Empty for all assets
+	MinValueUSD float64  // Drop priced assets worth less than this
+	Force       bool     // Read the exchange instead of the engine's balance cache
+}
+
+type Balance struct {
+	Exchange       string
+	Accounts       []string
+	Balances       map[string]AssetBalance
+	TotalValueUSD  float64
+	UnpricedAssets []string
+	MarginLevel    float64 // Margin accounts only
+	Cached         bool
+	Timestamp      time.Time // When the exchange was read
+}
+
+type AssetBalance struct {
+	Asset    string
+	Free     float64
+	Locked   float64
+	Total    float64
+	ValueUSD float64
+	Borrowed float64
+	Interest float64
+}
+
+// ListOrdersRequest filters recorded orders; empty fields match every order
+type ListOrdersRequest struct {
+	StrategyName string
+	Symbol       string
+	Side         string
+	Status       string
+	Exchange     string
+	From, To     time.Time // Zero leaves that side open
+	Limit        int       // 0 for the server default (50)
+	Cursor       string    // NextCursor of the previous page
+}
+
+type OrderPage struct {
+	Orders     []Order
+	NextCursor string // Empty on the last page
+}
+
+// Order is a recorded order. Over REST only OrderID, StrategyName, Symbol, Side,
+// Quantity, Price, Status, AveragePrice, Exchange and Timestamp are filled.
+type Order struct {
+	OrderID         string
+	ExchangeOrderID string
+	StrategyName    string
+	Symbol          string
+	Side            string
+	Quantity        float64
+	Price           float64
+	Status          string
+	FilledQuantity  float64
+	AveragePrice    float64
+	Fees            float64
+	Exchange        string
+	AccountType     string
+	OrderType       string // Empty for orders recorded before it was kept
+	Timestamp       time.Time
+	ExecutedAt      time.Time // Zero until executed
+	UpdatedAt       time.Time
+}
+
+// PositionsRequest filters positions; empty fields match every position
+type PositionsRequest struct {
+	StrategyName  string
+	Symbol        string
+	Exchange      string
+	Account       *string // nil for all accounts, "" for the default one
+	IncludeClosed bool
+	ClosedWithin  time.Duration // With IncludeClosed; 0 for the server default (24h)
+}
+
+type Positions struct {
+	Positions          []Position
+	TotalUnrealizedPnL float64
+	TotalRealizedPnL   float64
+	TotalPnL           float64
+	TotalMarketValue   float64
+}
+
+// Position is a strategy's holding in a symbol. The pointer fields are nil until
+// the position is marked to market.
+type Position struct {
+	Symbol            string
+	Account           string
+	StrategyName      string
+	Quantity          float64 // Negative for shorts, 0 once closed
+	AverageEntryPrice float64
+	CurrentPrice      *float64
+	MarketValue       *float64
+	UnrealizedPnL     *float64
+	RealizedPnL       *float64
+	OpenedAt          time.Time
+	LastUpdated       time.Time
+	Closed            bool
+}
+
+// OrderUpdateFilter narrows an order update stream; empty fields match every order
+type OrderUpdateFilter struct {
+	StrategyName string
+	Symbol       string
+}
+
+// OrderUpdate is one order state change
+type OrderUpdate struct {
+	Type            string // submitted, filled, partially_filled, cancelled, rejected or unknown
+	OrderID         string
+	ExchangeOrderID string
+	StrategyName    string
+	Symbol          string
+	Side            string
+	Exchange        string
+	Status          string
+	FilledQuantity  float64
+	AveragePrice    float64 // 0 until something is filled
+	Fees            float64
+	Error           string // Why the order was rejected
+	Timestamp       time.Time
+}
+
+// Error is a call the engine answered with a failure. Over gRPC, StatusCode is
+// the HTTP status grpc-gateway gives the call's code.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("execution engine: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// StatusCode returns the HTTP status of err when the engine answered it, else 0
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Option configures a client
+type Option func(*options)
+
+type options struct {
+	token       string
+	apiKey      string
+	apiSecret   string
+	retries     int
+	backoff     time.Duration
+	httpClient  *http.Client
+	dialOptions []grpc.DialOption
+}
+
+func defaultOptions() *options {
+	return &options{
+		retries:    3,
+		backoff:    200 * time.Millisecond,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// WithBearerToken authenticates with a token from /api/v1/auth/token
+func WithBearerToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithAPIKey authenticates with a client API key. Keys created with --signed also
+// pass their secret, which signs state-changing REST requests; over gRPC signed
+// keys can only read.
+func WithAPIKey(key, secret string) Option {
+	return func(o *options) { o.apiKey, o.apiSecret = key, secret }
+}
+
+// WithRetries sets how many times a call failing with a server error is retried
+// (default 3) and the first backoff (default 200ms), which doubles per attempt
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(o *options) { o.retries, o.backoff = retries, backoff }
+}
+
+// WithHTTPClient replaces the REST transport's HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) { o.httpClient = httpClient }
+}
+
+// WithDialOptions adds gRPC dial options, e.g. transport credentials; the
+// connection is plaintext unless they say otherwise
+func WithDialOptions(dialOptions ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, dialOptions...) }
+}
+
+// retry runs call until it succeeds, fails for good or the retries run out.
+// call reports whether its error is worth retrying.
+func (o *options) retry(ctx context.Context, call func() (retryable bool, err error)) error {
+	backoff := o.backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := call()
+		if err == nil || !retryable || attempt >= o.retries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// idempotencyKey is the key an order goes out with, the same on every retry
+func idempotencyKey(req *OrderRequest) string {
+	if req.IdempotencyKey != "" {
+		return req.IdempotencyKey
+	}
+	if req.OrderID != "" {
+		return req.OrderID
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
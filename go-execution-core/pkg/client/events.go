@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EventSchemaVersion is the event schema this package decodes
+const EventSchemaVersion = 1
+
+// EventConsumer reads the engine's Redis event stream (ORDER_EVENTS_STREAM) as one
+// consumer of a consumer group. Each entry goes to one consumer of the group and
+// stays pending until acked, so nothing is lost while a consumer is offline:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	events := client.NewEventConsumer(rdb, "order_events", "default", "pnl-1")
+//	for {
+//		batch, err := events.Read(ctx)
+//		if err != nil {
+//			return err
+//		}
+//		for _, ev := range batch {
+//			if ev.Fill != nil {
+//				book(ev.Fill)
+//			}
+//			events.Ack(ctx, ev.ID)
+//		}
+//	}
+//
+// After a restart the consumer first gets back what it read but did not ack.
+// Entries of a consumer that is gone for good are taken over with ClaimStale.
+// Delivery is at least once: handlers should tolerate seeing an entry twice.
+type EventConsumer struct {
+	rdb      redis.UniversalClient
+	stream   string
+	group    string
+	consumer string
+
+	// Count is the most entries one Read returns (default 100); Block is how long
+	// Read waits for new entries (default 5s)
+	Count int64
+	Block time.Duration
+
+	pendingFrom string // where reading back this consumer's unacked entries resumes; "" once done
+}
+
+// NewEventConsumer reads stream as consumer of group. The engine creates its
+// default group (ORDER_EVENTS_STREAM_GROUP); other groups are created with
+// CreateGroup.
+func NewEventConsumer(rdb redis.UniversalClient, stream, group, consumer string) *EventConsumer {
+	return &EventConsumer{rdb: rdb, stream: stream, group: group, consumer: consumer, Count: 100, Block: 5 * time.Second,
+		pendingFrom: "0"}
+}
+
+// StreamEvent is one entry of the event stream
+type StreamEvent struct {
+	ID            string // entry ID, passed to Ack
+	Type          string // an OrderUpdate type, or fill
+	OrderID       string
+	Source        string // live, or replay for entries re-emitted from recorded orders
+	SchemaVersion int
+	Data          json.RawMessage // the event as published
+	Order         *OrderUpdate    // set for order events of a known schema version
+	Fill          *Fill           // set for fills of a known schema version
+	Deliveries    int64           // set by ClaimStale: deliveries so far, this one included
+}
+
+// Fill is one execution against an order. Replayed fills carry the order's whole
+// executed quantity.
+type Fill struct {
+	OrderID      string    `json:"order_id"`
+	StrategyName string    `json:"strategy_name"`
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	Exchange     string    `json:"exchange"`
+	Price        float64   `json:"price"`
+	Quantity     float64   `json:"quantity"`
+	Fees         float64   `json:"fees"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// CreateGroup creates the consumer group reading the stream from its start,
+// creating the stream too; a group that already exists is not an error
+func (c *EventConsumer) CreateGroup(ctx context.Context) error {
+	err := c.rdb.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Read returns the next entries for this consumer: first any it read earlier
+// without acking, then new ones, waiting up to Block. An empty slice means none
+// arrived in time.
+func (c *EventConsumer) Read(ctx context.Context) ([]StreamEvent, error) {
+	start := ">"
+	block := c.Block
+	if c.pendingFrom != "" {
+		start, block = c.pendingFrom, -1 // pending entries are there already; XREADGROUP without BLOCK
+	}
+	streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, start},
+		Count:    c.Count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			events = append(events, decodeStreamEvent(msg))
+		}
+	}
+	if c.pendingFrom != "" {
+		if len(events) == 0 {
+			c.pendingFrom = ""
+			return c.Read(ctx)
+		}
+		c.pendingFrom = events[len(events)-1].ID
+	}
+	return events, nil
+}
+
+// Ack marks entries handled, removing them from the group's pending list
+func (c *EventConsumer) Ack(ctx context.Context, ids ...string) error {
+	return c.rdb.XAck(ctx, c.stream, c.group, ids...).Err()
+}
+
+// ClaimStale takes over up to Count entries other consumers of the group read but
+// have not acked for minIdle, e.g. because they crashed. Claimed entries are this
+// consumer's to handle and ack.
+func (c *EventConsumer) ClaimStale(ctx context.Context, minIdle time.Duration) ([]StreamEvent, error) {
+	msgs, _, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    c.Count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]StreamEvent, 0, len(msgs))
+	deliveries := make(map[string]int64)
+	if len(msgs) > 0 {
+		// XAUTOCLAIM does not report delivery counts; XPENDING over the claimed range does
+		pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Start:    msgs[0].ID,
+			End:      msgs[len(msgs)-1].ID,
+			Count:    int64(len(msgs)),
+			Consumer: c.consumer,
+		}).Result()
+		if err == nil {
+			for _, p := range pending {
+				deliveries[p.ID] = p.RetryCount
+			}
+		}
+	}
+	for _, msg := range msgs {
+		ev := decodeStreamEvent(msg)
+		ev.Deliveries = deliveries[msg.ID]
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// decodeStreamEvent reads an entry's fields; Order or Fill stay nil when the
+// schema version is unknown or the data does not decode
+func decodeStreamEvent(msg redis.XMessage) StreamEvent {
+	field := func(name string) string {
+		value, _ := msg.Values[name].(string)
+		return value
+	}
+	ev := StreamEvent{
+		ID:      msg.ID,
+		Type:    field("type"),
+		OrderID: field("order_id"),
+		Source:  field("source"),
+		Data:    json.RawMessage(field("data")),
+	}
+	ev.SchemaVersion, _ = strconv.Atoi(field("schema_version"))
+	if ev.SchemaVersion != EventSchemaVersion {
+		return ev
+	}
+
+	if ev.Type == "fill" {
+		var fill Fill
+		if json.Unmarshal(ev.Data, &fill) == nil {
+			ev.Fill = &fill
+		}
+		return ev
+	}
+	var order struct {
+		Type            string    `json:"type"`
+		OrderID         string    `json:"order_id"`
+		ExchangeOrderID string    `json:"exchange_order_id"`
+		StrategyName    string    `json:"strategy_name"`
+		Symbol          string    `json:"symbol"`
+		Side            string    `json:"side"`
+		Exchange        string    `json:"exchange"`
+		Status          string    `json:"status"`
+		FilledQuantity  float64   `json:"filled_quantity"`
+		Price           float64   `json:"price"`
+		Fees            float64   `json:"fees"`
+		Error           string    `json:"error"`
+		Timestamp       time.Time `json:"timestamp"`
+	}
+	if json.Unmarshal(ev.Data, &order) == nil {
+		if order.FilledQuantity == 0 {
+			order.Price = 0 // the order's limit price until something fills
+		}
+		ev.Order = &OrderUpdate{
+			Type:            order.Type,
+			OrderID:         order.OrderID,
+			ExchangeOrderID: order.ExchangeOrderID,
+			StrategyName:    order.StrategyName,
+			Symbol:          order.Symbol,
+			Side:            order.Side,
+			Exchange:        order.Exchange,
+			Status:          order.Status,
+			FilledQuantity:  order.FilledQuantity,
+			AveragePrice:    order.Price,
+			Fees:            order.Fees,
+			Error:           order.Error,
+			Timestamp:       order.Timestamp,
+		}
+	}
+	return ev
+}
@@ -0,0 +1,109 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"execution-engine/pkg/client"
+)
+
+// stubEngine answers order submissions the way the engine does: a fill for known
+// exchanges, a 400 reject for others and a 404 for unknown orders on cancel
+func stubEngine() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		var order client.OrderRequest
+		json.NewDecoder(r.Body).Decode(&order)
+		w.Header().Set("Content-Type", "application/json")
+		if order.Exchange == "kraken" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false, "error": "Exchange kraken not configured", "reject_reason": client.RejectExchangeNotConfigured,
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true, "order_id": order.OrderID, "exchange_order_id": "123", "status": "FILLED",
+			"executed_price": 30000, "executed_quantity": order.Quantity,
+		})
+	})
+	mux.HandleFunc("/api/v1/orders/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "Order nope not found; pass symbol and exchange to cancel it"})
+	})
+	return httptest.NewServer(mux)
+}
+
+func ExampleNewREST() {
+	engine := stubEngine()
+	defer engine.Close()
+
+	c := client.NewREST(engine.URL, client.WithAPIKey("key", ""))
+	defer c.Close()
+
+	ctx := context.Background()
+	result, err := c.SubmitOrder(ctx, &client.OrderRequest{
+		OrderID: "momentum-42", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 0.01,
+	})
+	if err != nil {
+		log.Fatal(err) // transport, auth or server failure
+	}
+	fmt.Println(result.Success, result.Status, result.ExecutedPrice)
+
+	// An order the engine refused is an answer, not an error
+	result, err = c.SubmitOrder(ctx, &client.OrderRequest{
+		OrderID: "momentum-43", StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 0.01, Exchange: "kraken",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(result.Success, result.RejectReason)
+	// Output:
+	// true FILLED 30000
+	// false exchange_not_configured
+}
+
+func ExampleNewGRPC() {
+	c, err := client.NewGRPC("localhost:50050", client.WithBearerToken(os.Getenv("EXECUTION_TOKEN")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	updates, err := c.StreamOrderUpdates(ctx, client.OrderUpdateFilter{StrategyName: "momentum"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer updates.Close()
+	for {
+		update, err := updates.Recv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s %s %s", update.OrderID, update.Type, update.Status)
+	}
+}
+
+func ExampleStatusCode() {
+	engine := stubEngine()
+	defer engine.Close()
+
+	c := client.NewREST(engine.URL)
+	err := c.CancelOrder(context.Background(), &client.CancelRequest{OrderID: "nope"})
+	switch client.StatusCode(err) {
+	case 0:
+		fmt.Println("cancelled, or no answer:", err)
+	case http.StatusNotFound:
+		fmt.Println("not found")
+	default:
+		fmt.Println("failed:", err)
+	}
+	// Output: not found
+}
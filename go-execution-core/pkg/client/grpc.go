@@ -0,0 +1,415 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCClient implements Client over the ExecutionService gRPC API
+type GRPCClient struct {
+	conn *grpc.ClientConn
+	rpc  pb.ExecutionServiceClient
+	opts *options
+}
+
+var _ Client = (*GRPCClient)(nil)
+
+// NewGRPC returns a client for the gRPC server at target, e.g. localhost:50050.
+// The connection is made lazily, on the first call.
+func NewGRPC(target string, opts ...Option) (*GRPCClient, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	dialOptions := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, o.dialOptions...)
+	conn, err := grpc.Dial(target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn, rpc: pb.NewExecutionServiceClient(conn), opts: o}, nil
+}
+
+// Close closes the connection
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// outgoing adds the credentials to ctx as metadata
+func (c *GRPCClient) outgoing(ctx context.Context) context.Context {
+	if c.opts.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.opts.token)
+	}
+	if c.opts.apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", c.opts.apiKey)
+	}
+	return ctx
+}
+
+// call runs a unary RPC with the credentials, retrying server errors
+func (c *GRPCClient) call(ctx context.Context, rpc func(ctx context.Context) error) error {
+	return grpcError(ctx, c.callStatus(ctx, rpc))
+}
+
+// callStatus is call leaving the error as the gRPC status
+func (c *GRPCClient) callStatus(ctx context.Context, rpc func(ctx context.Context) error) error {
+	callCtx := c.outgoing(ctx)
+	return c.opts.retry(ctx, func() (bool, error) {
+		err := rpc(callCtx)
+		return err != nil && retryableStatus(grpcHTTPStatus(status.Code(err))), err
+	})
+}
+
+// grpcError converts a failed call's status to an Error, leaving the caller's
+// own cancellation as it is
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return &Error{StatusCode: grpcHTTPStatus(st.Code()), Message: st.Message()}
+}
+
+// grpcHTTPStatus maps a gRPC code to an HTTP status as grpc-gateway (and the
+// engine's REST endpoints served by gRPC methods) do
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// retryableStatus reports whether a call answered with status is worth retrying
+func retryableStatus(status int) bool {
+	return status >= 500 && status != http.StatusNotImplemented
+}
+
+// SubmitOrder calls SubmitOrder with idempotency-key metadata. A key reused for
+// a different order fails with 422, as over REST.
+func (c *GRPCClient) SubmitOrder(ctx context.Context, req *OrderRequest) (*OrderResult, error) {
+	keyCtx := metadata.AppendToOutgoingContext(ctx, "idempotency-key", idempotencyKey(req))
+	var resp *pb.OrderResponse
+	err := c.callStatus(keyCtx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.SubmitOrder(ctx, &pb.OrderRequest{
+			OrderId:        req.OrderID,
+			StrategyName:   req.StrategyName,
+			Symbol:         req.Symbol,
+			Side:           req.Side,
+			Quantity:       req.Quantity,
+			Price:          req.Price,
+			OrderType:      req.OrderType,
+			Exchange:       req.Exchange,
+			Account:        req.Account,
+			ReduceOnly:     req.ReduceOnly,
+			PositionSide:   req.PositionSide,
+			AccountType:    req.AccountType,
+			SideEffectType: req.SideEffectType,
+		})
+		return err
+	})
+	if status.Code(err) == codes.AlreadyExists && ctx.Err() == nil {
+		return nil, &Error{StatusCode: http.StatusUnprocessableEntity, Message: status.Convert(err).Message()}
+	}
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	result := &OrderResult{
+		Success:          resp.Success,
+		OrderID:          resp.OrderId,
+		ExchangeOrderID:  resp.ExchangeOrderId,
+		Status:           resp.Status,
+		ExecutedPrice:    resp.ExecutedPrice,
+		ExecutedQuantity: resp.ExecutedQuantity,
+		Fees:             resp.Fees,
+		Error:            resp.ErrorMessage,
+		RejectReason:     resp.RejectReason,
+		Replayed:         resp.Replayed,
+	}
+	if resp.ExecutedAt != nil {
+		result.ExecutedAt = resp.ExecutedAt.AsTime()
+	}
+	for _, fe := range resp.FieldErrors {
+		result.FieldErrors = append(result.FieldErrors, FieldError{Field: fe.Field, Message: fe.Message})
+	}
+	return result, nil
+}
+
+// CancelOrder calls CancelOrder
+func (c *GRPCClient) CancelOrder(ctx context.Context, req *CancelRequest) error {
+	exchange := req.Exchange
+	if exchange != "" && req.Account != "" {
+		exchange += ":" + req.Account
+	}
+	return c.call(ctx, func(ctx context.Context) error {
+		_, err := c.rpc.CancelOrder(ctx, &pb.CancelOrderRequest{
+			OrderId:  req.OrderID,
+			Symbol:   req.Symbol,
+			Exchange: exchange,
+		})
+		return err
+	})
+}
+
+// GetMarketData calls GetMarketData
+func (c *GRPCClient) GetMarketData(ctx context.Context, exchange, symbol string) (*MarketData, error) {
+	var resp *pb.MarketDataResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.GetMarketData(ctx, &pb.MarketDataRequest{Symbol: symbol, Exchange: exchange})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MarketData{
+		Symbol:         resp.Symbol,
+		Exchange:       resp.Exchange,
+		Price:          resp.Price,
+		Bid:            resp.Bid,
+		Ask:            resp.Ask,
+		Volume24h:      resp.Volume_24H,
+		High24h:        resp.High_24H,
+		Low24h:         resp.Low_24H,
+		PriceChange24h: resp.PriceChange_24H,
+		Timestamp:      resp.Timestamp.AsTime(),
+	}, nil
+}
+
+// GetBalance calls GetBalance
+func (c *GRPCClient) GetBalance(ctx context.Context, req *BalanceRequest) (*Balance, error) {
+	var resp *pb.BalanceResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.GetBalance(ctx, &pb.BalanceRequest{
+			Exchange:    req.Exchange,
+			Assets:      req.Assets,
+			MinValueUsd: req.MinValueUSD,
+			Account:     req.Account,
+			Force:       req.Force,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &Balance{
+		Exchange:       resp.Exchange,
+		Accounts:       resp.Accounts,
+		Balances:       make(map[string]AssetBalance, len(resp.Balances)),
+		TotalValueUSD:  resp.TotalValueUsd,
+		UnpricedAssets: resp.UnpricedAssets,
+		MarginLevel:    resp.MarginLevel,
+		Cached:         resp.Cached,
+		Timestamp:      resp.Timestamp.AsTime(),
+	}
+	for asset, bal := range resp.Balances {
+		balance.Balances[asset] = AssetBalance{
+			Asset:    bal.Asset,
+			Free:     bal.Free,
+			Locked:   bal.Locked,
+			Total:    bal.Total,
+			ValueUSD: bal.ValueUsd,
+			Borrowed: bal.Borrowed,
+			Interest: bal.Interest,
+		}
+	}
+	return balance, nil
+}
+
+// ListOrders calls ListOrders
+func (c *GRPCClient) ListOrders(ctx context.Context, req *ListOrdersRequest) (*OrderPage, error) {
+	listReq := &pb.ListOrdersRequest{
+		StrategyName: req.StrategyName,
+		Symbol:       req.Symbol,
+		Side:         req.Side,
+		Status:       req.Status,
+		Exchange:     req.Exchange,
+		Limit:        int32(req.Limit),
+		Cursor:       req.Cursor,
+	}
+	if !req.From.IsZero() {
+		listReq.From = timestamppb.New(req.From)
+	}
+	if !req.To.IsZero() {
+		listReq.To = timestamppb.New(req.To)
+	}
+
+	var resp *pb.ListOrdersResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.ListOrders(ctx, listReq)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: make([]Order, len(resp.Orders)), NextCursor: resp.NextCursor}
+	for i, order := range resp.Orders {
+		page.Orders[i] = Order{
+			OrderID:         order.OrderId,
+			ExchangeOrderID: order.ExchangeOrderId,
+			StrategyName:    order.StrategyName,
+			Symbol:          order.Symbol,
+			Side:            order.Side,
+			Quantity:        order.Quantity,
+			Price:           order.Price,
+			Status:          order.Status,
+			FilledQuantity:  order.FilledQuantity,
+			AveragePrice:    order.AveragePrice,
+			Fees:            order.Fees,
+			Exchange:        order.Exchange,
+			AccountType:     order.AccountType,
+			OrderType:       order.OrderType,
+			Timestamp:       order.Timestamp.AsTime(),
+			UpdatedAt:       order.UpdatedAt.AsTime(),
+		}
+		if order.ExecutedAt != nil {
+			page.Orders[i].ExecutedAt = order.ExecutedAt.AsTime()
+		}
+	}
+	return page, nil
+}
+
+// GetPositions calls GetPositions
+func (c *GRPCClient) GetPositions(ctx context.Context, req *PositionsRequest) (*Positions, error) {
+	positionsReq := &pb.PositionsRequest{
+		StrategyName: req.StrategyName,
+		Symbol:       req.Symbol,
+		Exchange:     req.Exchange,
+		Account:      req.Account,
+	}
+	if req.IncludeClosed {
+		positionsReq.IncludeClosed = true
+		positionsReq.ClosedWithinSeconds = int64(req.ClosedWithin.Seconds())
+	}
+
+	var resp *pb.PositionsResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.rpc.GetPositions(ctx, positionsReq)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	positions := &Positions{
+		Positions:          make([]Position, len(resp.Positions)),
+		TotalUnrealizedPnL: resp.TotalUnrealizedPnl,
+		TotalRealizedPnL:   resp.TotalRealizedPnl,
+		TotalPnL:           resp.TotalPnl,
+		TotalMarketValue:   resp.TotalMarketValue,
+	}
+	for i, position := range resp.Positions {
+		positions.Positions[i] = Position{
+			Symbol:            position.Symbol,
+			Account:           position.Account,
+			StrategyName:      position.StrategyName,
+			Quantity:          position.Quantity,
+			AverageEntryPrice: position.AverageEntryPrice,
+			CurrentPrice:      position.CurrentPrice,
+			MarketValue:       position.MarketValue,
+			UnrealizedPnL:     position.UnrealizedPnl,
+			RealizedPnL:       position.RealizedPnl,
+			OpenedAt:          position.OpenedAt.AsTime(),
+			LastUpdated:       position.LastUpdated.AsTime(),
+			Closed:            position.Closed,
+		}
+	}
+	return positions, nil
+}
+
+// StreamOrderUpdates opens a StreamOrderUpdates stream
+func (c *GRPCClient) StreamOrderUpdates(ctx context.Context, filter OrderUpdateFilter) (OrderUpdateStream, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := c.rpc.StreamOrderUpdates(c.outgoing(streamCtx), &pb.OrderUpdatesRequest{
+		StrategyName: filter.StrategyName,
+		Symbol:       filter.Symbol,
+	})
+	if err != nil {
+		cancel()
+		return nil, grpcError(ctx, err)
+	}
+	return &grpcOrderStream{ctx: ctx, stream: stream, cancel: cancel}, nil
+}
+
+type grpcOrderStream struct {
+	ctx    context.Context
+	stream pb.ExecutionService_StreamOrderUpdatesClient
+	cancel context.CancelFunc
+	err    error
+}
+
+func (s *grpcOrderStream) Recv() (*OrderUpdate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	update, err := s.stream.Recv()
+	if err != nil {
+		if err != io.EOF {
+			err = grpcError(s.ctx, err)
+		}
+		s.err = err
+		return nil, err
+	}
+
+	return &OrderUpdate{
+		Type:            update.EventType,
+		OrderID:         update.OrderId,
+		ExchangeOrderID: update.ExchangeOrderId,
+		StrategyName:    update.StrategyName,
+		Symbol:          update.Symbol,
+		Side:            update.Side,
+		Exchange:        update.Exchange,
+		Status:          update.Status,
+		FilledQuantity:  update.FilledQuantity,
+		AveragePrice:    update.AveragePrice,
+		Fees:            update.Fees,
+		Error:           update.Error,
+		Timestamp:       update.Timestamp.AsTime(),
+	}, nil
+}
+
+func (s *grpcOrderStream) Close() error {
+	s.cancel()
+	return nil
+}
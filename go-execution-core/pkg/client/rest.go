@@ -0,0 +1,571 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RESTClient implements Client over the REST API
+type RESTClient struct {
+	baseURL string
+	opts    *options
+}
+
+var _ Client = (*RESTClient)(nil)
+
+// NewREST returns a client for the REST API at baseURL, e.g. http://localhost:8080
+func NewREST(baseURL string, opts ...Option) *RESTClient {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &RESTClient{baseURL: strings.TrimRight(baseURL, "/"), opts: o}
+}
+
+// Close releases nothing; it is there to satisfy Client
+func (c *RESTClient) Close() error {
+	return nil
+}
+
+// restResponse is the answer to the last attempt of a request
+type restResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request with the credentials, retrying transport failures and the
+// answers retryable accepts (nil retries server errors)
+func (c *RESTClient) do(ctx context.Context, method, path string, query url.Values, body interface{},
+	header http.Header, retryable func(*restResponse) bool) (*restResponse, error) {
+	reqURL := c.baseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	if retryable == nil {
+		retryable = func(resp *restResponse) bool { return retryableStatus(resp.status) }
+	}
+
+	var resp *restResponse
+	err := c.opts.retry(ctx, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, bytes.NewReader(payload))
+		if err != nil {
+			return false, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		c.authorize(req.Header, method, req.URL.RequestURI(), payload)
+
+		httpResp, err := c.opts.httpClient.Do(req)
+		if err != nil {
+			return true, err
+		}
+		defer httpResp.Body.Close()
+		data, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return true, err
+		}
+		resp = &restResponse{status: httpResp.StatusCode, header: httpResp.Header, body: data}
+		if retryable(resp) {
+			return true, restError(resp)
+		}
+		return false, nil
+	})
+	if err != nil && resp == nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// authorize adds the credentials, signing state-changing requests for signed keys
+func (c *RESTClient) authorize(header http.Header, method, requestURI string, body []byte) {
+	if c.opts.token != "" {
+		header.Set("Authorization", "Bearer "+c.opts.token)
+	}
+	if c.opts.apiKey == "" {
+		return
+	}
+	header.Set("X-API-Key", c.opts.apiKey)
+	if c.opts.apiSecret == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(c.opts.apiSecret))
+	mac.Write([]byte(timestamp + method + requestURI))
+	mac.Write(body)
+	header.Set("X-Timestamp", timestamp)
+	header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// get sends a GET and decodes a 200 answer into out
+func (c *RESTClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.status != http.StatusOK {
+		return restError(resp)
+	}
+	if err := json.Unmarshal(resp.body, out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// restError reads {"error": "..."} from a failed answer, or its text
+func restError(resp *restResponse) *Error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(resp.body))
+	if json.Unmarshal(resp.body, &body) == nil && body.Error != "" {
+		message = body.Error
+	}
+	return &Error{StatusCode: resp.status, Message: message}
+}
+
+// restOrderResponse is the POST /api/v1/orders body
+type restOrderResponse struct {
+	Success          bool         `json:"success"`
+	OrderID          string       `json:"order_id"`
+	ExchangeOrderID  string       `json:"exchange_order_id"`
+	Status           string       `json:"status"`
+	ExecutedPrice    float64      `json:"executed_price"`
+	ExecutedQuantity float64      `json:"executed_quantity"`
+	Fees             float64      `json:"fees"`
+	Error            string       `json:"error"`
+	RejectReason     string       `json:"reject_reason"`
+	Errors           []FieldError `json:"errors"`
+}
+
+// SubmitOrder posts to /api/v1/orders with an Idempotency-Key header. Rejections
+// come back as 422 (validation), 400 or 503 with an order body; a 503 for an
+// unavailable exchange is such an answer, not a server error, so it is not retried.
+func (c *RESTClient) SubmitOrder(ctx context.Context, req *OrderRequest) (*OrderResult, error) {
+	header := http.Header{"Idempotency-Key": {idempotencyKey(req)}}
+	decode := func(resp *restResponse) (*restOrderResponse, bool) {
+		var body restOrderResponse
+		if json.Unmarshal(resp.body, &body) != nil {
+			return nil, false
+		}
+		switch {
+		case resp.status == http.StatusOK:
+		case resp.status == http.StatusUnprocessableEntity && len(body.Errors) > 0:
+			body.RejectReason = RejectValidation
+		case body.RejectReason == "":
+			return nil, false
+		}
+		return &body, true
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/v1/orders", nil, req, header, func(resp *restResponse) bool {
+		_, answered := decode(resp)
+		return retryableStatus(resp.status) && !answered
+	})
+	if err != nil {
+		return nil, err
+	}
+	body, answered := decode(resp)
+	if !answered {
+		return nil, restError(resp)
+	}
+
+	result := &OrderResult{
+		Success:          body.Success,
+		OrderID:          body.OrderID,
+		ExchangeOrderID:  body.ExchangeOrderID,
+		Status:           body.Status,
+		ExecutedPrice:    body.ExecutedPrice,
+		ExecutedQuantity: body.ExecutedQuantity,
+		Fees:             body.Fees,
+		Error:            body.Error,
+		RejectReason:     body.RejectReason,
+		FieldErrors:      body.Errors,
+		Replayed:         resp.header.Get("Idempotent-Replayed") == "true",
+	}
+	if !result.Success {
+		result.OrderID, result.Status = req.OrderID, "FAILED"
+		if result.RejectReason != "" {
+			result.Status = "REJECTED"
+		}
+	}
+	return result, nil
+}
+
+// CancelOrder sends DELETE /api/v1/orders/{id}
+func (c *RESTClient) CancelOrder(ctx context.Context, req *CancelRequest) error {
+	query := url.Values{}
+	for name, value := range map[string]string{"symbol": req.Symbol, "exchange": req.Exchange, "account": req.Account} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	resp, err := c.do(ctx, http.MethodDelete, "/api/v1/orders/"+url.PathEscape(req.OrderID), query, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.status != http.StatusOK {
+		return restError(resp)
+	}
+	return nil
+}
+
+// GetMarketData reads /api/v1/market/{exchange}/{symbol}
+func (c *RESTClient) GetMarketData(ctx context.Context, exchange, symbol string) (*MarketData, error) {
+	if exchange == "" {
+		exchange = "binance"
+	}
+	var body struct {
+		Symbol         string    `json:"symbol"`
+		Exchange       string    `json:"exchange"`
+		Price          float64   `json:"price"`
+		Bid            float64   `json:"bid"`
+		Ask            float64   `json:"ask"`
+		Volume24h      float64   `json:"volume_24h"`
+		High24h        float64   `json:"high_24h"`
+		Low24h         float64   `json:"low_24h"`
+		PriceChange24h float64   `json:"price_change_24h"`
+		Timestamp      time.Time `json:"timestamp"`
+	}
+	path := "/api/v1/market/" + url.PathEscape(exchange) + "/" + url.PathEscape(symbol)
+	if err := c.get(ctx, path, nil, &body); err != nil {
+		return nil, err
+	}
+	data := MarketData(body)
+	return &data, nil
+}
+
+// GetBalance reads /api/v1/balance/{exchange}
+func (c *RESTClient) GetBalance(ctx context.Context, req *BalanceRequest) (*Balance, error) {
+	exchange := req.Exchange
+	if exchange == "" {
+		exchange = "binance"
+	}
+	query := url.Values{}
+	if req.Account != "" {
+		query.Set("account", req.Account)
+	}
+	if len(req.Assets) > 0 {
+		query.Set("assets", strings.Join(req.Assets, ","))
+	}
+	if req.MinValueUSD > 0 {
+		query.Set("min_value_usd", strconv.FormatFloat(req.MinValueUSD, 'f', -1, 64))
+	}
+	if req.Force {
+		query.Set("force", "true")
+	}
+
+	var body struct {
+		Exchange string   `json:"exchange"`
+		Accounts []string `json:"accounts"`
+		Balances map[string]struct {
+			Free     float64 `json:"free"`
+			Locked   float64 `json:"locked"`
+			Total    float64 `json:"total"`
+			ValueUSD float64 `json:"value_usd"`
+			Borrowed float64 `json:"borrowed"`
+			Interest float64 `json:"interest"`
+		} `json:"balances"`
+		TotalValueUSD  float64   `json:"total_value_usd"`
+		UnpricedAssets []string  `json:"unpriced_assets"`
+		MarginLevel    float64   `json:"margin_level"`
+		Cached         bool      `json:"cached"`
+		FetchedAt      time.Time `json:"fetched_at"`
+	}
+	if err := c.get(ctx, "/api/v1/balance/"+url.PathEscape(exchange), query, &body); err != nil {
+		return nil, err
+	}
+
+	balance := &Balance{
+		Exchange:       body.Exchange,
+		Accounts:       body.Accounts,
+		Balances:       make(map[string]AssetBalance, len(body.Balances)),
+		TotalValueUSD:  body.TotalValueUSD,
+		UnpricedAssets: body.UnpricedAssets,
+		MarginLevel:    body.MarginLevel,
+		Cached:         body.Cached,
+		Timestamp:      body.FetchedAt,
+	}
+	for asset, bal := range body.Balances {
+		balance.Balances[asset] = AssetBalance{
+			Asset:    asset,
+			Free:     bal.Free,
+			Locked:   bal.Locked,
+			Total:    bal.Total,
+			ValueUSD: bal.ValueUSD,
+			Borrowed: bal.Borrowed,
+			Interest: bal.Interest,
+		}
+	}
+	return balance, nil
+}
+
+// ListOrders reads a page of /api/v1/orders
+func (c *RESTClient) ListOrders(ctx context.Context, req *ListOrdersRequest) (*OrderPage, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"strategy_name": req.StrategyName,
+		"symbol":        req.Symbol,
+		"side":          req.Side,
+		"status":        req.Status,
+		"exchange":      req.Exchange,
+		"cursor":        req.Cursor,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if !req.From.IsZero() {
+		query.Set("from", req.From.Format(time.RFC3339))
+	}
+	if !req.To.IsZero() {
+		query.Set("to", req.To.Format(time.RFC3339))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+
+	var body struct {
+		Orders []struct {
+			OrderID       string    `json:"order_id"`
+			StrategyName  string    `json:"strategy_name"`
+			Symbol        string    `json:"symbol"`
+			Side          string    `json:"side"`
+			Quantity      float64   `json:"quantity"`
+			Price         float64   `json:"price"`
+			ExecutedPrice float64   `json:"executed_price"`
+			Status        string    `json:"status"`
+			Exchange      string    `json:"exchange"`
+			Timestamp     time.Time `json:"timestamp"`
+		} `json:"orders"`
+		NextCursor string `json:"next_cursor"`
+	}
+	if err := c.get(ctx, "/api/v1/orders", query, &body); err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: make([]Order, len(body.Orders)), NextCursor: body.NextCursor}
+	for i, order := range body.Orders {
+		page.Orders[i] = Order{
+			OrderID:      order.OrderID,
+			StrategyName: order.StrategyName,
+			Symbol:       order.Symbol,
+			Side:         order.Side,
+			Quantity:     order.Quantity,
+			Price:        order.Price,
+			Status:       order.Status,
+			AveragePrice: order.ExecutedPrice,
+			Exchange:     order.Exchange,
+			Timestamp:    order.Timestamp,
+		}
+	}
+	return page, nil
+}
+
+// GetPositions reads /api/v1/portfolio/positions
+func (c *RESTClient) GetPositions(ctx context.Context, req *PositionsRequest) (*Positions, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"strategy_name": req.StrategyName,
+		"symbol":        req.Symbol,
+		"exchange":      req.Exchange,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if req.Account != nil {
+		query.Set("account", *req.Account)
+	}
+	if req.IncludeClosed {
+		query.Set("include_closed", "true")
+		if req.ClosedWithin > 0 {
+			query.Set("closed_within", req.ClosedWithin.String())
+		}
+	}
+
+	var body struct {
+		Positions []struct {
+			Symbol            string    `json:"symbol"`
+			Account           string    `json:"account"`
+			StrategyName      string    `json:"strategy_name"`
+			Quantity          float64   `json:"quantity"`
+			AverageEntryPrice float64   `json:"average_entry_price"`
+			CurrentPrice      *float64  `json:"current_price"`
+			MarketValue       *float64  `json:"market_value"`
+			UnrealizedPnL     *float64  `json:"unrealized_pnl"`
+			RealizedPnL       *float64  `json:"realized_pnl"`
+			OpenedAt          time.Time `json:"opened_at"`
+			LastUpdated       time.Time `json:"last_updated"`
+			Closed            bool      `json:"closed"`
+		} `json:"positions"`
+		TotalUnrealizedPnL float64 `json:"total_unrealized_pnl"`
+		TotalRealizedPnL   float64 `json:"total_realized_pnl"`
+		TotalPnL           float64 `json:"total_pnl"`
+		TotalMarketValue   float64 `json:"total_market_value"`
+	}
+	if err := c.get(ctx, "/api/v1/portfolio/positions", query, &body); err != nil {
+		return nil, err
+	}
+
+	positions := &Positions{
+		Positions:          make([]Position, len(body.Positions)),
+		TotalUnrealizedPnL: body.TotalUnrealizedPnL,
+		TotalRealizedPnL:   body.TotalRealizedPnL,
+		TotalPnL:           body.TotalPnL,
+		TotalMarketValue:   body.TotalMarketValue,
+	}
+	for i, position := range body.Positions {
+		positions.Positions[i] = Position(position)
+	}
+	return positions, nil
+}
+
+// StreamOrderUpdates opens the /api/v1/ws/orders websocket
+func (c *RESTClient) StreamOrderUpdates(ctx context.Context, filter OrderUpdateFilter) (OrderUpdateStream, error) {
+	wsURL := c.baseURL + "/api/v1/ws/orders"
+	if strings.HasPrefix(wsURL, "http") {
+		wsURL = "ws" + strings.TrimPrefix(wsURL, "http")
+	}
+	query := url.Values{}
+	if filter.StrategyName != "" {
+		query.Set("strategy_name", filter.StrategyName)
+	}
+	if filter.Symbol != "" {
+		query.Set("symbol", filter.Symbol)
+	}
+	if len(query) > 0 {
+		wsURL += "?" + query.Encode()
+	}
+	header := http.Header{}
+	c.authorize(header, http.MethodGet, "", nil)
+
+	var conn *websocket.Conn
+	err := c.opts.retry(ctx, func() (bool, error) {
+		var resp *http.Response
+		var err error
+		conn, resp, err = websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+		if err == nil {
+			return false, nil
+		}
+		if resp == nil {
+			return true, err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		failed := &restResponse{status: resp.StatusCode, header: resp.Header, body: data}
+		return retryableStatus(failed.status), restError(failed)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &restOrderStream{ctx: ctx, conn: conn}
+	stream.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	return stream, nil
+}
+
+// restOrderStream reads OrderEvents off the order websocket
+type restOrderStream struct {
+	ctx  context.Context
+	conn *websocket.Conn
+	stop func() bool
+	err  error
+}
+
+func (s *restOrderStream) Recv() (*OrderUpdate, error) {
+	for s.err == nil {
+		var event struct {
+			Type            string    `json:"type"`
+			OrderID         string    `json:"order_id"`
+			ExchangeOrderID string    `json:"exchange_order_id"`
+			StrategyName    string    `json:"strategy_name"`
+			Symbol          string    `json:"symbol"`
+			Side            string    `json:"side"`
+			Exchange        string    `json:"exchange"`
+			Status          string    `json:"status"`
+			FilledQuantity  float64   `json:"filled_quantity"`
+			Price           float64   `json:"price"`
+			Fees            float64   `json:"fees"`
+			Error           string    `json:"error"`
+			Timestamp       time.Time `json:"timestamp"`
+		}
+		if err := s.conn.ReadJSON(&event); err != nil {
+			s.err = s.streamError(err)
+			break
+		}
+		if event.OrderID == "" {
+			continue // the subscription acknowledgement
+		}
+
+		update := &OrderUpdate{
+			Type:            event.Type,
+			OrderID:         event.OrderID,
+			ExchangeOrderID: event.ExchangeOrderID,
+			StrategyName:    event.StrategyName,
+			Symbol:          event.Symbol,
+			Side:            event.Side,
+			Exchange:        event.Exchange,
+			Status:          event.Status,
+			FilledQuantity:  event.FilledQuantity,
+			Fees:            event.Fees,
+			Error:           event.Error,
+			Timestamp:       event.Timestamp,
+		}
+		// Before any fill the event carries the limit price, not an average
+		if event.FilledQuantity > 0 {
+			update.AveragePrice = event.Price
+		}
+		return update, nil
+	}
+	return nil, s.err
+}
+
+// streamError explains why the websocket ended: the caller's context, io.EOF for
+// a normal close, or 429 like gRPC's RESOURCE_EXHAUSTED when the server dropped a
+// reader that fell behind
+func (s *restOrderStream) streamError(err error) error {
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseNormalClosure, websocket.CloseGoingAway:
+			return io.EOF
+		case websocket.ClosePolicyViolation:
+			return &Error{StatusCode: http.StatusTooManyRequests, Message: closeErr.Text}
+		}
+	}
+	return err
+}
+
+func (s *restOrderStream) Close() error {
+	s.stop()
+	return s.conn.Close()
+}
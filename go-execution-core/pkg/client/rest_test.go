@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyEngine fails the first failures order submissions with status, then fills
+// them, recording the Idempotency-Key of every attempt
+type flakyEngine struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	body     map[string]interface{}
+	keys     []string
+}
+
+func (e *flakyEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys = append(e.keys, r.Header.Get("Idempotency-Key"))
+	w.Header().Set("Content-Type", "application/json")
+	if len(e.keys) <= e.failures {
+		w.WriteHeader(e.status)
+		json.NewEncoder(w).Encode(e.body)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "order_id": "ord-1", "status": "FILLED"})
+}
+
+func TestRESTSubmitOrderRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		engine   *flakyEngine
+		attempts int
+		success  bool
+		status   int
+	}{
+		{"server error is retried", &flakyEngine{failures: 2, status: http.StatusBadGateway}, 3, true, 0},
+		{"retries run out", &flakyEngine{failures: 5, status: http.StatusInternalServerError}, 4, false, http.StatusInternalServerError},
+		{"client error is not retried", &flakyEngine{failures: 1, status: http.StatusUnauthorized, body: map[string]interface{}{"error": "unauthorized"}}, 1, false, http.StatusUnauthorized},
+		{"unavailable exchange is an answer", &flakyEngine{failures: 1, status: http.StatusServiceUnavailable, body: map[string]interface{}{
+			"success": false, "error": "exchange down", "reject_reason": RejectExchangeUnavailable,
+		}}, 1, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.engine)
+			defer srv.Close()
+			c := NewREST(srv.URL, WithRetries(3, time.Millisecond))
+
+			result, err := c.SubmitOrder(context.Background(), &OrderRequest{OrderID: "ord-1", Symbol: "BTCUSDT", Side: "BUY", Quantity: 1})
+			if got := StatusCode(err); got != tt.status {
+				t.Errorf("status %d, want %d (err %v)", got, tt.status, err)
+			}
+			if tt.success && (err != nil || !result.Success) {
+				t.Errorf("result = %+v, err %v", result, err)
+			}
+			if len(tt.engine.keys) != tt.attempts {
+				t.Errorf("%d attempts, want %d", len(tt.engine.keys), tt.attempts)
+			}
+			for _, key := range tt.engine.keys {
+				if key != "ord-1" {
+					t.Errorf("attempt sent Idempotency-Key %q, want the order ID", key)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	if got := idempotencyKey(&OrderRequest{OrderID: "ord-1", IdempotencyKey: "key"}); got != "key" {
+		t.Errorf("explicit key: %q", got)
+	}
+	if got := idempotencyKey(&OrderRequest{OrderID: "ord-1"}); got != "ord-1" {
+		t.Errorf("order ID: %q", got)
+	}
+	a, b := idempotencyKey(&OrderRequest{}), idempotencyKey(&OrderRequest{})
+	if len(a) != 32 || a == b {
+		t.Errorf("random keys %q and %q", a, b)
+	}
+}
@@ -0,0 +1,40 @@
+package position
+
+// LotMatch is what a fill does to a list of open lots, oldest first
+type LotMatch struct {
+	Closed    int     // leading lots the fill closed entirely
+	Reduced   bool    // whether the lot after them was partly closed
+	Remaining float64 // that lot's quantity afterwards, when Reduced
+	Opened    *Lot    // lot the fill opened past any reduction, nil if none
+	Realized  float64 // PnL realized against the lots, net of the fill's fee share
+	ClosedQty float64 // quantity of the lots the fill closed
+}
+
+// MatchLots applies fill to open FIFO lots, all on one side, and reports which
+// lots it closed. A fill larger than the lots closes them all and opens the
+// remainder as a lot on the other side.
+func MatchLots(open []Lot, fill Fill) (LotMatch, error) {
+	var quantity float64
+	for _, lot := range open {
+		quantity += lot.Quantity
+	}
+	res, err := Apply(Position{Quantity: quantity, AvgEntryPrice: lotsAverage(open), Lots: open}, fill, FIFO)
+	if err != nil {
+		return LotMatch{}, err
+	}
+
+	m := LotMatch{Realized: res.Realized, ClosedQty: res.Closed}
+	kept := res.Position.Lots
+	if res.Opened > 0 {
+		opened := kept[len(kept)-1]
+		m.Opened = &opened
+		kept = kept[:len(kept)-1]
+	}
+	// Apply only takes lots off the front, so the kept lots are the tail of open
+	m.Closed = len(open) - len(kept)
+	if len(kept) > 0 && kept[0].Quantity != open[m.Closed].Quantity {
+		m.Reduced = true
+		m.Remaining = kept[0].Quantity
+	}
+	return m, nil
+}
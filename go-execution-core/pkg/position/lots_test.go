@@ -0,0 +1,166 @@
+package position
+
+import "testing"
+
+func TestMatchLots(t *testing.T) {
+	tests := []struct {
+		name string
+		open []Lot
+		fill Fill
+		want LotMatch
+	}{
+		{
+			name: "first lot, fee in its price",
+			fill: Fill{Side: "BUY", Quantity: 1, Price: 100, Fee: 0.1},
+			want: LotMatch{Opened: &Lot{1, 100.1}},
+		},
+		{
+			name: "add to long",
+			open: []Lot{{1, 100}},
+			fill: Fill{Side: "BUY", Quantity: 1, Price: 110},
+			want: LotMatch{Opened: &Lot{1, 110}},
+		},
+		{
+			name: "add to short, fee lowers the entry",
+			open: []Lot{{-1, 100}},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 90, Fee: 0.1},
+			want: LotMatch{Opened: &Lot{-1, 89.9}},
+		},
+		{
+			name: "part of the oldest lot",
+			open: []Lot{{2, 100}, {1, 110}},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 120},
+			want: LotMatch{Reduced: true, Remaining: 1, Realized: 20, ClosedQty: 1},
+		},
+		{
+			name: "exactly the oldest lot",
+			open: []Lot{{1, 100}, {1, 110}},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 120},
+			want: LotMatch{Closed: 1, Realized: 20, ClosedQty: 1},
+		},
+		{
+			name: "oldest first, not newest",
+			open: []Lot{{1, 100}, {1, 200}},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 150},
+			want: LotMatch{Closed: 1, Realized: 50, ClosedQty: 1},
+		},
+		{
+			name: "across lots into the next, net of the fee",
+			open: []Lot{{1, 100}, {2, 110}},
+			fill: Fill{Side: "SELL", Quantity: 2, Price: 120, Fee: 0.2},
+			want: LotMatch{Closed: 1, Reduced: true, Remaining: 1, Realized: 29.8, ClosedQty: 2},
+		},
+		{
+			name: "every lot exactly",
+			open: []Lot{{1, 100}, {1, 110}},
+			fill: Fill{Side: "SELL", Quantity: 2, Price: 105},
+			want: LotMatch{Closed: 2, ClosedQty: 2},
+		},
+		{
+			name: "flip long to short",
+			open: []Lot{{1, 100}, {1, 110}},
+			fill: Fill{Side: "SELL", Quantity: 3, Price: 105, Fee: 0.3},
+			want: LotMatch{Closed: 2, Opened: &Lot{-1, 104.9}, Realized: -0.2, ClosedQty: 2},
+		},
+		{
+			name: "part of a short lot",
+			open: []Lot{{-2, 100}},
+			fill: Fill{Side: "BUY", Quantity: 1, Price: 90},
+			want: LotMatch{Reduced: true, Remaining: -1, Realized: 10, ClosedQty: 1},
+		},
+		{
+			name: "across short lots",
+			open: []Lot{{-1, 100}, {-1, 90}},
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 95},
+			want: LotMatch{Closed: 2, ClosedQty: 2},
+		},
+		{
+			name: "short lots at a loss",
+			open: []Lot{{-1, 100}, {-2, 90}},
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 110},
+			want: LotMatch{Closed: 1, Reduced: true, Remaining: -1, Realized: -30, ClosedQty: 2},
+		},
+		{
+			name: "flip short to long",
+			open: []Lot{{-1, 100}},
+			fill: Fill{Side: "BUY", Quantity: 3, Price: 95, Fee: 0.3},
+			want: LotMatch{Closed: 1, Opened: &Lot{2, 95.1}, Realized: 4.9, ClosedQty: 1},
+		},
+		{
+			name: "float dust left by the lot counts as closed",
+			open: []Lot{{0.1 + 0.2, 100}},
+			fill: Fill{Side: "SELL", Quantity: 0.3, Price: 100},
+			want: LotMatch{Closed: 1, ClosedQty: 0.3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open := append([]Lot(nil), tt.open...)
+			got, err := MatchLots(tt.open, tt.fill)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Closed != tt.want.Closed || got.Reduced != tt.want.Reduced || !near(got.Remaining, tt.want.Remaining) ||
+				!near(got.Realized, tt.want.Realized) || !near(got.ClosedQty, tt.want.ClosedQty) {
+				t.Errorf("match = %+v, want %+v", got, tt.want)
+			}
+			switch {
+			case (got.Opened == nil) != (tt.want.Opened == nil):
+				t.Errorf("opened %v, want %v", got.Opened, tt.want.Opened)
+			case got.Opened != nil && !lotsNear([]Lot{*got.Opened}, []Lot{*tt.want.Opened}):
+				t.Errorf("opened %+v, want %+v", *got.Opened, *tt.want.Opened)
+			}
+			if !lotsNear(tt.open, open) {
+				t.Errorf("MatchLots modified the lots it was given: %v", tt.open)
+			}
+		})
+	}
+}
+
+// TestMatchLotsAgreesWithApply checks the per-lot view adds up to the position
+// Apply books for the same fills
+func TestMatchLotsAgreesWithApply(t *testing.T) {
+	fills := []Fill{
+		{Side: "BUY", Quantity: 1, Price: 100, Fee: 0.1},
+		{Side: "BUY", Quantity: 2, Price: 110, Fee: 0.2},
+		{Side: "SELL", Quantity: 1.5, Price: 120, Fee: 0.15},
+		{Side: "SELL", Quantity: 3, Price: 90, Fee: 0.3},
+		{Side: "BUY", Quantity: 0.5, Price: 95},
+		{Side: "BUY", Quantity: 2, Price: 85, Fee: 0.2},
+	}
+	var lots []Lot
+	var p Position
+	var realized float64
+	for i, fill := range fills {
+		m, err := MatchLots(lots, fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lots = append([]Lot(nil), lots[m.Closed:]...)
+		if m.Reduced {
+			lots[0].Quantity = m.Remaining
+		}
+		if m.Opened != nil {
+			lots = append(lots, *m.Opened)
+		}
+		realized += m.Realized
+
+		res, err := Apply(p, fill, FIFO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = res.Position
+		if !lotsNear(lots, p.Lots) || !near(realized, p.RealizedPnL) {
+			t.Fatalf("after fill %d: lots %v realized %v, Apply has %v and %v", i, lots, realized, p.Lots, p.RealizedPnL)
+		}
+	}
+}
+
+func TestMatchLotsRejectsBadFill(t *testing.T) {
+	if _, err := MatchLots([]Lot{{1, 100}}, Fill{Side: "SELL", Quantity: 0, Price: 100}); err == nil {
+		t.Error("zero quantity accepted")
+	}
+	if _, err := MatchLots(nil, Fill{Side: "short", Quantity: 1, Price: 100}); err == nil {
+		t.Error("bad side accepted")
+	}
+}
@@ -0,0 +1,186 @@
+// Package position is the arithmetic of applying fills to a position: the
+// signed quantity, the average entry price and the PnL realized by reductions.
+// It knows nothing about storage; the engine loads a Position, applies a Fill
+// and writes the result back.
+//
+// Fees are taken to be in the quote currency. The part of a fill's fee paid for
+// the quantity that opens or adds to a position goes into its cost, raising the
+// entry price of a long and lowering that of a short; the part paid for the
+// quantity that reduces a position comes off the PnL it realizes. Realized PnL is
+// therefore net of fees on both legs.
+package position
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Method decides which entry price a reduction is measured against
+type Method string
+
+const (
+	// WeightedAverage measures reductions against the average entry price of
+	// everything still open
+	WeightedAverage Method = "average"
+	// FIFO measures reductions against the oldest open lots first
+	FIFO Method = "fifo"
+)
+
+// ParseMethod reads a Method, defaulting to WeightedAverage when s is empty
+func ParseMethod(s string) (Method, error) {
+	switch Method(s) {
+	case "", WeightedAverage:
+		return WeightedAverage, nil
+	case FIFO:
+		return FIFO, nil
+	}
+	return "", fmt.Errorf("unknown position accounting method %q (use %s or %s)", s, WeightedAverage, FIFO)
+}
+
+// dust is the quantity below which a position counts as flat, so float rounding
+// in repeated partial fills does not leave a 1e-17 position open
+const dust = 1e-9
+
+// Lot is an open slice of a position and the price, fees included, it was
+// entered at. Quantity has the sign of the position.
+type Lot struct {
+	Quantity float64 `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+// Position is a holding in one symbol
+type Position struct {
+	Quantity      float64 // Negative for shorts
+	AvgEntryPrice float64 // Including opening fees; 0 when flat
+	RealizedPnL   float64 // Running total, net of fees
+	// Lots are the open entries oldest first; FIFO keeps them, WeightedAverage
+	// leaves them nil
+	Lots []Lot
+}
+
+// Fill is an execution against the position's symbol
+type Fill struct {
+	Side     string // BUY or SELL
+	Quantity float64
+	Price    float64
+	Fee      float64
+}
+
+// Result is a position after a fill
+type Result struct {
+	Position Position
+	Realized float64 // PnL realized by this fill, net of its share of the fee
+	Closed   float64 // Quantity of the previous position the fill reduced
+	Opened   float64 // Quantity the fill opened or added, past any reduction
+}
+
+// Apply books fill into p. A fill larger than the opposite position closes it and
+// opens the remainder on the other side at the fill price.
+func Apply(p Position, fill Fill, method Method) (Result, error) {
+	var direction float64
+	switch fill.Side {
+	case "BUY":
+		direction = 1
+	case "SELL":
+		direction = -1
+	default:
+		return Result{}, fmt.Errorf("invalid fill side %q", fill.Side)
+	}
+	if !(fill.Quantity > 0) || math.IsInf(fill.Quantity, 0) {
+		return Result{}, fmt.Errorf("invalid fill quantity %v", fill.Quantity)
+	}
+	if !(fill.Price > 0) || math.IsInf(fill.Price, 0) {
+		return Result{}, fmt.Errorf("invalid fill price %v", fill.Price)
+	}
+	if !(fill.Fee >= 0) || math.IsInf(fill.Fee, 0) {
+		return Result{}, errors.New("fill fee must be a finite non-negative amount")
+	}
+	if method != WeightedAverage && method != FIFO {
+		return Result{}, fmt.Errorf("unknown position accounting method %q", method)
+	}
+
+	if math.Abs(p.Quantity) < dust {
+		p.Quantity, p.AvgEntryPrice, p.Lots = 0, 0, nil
+	}
+	if method == FIFO && len(p.Lots) == 0 && p.Quantity != 0 {
+		// A position booked by average cost becomes one lot
+		p.Lots = []Lot{{Quantity: p.Quantity, Price: p.AvgEntryPrice}}
+	}
+	if method == WeightedAverage {
+		p.Lots = nil
+	}
+	p.Lots = append([]Lot(nil), p.Lots...)
+
+	feePerUnit := fill.Fee / fill.Quantity
+	var res Result
+
+	// Reduce an opposite position first
+	if p.Quantity*direction < 0 {
+		res.Closed = math.Min(fill.Quantity, math.Abs(p.Quantity))
+		sign := -direction // sign of the position being reduced
+		switch method {
+		case WeightedAverage:
+			res.Realized = sign * (fill.Price - p.AvgEntryPrice) * res.Closed
+		case FIFO:
+			remaining := res.Closed
+			for remaining > dust && len(p.Lots) > 0 {
+				lot := &p.Lots[0]
+				take := math.Min(remaining, math.Abs(lot.Quantity))
+				res.Realized += sign * (fill.Price - lot.Price) * take
+				lot.Quantity -= sign * take
+				remaining -= take
+				if math.Abs(lot.Quantity) < dust {
+					p.Lots = p.Lots[1:]
+				}
+			}
+		}
+		res.Realized -= feePerUnit * res.Closed
+		p.Quantity += direction * res.Closed
+		p.RealizedPnL += res.Realized
+		if math.Abs(p.Quantity) < dust {
+			p.Quantity, p.AvgEntryPrice, p.Lots = 0, 0, nil
+		}
+		if method == FIFO {
+			p.AvgEntryPrice = lotsAverage(p.Lots)
+		}
+	}
+
+	// Open or add with whatever is left
+	res.Opened = fill.Quantity - res.Closed
+	if res.Opened > dust {
+		entry := fill.Price + direction*feePerUnit
+		held := math.Abs(p.Quantity)
+		p.AvgEntryPrice = (held*p.AvgEntryPrice + res.Opened*entry) / (held + res.Opened)
+		p.Quantity += direction * res.Opened
+		if method == FIFO {
+			p.Lots = append(p.Lots, Lot{Quantity: direction * res.Opened, Price: entry})
+		}
+	} else {
+		res.Opened = 0
+	}
+
+	if len(p.Lots) == 0 {
+		p.Lots = nil
+	}
+	res.Position = p
+	return res, nil
+}
+
+// lotsAverage is the quantity-weighted entry price of lots
+func lotsAverage(lots []Lot) float64 {
+	var quantity, cost float64
+	for _, lot := range lots {
+		quantity += math.Abs(lot.Quantity)
+		cost += math.Abs(lot.Quantity) * lot.Price
+	}
+	if quantity < dust {
+		return 0
+	}
+	return cost / quantity
+}
+
+// UnrealizedPnL is what closing p at price would realize, before closing fees
+func UnrealizedPnL(p Position, price float64) float64 {
+	return (price - p.AvgEntryPrice) * p.Quantity
+}
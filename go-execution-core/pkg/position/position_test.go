@@ -0,0 +1,221 @@
+package position
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func lotsNear(a, b []Lot) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !near(a[i].Quantity, b[i].Quantity) || !near(a[i].Price, b[i].Price) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Method
+		pos    Position
+		fill   Fill
+		want   Position
+		// realized, closed and opened by this fill
+		realized, closed, opened float64
+	}{
+		{
+			name: "open long, fee raises the entry", method: WeightedAverage,
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 100, Fee: 2},
+			want: Position{Quantity: 2, AvgEntryPrice: 101}, opened: 2,
+		},
+		{
+			name: "open short, fee lowers the entry", method: WeightedAverage,
+			fill: Fill{Side: "SELL", Quantity: 2, Price: 100, Fee: 2},
+			want: Position{Quantity: -2, AvgEntryPrice: 99}, opened: 2,
+		},
+		{
+			name: "add to long", method: WeightedAverage,
+			pos:  Position{Quantity: 2, AvgEntryPrice: 101},
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 111},
+			want: Position{Quantity: 4, AvgEntryPrice: 106}, opened: 2,
+		},
+		{
+			name: "partial reduction nets its fee", method: WeightedAverage,
+			pos:  Position{Quantity: 4, AvgEntryPrice: 106, RealizedPnL: 5},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 116, Fee: 1},
+			want: Position{Quantity: 3, AvgEntryPrice: 106, RealizedPnL: 14}, realized: 9, closed: 1,
+		},
+		{
+			name: "close at a loss", method: WeightedAverage,
+			pos:  Position{Quantity: 3, AvgEntryPrice: 106},
+			fill: Fill{Side: "SELL", Quantity: 3, Price: 100},
+			want: Position{RealizedPnL: -18}, realized: -18, closed: 3,
+		},
+		{
+			name: "partial cover of a short", method: WeightedAverage,
+			pos:  Position{Quantity: -2, AvgEntryPrice: 109},
+			fill: Fill{Side: "BUY", Quantity: 1, Price: 100, Fee: 0.5},
+			want: Position{Quantity: -1, AvgEntryPrice: 109, RealizedPnL: 8.5}, realized: 8.5, closed: 1,
+		},
+		{
+			name: "flip long to short splits the fee", method: WeightedAverage,
+			pos:  Position{Quantity: 1, AvgEntryPrice: 100},
+			fill: Fill{Side: "SELL", Quantity: 3, Price: 110, Fee: 3},
+			want: Position{Quantity: -2, AvgEntryPrice: 109, RealizedPnL: 9}, realized: 9, closed: 1, opened: 2,
+		},
+		{
+			name: "flip short to long", method: WeightedAverage,
+			pos:  Position{Quantity: -1, AvgEntryPrice: 109},
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 100},
+			want: Position{Quantity: 1, AvgEntryPrice: 100, RealizedPnL: 9}, realized: 9, closed: 1, opened: 1,
+		},
+		{
+			name: "average cost drops lots", method: WeightedAverage,
+			pos:  Position{Quantity: 3, AvgEntryPrice: 320.0 / 3, Lots: []Lot{{1, 100}, {2, 110}}},
+			fill: Fill{Side: "SELL", Quantity: 2, Price: 120},
+			want: Position{Quantity: 1, AvgEntryPrice: 320.0 / 3, RealizedPnL: 80.0 / 3}, realized: 80.0 / 3, closed: 2,
+		},
+		{
+			name: "FIFO open keeps a lot", method: FIFO,
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 100, Fee: 2},
+			want: Position{Quantity: 2, AvgEntryPrice: 101, Lots: []Lot{{2, 101}}}, opened: 2,
+		},
+		{
+			name: "FIFO partial fill across lots", method: FIFO,
+			pos:  Position{Quantity: 3, AvgEntryPrice: 320.0 / 3, Lots: []Lot{{1, 100}, {2, 110}}},
+			fill: Fill{Side: "SELL", Quantity: 2, Price: 120},
+			want: Position{Quantity: 1, AvgEntryPrice: 110, RealizedPnL: 30, Lots: []Lot{{1, 110}}}, realized: 30, closed: 2,
+		},
+		{
+			name: "FIFO flip opens a lot at the fill price", method: FIFO,
+			pos:      Position{Quantity: 2, AvgEntryPrice: 105, Lots: []Lot{{1, 100}, {1, 110}}},
+			fill:     Fill{Side: "SELL", Quantity: 3, Price: 105, Fee: 0.3},
+			want:     Position{Quantity: -1, AvgEntryPrice: 104.9, RealizedPnL: -0.2, Lots: []Lot{{-1, 104.9}}},
+			realized: -0.2, closed: 2, opened: 1,
+		},
+		{
+			name: "FIFO short lots", method: FIFO,
+			pos:  Position{Quantity: -3, AvgEntryPrice: 320.0 / 3, Lots: []Lot{{-1, 100}, {-2, 110}}},
+			fill: Fill{Side: "BUY", Quantity: 2, Price: 90},
+			want: Position{Quantity: -1, AvgEntryPrice: 110, RealizedPnL: 30, Lots: []Lot{{-1, 110}}}, realized: 30, closed: 2,
+		},
+		{
+			name: "FIFO takes over an average-cost position as one lot", method: FIFO,
+			pos:  Position{Quantity: 2, AvgEntryPrice: 100},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 110},
+			want: Position{Quantity: 1, AvgEntryPrice: 100, RealizedPnL: 10, Lots: []Lot{{1, 100}}}, realized: 10, closed: 1,
+		},
+		{
+			name: "dust position counts as flat", method: WeightedAverage,
+			pos:  Position{Quantity: 1e-12, AvgEntryPrice: 500},
+			fill: Fill{Side: "SELL", Quantity: 1, Price: 100},
+			want: Position{Quantity: -1, AvgEntryPrice: 100}, opened: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lots := append([]Lot(nil), tt.pos.Lots...)
+			res, err := Apply(tt.pos, tt.fill, tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := res.Position
+			if !near(got.Quantity, tt.want.Quantity) || !near(got.AvgEntryPrice, tt.want.AvgEntryPrice) ||
+				!near(got.RealizedPnL, tt.want.RealizedPnL) || !lotsNear(got.Lots, tt.want.Lots) {
+				t.Errorf("position = %+v, want %+v", got, tt.want)
+			}
+			if !near(res.Realized, tt.realized) || !near(res.Closed, tt.closed) || !near(res.Opened, tt.opened) {
+				t.Errorf("realized %v closed %v opened %v, want %v %v %v",
+					res.Realized, res.Closed, res.Opened, tt.realized, tt.closed, tt.opened)
+			}
+			if !lotsNear(tt.pos.Lots, lots) {
+				t.Errorf("Apply modified the lots it was given: %v", tt.pos.Lots)
+			}
+		})
+	}
+}
+
+// TestApplyPartialFills books an order filled in pieces; the pieces must add up
+// to the same position as one fill, and close it exactly
+func TestApplyPartialFills(t *testing.T) {
+	for _, method := range []Method{WeightedAverage, FIFO} {
+		var p Position
+		for i := 0; i < 3; i++ {
+			res, err := Apply(p, Fill{Side: "BUY", Quantity: 0.1, Price: 100, Fee: 0.01}, method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p = res.Position
+		}
+		if !near(p.Quantity, 0.3) || !near(p.AvgEntryPrice, 100.1) {
+			t.Errorf("%s: after three buys %+v", method, p)
+		}
+		for i := 0; i < 3; i++ {
+			res, err := Apply(p, Fill{Side: "SELL", Quantity: 0.1, Price: 110, Fee: 0.01}, method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p = res.Position
+		}
+		if p.Quantity != 0 || p.AvgEntryPrice != 0 || p.Lots != nil {
+			t.Errorf("%s: after selling it all %+v, want flat", method, p)
+		}
+		// 0.3 * (110 - 100.1) less the selling fees
+		if !near(p.RealizedPnL, 0.3*9.9-0.03) {
+			t.Errorf("%s: realized %v", method, p.RealizedPnL)
+		}
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		fill   Fill
+		method Method
+	}{
+		{"bad side", Fill{Side: "HOLD", Quantity: 1, Price: 1}, WeightedAverage},
+		{"zero quantity", Fill{Side: "BUY", Price: 1}, WeightedAverage},
+		{"infinite quantity", Fill{Side: "BUY", Quantity: math.Inf(1), Price: 1}, WeightedAverage},
+		{"negative price", Fill{Side: "BUY", Quantity: 1, Price: -1}, WeightedAverage},
+		{"NaN price", Fill{Side: "BUY", Quantity: 1, Price: math.NaN()}, WeightedAverage},
+		{"negative fee", Fill{Side: "BUY", Quantity: 1, Price: 1, Fee: -1}, WeightedAverage},
+		{"NaN fee", Fill{Side: "BUY", Quantity: 1, Price: 1, Fee: math.NaN()}, WeightedAverage},
+		{"unknown method", Fill{Side: "BUY", Quantity: 1, Price: 1}, "lifo"},
+	}
+	for _, tt := range tests {
+		if _, err := Apply(Position{}, tt.fill, tt.method); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	for s, want := range map[string]Method{"": WeightedAverage, "average": WeightedAverage, "fifo": FIFO} {
+		if got, err := ParseMethod(s); err != nil || got != want {
+			t.Errorf("ParseMethod(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseMethod("FIFO"); err == nil {
+		t.Error(`ParseMethod("FIFO") accepted an upper-case method`)
+	}
+}
+
+func TestUnrealizedPnL(t *testing.T) {
+	if got := UnrealizedPnL(Position{Quantity: -2, AvgEntryPrice: 109}, 100); !near(got, 18) {
+		t.Errorf("short = %v", got)
+	}
+	if got := UnrealizedPnL(Position{Quantity: 2, AvgEntryPrice: 101}, 100); !near(got, -2) {
+		t.Errorf("long = %v", got)
+	}
+	if got := UnrealizedPnL(Position{}, 100); got != 0 {
+		t.Errorf("flat = %v", got)
+	}
+}
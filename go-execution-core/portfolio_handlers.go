@@ -1,191 +1,224 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
+	"sort"
 	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 // Portfolio and risk management REST API handlers
 
 func (s *Server) registerPortfolioEndpoints(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/portfolio/positions", s.handlePositions)
+	mux.HandleFunc("/api/v1/portfolio/positions/", s.handlePositionBySymbol)
+	mux.HandleFunc("/api/v1/portfolio/close_all", s.handleCloseAll)
 	mux.HandleFunc("/api/v1/portfolio/performance", s.handlePortfolioPerformance)
 	mux.HandleFunc("/api/v1/portfolio/risk", s.handleRiskMetrics)
+	mux.HandleFunc("/api/v1/portfolio/risk/limits", s.handleRiskLimits)
+	mux.HandleFunc("/api/v1/portfolio/risk/events", s.handleRiskEvents)
+	mux.HandleFunc("/api/v1/portfolio/risk/events/", s.handleResolveRiskEvent)
 	mux.HandleFunc("/api/v1/portfolio/pnl", s.handlePnL)
 	mux.HandleFunc("/api/v1/portfolio/balances", s.handleAllBalances)
+	mux.HandleFunc("/api/v1/portfolio/equity", s.handleEquity)
 }
 
-// handlePositions returns current open positions
+// defaultClosedWithin is how far back include_closed looks for flattened positions
+const defaultClosedWithin = 24 * time.Hour
+
+// handlePositions returns current open positions:
+// GET /api/v1/portfolio/positions?strategy_name=...&symbol=...&exchange=...&account=...
+// include_closed=true adds positions flattened within closed_within (default 24h),
+// and group_by=strategy adds per-strategy subtotals. Totals cover the filtered set.
 func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
-	query := `
-		SELECT symbol, strategy_name, quantity, average_entry_price, current_price,
-		       unrealized_pnl, realized_pnl, opened_at, last_updated
-		FROM positions
-		WHERE quantity != 0
-		ORDER BY last_updated DESC
-	`
+	params := r.URL.Query()
+	groupBy := params.Get("group_by")
+	if groupBy != "" && groupBy != "strategy" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "group_by must be strategy"})
+		return
+	}
+
+	filter := positionFilter{
+		StrategyName:  params.Get("strategy_name"),
+		Symbol:        params.Get("symbol"),
+		Exchange:      params.Get("exchange"),
+		IncludeClosed: params.Get("include_closed") == "true",
+	}
+	if raw := params.Get("closed_within"); raw != "" && filter.IncludeClosed {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": "closed_within must be a positive duration such as 24h",
+			})
+			return
+		}
+		filter.ClosedWithin = parsed
+	}
+	// Positions across all accounts by default; ?account= narrows to one
+	if account, ok := params["account"]; ok {
+		filter.Account = &account[0]
+	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.queryPositions(r.Context(), filter)
 	if err != nil {
-		log.Printf("Failed to query positions: %v", err)
+		logEvent(r.Context(), "Failed to query positions", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch positions",
 		})
 		return
 	}
-	defer rows.Close()
-
-	positions := make([]map[string]interface{}, 0)
-	var totalUnrealizedPnL, totalRealizedPnL float64
 
-	for rows.Next() {
-		var symbol, strategyName string
-		var quantity, avgEntryPrice float64
-		var currentPrice, unrealizedPnL, realizedPnL sql.NullFloat64
-		var openedAt, lastUpdated time.Time
-
-		err := rows.Scan(&symbol, &strategyName, &quantity, &avgEntryPrice,
-			&currentPrice, &unrealizedPnL, &realizedPnL, &openedAt, &lastUpdated)
-		if err != nil {
-			log.Printf("Failed to scan position row: %v", err)
-			continue
-		}
+	positions := make([]map[string]interface{}, 0, len(rows))
+	var totals positionTotals
+	byStrategy := make(map[string]*positionTotals)
+	strategyOrder := make([]string, 0)
 
+	for _, row := range rows {
 		position := map[string]interface{}{
-			"symbol":              symbol,
-			"strategy_name":       strategyName,
-			"quantity":            quantity,
-			"average_entry_price": avgEntryPrice,
-			"opened_at":           openedAt.Format(time.RFC3339),
-			"last_updated":        lastUpdated.Format(time.RFC3339),
+			"symbol":              row.Symbol,
+			"account":             row.Account,
+			"strategy_name":       row.StrategyName,
+			"quantity":            row.Quantity,
+			"average_entry_price": row.AvgEntryPrice,
+			"closed":              row.Quantity == 0,
+			"opened_at":           row.OpenedAt.Format(time.RFC3339),
+			"last_updated":        row.LastUpdated.Format(time.RFC3339),
 		}
 
-		if currentPrice.Valid {
-			position["current_price"] = currentPrice.Float64
-			position["market_value"] = currentPrice.Float64 * quantity
+		if row.CurrentPrice.Valid {
+			position["current_price"] = row.CurrentPrice.Float64
+			position["market_value"] = row.CurrentPrice.Float64 * row.Quantity
 		}
-		if unrealizedPnL.Valid {
-			position["unrealized_pnl"] = unrealizedPnL.Float64
-			totalUnrealizedPnL += unrealizedPnL.Float64
+		if row.UnrealizedPnL.Valid {
+			position["unrealized_pnl"] = row.UnrealizedPnL.Float64
 		}
-		if realizedPnL.Valid {
-			position["realized_pnl"] = realizedPnL.Float64
-			totalRealizedPnL += realizedPnL.Float64
+		if row.RealizedPnL.Valid {
+			position["realized_pnl"] = row.RealizedPnL.Float64
+		}
+
+		totals.add(row)
+		if groupBy == "strategy" {
+			group, exists := byStrategy[row.StrategyName]
+			if !exists {
+				group = &positionTotals{}
+				byStrategy[row.StrategyName] = group
+				strategyOrder = append(strategyOrder, row.StrategyName)
+			}
+			group.add(row)
 		}
 
 		positions = append(positions, position)
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	response := map[string]interface{}{
 		"positions":            positions,
 		"count":                len(positions),
-		"total_unrealized_pnl": totalUnrealizedPnL,
-		"total_realized_pnl":   totalRealizedPnL,
-		"total_pnl":            totalUnrealizedPnL + totalRealizedPnL,
-	})
+		"total_unrealized_pnl": totals.unrealizedPnL,
+		"total_realized_pnl":   totals.realizedPnL,
+		"total_pnl":            totals.unrealizedPnL + totals.realizedPnL,
+		"total_market_value":   totals.marketValue,
+	}
+	if groupBy == "strategy" {
+		sort.Strings(strategyOrder)
+		groups := make([]map[string]interface{}, len(strategyOrder))
+		for i, name := range strategyOrder {
+			group := byStrategy[name]
+			groups[i] = map[string]interface{}{
+				"strategy_name":        name,
+				"count":                group.count,
+				"open_count":           group.open,
+				"total_unrealized_pnl": group.unrealizedPnL,
+				"total_realized_pnl":   group.realizedPnL,
+				"total_pnl":            group.unrealizedPnL + group.realizedPnL,
+				"total_market_value":   group.marketValue,
+			}
+		}
+		response["by_strategy"] = groups
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// positionTotals sums a set of positions
+type positionTotals struct {
+	count         int
+	open          int
+	unrealizedPnL float64
+	realizedPnL   float64
+	marketValue   float64
+}
+
+func (t *positionTotals) add(p positionRow) {
+	t.count++
+	if p.Quantity != 0 {
+		t.open++
+	}
+	if p.CurrentPrice.Valid {
+		t.marketValue += p.CurrentPrice.Float64 * p.Quantity
+	}
+	if p.UnrealizedPnL.Valid {
+		t.unrealizedPnL += p.UnrealizedPnL.Float64
+	}
+	if p.RealizedPnL.Valid {
+		t.realizedPnL += p.RealizedPnL.Float64
+	}
 }
 
 // handlePortfolioPerformance returns overall portfolio performance metrics
 func (s *Server) handlePortfolioPerformance(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
-	// Get aggregate statistics from trades
-	query := `
-		SELECT 
-			COUNT(*) as total_trades,
-			COUNT(CASE WHEN pnl > 0 THEN 1 END) as winning_trades,
-			COUNT(CASE WHEN pnl < 0 THEN 1 END) as losing_trades,
-			COALESCE(SUM(pnl), 0) as total_pnl,
-			COALESCE(AVG(pnl), 0) as avg_pnl,
-			COALESCE(MAX(pnl), 0) as max_win,
-			COALESCE(MIN(pnl), 0) as max_loss
-		FROM trades
-		WHERE pnl IS NOT NULL AND status = 'FILLED'
-	`
-
-	var totalTrades, winningTrades, losingTrades int64
-	var totalPnL, avgPnL, maxWin, maxLoss float64
-
-	err := s.db.QueryRow(query).Scan(&totalTrades, &winningTrades, &losingTrades,
-		&totalPnL, &avgPnL, &maxWin, &maxLoss)
+	perf, err := s.queryPortfolioPerformance(r.Context())
 	if err != nil {
-		log.Printf("Failed to query performance: %v", err)
+		logEvent(r.Context(), "Failed to query performance", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch performance data",
 		})
 		return
 	}
 
-	winRate := 0.0
-	if totalTrades > 0 {
-		winRate = float64(winningTrades) / float64(totalTrades)
-	}
-
-	// Get performance by strategy
-	strategyQuery := `
-		SELECT strategy_name, COUNT(*) as trades, COALESCE(SUM(pnl), 0) as pnl
-		FROM trades
-		WHERE pnl IS NOT NULL AND status = 'FILLED'
-		GROUP BY strategy_name
-		ORDER BY pnl DESC
-	`
-
-	rows, err := s.db.Query(strategyQuery)
-	if err != nil {
-		log.Printf("Failed to query strategy performance: %v", err)
-	}
-
-	strategyPerformance := make([]map[string]interface{}, 0)
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var strategyName string
-			var trades int64
-			var pnl float64
-
-			if err := rows.Scan(&strategyName, &trades, &pnl); err != nil {
-				continue
-			}
-
-			strategyPerformance = append(strategyPerformance, map[string]interface{}{
-				"strategy_name": strategyName,
-				"trades":        trades,
-				"pnl":           pnl,
-			})
+	strategyPerformance := make([]map[string]interface{}, len(perf.Strategies))
+	for i, strategy := range perf.Strategies {
+		strategyPerformance[i] = map[string]interface{}{
+			"strategy_name": strategy.StrategyName,
+			"trades":        strategy.Trades,
+			"pnl":           strategy.PnL,
+			"risk_adjusted": strategy.RiskAdjusted,
 		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"total_trades":          totalTrades,
-		"winning_trades":        winningTrades,
-		"losing_trades":         losingTrades,
-		"win_rate":              winRate,
-		"total_pnl":             totalPnL,
-		"average_pnl_per_trade": avgPnL,
-		"max_win":               maxWin,
-		"max_loss":              maxLoss,
+		"total_trades":          perf.TotalTrades,
+		"winning_trades":        perf.WinningTrades,
+		"losing_trades":         perf.LosingTrades,
+		"win_rate":              perf.WinRate,
+		"total_pnl":             perf.TotalPnL,
+		"average_pnl_per_trade": perf.AvgPnL,
+		"max_win":               perf.MaxWin,
+		"max_loss":              perf.MaxLoss,
+		"risk_adjusted":         perf.RiskAdjusted,
 		"strategy_performance":  strategyPerformance,
 	})
 }
 
 // handleRiskMetrics returns risk metrics
 func (s *Server) handleRiskMetrics(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
@@ -204,9 +237,12 @@ func (s *Server) handleRiskMetrics(w http.ResponseWriter, r *http.Request) {
 	var totalExposure float64
 	var openPositions int64
 
-	err := s.db.QueryRow(exposureQuery).Scan(&totalExposure, &openPositions)
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	db := s.store.reader(readAnalytics)
+	err := db.QueryRowContext(ctx, exposureQuery).Scan(&totalExposure, &openPositions)
 	if err != nil {
-		log.Printf("Failed to query exposure: %v", err)
+		logEvent(r.Context(), "Failed to query exposure", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch risk metrics",
 		})
@@ -215,160 +251,311 @@ func (s *Server) handleRiskMetrics(w http.ResponseWriter, r *http.Request) {
 
 	// Get recent risk events
 	riskEventsQuery := `
-		SELECT event_type, severity, description, timestamp
+		SELECT id, event_type, severity, description, timestamp
 		FROM risk_events
 		WHERE resolved = false
 		ORDER BY timestamp DESC
 		LIMIT 5
 	`
 
-	rows, err := s.db.Query(riskEventsQuery)
+	rows, err := db.QueryContext(ctx, riskEventsQuery)
 	if err != nil {
-		log.Printf("Failed to query risk events: %v", err)
+		logEvent(r.Context(), "Failed to query risk events", "error", err)
 	}
 
 	riskEvents := make([]map[string]interface{}, 0)
 	if rows != nil {
 		defer rows.Close()
 		for rows.Next() {
-			var eventType, severity, description string
+			var id, eventType, severity, description string
 			var timestamp time.Time
 
-			if err := rows.Scan(&eventType, &severity, &description, &timestamp); err != nil {
+			if err := rows.Scan(&id, &eventType, &severity, &description, &timestamp); err != nil {
 				continue
 			}
 
 			riskEvents = append(riskEvents, map[string]interface{}{
+				"id":          id,
 				"event_type":  eventType,
 				"severity":    severity,
 				"description": description,
 				"timestamp":   timestamp.Format(time.RFC3339),
 			})
 		}
+		if err := rows.Err(); err != nil {
+			logEvent(r.Context(), "Failed to read risk events", "error", err)
+		}
 	}
 
 	// Simple VaR calculation (95% confidence, last 30 days)
-	varQuery := `
-		SELECT COALESCE(PERCENTILE_CONT(0.05) WITHIN GROUP (ORDER BY pnl), 0) as var_95
-		FROM trades
-		WHERE pnl IS NOT NULL 
-		  AND executed_at > NOW() - INTERVAL '30 days'
-		  AND status = 'FILLED'
-	`
+	var95, err := s.store.pnlPercentile(ctx, readAnalytics, 0.05, 30)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query VaR", "error", err)
+	}
 
-	var var95 float64
-	s.db.QueryRow(varQuery).Scan(&var95)
+	// Largest single-symbol exposure and today's realized loss (UTC day), the
+	// current values of the limits that exposureQuery does not cover
+	maxSymbolNotional, todayPnL, err := s.store.limitUsage(ctx, readAnalytics)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query limit usage", "error", err)
+	}
+	dailyLoss := math.Max(0, -todayPnL)
+	positionCount := float64(openPositions)
+
+	limits, err := s.riskLimits.Get(ctx)
+	if err != nil {
+		logEvent(r.Context(), "Failed to load risk limits", "error", err)
+	}
+	exposureScale := float64(defaultExposureScale)
+	if limit, ok := limits["max_total_exposure_usd"]; ok {
+		exposureScale = limit
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"total_exposure": totalExposure,
 		"open_positions": openPositions,
 		"var_95_30d":     var95,
 		"risk_events":    riskEvents,
-		"risk_level":     calculateRiskLevel(openPositions, totalExposure),
+		"risk_level":     calculateRiskLevel(openPositions, totalExposure, exposureScale),
+		"margin_levels":  s.marginLevels(r.Context()),
+		"limits": map[string]interface{}{
+			"max_total_exposure_usd":           riskLimitUsage(limits, "max_total_exposure_usd", &totalExposure),
+			"max_position_notional_per_symbol": riskLimitUsage(limits, "max_position_notional_per_symbol", &maxSymbolNotional),
+			"max_open_positions":               riskLimitUsage(limits, "max_open_positions", &positionCount),
+			"max_daily_loss":                   riskLimitUsage(limits, "max_daily_loss", &dailyLoss),
+			// Applies per order, so there is no standing utilization
+			"max_order_notional": riskLimitUsage(limits, "max_order_notional", nil),
+		},
 	})
 }
 
-// handlePnL returns PnL calculation
+// marginLevels reports the current margin level of every margin account so leverage is visible
+func (s *Server) marginLevels(ctx context.Context) map[string]float64 {
+	s.mu.RLock()
+	marginAccounts := make(map[string]*BinanceMarginExchange)
+	for name, exchange := range s.exchanges {
+		if margin, ok := exchange.(*BinanceMarginExchange); ok {
+			marginAccounts[name] = margin
+		}
+	}
+	s.mu.RUnlock()
+
+	levels := make(map[string]float64)
+	for name, margin := range marginAccounts {
+		balance, err := margin.GetBalance(ctx)
+		if err != nil {
+			logEvent(ctx, "Failed to get margin level", "exchange", name, "error", err)
+			continue
+		}
+		levels[name] = balance.MarginLevel
+	}
+	return levels
+}
+
+// pnlPeriods maps the supported ?period= values to a lookback in days (0 = all time)
+var pnlPeriods = map[string]int{
+	"1d":   1,
+	"7d":   7,
+	"30d":  30,
+	"90d":  90,
+	"365d": 365,
+	"all":  0,
+}
+
+var pnlPeriodNames = []string{"1d", "7d", "30d", "90d", "365d", "all"}
+
+// pnlGranularities are the supported ?granularity= values, each a date_trunc unit
+var pnlGranularities = map[string]bool{"hour": true, "day": true, "week": true}
+
+// handlePnL returns realized PnL per hour, day or week:
+// GET /api/v1/portfolio/pnl?period=30d&granularity=day&tz=Asia/Tokyo
+// Buckets are cut at tz's local midnight (or hour, or Monday), default UTC, and
+// are listed oldest first so cumulative_pnl runs forward in time.
 func (s *Server) handlePnL(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
-	// Get time period from query params (default: last 30 days)
-	period := r.URL.Query().Get("period")
+	// Time range: an explicit from/to pair, or a whitelisted period (default: last 30 days)
+	query := r.URL.Query()
+	period := query.Get("period")
 	if period == "" {
-		period = "30 days"
+		period = "30d"
+	}
+	days, ok := pnlPeriods[period]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":           fmt.Sprintf("invalid period %q", period),
+			"allowed_periods": pnlPeriodNames,
+		})
+		return
+	}
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	if !pnlGranularities[granularity] {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "granularity must be hour, day or week",
+		})
+		return
+	}
+	tz := query.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	// Go and Postgres both read the IANA database, so a zone Go knows is one
+	// Postgres accepts; "Local" is Go-only and rejected
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("unknown time zone %q, expected an IANA name such as Asia/Tokyo", tz),
+		})
+		return
 	}
 
-	query := fmt.Sprintf(`
-		SELECT 
-			DATE(executed_at) as date,
-			COALESCE(SUM(pnl), 0) as daily_pnl,
-			COUNT(*) as trades
-		FROM trades
-		WHERE pnl IS NOT NULL 
-		  AND executed_at > NOW() - INTERVAL '%s'
-		  AND status = 'FILLED'
-		GROUP BY DATE(executed_at)
-		ORDER BY date DESC
-	`, period)
-
-	rows, err := s.db.Query(query)
+	where := &whereBuilder{}
+	where.add("pnl IS NOT NULL")
+	where.add("status = 'FILLED'")
+
+	response := map[string]interface{}{
+		"granularity": granularity,
+		"tz":          tz,
+	}
+	from, to := query.Get("from"), query.Get("to")
+	if from != "" || to != "" {
+		for _, bound := range []struct{ param, value, op string }{
+			{"from", from, ">="},
+			{"to", to, "<"},
+		} {
+			if bound.value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, bound.value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+					"error": fmt.Sprintf("%s must be an RFC3339 timestamp", bound.param),
+				})
+				return
+			}
+			where.add("executed_at "+bound.op+" ?", t)
+			response[bound.param] = t.Format(time.RFC3339)
+		}
+	} else {
+		if days > 0 {
+			where.add("executed_at > ?", time.Now().AddDate(0, 0, -days))
+		}
+		response["period"] = period
+	}
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	sums, err := s.store.sumPnL(ctx, readAnalytics, where, granularity, loc, false)
 	if err != nil {
-		log.Printf("Failed to query PnL: %v", err)
+		logEvent(r.Context(), "Failed to query PnL", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch PnL data",
 		})
 		return
 	}
-	defer rows.Close()
 
-	dailyPnL := make([]map[string]interface{}, 0)
+	buckets := make([]map[string]interface{}, 0, len(sums))
 	var cumulativePnL float64
-
-	for rows.Next() {
-		var date time.Time
-		var pnl float64
-		var trades int64
-
-		if err := rows.Scan(&date, &pnl, &trades); err != nil {
-			continue
-		}
-
-		cumulativePnL += pnl
-
-		dailyPnL = append(dailyPnL, map[string]interface{}{
-			"date":           date.Format("2006-01-02"),
-			"daily_pnl":      pnl,
+	for _, sum := range sums {
+		cumulativePnL += sum.PnL
+		buckets = append(buckets, map[string]interface{}{
+			"start":          sum.Start.Format(time.RFC3339),
+			"date":           sum.Start.Format("2006-01-02"),
+			"pnl":            sum.PnL,
 			"cumulative_pnl": cumulativePnL,
-			"trades":         trades,
+			"trades":         sum.Trades,
 		})
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"period":         period,
-		"daily_pnl":      dailyPnL,
-		"cumulative_pnl": cumulativePnL,
-	})
+	response["buckets"] = buckets
+	response["cumulative_pnl"] = cumulativePnL
+	writeJSON(w, http.StatusOK, response)
 }
 
-// handleAllBalances returns balances across all configured exchanges
+// handleAllBalances returns balances across all configured exchanges. Exchanges
+// are read concurrently, each within BALANCE_FETCH_TIMEOUT, so one slow exchange
+// shows up as an error entry instead of delaying the rest.
 func (s *Server) handleAllBalances(w http.ResponseWriter, r *http.Request) {
+	// Optional filters: ?exchange=binance and/or ?account=alpha; force=true skips the cache
+	exchangeFilter := r.URL.Query().Get("exchange")
+	accountFilter, filterAccount := r.URL.Query()["account"]
+	force := r.URL.Query().Get("force") == "true"
+
+	// Copy the exchanges so no exchange call runs under the lock
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	exchanges := make(map[string]Exchange, len(s.exchanges))
+	for exchangeName, exchange := range s.exchanges {
+		base, account := splitExchangeKey(exchangeName)
+		if exchangeFilter != "" && base != exchangeFilter {
+			continue
+		}
+		if filterAccount && account != accountFilter[0] {
+			continue
+		}
+		exchanges[exchangeName] = exchange
+	}
+	s.mu.RUnlock()
+
+	type fetched struct {
+		balance  *Balance
+		cached   bool
+		err      error
+		duration time.Duration
+	}
+	results := make(map[string]*fetched, len(exchanges))
+	var g errgroup.Group
+	for exchangeName, exchange := range exchanges {
+		result := &fetched{}
+		results[exchangeName] = result
+		exchangeName, exchange := exchangeName, exchange
+		g.Go(func() error {
+			start := time.Now()
+			result.balance, result.cached, result.err = s.balanceWithTimeout(r.Context(), exchangeName, exchange,
+				force, s.config.BalanceFetchTimeout)
+			result.duration = time.Since(start)
+			s.balanceFetches.observe(exchangeName, result.duration, result.err)
+			return nil // one exchange failing must not cancel the others
+		})
+	}
+	g.Wait()
 
 	allBalances := make(map[string]interface{})
 	var totalValueUSD float64
 
-	for exchangeName, exchange := range s.exchanges {
-		balance, err := exchange.GetBalance()
-		if err != nil {
-			log.Printf("Failed to get balance for %s: %v", exchangeName, err)
+	for exchangeName, result := range results {
+		durationMS := result.duration.Seconds() * 1000
+		if result.err != nil {
+			logEvent(r.Context(), "Failed to get balance", "exchange", exchangeName, "error", result.err)
 			allBalances[exchangeName] = map[string]interface{}{
-				"error": err.Error(),
+				"error":             result.err.Error(),
+				"fetch_duration_ms": durationMS,
 			}
 			continue
 		}
-
-		// Convert to JSON-friendly format
-		balances := make(map[string]interface{})
-		for asset, bal := range balance.Balances {
-			balances[asset] = map[string]float64{
-				"free":   bal.Free,
-				"locked": bal.Locked,
-				"total":  bal.Total,
-			}
+		balance := result.balance
+
+		exchangeBalances := map[string]interface{}{
+			"balances":          assetBalancesJSON(balance),
+			"total_value_usd":   balance.TotalValueUSD,
+			"unpriced_assets":   unpricedAssetsJSON(balance),
+			"timestamp":         balance.Timestamp.Format(time.RFC3339),
+			"fetched_at":        balance.Timestamp.Format(time.RFC3339Nano),
+			"cached":            result.cached,
+			"fetch_duration_ms": durationMS,
 		}
-
-		allBalances[exchangeName] = map[string]interface{}{
-			"balances":        balances,
-			"total_value_usd": balance.TotalValueUSD,
-			"timestamp":       balance.Timestamp.Format(time.RFC3339),
+		if balance.MarginLevel > 0 {
+			exchangeBalances["margin_level"] = balance.MarginLevel
 		}
 
+		allBalances[exchangeName] = exchangeBalances
+
 		totalValueUSD += balance.TotalValueUSD
 	}
 
@@ -379,18 +566,19 @@ func (s *Server) handleAllBalances(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Helper function to calculate risk level
-func calculateRiskLevel(openPositions int64, totalExposure float64) string {
+// calculateRiskLevel grades exposure against maxExposure (max_total_exposure_usd,
+// or defaultExposureScale when unset): under 10% LOW, 50% MEDIUM, 100% HIGH
+func calculateRiskLevel(openPositions int64, totalExposure, maxExposure float64) string {
 	if openPositions == 0 {
 		return "NONE"
 	}
-	if totalExposure < 10000 {
+	if totalExposure < maxExposure*0.1 {
 		return "LOW"
 	}
-	if totalExposure < 50000 {
+	if totalExposure < maxExposure*0.5 {
 		return "MEDIUM"
 	}
-	if totalExposure < 100000 {
+	if totalExposure < maxExposure {
 		return "HIGH"
 	}
 	return "CRITICAL"
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPnLPeriods(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	// One trade inside each period boundary, each with its own power of two so a
+	// sum names exactly the trades it included
+	now := time.Now()
+	for i, age := range []time.Duration{12 * time.Hour, 3 * 24 * time.Hour, 20 * 24 * time.Hour,
+		60 * 24 * time.Hour, 200 * 24 * time.Hour, 500 * 24 * time.Hour} {
+		insertTestTrade(t, s, fmt.Sprintf("ord-%d", i), "momentum", float64(int(1)<<i), now.Add(-age))
+	}
+
+	tests := []struct {
+		period string
+		want   float64
+		trades int
+	}{
+		{"", 7, 3}, // 30d
+		{"1d", 1, 1},
+		{"7d", 3, 2},
+		{"30d", 7, 3},
+		{"90d", 15, 4},
+		{"365d", 31, 5},
+		{"all", 63, 6},
+	}
+	for _, tt := range tests {
+		code, body := doJSON(t, srv, http.MethodGet, "/api/v1/portfolio/pnl?period="+tt.period, nil)
+		if code != http.StatusOK {
+			t.Errorf("period %q: status %d: %v", tt.period, code, body)
+			continue
+		}
+		buckets, _ := body["buckets"].([]interface{})
+		trades := 0
+		for _, raw := range buckets {
+			trades += int(raw.(map[string]interface{})["trades"].(float64))
+		}
+		if body["cumulative_pnl"] != tt.want || trades != tt.trades {
+			t.Errorf("period %q: cumulative_pnl %v over %d trades, want %g over %d", tt.period,
+				body["cumulative_pnl"], trades, tt.want, tt.trades)
+		}
+	}
+
+	from := url.QueryEscape(now.Add(-100 * 24 * time.Hour).Format(time.RFC3339))
+	to := url.QueryEscape(now.Add(-24 * time.Hour).Format(time.RFC3339))
+	code, body := doJSON(t, srv, http.MethodGet, "/api/v1/portfolio/pnl?from="+from+"&to="+to, nil)
+	if code != http.StatusOK || body["cumulative_pnl"] != 14.0 {
+		t.Errorf("from/to range: status %d: %v", code, body)
+	}
+}
+
+func TestPnLRejectsInjection(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+	insertTestTrade(t, s, "ord-1", "momentum", 5, time.Now().Add(-time.Hour))
+
+	for _, query := range []string{
+		"period=" + url.QueryEscape("30 days'; DROP TABLE trades; --"),
+		"period=" + url.QueryEscape("1 day' OR '1'='1"),
+		"period=30+days",
+		"granularity=" + url.QueryEscape("day'); DELETE FROM trades; --"),
+		"tz=" + url.QueryEscape("UTC'; DROP TABLE trades; --"),
+		"from=" + url.QueryEscape("2024-01-01' OR 1=1 --"),
+	} {
+		code, body := doJSON(t, srv, http.MethodGet, "/api/v1/portfolio/pnl?"+query, nil)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: status %d: %v", query, code, body)
+		}
+	}
+
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM trades`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("trades after injection attempts: count %d, err %v", count, err)
+	}
+}
+
+// TestPnLGranularityAcrossTimeZones seeds trades either side of midnight in Tokyo
+// (15:00 UTC) on Sunday 2024-03-10 and checks where each granularity and zone
+// cuts them, and that cumulative PnL runs in ascending bucket order
+func TestPnLGranularityAcrossTimeZones(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	for i, trade := range []struct {
+		at  string
+		pnl float64
+	}{
+		{"2024-03-10T14:30:00Z", 1},  // Tokyo 23:30 Sunday, Kolkata 20:00
+		{"2024-03-10T15:30:00Z", 2},  // Tokyo 00:30 Monday, Kolkata 21:00
+		{"2024-03-10T16:10:00Z", -4}, // Tokyo 01:10 Monday, Kolkata 21:40
+		{"2024-03-11T02:00:00Z", 8},  // Tokyo 11:00 Monday, Kolkata 07:30
+	} {
+		at, err := time.Parse(time.RFC3339, trade.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		insertTestTrade(t, s, fmt.Sprintf("ord-%d", i), "momentum", trade.pnl, at)
+	}
+
+	type bucket struct {
+		start      string
+		pnl        float64
+		cumulative float64
+		trades     float64
+	}
+	tests := []struct {
+		granularity string
+		tz          string
+		want        []bucket
+	}{
+		{"day", "", []bucket{
+			{"2024-03-10T00:00:00Z", -1, -1, 3},
+			{"2024-03-11T00:00:00Z", 8, 7, 1},
+		}},
+		{"day", "Asia/Tokyo", []bucket{
+			{"2024-03-10T00:00:00+09:00", 1, 1, 1},
+			{"2024-03-11T00:00:00+09:00", 6, 7, 3},
+		}},
+		{"hour", "UTC", []bucket{
+			{"2024-03-10T14:00:00Z", 1, 1, 1},
+			{"2024-03-10T15:00:00Z", 2, 3, 1},
+			{"2024-03-10T16:00:00Z", -4, -1, 1},
+			{"2024-03-11T02:00:00Z", 8, 7, 1},
+		}},
+		{"hour", "Asia/Kolkata", []bucket{
+			{"2024-03-10T20:00:00+05:30", 1, 1, 1},
+			{"2024-03-10T21:00:00+05:30", -2, -1, 2},
+			{"2024-03-11T07:00:00+05:30", 8, 7, 1},
+		}},
+		{"week", "UTC", []bucket{
+			{"2024-03-04T00:00:00Z", -1, -1, 3},
+			{"2024-03-11T00:00:00Z", 8, 7, 1},
+		}},
+		{"week", "Asia/Tokyo", []bucket{
+			{"2024-03-04T00:00:00+09:00", 1, 1, 1},
+			{"2024-03-11T00:00:00+09:00", 6, 7, 3},
+		}},
+	}
+
+	ok2xx := []string{"route", "/api/v1/portfolio/pnl", "method", "GET", "status_class", "2xx"}
+	requestsBefore, _ := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", ok2xx...)
+	queriesBefore, _ := scrapeMetric(t, srv, "signalops_db_query_duration_seconds_count", "operation", "query")
+
+	for _, tt := range tests {
+		path := "/api/v1/portfolio/pnl?from=2024-03-01T00:00:00Z&to=2024-04-01T00:00:00Z&granularity=" + tt.granularity
+		if tt.tz != "" {
+			path += "&tz=" + url.QueryEscape(tt.tz)
+		}
+		code, body := doJSON(t, srv, http.MethodGet, path, nil)
+		if code != http.StatusOK {
+			t.Errorf("%s %s: status %d: %v", tt.granularity, tt.tz, code, body)
+			continue
+		}
+		raw, _ := body["buckets"].([]interface{})
+		got := make([]bucket, 0, len(raw))
+		for _, r := range raw {
+			b := r.(map[string]interface{})
+			got = append(got, bucket{b["start"].(string), b["pnl"].(float64), b["cumulative_pnl"].(float64), b["trades"].(float64)})
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s %s: buckets\n got  %v\n want %v", tt.granularity, tt.tz, got, tt.want)
+		}
+		if body["cumulative_pnl"] != 7.0 {
+			t.Errorf("%s %s: cumulative_pnl %v, want 7", tt.granularity, tt.tz, body["cumulative_pnl"])
+		}
+	}
+
+	for _, query := range []string{"granularity=month", "tz=Local", "tz=Mars%2FOlympus"} {
+		if code, body := doJSON(t, srv, http.MethodGet, "/api/v1/portfolio/pnl?"+query, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d: %v", query, code, body)
+		}
+	}
+
+	requestsAfter, _ := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", ok2xx...)
+	if got := requestsAfter - requestsBefore; got != float64(len(tests)) {
+		t.Errorf("PnL requests recorded = %g, want %d", got, len(tests))
+	}
+	if _, ok := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count",
+		"route", "/api/v1/portfolio/pnl", "method", "GET", "status_class", "4xx"); !ok {
+		t.Error("no series for rejected PnL requests")
+	}
+	if queriesAfter, _ := scrapeMetric(t, srv, "signalops_db_query_duration_seconds_count", "operation", "query"); queriesAfter-queriesBefore < float64(len(tests)) {
+		t.Errorf("db queries recorded = %g, want at least %d", queriesAfter-queriesBefore, len(tests))
+	}
+}
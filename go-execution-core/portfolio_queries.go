@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Portfolio reads shared by the REST handlers and the gRPC service, so both
+// answer from the same SQL
+
+// positionFilter narrows queryPositions; empty fields match everything
+type positionFilter struct {
+	StrategyName string
+	Symbol       string
+	Exchange     string  // exchange or exchange:account
+	Account      *string // nil for all accounts, "" for the default one
+	// IncludeClosed adds positions flattened within ClosedWithin
+	IncludeClosed bool
+	ClosedWithin  time.Duration
+}
+
+// positionRow is one row of the positions table
+type positionRow struct {
+	Symbol        string
+	Account       string
+	StrategyName  string
+	Quantity      float64
+	AvgEntryPrice float64
+	CurrentPrice  sql.NullFloat64
+	UnrealizedPnL sql.NullFloat64
+	RealizedPnL   sql.NullFloat64
+	OpenedAt      time.Time
+	LastUpdated   time.Time
+}
+
+// queryPositions reads positions matching f, most recently updated first
+func (s *Server) queryPositions(ctx context.Context, f positionFilter) ([]positionRow, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var where whereBuilder
+	if f.IncludeClosed {
+		closedWithin := f.ClosedWithin
+		if closedWithin <= 0 {
+			closedWithin = defaultClosedWithin
+		}
+		where.add("(quantity != 0 OR last_updated >= ?)", time.Now().Add(-closedWithin))
+	} else {
+		where.add("quantity != 0")
+	}
+
+	if f.Account != nil {
+		where.add("account = ?", *f.Account)
+	}
+	if f.StrategyName != "" {
+		where.add("strategy_name = ?", f.StrategyName)
+	}
+	if f.Symbol != "" {
+		where.add("symbol = ?", f.Symbol)
+	}
+	if f.Exchange != "" {
+		// Positions do not record their exchange; it is the one their strategy traded the symbol on
+		base, account := splitExchangeKey(f.Exchange)
+		if account != "" {
+			where.add("account = ?", account)
+		}
+		where.add(`EXISTS (
+			SELECT 1 FROM trades t
+			WHERE t.symbol = positions.symbol AND t.account = positions.account
+			  AND t.strategy_name = positions.strategy_name AND t.exchange = ?
+		)`, base)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT symbol, account, strategy_name, quantity, average_entry_price, current_price,
+		       unrealized_pnl, realized_pnl, opened_at, last_updated
+		FROM positions
+		%s
+		ORDER BY last_updated DESC
+	`, where.sql())
+
+	rows, err := s.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := make([]positionRow, 0)
+	for rows.Next() {
+		var p positionRow
+		err := rows.Scan(&p.Symbol, &p.Account, &p.StrategyName, &p.Quantity, &p.AvgEntryPrice,
+			&p.CurrentPrice, &p.UnrealizedPnL, &p.RealizedPnL, &p.OpenedAt, &p.LastUpdated)
+		if err != nil {
+			logEvent(ctx, "Failed to scan position row", "error", err)
+			continue
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// portfolioPerformance is the realized performance of filled trades
+type portfolioPerformance struct {
+	TotalTrades   int64
+	WinningTrades int64
+	LosingTrades  int64
+	WinRate       float64
+	TotalPnL      float64
+	AvgPnL        float64
+	MaxWin        float64
+	MaxLoss       float64
+	RiskAdjusted  riskAdjustedStats
+	Strategies    []strategyPnL // by PnL, best first
+}
+
+type strategyPnL struct {
+	StrategyName string
+	Trades       int64
+	PnL          float64
+	RiskAdjusted riskAdjustedStats
+}
+
+// queryPortfolioPerformance aggregates filled trades with a recorded PnL. Only
+// the totals are required; a failed per-strategy or daily query is logged and
+// leaves those parts empty.
+func (s *Server) queryPortfolioPerformance(ctx context.Context) (*portfolioPerformance, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	db := s.store.reader(readAnalytics)
+	perf := &portfolioPerformance{Strategies: make([]strategyPnL, 0)}
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) as total_trades,
+			COUNT(CASE WHEN pnl > 0 THEN 1 END) as winning_trades,
+			COUNT(CASE WHEN pnl < 0 THEN 1 END) as losing_trades,
+			COALESCE(SUM(pnl), 0) as total_pnl,
+			COALESCE(AVG(pnl), 0) as avg_pnl,
+			COALESCE(MAX(pnl), 0) as max_win,
+			COALESCE(MIN(pnl), 0) as max_loss
+		FROM trades
+		WHERE pnl IS NOT NULL AND status = 'FILLED'
+	`).Scan(&perf.TotalTrades, &perf.WinningTrades, &perf.LosingTrades,
+		&perf.TotalPnL, &perf.AvgPnL, &perf.MaxWin, &perf.MaxLoss)
+	if err != nil {
+		return nil, err
+	}
+	if perf.TotalTrades > 0 {
+		perf.WinRate = float64(perf.WinningTrades) / float64(perf.TotalTrades)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT strategy_name, COUNT(*) as trades, COALESCE(SUM(pnl), 0) as pnl
+		FROM trades
+		WHERE pnl IS NOT NULL AND status = 'FILLED'
+		GROUP BY strategy_name
+		ORDER BY pnl DESC
+	`)
+	if err != nil {
+		logEvent(ctx, "Failed to query strategy performance", "error", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var strategy strategyPnL
+			if err := rows.Scan(&strategy.StrategyName, &strategy.Trades, &strategy.PnL); err != nil {
+				continue
+			}
+			perf.Strategies = append(perf.Strategies, strategy)
+		}
+		if err := rows.Err(); err != nil {
+			logEvent(ctx, "Failed to read strategy performance", "error", err)
+			perf.Strategies = make([]strategyPnL, 0)
+		}
+	}
+
+	// Sharpe, Sortino, drawdown and profit factor from the daily PnL series
+	dailyPnL, err := s.queryDailyPnL(ctx)
+	if err != nil {
+		logEvent(ctx, "Failed to query daily PnL", "error", err)
+	}
+	for i := range perf.Strategies {
+		perf.Strategies[i].RiskAdjusted = computeRiskAdjusted(dailyPnL[perf.Strategies[i].StrategyName])
+	}
+	perf.RiskAdjusted = computeRiskAdjusted(combineDailyPnL(dailyPnL))
+	return perf, nil
+}
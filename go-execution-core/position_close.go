@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// openPosition is a positions row with nonzero quantity
+type openPosition struct {
+	ID            string
+	Symbol        string
+	Account       string
+	StrategyName  string
+	Quantity      float64 // negative for shorts
+	AvgEntryPrice float64
+	CurrentPrice  float64 // 0 when not recorded
+}
+
+// positionCloseResult is the outcome of closing (part of) a position
+type positionCloseResult struct {
+	OrderID           string  `json:"order_id"`
+	ExchangeOrderID   string  `json:"exchange_order_id"`
+	Symbol            string  `json:"symbol"`
+	StrategyName      string  `json:"strategy_name"`
+	Exchange          string  `json:"exchange"`
+	Side              string  `json:"side"`
+	Quantity          float64 `json:"quantity"`
+	Status            string  `json:"status"`
+	ExecutedPrice     float64 `json:"executed_price"`
+	ExecutedQuantity  float64 `json:"executed_quantity"`
+	Fees              float64 `json:"fees"`
+	RealizedPnL       float64 `json:"realized_pnl"` // net of fees
+	RemainingQuantity float64 `json:"remaining_quantity"`
+}
+
+// handlePositionBySymbol routes /api/v1/portfolio/positions/{symbol}/close
+func (s *Server) handlePositionBySymbol(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/portfolio/positions/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "close" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.handleClosePosition(w, r, strings.ToUpper(parts[0]))
+}
+
+// handleClosePosition flattens a position with a market order:
+// POST /api/v1/portfolio/positions/{symbol}/close {"strategy_name": ..., "percentage": 50}
+// The body is optional; account and exchange pick the position and venue when a
+// symbol is held in several accounts.
+func (s *Server) handleClosePosition(w http.ResponseWriter, r *http.Request, symbol string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		StrategyName string   `json:"strategy_name"`
+		Percentage   *float64 `json:"percentage"`
+		Account      *string  `json:"account"`
+		Exchange     string   `json:"exchange"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	percentage := 100.0
+	if req.Percentage != nil {
+		percentage = *req.Percentage
+	}
+	if math.IsNaN(percentage) || percentage <= 0 || percentage > 100 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "percentage must be greater than 0 and at most 100",
+		})
+		return
+	}
+
+	var where whereBuilder
+	where.add("symbol = ?", symbol)
+	where.add("quantity != 0")
+	if req.StrategyName != "" {
+		where.add("strategy_name = ?", req.StrategyName)
+	}
+	if req.Account != nil {
+		where.add("account = ?", *req.Account)
+	}
+	positions, err := s.loadOpenPositions(r.Context(), where)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query positions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch positions",
+		})
+		return
+	}
+	if len(positions) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("No open position in %s", symbol),
+		})
+		return
+	}
+	if len(positions) > 1 {
+		accounts := make([]string, len(positions))
+		for i, p := range positions {
+			accounts[i] = p.Account
+		}
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":    fmt.Sprintf("%s is held in %d accounts; pass account to pick one", symbol, len(positions)),
+			"accounts": accounts,
+		})
+		return
+	}
+
+	result, err := s.closePosition(context.WithoutCancel(r.Context()), positions[0], req.Exchange, percentage)
+	var validation validationError
+	switch {
+	case errors.As(err, &validation):
+		writeValidationError(w, validation)
+		return
+	case errors.Is(err, errExchangeNotConfigured):
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	case errors.Is(err, errExchangeUnhealthy):
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	case err != nil && result == nil:
+		logEvent(r.Context(), "Position close failed", "symbol", symbol, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	case err != nil:
+		// The order went through but the books could not be updated
+		logEvent(r.Context(), "Position closed but not recorded", "symbol", symbol, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "Order executed but the position could not be updated: " + err.Error(),
+			"fill":    result,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"fill":    result,
+	})
+}
+
+// loadOpenPositions reads the positions matching where
+func (s *Server) loadOpenPositions(ctx context.Context, where whereBuilder) ([]openPosition, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, symbol, account, strategy_name, quantity, average_entry_price, COALESCE(current_price, 0)
+		FROM positions
+		%s
+		ORDER BY symbol, account
+	`, where.sql()), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := make([]openPosition, 0)
+	for rows.Next() {
+		var p openPosition
+		if err := rows.Scan(&p.ID, &p.Symbol, &p.Account, &p.StrategyName, &p.Quantity,
+			&p.AvgEntryPrice, &p.CurrentPrice); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// positionExchange is the exchange a position is closed on: the one given, else
+// the one its strategy last traded the symbol on, else binance
+func (s *Server) positionExchange(ctx context.Context, pos openPosition, exchange string) string {
+	if exchange == "" {
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COALESCE(exchange, '') FROM trades
+			WHERE symbol = $1 AND account = $2 AND strategy_name = $3
+			ORDER BY timestamp DESC
+			LIMIT 1
+		`, pos.Symbol, pos.Account, pos.StrategyName).Scan(&exchange)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logEvent(ctx, "Failed to look up position exchange", "symbol", pos.Symbol, "error", err)
+		}
+	}
+	if exchange == "" {
+		exchange = "binance"
+	}
+	base, account := normalizeExchangeAccount(exchange, pos.Account)
+	return exchangeKey(base, account)
+}
+
+// closePosition submits the opposite-side market order for percentage of a
+// position and books the fill: a trades row with its realized PnL and the
+// reduced position, in one transaction. A non-nil result with an error means
+// the order executed but the books were not updated.
+func (s *Server) closePosition(ctx context.Context, pos openPosition, exchangeName string,
+	percentage float64) (*positionCloseResult, error) {
+	key := s.positionExchange(ctx, pos, exchangeName)
+	s.mu.RLock()
+	exchange, exists := s.exchanges[key]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errExchangeNotConfigured, key)
+	}
+
+	side := "SELL"
+	if pos.Quantity < 0 {
+		side = "BUY"
+	}
+	order := &Order{
+		ID:           fmt.Sprintf("close-%s-%d", strings.ToLower(pos.Symbol), time.Now().UnixNano()),
+		Symbol:       pos.Symbol,
+		Side:         side,
+		Quantity:     math.Abs(pos.Quantity) * percentage / 100,
+		OrderType:    "MARKET",
+		StrategyName: pos.StrategyName,
+		ReduceOnly:   accountTypeForExchange(key) == "futures",
+	}
+	if errs := validateOrder(exchange, order); errs != nil {
+		return nil, errs
+	}
+	if err := s.health.CheckOrderable(key); err != nil {
+		return nil, err
+	}
+
+	result, err := s.submitOrder(ctx, key, exchange, order)
+	if err != nil {
+		return nil, err
+	}
+
+	closed := &positionCloseResult{
+		OrderID:          order.ID,
+		ExchangeOrderID:  result.ExchangeOrderID,
+		Symbol:           pos.Symbol,
+		StrategyName:     pos.StrategyName,
+		Exchange:         key,
+		Side:             side,
+		Quantity:         order.Quantity,
+		Status:           result.Status,
+		ExecutedPrice:    result.ExecutedPrice,
+		ExecutedQuantity: result.ExecutedQuantity,
+		Fees:             result.Fees,
+	}
+	booked, err := s.recordPositionClose(ctx, key, order, result)
+	if err != nil {
+		// Long positions shrink by what was sold, shorts by what was bought back
+		closed.RemainingQuantity = pos.Quantity - math.Copysign(result.ExecutedQuantity, pos.Quantity)
+		return closed, err
+	}
+	closed.RemainingQuantity = pos.Quantity
+	if booked != nil {
+		closed.RealizedPnL = booked.Realized
+		closed.RemainingQuantity = booked.Remaining
+	}
+	return closed, nil
+}
+
+// recordPositionClose writes the closing trade and books its fill to the
+// position in one transaction, returning what booking did (nil when nothing
+// filled)
+func (s *Server) recordPositionClose(ctx context.Context, key string, order *Order,
+	result *OrderResult) (*bookedFill, error) {
+	exchange, account := splitExchangeKey(key)
+	booked, err := s.store.ApplyFill(ctx, OrderFill{Mode: fillInsert, Trade: &TradeRecord{
+		OrderID:          order.ID,
+		StrategyName:     order.StrategyName,
+		Symbol:           order.Symbol,
+		Side:             order.Side,
+		OrderType:        order.OrderType,
+		Quantity:         order.Quantity,
+		ExecutedPrice:    result.ExecutedPrice,
+		Status:           result.Status,
+		Exchange:         exchange,
+		Account:          account,
+		Timestamp:        time.Now(),
+		ExecutedAt:       result.Timestamp,
+		Fees:             result.Fees,
+		ExchangeOrderID:  result.ExchangeOrderID,
+		ExecutedQuantity: result.ExecutedQuantity,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	s.cacheOrderStatus(ctx, &trackedOrder{
+		OrderID:         order.ID,
+		ExchangeOrderID: result.ExchangeOrderID,
+		Exchange:        exchange,
+		Account:         account,
+		StrategyName:    order.StrategyName,
+		Symbol:          order.Symbol,
+		Side:            order.Side,
+		Status:          result.Status,
+		FilledQty:       result.ExecutedQuantity,
+		AveragePrice:    result.ExecutedPrice,
+		Fees:            result.Fees,
+		UpdatedAt:       time.Now(),
+	})
+	if booked != nil {
+		s.refreshLeaderboard(ctx, booked.Strategy)
+		logEvent(ctx, "Position closed", "symbol", order.Symbol, "account", account, "order_id", order.ID,
+			"filled", booked.Quantity, "remaining", booked.Remaining, "realized_pnl", booked.Realized)
+	}
+	return booked, nil
+}
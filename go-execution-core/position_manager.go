@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"execution-engine/pkg/position"
+)
+
+// Positions are maintained from fills: whenever an order's trades row records
+// more filled quantity than has been booked, the difference is applied to the
+// (symbol, account) position with the arithmetic in pkg/position, in the
+// transaction that wrote the row (Store.ApplyFill). Booking works
+// from the row's cumulative filled_quantity, executed_price and fees, so it does
+// not matter which path saw a fill first (submission result, status refresh,
+// execution report) or how often it is seen.
+
+// bookedFill is what booking an order's new fills did to its position
+type bookedFill struct {
+	Symbol       string
+	Account      string
+	Strategy     string
+	Quantity     float64 // newly booked fill
+	Realized     float64 // realized on the position
+	Remaining    float64 // position quantity afterwards
+	TradePnL     float64 // realized against the strategy's lots, added to the trade's pnl
+	PrevNotional float64 // size of the position at its entry price before the fill
+	Notional     float64 // and after
+}
+
+// bookOrderTx applies the part of an order's fill not yet booked to its position
+// within tx, returning nil when there was nothing new. The trades row is locked
+// first, then the position, so concurrent bookings of one order serialize; the
+// fill is also matched against its strategy's lots, which sets the trade's pnl.
+// The transaction must hold lockStrategyLots.
+func (st *Store) bookOrderTx(ctx context.Context, tx *sql.Tx, orderID string) (*bookedFill, error) {
+	var symbol, side, strategy, account string
+	var filled, price, fees, bookedQty, bookedNotional, bookedFees float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT symbol, side, strategy_name, account,
+		       COALESCE(filled_quantity, 0), COALESCE(executed_price, 0), COALESCE(fees, 0),
+		       booked_quantity, booked_notional, booked_fees
+		FROM trades
+		WHERE order_id = $1
+		`+st.dialect.forUpdate()+`
+	`, orderID).Scan(&symbol, &side, &strategy, &account, &filled, &price, &fees,
+		&bookedQty, &bookedNotional, &bookedFees)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	quantity := filled - bookedQty
+	if quantity <= 1e-9 || price <= 0 {
+		return nil, nil
+	}
+	// Price of just the new fill, backed out of the change in average price
+	notional := filled * price
+	fillPrice := (notional - bookedNotional) / quantity
+	if fillPrice <= 0 {
+		fillPrice = price
+	}
+	fill := position.Fill{
+		Side:     side,
+		Quantity: quantity,
+		Price:    fillPrice,
+		Fee:      math.Max(fees-bookedFees, 0),
+	}
+
+	// The row may not exist yet; create it flat so it can be locked
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO positions (symbol, account, strategy_name, quantity, average_entry_price)
+		VALUES ($1, $2, $3, 0, 0)
+		ON CONFLICT (symbol, account) DO NOTHING
+	`, symbol, account, strategy); err != nil {
+		return nil, err
+	}
+	var id string
+	var current position.Position
+	var lots []byte
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id, quantity, average_entry_price, COALESCE(realized_pnl, 0), lots
+		FROM positions
+		WHERE symbol = $1 AND account = $2
+		`+st.dialect.forUpdate()+`
+	`, symbol, account).Scan(&id, &current.Quantity, &current.AvgEntryPrice, &current.RealizedPnL, &lots); err != nil {
+		return nil, err
+	}
+	if len(lots) > 0 {
+		if err := json.Unmarshal(lots, &current.Lots); err != nil {
+			return nil, fmt.Errorf("invalid lots on position %s: %w", id, err)
+		}
+	}
+
+	result, err := position.Apply(current, fill, st.positionMethod)
+	if err != nil {
+		return nil, err
+	}
+	next := result.Position
+	var nextLots interface{}
+	if next.Lots != nil {
+		encoded, err := json.Marshal(next.Lots)
+		if err != nil {
+			return nil, err
+		}
+		nextLots = string(encoded)
+	}
+
+	// A position opened from flat belongs to the strategy that opened it
+	reopened := current.Quantity == 0 && next.Quantity != 0
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE positions
+		SET quantity = $2,
+		    average_entry_price = $3,
+		    realized_pnl = $4,
+		    lots = `+st.dialect.jsonParam("$5")+`,
+		    unrealized_pnl = CASE WHEN $2 = 0 THEN 0
+		                          WHEN current_price IS NULL THEN NULL
+		                          ELSE (current_price - $3) * $2 END,
+		    strategy_name = CASE WHEN $6 THEN $7 ELSE strategy_name END,
+		    opened_at = CASE WHEN $6 THEN $8 ELSE opened_at END,
+		    last_updated = $8
+		WHERE id = $1
+	`, id, next.Quantity, next.AvgEntryPrice, next.RealizedPnL, nextLots, reopened, strategy, time.Now()); err != nil {
+		return nil, err
+	}
+
+	match, err := st.applyStrategyFill(ctx, tx, strategy, symbol, orderID, fill, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE trades
+		SET booked_quantity = $2, booked_notional = $3, booked_fees = $4,
+		    pnl = CASE WHEN $6 THEN COALESCE(pnl, 0) + $5 ELSE pnl END
+		WHERE order_id = $1
+	`, orderID, filled, notional, math.Max(fees, bookedFees), match.Realized, match.ClosedQty > 0); err != nil {
+		return nil, err
+	}
+
+	return &bookedFill{
+		Symbol:       symbol,
+		Account:      account,
+		Strategy:     strategy,
+		Quantity:     quantity,
+		Realized:     result.Realized,
+		Remaining:    next.Quantity,
+		TradePnL:     match.Realized,
+		PrevNotional: math.Abs(current.Quantity * current.AvgEntryPrice),
+		Notional:     math.Abs(next.Quantity * next.AvgEntryPrice),
+	}, nil
+}
+
+// bookExecution books an order the exchange reported trading. Execution reports
+// carry the exchange's order ID; the order is refreshed from the exchange, which
+// records the fill and books it.
+func (s *Server) bookExecution(ctx context.Context, key, exchangeOrderID string) {
+	exchange, account := splitExchangeKey(key)
+	var orderID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT order_id FROM trades
+		WHERE exchange_order_id = $1 AND exchange = $2 AND account = $3
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, exchangeOrderID, exchange, account).Scan(&orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return // placed outside the engine, or not recorded yet
+	}
+	if err != nil {
+		logEvent(ctx, "Failed to look up executed order", "exchange", key, "exchange_order_id", exchangeOrderID, "error", err)
+		return
+	}
+	if _, err := s.refreshOrderStatus(ctx, orderID); err != nil {
+		logEvent(ctx, "Failed to refresh executed order", "order_id", orderID, "error", err)
+	}
+}
+
+// followExecutions keeps the account streams of exchanges that push them open for
+// the life of the server, booking each trade execution they report
+func (s *Server) followExecutions() {
+	if s.db == nil {
+		return
+	}
+	s.mu.RLock()
+	managers := make(map[string]*AccountStreamManager)
+	for key, exchange := range s.exchanges {
+		if streamer, ok := exchange.(accountStreamer); ok && streamer.AccountStream() != nil {
+			managers[key] = streamer.AccountStream()
+		}
+	}
+	s.mu.RUnlock()
+
+	for key, manager := range managers {
+		go s.followAccountExecutions(key, manager)
+	}
+}
+
+func (s *Server) followAccountExecutions(key string, manager *AccountStreamManager) {
+	for s.streamCtx.Err() == nil {
+		sub := manager.subscribe()
+		for update := range sub.send {
+			if update.ExecutedOrderID != "" {
+				s.bookExecution(s.streamCtx, key, update.ExecutedOrderID)
+			}
+		}
+		manager.unsubscribe(sub)
+		if !sub.dropped {
+			return // the manager was closed
+		}
+		logEvent(s.streamCtx, "Execution follower fell behind, resubscribing", "exchange", key)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PriceCache holds last prices from GetAllTickers for USD valuation of balances.
+// The ticker list is refreshed lazily once it is older than maxAge.
+type PriceCache struct {
+	fetch     func() ([]TickerData, error)
+	maxAge    time.Duration
+	prices    map[string]float64
+	fetchedAt time.Time
+	mu        sync.Mutex
+}
+
+func NewPriceCache(fetch func() ([]TickerData, error), maxAge time.Duration) *PriceCache {
+	return &PriceCache{
+		fetch:  fetch,
+		maxAge: maxAge,
+		prices: make(map[string]float64),
+	}
+}
+
+// usdStablecoins are valued at 1 USD without a lookup
+var usdStablecoins = map[string]bool{
+	"USD": true, "USDT": true, "USDC": true, "BUSD": true, "FDUSD": true, "TUSD": true, "DAI": true,
+}
+
+// bridgeAssets are tried in order for assets without a direct USDT pair
+var bridgeAssets = []string{"BTC", "ETH", "BNB"}
+
+// snapshot returns a fresh price map, refreshing from the exchange when stale
+func (pc *PriceCache) snapshot() (map[string]float64, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if time.Since(pc.fetchedAt) <= pc.maxAge {
+		return pc.prices, nil
+	}
+
+	tickers, err := pc.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh ticker prices: %w", err)
+	}
+
+	prices := make(map[string]float64, len(tickers))
+	for _, t := range tickers {
+		if t.Price > 0 {
+			prices[t.Symbol] = t.Price
+		}
+	}
+	pc.prices = prices
+	pc.fetchedAt = time.Now()
+	return prices, nil
+}
+
+// usdPrice resolves an asset to USD via <asset>USDT or a BTC/ETH/BNB bridge
+func usdPrice(asset string, prices map[string]float64) (float64, bool) {
+	if usdStablecoins[asset] {
+		return 1, true
+	}
+	if p, ok := prices[asset+"USDT"]; ok {
+		return p, true
+	}
+	for _, bridge := range bridgeAssets {
+		bridgeUSD, ok := prices[bridge+"USDT"]
+		if !ok {
+			continue
+		}
+		if p, ok := prices[asset+bridge]; ok {
+			return p * bridgeUSD, true
+		}
+		if p, ok := prices[bridge+asset]; ok && p > 0 {
+			return bridgeUSD / p, true
+		}
+	}
+	return 0, false
+}
+
+// Value fills AssetBalance.ValueUSD and Balance.TotalValueUSD. Assets that cannot be
+// priced (no pair, or the ticker cache is stale and cannot be refreshed) are listed in
+// Balance.UnpricedAssets instead of being silently valued at zero.
+func (pc *PriceCache) Value(balance *Balance) {
+	prices, err := pc.snapshot()
+
+	balance.TotalValueUSD = 0
+	balance.UnpricedAssets = nil
+
+	for asset, bal := range balance.Balances {
+		price, ok := 0.0, false
+		if err == nil {
+			price, ok = usdPrice(asset, prices)
+		}
+		if !ok {
+			balance.UnpricedAssets = append(balance.UnpricedAssets, asset)
+			continue
+		}
+
+		// Net of margin debt so the total reflects account equity
+		bal.ValueUSD = (bal.Total - bal.Borrowed - bal.Interest) * price
+		balance.Balances[asset] = bal
+		balance.TotalValueUSD += bal.ValueUSD
+	}
+
+	sort.Strings(balance.UnpricedAssets)
+}
+
+// fetchBalance gets an exchange balance with USD valuation applied
+func (s *Server) fetchBalance(ctx context.Context, exchange Exchange) (*Balance, error) {
+	balance, err := exchange.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.prices != nil {
+		s.prices.Value(balance)
+	}
+	return balance, nil
+}
+
+// filterBalance keeps only the requested assets (all when empty) and drops priced assets
+// worth less than minValueUSD. Unpriced assets are kept since their value is unknown.
+// TotalValueUSD is recomputed over the remaining assets.
+func filterBalance(balance *Balance, assets []string, minValueUSD float64) {
+	if len(assets) == 0 && minValueUSD <= 0 {
+		return
+	}
+
+	wanted := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		wanted[strings.ToUpper(asset)] = true
+	}
+
+	unpriced := make(map[string]bool, len(balance.UnpricedAssets))
+	for _, asset := range balance.UnpricedAssets {
+		unpriced[asset] = true
+	}
+
+	balance.TotalValueUSD = 0
+	for asset, bal := range balance.Balances {
+		if len(wanted) > 0 && !wanted[asset] {
+			delete(balance.Balances, asset)
+			continue
+		}
+		if minValueUSD > 0 && !unpriced[asset] && bal.ValueUSD < minValueUSD {
+			delete(balance.Balances, asset)
+			continue
+		}
+		balance.TotalValueUSD += bal.ValueUSD
+	}
+
+	kept := balance.UnpricedAssets[:0]
+	for _, asset := range balance.UnpricedAssets {
+		if _, ok := balance.Balances[asset]; ok {
+			kept = append(kept, asset)
+		}
+	}
+	balance.UnpricedAssets = kept
+}
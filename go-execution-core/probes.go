@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readinessDBTimeout bounds the Postgres ping of one /readyz request
+const readinessDBTimeout = 2 * time.Second
+
+// Liveness and readiness are separate so that a dependency outage takes the
+// engine out of rotation (/readyz fails) without getting it restarted (/livez
+// keeps passing). /livez must only fail when the process itself is wedged.
+
+// listen binds a server's port up front, so readiness can be marked only once
+// both servers are accepting connections
+func listen(name, port string) net.Listener {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s port %s: %v", name, port, err)
+	}
+	return lis
+}
+
+// markReady is called once the exchange registry is built and the gRPC and HTTP
+// listeners are bound; shutdown clears it so traffic drains away first
+func (s *Server) markReady() {
+	s.started.Store(true)
+	log.Println("✓ Ready to serve traffic")
+}
+
+// handleLivez reports that the process is up. It checks no dependencies: that
+// the handler runs at all shows the HTTP server is scheduling requests.
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "alive",
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// handleReadyz reports whether the engine can take traffic: startup finished,
+// Postgres answers, and at least one exchange is configured and orderable.
+// 503 lists the failing checks. Unresolved CRITICAL risk events set "degraded"
+// without failing readiness: the engine is needed to deal with them.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := s.readiness(r.Context())
+	status := http.StatusOK
+	body := map[string]interface{}{"status": "ready", "checks": checks, "degraded": false}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body["status"] = "not_ready"
+	}
+	if s.db != nil && checks["database"] == "ok" {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessDBTimeout)
+		critical, err := s.unresolvedCriticalRiskEvents(ctx)
+		cancel()
+		if err != nil {
+			logEvent(r.Context(), "Failed to count critical risk events", "error", err)
+		} else if critical > 0 {
+			body["degraded"] = true
+			body["critical_risk_events"] = critical
+		}
+	}
+	writeJSON(w, status, body)
+}
+
+// readiness runs the /readyz checks; each maps to "ok" or the reason it failed
+func (s *Server) readiness(ctx context.Context) (bool, map[string]string) {
+	checks := make(map[string]string)
+	ready := true
+	fail := func(check, reason string) {
+		checks[check] = reason
+		ready = false
+	}
+
+	if s.started.Load() {
+		checks["startup"] = "ok"
+	} else {
+		fail("startup", "starting or shutting down")
+	}
+	if s.grpcListening.Load() {
+		checks["grpc"] = "ok"
+	} else {
+		fail("grpc", "listener not bound")
+	}
+
+	switch {
+	case s.db != nil && !s.dbConnected.Load():
+		fail("database", "not connected")
+	case s.db != nil:
+		pingCtx, cancel := context.WithTimeout(ctx, readinessDBTimeout)
+		err := s.db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			fail("database", err.Error())
+		} else {
+			checks["database"] = "ok"
+		}
+	case s.config.DatabaseURL != "":
+		fail("database", "not connected")
+	default:
+		checks["database"] = "disabled"
+	}
+
+	s.mu.RLock()
+	names := make([]string, 0, len(s.exchanges))
+	for name := range s.exchanges {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	healthy := 0
+	for _, name := range names {
+		if s.health.CheckOrderable(name) == nil {
+			healthy++
+		}
+	}
+	switch {
+	case len(names) == 0:
+		fail("exchanges", "none configured")
+	case healthy == 0:
+		fail("exchanges", "none healthy")
+	default:
+		checks["exchanges"] = "ok"
+	}
+	return ready, checks
+}
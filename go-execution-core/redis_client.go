@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisOptions builds the client options from REDIS_URL, which is either host:port
+// or a redis:// or rediss:// (TLS) URL carrying the username, password and
+// database, and the REDIS_* settings, which take precedence over the URL
+func redisOptions(config *Config) (*redis.Options, error) {
+	opts := &redis.Options{Addr: config.RedisURL}
+	if strings.Contains(config.RedisURL, "://") {
+		parsed, err := redis.ParseURL(config.RedisURL)
+		if err != nil {
+			// The URL may hold the password, so it is not repeated
+			return nil, errors.New("REDIS_URL must be host:port or a redis:// or rediss:// URL")
+		}
+		opts = parsed
+	}
+	opts.DialTimeout = 5 * time.Second
+	opts.ReadTimeout = 3 * time.Second
+	opts.WriteTimeout = 3 * time.Second
+	opts.PoolSize = 10
+
+	if config.RedisUsername != "" {
+		opts.Username = config.RedisUsername
+	}
+	if config.RedisPassword != "" {
+		opts.Password = config.RedisPassword
+	}
+	if config.RedisDB >= 0 {
+		opts.DB = config.RedisDB
+	}
+
+	if config.RedisTLS || opts.TLSConfig != nil {
+		tlsConfig, err := redisTLSConfig(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+// redisTLSConfig is the TLS setup of the connection: the server verified against
+// REDIS_TLS_CA_FILE (else the system roots) unless REDIS_TLS_INSECURE_SKIP_VERIFY,
+// and a client certificate when REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE are set
+func redisTLSConfig(config *Config, opts *redis.Options) (*tls.Config, error) {
+	tlsConfig := opts.TLSConfig
+	if tlsConfig == nil {
+		host, _, err := net.SplitHostPort(opts.Addr)
+		if err != nil {
+			host = opts.Addr
+		}
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	tlsConfig.InsecureSkipVerify = config.RedisTLSInsecureSkipVerify
+
+	if config.RedisTLSCAFile != "" {
+		pem, err := os.ReadFile(config.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("REDIS_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("REDIS_TLS_CA_FILE: no PEM certificates in %s", config.RedisTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (config.RedisTLSCertFile == "") != (config.RedisTLSKeyFile == "") {
+		return nil, errors.New("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+	if config.RedisTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.RedisTLSCertFile, config.RedisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("REDIS_TLS_CERT_FILE/REDIS_TLS_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// redisErrorKind classifies a failed connection for the startup warning:
+// authentication (credentials refused), tls (handshake or certificate),
+// network (unreachable, refused, timed out) or other
+func redisErrorKind(err error) string {
+	msg := err.Error()
+	for _, prefix := range []string{"WRONGPASS", "NOAUTH", "NOPERM"} {
+		if strings.HasPrefix(msg, prefix) {
+			return "authentication"
+		}
+	}
+	// ERR invalid password, ERR AUTH <password> called without any password configured, ...
+	if strings.HasPrefix(msg, "ERR") && (strings.Contains(msg, "AUTH") || strings.Contains(msg, "password")) {
+		return "authentication"
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || strings.HasPrefix(msg, "tls:") {
+		return "tls"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return "network"
+	}
+	return "other"
+}
+
+// redisConnectHint suggests what to check for a kind of connection failure
+func redisConnectHint(kind string) string {
+	switch kind {
+	case "authentication":
+		return "check REDIS_USERNAME and REDIS_PASSWORD (or the credentials in REDIS_URL)"
+	case "tls":
+		return "check REDIS_TLS and REDIS_TLS_CA_FILE, or whether the server expects TLS at all"
+	case "network":
+		return "check REDIS_URL and that the server is reachable"
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+)
+
+// batchBodyRoutes take many orders per request and get MAX_BATCH_BODY_BYTES
+// instead of MAX_REQUEST_BODY_BYTES
+var batchBodyRoutes = map[string]bool{
+	"/api/v1/orders/batch":       true,
+	"/api/v1/order_status/batch": true,
+}
+
+// bodyLimit is the largest request body accepted on path
+func (s *Server) bodyLimit(path string) int64 {
+	if batchBodyRoutes[path] {
+		return s.config.MaxBatchBodyBytes
+	}
+	return s.config.MaxRequestBodyBytes
+}
+
+// limitRequestBody caps request bodies before any handler reads them. A declared
+// Content-Length over the limit is rejected up front; a chunked body is cut off by
+// http.MaxBytesReader, which handlers report through requestBodyError.
+func (s *Server) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.bodyLimit(r.URL.Path)
+		if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > limit {
+				writeBodyTooLarge(w, limit)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	writeJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+		"error":     "Request body too large",
+		"max_bytes": limit,
+	})
+}
+
+// requestBodyError answers a body read that failed because the body was too large
+// (413) or the client was too slow to send it (408) and reports whether it did;
+// any other error is left to the caller, usually as 400 Invalid JSON
+func requestBodyError(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeBodyTooLarge(w, tooLarge.Limit)
+		return true
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		writeJSON(w, http.StatusRequestTimeout, map[string]interface{}{
+			"error": "Timed out reading request body",
+		})
+		return true
+	}
+	return false
+}
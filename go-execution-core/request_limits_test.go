@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// batchBody is a batch of n mock orders, about 130 bytes each
+func batchBody(t *testing.T, n int) []byte {
+	t.Helper()
+	legs := make([]map[string]interface{}, n)
+	for i := range legs {
+		legs[i] = map[string]interface{}{
+			"order_id": fmt.Sprintf("leg-%d", i), "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1,
+		}
+	}
+	raw, err := json.Marshal(map[string]interface{}{"exchange": "mock", "orders": legs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// postRaw posts body as is; without a length the client sends it chunked
+func postRaw(t *testing.T, url string, body io.Reader) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestOversizedBatchRejected(t *testing.T) {
+	s, mock := newTestServer(t)
+	s.config.MaxRequestBodyBytes = 4 << 10
+	s.config.MaxBatchBodyBytes = 16 << 10
+	srv := serveTest(t, s)
+
+	tooLarge := batchBody(t, 200)
+	if len(tooLarge) <= 16<<10 {
+		t.Fatalf("oversized batch is only %d bytes", len(tooLarge))
+	}
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{"declared length", bytes.NewReader(tooLarge)},
+		{"chunked", io.MultiReader(bytes.NewReader(tooLarge))}, // hides the length
+	}
+	for _, tt := range tests {
+		code, body := postRaw(t, srv.URL+"/api/v1/orders/batch", tt.body)
+		if code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d: %v", tt.name, code, body)
+			continue
+		}
+		if body["error"] != "Request body too large" || body["max_bytes"] != float64(16<<10) {
+			t.Errorf("%s: body = %v", tt.name, body)
+		}
+	}
+	if got := mock.CallCount("SubmitOrder"); got != 0 {
+		t.Errorf("oversized batches submitted %d orders", got)
+	}
+
+	// Between the two limits: too large for a plain request, fine for a batch
+	midsize := batchBody(t, 50)
+	if len(midsize) <= 4<<10 || len(midsize) > 16<<10 {
+		t.Fatalf("midsize batch is %d bytes", len(midsize))
+	}
+	if code, body := postRaw(t, srv.URL+"/api/v1/orders/batch", bytes.NewReader(midsize)); code != http.StatusOK {
+		t.Errorf("batch under MAX_BATCH_BODY_BYTES: status %d: %v", code, body)
+	}
+	if code, body := postRaw(t, srv.URL+"/api/v1/orders", bytes.NewReader(midsize)); code != http.StatusRequestEntityTooLarge ||
+		body["max_bytes"] != float64(4<<10) {
+		t.Errorf("order over MAX_REQUEST_BODY_BYTES: status %d: %v", code, body)
+	}
+}
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	s, _ := newTestServer(t)
+	server := s.newHTTPServer()
+	if server.ReadHeaderTimeout != s.config.HTTPReadHeaderTimeout || server.ReadTimeout != s.config.HTTPReadTimeout ||
+		server.WriteTimeout != s.config.HTTPWriteTimeout || server.IdleTimeout != s.config.HTTPIdleTimeout {
+		t.Errorf("timeouts = %v/%v/%v/%v", server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+	if server.ReadHeaderTimeout <= 0 || server.ReadTimeout <= 0 || server.WriteTimeout <= 0 || server.IdleTimeout <= 0 {
+		t.Error("a default timeout is disabled")
+	}
+}
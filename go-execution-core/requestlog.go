@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestInfo follows a request through the middleware chain. It is stored as a
+// pointer so inner middleware (auth) can fill in the caller for the access log.
+type requestInfo struct {
+	ID     string
+	Caller string
+}
+
+const requestInfoContextKey contextKey = "request_info"
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
+
+// requestIDFromContext returns the request ID, or "" outside a request
+func requestIDFromContext(ctx context.Context) string {
+	if info := requestInfoFromContext(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// validRequestID accepts caller-supplied IDs that are safe to echo into logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// logEvent writes a key=value log line tagged with the request ID and caller from ctx
+func logEvent(ctx context.Context, msg string, kv ...interface{}) {
+	var b strings.Builder
+	b.WriteString("msg=")
+	b.WriteString(logValue(msg))
+	if info := requestInfoFromContext(ctx); info != nil {
+		b.WriteString(" request_id=" + info.ID)
+		if info.Caller != "" {
+			b.WriteString(" caller=" + logValue(info.Caller))
+		}
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&b, " %v=%s", kv[i], logValue(kv[i+1]))
+	}
+	log.Print(b.String())
+}
+
+// logValue formats a value, quoting it when it would break key=value parsing
+func logValue(v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case error:
+		s = value.Error()
+	case float64:
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(value)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// statusRecorder captures the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(p)
+	sr.bytes += n
+	return n, err
+}
+
+// Flush and Hijack keep streaming and WebSocket handlers working behind the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// requestLogging assigns each request an ID (honoring a valid incoming X-Request-ID),
+// returns it in the response headers and writes one access log line per request
+func (s *Server) requestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		info := &requestInfo{ID: id}
+		w.Header().Set(requestIDHeader, id)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		switch r.URL.Path {
+		case "/health", "/livez", "/readyz", "/metrics":
+			return
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logEvent(ctx, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes", recorder.bytes,
+			"remote", r.RemoteAddr,
+		)
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "execution-engine/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// REST endpoints served by the gRPC methods, so the two APIs cannot drift:
+//
+//	POST /api/v1/orders                      SubmitOrder
+//	GET  /api/v1/market/{exchange}/{symbol}  GetMarketData
+//	GET  /api/v1/balance/{exchange}          GetBalance
+//
+// Each handler decodes the request into the method's message, calls the method
+// on Server directly (requireAuth has already checked the caller, who is in the
+// context) and renders the JSON the endpoint has always returned. Failed calls
+// take the HTTP status grpc-gateway would give their code.
+
+// grpcHTTPStatus maps a gRPC status code to an HTTP status, as grpc-gateway does
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeGRPCError answers a failed call with {"error": message}
+func writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	writeJSON(w, grpcHTTPStatus(st.Code()), map[string]interface{}{
+		"error": st.Message(),
+	})
+}
+
+// handleSubmitOrder submits a new order through SubmitOrder. The Idempotency-Key
+// header travels as idempotency-key metadata.
+func (s *Server) handleSubmitOrder(w http.ResponseWriter, r *http.Request) {
+	var req orderSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(r.Header.Get(idempotencyHeader)) > maxIdempotencyKeyLen {
+		http.Error(w, fmt.Sprintf("%s must be at most %d characters", idempotencyHeader, maxIdempotencyKeyLen), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if key := r.Header.Get(idempotencyHeader); key != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(idempotencyMetadata, key))
+	}
+	resp, err := s.SubmitOrder(ctx, &pb.OrderRequest{
+		OrderId:        req.OrderID,
+		StrategyName:   req.StrategyName,
+		Symbol:         req.Symbol,
+		Side:           req.Side,
+		Quantity:       req.Quantity,
+		Price:          req.Price,
+		OrderType:      req.OrderType,
+		Exchange:       req.Exchange,
+		Account:        req.Account,
+		ReduceOnly:     req.ReduceOnly,
+		PositionSide:   req.PositionSide,
+		AccountType:    req.AccountType,
+		SideEffectType: req.SideEffectType,
+	})
+	if err != nil {
+		st := status.Convert(err)
+		code := grpcHTTPStatus(st.Code())
+		if st.Code() == codes.AlreadyExists {
+			code = http.StatusUnprocessableEntity // idempotency key reused for a different order
+		}
+		writeJSON(w, code, map[string]interface{}{
+			"success": false,
+			"error":   st.Message(),
+		})
+		return
+	}
+
+	switch resp.RejectReason {
+	case rejectValidation:
+		errs := make(validationError, len(resp.FieldErrors))
+		for i, fe := range resp.FieldErrors {
+			errs[i] = FieldError{Field: fe.Field, Message: fe.Message}
+		}
+		writeValidationError(w, errs)
+	case rejectExchangeNotConfigured:
+		writeJSON(w, http.StatusBadRequest, orderResponseJSON(resp))
+	case rejectExchangeUnavailable:
+		writeJSON(w, http.StatusServiceUnavailable, orderResponseJSON(resp))
+	default:
+		if resp.Replayed {
+			w.Header().Set(replayedHeader, "true")
+		}
+		writeJSON(w, http.StatusOK, orderResponseJSON(resp))
+	}
+}
+
+// handleGetMarketData fetches market data through GetMarketData; ?force=true
+// skips the market data cache
+func (s *Server) handleGetMarketData(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/market/"), "/")
+	if len(parts) < 2 {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+
+	exchange := parts[0]
+	symbol := parts[1]
+	if symbol == "tickers" {
+		s.handleGetTickers(w, r, exchange)
+		return
+	}
+	if exchange == "" {
+		writeGRPCError(w, status.Error(codes.FailedPrecondition, "exchange required"))
+		return
+	}
+
+	ctx := r.Context()
+	if r.URL.Query().Get("force") == "true" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(cacheBypassMetadata, "true"))
+	}
+	data, err := s.GetMarketData(ctx, &pb.MarketDataRequest{Symbol: symbol, Exchange: exchange})
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"symbol":           data.Symbol,
+		"exchange":         data.Exchange,
+		"price":            data.Price,
+		"bid":              data.Bid,
+		"ask":              data.Ask,
+		"volume_24h":       data.Volume_24H,
+		"high_24h":         data.High_24H,
+		"low_24h":          data.Low_24H,
+		"price_change_24h": data.PriceChange_24H,
+		"timestamp":        data.Timestamp.AsTime().Local().Format(time.RFC3339),
+		"age_ms":           time.Since(data.Timestamp.AsTime()).Milliseconds(),
+	})
+}
+
+// handleGetBalance fetches account balance through GetBalance:
+// ?assets=BTC,ETH&min_value_usd=1&account=alpha|all&force=true
+func (s *Server) handleGetBalance(w http.ResponseWriter, r *http.Request) {
+	exchange := strings.TrimPrefix(r.URL.Path, "/api/v1/balance/")
+	if exchange == "" {
+		writeGRPCError(w, status.Error(codes.FailedPrecondition, "exchange required"))
+		return
+	}
+
+	req := &pb.BalanceRequest{
+		Exchange: exchange,
+		Account:  r.URL.Query().Get("account"),
+		// force=true skips the balance cache, e.g. right after an external transfer
+		Force: r.URL.Query().Get("force") == "true",
+	}
+	if raw := r.URL.Query().Get("min_value_usd"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			writeGRPCError(w, status.Error(codes.InvalidArgument, "min_value_usd must be a non-negative number"))
+			return
+		}
+		req.MinValueUsd = parsed
+	}
+	if raw := r.URL.Query().Get("assets"); raw != "" {
+		for _, asset := range strings.Split(raw, ",") {
+			if asset = strings.TrimSpace(asset); asset != "" {
+				req.Assets = append(req.Assets, asset)
+			}
+		}
+	}
+
+	resp, err := s.GetBalance(r.Context(), req)
+	if err != nil {
+		writeGRPCError(w, err)
+		return
+	}
+
+	balance := &Balance{
+		Balances:       make(map[string]AssetBalance, len(resp.Balances)),
+		UnpricedAssets: resp.UnpricedAssets,
+	}
+	for asset, bal := range resp.Balances {
+		balance.Balances[asset] = AssetBalance{
+			Asset:    bal.Asset,
+			Free:     bal.Free,
+			Locked:   bal.Locked,
+			Total:    bal.Total,
+			ValueUSD: bal.ValueUsd,
+			Borrowed: bal.Borrowed,
+			Interest: bal.Interest,
+		}
+	}
+	fetchedAt := resp.Timestamp.AsTime().Local()
+
+	response := map[string]interface{}{
+		"exchange":        resp.Exchange,
+		"accounts":        resp.Accounts,
+		"balances":        assetBalancesJSON(balance),
+		"total_value_usd": resp.TotalValueUsd,
+		"unpriced_assets": unpricedAssetsJSON(balance),
+		"timestamp":       fetchedAt.Format(time.RFC3339),
+		"fetched_at":      fetchedAt.Format(time.RFC3339Nano),
+		"cached":          resp.Cached,
+	}
+	if resp.MarginLevel > 0 {
+		response["margin_level"] = resp.MarginLevel
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// anyValue matches whatever the response holds under a key, for values such as
+// timestamps and exchange order IDs that differ between runs
+const anyValue = "<any>"
+
+// TestRESTGatewayContract checks that the endpoints served through the gRPC
+// methods answer with the status and JSON the hand-written handlers returned.
+// want is the old body; added lists the keys the gateway may add on top of it.
+func TestRESTGatewayContract(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.FillPrice = 30000
+	mock.FeeRate = 0.001
+	mock.SymbolErrors["DOGEUSDT"] = ErrMockInsufficientBalance
+	s.exchanges["down"] = NewMockExchange()
+	s.health = NewHealthMonitor(time.Minute, 0)
+	s.health.record("down", 0, errors.New("connection refused"))
+	srv := serveTest(t, s)
+
+	order := func(id, symbol, exchange string) map[string]interface{} {
+		return map[string]interface{}{
+			"order_id": id, "strategy_name": "momentum", "symbol": symbol,
+			"side": "BUY", "quantity": 0.5, "exchange": exchange,
+		}
+	}
+	invalid := order("ord-5", "BTCUSDT", "mock")
+	invalid["quantity"] = -1
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		want   map[string]interface{}
+		added  map[string]interface{}
+	}{
+		{
+			name: "order filled", method: http.MethodPost, path: "/api/v1/orders", body: order("ord-1", "BTCUSDT", "mock"),
+			status: http.StatusOK,
+			want: map[string]interface{}{
+				"success": true, "order_id": "ord-1", "exchange_order_id": anyValue, "status": "FILLED",
+				"executed_price": 30000.0, "executed_quantity": 0.5, "fees": 15.0,
+			},
+		},
+		{
+			name: "order rejected by the exchange", method: http.MethodPost, path: "/api/v1/orders", body: order("ord-2", "DOGEUSDT", "mock"),
+			status: http.StatusOK,
+			want:   map[string]interface{}{"success": false, "error": ErrMockInsufficientBalance.Error()},
+		},
+		{
+			name: "exchange not configured", method: http.MethodPost, path: "/api/v1/orders", body: order("ord-3", "BTCUSDT", "kraken"),
+			status: http.StatusBadRequest,
+			want:   map[string]interface{}{"success": false, "error": "Exchange kraken not configured"},
+			added:  map[string]interface{}{"reject_reason": rejectExchangeNotConfigured},
+		},
+		{
+			name: "exchange failing health probes", method: http.MethodPost, path: "/api/v1/orders", body: order("ord-4", "BTCUSDT", "down"),
+			status: http.StatusServiceUnavailable,
+			want:   map[string]interface{}{"success": false, "error": anyValue},
+			added:  map[string]interface{}{"reject_reason": rejectExchangeUnavailable},
+		},
+		{
+			name: "order failing validation", method: http.MethodPost, path: "/api/v1/orders", body: invalid,
+			status: http.StatusUnprocessableEntity,
+			want:   map[string]interface{}{"success": false, "error": "Order validation failed", "errors": anyValue},
+		},
+		{
+			name: "market data", method: http.MethodGet, path: "/api/v1/market/mock/BTCUSDT",
+			status: http.StatusOK,
+			want: map[string]interface{}{
+				"symbol": "BTCUSDT", "exchange": "mock", "price": 30000.0, "bid": anyValue, "ask": anyValue,
+				"volume_24h": anyValue, "high_24h": anyValue, "low_24h": anyValue, "price_change_24h": anyValue,
+				"timestamp": anyValue,
+			},
+			added: map[string]interface{}{"age_ms": anyValue},
+		},
+		{
+			name: "market data on an unconfigured exchange", method: http.MethodGet, path: "/api/v1/market/kraken/BTCUSDT",
+			status: http.StatusBadRequest,
+			want:   map[string]interface{}{"error": "Exchange kraken not configured"},
+		},
+		{
+			name: "balance", method: http.MethodGet, path: "/api/v1/balance/mock",
+			status: http.StatusOK,
+			want: map[string]interface{}{
+				"exchange": "mock", "accounts": anyValue, "balances": anyValue, "total_value_usd": 40000.0,
+				"unpriced_assets": anyValue, "timestamp": anyValue, "fetched_at": anyValue, "cached": false,
+			},
+		},
+		{
+			name: "balance with a bad dust threshold", method: http.MethodGet, path: "/api/v1/balance/mock?min_value_usd=-1",
+			status: http.StatusBadRequest,
+			want:   map[string]interface{}{"error": "min_value_usd must be a non-negative number"},
+		},
+		{
+			name: "balance on an unconfigured exchange", method: http.MethodGet, path: "/api/v1/balance/kraken",
+			status: http.StatusBadRequest,
+			want:   map[string]interface{}{"error": "Exchange kraken not configured"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := doJSON(t, srv, tt.method, tt.path, tt.body)
+			if code != tt.status {
+				t.Fatalf("status %d, want %d: %v", code, tt.status, body)
+			}
+			for key, want := range tt.want {
+				got, ok := body[key]
+				if !ok {
+					t.Errorf("%s missing", key)
+				} else if want != anyValue && got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+			for key, got := range body {
+				if _, old := tt.want[key]; old {
+					continue
+				}
+				want, ok := tt.added[key]
+				if !ok {
+					t.Errorf("unexpected key %s = %v", key, got)
+				} else if want != anyValue && got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+			for key := range tt.added {
+				if _, ok := body[key]; !ok {
+					t.Errorf("%s missing", key)
+				}
+			}
+		})
+	}
+}
@@ -1,31 +1,38 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func (s *Server) registerRESTEndpoints(mux *http.ServeMux) {
-	// Order management
+	// Order management; submission, market data and balance are served by the
+	// gRPC methods (rest_gateway.go)
 	mux.HandleFunc("/api/v1/orders", s.handleOrders)
 	mux.HandleFunc("/api/v1/orders/", s.handleOrderByID)
 	mux.HandleFunc("/api/v1/orders/batch", s.handleBatchOrders)
 	mux.HandleFunc("/api/v1/orders/stop_loss", s.handleStopLoss)
 	mux.HandleFunc("/api/v1/orders/take_profit", s.handleTakeProfit)
+	mux.HandleFunc("/api/v1/trades/export", s.handleExportTrades)
 
 	// Market data
 	mux.HandleFunc("/api/v1/market/", s.handleGetMarketData)
+	mux.HandleFunc("/api/v1/orderbook/", s.handleGetOrderBook)
+	mux.HandleFunc("/api/v1/klines/", s.handleGetKlines)
 
 	// Balance
 	mux.HandleFunc("/api/v1/balance/", s.handleGetBalance)
 
 	// Order status
 	mux.HandleFunc("/api/v1/order_status", s.handleGetOrderStatus)
+	mux.HandleFunc("/api/v1/order_status/batch", s.handleBatchOrderStatus)
 }
 
 // handleOrders handles GET (list) and POST (submit)
@@ -42,143 +49,106 @@ func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
 
 // handleListOrders returns recent orders
 func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
-	limit := r.URL.Query().Get("limit")
-	if limit == "" {
-		limit = "50"
-	}
-
-	query := fmt.Sprintf(`
-		SELECT order_id, strategy_name, symbol, side, quantity, price, 
-		       executed_price, status, exchange, timestamp
-		FROM trades
-		ORDER BY timestamp DESC
-		LIMIT %s
-	`, limit)
-
-	rows, err := s.db.Query(query)
+	limit, err := parsePageSize(r.URL.Query().Get("limit"), 50)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"error": "Failed to fetch orders",
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
 		})
 		return
 	}
-	defer rows.Close()
 
-	orders := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var orderID, strategyName, symbol, side, status, exchange string
-		var quantity, price float64
-		var executedPrice sql.NullFloat64
-		var timestamp time.Time
-
-		if err := rows.Scan(&orderID, &strategyName, &symbol, &side, &quantity,
-			&price, &executedPrice, &status, &exchange, &timestamp); err != nil {
+	// Optional filters, combined with AND
+	filter := orderListFilter{Limit: limit}
+	filters := make(map[string]interface{})
+	for param, field := range map[string]*string{
+		"strategy_name": &filter.StrategyName,
+		"symbol":        &filter.Symbol,
+		"side":          &filter.Side,
+		"status":        &filter.Status,
+		"exchange":      &filter.Exchange,
+	} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
 			continue
 		}
-
-		order := map[string]interface{}{
-			"order_id":      orderID,
-			"strategy_name": strategyName,
-			"symbol":        symbol,
-			"side":          side,
-			"quantity":      quantity,
-			"price":         price,
-			"status":        status,
-			"exchange":      exchange,
-			"timestamp":     timestamp.Format(time.RFC3339),
-		}
-		if executedPrice.Valid {
-			order["executed_price"] = executedPrice.Float64
+		if param == "side" || param == "status" || param == "symbol" {
+			value = strings.ToUpper(value)
 		}
-
-		orders = append(orders, order)
-	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"orders": orders,
-		"count":  len(orders),
-	})
-}
-
-// handleSubmitOrder submits a new order
-func (s *Server) handleSubmitOrder(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		OrderID      string  `json:"order_id"`
-		StrategyName string  `json:"strategy_name"`
-		Symbol       string  `json:"symbol"`
-		Side         string  `json:"side"`
-		Quantity     float64 `json:"quantity"`
-		Price        float64 `json:"price"`
-		OrderType    string  `json:"order_type"`
-		Exchange     string  `json:"exchange"`
+		*field = value
+		filters[param] = value
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	for param, field := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param),
+			})
+			return
+		}
+		*field = t
+		filters[param] = t.Format(time.RFC3339)
 	}
 
-	log.Printf("HTTP Order: %s %s %.8f %s", req.Side, req.Symbol, req.Quantity, req.Exchange)
-
-	if req.Exchange == "" {
-		req.Exchange = "binance"
-	}
-	if req.OrderType == "" {
-		req.OrderType = "MARKET"
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		filter.Cursor = &cursor
 	}
 
-	s.mu.RLock()
-	exchange, exists := s.exchanges[req.Exchange]
-	s.mu.RUnlock()
-
-	if !exists {
-		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Exchange %s not configured", req.Exchange),
+	records, nextCursor, err := s.listOrders(r.Context(), filter)
+	if err != nil {
+		logEvent(r.Context(), "Failed to list orders", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch orders",
 		})
 		return
 	}
 
-	order := &Order{
-		ID:           req.OrderID,
-		Symbol:       req.Symbol,
-		Side:         req.Side,
-		Quantity:     req.Quantity,
-		Price:        req.Price,
-		OrderType:    req.OrderType,
-		StrategyName: req.StrategyName,
+	orders := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		order := map[string]interface{}{
+			"order_id":      record.OrderID,
+			"strategy_name": record.StrategyName,
+			"symbol":        record.Symbol,
+			"side":          record.Side,
+			"quantity":      record.Quantity,
+			"price":         record.Price,
+			"status":        record.Status,
+			"exchange":      record.Exchange,
+			"timestamp":     record.Timestamp.Format(time.RFC3339),
+		}
+		if record.AveragePrice > 0 {
+			order["executed_price"] = record.AveragePrice
+		}
+		orders = append(orders, order)
 	}
 
-	result, err := exchange.SubmitOrder(order)
-	if err != nil {
-		log.Printf("Order failed: %v", err)
-		writeJSON(w, http.StatusOK, map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
-		return
+	response := map[string]interface{}{
+		"orders":  orders,
+		"count":   len(orders),
+		"filters": filters,
 	}
-
-	if s.db != nil {
-		go s.logOrderToDB(req, result)
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success":           true,
-		"order_id":          req.OrderID,
-		"exchange_order_id": result.ExchangeOrderID,
-		"status":            result.Status,
-		"executed_price":    result.ExecutedPrice,
-		"executed_quantity": result.ExecutedQuantity,
-		"fees":              result.Fees,
-	})
+	writeJSON(w, http.StatusOK, response)
 }
 
 // handleOrderByID handles DELETE (cancel) and PUT (modify)
@@ -190,6 +160,8 @@ func (s *Server) handleOrderByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	switch r.Method {
+	case http.MethodGet:
+		s.handleGetOrder(w, r, orderID)
 	case http.MethodDelete:
 		s.handleCancelOrder(w, r, orderID)
 	case http.MethodPut:
@@ -199,49 +171,127 @@ func (s *Server) handleOrderByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleCancelOrder cancels an order
+// handleGetOrder returns an order's full trades row:
+// GET /api/v1/orders/{id}?refresh=true
+// With refresh the status is first brought up to date from the exchange.
+func (s *Server) handleGetOrder(w http.ResponseWriter, r *http.Request, orderID string) {
+	if !s.dbAvailable() {
+		http.Error(w, "Database not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	refresh := r.URL.Query().Get("refresh") == "true"
+	order, err := s.loadOrder(r.Context(), orderID, refresh)
+	if errors.Is(err, errOrderNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Order %s not found", orderID),
+		})
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to load order", "order_id", orderID, "error", err)
+		http.Error(w, "Failed to load order", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orderRecordJSON(order))
+}
+
+// handleCancelOrder cancels an order. Symbol, exchange and account come from the
+// query string or, for older clients, a JSON body; whatever is missing is looked
+// up from the trades table.
 func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request, orderID string) {
-	var req struct {
+	query := r.URL.Query()
+	req := struct {
 		Symbol   string `json:"symbol"`
 		Exchange string `json:"exchange"`
+		Account  string `json:"account"`
+	}{
+		Symbol:   query.Get("symbol"),
+		Exchange: query.Get("exchange"),
+		Account:  query.Get("account"),
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// The body is optional; an empty one decodes to io.EOF
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		if requestBodyError(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	// A recorded order is cancelled on the exchange by its exchange order ID
+	exchangeOrderID, recorded := orderID, false
+	cancelled := &Order{ID: orderID}
+	if s.db != nil {
+		stored, err := s.loadStoredOrder(r.Context(), orderID)
+		switch {
+		case err == nil:
+			recorded = true
+			cancelled.StrategyName, cancelled.Side = stored.StrategyName, stored.Side
+			if stored.ExchangeOrderID != "" {
+				exchangeOrderID = stored.ExchangeOrderID
+			}
+			if req.Symbol == "" {
+				req.Symbol = stored.Symbol
+			}
+			if req.Exchange == "" {
+				req.Exchange = stored.Exchange
+				if req.Account == "" {
+					req.Account = stored.Account
+				}
+			}
+		case errors.Is(err, errOrderNotFound):
+			if req.Symbol == "" {
+				writeJSON(w, http.StatusNotFound, map[string]interface{}{
+					"error": fmt.Sprintf("Order %s not found; pass symbol and exchange to cancel it", orderID),
+				})
+				return
+			}
+		default:
+			logEvent(r.Context(), "Failed to load order", "order_id", orderID, "error", err)
+			http.Error(w, "Failed to load order", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if req.Exchange == "" {
 		req.Exchange = "binance"
 	}
+	key := exchangeKey(normalizeExchangeAccount(req.Exchange, req.Account))
 
 	s.mu.RLock()
-	exchange, exists := s.exchanges[req.Exchange]
+	exchange, exists := s.exchanges[key]
 	s.mu.RUnlock()
 
 	if !exists {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"error": fmt.Sprintf("Exchange %s not configured", req.Exchange),
+			"error": fmt.Sprintf("Exchange %s not configured", key),
 		})
 		return
 	}
 
-	// Type assert to get CancelOrder method
-	binanceEx, ok := exchange.(*BinanceExchange)
-	if !ok {
+	cancelled.Symbol = req.Symbol
+	err := s.cancelOrder(r.Context(), key, exchange, cancelled, exchangeOrderID)
+	if errors.Is(err, errCancelUnsupported) {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"error": "Exchange does not support order cancellation",
 		})
 		return
 	}
-
-	if err := binanceEx.CancelOrder(req.Symbol, orderID); err != nil {
+	if err != nil {
+		logEvent(r.Context(), "Cancel failed", "order_id", orderID, "exchange", key, "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
 		})
 		return
 	}
+	if recorded {
+		s.markOrderCancelled(r.Context(), orderID)
+	}
+	logEvent(r.Context(), "HTTP cancel", "order_id", orderID, "symbol", req.Symbol, "exchange", key)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -249,51 +299,75 @@ func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request, order
 	})
 }
 
-// handleModifyOrder modifies an order
+// handleModifyOrder replaces an order with a limit order at a new quantity and
+// price, like the ModifyOrder RPC: symbol, exchange and side come from the trades
+// row, or the body for orders the engine did not record, and the exchange is asked
+// to replace the order by its exchange order ID.
 func (s *Server) handleModifyOrder(w http.ResponseWriter, r *http.Request, orderID string) {
 	var req struct {
 		Symbol      string  `json:"symbol"`
+		Side        string  `json:"side"`
 		NewQuantity float64 `json:"new_quantity"`
 		NewPrice    float64 `json:"new_price"`
 		Exchange    string  `json:"exchange"`
+		Account     string  `json:"account"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-
-	if req.Exchange == "" {
-		req.Exchange = "binance"
-	}
-
-	s.mu.RLock()
-	exchange, exists := s.exchanges[req.Exchange]
-	s.mu.RUnlock()
-
-	if !exists {
+	if req.NewQuantity <= 0 || req.NewPrice <= 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"error": fmt.Sprintf("Exchange %s not configured", req.Exchange),
+			"error": "new_quantity and new_price must be positive",
 		})
 		return
 	}
 
-	binanceEx, ok := exchange.(*BinanceExchange)
-	if !ok {
+	exchangeName := req.Exchange
+	if exchangeName != "" {
+		exchangeName = exchangeKey(normalizeExchangeAccount(req.Exchange, req.Account))
+	}
+	target, err := s.resolveOrderTarget(r.Context(), orderID, req.Symbol, exchangeName)
+	if err != nil {
+		writeOrderActionError(w, err)
+		return
+	}
+
+	replacement := &Order{
+		ID:        orderID,
+		Symbol:    target.symbol,
+		Side:      req.Side,
+		Quantity:  req.NewQuantity,
+		Price:     req.NewPrice,
+		OrderType: "LIMIT",
+	}
+	if target.stored != nil {
+		replacement.Side = target.stored.Side
+		replacement.StrategyName = target.stored.StrategyName
+	}
+	if replacement.Side != "BUY" && replacement.Side != "SELL" {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"error": "Exchange does not support order modification",
+			"error": "side (BUY or SELL) required for orders the engine did not record",
 		})
 		return
 	}
 
-	result, err := binanceEx.ModifyOrder(req.Symbol, orderID, req.NewQuantity, req.NewPrice)
+	result, err := s.modifyOrder(r.Context(), target.key, target.exchange, target.exchangeOrderID, replacement)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		logEvent(r.Context(), "Modify failed", "order_id", orderID, "exchange", target.key, "error", err)
+		if errors.Is(err, errReplacementFailed) {
+			s.markOrderCancelled(r.Context(), orderID)
+		}
+		writeOrderActionError(w, orderActionError(orderID, err))
 		return
 	}
+	s.recordOrderReplacement(r.Context(), replacement, result)
+	logEvent(r.Context(), "HTTP modify", "order_id", orderID, "exchange", target.key,
+		"new_exchange_order_id", result.ExchangeOrderID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":           true,
@@ -320,11 +394,18 @@ func (s *Server) handleBatchOrders(w http.ResponseWriter, r *http.Request) {
 			Quantity     float64 `json:"quantity"`
 			Price        float64 `json:"price"`
 			OrderType    string  `json:"order_type"`
+			ReduceOnly   bool    `json:"reduce_only"`
+			PositionSide string  `json:"position_side"`
 		} `json:"orders"`
 		Exchange string `json:"exchange"`
+		Account  string `json:"account"`
+		Atomic   bool   `json:"atomic"` // all legs or none: cancel open legs if any fails
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
@@ -332,23 +413,27 @@ func (s *Server) handleBatchOrders(w http.ResponseWriter, r *http.Request) {
 	if req.Exchange == "" {
 		req.Exchange = "binance"
 	}
+	key := exchangeKey(normalizeExchangeAccount(req.Exchange, req.Account))
 
 	s.mu.RLock()
-	exchange, exists := s.exchanges[req.Exchange]
+	exchange, exists := s.exchanges[key]
 	s.mu.RUnlock()
 
 	if !exists {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"error": fmt.Sprintf("Exchange %s not configured", req.Exchange),
+			"error": fmt.Sprintf("Exchange %s not configured", key),
 		})
 		return
 	}
 
-	results := make([]map[string]interface{}, 0)
-	successCount := 0
-
-	for _, orderReq := range req.Orders {
-		order := &Order{
+	// Validate every leg up front so a bad one rejects the batch before anything is placed
+	orders := make([]*Order, len(req.Orders))
+	var invalid validationError
+	for i, orderReq := range req.Orders {
+		if orderReq.OrderType == "" {
+			orderReq.OrderType = "MARKET"
+		}
+		orders[i] = &Order{
 			ID:           orderReq.OrderID,
 			Symbol:       orderReq.Symbol,
 			Side:         orderReq.Side,
@@ -356,32 +441,73 @@ func (s *Server) handleBatchOrders(w http.ResponseWriter, r *http.Request) {
 			Price:        orderReq.Price,
 			OrderType:    orderReq.OrderType,
 			StrategyName: orderReq.StrategyName,
+			ReduceOnly:   orderReq.ReduceOnly,
+			PositionSide: orderReq.PositionSide,
+		}
+		if errs := validateOrder(exchange, orders[i]); errs != nil {
+			invalid = append(invalid, errs.prefixed(fmt.Sprintf("orders[%d].", i))...)
 		}
+	}
+	if invalid != nil {
+		writeValidationError(w, invalid)
+		return
+	}
 
-		result, err := exchange.SubmitOrder(order)
-		if err != nil {
+	if err := s.health.CheckOrderable(key); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	batch := s.batchSubmit(r.Context(), key, exchange, orders, req.Atomic)
+
+	results := make([]map[string]interface{}, 0, len(batch.legs))
+	for i, leg := range batch.legs {
+		if leg.err != nil {
 			results = append(results, map[string]interface{}{
-				"order_id": orderReq.OrderID,
+				"order_id": req.Orders[i].OrderID,
 				"success":  false,
-				"error":    err.Error(),
+				"error":    leg.err.Error(),
 			})
 		} else {
-			successCount++
 			results = append(results, map[string]interface{}{
-				"order_id":          orderReq.OrderID,
+				"order_id":          req.Orders[i].OrderID,
 				"success":           true,
-				"exchange_order_id": result.ExchangeOrderID,
-				"status":            result.Status,
+				"exchange_order_id": leg.result.ExchangeOrderID,
+				"status":            leg.result.Status,
 			})
 		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	response := map[string]interface{}{
 		"total":   len(req.Orders),
-		"success": successCount,
-		"failed":  len(req.Orders) - successCount,
+		"success": batch.placed,
+		"failed":  len(req.Orders) - batch.placed,
 		"results": results,
-	})
+	}
+
+	if req.Atomic {
+		response["atomic"] = true
+		response["status"] = "COMPLETED"
+		if batch.unwound != nil {
+			// Unwound: every leg reports what became of it
+			for i, outcome := range batch.unwound {
+				results[i]["success"] = false
+				results[i]["leg_state"] = outcome.state
+				if outcome.err != nil {
+					results[i]["error"] = outcome.err.Error()
+				}
+			}
+			response["status"] = "FAILED"
+		} else {
+			for i := range results {
+				results[i]["leg_state"] = legSubmitted
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
 }
 
 // handleStopLoss creates a stop-loss order
@@ -401,6 +527,9 @@ func (s *Server) handleStopLoss(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
@@ -433,6 +562,9 @@ func (s *Server) handleTakeProfit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
@@ -447,16 +579,33 @@ func (s *Server) handleTakeProfit(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleGetMarketData fetches market data
-func (s *Server) handleGetMarketData(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/market/"), "/")
-	if len(parts) < 2 {
+// handleGetOrderBook returns the live order book maintained from depth streams;
+// /api/v1/orderbook/{symbol}/history is served by handleOrderBookHistory
+func (s *Server) handleGetOrderBook(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/orderbook/"), "/")
+	if len(parts) == 2 && parts[0] != "" && parts[1] == "history" {
+		s.handleOrderBookHistory(w, r, parts[0])
+		return
+	}
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
 		http.Error(w, "Invalid URL format", http.StatusBadRequest)
 		return
 	}
 
-	exchange := parts[0]
-	symbol := parts[1]
+	exchange := exchangeKey(normalizeExchangeAccount(parts[0], r.URL.Query().Get("account")))
+	symbol := strings.ToUpper(parts[1])
+
+	depth := 20
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > depthSnapshotLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("depth must be an integer between 1 and %d", depthSnapshotLimit),
+			})
+			return
+		}
+		depth = parsed
+	}
 
 	s.mu.RLock()
 	exchangeClient, exists := s.exchanges[exchange]
@@ -469,127 +618,133 @@ func (s *Server) handleGetMarketData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := exchangeClient.GetMarketData(symbol)
+	provider, ok := exchangeClient.(interface {
+		GetLiveOrderBook(symbol string) (*OrderBook, error)
+	})
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Exchange does not support live order books",
+		})
+		return
+	}
+
+	book, err := provider.GetLiveOrderBook(symbol)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": err.Error(),
 		})
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"symbol":           symbol,
-		"exchange":         exchange,
-		"price":            data.Price,
-		"bid":              data.Bid,
-		"ask":              data.Ask,
-		"volume_24h":       data.Volume24h,
-		"high_24h":         data.High24h,
-		"low_24h":          data.Low24h,
-		"price_change_24h": data.PriceChange,
-		"timestamp":        data.Timestamp.Format(time.RFC3339),
+		"exchange":       exchange,
+		"symbol":         symbol,
+		"bids":           orderBookLevelsJSON(book.Bids, depth),
+		"asks":           orderBookLevelsJSON(book.Asks, depth),
+		"last_update_id": book.LastUpdateID,
+		"timestamp":      book.Timestamp.Format(time.RFC3339Nano),
 	})
 }
 
-// handleGetBalance fetches account balance
-func (s *Server) handleGetBalance(w http.ResponseWriter, r *http.Request) {
-	exchange := strings.TrimPrefix(r.URL.Path, "/api/v1/balance/")
-
-	s.mu.RLock()
-	exchangeClient, exists := s.exchanges[exchange]
-	s.mu.RUnlock()
-
-	if !exists {
-		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"error": fmt.Sprintf("Exchange %s not configured", exchange),
-		})
-		return
+// orderBookLevelsJSON converts book levels to [price, quantity] pairs, truncated to depth
+func orderBookLevelsJSON(levels []OrderBookLevel, depth int) [][2]float64 {
+	if len(levels) > depth {
+		levels = levels[:depth]
 	}
-
-	balance, err := exchangeClient.GetBalance()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+	out := make([][2]float64, 0, len(levels))
+	for _, level := range levels {
+		out = append(out, [2]float64{level.Price, level.Quantity})
 	}
+	return out
+}
 
+// assetBalancesJSON converts balances to the JSON shape shared by the balance endpoints
+func assetBalancesJSON(balance *Balance) map[string]interface{} {
 	balances := make(map[string]interface{})
 	for asset, bal := range balance.Balances {
-		balances[asset] = map[string]float64{
-			"free":   bal.Free,
-			"locked": bal.Locked,
-			"total":  bal.Total,
+		entry := map[string]float64{
+			"free":      bal.Free,
+			"locked":    bal.Locked,
+			"total":     bal.Total,
+			"value_usd": bal.ValueUSD,
+		}
+		if bal.Borrowed > 0 || bal.Interest > 0 {
+			entry["borrowed"] = bal.Borrowed
+			entry["interest"] = bal.Interest
 		}
+		balances[asset] = entry
 	}
+	return balances
+}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"exchange":        exchange,
-		"balances":        balances,
-		"total_value_usd": balance.TotalValueUSD,
-		"timestamp":       balance.Timestamp.Format(time.RFC3339),
-	})
+// unpricedAssetsJSON returns a non-nil list so the field always encodes as an array
+func unpricedAssetsJSON(balance *Balance) []string {
+	if balance.UnpricedAssets == nil {
+		return []string{}
+	}
+	return balance.UnpricedAssets
 }
 
-// handleGetOrderStatus fetches order status
-func (s *Server) handleGetOrderStatus(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Query().Get("order_id")
-	if orderID == "" {
-		http.Error(w, "order_id required", http.StatusBadRequest)
-		return
+var errCancelUnsupported = errors.New("exchange does not support order cancellation")
+
+// submitOrder sends an order to the exchange and publishes the outcome to order
+// stream subscribers; shutdown waits for it to return
+func (s *Server) submitOrder(ctx context.Context, key string, exchange Exchange, order *Order) (*OrderResult, error) {
+	limits, err := s.riskLimits.Get(ctx)
+	if err != nil {
+		logEvent(ctx, "Failed to load risk limits, using last known", "error", err)
+	}
+	if err := checkOrderLimits(order, limits); err != nil {
+		s.recordRiskRejection(ctx, order, err)
+		return nil, err
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"order_id": orderID,
-		"status":   "FILLED",
-		"message":  "Order status tracking coming soon",
-	})
-}
+	s.exchangeCalls.Add(1)
+	defer s.exchangeCalls.Done()
 
-// logOrderToDB logs order to database
-func (s *Server) logOrderToDB(req interface{}, result *OrderResult) {
-	r, ok := req.(struct {
-		OrderID      string  `json:"order_id"`
-		StrategyName string  `json:"strategy_name"`
-		Symbol       string  `json:"symbol"`
-		Side         string  `json:"side"`
-		Quantity     float64 `json:"quantity"`
-		Price        float64 `json:"price"`
-		OrderType    string  `json:"order_type"`
-		Exchange     string  `json:"exchange"`
-	})
-	if !ok {
-		log.Println("Failed to log order: type assertion failed")
-		return
+	result, err := exchange.SubmitOrder(ctx, order)
+	s.publishOrderResult(key, order, result, err)
+	exchangeName, _ := splitExchangeKey(key)
+	status := "ERROR"
+	if err == nil && result != nil {
+		status = result.Status
 	}
+	ordersSubmitted.WithLabelValues(exchangeName, order.Side, status).Inc()
+	// Even a failed submission may have reached the exchange
+	s.invalidateBalance(ctx, key)
+	return result, err
+}
 
-	query := `
-		INSERT INTO trades
-		(order_id, strategy_name, symbol, side, quantity, price, executed_price,
-		 status, exchange, timestamp, executed_at, fees)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-	`
-
-	_, err := s.db.Exec(query,
-		r.OrderID,
-		r.StrategyName,
-		r.Symbol,
-		r.Side,
-		r.Quantity,
-		r.Price,
-		result.ExecutedPrice,
-		result.Status,
-		r.Exchange,
-		time.Now(),
-		result.Timestamp,
-		result.Fees,
-	)
+// cancelOrder cancels the exchange order exchangeOrderID through the optional
+// CancelOrder method (it is not part of Exchange) and publishes the cancellation
+// under order's engine ID, strategy and side, like modifyOrder does
+func (s *Server) cancelOrder(ctx context.Context, key string, exchange Exchange, order *Order, exchangeOrderID string) error {
+	s.exchangeCalls.Add(1)
+	defer s.exchangeCalls.Done()
 
-	if err != nil {
-		log.Printf("Failed to log order to database: %v", err)
-	} else {
-		log.Printf("✓ Order logged to database: %s", r.OrderID)
+	canceler, ok := exchange.(interface {
+		CancelOrder(ctx context.Context, symbol, orderID string) error
+	})
+	if !ok {
+		return errCancelUnsupported
+	}
+	err := canceler.CancelOrder(ctx, order.Symbol, exchangeOrderID)
+
+	if err == nil {
+		s.orderEvents.Publish(OrderEvent{
+			Type:            orderEventCancelled,
+			OrderID:         order.ID,
+			ExchangeOrderID: exchangeOrderID,
+			StrategyName:    order.StrategyName,
+			Symbol:          order.Symbol,
+			Side:            order.Side,
+			Exchange:        key,
+			Status:          "CANCELED",
+		})
+		// Cancelling releases locked funds
+		s.invalidateBalance(ctx, key)
 	}
+	return err
 }
 
 // writeJSON writes JSON response
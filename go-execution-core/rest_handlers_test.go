@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	pb "execution-engine/pb"
+)
+
+func TestSubmitOrderHandler(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.FillPrice = 30000
+	mock.FeeRate = 0.001
+	srv := serveTest(t, s)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT",
+		"side": "BUY", "quantity": 0.5, "exchange": "mock",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	if body["success"] != true || body["status"] != "FILLED" || body["executed_price"] != 30000.0 ||
+		body["executed_quantity"] != 0.5 || body["fees"] != 15.0 {
+		t.Errorf("response = %v", body)
+	}
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Errorf("SubmitOrder called %d times, want 1", got)
+	}
+
+	s.dbWrites.Wait()
+	var status string
+	var quantity float64
+	err := s.db.QueryRow(`SELECT status, quantity FROM trades WHERE order_id = $1`, "ord-1").Scan(&status, &quantity)
+	if err != nil {
+		t.Fatalf("trade not recorded: %v", err)
+	}
+	if status != "FILLED" || quantity != 0.5 {
+		t.Errorf("trade status %s quantity %g", status, quantity)
+	}
+
+	// Invalid orders are rejected before they reach the exchange
+	code, body = doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-2", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "HOLD", "quantity": 1, "exchange": "mock",
+	})
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid side: status %d: %v", code, body)
+	}
+	if got := mock.CallCount("SubmitOrder"); got != 1 {
+		t.Errorf("invalid order reached the exchange")
+	}
+}
+
+func TestSubmitOrderHandlerExchangeError(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.SymbolErrors["ETHUSDT"] = ErrMockInsufficientBalance
+	srv := serveTest(t, s)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-1", "strategy_name": "momentum", "symbol": "ETHUSDT", "side": "BUY", "quantity": 1, "exchange": "mock",
+	})
+	// Exchange failures are answered with 200 and success=false, like the gRPC response
+	if code != http.StatusOK || body["success"] != false {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	if msg, _ := body["error"].(string); msg != ErrMockInsufficientBalance.Error() {
+		t.Errorf("error = %q", msg)
+	}
+}
+
+func TestCancelOrderHandler(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.RestLimitOrders = true
+	srv := serveTest(t, s)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1,
+		"price": 25000, "order_type": "LIMIT", "exchange": "mock",
+	})
+	if code != http.StatusOK || body["status"] != "NEW" {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	exchangeOrderID, _ := body["exchange_order_id"].(string)
+
+	code, body = doJSON(t, srv, http.MethodDelete, "/api/v1/orders/"+exchangeOrderID+"?symbol=BTCUSDT&exchange=mock", nil)
+	if code != http.StatusOK || body["success"] != true {
+		t.Fatalf("cancel: status %d: %v", code, body)
+	}
+	status, err := mock.GetOrderStatus(context.Background(), exchangeOrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "CANCELED" {
+		t.Errorf("order status = %s, want CANCELED", status.Status)
+	}
+
+	// Cancelling again fails at the exchange; a filled order cannot be cancelled
+	mock.RestLimitOrders = false
+	_, filled := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-2", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1, "exchange": "mock",
+	})
+	filledID, _ := filled["exchange_order_id"].(string)
+	code, body = doJSON(t, srv, http.MethodDelete, "/api/v1/orders/"+filledID+"?symbol=BTCUSDT&exchange=mock", nil)
+	if code == http.StatusOK {
+		t.Errorf("cancelling a filled order: status %d: %v", code, body)
+	}
+
+	code, body = doJSON(t, srv, http.MethodDelete, "/api/v1/orders/unknown", nil)
+	if code != http.StatusNotFound {
+		t.Errorf("unknown order without symbol: status %d: %v", code, body)
+	}
+}
+
+func TestBatchOrdersHandlerPartialFailure(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.OrderErrors["leg-2"] = ErrMockTimeout
+	srv := serveTest(t, s)
+
+	legs := make([]map[string]interface{}, 3)
+	for i := range legs {
+		legs[i] = map[string]interface{}{
+			"order_id": []string{"leg-1", "leg-2", "leg-3"}[i], "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1,
+		}
+	}
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders/batch", map[string]interface{}{
+		"exchange": "mock", "orders": legs,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	if body["total"] != 3.0 || body["success"] != 2.0 || body["failed"] != 1.0 {
+		t.Errorf("counts = %v", body)
+	}
+	results, _ := body["results"].([]interface{})
+	if len(results) != 3 {
+		t.Fatalf("results = %v", body["results"])
+	}
+	for i, raw := range results {
+		result := raw.(map[string]interface{})
+		if result["order_id"] != legs[i]["order_id"] {
+			t.Errorf("results[%d] order_id = %v, want input order", i, result["order_id"])
+		}
+		wantSuccess := i != 1
+		if result["success"] != wantSuccess {
+			t.Errorf("results[%d] = %v", i, result)
+		}
+	}
+	if msg := results[1].(map[string]interface{})["error"]; msg != ErrMockTimeout.Error() {
+		t.Errorf("failed leg error = %v", msg)
+	}
+	if got := mock.CallCount("CancelOrder"); got != 0 {
+		t.Errorf("non-atomic batch cancelled %d legs", got)
+	}
+}
+
+func TestBalanceHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	code, body := doJSON(t, srv, http.MethodGet, "/api/v1/balance/mock", nil)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	balances, _ := body["balances"].(map[string]interface{})
+	btc, _ := balances["BTC"].(map[string]interface{})
+	usdt, _ := balances["USDT"].(map[string]interface{})
+	if btc["free"] != 1.0 || btc["value_usd"] != 30000.0 || usdt["total"] != 10000.0 {
+		t.Errorf("balances = %v", balances)
+	}
+	if body["total_value_usd"] != 40000.0 {
+		t.Errorf("total_value_usd = %v, want 40000", body["total_value_usd"])
+	}
+
+	code, body = doJSON(t, srv, http.MethodGet, "/api/v1/balance/kraken", nil)
+	if code == http.StatusOK {
+		t.Errorf("unconfigured exchange: status %d: %v", code, body)
+	}
+}
+
+// TestAtomicBatchThirdLegFails places five resting orders one at a time; the
+// third fails, so the two before it are cancelled and the last two never sent
+func TestAtomicBatchThirdLegFails(t *testing.T) {
+	s, mock := newTestServer(t)
+	s.config.BatchConcurrency = 1
+	mock.RestLimitOrders = true
+	mock.OrderErrors["leg-3"] = ErrMockInsufficientBalance
+	srv := serveTest(t, s)
+
+	legs := make([]map[string]interface{}, 5)
+	for i := range legs {
+		legs[i] = map[string]interface{}{
+			"order_id": fmt.Sprintf("leg-%d", i+1), "strategy_name": "momentum", "symbol": "BTCUSDT",
+			"side": "BUY", "quantity": 0.1, "price": 25000, "order_type": "LIMIT",
+		}
+	}
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders/batch", map[string]interface{}{
+		"exchange": "mock", "atomic": true, "orders": legs,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	if body["atomic"] != true || body["status"] != "FAILED" || body["total"] != 5.0 ||
+		body["success"] != 2.0 || body["failed"] != 3.0 {
+		t.Errorf("summary = %v", body)
+	}
+
+	want := []struct {
+		state string
+		err   string
+	}{
+		{legCancelled, ""},
+		{legCancelled, ""},
+		{legFailed, ErrMockInsufficientBalance.Error()},
+		{legNeverSubmitted, errBatchAborted.Error() + ", order not submitted"},
+		{legNeverSubmitted, errBatchAborted.Error() + ", order not submitted"},
+	}
+	results, _ := body["results"].([]interface{})
+	if len(results) != len(want) {
+		t.Fatalf("results = %v", body["results"])
+	}
+	for i, raw := range results {
+		result := raw.(map[string]interface{})
+		if result["order_id"] != legs[i]["order_id"] || result["success"] != false || result["leg_state"] != want[i].state {
+			t.Errorf("results[%d] = %v, want leg_state %s", i, result, want[i].state)
+		}
+		if msg, _ := result["error"].(string); msg != want[i].err {
+			t.Errorf("results[%d] error = %q, want %q", i, msg, want[i].err)
+		}
+		if i < 2 && result["exchange_order_id"] == nil {
+			t.Errorf("results[%d] lost its exchange_order_id", i)
+		}
+	}
+
+	if got := mock.CallCount("SubmitOrder"); got != 3 {
+		t.Errorf("exchange received %d orders, want 3", got)
+	}
+	for _, call := range mock.Calls() {
+		if call.Method != "CancelOrder" {
+			continue
+		}
+		status, err := mock.GetOrderStatus(context.Background(), call.Args[1].(string))
+		if err != nil || status.Status != "CANCELED" {
+			t.Errorf("unwound order %v: %+v, %v", call.Args[1], status, err)
+		}
+	}
+	if got := mock.CallCount("CancelOrder"); got != 2 {
+		t.Errorf("%d legs cancelled, want 2", got)
+	}
+}
+
+// TestAtomicBatchLeavesNothingOpen runs the same batch at full concurrency, where
+// any leg may already be placed when the third fails: none may be left resting
+func TestAtomicBatchLeavesNothingOpen(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.RestLimitOrders = true
+	mock.OrderErrors["leg-3"] = ErrMockInsufficientBalance
+	srv := serveTest(t, s)
+
+	legs := make([]map[string]interface{}, 5)
+	for i := range legs {
+		legs[i] = map[string]interface{}{
+			"order_id": fmt.Sprintf("leg-%d", i+1), "strategy_name": "momentum", "symbol": "BTCUSDT",
+			"side": "BUY", "quantity": 0.1, "price": 25000, "order_type": "LIMIT",
+		}
+	}
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders/batch", map[string]interface{}{
+		"exchange": "mock", "atomic": true, "orders": legs,
+	})
+	if code != http.StatusOK || body["status"] != "FAILED" {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	placed := mock.CallCount("SubmitOrder") - 1 // the failed leg
+	if got := mock.CallCount("CancelOrder"); got != placed {
+		t.Errorf("%d legs placed but %d cancelled", placed, got)
+	}
+	for i, raw := range body["results"].([]interface{}) {
+		switch state := raw.(map[string]interface{})["leg_state"]; state {
+		case legCancelled, legNeverSubmitted:
+		case legFailed:
+			if i != 2 {
+				t.Errorf("results[%d] failed", i)
+			}
+		default:
+			t.Errorf("results[%d] leg_state = %v", i, state)
+		}
+	}
+}
+
+// bookExchange is a MockExchange with a live order book
+type bookExchange struct {
+	*MockExchange
+	book *OrderBook
+}
+
+func (b *bookExchange) GetLiveOrderBook(symbol string) (*OrderBook, error) {
+	return b.book, nil
+}
+
+// TestOrderRoutesNamedAccount checks the order book and modify routes find an
+// account registered as exchange:account, named either way
+func TestOrderRoutesNamedAccount(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.exchanges["mock:alpha"] = &bookExchange{MockExchange: NewMockExchange(), book: &OrderBook{
+		Symbol: "BTCUSDT", Bids: []OrderBookLevel{{Price: 29999, Quantity: 1}}, Asks: []OrderBookLevel{{Price: 30001, Quantity: 2}},
+		LastUpdateID: 7, Timestamp: time.Now(),
+	}}
+	srv := serveTest(t, s)
+
+	for _, path := range []string{"/api/v1/orderbook/mock:alpha/btcusdt", "/api/v1/orderbook/mock/btcusdt?account=alpha"} {
+		code, body := doJSON(t, srv, http.MethodGet, path, nil)
+		if code != http.StatusOK || body["exchange"] != "mock:alpha" || body["last_update_id"] != 7.0 {
+			t.Errorf("%s: status %d: %v", path, code, body)
+		}
+	}
+
+	// Not configured would be a 404; the mock cannot modify orders
+	for _, modify := range []map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "BUY", "new_quantity": 1, "new_price": 29000, "exchange": "mock:alpha"},
+		{"symbol": "BTCUSDT", "side": "BUY", "new_quantity": 1, "new_price": 29000, "exchange": "mock", "account": "alpha"},
+	} {
+		code, body := doJSON(t, srv, http.MethodPut, "/api/v1/orders/ord-1", modify)
+		if code != http.StatusBadRequest || body["error"] != errModifyUnsupported.Error() {
+			t.Errorf("modify on %v: status %d: %v", modify["exchange"], code, body)
+		}
+	}
+}
+
+// modifyExchange is a mock that replaces orders, recording the exchange order IDs
+// it was asked to replace
+type modifyExchange struct {
+	*MockExchange
+	replaced []string
+	err      error
+}
+
+func (m *modifyExchange) ModifyOrder(ctx context.Context, orderID string, replacement *Order) (*OrderResult, error) {
+	m.replaced = append(m.replaced, orderID)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &OrderResult{OrderID: replacement.ID, ExchangeOrderID: "replacement-" + orderID, Status: "NEW", Timestamp: time.Now()}, nil
+}
+
+// TestModifyOrderHandler checks PUT /api/v1/orders/{id} replaces the stored order
+// by its exchange order ID on its own exchange and account, and answers refusals
+// with 400, 404, 409 or 502
+func TestModifyOrderHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	modifier := &modifyExchange{MockExchange: NewMockExchange()}
+	modifier.RestLimitOrders = true
+	s.exchanges["mock:alpha"] = modifier
+	srv := serveTest(t, s)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-1", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1,
+		"price": 25000, "order_type": "LIMIT", "exchange": "mock:alpha",
+	})
+	if code != http.StatusOK || body["status"] != "NEW" {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+	exchangeOrderID, _ := body["exchange_order_id"].(string)
+	s.dbWrites.Wait()
+
+	// Symbol, exchange and account come from the trades row
+	code, body = doJSON(t, srv, http.MethodPut, "/api/v1/orders/ord-1", map[string]interface{}{"new_quantity": 0.2, "new_price": 24000})
+	if code != http.StatusOK || body["new_order_id"] != "replacement-"+exchangeOrderID {
+		t.Fatalf("modify: status %d: %v", code, body)
+	}
+	if len(modifier.replaced) != 1 || modifier.replaced[0] != exchangeOrderID {
+		t.Errorf("exchange asked to replace %v, want [%s]", modifier.replaced, exchangeOrderID)
+	}
+
+	if code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+		"order_id": "ord-2", "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "BUY", "quantity": 0.1, "exchange": "mock:alpha",
+	}); code != http.StatusOK || body["status"] != "FILLED" {
+		t.Fatalf("submit: status %d: %v", code, body)
+	}
+	s.dbWrites.Wait()
+	maxNotional := 1000.0
+	if err := s.riskLimits.Set(context.Background(), map[string]*float64{"max_order_notional": &maxNotional}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		orderID string
+		body    map[string]interface{}
+		want    int
+	}{
+		{"zero quantity", "ord-1", map[string]interface{}{"new_quantity": 0, "new_price": 24000}, http.StatusBadRequest},
+		{"negative price", "ord-1", map[string]interface{}{"new_quantity": 0.01, "new_price": -1}, http.StatusBadRequest},
+		{"unknown order", "ord-x", map[string]interface{}{"new_quantity": 0.01, "new_price": 24000}, http.StatusNotFound},
+		{"exchange not configured", "ord-1", map[string]interface{}{"new_quantity": 0.01, "new_price": 24000, "exchange": "kraken"}, http.StatusNotFound},
+		{"filled order", "ord-2", map[string]interface{}{"new_quantity": 0.01, "new_price": 24000}, http.StatusConflict},
+		{"over max_order_notional", "ord-1", map[string]interface{}{"new_quantity": 1, "new_price": 24000}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := doJSON(t, srv, http.MethodPut, "/api/v1/orders/"+tt.orderID, tt.body); code != tt.want {
+				t.Errorf("status %d, want %d: %v", code, tt.want, body)
+			}
+		})
+	}
+	if len(modifier.replaced) != 1 {
+		t.Errorf("refused modifications reached the exchange: %v", modifier.replaced)
+	}
+
+	modifier.err = errors.New("connection reset")
+	code, body = doJSON(t, srv, http.MethodPut, "/api/v1/orders/ord-1", map[string]interface{}{"new_quantity": 0.01, "new_price": 24000})
+	if code != http.StatusBadGateway || body["success"] != false {
+		t.Errorf("exchange failure: status %d: %v", code, body)
+	}
+}
+
+// TestCancelOrderEvent checks cancellations reach strategy-filtered subscribers
+// under the engine order ID, over REST and gRPC
+func TestCancelOrderEvent(t *testing.T) {
+	s, mock := newTestServer(t)
+	mock.RestLimitOrders = true
+	srv := serveTest(t, s)
+	sub := s.orderEvents.subscribe(orderEventFilter{StrategyName: "momentum"})
+	defer s.orderEvents.unsubscribe(sub)
+
+	cancelled := func(orderID string) *OrderEvent {
+		t.Helper()
+		for {
+			select {
+			case msg := <-sub.send:
+				if ev, ok := msg.(*OrderEvent); ok && ev.Type == orderEventCancelled {
+					return ev
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no cancelled event for %s", orderID)
+			}
+		}
+	}
+
+	for _, via := range []string{"rest", "grpc"} {
+		orderID := "ord-" + via
+		code, body := doJSON(t, srv, http.MethodPost, "/api/v1/orders", map[string]interface{}{
+			"order_id": orderID, "strategy_name": "momentum", "symbol": "BTCUSDT", "side": "SELL", "quantity": 0.1,
+			"price": 35000, "order_type": "LIMIT", "exchange": "mock",
+		})
+		if code != http.StatusOK {
+			t.Fatalf("submit: status %d: %v", code, body)
+		}
+		exchangeOrderID, _ := body["exchange_order_id"].(string)
+		s.dbWrites.Wait()
+
+		if via == "rest" {
+			if code, body := doJSON(t, srv, http.MethodDelete, "/api/v1/orders/"+orderID, nil); code != http.StatusOK {
+				t.Fatalf("cancel: status %d: %v", code, body)
+			}
+		} else if _, err := s.CancelOrder(context.Background(), &pb.CancelOrderRequest{OrderId: orderID}); err != nil {
+			t.Fatal(err)
+		}
+
+		ev := cancelled(orderID)
+		if ev.OrderID != orderID || ev.ExchangeOrderID != exchangeOrderID || ev.StrategyName != "momentum" ||
+			ev.Side != "SELL" || ev.Symbol != "BTCUSDT" || ev.Exchange != "mock" {
+			t.Errorf("%s: cancelled event %+v", via, ev)
+		}
+	}
+}
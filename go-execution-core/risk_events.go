@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Risk events are the audit trail of risk decisions: pre-trade rejections, close
+// all runs, and whatever external monitors report. Unresolved CRITICAL events
+// flag /readyz as degraded until someone resolves them.
+
+const (
+	riskSeverityInfo     = "INFO"
+	riskSeverityWarning  = "WARNING"
+	riskSeverityCritical = "CRITICAL"
+)
+
+var riskEventIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var validRiskSeverities = map[string]bool{
+	riskSeverityInfo: true, riskSeverityWarning: true, riskSeverityCritical: true,
+}
+
+// riskEvent is one row of risk_events
+type riskEvent struct {
+	ID           string                 `json:"id"`
+	Timestamp    time.Time              `json:"timestamp"`
+	EventType    string                 `json:"event_type"`
+	Severity     string                 `json:"severity"`
+	StrategyName string                 `json:"strategy_name,omitempty"`
+	Symbol       string                 `json:"symbol,omitempty"`
+	Description  string                 `json:"description"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Resolved     bool                   `json:"resolved"`
+	ResolvedBy   string                 `json:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time             `json:"resolved_at,omitempty"`
+}
+
+const riskEventColumns = `id, timestamp, event_type, severity, COALESCE(strategy_name, ''), COALESCE(symbol, ''),
+	description, data, COALESCE(resolved, false), COALESCE(resolved_by, ''), resolved_at`
+
+func scanRiskEvent(row interface{ Scan(...interface{}) error }) (*riskEvent, error) {
+	var e riskEvent
+	var data []byte
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.Timestamp, &e.EventType, &e.Severity, &e.StrategyName, &e.Symbol,
+		&e.Description, &data, &e.Resolved, &e.ResolvedBy, &resolvedAt); err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &e.Data); err != nil {
+			return nil, err
+		}
+	}
+	if resolvedAt.Valid {
+		e.ResolvedAt = &resolvedAt.Time
+	}
+	return &e, nil
+}
+
+// RecordRiskEvent writes a risk event and returns its ID. String "strategy_name"
+// and "symbol" entries of metadata also fill those columns.
+func (s *Server) RecordRiskEvent(ctx context.Context, eventType, severity, description string,
+	metadata map[string]interface{}) (string, error) {
+	if s.db == nil {
+		return "", errors.New("database not available")
+	}
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	return insertRiskEvent(ctx, s.db, eventType, severity, description, metadata)
+}
+
+// sqlQueryRower is a *sql.DB or *sql.Tx
+type sqlQueryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertRiskEvent is RecordRiskEvent with db, which may be a transaction
+func insertRiskEvent(ctx context.Context, db sqlQueryRower, eventType, severity, description string,
+	metadata map[string]interface{}) (string, error) {
+	strategyName, _ := metadata["strategy_name"].(string)
+	symbol, _ := metadata["symbol"].(string)
+	var data []byte
+	if len(metadata) > 0 {
+		var err error
+		if data, err = json.Marshal(metadata); err != nil {
+			return "", err
+		}
+	}
+
+	var id string
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO risk_events (event_type, severity, strategy_name, symbol, description, data)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		RETURNING id
+	`, eventType, severity, strategyName, symbol, description, data).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	logEvent(ctx, "Risk event recorded", "risk_event_id", id, "event_type", eventType, "severity", severity)
+	return id, nil
+}
+
+// recordRiskRejection records an order turned away by a risk limit without
+// holding up the response
+func (s *Server) recordRiskRejection(ctx context.Context, order *Order, reason error) {
+	if s.db == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	s.goDBWrite(func() {
+		_, err := s.RecordRiskEvent(ctx, "ORDER_REJECTED", riskSeverityWarning, reason.Error(), map[string]interface{}{
+			"order_id":      order.ID,
+			"strategy_name": order.StrategyName,
+			"symbol":        order.Symbol,
+			"side":          order.Side,
+			"quantity":      order.Quantity,
+			"price":         order.Price,
+		})
+		if err != nil {
+			logEvent(ctx, "Failed to record risk event", "order_id", order.ID, "error", err)
+		}
+	})
+}
+
+// unresolvedCriticalRiskEvents counts the CRITICAL events nobody has resolved
+func (s *Server) unresolvedCriticalRiskEvents(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM risk_events WHERE severity = 'CRITICAL' AND resolved = false
+	`).Scan(&n)
+	return n, err
+}
+
+// handleRiskEvents lists and records risk events:
+// GET /api/v1/portfolio/risk/events?severity=CRITICAL&resolved=false&event_type=...&limit=50&cursor=...
+// POST /api/v1/portfolio/risk/events {"event_type", "severity", "description", "strategy_name", "symbol", "data"}
+func (s *Server) handleRiskEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.handleListRiskEvents(w, r)
+	case http.MethodPost:
+		s.handleCreateRiskEvent(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleListRiskEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := parsePageSize(query.Get("limit"), 50)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	var where whereBuilder
+	filters := make(map[string]interface{})
+	if severity := strings.ToUpper(query.Get("severity")); severity != "" {
+		if !validRiskSeverities[severity] {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": "severity must be INFO, WARNING or CRITICAL",
+			})
+			return
+		}
+		where.add("severity = ?", severity)
+		filters["severity"] = severity
+	}
+	if raw := query.Get("resolved"); raw != "" {
+		resolved, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "resolved must be true or false"})
+			return
+		}
+		where.add("COALESCE(resolved, false) = ?", resolved)
+		filters["resolved"] = resolved
+	}
+	if eventType := strings.ToUpper(query.Get("event_type")); eventType != "" {
+		where.add("event_type = ?", eventType)
+		filters["event_type"] = eventType
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		where.add("(timestamp, id::text) < (?, ?)", cursor.Timestamp, cursor.OrderID)
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+riskEventColumns+` FROM risk_events `+where.sql()+
+		` ORDER BY timestamp DESC, id::text DESC LIMIT `+strconv.Itoa(limit+1), where.args...)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query risk events", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to fetch risk events"})
+		return
+	}
+	defer rows.Close()
+
+	events := make([]*riskEvent, 0)
+	for rows.Next() {
+		event, err := scanRiskEvent(rows)
+		if err != nil {
+			logEvent(r.Context(), "Failed to read risk event", "error", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		logEvent(r.Context(), "Failed to read risk events", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to fetch risk events"})
+		return
+	}
+
+	response := map[string]interface{}{"filters": filters}
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[limit-1]
+		response["next_cursor"] = encodeCursor(last.Timestamp, last.ID)
+	}
+	response["events"] = events
+	response["count"] = len(events)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleCreateRiskEvent(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EventType    string                 `json:"event_type"`
+		Severity     string                 `json:"severity"`
+		Description  string                 `json:"description"`
+		StrategyName string                 `json:"strategy_name"`
+		Symbol       string                 `json:"symbol"`
+		Data         map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.EventType = strings.ToUpper(strings.TrimSpace(req.EventType))
+	req.Severity = strings.ToUpper(req.Severity)
+	var errs validationError
+	if req.EventType == "" || len(req.EventType) > 50 {
+		errs = append(errs, FieldError{Field: "event_type", Message: "is required, at most 50 characters"})
+	}
+	if !validRiskSeverities[req.Severity] {
+		errs = append(errs, FieldError{Field: "severity", Message: "must be INFO, WARNING or CRITICAL"})
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		errs = append(errs, FieldError{Field: "description", Message: "is required"})
+	}
+	if len(req.StrategyName) > 100 {
+		errs = append(errs, FieldError{Field: "strategy_name", Message: "must be at most 100 characters"})
+	}
+	if len(req.Symbol) > 20 {
+		errs = append(errs, FieldError{Field: "symbol", Message: "must be at most 20 characters"})
+	}
+	if errs != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":   "Risk event validation failed",
+			"details": errs,
+		})
+		return
+	}
+
+	metadata := req.Data
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["reported_by"] = callerID(r.Context())
+	if req.StrategyName != "" {
+		metadata["strategy_name"] = req.StrategyName
+	}
+	if req.Symbol != "" {
+		metadata["symbol"] = strings.ToUpper(req.Symbol)
+	}
+	id, err := s.RecordRiskEvent(r.Context(), req.EventType, req.Severity, req.Description, metadata)
+	if err != nil {
+		logEvent(r.Context(), "Failed to record risk event", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to record risk event"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id})
+}
+
+// handleResolveRiskEvent marks an event resolved by the caller:
+// POST /api/v1/portfolio/risk/events/{id}/resolve
+func (s *Server) handleResolveRiskEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/portfolio/risk/events/"), "/")
+	if id == "" || action != "resolve" {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+
+	if !riskEventIDPattern.MatchString(id) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Risk event %s not found", id),
+		})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	event, err := scanRiskEvent(s.db.QueryRowContext(ctx, `
+		UPDATE risk_events
+		SET resolved = true, resolved_by = $2, resolved_at = NOW()
+		WHERE id = $1 AND COALESCE(resolved, false) = false
+		RETURNING `+riskEventColumns, id, callerID(r.Context())))
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, lookupErr := scanRiskEvent(s.db.QueryRowContext(ctx,
+			`SELECT `+riskEventColumns+` FROM risk_events WHERE id = $1`, id))
+		switch {
+		case errors.Is(lookupErr, sql.ErrNoRows):
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"error": fmt.Sprintf("Risk event %s not found", id),
+			})
+		case lookupErr != nil:
+			logEvent(r.Context(), "Failed to load risk event", "risk_event_id", id, "error", lookupErr)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to resolve risk event"})
+		default:
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": "Risk event is already resolved",
+				"event": existing,
+			})
+		}
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to resolve risk event", "risk_event_id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": "Failed to resolve risk event"})
+		return
+	}
+	logEvent(r.Context(), "Risk event resolved", "risk_event_id", id, "caller", callerID(r.Context()))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"event": event})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// riskLimitNames are the settings stored in risk_limits. A limit that is not set
+// does not apply.
+var riskLimitNames = []string{
+	"max_total_exposure_usd",
+	"max_position_notional_per_symbol",
+	"max_open_positions",
+	"max_daily_loss",
+	"max_order_notional",
+}
+
+// defaultExposureScale is the exposure calculateRiskLevel grades against when
+// max_total_exposure_usd is not set
+const defaultExposureScale = 100000
+
+// errRiskLimitExceeded wraps pre-trade rejections
+var errRiskLimitExceeded = errors.New("risk limit exceeded")
+
+// RiskLimits maps a name from riskLimitNames to its value
+type RiskLimits map[string]float64
+
+// RiskLimitStore caches the risk_limits table for ttl so the order path does not
+// query it per order; updates through Set invalidate it at once on this instance
+// and within one TTL on the others
+type RiskLimitStore struct {
+	db       *sql.DB
+	ttl      time.Duration
+	limits   RiskLimits
+	loadedAt time.Time
+	mu       sync.Mutex
+}
+
+func NewRiskLimitStore(db *sql.DB, ttl time.Duration) *RiskLimitStore {
+	return &RiskLimitStore{db: db, ttl: ttl}
+}
+
+// Get returns the current limits. When the table cannot be read the last loaded
+// limits are returned with the error, so a database blip keeps the old limits.
+func (rs *RiskLimitStore) Get(ctx context.Context) (RiskLimits, error) {
+	if rs == nil {
+		return RiskLimits{}, nil
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.limits != nil && time.Since(rs.loadedAt) < rs.ttl {
+		return rs.limits, nil
+	}
+
+	limits, err := rs.load(ctx)
+	if err != nil {
+		if rs.limits == nil {
+			return RiskLimits{}, err
+		}
+		return rs.limits, err
+	}
+	rs.limits, rs.loadedAt = limits, time.Now()
+	return limits, nil
+}
+
+func (rs *RiskLimitStore) load(ctx context.Context) (RiskLimits, error) {
+	rows, err := rs.db.QueryContext(ctx, `SELECT name, value FROM risk_limits`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(RiskLimits)
+	for rows.Next() {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		limits[name] = value
+	}
+	return limits, rows.Err()
+}
+
+// Set applies changes in one transaction: a value sets a limit, nil removes it
+func (rs *RiskLimitStore) Set(ctx context.Context, changes map[string]*float64, updatedBy string) error {
+	tx, err := rs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for name, value := range changes {
+		if value == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM risk_limits WHERE name = $1`, name)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO risk_limits (name, value, updated_by, updated_at)
+				VALUES ($1, $2, $3, NOW())
+				ON CONFLICT (name) DO UPDATE
+				SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+			`, name, *value, updatedBy)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	rs.limits = nil
+	rs.mu.Unlock()
+	return nil
+}
+
+// validateRiskLimitChanges checks a PUT body; returns nil when it is valid
+func validateRiskLimitChanges(changes map[string]*float64) validationError {
+	var errs validationError
+	known := make(map[string]bool, len(riskLimitNames))
+	for _, name := range riskLimitNames {
+		known[name] = true
+	}
+	for name, value := range changes {
+		switch {
+		case !known[name]:
+			errs = append(errs, FieldError{Field: name, Message: "is not a known risk limit"})
+		case value == nil:
+		case math.IsNaN(*value) || math.IsInf(*value, 0) || *value < 0:
+			errs = append(errs, FieldError{Field: name, Message: "must be a number of at least 0, or null to remove"})
+		case name == "max_open_positions" && *value != math.Trunc(*value):
+			errs = append(errs, FieldError{Field: name, Message: "must be a whole number"})
+		}
+	}
+	return errs
+}
+
+// checkOrderLimits applies the per-order limits that need no portfolio state.
+// Market orders carry no price and are not checked here.
+func checkOrderLimits(order *Order, limits RiskLimits) error {
+	maxNotional, ok := limits["max_order_notional"]
+	if !ok || order.Price <= 0 {
+		return nil
+	}
+	if notional := order.Quantity * order.Price; notional > maxNotional {
+		return fmt.Errorf("%w: order notional %.2f above max_order_notional %.2f",
+			errRiskLimitExceeded, notional, maxNotional)
+	}
+	return nil
+}
+
+// handleRiskLimits reads and updates risk limits:
+// GET /api/v1/portfolio/risk/limits
+// PUT /api/v1/portfolio/risk/limits {"max_open_positions": 20, "max_daily_loss": null}
+// PUT changes only the limits in the body; null removes a limit.
+func (s *Server) handleRiskLimits(w http.ResponseWriter, r *http.Request) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var changes map[string]*float64
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			if requestBodyError(w, err) {
+				return
+			}
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(changes) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":  "Nothing to update",
+				"limits": riskLimitNames,
+			})
+			return
+		}
+		if errs := validateRiskLimitChanges(changes); errs != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":   "Risk limit validation failed",
+				"details": errs,
+			})
+			return
+		}
+		if err := s.riskLimits.Set(r.Context(), changes, callerID(r.Context())); err != nil {
+			logEvent(r.Context(), "Failed to update risk limits", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to update risk limits",
+			})
+			return
+		}
+		logEvent(r.Context(), "Risk limits updated", "caller", callerID(r.Context()), "changes", len(changes))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limits, err := s.riskLimits.Get(r.Context())
+	if err != nil {
+		logEvent(r.Context(), "Failed to load risk limits", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to load risk limits",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"limits": riskLimitsJSON(limits),
+	})
+}
+
+// riskLimitsJSON lists every known limit, null where it is not set
+func riskLimitsJSON(limits RiskLimits) map[string]interface{} {
+	out := make(map[string]interface{}, len(riskLimitNames))
+	for _, name := range riskLimitNames {
+		if value, ok := limits[name]; ok {
+			out[name] = value
+		} else {
+			out[name] = nil
+		}
+	}
+	return out
+}
+
+// riskLimitUsage reports one limit against its current value; utilization_pct is
+// null when the limit is not set or has no current value
+func riskLimitUsage(limits RiskLimits, name string, current *float64) map[string]interface{} {
+	usage := map[string]interface{}{"limit": nil, "current": nil, "utilization_pct": nil}
+	if current != nil {
+		usage["current"] = *current
+	}
+	limit, ok := limits[name]
+	if !ok {
+		return usage
+	}
+	usage["limit"] = limit
+	if current != nil && limit > 0 {
+		usage["utilization_pct"] = *current / limit * 100
+	}
+	return usage
+}
@@ -0,0 +1,239 @@
+-- SQLite schema for local development (DATABASE_URL=sqlite://path), created at
+-- startup. It has the tables of migrations/ in SQLite types: UUIDs and JSON are
+-- TEXT, decimals REAL, and timestamps UTC text in the format the engine's
+-- driver writes (see sqlite.go). A column added by a migration must be added
+-- here too, and to sqliteAddedColumns for files created before it.
+
+CREATE TABLE IF NOT EXISTS trades (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    order_id TEXT UNIQUE NOT NULL,
+    exchange_order_id TEXT,
+    strategy_name TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL CHECK (side IN ('BUY', 'SELL')),
+    order_type TEXT,
+    quantity REAL NOT NULL,
+    price REAL NOT NULL,
+    executed_price REAL,
+    filled_quantity REAL,
+    status TEXT NOT NULL DEFAULT 'PENDING',
+    exchange TEXT,
+    account_type TEXT NOT NULL DEFAULT 'spot' CHECK (account_type IN ('spot', 'margin', 'futures')),
+    account TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    executed_at TIMESTAMP,
+    pnl REAL,
+    fees REAL DEFAULT 0,
+    slippage REAL,
+    metadata TEXT,
+    booked_quantity REAL NOT NULL DEFAULT 0,
+    booked_notional REAL NOT NULL DEFAULT 0,
+    booked_fees REAL NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_trades_timestamp_order ON trades(timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_strategy_executed ON trades(strategy_name, executed_at DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_strategy_timestamp ON trades(strategy_name, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol_timestamp ON trades(symbol, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_status_timestamp ON trades(status, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_exchange_timestamp ON trades(exchange, timestamp DESC, order_id DESC);
+CREATE INDEX IF NOT EXISTS idx_trades_exchange_order ON trades(exchange_order_id);
+CREATE INDEX IF NOT EXISTS idx_trades_updated_at ON trades(updated_at);
+
+-- Never filled by SQLite (archive-trades needs Postgres); read by order lookups
+CREATE TABLE IF NOT EXISTS trades_archive (
+    id TEXT PRIMARY KEY,
+    order_id TEXT UNIQUE NOT NULL,
+    exchange_order_id TEXT,
+    strategy_name TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL,
+    order_type TEXT,
+    quantity REAL NOT NULL,
+    price REAL NOT NULL,
+    executed_price REAL,
+    filled_quantity REAL,
+    status TEXT NOT NULL,
+    exchange TEXT,
+    account_type TEXT NOT NULL,
+    account TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    executed_at TIMESTAMP,
+    pnl REAL,
+    fees REAL,
+    slippage REAL,
+    metadata TEXT,
+    booked_quantity REAL NOT NULL,
+    booked_notional REAL NOT NULL,
+    booked_fees REAL NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS positions (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    symbol TEXT NOT NULL,
+    account TEXT NOT NULL DEFAULT '',
+    strategy_name TEXT NOT NULL,
+    quantity REAL NOT NULL,
+    average_entry_price REAL NOT NULL,
+    current_price REAL,
+    unrealized_pnl REAL,
+    realized_pnl REAL DEFAULT 0,
+    opened_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_updated TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    lots TEXT,
+    metadata TEXT,
+    UNIQUE(symbol, account)
+);
+
+CREATE TABLE IF NOT EXISTS strategy_lots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    strategy_name TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    open_order_id TEXT NOT NULL,
+    quantity REAL NOT NULL,
+    remaining REAL NOT NULL,
+    price REAL NOT NULL,
+    opened_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_strategy_lots_open ON strategy_lots(strategy_name, symbol, id) WHERE remaining <> 0;
+
+CREATE TABLE IF NOT EXISTS strategies (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    config TEXT NOT NULL,
+    is_active BOOLEAN DEFAULT true,
+    created_by TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_executed_at TIMESTAMP,
+    total_pnl REAL DEFAULT 0,
+    win_rate REAL,
+    total_trades INTEGER DEFAULT 0,
+    metadata TEXT,
+    deleted_at TIMESTAMP,
+    deleted_by TEXT
+);
+
+CREATE TABLE IF NOT EXISTS strategy_versions (
+    strategy_name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    description TEXT,
+    config TEXT NOT NULL,
+    change TEXT NOT NULL,
+    source_version INTEGER,
+    changed_by TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (strategy_name, version)
+);
+
+CREATE TABLE IF NOT EXISTS klines (
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    interval TEXT NOT NULL,
+    open_time TIMESTAMP NOT NULL,
+    open REAL NOT NULL,
+    high REAL NOT NULL,
+    low REAL NOT NULL,
+    close REAL NOT NULL,
+    volume REAL NOT NULL,
+    close_time TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (exchange, symbol, interval, open_time)
+);
+
+CREATE TABLE IF NOT EXISTS book_snapshots (
+    exchange TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    ts TIMESTAMP NOT NULL,
+    last_update_id INTEGER NOT NULL,
+    bids TEXT NOT NULL,
+    asks TEXT NOT NULL,
+    mid REAL,
+    spread REAL,
+    PRIMARY KEY (exchange, symbol, ts)
+);
+
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    exchange TEXT NOT NULL,
+    ts TIMESTAMP NOT NULL,
+    total_value_usd REAL,
+    assets TEXT,
+    error TEXT,
+    PRIMARY KEY (exchange, ts)
+);
+
+CREATE TABLE IF NOT EXISTS risk_events (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    timestamp TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    event_type TEXT NOT NULL,
+    severity TEXT NOT NULL CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+    strategy_name TEXT,
+    symbol TEXT,
+    description TEXT NOT NULL,
+    data TEXT,
+    resolved BOOLEAN DEFAULT false,
+    resolved_by TEXT,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS risk_limits (
+    name TEXT PRIMARY KEY,
+    value REAL NOT NULL CHECK (value >= 0),
+    updated_by TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+INSERT INTO risk_limits (name, value, updated_by) VALUES ('max_total_exposure_usd', 100000, 'migration')
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    exchange TEXT NOT NULL,
+    key_name TEXT NOT NULL,
+    encrypted_key TEXT NOT NULL,
+    encrypted_secret TEXT NOT NULL,
+    encrypted_passphrase TEXT,
+    testnet BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_used_at TIMESTAMP,
+    UNIQUE(exchange, key_name)
+);
+
+CREATE TABLE IF NOT EXISTS client_api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_id TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'trader', 'admin')),
+    key_hash TEXT UNIQUE NOT NULL,
+    require_signature BOOLEAN NOT NULL DEFAULT false,
+    signing_secret TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- The updated_at and last_updated triggers of the Postgres schema
+CREATE TRIGGER IF NOT EXISTS update_trades_updated_at AFTER UPDATE ON trades FOR EACH ROW
+BEGIN
+    UPDATE trades SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS update_positions_last_updated AFTER UPDATE ON positions FOR EACH ROW
+BEGIN
+    UPDATE positions SET last_updated = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS update_strategies_updated_at AFTER UPDATE ON strategies FOR EACH ROW
+BEGIN
+    UPDATE strategies SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"execution-engine/pkg/position"
+)
+
+// newTestServer builds a Server the way main does, on a fresh SQLite database,
+// with a MockExchange registered as "mock", prices from testPrices and the API
+// unauthenticated. Tests adjust s.config before serving requests.
+func newTestServer(t *testing.T) (*Server, *MockExchange) {
+	t.Helper()
+	config := loadConfig()
+	config.DatabaseURL = "sqlite://" + filepath.Join(t.TempDir(), "engine.db")
+	config.APIAuthEnabled = false
+	config.RateLimitEnabled = false
+
+	db, err := initDatabase(config.DatabaseURL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		config:         config,
+		db:             db,
+		exchanges:      make(map[string]Exchange),
+		batchStats:     newBatchMetrics(),
+		balanceFetches: newBalanceFetchMetrics(),
+		orderEvents:    NewOrderEventHub(),
+		fills:          NewFillStream(),
+		exports:        newExportJobs(),
+	}
+	if s.positionMethod, err = position.ParseMethod(config.PositionAccounting); err != nil {
+		t.Fatal(err)
+	}
+	s.streamCtx, s.stopStreams = context.WithCancel(context.Background())
+	s.dbConnected.Store(true)
+	s.grpcHealth = newGRPCHealth(s)
+	s.riskLimits = NewRiskLimitStore(db, config.RiskLimitsCacheTTL)
+	s.store = NewStore(db, dialectForURL(config.DatabaseURL), s.positionMethod, s.riskLimits)
+	s.health = NewHealthMonitor(config.HealthProbeInterval, config.ExchangeUnhealthyGrace)
+	s.prices = NewPriceCache(testPrices, time.Minute)
+	s.tickers = NewTickerCache(config.TickerCacheTTL)
+	s.strategyTimeseries = NewTimeseriesCache()
+
+	mock := NewMockExchange()
+	s.exchanges["mock"] = mock
+
+	t.Cleanup(func() {
+		s.stopStreams()
+		s.dbWrites.Wait()
+		db.Close()
+	})
+	return s, mock
+}
+
+// testPrices stands in for the Binance ticker feed
+func testPrices() ([]TickerData, error) {
+	return []TickerData{{Symbol: "BTCUSDT", Price: 30000}, {Symbol: "ETHUSDT", Price: 2000}}, nil
+}
+
+// serveTest starts the server's full HTTP handler chain
+func serveTest(t *testing.T, s *Server) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(s.newHTTPServer().Handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// doJSON sends body as JSON and decodes the JSON response into a map
+func doJSON(t *testing.T, srv *httptest.Server, method, path string, body interface{}, headers ...string) (int, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if len(bytes.TrimSpace(raw)) > 0 && json.Unmarshal(raw, &decoded) != nil {
+		decoded = map[string]interface{}{"body": string(raw)}
+	}
+	return resp.StatusCode, decoded
+}
+
+// insertTestTrade records a filled trade directly, bypassing the order path
+func insertTestTrade(t testing.TB, s *Server, orderID, strategy string, pnl float64, executedAt time.Time) {
+	t.Helper()
+	_, err := s.db.Exec(`
+		INSERT INTO trades (order_id, strategy_name, symbol, side, quantity, price, executed_price,
+			filled_quantity, status, exchange, timestamp, executed_at, pnl)
+		VALUES ($1, $2, 'BTCUSDT', 'SELL', 1, 30000, 30000, 1, 'FILLED', 'mock', $3, $3, $4)`,
+		orderID, strategy, executedAt.UTC(), pnl)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// scrapeMetric reads /metrics and returns the sample of name whose labels include
+// the given label/value pairs, and whether such a series was exported at all
+func scrapeMetric(t *testing.T, srv *httptest.Server, name string, labels ...string) (float64, bool) {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics: status %d: %s", resp.StatusCode, raw)
+	}
+lines:
+	for _, line := range strings.Split(string(raw), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.LastIndexByte(line, ' ')
+		if sep < 0 {
+			continue
+		}
+		series := line[:sep]
+		seriesName, seriesLabels, _ := strings.Cut(series, "{")
+		if seriesName != name {
+			continue
+		}
+		for i := 0; i+1 < len(labels); i += 2 {
+			if !strings.Contains(seriesLabels, labels[i]+"=\""+labels[i+1]+"\"") {
+				continue lines
+			}
+		}
+		value, err := strconv.ParseFloat(line[sep+1:], 64)
+		if err != nil {
+			t.Fatalf("/metrics: %q: %v", line, err)
+		}
+		return value, true
+	}
+	return 0, false
+}
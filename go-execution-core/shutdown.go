@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// goDBWrite runs a database write in the background; shutdown flushes it before
+// closing Postgres so orders that reached the exchange are not lost
+func (s *Server) goDBWrite(write func()) {
+	s.dbWrites.Add(1)
+	go func() {
+		defer s.dbWrites.Done()
+		write()
+	}()
+}
+
+// waitGroupDone reports whether wg drained before ctx expired
+func waitGroupDone(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shutdown drains the engine within SHUTDOWN_TIMEOUT: stop accepting HTTP and
+// gRPC requests, wait for in-flight exchange calls, flush queued DB writes, then
+// close Redis and Postgres. If the window runs out the process exits non-zero,
+// naming the phase it was stuck in.
+func (s *Server) shutdown(httpServer *http.Server, grpcServer *grpc.Server) {
+	log.Printf("Shutting down (timeout %s)...", s.config.ShutdownTimeout)
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	forceExit := func(phase string) {
+		log.Printf("Shutdown timed out after %s while %s, forcing exit", time.Since(start).Round(time.Millisecond), phase)
+		grpcServer.Stop()
+		os.Exit(1)
+	}
+
+	// Phase 1: stop listeners and let in-flight requests finish; readiness and
+	// gRPC health are cleared first so a probe racing the drain sees not ready
+	s.started.Store(false)
+	s.grpcHealth.drain()
+	log.Println("Shutdown: draining HTTP and gRPC requests")
+	s.stopStreams()
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		forceExit("draining HTTP requests")
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		forceExit("draining gRPC requests")
+	}
+
+	// Phase 2: exchange calls started by requests (normally finished with them)
+	log.Println("Shutdown: waiting for in-flight exchange calls")
+	if !waitGroupDone(ctx, &s.exchangeCalls) {
+		forceExit("waiting for in-flight exchange calls")
+	}
+
+	// Phase 3: async order logging
+	log.Println("Shutdown: flushing database writes")
+	if !waitGroupDone(ctx, &s.dbWrites) {
+		forceExit("flushing database writes")
+	}
+
+	// Phase 4: connections
+	log.Println("Shutdown: closing Redis and Postgres")
+	if s.redis != nil {
+		if err := s.redis.Close(); err != nil {
+			log.Printf("Warning: Redis close failed: %v", err)
+		}
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			log.Printf("Warning: Postgres close failed: %v", err)
+		}
+	}
+	if s.store != nil && s.store.replica != nil {
+		if err := s.store.replica.Close(); err != nil {
+			log.Printf("Warning: Postgres read replica close failed: %v", err)
+		}
+	}
+
+	log.Printf("✓ Shutdown complete in %s", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// whereBuilder accumulates AND-ed conditions with positional ($N) arguments.
+// Conditions use "?" for their argument, which is rewritten to the next $N.
+type whereBuilder struct {
+	clauses []string
+	args    []interface{}
+}
+
+// arg binds a value and returns its placeholder
+func (wb *whereBuilder) arg(value interface{}) string {
+	wb.args = append(wb.args, value)
+	return fmt.Sprintf("$%d", len(wb.args))
+}
+
+// add appends a condition such as "symbol = ?" bound to arg
+func (wb *whereBuilder) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		condition = strings.Replace(condition, "?", wb.arg(arg), 1)
+	}
+	wb.clauses = append(wb.clauses, condition)
+}
+
+// sql returns the WHERE clause (or "" when there are no conditions)
+func (wb *whereBuilder) sql() string {
+	if len(wb.clauses) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(wb.clauses, " AND ")
+}
+
+// Keyset pagination over trades. Pages are ordered by (timestamp column, order_id)
+// descending and the cursor encodes the last row returned, so rows inserted while
+// paging never shift later pages the way OFFSET does.
+
+const maxPageSize = 1000
+
+// pageCursor identifies the last row of a page
+type pageCursor struct {
+	Timestamp time.Time
+	OrderID   string
+}
+
+func encodeCursor(ts time.Time, orderID string) string {
+	raw := ts.UTC().Format(time.RFC3339Nano) + "|" + orderID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(encoded string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return pageCursor{Timestamp: ts, OrderID: parts[1]}, nil
+}
+
+// addCursor restricts results to rows strictly after the cursor in descending order
+func (wb *whereBuilder) addCursor(tsColumn string, cursor pageCursor) {
+	wb.add(fmt.Sprintf("(%s, order_id) < (?, ?)", tsColumn), cursor.Timestamp, cursor.OrderID)
+}
+
+// parsePageSize reads a limit parameter: empty means def, non-numeric input is an
+// error, and numeric values are clamped to 1..maxPageSize. The value is always bound
+// as a query parameter, never interpolated into SQL.
+func parsePageSize(raw string, def int) (int, error) {
+	if raw == "" {
+		return def, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("limit must be an integer")
+	}
+	if size < 1 {
+		return 1, nil
+	}
+	if size > maxPageSize {
+		return maxPageSize, nil
+	}
+	return size, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{raw: "", want: 50},
+		{raw: "20", want: 20},
+		{raw: "1000", want: 1000},
+		{raw: "1001", want: 1000},
+		{raw: "99999999999", want: 1000},
+		{raw: "99999999999999999999", wantErr: true}, // overflows int
+		{raw: "0", want: 1},
+		{raw: "-5", want: 1},
+		{raw: "abc", wantErr: true},
+		{raw: "10 OR 1=1", wantErr: true},
+		{raw: "1;DROP TABLE trades", wantErr: true},
+		{raw: "1e3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePageSize(tt.raw, 50)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePageSize(%q) err = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parsePageSize(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestListOrdersRejectsBadLimit(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	for _, limit := range []string{"abc", "10 OR 1=1", "1;DROP TABLE trades", "1)--"} {
+		code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders?limit="+url.QueryEscape(limit), nil)
+		if code != http.StatusBadRequest {
+			t.Errorf("limit=%q: status %d: %v", limit, code, body)
+		}
+	}
+	if _, err := s.db.Exec(`SELECT count(*) FROM trades`); err != nil {
+		t.Fatalf("trades table gone: %v", err)
+	}
+
+	code, body := doJSON(t, srv, http.MethodGet, "/api/v1/orders?limit=5000", nil)
+	if code != http.StatusOK {
+		t.Errorf("oversized limit should be clamped: status %d: %v", code, body)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite stands in for Postgres in local development (DATABASE_URL=sqlite://path),
+// so hacking on a strategy does not need a database server. Its schema is
+// schema_sqlite.sql, the tables of the Postgres migrations in SQLite types,
+// created at startup instead of migrated. The driver below lets the engine's SQL
+// run unchanged where the dialects agree: it rewrites $n placeholders, which
+// SQLite numbers by first appearance rather than by n, provides NOW(), and
+// stores timestamps as UTC text, which sorts and compares in time order. The
+// queries that still differ are handled by the Store (store_dialect.go).
+//
+// Advisory locks, trade archiving and `recompute-pnl` are Postgres only.
+
+// instrumentedSQLiteDriver is go-sqlite3 behind the same timing as Postgres
+const instrumentedSQLiteDriver = "sqlite-instrumented"
+
+// sqliteTimeFormat is how timestamps are stored: the first format go-sqlite3
+// parses back, always in UTC
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+//go:embed schema_sqlite.sql
+var sqliteSchema string
+
+func init() {
+	sql.Register(instrumentedSQLiteDriver, instrumentedDriver{sqliteDriver{&sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("now", func() string {
+				return time.Now().UTC().Format(sqliteTimeFormat)
+			}, false)
+		},
+	}}})
+}
+
+// sqliteBusyTimeout is how long a statement waits for another connection to
+// release the write lock. SQLite's own busy handler sleeps in C, out of reach of
+// a cancelled context, so it only waits sqliteBusySlice at a time (_busy_timeout)
+// and the driver retries in Go until the timeout or the context ends.
+const (
+	sqliteBusyTimeout = 5 * time.Second
+	sqliteBusySlice   = 20 * time.Millisecond
+)
+
+// sqliteDSN turns sqlite://path?params into a go-sqlite3 data source. Every
+// transaction takes the write lock when it begins (_txlock=immediate), standing
+// in for row locks, and waits up to sqliteBusyTimeout for another to finish.
+func sqliteDSN(dbURL string) (string, error) {
+	path, rawQuery, _ := strings.Cut(strings.TrimPrefix(dbURL, sqliteURLPrefix), "?")
+	if path == "" {
+		return "", fmt.Errorf("DATABASE_URL %q has no file path, expected sqlite://path/to/file.db", dbURL)
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid DATABASE_URL parameters: %w", err)
+	}
+	for key, value := range map[string]string{
+		"_foreign_keys": "1",
+		"_journal_mode": "WAL",
+		"_busy_timeout": strconv.Itoa(int(sqliteBusySlice.Milliseconds())),
+		"_txlock":       "immediate",
+	} {
+		if params.Get(key) == "" {
+			params.Set(key, value)
+		}
+	}
+	return "file:" + path + "?" + params.Encode(), nil
+}
+
+// sqliteAddedColumns are the columns added to tables after they were first in
+// schema_sqlite.sql. CREATE TABLE IF NOT EXISTS leaves the tables of an existing
+// file as they were, so prepareSQLite adds these where they are missing.
+var sqliteAddedColumns = []struct{ table, column, definition string }{
+	{"strategies", "deleted_at", "TIMESTAMP"},
+	{"strategies", "deleted_by", "TEXT"},
+}
+
+// prepareSQLite creates the tables and columns the SQLite schema is missing
+func prepareSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create SQLite schema: %w", err)
+	}
+	for _, c := range sqliteAddedColumns {
+		var present bool
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info($1) WHERE name = $2`,
+			c.table, c.column).Scan(&present); err != nil {
+			return fmt.Errorf("failed to read SQLite table %s: %w", c.table, err)
+		}
+		if present {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s to the SQLite schema: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// sqliteQuery rewrites the $n placeholders of query, outside literals and
+// comments, to ?n, which SQLite binds by n
+func sqliteQuery(query string) string {
+	if !strings.Contains(query, "$") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sqliteArgs stores times in UTC so their text sorts in time order
+func sqliteArgs(args []driver.NamedValue) []driver.NamedValue {
+	for i, arg := range args {
+		if t, ok := arg.Value.(time.Time); ok {
+			args[i].Value = t.UTC()
+		}
+	}
+	return args
+}
+
+type sqliteDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.SQLiteConn.QueryContext(ctx, sqliteQuery(query), sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{Rows: rows, ctx: ctx}, nil
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	err = sqliteRetryBusy(ctx, func() error {
+		result, err = c.SQLiteConn.ExecContext(ctx, sqliteQuery(query), sqliteArgs(args))
+		return err
+	})
+	return result, err
+}
+
+func (c sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	err = sqliteRetryBusy(ctx, func() error {
+		tx, err = c.SQLiteConn.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, sqliteQuery(query))
+	if err != nil {
+		return nil, err
+	}
+	return sqliteStmt{stmt.(*sqlite3.SQLiteStmt)}, nil
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+type sqliteStmt struct {
+	*sqlite3.SQLiteStmt
+}
+
+func (s sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.SQLiteStmt.QueryContext(ctx, sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{Rows: rows, ctx: ctx}, nil
+}
+
+func (s sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	err = sqliteRetryBusy(ctx, func() error {
+		result, err = s.SQLiteStmt.ExecContext(ctx, sqliteArgs(args))
+		return err
+	})
+	return result, err
+}
+
+// sqliteRetryBusy runs op again while it fails with SQLITE_BUSY, for up to
+// sqliteBusyTimeout or until ctx ends. A busy statement has not run, and go-sqlite3
+// resets it, so running it again is safe.
+func sqliteRetryBusy(ctx context.Context, op func() error) error {
+	deadline := time.Now().Add(sqliteBusyTimeout)
+	for {
+		err := op()
+		var sqliteErr sqlite3.Error
+		if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrBusy || time.Now().After(deadline) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// sqliteRows reads stored timestamps back as times. go-sqlite3 only does so for
+// columns declared TIMESTAMP, not for expressions such as MAX(executed_at) or
+// NOW().
+type sqliteRows struct {
+	driver.Rows
+	ctx     context.Context
+	started bool
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	next := func() error { return r.Rows.Next(dest) }
+	if !r.started {
+		// A statement takes its locks on the first step, e.g. INSERT ... RETURNING
+		r.started = true
+		if err := sqliteRetryBusy(r.ctx, next); err != nil {
+			return err
+		}
+	} else if err := next(); err != nil {
+		return err
+	}
+	for i, value := range dest {
+		s, ok := value.(string)
+		if !ok || len(s) < len("2006-01-02 15:04:05+00:00") || s[4] != '-' || s[10] != ' ' || !strings.HasSuffix(s, "+00:00") {
+			continue
+		}
+		if t, err := time.Parse(sqliteTimeFormat, s); err == nil {
+			dest[i] = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"execution-engine/pkg/position"
+	"github.com/lib/pq"
+)
+
+// Fills are recorded in one transaction each: the order's trades row is written,
+// its unbooked fill applied to the position and the strategy's lots, the
+// strategy's aggregates recomputed and the risk events the fill raises
+// inserted, so a crash or failure midway leaves none of it behind. Every path
+// that records an order or a fill of one goes through Store.ApplyFill: REST and
+// gRPC submissions, batch legs, position closes, the order journal, modified
+// orders and status refreshes, which is also how execution reports from the
+// user data streams arrive.
+
+// storeMaxAttempts bounds the retries of a fill transaction that lost a
+// serialization conflict or a deadlock
+const storeMaxAttempts = 3
+
+// Store writes orders and their fills to the database, and runs the queries
+// whose SQL depends on its dialect
+type Store struct {
+	db             *sql.DB
+	dialect        sqlDialect
+	positionMethod position.Method
+	riskLimits     *RiskLimitStore
+
+	// replica serves analytics reads while replicaHealthy (db_replica.go)
+	replica        *sql.DB
+	replicaHealthy atomic.Bool
+}
+
+func NewStore(db *sql.DB, dialect sqlDialect, positionMethod position.Method, riskLimits *RiskLimitStore) *Store {
+	return &Store{db: db, dialect: dialect, positionMethod: positionMethod, riskLimits: riskLimits}
+}
+
+// orderFillMode is how ApplyFill writes an order's trades row
+type orderFillMode string
+
+const (
+	// fillInsert records a newly placed order
+	fillInsert orderFillMode = "insert"
+	// fillReplay records a journaled order, which may already have been written
+	fillReplay orderFillMode = "replay"
+	// fillUpdate records a known order's status, cumulative fill, average price
+	// and fees
+	fillUpdate orderFillMode = "update"
+	// fillReplace records the exchange order a modified order was replaced with;
+	// its fills are booked from zero
+	fillReplace orderFillMode = "replace"
+)
+
+// OrderFill is an order's trades row as of its latest fill
+type OrderFill struct {
+	Trade *TradeRecord
+	Mode  orderFillMode
+}
+
+// ApplyFill records fill and books it, returning what booking did (nil when
+// there was no new fill). The transaction is retried on serialization failures
+// and deadlocks.
+func (st *Store) ApplyFill(ctx context.Context, fill OrderFill) (*bookedFill, error) {
+	if st == nil {
+		return nil, errors.New("database not available")
+	}
+	var err error
+	for attempt := 1; attempt <= storeMaxAttempts; attempt++ {
+		var booked *bookedFill
+		booked, err = st.applyFillOnce(ctx, fill)
+		if err == nil || !retryableTxError(err) || ctx.Err() != nil {
+			return booked, err
+		}
+		logEvent(ctx, "Retrying fill transaction", "order_id", fill.Trade.OrderID, "attempt", attempt, "error", err)
+	}
+	return nil, err
+}
+
+func (st *Store) applyFillOnce(ctx context.Context, fill OrderFill) (*bookedFill, error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Before any trades row is locked; see lockStrategyLots
+	if err := st.lockStrategyLots(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := writeOrderFill(ctx, tx, fill); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT booking`); err != nil {
+		return nil, err
+	}
+	booked, err := st.bookOrderTx(ctx, tx, fill.Trade.OrderID)
+	if err != nil && !isDatabaseError(err) && ctx.Err() == nil {
+		// The position cannot take the fill (invalid stored lots): keep the order
+		// row, unbooked, rather than lose it, and let a later write book it
+		logEvent(ctx, "Failed to book fill", "order_id", fill.Trade.OrderID, "error", err)
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT booking`); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if booked != nil {
+		if _, err := st.recomputeStrategyStats(ctx, tx, []string{booked.Strategy}); err != nil {
+			return nil, fmt.Errorf("strategy stats: %w", err)
+		}
+		if err := st.recordFillRiskEvents(ctx, tx, fill.Trade.OrderID, booked); err != nil {
+			return nil, fmt.Errorf("risk events: %w", err)
+		}
+	}
+	return booked, tx.Commit()
+}
+
+// writeOrderFill inserts or updates fill's trades row within tx
+func writeOrderFill(ctx context.Context, tx *sql.Tx, fill OrderFill) error {
+	t := fill.Trade
+	switch fill.Mode {
+	case fillInsert, fillReplay:
+		return insertTrade(ctx, tx, t, fill.Mode == fillReplay)
+	case fillUpdate:
+		// executed_at follows the latest fill
+		_, err := tx.ExecContext(ctx, `
+			UPDATE trades
+			SET status = $2, filled_quantity = $3, executed_price = $4, fees = $5,
+			    executed_at = CASE WHEN $3 > COALESCE(filled_quantity, 0) THEN $6 ELSE executed_at END
+			WHERE order_id = $1
+		`, t.OrderID, t.Status, t.ExecutedQuantity, t.ExecutedPrice, t.Fees, t.ExecutedAt)
+		return err
+	case fillReplace:
+		_, err := tx.ExecContext(ctx, `
+			UPDATE trades
+			SET exchange_order_id = $2, quantity = $3, price = $4, status = $5, filled_quantity = $6,
+			    executed_price = $7, fees = $8, booked_quantity = 0, booked_notional = 0, booked_fees = 0,
+			    updated_at = NOW()
+			WHERE order_id = $1
+		`, t.OrderID, t.ExchangeOrderID, t.Quantity, t.Price, t.Status, t.ExecutedQuantity, t.ExecutedPrice, t.Fees)
+		return err
+	}
+	return fmt.Errorf("unknown order fill mode %q", fill.Mode)
+}
+
+// recordFillRiskEvents inserts the risk events a booked fill raises within tx:
+// the symbol's position notional crossing max_position_notional_per_symbol, and
+// the day's realized loss crossing max_daily_loss. Each is raised by the fill
+// that crosses the limit, not by every fill while it stays above.
+func (st *Store) recordFillRiskEvents(ctx context.Context, tx *sql.Tx, orderID string, booked *bookedFill) error {
+	limits, err := st.riskLimits.Get(ctx)
+	if err != nil {
+		logEvent(ctx, "Failed to load risk limits", "error", err)
+	}
+
+	if limit, ok := limits["max_position_notional_per_symbol"]; ok && booked.Notional > booked.PrevNotional {
+		var notional float64
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(ABS(quantity * average_entry_price)), 0)
+			FROM positions WHERE symbol = $1 AND quantity != 0
+		`, booked.Symbol).Scan(&notional); err != nil {
+			return err
+		}
+		if previous := notional - booked.Notional + booked.PrevNotional; notional > limit && previous <= limit {
+			description := fmt.Sprintf("%s position notional %.2f above max_position_notional_per_symbol %.2f",
+				booked.Symbol, notional, limit)
+			if _, err := insertRiskEvent(ctx, tx, "POSITION_LIMIT_EXCEEDED", riskSeverityWarning, description,
+				map[string]interface{}{
+					"order_id":      orderID,
+					"strategy_name": booked.Strategy,
+					"symbol":        booked.Symbol,
+					"account":       booked.Account,
+					"notional":      notional,
+					"limit":         limit,
+				}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if limit, ok := limits["max_daily_loss"]; ok && booked.TradePnL < 0 {
+		// Same measure as the max_daily_loss usage on /api/v1/portfolio/risk
+		var todayPnL float64
+		var counted bool // whether this order is in it yet
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(pnl), 0), COALESCE(`+st.dialect.boolOr("order_id = $1")+`, false) FROM trades
+			WHERE pnl IS NOT NULL AND status = 'FILLED'
+			  AND executed_at >= `+st.dialect.startOfUTCDay()+`
+		`, orderID).Scan(&todayPnL, &counted); err != nil {
+			return err
+		}
+		loss := math.Max(0, -todayPnL)
+		if previous := math.Max(0, -(todayPnL - booked.TradePnL)); counted && loss > limit && previous <= limit {
+			description := fmt.Sprintf("realized loss today %.2f above max_daily_loss %.2f", loss, limit)
+			if _, err := insertRiskEvent(ctx, tx, "DAILY_LOSS_LIMIT_EXCEEDED", riskSeverityCritical, description,
+				map[string]interface{}{
+					"order_id":      orderID,
+					"strategy_name": booked.Strategy,
+					"symbol":        booked.Symbol,
+					"daily_loss":    loss,
+					"limit":         limit,
+				}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// retryableTxError reports whether err is a serialization failure or deadlock,
+// which running the transaction again can get past
+func retryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// recordOrderFill writes fill through the store, then its order status cache
+// entry, and logs what booking did
+func (s *Server) recordOrderFill(ctx context.Context, fill OrderFill) (*bookedFill, error) {
+	booked, err := s.store.ApplyFill(ctx, fill)
+	if err != nil {
+		return nil, err
+	}
+	if fill.Mode == fillInsert {
+		s.cacheOrderStatus(ctx, tradeOrderStatus(fill.Trade))
+	} else {
+		// Replays may have lost to a newer row, updates and replacements carry only
+		// part of it
+		s.forgetOrderStatus(ctx, fill.Trade.OrderID)
+	}
+	if booked != nil {
+		s.refreshLeaderboard(ctx, booked.Strategy)
+		logEvent(ctx, "Position updated", "order_id", fill.Trade.OrderID, "symbol", booked.Symbol,
+			"account", booked.Account, "filled", booked.Quantity, "quantity", booked.Remaining,
+			"realized_pnl", booked.Realized)
+	}
+	return booked, nil
+}
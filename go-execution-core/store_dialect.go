@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// The engine runs on Postgres, or on SQLite for local development when
+// DATABASE_URL starts with sqlite://. Most SQL is written once for both: $n
+// placeholders (rewritten for SQLite by its driver, see sqlite.go), NOW(),
+// ON CONFLICT and RETURNING. The queries on trades, strategies and positions that
+// cannot be are Store methods, which build the parts that differ with the
+// store's sqlDialect or do in Go what SQLite lacks (time zones, percentiles).
+
+// sqlDialect is the SQL flavour of the database behind a Store
+type sqlDialect string
+
+const (
+	dialectPostgres sqlDialect = "postgres"
+	dialectSQLite   sqlDialect = "sqlite"
+)
+
+// sqliteURLPrefix marks a DATABASE_URL as a SQLite file
+const sqliteURLPrefix = "sqlite://"
+
+// dialectForURL is the dialect of the database at dbURL; Postgres unless it is a
+// sqlite:// URL
+func dialectForURL(dbURL string) sqlDialect {
+	if strings.HasPrefix(dbURL, sqliteURLPrefix) {
+		return dialectSQLite
+	}
+	return dialectPostgres
+}
+
+// requirePostgres fails the commands that only run on Postgres
+func requirePostgres(dbURL, command string) error {
+	if dialectForURL(dbURL) != dialectPostgres {
+		return fmt.Errorf("%s needs Postgres, DATABASE_URL is a SQLite database", command)
+	}
+	return nil
+}
+
+// forUpdate locks the rows a SELECT reads. SQLite transactions take the database
+// write lock when they begin (see sqliteDSN), so there is nothing to add.
+func (d sqlDialect) forUpdate() string {
+	if d == dialectSQLite {
+		return ""
+	}
+	return "FOR UPDATE"
+}
+
+// jsonParam is placeholder p read as a JSON document
+func (d sqlDialect) jsonParam(p string) string {
+	if d == dialectSQLite {
+		return p
+	}
+	return p + "::jsonb"
+}
+
+// inList matches column against the values bound to p with listArg
+func (d sqlDialect) inList(column, p string) string {
+	if d == dialectSQLite {
+		return column + " IN (SELECT value FROM json_each(" + p + "))"
+	}
+	return column + " = ANY(" + p + ")"
+}
+
+// listArg binds a slice for inList
+func (d sqlDialect) listArg(values interface{}) interface{} {
+	if d == dialectSQLite {
+		encoded, _ := json.Marshal(values)
+		return string(encoded)
+	}
+	return pq.Array(values)
+}
+
+// ratio divides two integer expressions as decimals, NULL when den is 0
+func (d sqlDialect) ratio(num, den string) string {
+	if d == dialectSQLite {
+		return "CAST(" + num + " AS REAL) / NULLIF(" + den + ", 0)"
+	}
+	return "(" + num + ")::numeric / NULLIF(" + den + ", 0)"
+}
+
+// boolOr is true when expr is true for any row
+func (d sqlDialect) boolOr(expr string) string {
+	if d == dialectSQLite {
+		return "MAX(" + expr + ")"
+	}
+	return "BOOL_OR(" + expr + ")"
+}
+
+// startOfUTCDay is midnight UTC of the database's current day. SQLite timestamps
+// are UTC text, which compares in time order.
+func (d sqlDialect) startOfUTCDay() string {
+	if d == dialectSQLite {
+		return "strftime('%Y-%m-%d 00:00:00+00:00', 'now')"
+	}
+	return "date_trunc('day', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'"
+}
+
+// daysAgo is the database's current time less the number of days bound to p
+func (d sqlDialect) daysAgo(p string) string {
+	if d == dialectSQLite {
+		return "strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', '-' || " + p + " || ' days')"
+	}
+	return "NOW() - " + p + " * INTERVAL '1 day'"
+}
+
+// ilike matches expr case-insensitively against the pattern bound to p, in which
+// backslash escapes % and _ (likeEscaper)
+func (d sqlDialect) ilike(expr, p string) string {
+	if d == dialectSQLite {
+		// LIKE ignores ASCII case in SQLite
+		return expr + ` LIKE ` + p + ` ESCAPE '\'`
+	}
+	return expr + " ILIKE " + p
+}
+
+// isDatabaseError reports whether err came from the database rather than from
+// the caller, e.g. position arithmetic
+func isDatabaseError(err error) bool {
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &pqErr) || errors.As(err, &sqliteErr)
+}
+
+// truncateTime is the start of the hour, day or ISO week (Monday) t falls in,
+// in loc, as date_trunc cuts it in Postgres
+func truncateTime(t time.Time, unit string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch unit {
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case "week":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// percentileCont interpolates the p-th percentile (0 to 1) of values like
+// Postgres PERCENTILE_CONT; 0 without values. values is sorted in place.
+func percentileCont(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	pos := p * float64(len(values)-1)
+	lower := int(pos)
+	if lower+1 >= len(values) {
+		return values[lower]
+	}
+	return values[lower] + (pos-float64(lower))*(values[lower+1]-values[lower])
+}
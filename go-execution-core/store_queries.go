@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reads of trades, strategies and positions whose SQL differs between Postgres
+// and SQLite; see store_dialect.go
+
+// likeEscaper makes user input match literally inside an ILIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// searchStrategies restricts where to strategies whose name or description
+// contains search, ignoring case
+func (st *Store) searchStrategies(where *whereBuilder, search string) {
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+	where.add("("+st.dialect.ilike("name", "?")+" OR "+st.dialect.ilike("COALESCE(description, '')", "?")+")",
+		pattern, pattern)
+}
+
+// orphanStrategyPositions marks the open positions of a strategy being deleted
+// orphaned within tx
+func (st *Store) orphanStrategyPositions(ctx context.Context, tx *sql.Tx, name string) error {
+	metadata := `COALESCE(metadata, '{}'::jsonb) || jsonb_build_object('orphaned', true, 'orphaned_at', NOW())`
+	if st.dialect == dialectSQLite {
+		metadata = `json_set(COALESCE(metadata, '{}'), '$.orphaned', json('true'), '$.orphaned_at', NOW())`
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE positions
+		SET metadata = `+metadata+`
+		WHERE strategy_name = $1 AND quantity <> 0
+	`, name)
+	return err
+}
+
+// pnlSum is the realized PnL of the trades in one bucket, and one strategy when
+// grouped by strategy
+type pnlSum struct {
+	Strategy    string
+	Start       time.Time // in the zone the buckets were cut in
+	PnL         float64
+	GrossProfit float64
+	GrossLoss   float64 // positive
+	Trades      int64
+	Wins        int64
+}
+
+// sumPnL sums the trades matching where per hour, day or week (unit) of their
+// executed_at in loc, and per strategy when byStrategy is set, oldest bucket
+// first. Postgres cuts the buckets with date_trunc; SQLite has no time zones, so
+// its rows are bucketed here.
+func (st *Store) sumPnL(ctx context.Context, intent readIntent, where *whereBuilder, unit string,
+	loc *time.Location, byStrategy bool) ([]pnlSum, error) {
+	db := st.reader(intent)
+	if st.dialect == dialectSQLite {
+		return sumPnLRows(ctx, db, where, unit, loc, byStrategy)
+	}
+
+	strategy, groupBy := "''", "bucket"
+	if byStrategy {
+		strategy, groupBy = "strategy_name", "strategy_name, bucket"
+	}
+	truncUnit, zone := where.arg(unit), where.arg(loc.String())
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s,
+		       date_trunc(%s, executed_at AT TIME ZONE %s) AS bucket,
+		       COALESCE(SUM(pnl), 0),
+		       COALESCE(SUM(pnl) FILTER (WHERE pnl > 0), 0),
+		       COALESCE(-SUM(pnl) FILTER (WHERE pnl < 0), 0),
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE pnl > 0)
+		FROM trades
+		%s
+		GROUP BY %s
+		ORDER BY bucket
+	`, strategy, truncUnit, zone, where.sql(), groupBy), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make([]pnlSum, 0)
+	for rows.Next() {
+		var p pnlSum
+		var bucket time.Time
+		if err := rows.Scan(&p.Strategy, &bucket, &p.PnL, &p.GrossProfit, &p.GrossLoss, &p.Trades, &p.Wins); err != nil {
+			return nil, err
+		}
+		// The bucket is a wall-clock time in loc without zone; attach loc to it
+		p.Start = time.Date(bucket.Year(), bucket.Month(), bucket.Day(), bucket.Hour(), 0, 0, 0, loc)
+		sums = append(sums, p)
+	}
+	return sums, rows.Err()
+}
+
+// sumPnLRows is sumPnL over the matching rows, for SQLite
+func sumPnLRows(ctx context.Context, db *sql.DB, where *whereBuilder, unit string, loc *time.Location,
+	byStrategy bool) ([]pnlSum, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT strategy_name, executed_at, pnl FROM trades
+		`+where.sql()+`
+		ORDER BY executed_at
+	`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make([]pnlSum, 0)
+	index := make(map[string]int) // strategy|bucket start to its sums entry
+	for rows.Next() {
+		var strategy string
+		var executedAt sql.NullTime
+		var pnl float64
+		if err := rows.Scan(&strategy, &executedAt, &pnl); err != nil {
+			return nil, err
+		}
+		if !executedAt.Valid {
+			continue
+		}
+		if !byStrategy {
+			strategy = ""
+		}
+		start := truncateTime(executedAt.Time, unit, loc)
+		key := fmt.Sprintf("%s|%d", strategy, start.Unix())
+		i, ok := index[key]
+		if !ok {
+			i = len(sums)
+			index[key] = i
+			sums = append(sums, pnlSum{Strategy: strategy, Start: start})
+		}
+		p := &sums[i]
+		p.PnL += pnl
+		p.Trades++
+		if pnl > 0 {
+			p.GrossProfit += pnl
+			p.Wins++
+		} else if pnl < 0 {
+			p.GrossLoss -= pnl
+		}
+	}
+	return sums, rows.Err()
+}
+
+// pnlPercentile is the percentile (0 to 1) of the realized PnL of the trades
+// filled in the last days, interpolated as PERCENTILE_CONT; 0 without trades
+func (st *Store) pnlPercentile(ctx context.Context, intent readIntent, percentile float64, days int) (float64, error) {
+	db := st.reader(intent)
+	recent := `
+		FROM trades
+		WHERE pnl IS NOT NULL
+		  AND executed_at > ` + st.dialect.daysAgo("$1") + `
+		  AND status = 'FILLED'
+	`
+	if st.dialect == dialectPostgres {
+		var value float64
+		err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(PERCENTILE_CONT($2) WITHIN GROUP (ORDER BY pnl), 0)`+recent,
+			days, percentile).Scan(&value)
+		return value, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT pnl`+recent, days)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var values []float64
+	for rows.Next() {
+		var pnl float64
+		if err := rows.Scan(&pnl); err != nil {
+			return 0, err
+		}
+		values = append(values, pnl)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return percentileCont(values, percentile), nil
+}
+
+// limitUsage returns the largest single-symbol position notional and today's
+// realized PnL (UTC day), the current values of the per-symbol and daily loss
+// limits
+func (st *Store) limitUsage(ctx context.Context, intent readIntent) (maxSymbolNotional, todayPnL float64, err error) {
+	err = st.reader(intent).QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT MAX(notional) FROM (
+				SELECT SUM(ABS(quantity * average_entry_price)) AS notional
+				FROM positions WHERE quantity != 0 GROUP BY symbol) per_symbol), 0),
+			COALESCE((SELECT SUM(pnl) FROM trades
+				WHERE pnl IS NOT NULL AND status = 'FILLED'
+				  AND executed_at >= `+st.dialect.startOfUTCDay()+`), 0)
+	`).Scan(&maxSymbolNotional, &todayPnL)
+	return maxSymbolNotional, todayPnL, err
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"execution-engine/pkg/position"
+)
+
+// storeBackend is a Store on a fresh, empty schema of one database
+type storeBackend struct {
+	name  string
+	db    *sql.DB
+	store *Store
+}
+
+// storeBackends returns a Store on SQLite and, when TEST_POSTGRES_URL is set, one
+// on migrated Postgres, for tests of the queries whose SQL differs between them
+func storeBackends(t *testing.T) []storeBackend {
+	t.Helper()
+	newBackend := func(name string, db *sql.DB, dialect sqlDialect) storeBackend {
+		return storeBackend{name: name, db: db, store: NewStore(db, dialect, position.WeightedAverage, NewRiskLimitStore(db, time.Minute))}
+	}
+
+	sqlite, err := initDatabase("sqlite://"+filepath.Join(t.TempDir(), "store.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	backends := []storeBackend{newBackend("sqlite", sqlite, dialectSQLite)}
+
+	t.Run("postgres setup", func(t *testing.T) {
+		db := postgresTestDB(t)
+		if _, err := runMigrations(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		backends = append(backends, newBackend("postgres", db, dialectPostgres))
+	})
+	return backends
+}
+
+// insertStoreTrade writes a trades row with a realized PnL, as booking leaves it
+func insertStoreTrade(t *testing.T, db *sql.DB, orderID, strategy, status string, pnl float64, executedAt time.Time) {
+	t.Helper()
+	_, err := db.Exec(`
+		INSERT INTO trades (order_id, strategy_name, symbol, side, quantity, price, executed_price,
+			filled_quantity, status, exchange, timestamp, executed_at, pnl)
+		VALUES ($1, $2, 'BTCUSDT', 'SELL', 1, 30000, 30000, 1, $3, 'mock', $4, $4, $5)`,
+		orderID, strategy, status, executedAt.UTC(), pnl)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closeTo compares money amounts read back from DECIMAL and REAL columns
+func closeTo(a, b float64) bool {
+	return a-b < 1e-6 && b-a < 1e-6
+}
+
+// testFill is a filled market buy of 1 BTCUSDT at 30000 by momentum
+func testFill(orderID string) OrderFill {
+	now := time.Now()
+	return OrderFill{Mode: fillInsert, Trade: &TradeRecord{
+		OrderID: orderID, StrategyName: "momentum", Symbol: "BTCUSDT", Side: "BUY", Quantity: 1,
+		ExecutedPrice: 30000, ExecutedQuantity: 1, Fees: 30, Status: "FILLED", Exchange: "mock",
+		Timestamp: now, ExecutedAt: now, ExchangeOrderID: "ex-" + orderID,
+	}}
+}
+
+// countRows returns the number of rows in table matching where
+func countRows(t *testing.T, s *Server, table, where string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestApplyFillRollsBack fails the fill transaction at different steps with a
+// trigger and checks none of its writes persist, and that the same fill goes
+// through once the failure is gone
+func TestApplyFillRollsBack(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger string
+	}{
+		{"strategy stats", `CREATE TRIGGER inject BEFORE UPDATE ON strategies BEGIN SELECT RAISE(ABORT, 'injected'); END`},
+		{"position upsert", `CREATE TRIGGER inject BEFORE INSERT ON positions BEGIN SELECT RAISE(ABORT, 'injected'); END`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			ctx := context.Background()
+			if _, err := s.db.Exec(`INSERT INTO strategies (name, config) VALUES ('momentum', '{}')`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.db.Exec(tt.trigger); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.store.ApplyFill(ctx, testFill("ord-1")); err == nil || !strings.Contains(err.Error(), "injected") {
+				t.Fatalf("err = %v, want the injected failure", err)
+			}
+			for _, table := range []string{"trades", "positions", "strategy_lots", "risk_events"} {
+				if n := countRows(t, s, table, "1 = 1"); n != 0 {
+					t.Errorf("%d %s rows persisted from the failed fill", n, table)
+				}
+			}
+			if n := countRows(t, s, "strategies", "name = 'momentum' AND total_trades = 0 AND total_pnl = 0"); n != 1 {
+				t.Error("strategy stats changed by the failed fill")
+			}
+
+			if _, err := s.db.Exec(`DROP TRIGGER inject`); err != nil {
+				t.Fatal(err)
+			}
+			booked, err := s.store.ApplyFill(ctx, testFill("ord-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if booked == nil {
+				t.Fatal("retried fill was not booked")
+			}
+			if n := countRows(t, s, "trades", "order_id = 'ord-1'"); n != 1 {
+				t.Errorf("%d trades rows after the retry", n)
+			}
+			if n := countRows(t, s, "positions", "symbol = 'BTCUSDT' AND quantity = 1"); n != 1 {
+				t.Errorf("%d positions of 1 BTCUSDT after the retry", n)
+			}
+			if n := countRows(t, s, "strategies", "name = 'momentum' AND total_trades = 1"); n != 1 {
+				t.Error("strategy stats not updated by the retry")
+			}
+		})
+	}
+}
+
+// TestStoreUpserts books fills through the position and strategy upserts on each
+// backend: adds, a replayed order, a partial fill and its completion
+func TestStoreUpserts(t *testing.T) {
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := b.db.Exec(`INSERT INTO strategies (name, config) VALUES ('momentum', '{}')`); err != nil {
+				t.Fatal(err)
+			}
+			second := testFill("ord-2")
+			second.Trade.ExecutedPrice, second.Trade.Fees = 32000, 0
+			for _, fill := range []OrderFill{testFill("ord-1"), second, {Mode: fillReplay, Trade: second.Trade}} {
+				if _, err := b.store.ApplyFill(ctx, fill); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var quantity, avgEntry float64
+			var rows int
+			if err := b.db.QueryRow(`SELECT COUNT(*), SUM(quantity), MAX(average_entry_price) FROM positions WHERE symbol = 'BTCUSDT'`).
+				Scan(&rows, &quantity, &avgEntry); err != nil {
+				t.Fatal(err)
+			}
+			// The first fill's 30 fee is in its entry price
+			if rows != 1 || quantity != 2 || !closeTo(avgEntry, 31015) {
+				t.Errorf("%d positions, quantity %v at %v; want one of 2 at 31015", rows, quantity, avgEntry)
+			}
+
+			// Open positions of a deleted strategy are marked in their JSON metadata
+			tx, err := b.db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.store.orphanStrategyPositions(ctx, tx, "momentum"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			var raw string
+			if err := b.db.QueryRow(`SELECT metadata FROM positions WHERE symbol = 'BTCUSDT'`).Scan(&raw); err != nil {
+				t.Fatal(err)
+			}
+			var metadata map[string]interface{}
+			if err := json.Unmarshal([]byte(raw), &metadata); err != nil || metadata["orphaned"] != true || metadata["orphaned_at"] == nil {
+				t.Errorf("metadata %s (%v)", raw, err)
+			}
+
+			sell := testFill("ord-3")
+			sell.Trade.Side, sell.Trade.Quantity, sell.Trade.ExecutedQuantity = "SELL", 2, 1
+			sell.Trade.ExecutedPrice, sell.Trade.Fees, sell.Trade.Status = 33000, 0, "PARTIALLY_FILLED"
+			if _, err := b.store.ApplyFill(ctx, sell); err != nil {
+				t.Fatal(err)
+			}
+			sell.Mode, sell.Trade.ExecutedQuantity, sell.Trade.Status = fillUpdate, 2, "FILLED"
+			if _, err := b.store.ApplyFill(ctx, sell); err != nil {
+				t.Fatal(err)
+			}
+			var realized, tradePnL, totalPnL float64
+			var totalTrades int
+			if err := b.db.QueryRow(`SELECT quantity, realized_pnl FROM positions WHERE symbol = 'BTCUSDT'`).Scan(&quantity, &realized); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.db.QueryRow(`SELECT pnl FROM trades WHERE order_id = 'ord-3'`).Scan(&tradePnL); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.db.QueryRow(`SELECT total_pnl, total_trades FROM strategies WHERE name = 'momentum'`).Scan(&totalPnL, &totalTrades); err != nil {
+				t.Fatal(err)
+			}
+			// 2 sold at 33000 against an average of 31015; FIFO lots of 30030 and 32000
+			if quantity != 0 || !closeTo(realized, 3970) || !closeTo(tradePnL, 3970) || !closeTo(totalPnL, 3970) || totalTrades != 3 {
+				t.Errorf("quantity %v, realized %v, trade pnl %v, strategy pnl %v over %d trades; want 0, 3970 x3, 3 trades",
+					quantity, realized, tradePnL, totalPnL, totalTrades)
+			}
+		})
+	}
+}
+
+// TestStoreTimeBuckets checks sumPnL cuts the same hour, day and week buckets in
+// each backend, in zones other than UTC too
+func TestStoreTimeBuckets(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type bucket struct {
+		start       time.Time
+		pnl         float64
+		trades      int64
+		grossProfit float64
+		grossLoss   float64
+	}
+	tests := []struct {
+		unit string
+		loc  *time.Location
+		want []bucket
+	}{
+		{"day", time.UTC, []bucket{
+			{time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), -1, 3, 3, 4},
+			{time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), 8, 1, 8, 0},
+		}},
+		{"day", tokyo, []bucket{
+			{time.Date(2024, 3, 10, 0, 0, 0, 0, tokyo), 1, 1, 1, 0},
+			{time.Date(2024, 3, 11, 0, 0, 0, 0, tokyo), 6, 3, 10, 4},
+		}},
+		{"hour", kolkata, []bucket{
+			{time.Date(2024, 3, 10, 20, 0, 0, 0, kolkata), 1, 1, 1, 0},
+			{time.Date(2024, 3, 10, 21, 0, 0, 0, kolkata), -2, 2, 2, 4},
+			{time.Date(2024, 3, 11, 7, 0, 0, 0, kolkata), 8, 1, 8, 0},
+		}},
+		{"week", time.UTC, []bucket{
+			{time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), -1, 3, 3, 4},
+			{time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), 8, 1, 8, 0},
+		}},
+	}
+
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			for i, trade := range []struct {
+				at  string
+				pnl float64
+			}{
+				{"2024-03-10T14:30:00Z", 1}, {"2024-03-10T15:30:00Z", 2},
+				{"2024-03-10T16:10:00Z", -4}, {"2024-03-11T02:00:00Z", 8},
+			} {
+				at, _ := time.Parse(time.RFC3339, trade.at)
+				insertStoreTrade(t, b.db, "ord-"+string(rune('a'+i)), "momentum", "FILLED", trade.pnl, at)
+			}
+			insertStoreTrade(t, b.db, "other-1", "other", "FILLED", 100, time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC))
+
+			for _, tt := range tests {
+				var where whereBuilder
+				where.add("strategy_name = ?", "momentum")
+				sums, err := b.store.sumPnL(context.Background(), readCurrent, &where, tt.unit, tt.loc, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]bucket, len(sums))
+				for i, sum := range sums {
+					got[i] = bucket{sum.Start, sum.PnL, sum.Trades, sum.GrossProfit, sum.GrossLoss}
+				}
+				if len(got) != len(tt.want) {
+					t.Errorf("%s/%s: buckets %v, want %v", tt.unit, tt.loc, got, tt.want)
+					continue
+				}
+				for i := range got {
+					g, w := got[i], tt.want[i]
+					if !g.start.Equal(w.start) || !closeTo(g.pnl, w.pnl) || g.trades != w.trades ||
+						!closeTo(g.grossProfit, w.grossProfit) || !closeTo(g.grossLoss, w.grossLoss) {
+						t.Errorf("%s/%s bucket %d = %+v, want %+v", tt.unit, tt.loc, i, g, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestStoreRecentWindows checks the relative time math: the days-ago window of
+// pnlPercentile and the UTC day of limitUsage
+func TestStoreRecentWindows(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			insertStoreTrade(t, b.db, "today", "momentum", "FILLED", 5, today.Add(time.Second))
+			insertStoreTrade(t, b.db, "yesterday", "momentum", "FILLED", 7, today.Add(-time.Hour))
+			insertStoreTrade(t, b.db, "cancelled", "momentum", "CANCELED", 500, today.Add(time.Second))
+			insertStoreTrade(t, b.db, "old", "momentum", "FILLED", 1000, now.AddDate(0, 0, -30))
+			for _, p := range []struct {
+				symbol, account string
+				quantity, price float64
+			}{{"BTCUSDT", "a", 2, 100}, {"BTCUSDT", "b", -1, 100}, {"ETHUSDT", "a", 1, 250}} {
+				if _, err := b.db.Exec(`INSERT INTO positions (symbol, account, strategy_name, quantity, average_entry_price)
+					VALUES ($1, $2, 'momentum', $3, $4)`, p.symbol, p.account, p.quantity, p.price); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			notional, todayPnL, err := b.store.limitUsage(ctx, readCurrent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// BTCUSDT's two accounts add up to 300 of exposure
+			if !closeTo(notional, 300) || !closeTo(todayPnL, 5) {
+				t.Errorf("limit usage %v notional, %v today; want 300 and 5", notional, todayPnL)
+			}
+
+			// Within 7 days: 5 and 7; the cancelled and month-old trades are out
+			median, err := b.store.pnlPercentile(ctx, readCurrent, 0.5, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !closeTo(median, 6) {
+				t.Errorf("median %v, want 6", median)
+			}
+			if wide, err := b.store.pnlPercentile(ctx, readCurrent, 0.5, 60); err != nil || !closeTo(wide, 7) {
+				t.Errorf("60-day median %v (%v), want 7", wide, err)
+			}
+		})
+	}
+}
+
+// TestStorePercentiles checks both backends interpolate like PERCENTILE_CONT
+func TestStorePercentiles(t *testing.T) {
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			if empty, err := b.store.pnlPercentile(ctx, readCurrent, 0.5, 7); err != nil || empty != 0 {
+				t.Errorf("without trades: %v (%v), want 0", empty, err)
+			}
+			at := time.Now().Add(-time.Hour)
+			for i, pnl := range []float64{8, -4, 10, 1, 2} {
+				insertStoreTrade(t, b.db, "ord-"+string(rune('a'+i)), "momentum", "FILLED", pnl, at)
+			}
+			for _, tt := range []struct{ p, want float64 }{
+				{0, -4}, {0.1, -2}, {0.5, 2}, {0.9, 9.2}, {1, 10},
+			} {
+				got, err := b.store.pnlPercentile(ctx, readCurrent, tt.p, 7)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !closeTo(got, tt.want) {
+					t.Errorf("percentile %v = %v, want %v", tt.p, got, tt.want)
+				}
+			}
+		})
+	}
+}
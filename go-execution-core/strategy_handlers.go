@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -29,7 +31,8 @@ func (s *Server) handleStrategies(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleStrategyByName handles GET (details), DELETE, and performance endpoints
+// handleStrategyByName handles GET (details), PATCH, DELETE, clone, recompute,
+// restore, version history, rollback and performance endpoints
 func (s *Server) handleStrategyByName(w http.ResponseWriter, r *http.Request) {
 	// Parse strategy name from URL: /api/v1/strategies/{name} or /api/v1/strategies/{name}/performance
 	path := strings.TrimPrefix(r.URL.Path, "/api/v1/strategies/")
@@ -44,7 +47,51 @@ func (s *Server) handleStrategyByName(w http.ResponseWriter, r *http.Request) {
 
 	// Check if this is a performance request
 	if len(parts) > 1 && parts[1] == "performance" {
-		s.getStrategyPerformance(w, r, strategyName)
+		if len(parts) > 2 && parts[2] == "timeseries" {
+			s.getStrategyTimeseries(w, r, strategyName)
+			return
+		}
+		s.getStrategyPerformance(w, r, strategyName, readAnalytics)
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "clone" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.cloneStrategy(w, r, strategyName)
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "recompute" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.recomputeStrategy(w, r, strategyName)
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "versions" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.listStrategyVersions(w, r, strategyName)
+		return
+	}
+
+	if len(parts) > 1 && (parts[1] == "rollback" || parts[1] == "restore") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[1] == "rollback" {
+			s.rollbackStrategy(w, r, strategyName)
+		} else {
+			s.restoreStrategy(w, r, strategyName)
+		}
 		return
 	}
 
@@ -52,6 +99,8 @@ func (s *Server) handleStrategyByName(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		s.getStrategy(w, r, strategyName)
+	case http.MethodPatch:
+		s.patchStrategy(w, r, strategyName)
 	case http.MethodDelete:
 		s.deleteStrategy(w, r, strategyName)
 	default:
@@ -59,33 +108,110 @@ func (s *Server) handleStrategyByName(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// listStrategies returns all strategies
+// strategySortColumns whitelists ?sort= values for the strategy list; values are
+// column names interpolated into ORDER BY, so only this map may supply them
+var strategySortColumns = map[string]string{
+	"":                 "name",
+	"name":             "name",
+	"total_pnl":        "total_pnl",
+	"win_rate":         "win_rate",
+	"total_trades":     "total_trades",
+	"last_executed_at": "last_executed_at",
+	"updated_at":       "updated_at",
+}
+
+var strategySortNames = []string{"name", "total_pnl", "win_rate", "total_trades", "last_executed_at", "updated_at"}
+
+// listStrategies returns strategies, optionally searched, sorted and paged:
+// GET /api/v1/strategies?search=graham&sort=total_pnl&order=desc&limit=20&offset=40
+// Deleted strategies are left out unless include_deleted=true.
 func (s *Server) listStrategies(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
-	// Query parameters for filtering
-	activeOnly := r.URL.Query().Get("active") == "true"
+	params := r.URL.Query()
+	sortColumn, ok := strategySortColumns[params.Get("sort")]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":         fmt.Sprintf("invalid sort %q", params.Get("sort")),
+			"allowed_sorts": strategySortNames,
+		})
+		return
+	}
+	direction := "DESC"
+	if params.Get("sort") == "" || params.Get("sort") == "name" {
+		direction = "ASC"
+	}
+	switch params.Get("order") {
+	case "":
+	case "asc":
+		direction = "ASC"
+	case "desc":
+		direction = "DESC"
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "order must be asc or desc"})
+		return
+	}
 
-	query := `
-		SELECT name, description, config, is_active, created_at, updated_at, 
-		       last_executed_at, total_pnl, win_rate, total_trades
-		FROM strategies
-	`
+	// Without a limit every strategy is returned, as before paging existed
+	limit, err := parsePageSize(params.Get("limit"), 0)
+	offset := 0
+	if raw := params.Get("offset"); err == nil && raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			err = fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	var where whereBuilder
+	if params.Get("include_deleted") != "true" {
+		where.add("deleted_at IS NULL")
+	}
+	if params.Get("active") == "true" {
+		where.add("is_active = true")
+	}
+	if search := params.Get("search"); search != "" {
+		s.store.searchStrategies(&where, search)
+	}
 
-	if activeOnly {
-		query += " WHERE is_active = true"
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	var totalCount int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM strategies `+where.sql(), where.args...).
+		Scan(&totalCount); err != nil {
+		logEvent(r.Context(), "Failed to count strategies", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategies",
+		})
+		return
 	}
 
-	query += " ORDER BY name"
+	// Strategies that never traded sort last either way; name breaks ties so pages are stable
+	query := fmt.Sprintf(`
+		SELECT name, description, config, is_active, created_at, updated_at, 
+		       last_executed_at, total_pnl, win_rate, total_trades, deleted_at
+		FROM strategies
+		%s
+		ORDER BY %s %s NULLS LAST, name
+	`, where.sql(), sortColumn, direction)
+	if limit > 0 {
+		query += " LIMIT " + where.arg(limit)
+	}
+	if offset > 0 {
+		query += " OFFSET " + where.arg(offset)
+	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.QueryContext(ctx, query, where.args...)
 	if err != nil {
-		log.Printf("Failed to query strategies: %v", err)
+		logEvent(r.Context(), "Failed to query strategies", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch strategies",
 		})
@@ -100,22 +226,22 @@ func (s *Server) listStrategies(w http.ResponseWriter, r *http.Request) {
 		var config []byte
 		var isActive bool
 		var createdAt, updatedAt time.Time
-		var lastExecutedAt sql.NullTime
+		var lastExecutedAt, deletedAt sql.NullTime
 		var totalPnl sql.NullFloat64
 		var winRate sql.NullFloat64
 		var totalTrades sql.NullInt64
 
 		err := rows.Scan(&name, &description, &config, &isActive, &createdAt, &updatedAt,
-			&lastExecutedAt, &totalPnl, &winRate, &totalTrades)
+			&lastExecutedAt, &totalPnl, &winRate, &totalTrades, &deletedAt)
 		if err != nil {
-			log.Printf("Failed to scan strategy row: %v", err)
+			logEvent(r.Context(), "Failed to scan strategy row", "error", err)
 			continue
 		}
 
 		// Parse config JSON
 		var configMap map[string]interface{}
 		if err := json.Unmarshal(config, &configMap); err != nil {
-			log.Printf("Failed to parse config for %s: %v", name, err)
+			logEvent(r.Context(), "Failed to parse config", "strategy", name, "error", err)
 			configMap = make(map[string]interface{})
 		}
 
@@ -140,60 +266,92 @@ func (s *Server) listStrategies(w http.ResponseWriter, r *http.Request) {
 		if totalTrades.Valid {
 			strategy["total_trades"] = totalTrades.Int64
 		}
+		if deletedAt.Valid {
+			strategy["deleted_at"] = deletedAt.Time.Format(time.RFC3339)
+		}
 
 		strategies = append(strategies, strategy)
 	}
+	if err := rows.Err(); err != nil {
+		logEvent(r.Context(), "Failed to read strategies", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategies",
+		})
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"strategies": strategies,
-		"count":      len(strategies),
+		"strategies":  strategies,
+		"count":       len(strategies),
+		"total_count": totalCount,
+		"limit":       limit,
+		"offset":      offset,
 	})
 }
 
+// errStrategyNotFound is returned by loadStrategy for unknown names
+var errStrategyNotFound = errors.New("strategy not found")
+
 // getStrategy returns details for a specific strategy
 func (s *Server) getStrategy(w http.ResponseWriter, r *http.Request, name string) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
 
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	strategy, err := s.loadStrategy(ctx, name)
+	if errors.Is(err, errStrategyNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' not found", name),
+		})
+		return
+	}
+
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategy",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, strategy)
+}
+
+// loadStrategy reads the full record of a strategy as returned by the API,
+// deleted or not, with its latest version number
+func (s *Server) loadStrategy(ctx context.Context, name string) (map[string]interface{}, error) {
 	query := `
 		SELECT name, description, config, is_active, created_by, created_at, updated_at,
-		       last_executed_at, total_pnl, win_rate, total_trades, metadata
+		       last_executed_at, total_pnl, win_rate, total_trades, metadata, deleted_at, deleted_by,
+		       (SELECT MAX(version) FROM strategy_versions WHERE strategy_name = strategies.name)
 		FROM strategies
 		WHERE name = $1
 	`
 
 	var strategyName, description string
-	var createdBy sql.NullString
+	var createdBy, deletedBy sql.NullString
 	var config, metadata []byte
 	var isActive bool
 	var createdAt, updatedAt time.Time
-	var lastExecutedAt sql.NullTime
+	var lastExecutedAt, deletedAt sql.NullTime
 	var totalPnl sql.NullFloat64
 	var winRate sql.NullFloat64
-	var totalTrades sql.NullInt64
+	var totalTrades, version sql.NullInt64
 
-	err := s.db.QueryRow(query, name).Scan(
+	err := s.db.QueryRowContext(ctx, query, name).Scan(
 		&strategyName, &description, &config, &isActive, &createdBy, &createdAt, &updatedAt,
-		&lastExecutedAt, &totalPnl, &winRate, &totalTrades, &metadata,
+		&lastExecutedAt, &totalPnl, &winRate, &totalTrades, &metadata, &deletedAt, &deletedBy, &version,
 	)
-
 	if err == sql.ErrNoRows {
-		writeJSON(w, http.StatusNotFound, map[string]interface{}{
-			"error": fmt.Sprintf("Strategy '%s' not found", name),
-		})
-		return
+		return nil, errStrategyNotFound
 	}
-
 	if err != nil {
-		log.Printf("Failed to query strategy: %v", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
-			"error": "Failed to fetch strategy",
-		})
-		return
+		return nil, err
 	}
 
 	// Parse JSON fields
@@ -230,13 +388,143 @@ func (s *Server) getStrategy(w http.ResponseWriter, r *http.Request, name string
 	if metadataMap != nil {
 		strategy["metadata"] = metadataMap
 	}
+	if version.Valid {
+		strategy["version"] = version.Int64
+	}
+	if deletedAt.Valid {
+		strategy["deleted_at"] = deletedAt.Time.Format(time.RFC3339)
+		if deletedBy.Valid {
+			strategy["deleted_by"] = deletedBy.String
+		}
+	}
+	return strategy, nil
+}
+
+// patchStrategy changes only the fields present in the body, so toggling
+// is_active no longer means re-sending the whole config:
+// PATCH /api/v1/strategies/{name} {"is_active": false, "description": "..."}
+func (s *Server) patchStrategy(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		IsActive    *bool   `json:"is_active"`
+		Description *string `json:"description"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid JSON; only is_active and description can be patched",
+		})
+		return
+	}
+	if req.IsActive == nil && req.Description == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Nothing to update; pass is_active and/or description",
+		})
+		return
+	}
+
+	sets := []string{"updated_at = NOW()"}
+	args := []interface{}{name}
+	if req.IsActive != nil {
+		args = append(args, *req.IsActive)
+		sets = append(sets, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+	if req.Description != nil {
+		args = append(args, *req.Description)
+		sets = append(sets, fmt.Sprintf("description = $%d", len(args)))
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logEvent(r.Context(), "Failed to update strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to update strategy",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// A new description is a new version of the strategy
+	var description string
+	var config []byte
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		UPDATE strategies SET %s WHERE name = $1 AND deleted_at IS NULL
+		RETURNING COALESCE(description, ''), config
+	`, strings.Join(sets, ", ")), args...).Scan(&description, &config)
+	if err == sql.ErrNoRows && writeStrategyStateError(w, name, strategyState(ctx, tx, name)) {
+		return
+	}
+	if err == nil && req.Description != nil {
+		_, err = recordStrategyVersion(ctx, tx, name, description, config, strategyUpdated, 0, callerID(r.Context()))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to update strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to update strategy",
+		})
+		return
+	}
+	logEvent(r.Context(), "Strategy updated", "strategy", name, "fields", len(sets)-1)
+
+	if req.IsActive != nil {
+		s.publishStrategyEvent(r.Context(), name, *req.IsActive)
+	}
 
+	strategy, err := s.loadStrategy(ctx, name)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Strategy updated but could not be reloaded",
+		})
+		return
+	}
 	writeJSON(w, http.StatusOK, strategy)
 }
 
-// createStrategy creates or updates a strategy
+// strategyEventsChannel is the Redis channel running strategy processes listen on
+const strategyEventsChannel = "strategies:events"
+
+// publishStrategyEvent tells strategy processes that a strategy was activated or
+// deactivated. The database stays the source of truth, so a failed publish is
+// only logged.
+func (s *Server) publishStrategyEvent(ctx context.Context, name string, active bool) {
+	if s.redis == nil {
+		return
+	}
+	eventType := "activated"
+	if !active {
+		eventType = "deactivated"
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":          eventType,
+		"strategy_name": name,
+		"is_active":     active,
+		"timestamp":     time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err := s.redis.Publish(ctx, strategyEventsChannel, payload).Err(); err != nil {
+		logEvent(ctx, "Failed to publish strategy event", "strategy", name, "type", eventType, "error", err)
+	}
+}
+
+// createStrategy creates or updates a strategy, recording the config as a new
+// version when it changed. A deleted strategy must be restored first.
 func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
@@ -252,6 +540,9 @@ func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"error": "Invalid JSON",
 		})
@@ -273,6 +564,11 @@ func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := validateStrategyConfig(req.Config, s.config.StrategyAllowUnknownTypes); errs != nil {
+		writeStrategyConfigError(w, errs)
+		return
+	}
+
 	// Convert config to JSON
 	configJSON, err := json.Marshal(req.Config)
 	if err != nil {
@@ -282,7 +578,7 @@ func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Insert or update strategy
+	// Insert or update strategy; a deleted one is left alone and returns no row
 	query := `
 		INSERT INTO strategies (name, description, config, is_active, created_by)
 		VALUES ($1, $2, $3, $4, $5)
@@ -291,17 +587,45 @@ func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
 			config = EXCLUDED.config,
 			is_active = EXCLUDED.is_active,
 			updated_at = NOW()
+		WHERE strategies.deleted_at IS NULL
 		RETURNING name, created_at, updated_at
 	`
 
 	var name string
 	var createdAt, updatedAt time.Time
 
-	err = s.db.QueryRow(query, req.Name, req.Description, configJSON, req.IsActive, req.CreatedBy).
-		Scan(&name, &createdAt, &updatedAt)
+	changedBy := callerID(r.Context())
+	if changedBy == "" {
+		changedBy = req.CreatedBy
+	}
 
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Failed to create/update strategy: %v", err)
+		logEvent(r.Context(), "Failed to create/update strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to save strategy",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, req.Name, req.Description, configJSON, req.IsActive, req.CreatedBy).
+		Scan(&name, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		writeStrategyStateError(w, req.Name, errStrategyDeleted)
+		return
+	}
+	var version int
+	if err == nil {
+		version, err = recordStrategyVersion(ctx, tx, name, req.Description, configJSON, strategyUpdated, 0, changedBy)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to create/update strategy", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to save strategy",
 		})
@@ -311,49 +635,393 @@ func (s *Server) createStrategy(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":    true,
 		"name":       name,
+		"version":    version,
 		"created_at": createdAt.Format(time.RFC3339),
 		"updated_at": updatedAt.Format(time.RFC3339),
 		"message":    "Strategy saved successfully",
 	})
 }
 
-// deleteStrategy deletes a strategy
+// cloneStrategy copies a strategy under a new name with parts of its config replaced:
+// POST /api/v1/strategies/{name}/clone {"new_name": "...", "overrides": {...}}
+// The clone starts inactive unless is_active is set, and is validated like a new strategy.
+func (s *Server) cloneStrategy(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		NewName     string                 `json:"new_name"`
+		Overrides   map[string]interface{} `json:"overrides"`
+		Description *string                `json:"description"`
+		IsActive    bool                   `json:"is_active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid JSON",
+		})
+		return
+	}
+	if strings.TrimSpace(req.NewName) == "" || strings.Contains(req.NewName, "/") {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "new_name is required and must not contain '/'",
+		})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	var description string
+	var config []byte
+	err := s.db.QueryRowContext(ctx, `SELECT description, config FROM strategies WHERE name = $1`, name).
+		Scan(&description, &config)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' not found", name),
+		})
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategy",
+		})
+		return
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(config, &merged); err != nil || merged == nil {
+		merged = make(map[string]interface{})
+	}
+	mergeConfig(merged, req.Overrides)
+	if errs := validateStrategyConfig(merged, s.config.StrategyAllowUnknownTypes); errs != nil {
+		writeStrategyConfigError(w, errs)
+		return
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+
+	mergedJSON, _ := json.Marshal(merged)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logEvent(r.Context(), "Failed to clone strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to save strategy",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// Deleted strategies keep their names, so a clone cannot take one
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO strategies (name, description, config, is_active, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING
+	`, req.NewName, description, mergedJSON, req.IsActive, callerID(r.Context()))
+	if err == nil {
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": fmt.Sprintf("Strategy '%s' already exists", req.NewName),
+			})
+			return
+		}
+		_, err = recordStrategyVersion(ctx, tx, req.NewName, description, mergedJSON, strategyCreated, 0, callerID(r.Context()))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to clone strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to save strategy",
+		})
+		return
+	}
+	logEvent(r.Context(), "Strategy cloned", "strategy", name, "clone", req.NewName, "overrides", len(req.Overrides))
+
+	strategy, err := s.loadStrategy(ctx, req.NewName)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Strategy cloned but could not be reloaded",
+		})
+		return
+	}
+	strategy["cloned_from"] = name
+	writeJSON(w, http.StatusCreated, strategy)
+}
+
+// mergeConfig applies overrides onto config in place: nested objects are merged
+// key by key, a null removes the key, and any other value replaces it
+func mergeConfig(config, overrides map[string]interface{}) {
+	for key, value := range overrides {
+		if value == nil {
+			delete(config, key)
+			continue
+		}
+		override, isObject := value.(map[string]interface{})
+		if !isObject {
+			config[key] = value
+			continue
+		}
+		existing, wasObject := config[key].(map[string]interface{})
+		if !wasObject {
+			existing = make(map[string]interface{})
+			config[key] = existing
+		}
+		mergeConfig(existing, override)
+	}
+}
+
+// writeStrategyConfigError responds 422 with the config problems field by field
+func writeStrategyConfigError(w http.ResponseWriter, errs validationError) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success": false,
+		"error":   "Strategy config validation failed",
+		"errors":  []FieldError(errs),
+	})
+}
+
+// strategyPosition is a nonzero position still held under a strategy
+type strategyPosition struct {
+	Symbol   string  `json:"symbol"`
+	Account  string  `json:"account"`
+	Quantity float64 `json:"quantity"`
+}
+
+// strategyOrder is an order of a strategy still resting on its exchange
+type strategyOrder struct {
+	OrderID         string `json:"order_id"`
+	ExchangeOrderID string `json:"exchange_order_id"`
+	StrategyName    string `json:"strategy_name"`
+	Symbol          string `json:"symbol"`
+	Side            string `json:"side"`
+	Exchange        string `json:"exchange"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+}
+
+// strategyBlockers lists what deleting a strategy would orphan: nonzero positions
+// and orders that are not yet final
+func (s *Server) strategyBlockers(ctx context.Context, name string) ([]strategyPosition, []strategyOrder, error) {
+	positions := make([]strategyPosition, 0)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT symbol, account, quantity FROM positions
+		WHERE strategy_name = $1 AND quantity <> 0
+		ORDER BY symbol
+	`, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var p strategyPosition
+		if err := rows.Scan(&p.Symbol, &p.Account, &p.Quantity); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		positions = append(positions, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	orders := make([]strategyOrder, 0)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT order_id, COALESCE(exchange_order_id, ''), strategy_name, symbol, side, COALESCE(exchange, ''), account, status
+		FROM trades
+		WHERE strategy_name = $1 AND status IN ('NEW', 'PARTIALLY_FILLED', 'PENDING')
+		ORDER BY timestamp
+	`, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o strategyOrder
+		var exchange, account string
+		if err := rows.Scan(&o.OrderID, &o.ExchangeOrderID, &o.StrategyName, &o.Symbol, &o.Side, &exchange, &account, &o.Status); err != nil {
+			return nil, nil, err
+		}
+		if exchange == "" {
+			exchange = "binance"
+		}
+		o.Exchange = exchangeKey(exchange, account)
+		orders = append(orders, o)
+	}
+	return positions, orders, rows.Err()
+}
+
+// cancelStrategyOrders cancels resting orders on their exchanges and returns the
+// ones that could not be cancelled, with the reason
+func (s *Server) cancelStrategyOrders(ctx context.Context, orders []strategyOrder) []strategyOrder {
+	failed := make([]strategyOrder, 0)
+	for _, o := range orders {
+		s.mu.RLock()
+		exchange, exists := s.exchanges[o.Exchange]
+		s.mu.RUnlock()
+
+		var err error
+		if !exists {
+			err = fmt.Errorf("exchange %s not configured", o.Exchange)
+		} else {
+			id := o.ExchangeOrderID
+			if id == "" {
+				id = o.OrderID
+			}
+			err = s.cancelOrder(ctx, o.Exchange, exchange,
+				&Order{ID: o.OrderID, StrategyName: o.StrategyName, Symbol: o.Symbol, Side: o.Side}, id)
+		}
+		if err != nil {
+			logEvent(ctx, "Failed to cancel strategy order", "order_id", o.OrderID, "exchange", o.Exchange, "error", err)
+			o.Error = err.Error()
+			failed = append(failed, o)
+		}
+	}
+	return failed
+}
+
+// deleteStrategy soft-deletes a strategy: it is deactivated and hidden from the
+// list until restored, and its trades, stats and versions are kept. A strategy
+// with nonzero positions or open orders is refused with 409 unless ?force=true,
+// which cancels the orders and marks the positions orphaned before deleting.
 func (s *Server) deleteStrategy(w http.ResponseWriter, r *http.Request, name string) {
-	if s.db == nil {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
 		return
 	}
+	ctx := r.Context()
+	force := r.URL.Query().Get("force") == "true"
 
-	query := `DELETE FROM strategies WHERE name = $1`
+	// The lookups get the statement timeout; cancelling orders runs under the
+	// exchanges' own deadlines
+	lookupCtx, cancel := s.dbContext(ctx)
+	defer cancel()
+	if err := strategyState(lookupCtx, s.db, name); err != nil {
+		if errors.Is(err, errStrategyDeleted) {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"error": fmt.Sprintf("Strategy '%s' is already deleted", name),
+			})
+			return
+		}
+		if !writeStrategyStateError(w, name, err) {
+			logEvent(ctx, "Failed to delete strategy", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to delete strategy",
+			})
+		}
+		return
+	}
 
-	result, err := s.db.Exec(query, name)
+	positions, orders, err := s.strategyBlockers(lookupCtx, name)
 	if err != nil {
-		log.Printf("Failed to delete strategy: %v", err)
+		logEvent(ctx, "Failed to check strategy positions and orders", "strategy", name, "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to delete strategy",
 		})
 		return
 	}
+	if !force && (len(positions) > 0 || len(orders) > 0) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' has %d open positions and %d open orders; pass force=true to cancel the orders and orphan the positions",
+				name, len(positions), len(orders)),
+			"open_positions": positions,
+			"open_orders":    orders,
+		})
+		return
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		writeJSON(w, http.StatusNotFound, map[string]interface{}{
-			"error": fmt.Sprintf("Strategy '%s' not found", name),
+	// Orders are cancelled before the transaction: exchange calls cannot be rolled
+	// back, and the strategy is kept if any order is still resting
+	if failed := s.cancelStrategyOrders(ctx, orders); len(failed) > 0 {
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error":         fmt.Sprintf("Failed to cancel %d of %d open orders; strategy not deleted", len(failed), len(orders)),
+			"failed_orders": failed,
+		})
+		return
+	}
+
+	wasActive, err := s.deleteStrategyTx(ctx, name, orders)
+	if err != nil {
+		logEvent(ctx, "Failed to delete strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to delete strategy",
 		})
 		return
 	}
+	logEvent(ctx, "Strategy deleted", "strategy", name, "forced", force,
+		"cancelled_orders", len(orders), "orphaned_positions", len(positions))
+	if wasActive {
+		s.publishStrategyEvent(ctx, name, false)
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("Strategy '%s' deleted successfully", name),
+		"success":            true,
+		"message":            fmt.Sprintf("Strategy '%s' deleted successfully", name),
+		"cancelled_orders":   len(orders),
+		"orphaned_positions": len(positions),
 	})
 }
 
-// getStrategyPerformance returns performance metrics for a strategy
-func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request, name string) {
-	if s.db == nil {
+// deleteStrategyTx records the cancelled orders, marks the strategy's remaining
+// positions orphaned and marks the strategy deleted and inactive, all or nothing,
+// reporting whether it was active. Trades keep their strategy_name as history.
+func (s *Server) deleteStrategyTx(ctx context.Context, name string, cancelled []strategyOrder) (bool, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, o := range cancelled {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE trades SET status = 'CANCELED' WHERE order_id = $1
+		`, o.OrderID); err != nil {
+			return false, err
+		}
+	}
+	if err := s.store.orphanStrategyPositions(ctx, tx, name); err != nil {
+		return false, err
+	}
+	var wasActive bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT is_active FROM strategies WHERE name = $1 AND deleted_at IS NULL
+	`, name).Scan(&wasActive); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE strategies SET deleted_at = NOW(), deleted_by = $2, is_active = false, updated_at = NOW()
+		WHERE name = $1
+	`, name, callerID(ctx)); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	orderIDs := make([]string, len(cancelled))
+	for i, o := range cancelled {
+		orderIDs[i] = o.OrderID
+	}
+	s.forgetOrderStatus(ctx, orderIDs...)
+	s.refreshLeaderboard(ctx, name)
+	return wasActive, nil
+}
+
+// getStrategyPerformance returns performance metrics for a strategy, read with
+// intent
+func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request, name string, intent readIntent) {
+	if !s.dbAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "Database not available",
 		})
@@ -372,7 +1040,10 @@ func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request,
 	var totalTrades sql.NullInt64
 	var lastExecutedAt sql.NullTime
 
-	err := s.db.QueryRow(strategyQuery, name).Scan(&totalPnl, &winRate, &totalTrades, &lastExecutedAt)
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	db := s.store.reader(intent)
+	err := db.QueryRowContext(ctx, strategyQuery, name).Scan(&totalPnl, &winRate, &totalTrades, &lastExecutedAt)
 	if err == sql.ErrNoRows {
 		writeJSON(w, http.StatusNotFound, map[string]interface{}{
 			"error": fmt.Sprintf("Strategy '%s' not found", name),
@@ -380,41 +1051,71 @@ func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request,
 		return
 	}
 	if err != nil {
-		log.Printf("Failed to query strategy performance: %v", err)
+		logEvent(r.Context(), "Failed to query strategy performance", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
 			"error": "Failed to fetch performance data",
 		})
 		return
 	}
 
-	// Get recent trades
-	tradesQuery := `
-		SELECT symbol, side, quantity, executed_price, pnl, executed_at
+	// Get recent trades, paged with the same keyset cursor as the order list
+	limit, err := parsePageSize(r.URL.Query().Get("limit"), 10)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var where whereBuilder
+	where.add("strategy_name = ?", name)
+	where.add("executed_at IS NOT NULL")
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		where.addCursor("executed_at", cursor)
+	}
+
+	tradesQuery := fmt.Sprintf(`
+		SELECT order_id, symbol, side, quantity, executed_price, pnl, executed_at
 		FROM trades
-		WHERE strategy_name = $1 AND executed_at IS NOT NULL
-		ORDER BY executed_at DESC
-		LIMIT 10
-	`
+		%s
+		ORDER BY executed_at DESC, order_id DESC
+		LIMIT %s
+	`, where.sql(), where.arg(limit+1))
 
-	rows, err := s.db.Query(tradesQuery, name)
+	rows, err := db.QueryContext(ctx, tradesQuery, where.args...)
 	if err != nil {
-		log.Printf("Failed to query recent trades: %v", err)
+		logEvent(r.Context(), "Failed to query recent trades", "error", err)
 	}
 
 	recentTrades := make([]map[string]interface{}, 0)
+	var nextCursor, lastOrderID string
+	var lastTradeAt time.Time
 	if rows != nil {
 		defer rows.Close()
 		for rows.Next() {
-			var symbol, side string
+			var orderID, symbol, side string
 			var quantity, executedPrice float64
 			var pnl sql.NullFloat64
 			var executedAt time.Time
 
-			if err := rows.Scan(&symbol, &side, &quantity, &executedPrice, &pnl, &executedAt); err != nil {
+			if err := rows.Scan(&orderID, &symbol, &side, &quantity, &executedPrice, &pnl, &executedAt); err != nil {
 				continue
 			}
 
+			if len(recentTrades) == limit {
+				nextCursor = encodeCursor(lastTradeAt, lastOrderID)
+				break
+			}
+
 			trade := map[string]interface{}{
+				"order_id":       orderID,
 				"symbol":         symbol,
 				"side":           side,
 				"quantity":       quantity,
@@ -426,6 +1127,12 @@ func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request,
 			}
 
 			recentTrades = append(recentTrades, trade)
+			lastTradeAt, lastOrderID = executedAt, orderID
+		}
+		if err := rows.Err(); err != nil {
+			// A cut-off page would look complete; leave the trades out instead
+			logEvent(r.Context(), "Failed to read recent trades", "error", err)
+			recentTrades, nextCursor = make([]map[string]interface{}, 0), ""
 		}
 	}
 
@@ -433,6 +1140,9 @@ func (s *Server) getStrategyPerformance(w http.ResponseWriter, r *http.Request,
 		"strategy_name": name,
 		"recent_trades": recentTrades,
 	}
+	if nextCursor != "" {
+		performance["next_cursor"] = nextCursor
+	}
 
 	if totalPnl.Valid {
 		performance["total_pnl"] = totalPnl.Float64
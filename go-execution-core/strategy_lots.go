@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"execution-engine/pkg/position"
+)
+
+// Realized PnL on trades.pnl is measured per strategy and symbol: each strategy's
+// fills are matched first in, first out against its own open lots, kept in
+// strategy_lots, whatever account position they also moved. Matching runs in the
+// transaction that books a fill to its position (bookOrderTx), so it sees the
+// same fill quantity, price and fees (converted to the quote currency). Closing
+// fills get the PnL they realized, net of fees on both legs; opening fills keep a
+// NULL pnl. `execution-engine recompute-pnl` rebuilds lots and pnl from the
+// booked fills of every trade.
+
+// strategyLotsLockID keys the advisory lock taken shared by every booking and
+// exclusively by a recompute
+const strategyLotsLockID = 0x504e4c4c4f54 // "PNLLOT"
+
+// strategyLotsBatch is the rows per statement a recompute writes
+const strategyLotsBatch = 500
+
+// strategyLotRow is a row of strategy_lots
+type strategyLotRow struct {
+	OrderID   string
+	Quantity  float64 // signed quantity the lot opened with
+	Remaining float64 // signed quantity still open, 0 once closed
+	Price     float64 // entry price including the opening fee share
+	OpenedAt  time.Time
+	ClosedAt  *time.Time
+}
+
+// lockStrategyLots waits out a running recompute. Bookings take it before locking
+// any trades row, which a recompute also updates. SQLite transactions already
+// hold the database.
+func (st *Store) lockStrategyLots(ctx context.Context, tx *sql.Tx) error {
+	if st.dialect == dialectSQLite {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock_shared($1)`, strategyLotsLockID)
+	return err
+}
+
+// applyStrategyFill matches a newly booked fill against the open lots of its
+// strategy and symbol within tx and records the result
+func (st *Store) applyStrategyFill(ctx context.Context, tx *sql.Tx, strategy, symbol, orderID string,
+	fill position.Fill, at time.Time) (position.LotMatch, error) {
+	// Serializes fills of one strategy and symbol, including the first ones,
+	// which have no lot rows to lock
+	if st.dialect == dialectPostgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, strategy+"|"+symbol); err != nil {
+			return position.LotMatch{}, err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, remaining, price
+		FROM strategy_lots
+		WHERE strategy_name = $1 AND symbol = $2 AND remaining != 0
+		ORDER BY id
+	`, strategy, symbol)
+	if err != nil {
+		return position.LotMatch{}, err
+	}
+	var ids []int64
+	var open []position.Lot
+	for rows.Next() {
+		var id int64
+		var lot position.Lot
+		if err := rows.Scan(&id, &lot.Quantity, &lot.Price); err != nil {
+			rows.Close()
+			return position.LotMatch{}, err
+		}
+		ids = append(ids, id)
+		open = append(open, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return position.LotMatch{}, err
+	}
+
+	match, err := position.MatchLots(open, fill)
+	if err != nil {
+		return position.LotMatch{}, err
+	}
+	if match.Closed > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE strategy_lots SET remaining = 0, closed_at = $2 WHERE `+st.dialect.inList("id", "$1"),
+			st.dialect.listArg(ids[:match.Closed]), at); err != nil {
+			return position.LotMatch{}, err
+		}
+	}
+	if match.Reduced {
+		if _, err := tx.ExecContext(ctx, `UPDATE strategy_lots SET remaining = $2 WHERE id = $1`,
+			ids[match.Closed], match.Remaining); err != nil {
+			return position.LotMatch{}, err
+		}
+	}
+	if match.Opened != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO strategy_lots (strategy_name, symbol, open_order_id, quantity, remaining, price, opened_at)
+			VALUES ($1, $2, $3, $4, $4, $5, $6)
+		`, strategy, symbol, orderID, match.Opened.Quantity, match.Opened.Price, at); err != nil {
+			return position.LotMatch{}, err
+		}
+	}
+	return match, nil
+}
+
+// bookedTradeFill is a trade's booked fill, replayed by a recompute
+type bookedTradeFill struct {
+	OrderID, Strategy, Symbol string
+	Fill                      position.Fill
+	At                        time.Time
+}
+
+// recomputeResult summarizes a recompute
+type recomputeResult struct {
+	Fills      int
+	Closing    int
+	OpenLots   int
+	Realized   float64
+	Strategies map[string]float64 // realized PnL per strategy
+}
+
+// recomputeStrategyPnL rebuilds strategy_lots and the pnl of trades and
+// trades_archive from booked fills in execution order, for one strategy or all
+// ("")
+func recomputeStrategyPnL(ctx context.Context, tx *sql.Tx, strategy string) (*recomputeResult, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, strategyLotsLockID); err != nil {
+		return nil, err
+	}
+
+	var where whereBuilder
+	where.add("booked_quantity > 0")
+	if strategy != "" {
+		where.add("strategy_name = ?", strategy)
+	}
+	// Archived trades still hold fills that opened or closed lots
+	columns := `order_id, strategy_name, symbol, side, booked_quantity, booked_notional, booked_fees,
+		COALESCE(executed_at, timestamp) AS executed_at, timestamp`
+	rows, err := tx.QueryContext(ctx, `
+		SELECT order_id, strategy_name, symbol, side, booked_quantity, booked_notional, booked_fees, executed_at
+		FROM (
+			SELECT `+columns+` FROM trades `+where.sql()+`
+			UNION ALL
+			SELECT `+columns+` FROM trades_archive `+where.sql()+`
+		) booked
+		ORDER BY executed_at, timestamp, order_id
+	`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	var fills []bookedTradeFill
+	for rows.Next() {
+		var f bookedTradeFill
+		var notional float64
+		if err := rows.Scan(&f.OrderID, &f.Strategy, &f.Symbol, &f.Fill.Side, &f.Fill.Quantity, &notional,
+			&f.Fill.Fee, &f.At); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		f.Fill.Price = notional / f.Fill.Quantity
+		fills = append(fills, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Replay in memory, then write everything
+	type lotKey struct{ strategy, symbol string }
+	lots := make(map[lotKey][]*strategyLotRow)
+	var all []*strategyLotRow
+	lotOwner := make(map[*strategyLotRow]lotKey)
+	pnl := make(map[string]float64)
+	result := &recomputeResult{Fills: len(fills), Strategies: make(map[string]float64)}
+	for _, f := range fills {
+		key := lotKey{f.Strategy, f.Symbol}
+		open := lots[key]
+		current := make([]position.Lot, len(open))
+		for i, lot := range open {
+			current[i] = position.Lot{Quantity: lot.Remaining, Price: lot.Price}
+		}
+		match, err := position.MatchLots(current, f.Fill)
+		if err != nil {
+			return nil, fmt.Errorf("order %s: %w", f.OrderID, err)
+		}
+		for _, lot := range open[:match.Closed] {
+			at := f.At
+			lot.Remaining, lot.ClosedAt = 0, &at
+		}
+		open = open[match.Closed:]
+		if match.Reduced {
+			open[0].Remaining = match.Remaining
+		}
+		if match.Opened != nil {
+			lot := &strategyLotRow{OrderID: f.OrderID, Quantity: match.Opened.Quantity,
+				Remaining: match.Opened.Quantity, Price: match.Opened.Price, OpenedAt: f.At}
+			open = append(open, lot)
+			all = append(all, lot)
+			lotOwner[lot] = key
+		}
+		lots[key] = open
+		if match.ClosedQty > 0 {
+			pnl[f.OrderID] += match.Realized
+			result.Closing++
+			result.Realized += match.Realized
+			result.Strategies[f.Strategy] += match.Realized
+		}
+	}
+
+	deleteLots := `DELETE FROM strategy_lots`
+	reset := ` SET pnl = NULL WHERE pnl IS NOT NULL`
+	var args []interface{}
+	if strategy != "" {
+		deleteLots += ` WHERE strategy_name = $1`
+		reset += ` AND strategy_name = $1`
+		args = append(args, strategy)
+	}
+	for _, query := range []string{deleteLots, `UPDATE trades` + reset, `UPDATE trades_archive` + reset} {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	for start := 0; start < len(all); start += strategyLotsBatch {
+		batch := all[start:]
+		if len(batch) > strategyLotsBatch {
+			batch = batch[:strategyLotsBatch]
+		}
+		values := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, 8*len(batch))
+		for _, lot := range batch {
+			key := lotOwner[lot]
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+			args = append(args, key.strategy, key.symbol, lot.OrderID, lot.Quantity, lot.Remaining, lot.Price,
+				lot.OpenedAt, lot.ClosedAt)
+			if lot.Remaining != 0 {
+				result.OpenLots++
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO strategy_lots (strategy_name, symbol, open_order_id, quantity, remaining, price, opened_at, closed_at)
+			VALUES `+strings.Join(values, ", "), args...); err != nil {
+			return nil, err
+		}
+	}
+
+	orderIDs := make([]string, 0, len(pnl))
+	for orderID := range pnl {
+		orderIDs = append(orderIDs, orderID)
+	}
+	for start := 0; start < len(orderIDs); start += strategyLotsBatch {
+		batch := orderIDs[start:]
+		if len(batch) > strategyLotsBatch {
+			batch = batch[:strategyLotsBatch]
+		}
+		values := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, 2*len(batch))
+		for _, orderID := range batch {
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d::varchar, $%d::numeric)", n+1, n+2))
+			args = append(args, orderID, pnl[orderID])
+		}
+		for _, table := range []string{"trades", "trades_archive"} {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE `+table+` t SET pnl = v.pnl
+				FROM (VALUES `+strings.Join(values, ", ")+`) AS v(order_id, pnl)
+				WHERE t.order_id = v.order_id
+			`, args...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// runRecomputePnLCommand is `execution-engine recompute-pnl`
+func runRecomputePnLCommand(args []string) int {
+	usage := "usage: execution-engine recompute-pnl [--strategy NAME] [--dry-run]"
+	flags := flag.NewFlagSet("recompute-pnl", flag.ContinueOnError)
+	strategy := flags.String("strategy", "", "only this strategy (default all)")
+	dryRun := flags.Bool("dry-run", false, "compute and report without saving")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	config := loadConfig()
+	if err := requirePostgres(config.DatabaseURL, "recompute-pnl"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := initDatabase(config.DatabaseURL, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start transaction: %v\n", err)
+		return 1
+	}
+	defer tx.Rollback()
+
+	// Bookings wait while the lots are rebuilt
+	result, err := recomputeStrategyPnL(ctx, tx, *strategy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recompute failed, nothing changed: %v\n", err)
+		return 1
+	}
+	for name, realized := range result.Strategies {
+		fmt.Printf("%-30s realized %.8f\n", name, realized)
+	}
+	fmt.Printf("%d fills replayed, %d closing, %d lots open, realized %.8f\n",
+		result.Fills, result.Closing, result.OpenLots, result.Realized)
+	if *dryRun {
+		fmt.Println("Dry run; nothing saved")
+		return 0
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save: %v\n", err)
+		return 1
+	}
+	return 0
+}
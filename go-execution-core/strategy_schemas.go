@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// configField describes one value of a strategy config. Kind is "number",
+// "integer", "string", "bool", "object" or "array".
+type configField struct {
+	Kind     string
+	Required bool
+	Min      *float64 // inclusive bounds for numbers
+	Max      *float64
+	Enum     []string
+	Fields   map[string]configField // keys of an object
+	Items    *configField           // elements of an array
+	MinItems int
+}
+
+// strategySchema is the config contract of one strategy type, selected by the
+// "type" key of the config
+type strategySchema struct {
+	Description string
+	Fields      map[string]configField
+	// check runs cross-field rules once every field has the right shape
+	check func(config map[string]interface{}, add func(field, format string, args ...interface{}))
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+var conditionOperators = []string{"<", "<=", ">", ">=", "==", "!="}
+
+// strategySchemas is the registry of known strategy types
+var strategySchemas = map[string]strategySchema{
+	"mean_reversion": {
+		Description: "Trade back toward a moving average when price leaves its Bollinger band",
+		Fields: map[string]configField{
+			"symbol":        {Kind: "string", Required: true},
+			"window":        {Kind: "integer", Required: true, Min: bound(2), Max: bound(1000)},
+			"num_std":       {Kind: "number", Required: true, Min: bound(0.1), Max: bound(10)},
+			"position_size": {Kind: "number", Min: bound(0), Max: bound(1)},
+		},
+	},
+	"trend_follower": {
+		Description: "Follow fast/slow moving average crossovers",
+		Fields: map[string]configField{
+			"symbol":        {Kind: "string", Required: true},
+			"fast_period":   {Kind: "integer", Required: true, Min: bound(1), Max: bound(1000)},
+			"slow_period":   {Kind: "integer", Required: true, Min: bound(2), Max: bound(1000)},
+			"position_size": {Kind: "number", Min: bound(0), Max: bound(1)},
+		},
+		check: func(config map[string]interface{}, add func(field, format string, args ...interface{})) {
+			fast, _ := config["fast_period"].(float64)
+			slow, _ := config["slow_period"].(float64)
+			if fast >= slow {
+				add("slow_period", "must be greater than fast_period")
+			}
+		},
+	},
+	"rule_based": {
+		Description: "Act when enough data-source rules agree, e.g. GrahamDefensive",
+		Fields: map[string]configField{
+			"rules": {Kind: "array", Required: true, MinItems: 1, Items: &configField{
+				Kind: "object",
+				Fields: map[string]configField{
+					"id":     {Kind: "string", Required: true},
+					"source": {Kind: "string", Required: true, Enum: []string{"fundamental", "polymarket", "technical", "onchain", "news"}},
+					"conditions": {Kind: "array", Required: true, MinItems: 1, Items: &configField{
+						Kind: "object",
+						Fields: map[string]configField{
+							"metric":    {Kind: "string"},
+							"market":    {Kind: "string"},
+							"operator":  {Kind: "string", Required: true, Enum: conditionOperators},
+							"threshold": {Kind: "number", Required: true},
+						},
+					}},
+				},
+			}},
+			"execution": {Kind: "object", Required: true, Fields: map[string]configField{
+				"require_confirmations": {Kind: "integer", Required: true, Min: bound(1)},
+				"position_size":         {Kind: "number", Required: true, Min: bound(0), Max: bound(1)},
+				"action_mode":           {Kind: "string", Enum: []string{"notify", "execute"}},
+			}},
+		},
+		check: func(config map[string]interface{}, add func(field, format string, args ...interface{})) {
+			rules, _ := config["rules"].([]interface{})
+			execution, _ := config["execution"].(map[string]interface{})
+			if confirmations, ok := execution["require_confirmations"].(float64); ok && int(confirmations) > len(rules) {
+				add("execution.require_confirmations", "must not exceed the %d rules", len(rules))
+			}
+			for i, r := range rules {
+				rule, _ := r.(map[string]interface{})
+				conditions, _ := rule["conditions"].([]interface{})
+				for j, c := range conditions {
+					condition, _ := c.(map[string]interface{})
+					_, hasMetric := condition["metric"]
+					_, hasMarket := condition["market"]
+					if hasMetric == hasMarket {
+						add(fmt.Sprintf("rules[%d].conditions[%d]", i, j), "needs exactly one of metric or market")
+					}
+				}
+			}
+		},
+	},
+}
+
+// strategyTypes lists the registered types for error messages
+func strategyTypes() []string {
+	types := make([]string, 0, len(strategySchemas))
+	for name := range strategySchemas {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// validateStrategyConfig checks a config against the schema named by its "type".
+// Configs without a registered type pass only when allowUnknown is set. Returns
+// nil when the config is valid.
+func validateStrategyConfig(config map[string]interface{}, allowUnknown bool) validationError {
+	var errs validationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	rawType, present := config["type"]
+	strategyType, isString := rawType.(string)
+	if present && !isString {
+		add("config.type", "must be a string")
+		return errs
+	}
+	schema, known := strategySchemas[strategyType]
+	if !known {
+		if !allowUnknown {
+			if strategyType == "" {
+				add("config.type", "is required, one of %s", strings.Join(strategyTypes(), ", "))
+			} else {
+				add("config.type", "unknown strategy type %q, expected one of %s",
+					strategyType, strings.Join(strategyTypes(), ", "))
+			}
+		}
+		return errs
+	}
+
+	fields := make(map[string]configField, len(schema.Fields)+1)
+	for name, field := range schema.Fields {
+		fields[name] = field
+	}
+	fields["type"] = configField{Kind: "string", Required: true}
+	checkConfigObject("config", config, fields, add)
+	if len(errs) == 0 && schema.check != nil {
+		schema.check(config, func(field, format string, args ...interface{}) {
+			add("config."+field, format, args...)
+		})
+	}
+	return errs
+}
+
+// checkConfigObject validates the keys of one object; unknown keys are rejected
+// so a mistyped parameter name does not silently fall back to a default
+func checkConfigObject(path string, object map[string]interface{}, fields map[string]configField,
+	add func(field, format string, args ...interface{})) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, present := object[name]
+		if !present {
+			if fields[name].Required {
+				add(path+"."+name, "is required")
+			}
+			continue
+		}
+		checkConfigValue(path+"."+name, value, fields[name], add)
+	}
+
+	extra := make([]string, 0)
+	for name := range object {
+		if _, known := fields[name]; !known {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		add(path+"."+name, "is not a known parameter")
+	}
+}
+
+func checkConfigValue(path string, value interface{}, field configField,
+	add func(field, format string, args ...interface{})) {
+	switch field.Kind {
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			add(path, "must be a number")
+			return
+		}
+		if field.Kind == "integer" && n != math.Trunc(n) {
+			add(path, "must be an integer")
+			return
+		}
+		if field.Min != nil && n < *field.Min {
+			add(path, "must be at least %g", *field.Min)
+		}
+		if field.Max != nil && n > *field.Max {
+			add(path, "must be at most %g", *field.Max)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			add(path, "must be a string")
+			return
+		}
+		if field.Required && strings.TrimSpace(s) == "" {
+			add(path, "must not be empty")
+			return
+		}
+		if len(field.Enum) > 0 {
+			for _, allowed := range field.Enum {
+				if s == allowed {
+					return
+				}
+			}
+			add(path, "must be one of %s, got %q", strings.Join(field.Enum, ", "), s)
+		}
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			add(path, "must be true or false")
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			add(path, "must be an object")
+			return
+		}
+		checkConfigObject(path, object, field.Fields, add)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			add(path, "must be an array")
+			return
+		}
+		if len(items) < field.MinItems {
+			add(path, "must have at least %d items", field.MinItems)
+		}
+		if field.Items != nil {
+			for i, item := range items {
+				checkConfigValue(fmt.Sprintf("%s[%d]", path, i), item, *field.Items, add)
+			}
+		}
+	}
+}
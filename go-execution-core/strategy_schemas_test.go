@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// parseConfig decodes a config the way the handlers do, so numbers are float64
+func parseConfig(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("%s: %v", raw, err)
+	}
+	return config
+}
+
+func errorFields(errs validationError) []string {
+	fields := make([]string, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+const validRuleBased = `{"type":"rule_based",
+	"rules":[
+		{"id":"pe","source":"fundamental","conditions":[{"metric":"pe_ratio","operator":"<","threshold":15}]},
+		{"id":"odds","source":"polymarket","conditions":[{"market":"fed-cut","operator":">=","threshold":0.6}]}
+	],
+	"execution":{"require_confirmations":2,"position_size":0.1,"action_mode":"notify"}}`
+
+func TestValidateStrategyConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		allowUnknown bool
+		want         []string // fields with an error, sorted
+	}{
+		{name: "mean_reversion valid", config: `{"type":"mean_reversion","symbol":"BTCUSDT","window":20,"num_std":2}`},
+		{name: "mean_reversion with position size", config: `{"type":"mean_reversion","symbol":"BTCUSDT","window":20,"num_std":2,"position_size":0.5}`},
+		{name: "mean_reversion missing fields", config: `{"type":"mean_reversion","symbol":"BTCUSDT"}`,
+			want: []string{"config.num_std", "config.window"}},
+		{name: "mean_reversion wrong types", config: `{"type":"mean_reversion","symbol":7,"window":"20","num_std":2}`,
+			want: []string{"config.symbol", "config.window"}},
+		{name: "mean_reversion fractional window", config: `{"type":"mean_reversion","symbol":"BTCUSDT","window":20.5,"num_std":2}`,
+			want: []string{"config.window"}},
+		{name: "mean_reversion out of range", config: `{"type":"mean_reversion","symbol":"BTCUSDT","window":1,"num_std":11,"position_size":1.5}`,
+			want: []string{"config.num_std", "config.position_size", "config.window"}},
+		{name: "mean_reversion blank symbol", config: `{"type":"mean_reversion","symbol":" ","window":20,"num_std":2}`,
+			want: []string{"config.symbol"}},
+		{name: "mean_reversion misspelled parameter", config: `{"type":"mean_reversion","symbol":"BTCUSDT","window":20,"num_std":2,"windw":30}`,
+			want: []string{"config.windw"}},
+
+		{name: "trend_follower valid", config: `{"type":"trend_follower","symbol":"ETHUSDT","fast_period":10,"slow_period":50}`},
+		{name: "trend_follower fast not below slow", config: `{"type":"trend_follower","symbol":"ETHUSDT","fast_period":50,"slow_period":50}`,
+			want: []string{"config.slow_period"}},
+		{name: "trend_follower field errors skip the cross check", config: `{"type":"trend_follower","symbol":"ETHUSDT","fast_period":60,"slow_period":5000}`,
+			want: []string{"config.slow_period"}},
+
+		{name: "rule_based valid", config: validRuleBased},
+		{name: "rule_based too many confirmations", config: `{"type":"rule_based",
+			"rules":[{"id":"pe","source":"fundamental","conditions":[{"metric":"pe_ratio","operator":"<","threshold":15}]}],
+			"execution":{"require_confirmations":2,"position_size":0.1}}`,
+			want: []string{"config.execution.require_confirmations"}},
+		{name: "rule_based condition with metric and market", config: `{"type":"rule_based",
+			"rules":[{"id":"pe","source":"fundamental","conditions":[{"metric":"pe_ratio","market":"x","operator":"<","threshold":15}]}],
+			"execution":{"require_confirmations":1,"position_size":0.1}}`,
+			want: []string{"config.rules[0].conditions[0]"}},
+		{name: "rule_based nested field errors", config: `{"type":"rule_based",
+			"rules":[{"id":"pe","source":"rumours","conditions":[{"metric":"pe_ratio","operator":"=~","threshold":"low"}]}],
+			"execution":{"require_confirmations":1,"position_size":0.1,"action_mode":"yolo"}}`,
+			want: []string{"config.execution.action_mode", "config.rules[0].conditions[0].operator",
+				"config.rules[0].conditions[0].threshold", "config.rules[0].source"}},
+		{name: "rule_based empty rules", config: `{"type":"rule_based","rules":[],"execution":{"require_confirmations":1,"position_size":0.1}}`,
+			want: []string{"config.rules"}},
+
+		{name: "missing type", config: `{"symbol":"BTCUSDT"}`, want: []string{"config.type"}},
+		{name: "type not a string", config: `{"type":3}`, want: []string{"config.type"}},
+		{name: "unknown type", config: `{"type":"martingale"}`, want: []string{"config.type"}},
+		{name: "unknown type allowed", config: `{"type":"martingale","anything":true}`, allowUnknown: true},
+		{name: "type not a string with unknown allowed", config: `{"type":3}`, allowUnknown: true, want: []string{"config.type"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateStrategyConfig(parseConfig(t, tt.config), tt.allowUnknown)
+			got := errorFields(errs)
+			if len(tt.want) == 0 && len(got) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("error fields = %v, want %v (%v)", got, tt.want, errs)
+			}
+		})
+	}
+}
+
+// TestCreateStrategyConfigErrors posts configs to the real handler and checks
+// the per-field 422 body and the request metrics it leaves behind
+func TestCreateStrategyConfigErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+	srv := serveTest(t, s)
+
+	rejected := []string{"route", "/api/v1/strategies", "method", "POST", "status_class", "4xx"}
+	before, _ := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", rejected...)
+
+	code, body := doJSON(t, srv, http.MethodPost, "/api/v1/strategies", map[string]interface{}{
+		"name":   "mr-bad",
+		"config": parseConfig(t, `{"type":"mean_reversion","symbol":"BTCUSDT","window":1,"num_std":"2","lookback":5}`),
+	})
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d: %v", code, body)
+	}
+	errs, _ := body["errors"].([]interface{})
+	fields := map[string]string{}
+	for _, e := range errs {
+		fe, _ := e.(map[string]interface{})
+		field, _ := fe["field"].(string)
+		message, _ := fe["message"].(string)
+		fields[field] = message
+	}
+	want := map[string]string{
+		"config.window":   "must be at least 2",
+		"config.num_std":  "must be a number",
+		"config.lookback": "is not a known parameter",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("errors = %v, want %v", fields, want)
+	}
+
+	code, body = doJSON(t, srv, http.MethodPost, "/api/v1/strategies", map[string]interface{}{
+		"name":   "tf-bad",
+		"config": parseConfig(t, `{"type":"trend_follower","symbol":"ETHUSDT","fast_period":20,"slow_period":10}`),
+	})
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d: %v", code, body)
+	}
+
+	for name, config := range map[string]string{
+		"mr-ok": `{"type":"mean_reversion","symbol":"BTCUSDT","window":20,"num_std":2}`,
+		"rb-ok": validRuleBased,
+	} {
+		code, body = doJSON(t, srv, http.MethodPost, "/api/v1/strategies", map[string]interface{}{
+			"name": name, "config": parseConfig(t, config),
+		})
+		if code >= 300 {
+			t.Fatalf("%s: status %d: %v", name, code, body)
+		}
+	}
+
+	after, ok := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count", rejected...)
+	if !ok || after-before != 2 {
+		t.Errorf("rejected creates recorded = %g (exported %t), want 2", after-before, ok)
+	}
+	if _, ok := scrapeMetric(t, srv, "signalops_http_request_duration_seconds_count",
+		"route", "/api/v1/strategies", "method", "POST", "status_class", "2xx"); !ok {
+		t.Error("no series for accepted creates")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// strategies.total_pnl, win_rate, total_trades and last_executed_at are derived
+// from trades: total_trades counts orders with a fill, total_pnl sums their pnl,
+// win_rate is the share of closing trades (those with a pnl) that made money
+// (NULL before the first), and last_executed_at is the latest fill. Archived
+// trades are not counted. Store.ApplyFill recomputes a strategy with each fill
+// it books; a background updater catches every other change, recomputing the
+// strategies whose trades changed since its last pass, found by
+// trades.updated_at, and all of them at startup, after archiving or
+// `recompute-pnl` may have changed them.
+
+// strategyStatsOverlap is how far before the watermark each pass looks again, so
+// a trade written by a transaction that started before the last pass and
+// committed after it is not missed
+const strategyStatsOverlap = time.Minute
+
+// recomputeStrategyStats recomputes the aggregates of the named strategies, or of
+// every strategy when names is nil, and returns how many strategies it updated
+func (st *Store) recomputeStrategyStats(ctx context.Context, tx *sql.Tx, names []string) (int64, error) {
+	query := `
+		UPDATE strategies AS s
+		SET (total_pnl, win_rate, total_trades, last_executed_at) = (
+			SELECT COALESCE(SUM(t.pnl), 0),
+			       ` + st.dialect.ratio("COUNT(*) FILTER (WHERE t.pnl > 0)", "COUNT(t.pnl)") + `,
+			       COUNT(*),
+			       MAX(COALESCE(t.executed_at, t.timestamp))
+			FROM trades t
+			WHERE t.strategy_name = s.name AND t.filled_quantity > 0
+		)`
+	var args []interface{}
+	if names != nil {
+		query += ` WHERE ` + st.dialect.inList("s.name", "$1")
+		args = append(args, st.dialect.listArg(names))
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// refreshStrategyStats runs recomputeStrategyStats in a transaction of its own
+func (s *Server) refreshStrategyStats(ctx context.Context, names []string) (int64, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	updated, err := s.store.recomputeStrategyStats(ctx, tx, names)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.refreshLeaderboard(ctx, names...) // nil rebuilds every board
+	return updated, nil
+}
+
+// changedStrategies returns the strategies with trades written after since, and
+// the database time the lookup ran at, the next pass's watermark
+func (s *Server) changedStrategies(ctx context.Context, since time.Time) ([]string, time.Time, error) {
+	ctx, cancel := s.dbContext(ctx)
+	defer cancel()
+	var now time.Time
+	if err := s.db.QueryRowContext(ctx, `SELECT NOW()`).Scan(&now); err != nil {
+		return nil, time.Time{}, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT strategy_name FROM trades WHERE updated_at > $1
+	`, since.Add(-strategyStatsOverlap))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, time.Time{}, err
+		}
+		names = append(names, name)
+	}
+	return names, now, rows.Err()
+}
+
+// runStrategyStats keeps the strategy aggregates current every
+// StrategyStatsInterval until shutdown
+func (s *Server) runStrategyStats() {
+	interval := s.config.StrategyStatsInterval
+	if s.db == nil || interval <= 0 {
+		return
+	}
+
+	// The full pass is retried each interval until it succeeds, so a database
+	// that was down at startup gets one once it is back
+	var watermark time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if watermark.IsZero() {
+			watermark = s.refreshAllStrategyStats()
+		} else if names, now, err := s.changedStrategies(s.streamCtx, watermark); err != nil {
+			log.Printf("Failed to find changed strategies: %v", err)
+		} else if len(names) == 0 {
+			watermark = now
+		} else if _, err := s.refreshStrategyStats(s.streamCtx, names); err != nil {
+			log.Printf("Failed to recompute strategy stats: %v", err) // the watermark stays, so the next pass retries
+		} else {
+			watermark = now
+		}
+
+		select {
+		case <-s.streamCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshAllStrategyStats recomputes every strategy, returning the database time
+// it started at, or the zero time when it failed
+func (s *Server) refreshAllStrategyStats() time.Time {
+	var now time.Time
+	ctx, cancel := s.dbContext(s.streamCtx)
+	err := s.db.QueryRowContext(ctx, `SELECT NOW()`).Scan(&now)
+	cancel()
+	if err == nil {
+		var updated int64
+		if updated, err = s.refreshStrategyStats(s.streamCtx, nil); err == nil {
+			log.Printf("✓ Strategy stats recomputed for %d strategies, refreshed every %s", updated, s.config.StrategyStatsInterval)
+			return now
+		}
+	}
+	log.Printf("Failed to recompute strategy stats: %v", err)
+	return time.Time{}
+}
+
+// recomputeStrategy refreshes one strategy's aggregates on demand:
+// POST /api/v1/strategies/{name}/recompute
+func (s *Server) recomputeStrategy(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+	updated, err := s.refreshStrategyStats(r.Context(), []string{name})
+	if err != nil {
+		logEvent(r.Context(), "Failed to recompute strategy stats", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to recompute strategy stats",
+		})
+		return
+	}
+	if updated == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' not found", name),
+		})
+		return
+	}
+	logEvent(r.Context(), "Strategy stats recomputed", "strategy", name, "by", callerID(r.Context()))
+	// The replica may not have the new stats yet
+	s.getStrategyPerformance(w, r, name, readCurrent)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeseriesCacheTTL is how long a computed equity curve is served from memory
+const timeseriesCacheTTL = time.Minute
+
+// maxTimeseriesBuckets caps the points of one equity curve
+const maxTimeseriesBuckets = 5000
+
+// timeseriesGranularities maps ?granularity= to the date_trunc unit and bucket width
+var timeseriesGranularities = map[string]struct {
+	unit string
+	step time.Duration
+}{
+	"1h": {"hour", time.Hour},
+	"1d": {"day", 24 * time.Hour},
+}
+
+// pnlBucket is one point of a strategy's equity curve
+type pnlBucket struct {
+	Start         time.Time `json:"start"`
+	PnL           float64   `json:"pnl"`
+	CumulativePnL float64   `json:"cumulative_pnl"`
+	Trades        int64     `json:"trades"`
+	Wins          int64     `json:"wins"`
+	WinRate       *float64  `json:"win_rate"`     // nil for buckets without trades
+	Drawdown      float64   `json:"drawdown"`     // below the running peak of cumulative PnL
+	MaxDrawdown   float64   `json:"max_drawdown"` // largest drawdown up to this bucket
+}
+
+// TimeseriesCache keeps computed equity curves for timeseriesCacheTTL, since each
+// one scans every closed trade of the strategy in the range
+type TimeseriesCache struct {
+	entries map[string]timeseriesEntry
+	mu      sync.Mutex
+}
+
+type timeseriesEntry struct {
+	buckets  []pnlBucket
+	cachedAt time.Time
+}
+
+func NewTimeseriesCache() *TimeseriesCache {
+	return &TimeseriesCache{entries: make(map[string]timeseriesEntry)}
+}
+
+func (c *TimeseriesCache) get(key string) ([]pnlBucket, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.cachedAt) >= timeseriesCacheTTL {
+		return nil, false
+	}
+	return entry.buckets, true
+}
+
+func (c *TimeseriesCache) put(key string, buckets []pnlBucket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Expired curves are dropped here, so the map only holds the last minute's queries
+	for k, entry := range c.entries {
+		if time.Since(entry.cachedAt) >= timeseriesCacheTTL {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = timeseriesEntry{buckets: buckets, cachedAt: time.Now()}
+}
+
+// getStrategyTimeseries returns a strategy's realized PnL per hour or day:
+// GET /api/v1/strategies/{name}/performance/timeseries?granularity=1d&from=...&to=...
+// Every bucket in [from, to) is present, with zero PnL where nothing closed, and
+// cumulative PnL starts from zero at from. Defaults to the last 30 days (1d) or
+// 7 days (1h).
+func (s *Server) getStrategyTimeseries(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "1d"
+	}
+	g, ok := timeseriesGranularities[granularity]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "granularity must be 1h or 1d",
+		})
+		return
+	}
+
+	// Bucket edges are aligned to the granularity in UTC, so the default range is
+	// the same for a whole bucket and its cache entry is reused
+	to := time.Now().UTC().Truncate(g.step).Add(g.step)
+	from := to.Add(-30 * g.step)
+	if granularity == "1h" {
+		from = to.Add(-7 * 24 * time.Hour)
+	}
+	for _, param := range []string{"from", "to"} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param),
+			})
+			return
+		}
+		if param == "from" {
+			from = t.UTC().Truncate(g.step)
+		} else {
+			to = t.UTC()
+		}
+	}
+	if !from.Before(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from)/g.step > maxTimeseriesBuckets {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Range spans more than %d %s buckets", maxTimeseriesBuckets, granularity),
+		})
+		return
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%d", name, granularity, from.UnixNano(), to.UnixNano())
+	buckets, cached := s.strategyTimeseries.get(key)
+	if !cached {
+		var exists bool
+		err := s.store.reader(readAnalytics).QueryRowContext(r.Context(), `SELECT EXISTS(SELECT 1 FROM strategies WHERE name = $1)`, name).
+			Scan(&exists)
+		if err == nil && !exists {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"error": fmt.Sprintf("Strategy '%s' not found", name),
+			})
+			return
+		}
+		if err == nil {
+			buckets, err = s.queryPnLBuckets(r, name, g.unit, g.step, from, to)
+		}
+		if err != nil {
+			logEvent(r.Context(), "Failed to query strategy timeseries", "strategy", name, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to fetch performance data",
+			})
+			return
+		}
+		s.strategyTimeseries.put(key, buckets)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"strategy_name": name,
+		"granularity":   granularity,
+		"from":          from.Format(time.RFC3339),
+		"to":            to.Format(time.RFC3339),
+		"buckets":       buckets,
+		"cached":        cached,
+	})
+}
+
+// queryPnLBuckets sums closed trades per bucket and fills the gaps
+func (s *Server) queryPnLBuckets(r *http.Request, name, unit string, step time.Duration,
+	from, to time.Time) ([]pnlBucket, error) {
+	var where whereBuilder
+	where.add("strategy_name = ?", name)
+	where.add("pnl IS NOT NULL")
+	where.add("status = 'FILLED'")
+	where.add("executed_at >= ?", from)
+	where.add("executed_at < ?", to)
+	sums, err := s.store.sumPnL(r.Context(), readAnalytics, &where, unit, time.UTC, false)
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[int64]pnlBucket, len(sums))
+	for _, sum := range sums {
+		totals[sum.Start.Unix()] = pnlBucket{PnL: sum.PnL, Trades: sum.Trades, Wins: sum.Wins}
+	}
+
+	buckets := make([]pnlBucket, 0, int(to.Sub(from)/step)+1)
+	var cumulative, peak, maxDrawdown float64
+	for start := from; start.Before(to); start = start.Add(step) {
+		b := totals[start.Unix()]
+		b.Start = start
+		cumulative += b.PnL
+		if cumulative > peak {
+			peak = cumulative
+		}
+		b.CumulativePnL = cumulative
+		b.Drawdown = peak - cumulative
+		if b.Drawdown > maxDrawdown {
+			maxDrawdown = b.Drawdown
+		}
+		b.MaxDrawdown = maxDrawdown
+		if b.Trades > 0 {
+			winRate := float64(b.Wins) / float64(b.Trades)
+			b.WinRate = &winRate
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Strategy history: every save that changes a strategy's config or description
+// (create, upsert, clone, PATCH of the description, rollback) adds a row to
+// strategy_versions in the same transaction, numbered from 1 per strategy and
+// stamped with the caller. Deleting a strategy only sets deleted_at, which hides
+// it from the list and refuses changes until it is restored; its row, stats and
+// history stay, so performance queries over its trades keep working.
+
+const (
+	strategyCreated    = "created"
+	strategyUpdated    = "updated"
+	strategyRolledBack = "rolled_back"
+)
+
+// errStrategyDeleted is returned for changes to a soft-deleted strategy
+var errStrategyDeleted = errors.New("strategy is deleted")
+
+// strategyVersion is one saved revision of a strategy
+type strategyVersion struct {
+	Version       int                    `json:"version"`
+	Description   string                 `json:"description"`
+	Config        map[string]interface{} `json:"config"`
+	Change        string                 `json:"change"`
+	SourceVersion *int                   `json:"source_version,omitempty"`
+	ChangedBy     string                 `json:"changed_by,omitempty"`
+	ChangedAt     time.Time              `json:"changed_at"`
+}
+
+// recordStrategyVersion adds the strategy's saved description and config to its
+// history within tx and returns the version number. A save that changed neither
+// returns the latest version without adding one, and the first version is always
+// created. source is the version a rollback restored, 0 otherwise.
+func recordStrategyVersion(ctx context.Context, tx *sql.Tx, name, description string, config []byte,
+	change string, source int, changedBy string) (int, error) {
+	var latest int
+	var latestDescription sql.NullString
+	var latestConfig []byte
+	err := tx.QueryRowContext(ctx, `
+		SELECT version, description, config FROM strategy_versions
+		WHERE strategy_name = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`, name).Scan(&latest, &latestDescription, &latestConfig)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil && latestDescription.String == description && sameJSON(latestConfig, config) {
+		return latest, nil
+	}
+	if latest == 0 {
+		change = strategyCreated
+	}
+
+	var sourceVersion sql.NullInt64
+	if source > 0 {
+		sourceVersion = sql.NullInt64{Int64: int64(source), Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO strategy_versions (strategy_name, version, description, config, change, source_version, changed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, name, latest+1, description, config, change, sourceVersion, changedBy)
+	if err != nil {
+		return 0, err
+	}
+	return latest + 1, nil
+}
+
+// sameJSON compares two JSON documents by value, so key order and the spacing
+// Postgres gives jsonb do not count as changes
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// strategyState returns errStrategyNotFound or errStrategyDeleted for a strategy
+// that cannot be changed, nil for one that can
+func strategyState(ctx context.Context, db sqlQueryRower, name string) error {
+	var deleted bool
+	err := db.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM strategies WHERE name = $1`, name).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return errStrategyNotFound
+	case err != nil:
+		return err
+	case deleted:
+		return errStrategyDeleted
+	}
+	return nil
+}
+
+// writeStrategyStateError responds 404 or 409 for the errors of strategyState
+// and reports whether it did
+func writeStrategyStateError(w http.ResponseWriter, name string, err error) bool {
+	switch {
+	case errors.Is(err, errStrategyNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' not found", name),
+		})
+	case errors.Is(err, errStrategyDeleted):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' is deleted; restore it with POST /api/v1/strategies/%s/restore", name, name),
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// listStrategyVersions returns a strategy's history, newest first, also for
+// deleted strategies:
+// GET /api/v1/strategies/{name}/versions?limit=50&before=12
+func (s *Server) listStrategyVersions(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	limit, err := parsePageSize(r.URL.Query().Get("limit"), 50)
+	var where whereBuilder
+	where.add("strategy_name = ?", name)
+	if raw := r.URL.Query().Get("before"); err == nil && raw != "" {
+		before, convErr := strconv.Atoi(raw)
+		if convErr != nil || before < 1 {
+			err = fmt.Errorf("before must be a positive version number")
+		}
+		where.add("version < ?", before)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	if err := strategyState(ctx, s.db, name); errors.Is(err, errStrategyNotFound) {
+		writeStrategyStateError(w, name, err)
+		return
+	} else if err != nil && !errors.Is(err, errStrategyDeleted) {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategy versions",
+		})
+		return
+	}
+
+	// Built before the call: where.arg appends to where.args, and Go does not
+	// order that against reading where.args in the same argument list
+	query := fmt.Sprintf(`
+		SELECT version, description, config, change, source_version, changed_by, changed_at
+		FROM strategy_versions
+		%s
+		ORDER BY version DESC
+		LIMIT %s
+	`, where.sql(), where.arg(limit+1))
+	rows, err := s.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy versions", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategy versions",
+		})
+		return
+	}
+	defer rows.Close()
+
+	versions := make([]strategyVersion, 0)
+	for rows.Next() {
+		var v strategyVersion
+		var description, changedBy sql.NullString
+		var config []byte
+		var source sql.NullInt64
+		if err := rows.Scan(&v.Version, &description, &config, &v.Change, &source, &changedBy, &v.ChangedAt); err != nil {
+			logEvent(r.Context(), "Failed to scan strategy version", "strategy", name, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to fetch strategy versions",
+			})
+			return
+		}
+		v.Description = description.String
+		v.ChangedBy = changedBy.String
+		if err := json.Unmarshal(config, &v.Config); err != nil {
+			logEvent(r.Context(), "Failed to parse config", "strategy", name, "version", v.Version, "error", err)
+		}
+		if source.Valid {
+			sourceVersion := int(source.Int64)
+			v.SourceVersion = &sourceVersion
+		}
+		v.ChangedAt = v.ChangedAt.UTC()
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		logEvent(r.Context(), "Failed to read strategy versions", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to fetch strategy versions",
+		})
+		return
+	}
+
+	response := map[string]interface{}{
+		"strategy": name,
+		"versions": versions,
+		"count":    len(versions),
+	}
+	if len(versions) > limit {
+		versions = versions[:limit]
+		response["versions"] = versions
+		response["count"] = limit
+		response["next_before"] = versions[limit-1].Version
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// rollbackStrategy puts back the config and description of an earlier version,
+// recorded as a new version: POST /api/v1/strategies/{name}/rollback {"version": 3}
+// The old config must still pass validation.
+func (s *Server) rollbackStrategy(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if requestBodyError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid JSON",
+		})
+		return
+	}
+	if req.Version < 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "version is required and must be positive",
+		})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logEvent(r.Context(), "Failed to roll back strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to roll back strategy",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := strategyState(ctx, tx, name); err != nil {
+		if !writeStrategyStateError(w, name, err) {
+			logEvent(r.Context(), "Failed to query strategy", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to roll back strategy",
+			})
+		}
+		return
+	}
+
+	var description sql.NullString
+	var config []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT description, config FROM strategy_versions WHERE strategy_name = $1 AND version = $2
+	`, name, req.Version).Scan(&description, &config)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": fmt.Sprintf("Strategy '%s' has no version %d", name, req.Version),
+		})
+		return
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy version", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to roll back strategy",
+		})
+		return
+	}
+
+	var configMap map[string]interface{}
+	if err := json.Unmarshal(config, &configMap); err != nil || configMap == nil {
+		configMap = make(map[string]interface{})
+	}
+	if errs := validateStrategyConfig(configMap, s.config.StrategyAllowUnknownTypes); errs != nil {
+		writeStrategyConfigError(w, errs)
+		return
+	}
+	configJSON, _ := json.Marshal(configMap)
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE strategies SET description = $2, config = $3, updated_at = NOW() WHERE name = $1
+	`, name, description.String, configJSON); err != nil {
+		logEvent(r.Context(), "Failed to roll back strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to roll back strategy",
+		})
+		return
+	}
+	version, err := recordStrategyVersion(ctx, tx, name, description.String, configJSON,
+		strategyRolledBack, req.Version, callerID(r.Context()))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logEvent(r.Context(), "Failed to roll back strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to roll back strategy",
+		})
+		return
+	}
+	logEvent(r.Context(), "Strategy rolled back", "strategy", name, "to_version", req.Version, "version", version)
+
+	strategy, err := s.loadStrategy(ctx, name)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Strategy rolled back but could not be reloaded",
+		})
+		return
+	}
+	strategy["rolled_back_to"] = req.Version
+	writeJSON(w, http.StatusOK, strategy)
+}
+
+// restoreStrategy undoes a soft delete: POST /api/v1/strategies/{name}/restore
+// The strategy comes back inactive, as deleting left it.
+func (s *Server) restoreStrategy(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.dbAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"error": "Database not available",
+		})
+		return
+	}
+
+	ctx, cancel := s.dbContext(r.Context())
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE strategies SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW()
+		WHERE name = $1 AND deleted_at IS NOT NULL
+	`, name)
+	if err != nil {
+		logEvent(r.Context(), "Failed to restore strategy", "strategy", name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to restore strategy",
+		})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		err := strategyState(ctx, s.db, name)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": fmt.Sprintf("Strategy '%s' is not deleted", name),
+			})
+		case !writeStrategyStateError(w, name, err):
+			logEvent(r.Context(), "Failed to query strategy", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error": "Failed to restore strategy",
+			})
+		}
+		return
+	}
+	logEvent(r.Context(), "Strategy restored", "strategy", name)
+	s.refreshLeaderboard(ctx, name)
+
+	strategy, err := s.loadStrategy(ctx, name)
+	if err != nil {
+		logEvent(r.Context(), "Failed to query strategy", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "Strategy restored but could not be reloaded",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, strategy)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTickerLimit = 50
+	maxTickerLimit     = 5000
+)
+
+// Sort keys accepted by the tickers endpoint and GetTickers
+var tickerSortKeys = map[string]func(t *TickerData) float64{
+	"price_change_percent": func(t *TickerData) float64 { return t.PriceChangePercent },
+	"quote_volume":         func(t *TickerData) float64 { return t.QuoteVolume },
+	"volume":               func(t *TickerData) float64 { return t.Volume },
+}
+
+// tickerLister is implemented by exchanges that return every 24h ticker in one call
+type tickerLister interface {
+	GetAllTickers() ([]TickerData, error)
+}
+
+// TickerCache keeps each exchange's full ticker list for a few seconds, so the
+// overview endpoints sort and slice a cached copy instead of refetching ~2MB.
+// Concurrent misses wait for one fetch.
+type TickerCache struct {
+	ttl     time.Duration
+	entries map[string]*tickerSnapshot
+	mu      sync.Mutex
+}
+
+type tickerSnapshot struct {
+	tickers   []TickerData
+	fetchedAt time.Time
+}
+
+func NewTickerCache(ttl time.Duration) *TickerCache {
+	return &TickerCache{ttl: ttl, entries: make(map[string]*tickerSnapshot)}
+}
+
+// get returns the cached tickers for exchange, refreshing them when older than
+// the TTL. The returned slice is shared and must not be modified.
+func (c *TickerCache) get(exchange string, fetch func() ([]TickerData, error)) (*tickerSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[exchange]; ok && time.Since(entry.fetchedAt) < c.ttl {
+		return entry, nil
+	}
+	tickers, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	entry := &tickerSnapshot{tickers: tickers, fetchedAt: time.Now()}
+	c.entries[exchange] = entry
+	return entry, nil
+}
+
+// tickerQuery selects and orders tickers from the cache
+type tickerQuery struct {
+	Exchange   string
+	QuoteAsset string // e.g. USDT keeps only *USDT pairs; empty keeps all
+	SortBy     string // a tickerSortKeys key; empty keeps exchange order
+	Ascending  bool
+	Limit      int
+}
+
+// validate checks the query and fills in the default limit
+func (q *tickerQuery) validate() error {
+	if _, ok := tickerSortKeys[q.SortBy]; q.SortBy != "" && !ok {
+		return fmt.Errorf("sort must be price_change_percent, quote_volume or volume")
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultTickerLimit
+	}
+	if q.Limit < 1 || q.Limit > maxTickerLimit {
+		return fmt.Errorf("limit must be an integer between 1 and %d", maxTickerLimit)
+	}
+	return nil
+}
+
+// tickerSource finds an exchange able to list all its tickers
+func (s *Server) tickerSource(name string) (tickerLister, error) {
+	s.mu.RLock()
+	exchange, exists := s.exchanges[name]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("exchange %s not configured", name)
+	}
+	lister, ok := exchange.(tickerLister)
+	if !ok {
+		return nil, fmt.Errorf("exchange %s does not list tickers", name)
+	}
+	return lister, nil
+}
+
+// marketTickers answers a validated tickerQuery from the ticker cache
+func (s *Server) marketTickers(lister tickerLister, q tickerQuery) ([]TickerData, time.Time, error) {
+	snapshot, err := s.tickers.get(q.Exchange, lister.GetAllTickers)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	quote := strings.ToUpper(q.QuoteAsset)
+	tickers := make([]TickerData, 0, len(snapshot.tickers))
+	for _, t := range snapshot.tickers {
+		if quote == "" || (strings.HasSuffix(t.Symbol, quote) && len(t.Symbol) > len(quote)) {
+			tickers = append(tickers, t)
+		}
+	}
+	if key := tickerSortKeys[q.SortBy]; key != nil {
+		sort.SliceStable(tickers, func(i, j int) bool {
+			if q.Ascending {
+				return key(&tickers[i]) < key(&tickers[j])
+			}
+			return key(&tickers[i]) > key(&tickers[j])
+		})
+	}
+	if len(tickers) > q.Limit {
+		tickers = tickers[:q.Limit]
+	}
+	return tickers, snapshot.fetchedAt, nil
+}
+
+// handleGetTickers serves the market overview:
+// GET /api/v1/market/{exchange}/tickers?quote=USDT&sort=price_change_percent&order=desc&limit=20
+func (s *Server) handleGetTickers(w http.ResponseWriter, r *http.Request, exchange string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	q := tickerQuery{
+		Exchange:   exchange,
+		QuoteAsset: query.Get("quote"),
+		SortBy:     query.Get("sort"),
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "order must be asc or desc"})
+		return
+	}
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			parsed = -1 // rejected by validate
+		}
+		q.Limit = parsed
+	}
+
+	lister, err := s.tickerSource(exchange)
+	if err == nil {
+		err = q.validate()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	tickers, fetchedAt, err := s.marketTickers(lister, q)
+	if err != nil {
+		logEvent(r.Context(), "Failed to load tickers", "exchange", exchange, "error", err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	rows := make([]map[string]interface{}, len(tickers))
+	for i, t := range tickers {
+		rows[i] = map[string]interface{}{
+			"symbol":               t.Symbol,
+			"price":                t.Price,
+			"price_change":         t.PriceChange,
+			"price_change_percent": t.PriceChangePercent,
+			"volume":               t.Volume,
+			"quote_volume":         t.QuoteVolume,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exchange":   exchange,
+		"tickers":    rows,
+		"count":      len(rows),
+		"fetched_at": fetchedAt.Format(time.RFC3339Nano),
+	})
+}
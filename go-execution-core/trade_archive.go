@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Finished trades older than the retention move from trades to trades_archive in
+// batches, each batch one statement, so a row is never in both tables or neither.
+// A trade is finished once its status is terminal and its fill is fully booked
+// into positions; open and UNKNOWN orders stay where the reconciler can reach them.
+
+const archivableTradeCondition = `
+	timestamp < $1
+	AND status IN ('FILLED', 'CANCELED', 'REJECTED', 'EXPIRED', 'FAILED')
+	AND booked_quantity >= COALESCE(filled_quantity, 0)
+`
+
+// tradeColumns lists the columns of trades in table order
+func tradeColumns(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'trades'
+		ORDER BY ordinal_position
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, pq.QuoteIdentifier(column))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("trades table not found")
+	}
+	return columns, nil
+}
+
+// countArchivableTrades counts the trades archiveTrades would move
+func countArchivableTrades(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM trades WHERE `+archivableTradeCondition, cutoff).Scan(&n)
+	return n, err
+}
+
+// archiveTrades moves finished trades placed before cutoff into trades_archive,
+// batch rows at a time, and returns how many moved. Rows locked by a concurrent
+// update are skipped and left for the next run.
+func archiveTrades(ctx context.Context, db *sql.DB, cutoff time.Time, batch int) (int64, error) {
+	columns, err := tradeColumns(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read trades columns: %w", err)
+	}
+	list := strings.Join(columns, ", ")
+	query := `
+		WITH moved AS (
+			DELETE FROM trades
+			WHERE id IN (
+				SELECT id FROM trades
+				WHERE ` + archivableTradeCondition + `
+				ORDER BY timestamp
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + list + `
+		)
+		INSERT INTO trades_archive (` + list + `)
+		SELECT ` + list + ` FROM moved
+	`
+
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, query, cutoff, batch)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batch) {
+			return total, nil
+		}
+	}
+}
+
+// runArchiveTradesCommand is `execution-engine archive-trades`
+func runArchiveTradesCommand(args []string) int {
+	usage := "usage: execution-engine archive-trades [--older-than DURATION] [--batch N] [--dry-run]"
+	config := loadConfig()
+
+	flags := flag.NewFlagSet("archive-trades", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", config.TradeArchiveAfter, "archive finished trades placed longer ago than this")
+	batch := flags.Int("batch", config.TradeArchiveBatch, "rows moved per statement")
+	dryRun := flags.Bool("dry-run", false, "only count the trades that would move")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || *olderThan <= 0 || *batch <= 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if err := requirePostgres(config.DatabaseURL, "archive-trades"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := initDatabase(config.DatabaseURL, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	cutoff := time.Now().Add(-*olderThan)
+	ctx := context.Background()
+	if *dryRun {
+		n, err := countArchivableTrades(ctx, db, cutoff)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to count trades: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%d trades placed before %s would be archived\n", n, cutoff.Format(time.RFC3339))
+		return 0
+	}
+
+	n, err := archiveTrades(ctx, db, cutoff, *batch)
+	fmt.Printf("Archived %d trades placed before %s\n", n, cutoff.Format(time.RFC3339))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archiving stopped: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	pb "execution-engine/pb"
+)
+
+// TradeRecord is the trades row written when an order is placed. Every path that
+// records a new order (SubmitOrder and the REST routes served by it, batch legs,
+// position closes, the order journal) builds one and writes it with
+// Store.ApplyFill, which inserts it with insertTrade.
+type TradeRecord struct {
+	OrderID          string    `json:"order_id"`
+	StrategyName     string    `json:"strategy_name"`
+	Symbol           string    `json:"symbol"`
+	Side             string    `json:"side"`
+	OrderType        string    `json:"order_type"`
+	Quantity         float64   `json:"quantity"`
+	Price            float64   `json:"price"` // limit price, 0 for market orders
+	ExecutedPrice    float64   `json:"executed_price"`
+	Status           string    `json:"status"`
+	Exchange         string    `json:"exchange"` // base exchange, without the account
+	Account          string    `json:"account"`
+	Timestamp        time.Time `json:"timestamp"`
+	ExecutedAt       time.Time `json:"executed_at"`
+	Fees             float64   `json:"fees"`
+	ExchangeOrderID  string    `json:"exchange_order_id"`
+	ExecutedQuantity float64   `json:"executed_quantity"`
+}
+
+// newTradeRecord is the trades row of a submitted order request
+func newTradeRecord(req *pb.OrderRequest, result *OrderResult) *TradeRecord {
+	return &TradeRecord{
+		OrderID:          req.OrderId,
+		StrategyName:     req.StrategyName,
+		Symbol:           req.Symbol,
+		Side:             req.Side,
+		OrderType:        req.OrderType,
+		Quantity:         req.Quantity,
+		Price:            req.Price,
+		ExecutedPrice:    result.ExecutedPrice,
+		Status:           result.Status,
+		Exchange:         req.Exchange,
+		Account:          req.Account,
+		Timestamp:        time.Now(),
+		ExecutedAt:       result.Timestamp,
+		Fees:             result.Fees,
+		ExchangeOrderID:  result.ExchangeOrderID,
+		ExecutedQuantity: result.ExecutedQuantity,
+	}
+}
+
+// sqlExecer is a *sql.DB or *sql.Tx
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+const insertTradeQuery = `
+	INSERT INTO trades
+	(order_id, strategy_name, symbol, side, order_type, quantity, price, executed_price,
+	 status, exchange, timestamp, executed_at, fees, account_type, account,
+	 exchange_order_id, filled_quantity)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+`
+
+// insertTrade writes t with db. A replayed row may already have been written by
+// an attempt that only looked failed, so replays skip rows that exist.
+func insertTrade(ctx context.Context, db sqlExecer, t *TradeRecord, replay bool) error {
+	query := insertTradeQuery
+	if replay {
+		query += ` ON CONFLICT (order_id) DO NOTHING`
+	}
+	_, err := db.ExecContext(ctx, query,
+		t.OrderID,
+		t.StrategyName,
+		t.Symbol,
+		t.Side,
+		t.OrderType,
+		t.Quantity,
+		t.Price,
+		t.ExecutedPrice,
+		t.Status,
+		t.Exchange,
+		t.Timestamp,
+		t.ExecutedAt,
+		t.Fees,
+		accountTypeForExchange(t.Exchange),
+		t.Account,
+		t.ExchangeOrderID,
+		t.ExecutedQuantity,
+	)
+	return err
+}
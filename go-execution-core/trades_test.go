@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// insertColumns are the columns insertTradeQuery lists, in order
+func insertColumns(t *testing.T) []string {
+	t.Helper()
+	match := regexp.MustCompile(`(?s)INSERT INTO trades\s*\(([^)]*)\)`).FindStringSubmatch(insertTradeQuery)
+	if match == nil {
+		t.Fatal("no column list in insertTradeQuery")
+	}
+	var columns []string
+	for _, column := range strings.Split(match[1], ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	return columns
+}
+
+// TestInsertTradeColumns checks every TradeRecord field lands in its own column,
+// by name rather than by position, including order_type and filled_quantity
+func TestInsertTradeColumns(t *testing.T) {
+	placed := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	record := &TradeRecord{
+		OrderID:          "ord-1",
+		StrategyName:     "momentum",
+		Symbol:           "BTCUSDT",
+		Side:             "BUY",
+		OrderType:        "LIMIT",
+		Quantity:         0.5,
+		Price:            29000,
+		ExecutedPrice:    28990,
+		Status:           "PARTIALLY_FILLED",
+		Exchange:         "binance_futures",
+		Account:          "desk-2",
+		Timestamp:        placed,
+		ExecutedAt:       placed.Add(time.Second),
+		Fees:             1.25,
+		ExchangeOrderID:  "123456",
+		ExecutedQuantity: 0.25,
+	}
+	want := map[string]driver.Value{
+		"order_id":          "ord-1",
+		"strategy_name":     "momentum",
+		"symbol":            "BTCUSDT",
+		"side":              "BUY",
+		"order_type":        "LIMIT",
+		"quantity":          0.5,
+		"price":             29000.0,
+		"executed_price":    28990.0,
+		"status":            "PARTIALLY_FILLED",
+		"exchange":          "binance_futures",
+		"timestamp":         placed,
+		"executed_at":       placed.Add(time.Second),
+		"fees":              1.25,
+		"account_type":      "futures",
+		"account":           "desk-2",
+		"exchange_order_id": "123456",
+		"filled_quantity":   0.25,
+	}
+
+	columns := insertColumns(t)
+	if len(columns) != len(want) {
+		t.Fatalf("insertTradeQuery lists %d columns %v, want %d", len(columns), columns, len(want))
+	}
+	args := make([]driver.Value, len(columns))
+	for i, column := range columns {
+		value, ok := want[column]
+		if !ok {
+			t.Fatalf("insertTradeQuery writes unexpected column %s", column)
+		}
+		args[i] = value
+	}
+
+	for _, replay := range []bool{false, true} {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := insertTradeQuery
+		if replay {
+			query += ` ON CONFLICT (order_id) DO NOTHING`
+		}
+		mock.ExpectExec(query).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := insertTrade(context.Background(), db, record, replay); err != nil {
+			t.Errorf("replay %t: %v", replay, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("replay %t: %v", replay, err)
+		}
+		db.Close()
+	}
+}
+
+// TestInsertTradeMarketOrder checks a market order stores no order_type of its
+// own: the empty string goes in as such and NULLIF turns it into NULL
+func TestInsertTradeMarketOrder(t *testing.T) {
+	if !strings.Contains(insertTradeQuery, "NULLIF($5, '')") {
+		t.Fatal("order_type is no longer written through NULLIF")
+	}
+	if columns := insertColumns(t); columns[4] != "order_type" {
+		t.Fatalf("$5 is %s, want order_type", columns[4])
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	args := make([]driver.Value, 17)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[4] = ""
+	args[13] = "spot"
+	mock.ExpectExec(`INSERT INTO trades`).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	record := &TradeRecord{OrderID: "ord-2", StrategyName: "momentum", Symbol: "ETHUSDT", Side: "SELL", Quantity: 1, Exchange: "binance"}
+	if err := insertTrade(context.Background(), db, record, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
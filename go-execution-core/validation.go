@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var validOrderSides = map[string]bool{"BUY": true, "SELL": true}
+
+var validOrderTypes = map[string]bool{
+	"MARKET":            true,
+	"LIMIT":             true,
+	"STOP_LOSS_LIMIT":   true,
+	"TAKE_PROFIT_LIMIT": true,
+}
+
+// FieldError describes one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError collects every problem with an order so callers can fix them in one go
+type validationError []FieldError
+
+func (e validationError) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid order: " + strings.Join(parts, "; ")
+}
+
+// symbolLister is implemented by exchanges that publish their tradable symbols
+type symbolLister interface {
+	KnownSymbols() (map[string]bool, error)
+}
+
+// validateOrder checks an order before it is sent to the exchange. Side and type
+// are upper-cased in place; the symbol is only checked against exchanges that
+// list their symbols. Returns nil when the order is valid.
+func validateOrder(exchange Exchange, order *Order) validationError {
+	var errs validationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	order.Side = strings.ToUpper(order.Side)
+	order.OrderType = strings.ToUpper(order.OrderType)
+
+	if strings.TrimSpace(order.StrategyName) == "" {
+		add("strategy_name", "is required")
+	}
+	if !validOrderSides[order.Side] {
+		add("side", "must be BUY or SELL, got %q", order.Side)
+	}
+	if !validOrderTypes[order.OrderType] {
+		add("order_type", "must be MARKET, LIMIT, STOP_LOSS_LIMIT or TAKE_PROFIT_LIMIT, got %q", order.OrderType)
+	}
+
+	if math.IsNaN(order.Quantity) || math.IsInf(order.Quantity, 0) {
+		add("quantity", "must be a finite number")
+	} else if order.Quantity <= 0 {
+		add("quantity", "must be positive")
+	}
+
+	// Market orders may omit the price; every other type needs one
+	if math.IsNaN(order.Price) || math.IsInf(order.Price, 0) {
+		add("price", "must be a finite number")
+	} else if order.Price < 0 {
+		add("price", "must be positive")
+	} else if order.Price == 0 && validOrderTypes[order.OrderType] && order.OrderType != "MARKET" {
+		add("price", "is required for %s orders", order.OrderType)
+	}
+
+	if order.Symbol == "" {
+		add("symbol", "is required")
+	} else if lister, ok := exchange.(symbolLister); ok {
+		// An unreachable symbol list should not block trading; the exchange still validates
+		if symbols, err := lister.KnownSymbols(); err == nil && !symbols[order.Symbol] {
+			add("symbol", "%s is not traded on this exchange", order.Symbol)
+		}
+	}
+
+	return errs
+}
+
+// prefixed qualifies field names, e.g. for the legs of a batch ("orders[2].side")
+func (e validationError) prefixed(prefix string) validationError {
+	out := make(validationError, len(e))
+	for i, fe := range e {
+		out[i] = FieldError{Field: prefix + fe.Field, Message: fe.Message}
+	}
+	return out
+}
+
+// writeValidationError responds 422 with the field-by-field list
+func writeValidationError(w http.ResponseWriter, errs validationError) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success": false,
+		"error":   "Order validation failed",
+		"errors":  []FieldError(errs),
+	})
+}
+
+// symbolCacheTTL is how often exchange symbol lists are refreshed
+const symbolCacheTTL = time.Hour
+
+// symbolCache holds an exchange's symbol list, refetched after symbolCacheTTL. A
+// failed refresh keeps serving the previous list.
+type symbolCache struct {
+	mu      sync.Mutex
+	symbols map[string]bool
+	fetched time.Time
+}
+
+func (c *symbolCache) get(fetch func() (map[string]bool, error)) (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.symbols != nil && time.Since(c.fetched) < symbolCacheTTL {
+		return c.symbols, nil
+	}
+	symbols, err := fetch()
+	if err != nil {
+		if c.symbols != nil {
+			return c.symbols, nil
+		}
+		return nil, err
+	}
+	c.symbols, c.fetched = symbols, time.Now()
+	return symbols, nil
+}
+
+// fetchBinanceSymbols reads the TRADING symbols from a Binance exchangeInfo endpoint
+// (spot and futures share the format)
+func fetchBinanceSymbols(client *http.Client, reqURL string) (map[string]bool, error) {
+	resp, err := client.Get(reqURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("binance API error: %s - %s", resp.Status, string(body))
+	}
+
+	var info struct {
+		Symbols []struct {
+			Symbol string `json:"symbol"`
+			Status string `json:"status"`
+		} `json:"symbols"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange info: %w", err)
+	}
+
+	symbols := make(map[string]bool, len(info.Symbols))
+	for _, s := range info.Symbols {
+		if s.Status == "TRADING" {
+			symbols[s.Symbol] = true
+		}
+	}
+	return symbols, nil
+}
@@ -6,13 +6,35 @@ from the Go execution engine which handles real exchange connectivity.
 """
 
 import grpc
+import hashlib
+import hmac
 import json
 import requests
+import time
 from typing import Dict, Optional
 from datetime import datetime
 import os
 
 
+class SignedRequestAuth(requests.auth.AuthBase):
+    """Signs state-changing requests with X-Timestamp and X-Signature (HMAC-SHA256)."""
+
+    def __init__(self, secret: str):
+        self.secret = secret.encode()
+
+    def __call__(self, r):
+        if r.method in ('GET', 'HEAD', 'OPTIONS'):
+            return r
+        timestamp = str(int(time.time()))
+        body = r.body or b''
+        if isinstance(body, str):
+            body = body.encode()
+        message = (timestamp + r.method + r.path_url).encode() + body
+        r.headers['X-Timestamp'] = timestamp
+        r.headers['X-Signature'] = hmac.new(self.secret, message, hashlib.sha256).hexdigest()
+        return r
+
+
 class ExecutionClient:
     """
     Client for communicating with Go Execution Engine.
@@ -30,6 +52,18 @@ class ExecutionClient:
         """
         self.grpc_url = grpc_url or os.getenv('GO_EXECUTION_GRPC_URL', 'localhost:50050')
         self.http_url = http_url or os.getenv('GO_EXECUTION_URL', 'http://localhost:8080')
+
+        # REST API key (X-API-Key) for the HTTP fallback, signed when a secret is set
+        self.http_session = requests.Session()
+        if os.getenv('EXECUTION_API_KEY'):
+            self.http_session.headers['X-API-Key'] = os.getenv('EXECUTION_API_KEY')
+        if os.getenv('EXECUTION_API_SECRET'):
+            self.http_session.auth = SignedRequestAuth(os.getenv('EXECUTION_API_SECRET'))
+        # The same key authenticates gRPC calls as x-api-key metadata. Signed keys
+        # can only read over gRPC, so their orders fail there and fall back to REST.
+        self.grpc_metadata = []
+        if os.getenv('EXECUTION_API_KEY'):
+            self.grpc_metadata.append(('x-api-key', os.getenv('EXECUTION_API_KEY')))
         self.use_grpc = False  # Start with HTTP fallback
 
         # Try to establish gRPC connection
@@ -120,7 +154,10 @@ class ExecutionClient:
         """Submit order via HTTP REST API."""
         try:
             url = f"{self.http_url}/api/v1/orders"
-            response = requests.post(url, json=order, timeout=10)
+            # Retrying with the same key replays the original result instead of
+            # placing a second order
+            headers = {'Idempotency-Key': order['order_id']}
+            response = self.http_session.post(url, json=order, headers=headers, timeout=10)
 
             if response.ok:
                 return response.json()
@@ -139,7 +176,7 @@ class ExecutionClient:
         """Get market data via HTTP."""
         try:
             url = f"{self.http_url}/api/v1/market/{exchange}/{symbol}"
-            response = requests.get(url, timeout=10)
+            response = self.http_session.get(url, timeout=10)
 
             if response.ok:
                 return response.json()
@@ -156,7 +193,7 @@ class ExecutionClient:
         """Get balance via HTTP."""
         try:
             url = f"{self.http_url}/api/v1/balance/{exchange}"
-            response = requests.get(url, timeout=10)
+            response = self.http_session.get(url, timeout=10)
 
             if response.ok:
                 return response.json()
@@ -190,7 +227,7 @@ class ExecutionClient:
             )
             
             # Call gRPC service
-            response = stub.SubmitOrder(request, timeout=10)
+            response = stub.SubmitOrder(request, timeout=10, metadata=self.grpc_metadata)
             
             return {
                 'success': response.success,
@@ -221,7 +258,7 @@ class ExecutionClient:
             )
             
             # Call gRPC service
-            response = stub.GetMarketData(request, timeout=10)
+            response = stub.GetMarketData(request, timeout=10, metadata=self.grpc_metadata)
             
             return {
                 'symbol': response.symbol,
@@ -253,7 +290,7 @@ class ExecutionClient:
             )
             
             # Call gRPC service
-            response = stub.GetBalance(request, timeout=10)
+            response = stub.GetBalance(request, timeout=10, metadata=self.grpc_metadata)
             
             # Convert balances
             balances = {}
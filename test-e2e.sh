@@ -49,7 +49,7 @@ echo ""
 
 # Test 4: Market Data
 echo "Step 5: Testing Market Data Endpoint..."
-market_response=$(curl -s http://localhost:8080/api/v1/market/binance/BTCUSDT)
+market_response=$(curl -s -H "X-API-Key: ${EXECUTION_API_KEY}" http://localhost:8080/api/v1/market/binance/BTCUSDT)
 if echo "$market_response" | grep -q "price"; then
     echo "✓ Market data endpoint working"
     price=$(echo "$market_response" | grep -o '"price":[0-9.]*' | head -1)
@@ -77,6 +77,7 @@ EOF
 )
 
 order_response=$(curl -s -X POST http://localhost:8080/api/v1/orders \
+    -H "X-API-Key: ${EXECUTION_API_KEY}" \
     -H "Content-Type: application/json" \
     -d "$order_json")
 
@@ -101,7 +101,7 @@ echo ""
 
 # Test Go REST API
 echo "Testing Go REST API..."
-if response=$(curl -s http://localhost:8080/api/v1/market/binance/BTCUSDT 2>/dev/null); then
+if response=$(curl -s -H "X-API-Key: ${EXECUTION_API_KEY}" http://localhost:8080/api/v1/market/binance/BTCUSDT 2>/dev/null); then
     echo "✓ Market data endpoint working"
     echo "$response" | grep -o '"symbol":"[^"]*"' | head -1
     echo "$response" | grep -o '"price":[0-9.]*' | head -1
@@ -128,6 +128,7 @@ EOF
 )
 
 if response=$(curl -s -X POST http://localhost:8080/api/v1/orders \
+    -H "X-API-Key: ${EXECUTION_API_KEY}" \
     -H "Content-Type: application/json" \
     -d "$order_json" 2>/dev/null); then
     echo "✓ Order submission endpoint working"